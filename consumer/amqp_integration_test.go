@@ -0,0 +1,100 @@
+// +build integration
+
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"gollum/core"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/trivago/tgo/ttesting"
+)
+
+// getAMQPTestServer returns the broker used for integration tests, e.g.
+// started by "docker run -p 5672:5672 rabbitmq:3".
+func getAMQPTestServer(t *testing.T) string {
+	server := os.Getenv("GOLLUM_AMQP_SERVER")
+	if server == "" {
+		t.Skip("GOLLUM_AMQP_SERVER is not set")
+	}
+	return server
+}
+
+func TestAMQPConsumeAndAck(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	server := getAMQPTestServer(t)
+	queue := "gollum-" + t.Name()
+
+	conn, err := amqp.Dial(server)
+	expect.NoError(err)
+	defer conn.Close()
+
+	channel, err := conn.Channel()
+	expect.NoError(err)
+	// Deleted after the consumer has been stopped
+	defer channel.QueueDelete(queue, false, false, false)
+
+	router := newMockRouter(t.Name(), 1)
+	cons := newAMQPTestConsumer(t, map[string]interface{}{
+		"Servers":     []string{server},
+		"Queue":       queue,
+		"Declare":     true,
+		"Durable":     false,
+		"Exchange":    "amq.topic",
+		"RoutingKey":  "gollum.#",
+		"SetMetadata": true,
+	})
+
+	workers := new(sync.WaitGroup)
+	go cons.Consume(workers)
+	defer func() {
+		cons.Control() <- core.PluginControlStopConsumer
+		workers.Wait()
+	}()
+
+	// Wait for the queue to be declared and bound
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		// A failed passive declare closes the channel, so a new one is used
+		probe, err := conn.Channel()
+		expect.NoError(err)
+		state, err := probe.QueueDeclarePassive(queue, false, false, false, false, nil)
+		probe.Close()
+		if err == nil && state.Consumers > 0 {
+			break
+		}
+	}
+
+	err = channel.PublishWithContext(context.Background(), "amq.topic", "gollum.test", false, false, amqp.Publishing{
+		Body: []byte("message"),
+	})
+	expect.NoError(err)
+
+	msg := router.receive(t, 1)[0]
+	expect.Equal("message", msg.String())
+	expect.MapEqual(msg.GetMetadata(), "routing_key", "gollum.test")
+
+	// The message has been acknowledged and removed from the queue
+	time.Sleep(100 * time.Millisecond)
+	state, err := channel.QueueDeclarePassive(queue, false, false, false, false, nil)
+	expect.NoError(err)
+	expect.Equal(0, state.Messages)
+}
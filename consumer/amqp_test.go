@@ -0,0 +1,162 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"gollum/core"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/trivago/tgo/ttesting"
+)
+
+// mockAcknowledger records the acknowledgement of a delivery
+type mockAcknowledger struct {
+	acked   bool
+	nacked  bool
+	requeue bool
+}
+
+func (ack *mockAcknowledger) Ack(tag uint64, multiple bool) error {
+	ack.acked = true
+	return nil
+}
+
+func (ack *mockAcknowledger) Nack(tag uint64, multiple bool, requeue bool) error {
+	ack.nacked = true
+	ack.requeue = requeue
+	return nil
+}
+
+func (ack *mockAcknowledger) Reject(tag uint64, requeue bool) error {
+	return ack.Nack(tag, false, requeue)
+}
+
+func TestAMQPAckOnEnqueue(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	router := newMockRouter(t.Name(), 1)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.AMQP")
+	config.Override("Streams", t.Name())
+	config.Override("SetMetadata", true)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*AMQP)
+	expect.True(casted)
+
+	ack := &mockAcknowledger{}
+	cons.handleDelivery(amqp.Delivery{
+		Acknowledger: ack,
+		Exchange:     "logs",
+		RoutingKey:   "nginx.access",
+		Headers:      amqp.Table{"trace.id": "abc"},
+		Body:         []byte("message"),
+	})
+
+	msg := router.receive(t, 1)[0]
+	expect.Equal("message", msg.String())
+	expect.True(ack.acked)
+	expect.False(ack.nacked)
+
+	metadata := msg.GetMetadata()
+	expect.MapEqual(metadata, "exchange", "logs")
+	expect.MapEqual(metadata, "routing_key", "nginx.access")
+	expect.Equal("abc", metadata["header.trace.id"])
+}
+
+func TestAMQPRequeueOnStop(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	// Reserve a port nobody listens on
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	expect.NoError(err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	router := newMockRouter(t.Name(), 1)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.AMQP")
+	config.Override("Streams", t.Name())
+	config.Override("Servers", []string{"amqp://" + address + "/"})
+	config.Override("ReconnectDelayMs", 10)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*AMQP)
+	expect.True(casted)
+
+	workers := new(sync.WaitGroup)
+	go cons.Consume(workers)
+
+	// Reconnect attempts are stopped together with the consumer
+	for start := time.Now(); cons.GetState() != core.PluginStateActive && time.Since(start) < time.Second; {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	cons.Control() <- core.PluginControlStopConsumer
+	expect.True(waitForWorkers(workers, time.Second))
+
+	ack := &mockAcknowledger{}
+	cons.handleDelivery(amqp.Delivery{
+		Acknowledger: ack,
+		Body:         []byte("message"),
+	})
+
+	expect.False(ack.acked)
+	expect.True(ack.nacked)
+	expect.True(ack.requeue)
+	expect.Equal(0, len(router.messages))
+}
+
+func TestAMQPConfigErrors(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	for idx, settings := range []map[string]interface{}{
+		{"Servers": []string{}},
+		{"Servers": []string{"http://localhost"}},
+		{"Queue": ""},
+	} {
+		config := core.NewPluginConfig(fmt.Sprintf("%s%d", t.Name(), idx), "consumer.AMQP")
+		for key, value := range settings {
+			config.Override(key, value)
+		}
+		_, err := core.NewPluginWithConfig(config)
+		expect.NotNil(err)
+	}
+}
+
+func waitForWorkers(workers *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
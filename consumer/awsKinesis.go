@@ -19,6 +19,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -30,6 +31,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/trivago/tgo/tcontainer"
 )
 
 const (
@@ -37,10 +39,35 @@ const (
 	kinesisOffsetOldest = "oldest"
 )
 
+// kinesisClient is the subset of the kinesis API used by AwsKinesis
+type kinesisClient interface {
+	DescribeStream(*kinesis.DescribeStreamInput) (*kinesis.DescribeStreamOutput, error)
+	GetShardIterator(*kinesis.GetShardIteratorInput) (*kinesis.GetShardIteratorOutput, error)
+	GetRecords(*kinesis.GetRecordsInput) (*kinesis.GetRecordsOutput, error)
+	RegisterStreamConsumer(*kinesis.RegisterStreamConsumerInput) (*kinesis.RegisterStreamConsumerOutput, error)
+	DescribeStreamConsumer(*kinesis.DescribeStreamConsumerInput) (*kinesis.DescribeStreamConsumerOutput, error)
+	SubscribeToShard(*kinesis.SubscribeToShardInput) (*kinesis.SubscribeToShardOutput, error)
+}
+
 // AwsKinesis consumer
 //
 // This consumer reads a message from an AWS Kinesis router.
 //
+// Shards created by resharding are read after all of their parent shards
+// have been read completely. If a parent shard has been read by this
+// consumer, its child shards are read from the oldest available record so
+// that no data is skipped.
+//
+// Metadata
+//
+// *NOTE: The metadata will only set if the parameter `SetMetadata` is active.*
+//
+// - partition_key: Partition key of the record
+//
+// - sequence_number: Sequence number of the record
+//
+// - shard_id: Id of the shard the record was read from
+//
 // Parameters
 //
 // - KinesisStream: This value defines the stream to read from.
@@ -67,13 +94,29 @@ const (
 // By default this parameter is set to "4".
 //
 // - CheckNewShardsSec: This value sets a timer to update shards in Kinesis.
-// You can set this parameter to "0" for disabling.
+// You can set this parameter to "0" for disabling. Child shards of a shard
+// that has been read completely are discovered regardless of this setting.
 // By default this parameter is set to "0".
 //
 // - DefaultOffset: This value defines the message index to start reading from.
 // Valid values are either "newest", "oldest", or a number.
 // By default this parameter is set to "newest".
 //
+// - EnhancedFanOut: When set to true, records are pushed to this consumer
+// using SubscribeToShard instead of being polled with GetRecords. This
+// gives each consumer a dedicated throughput per shard but is billed
+// separately by AWS. The consumer is registered with the name given by
+// ConsumerName if required.
+// By default this parameter is set to false.
+//
+// - ConsumerName: Defines the name used to register this consumer when
+// EnhancedFanOut is enabled.
+// By default this parameter is set to "gollum".
+//
+// - SetMetadata: When this value is set to "true", the fields mentioned in the metadata
+// section will be added to each message.
+// By default this parameter is set to false.
+//
 // Examples
 //
 // This example consumes a kinesis stream "myStream" and create messages:
@@ -92,20 +135,28 @@ type AwsKinesis struct {
 	// AwsMultiClient is public to make AwsMultiClient.Configure() callable
 	AwsMultiClient components.AwsMultiClient `gollumdoc:"embed_type"`
 
-	stream          string        `config:"KinesisStream" default:"default"`
-	offsetFile      string        `config:"OffsetFile"`
-	recordsPerQuery int64         `config:"RecordsPerQuery" default:"100"`
-	delimiter       []byte        `config:"RecordMessageDelimiter"`
-	sleepTime       time.Duration `config:"QuerySleepTimeMs" default:"1000" metric:"ms"`
-	//retryTime       time.Duration `config:"RetrySleepTimeSec" default:"4" metric:"sec"`
-	shardTime time.Duration `config:"CheckNewShardsSec" default:"0" metric:"sec"`
-
-	client        *kinesis.Kinesis
+	stream           string        `config:"KinesisStream" default:"default"`
+	offsetFile       string        `config:"OffsetFile"`
+	recordsPerQuery  int64         `config:"RecordsPerQuery" default:"100"`
+	delimiter        []byte        `config:"RecordMessageDelimiter"`
+	sleepTime        time.Duration `config:"QuerySleepTimeMs" default:"1000" metric:"ms"`
+	retryTime        time.Duration `config:"RetrySleepTimeSec" default:"4" metric:"sec"`
+	shardTime        time.Duration `config:"CheckNewShardsSec" default:"0" metric:"sec"`
+	enhancedFanOut   bool          `config:"EnhancedFanOut" default:"false"`
+	consumerName     string        `config:"ConsumerName" default:"gollum"`
+	hasToSetMetadata bool          `config:"SetMetadata" default:"false"`
+
+	client        kinesisClient
+	consumerARN   string
 	offsets       map[string]string
+	activeShards  map[string]bool
+	closedShards  map[string]bool
+	childShards   map[string]bool
 	offsetType    string
 	defaultOffset string
 	running       bool
 	offsetsGuard  *sync.RWMutex
+	storeGuard    *sync.Mutex
 }
 
 func init() {
@@ -115,7 +166,11 @@ func init() {
 // Configure initializes this consumer with values from a plugin config.
 func (cons *AwsKinesis) Configure(conf core.PluginConfigReader) {
 	cons.offsets = make(map[string]string)
+	cons.activeShards = make(map[string]bool)
+	cons.closedShards = make(map[string]bool)
+	cons.childShards = make(map[string]bool)
 	cons.offsetsGuard = new(sync.RWMutex)
+	cons.storeGuard = new(sync.Mutex)
 
 	// Offset
 	offsetValue := strings.ToLower(conf.GetString("DefaultOffset", kinesisOffsetNewest))
@@ -143,7 +198,6 @@ func (cons *AwsKinesis) Configure(conf core.PluginConfigReader) {
 		if err != nil {
 			cons.Logger.Errorf("Failed to open kinesis offset file: %s", err.Error())
 		} else {
-			cons.offsetType = kinesis.ShardIteratorTypeAfterSequenceNumber
 			conf.Errors.Push(json.Unmarshal(fileContents, &cons.offsets))
 		}
 	}
@@ -155,38 +209,59 @@ func (cons *AwsKinesis) marshalOffsets() ([]byte, error) {
 	return json.Marshal(cons.offsets)
 }
 
+// storeOffsets atomically replaces the offset file with the current offsets.
 func (cons *AwsKinesis) storeOffsets() {
-	if cons.offsetFile != "" {
-		fileContents, err := cons.marshalOffsets()
-		if err != nil {
-			cons.Logger.Errorf("Failed to marshal kinesis offsets: %s", err.Error())
-			return
-		}
+	if cons.offsetFile == "" {
+		return // ### return, offsets are not persisted ###
+	}
 
-		if err := ioutil.WriteFile(cons.offsetFile, fileContents, 0644); err != nil {
-			cons.Logger.Errorf("Failed to write kinesis offsets: %s", err.Error())
-		}
+	fileContents, err := cons.marshalOffsets()
+	if err != nil {
+		cons.Logger.Errorf("Failed to marshal kinesis offsets: %s", err.Error())
+		return
+	}
+
+	cons.storeGuard.Lock()
+	defer cons.storeGuard.Unlock()
+
+	tmpFile := cons.offsetFile + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, fileContents, 0644); err != nil {
+		cons.Logger.Errorf("Failed to write kinesis offsets: %s", err.Error())
+		return
+	}
+	if err := os.Rename(tmpFile, cons.offsetFile); err != nil {
+		cons.Logger.Errorf("Failed to write kinesis offsets: %s", err.Error())
+	}
+}
+
+// getStartPosition returns the iterator type and sequence number to start
+// reading a shard from.
+func (cons *AwsKinesis) getStartPosition(shardID string) (string, string) {
+	cons.offsetsGuard.RLock()
+	defer cons.offsetsGuard.RUnlock()
+
+	switch {
+	case cons.offsets[shardID] != "":
+		return kinesis.ShardIteratorTypeAfterSequenceNumber, cons.offsets[shardID]
+	case cons.childShards[shardID]:
+		return kinesis.ShardIteratorTypeTrimHorizon, ""
+	default:
+		return cons.offsetType, ""
 	}
 }
 
 func (cons *AwsKinesis) createShardIteratorConfig(shardID string) *kinesis.GetRecordsInput {
 	for cons.running {
-		cons.offsetsGuard.RLock()
-		offset := cons.offsets[shardID]
-		cons.offsetsGuard.RUnlock()
+		iteratorType, offset := cons.getStartPosition(shardID)
 
 		iteratorConfig := kinesis.GetShardIteratorInput{
-			ShardId:                aws.String(shardID),
-			ShardIteratorType:      aws.String(cons.offsetType),
-			StreamName:             aws.String(cons.stream),
-			StartingSequenceNumber: aws.String(offset),
+			ShardId:           aws.String(shardID),
+			ShardIteratorType: aws.String(iteratorType),
+			StreamName:        aws.String(cons.stream),
 		}
 
-		if *iteratorConfig.StartingSequenceNumber == "" {
-			iteratorConfig.StartingSequenceNumber = nil
-		} else {
-			// starting sequence number requires ShardIteratorTypeAfterSequenceNumber
-			iteratorConfig.ShardIteratorType = aws.String(kinesis.ShardIteratorTypeAfterSequenceNumber)
+		if offset != "" {
+			iteratorConfig.StartingSequenceNumber = aws.String(offset)
 		}
 
 		iterator, err := cons.client.GetShardIterator(&iteratorConfig)
@@ -197,8 +272,8 @@ func (cons *AwsKinesis) createShardIteratorConfig(shardID string) *kinesis.GetRe
 			}
 		}
 
-		cons.Logger.Errorf("Failed to iterate shard %s:%s - %s", *iteratorConfig.StreamName, *iteratorConfig.ShardId, err.Error())
-		time.Sleep(3 * time.Second)
+		cons.Logger.Errorf("Failed to iterate shard %s:%s - %v", *iteratorConfig.StreamName, *iteratorConfig.ShardId, err)
+		time.Sleep(cons.retryTime)
 	}
 
 	return nil
@@ -207,11 +282,29 @@ func (cons *AwsKinesis) createShardIteratorConfig(shardID string) *kinesis.GetRe
 func (cons *AwsKinesis) processShard(shardID string) {
 	cons.AddWorker()
 	defer cons.WorkerDone()
+
+	var closed bool
+	if cons.enhancedFanOut {
+		closed = cons.subscribeShard(shardID)
+	} else {
+		closed = cons.pollShard(shardID)
+	}
+
+	if closed {
+		cons.onShardClosed(shardID)
+	}
+}
+
+// pollShard reads records from a shard with GetRecords. True is returned
+// if the shard has been read completely.
+func (cons *AwsKinesis) pollShard(shardID string) bool {
 	recordConfig := (*kinesis.GetRecordsInput)(nil)
 
 	for cons.running {
 		if recordConfig == nil {
-			recordConfig = cons.createShardIteratorConfig(shardID)
+			if recordConfig = cons.createShardIteratorConfig(shardID); recordConfig == nil {
+				return false // ### return, stopped ###
+			}
 		}
 
 		result, err := cons.client.GetRecords(recordConfig)
@@ -220,11 +313,11 @@ func (cons *AwsKinesis) processShard(shardID string) {
 
 			if AWSerr, isAWSerr := err.(awserr.Error); isAWSerr {
 				switch AWSerr.Code() {
-				case "ProvisionedThroughputExceededException":
+				case kinesis.ErrCodeProvisionedThroughputExceededException:
 					// We reached thethroughput limit
 					time.Sleep(5 * time.Second)
 
-				case "ExpiredIteratorException":
+				case kinesis.ErrCodeExpiredIteratorException:
 					// We need to create a new iterator
 					recordConfig = nil
 				}
@@ -232,42 +325,127 @@ func (cons *AwsKinesis) processShard(shardID string) {
 			continue // ### continue ###
 		}
 
+		cons.processRecords(shardID, result.Records)
+		cons.storeOffsets()
+
 		if result.NextShardIterator == nil {
-			cons.Logger.Warningf("Shard %s:%s has been closed", cons.stream, shardID)
-			return // ### return, closed ###
+			cons.Logger.Infof("Shard %s:%s has been closed", cons.stream, shardID)
+			return true // ### return, closed ###
 		}
 
-		for _, record := range result.Records {
-			if record == nil {
-				continue // ### continue ###
-			}
+		recordConfig.ShardIterator = result.NextShardIterator
+		time.Sleep(cons.sleepTime)
+	}
+	return false
+}
 
-			if len(cons.delimiter) > 0 {
-				messages := bytes.Split(record.Data, cons.delimiter)
-				for _, msg := range messages {
-					cons.Enqueue(msg)
-				}
-			} else {
-				cons.Enqueue(record.Data)
+// subscribeShard reads records from a shard with SubscribeToShard. True is
+// returned if the shard has been read completely.
+func (cons *AwsKinesis) subscribeShard(shardID string) bool {
+	for cons.running {
+		iteratorType, offset := cons.getStartPosition(shardID)
+		startingPosition := &kinesis.StartingPosition{
+			Type: aws.String(iteratorType),
+		}
+		if offset != "" {
+			startingPosition.SequenceNumber = aws.String(offset)
+		}
+
+		result, err := cons.client.SubscribeToShard(&kinesis.SubscribeToShardInput{
+			ConsumerARN:      aws.String(cons.consumerARN),
+			ShardId:          aws.String(shardID),
+			StartingPosition: startingPosition,
+		})
+		if err != nil {
+			cons.Logger.Errorf("Failed to subscribe to shard %s:%s - %s", cons.stream, shardID, err.Error())
+			time.Sleep(cons.retryTime)
+			continue // ### continue, retry ###
+		}
+
+		closed := cons.readEventStream(shardID, result.GetStream())
+		if closed {
+			cons.Logger.Infof("Shard %s:%s has been closed", cons.stream, shardID)
+			return true // ### return, closed ###
+		}
+	}
+	return false
+}
+
+// readEventStream processes all events of a subscription until it expires,
+// the consumer stops or the shard has been read completely. True is returned
+// in the latter case.
+func (cons *AwsKinesis) readEventStream(shardID string, stream *kinesis.SubscribeToShardEventStream) bool {
+	defer stream.Close()
+
+	for event := range stream.Events() {
+		shardEvent, isShardEvent := event.(*kinesis.SubscribeToShardEvent)
+		if !isShardEvent {
+			continue // ### continue, unknown event ###
+		}
+
+		cons.processRecords(shardID, shardEvent.Records)
+		if shardEvent.ContinuationSequenceNumber == nil {
+			cons.storeOffsets()
+			return true // ### return, closed ###
+		}
+
+		cons.offsetsGuard.Lock()
+		cons.offsets[shardID] = *shardEvent.ContinuationSequenceNumber
+		cons.offsetsGuard.Unlock()
+		cons.storeOffsets()
+
+		if !cons.running {
+			return false // ### return, stopped ###
+		}
+	}
+
+	if err := stream.Err(); err != nil {
+		cons.Logger.Errorf("Subscription to shard %s:%s failed - %s", cons.stream, shardID, err.Error())
+		time.Sleep(cons.retryTime)
+	}
+	return false
+}
+
+// processRecords enqueues all records and updates the shard offset.
+func (cons *AwsKinesis) processRecords(shardID string, records []*kinesis.Record) {
+	for _, record := range records {
+		if record == nil {
+			continue // ### continue ###
+		}
+
+		if len(cons.delimiter) > 0 {
+			messages := bytes.Split(record.Data, cons.delimiter)
+			for _, msg := range messages {
+				cons.enqueueRecordData(msg, shardID, record)
 			}
+		} else {
+			cons.enqueueRecordData(record.Data, shardID, record)
+		}
 
-			// Why not an exclusive lock here?
-			// - the map already has an entry for the shardID at this point.
-			// - we are the only one writing to this field
-			// - reading an offset is always a race as it can change at any time
-			// - performance is crucial here
-			// If we could be sure this actually IS a number, we could use atomic.Store here
-			cons.offsetsGuard.RLock()
+		if record.SequenceNumber != nil {
+			cons.offsetsGuard.Lock()
 			cons.offsets[shardID] = *record.SequenceNumber
-			cons.offsetsGuard.RUnlock()
+			cons.offsetsGuard.Unlock()
 		}
+	}
+}
 
-		cons.storeOffsets()
-		recordConfig.ShardIterator = result.NextShardIterator
-		time.Sleep(cons.sleepTime)
+func (cons *AwsKinesis) enqueueRecordData(data []byte, shardID string, record *kinesis.Record) {
+	if cons.hasToSetMetadata {
+		cons.EnqueueWithMetadata(data, cons.getRecordMetadata(shardID, record))
+	} else {
+		cons.Enqueue(data)
 	}
 }
 
+func (cons *AwsKinesis) getRecordMetadata(shardID string, record *kinesis.Record) tcontainer.MarshalMap {
+	metaData := core.NewMetadata()
+	metaData.Set("shard_id", shardID)
+	metaData.Set("partition_key", aws.StringValue(record.PartitionKey))
+	metaData.Set("sequence_number", aws.StringValue(record.SequenceNumber))
+	return metaData
+}
+
 func (cons *AwsKinesis) initKinesisClient() {
 	sess, err := cons.AwsMultiClient.NewSessionWithOptions()
 	if err != nil {
@@ -284,38 +462,172 @@ func (cons *AwsKinesis) initKinesisClient() {
 	cons.client = kinesis.New(sess, awsConfig)
 }
 
-func (cons *AwsKinesis) connect() error {
-	cons.initKinesisClient()
-
-	// Get shard ids for stream
+// describeShards returns the ARN and all shards of the stream.
+func (cons *AwsKinesis) describeShards() (string, []*kinesis.Shard, error) {
 	streamQuery := &kinesis.DescribeStreamInput{
 		StreamName: aws.String(cons.stream),
 	}
 
-	streamInfo, err := cons.client.DescribeStream(streamQuery)
+	streamARN := ""
+	shards := []*kinesis.Shard{}
+	for {
+		streamInfo, err := cons.client.DescribeStream(streamQuery)
+		if err != nil {
+			return "", nil, err
+		}
+
+		if streamInfo.StreamDescription == nil {
+			return "", nil, fmt.Errorf("streamDescription could not be retrieved")
+		}
+
+		streamARN = aws.StringValue(streamInfo.StreamDescription.StreamARN)
+		for _, shard := range streamInfo.StreamDescription.Shards {
+			if shard.ShardId == nil {
+				return "", nil, fmt.Errorf("shardId could not be retrieved")
+			}
+			shards = append(shards, shard)
+		}
+
+		if !aws.BoolValue(streamInfo.StreamDescription.HasMoreShards) || len(shards) == 0 {
+			return streamARN, shards, nil // ### return, all shards read ###
+		}
+		streamQuery.ExclusiveStartShardId = shards[len(shards)-1].ShardId
+	}
+}
+
+// getShardsToStart returns the ids of all shards that are not being read
+// yet and whose parent shards have been read completely. Parent shards that
+// are not part of the stream anymore are treated as completely read.
+func (cons *AwsKinesis) getShardsToStart(shards []*kinesis.Shard) []string {
+	cons.offsetsGuard.Lock()
+	defer cons.offsetsGuard.Unlock()
+
+	listed := make(map[string]bool)
+	for _, shard := range shards {
+		listed[*shard.ShardId] = true
+	}
+
+	toStart := []string{}
+	for _, shard := range shards {
+		shardID := *shard.ShardId
+		if cons.activeShards[shardID] || cons.closedShards[shardID] {
+			continue // ### continue, already known ###
+		}
+
+		parentsDone, parentsRead := true, false
+		for _, parentID := range []*string{shard.ParentShardId, shard.AdjacentParentShardId} {
+			if parentID == nil {
+				continue
+			}
+			if listed[*parentID] && !cons.closedShards[*parentID] {
+				parentsDone = false
+			}
+			if cons.closedShards[*parentID] && cons.offsets[*parentID] != "" {
+				parentsRead = true
+			}
+		}
+
+		if !parentsDone {
+			continue // ### continue, wait for parents ###
+		}
+
+		if _, offsetStored := cons.offsets[shardID]; !offsetStored {
+			if parentsRead {
+				cons.childShards[shardID] = true
+				cons.offsets[shardID] = ""
+			} else {
+				cons.offsets[shardID] = cons.defaultOffset
+			}
+		}
+
+		cons.activeShards[shardID] = true
+		toStart = append(toStart, shardID)
+	}
+	return toStart
+}
+
+// refreshShards starts reading all shards returned by getShardsToStart.
+func (cons *AwsKinesis) refreshShards() error {
+	_, shards, err := cons.describeShards()
 	if err != nil {
 		return err
 	}
 
-	if streamInfo.StreamDescription == nil {
-		return fmt.Errorf("streamDescription could not be retrieved")
+	for _, shardID := range cons.getShardsToStart(shards) {
+		cons.Logger.Debugf("Starting kinesis consumer for %s:%s", cons.stream, shardID)
+		go cons.processShard(shardID)
 	}
+	return nil
+}
 
-	cons.running = true
-	for _, shard := range streamInfo.StreamDescription.Shards {
-		if shard.ShardId == nil {
-			return fmt.Errorf("shardId could not be retrieved")
+// onShardClosed marks a shard as completely read and starts reading its
+// child shards.
+func (cons *AwsKinesis) onShardClosed(shardID string) {
+	cons.offsetsGuard.Lock()
+	delete(cons.activeShards, shardID)
+	cons.closedShards[shardID] = true
+	cons.offsetsGuard.Unlock()
+
+	if cons.running {
+		if err := cons.refreshShards(); err != nil {
+			cons.Logger.WithError(err).Warning("Failed to discover child shards")
 		}
+	}
+}
 
-		// No locks required here as connect is called only once on start
-		if _, offsetStored := cons.offsets[*shard.ShardId]; !offsetStored {
-			cons.offsets[*shard.ShardId] = cons.defaultOffset
+// registerStreamConsumer registers this consumer for enhanced fan-out and
+// waits until the registration is active.
+func (cons *AwsKinesis) registerStreamConsumer(streamARN string) error {
+	_, err := cons.client.RegisterStreamConsumer(&kinesis.RegisterStreamConsumerInput{
+		ConsumerName: aws.String(cons.consumerName),
+		StreamARN:    aws.String(streamARN),
+	})
+	if err != nil {
+		if AWSerr, isAWSerr := err.(awserr.Error); !isAWSerr || AWSerr.Code() != kinesis.ErrCodeResourceInUseException {
+			return err // ### return, registration failed ###
 		}
 	}
 
-	// No locks required here updateShards is not yet running and processShard
-	// does not change the offsets structure.
-	for shardID := range cons.offsets {
+	for cons.running {
+		result, err := cons.client.DescribeStreamConsumer(&kinesis.DescribeStreamConsumerInput{
+			ConsumerName: aws.String(cons.consumerName),
+			StreamARN:    aws.String(streamARN),
+		})
+		if err != nil {
+			return err
+		}
+
+		description := result.ConsumerDescription
+		if description != nil && aws.StringValue(description.ConsumerStatus) == kinesis.ConsumerStatusActive {
+			cons.consumerARN = aws.StringValue(description.ConsumerARN)
+			return nil // ### return, registered ###
+		}
+
+		cons.Logger.Debugf("Waiting for stream consumer %s to become active", cons.consumerName)
+		time.Sleep(time.Second)
+	}
+	return fmt.Errorf("stopped while waiting for stream consumer")
+}
+
+func (cons *AwsKinesis) connect() error {
+	cons.initKinesisClient()
+	return cons.start()
+}
+
+func (cons *AwsKinesis) start() error {
+	streamARN, shards, err := cons.describeShards()
+	if err != nil {
+		return err
+	}
+
+	cons.running = true
+	if cons.enhancedFanOut {
+		if err := cons.registerStreamConsumer(streamARN); err != nil {
+			return err
+		}
+	}
+
+	for _, shardID := range cons.getShardsToStart(shards) {
 		cons.Logger.Debugf("Starting consumer for %s:%s", cons.stream, shardID)
 		go cons.processShard(shardID)
 	}
@@ -331,35 +643,9 @@ func (cons *AwsKinesis) connect() error {
 func (cons *AwsKinesis) updateShards() {
 	defer cons.WorkerDone()
 
-	streamQuery := &kinesis.DescribeStreamInput{
-		StreamName: aws.String(cons.stream),
-	}
-
 	for cons.running {
-		streamInfo, err := cons.client.DescribeStream(streamQuery)
-		if err != nil {
-			cons.Logger.Warningf("StreamInfo could not be retrieved.")
-		}
-
-		if streamInfo.StreamDescription == nil {
-			cons.Logger.Warningf("StreamDescription could not be retrieved.")
-			continue
-		}
-
-		cons.running = true
-		for _, shard := range streamInfo.StreamDescription.Shards {
-			if shard.ShardId == nil {
-				cons.Logger.Warningf("ShardId could not be retrieved.")
-				continue
-			}
-
-			cons.offsetsGuard.Lock()
-			if _, offsetStored := cons.offsets[*shard.ShardId]; !offsetStored {
-				cons.offsets[*shard.ShardId] = cons.defaultOffset
-				cons.Logger.Debugf("Starting kinesis consumer for %s:%s", cons.stream, *shard.ShardId)
-				go cons.processShard(*shard.ShardId)
-			}
-			cons.offsetsGuard.Unlock()
+		if err := cons.refreshShards(); err != nil {
+			cons.Logger.WithError(err).Warning("StreamInfo could not be retrieved.")
 		}
 		time.Sleep(cons.shardTime)
 	}
@@ -0,0 +1,222 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gollum/core"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/trivago/tgo/ttesting"
+)
+
+type mockKinesisClient struct {
+	kinesisClient
+	pages [][]*kinesis.Shard
+}
+
+func (client *mockKinesisClient) DescribeStream(input *kinesis.DescribeStreamInput) (*kinesis.DescribeStreamOutput, error) {
+	page := 0
+	if input.ExclusiveStartShardId != nil {
+		for i, shards := range client.pages {
+			if *shards[len(shards)-1].ShardId == *input.ExclusiveStartShardId {
+				page = i + 1
+			}
+		}
+	}
+
+	return &kinesis.DescribeStreamOutput{
+		StreamDescription: &kinesis.StreamDescription{
+			StreamARN:     aws.String("arn:test"),
+			Shards:        client.pages[page],
+			HasMoreShards: aws.Bool(page < len(client.pages)-1),
+		},
+	}, nil
+}
+
+type mockKinesisEventReader struct {
+	events chan kinesis.SubscribeToShardEventStreamEvent
+}
+
+func (reader *mockKinesisEventReader) Events() <-chan kinesis.SubscribeToShardEventStreamEvent {
+	return reader.events
+}
+
+func (reader *mockKinesisEventReader) Close() error {
+	return nil
+}
+
+func (reader *mockKinesisEventReader) Err() error {
+	return nil
+}
+
+func newKinesisShard(shardID string, parentIDs ...string) *kinesis.Shard {
+	shard := &kinesis.Shard{ShardId: aws.String(shardID)}
+	if len(parentIDs) > 0 {
+		shard.ParentShardId = aws.String(parentIDs[0])
+	}
+	if len(parentIDs) > 1 {
+		shard.AdjacentParentShardId = aws.String(parentIDs[1])
+	}
+	return shard
+}
+
+func TestAwsKinesisCheckpoint(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-kinesis")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	newMockRouter(t.Name(), 2)
+	offsetFile := filepath.Join(dir, "offsets.json")
+
+	config := core.NewPluginConfig("", "consumer.AwsKinesis")
+	config.Override("Streams", t.Name())
+	config.Override("OffsetFile", offsetFile)
+	config.Override("DefaultOffset", "oldest")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*AwsKinesis)
+	expect.True(casted)
+
+	cons.processRecords("shard-0", []*kinesis.Record{
+		{Data: []byte("a"), SequenceNumber: aws.String("10")},
+		{Data: []byte("b"), SequenceNumber: aws.String("11")},
+	})
+	cons.storeOffsets()
+
+	_, err = os.Stat(offsetFile + ".tmp")
+	expect.True(os.IsNotExist(err))
+
+	plugin, err = core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	restored, casted := plugin.(*AwsKinesis)
+	expect.True(casted)
+
+	iteratorType, offset := restored.getStartPosition("shard-0")
+	expect.Equal(kinesis.ShardIteratorTypeAfterSequenceNumber, iteratorType)
+	expect.Equal("11", offset)
+
+	// Shards without a checkpoint use the default offset
+	iteratorType, offset = restored.getStartPosition("shard-1")
+	expect.Equal(kinesis.ShardIteratorTypeTrimHorizon, iteratorType)
+	expect.Equal("", offset)
+}
+
+func TestAwsKinesisShardRefresh(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	newMockRouter(t.Name(), 1)
+
+	config := core.NewPluginConfig("", "consumer.AwsKinesis")
+	config.Override("Streams", t.Name())
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*AwsKinesis)
+	expect.True(casted)
+
+	cons.client = &mockKinesisClient{
+		pages: [][]*kinesis.Shard{
+			{newKinesisShard("shard-0"), newKinesisShard("shard-1", "shard-expired")},
+			{newKinesisShard("shard-2", "shard-0"), newKinesisShard("shard-3", "shard-0", "shard-1")},
+		},
+	}
+
+	_, shards, err := cons.describeShards()
+	expect.NoError(err)
+	expect.Equal(4, len(shards))
+
+	// Children have to wait for their parents
+	expect.Equal([]string{"shard-0", "shard-1"}, cons.getShardsToStart(shards))
+	expect.Equal([]string{}, cons.getShardsToStart(shards))
+
+	cons.processRecords("shard-0", []*kinesis.Record{{Data: []byte("a"), SequenceNumber: aws.String("1")}})
+	cons.closedShards["shard-0"] = true
+	delete(cons.activeShards, "shard-0")
+	expect.Equal([]string{"shard-2"}, cons.getShardsToStart(shards))
+
+	// Children of read parents start at the oldest record
+	iteratorType, _ := cons.getStartPosition("shard-2")
+	expect.Equal(kinesis.ShardIteratorTypeTrimHorizon, iteratorType)
+
+	cons.closedShards["shard-1"] = true
+	delete(cons.activeShards, "shard-1")
+	expect.Equal([]string{"shard-3"}, cons.getShardsToStart(shards))
+}
+
+func TestAwsKinesisEventStream(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	router := newMockRouter(t.Name(), 1)
+
+	config := core.NewPluginConfig("", "consumer.AwsKinesis")
+	config.Override("Streams", t.Name())
+	config.Override("SetMetadata", true)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*AwsKinesis)
+	expect.True(casted)
+
+	reader := &mockKinesisEventReader{
+		events: make(chan kinesis.SubscribeToShardEventStreamEvent, 2),
+	}
+	stream := kinesis.NewSubscribeToShardEventStream(func(es *kinesis.SubscribeToShardEventStream) {
+		es.Reader = reader
+		es.StreamCloser = reader
+	})
+
+	record := &kinesis.Record{
+		Data:           []byte("payload"),
+		PartitionKey:   aws.String("key"),
+		SequenceNumber: aws.String("42"),
+	}
+	reader.events <- &kinesis.SubscribeToShardEvent{
+		Records:                    []*kinesis.Record{record},
+		ContinuationSequenceNumber: aws.String("43"),
+	}
+	reader.events <- &kinesis.SubscribeToShardEvent{}
+	close(reader.events)
+
+	cons.running = true
+	expect.True(cons.readEventStream("shard-0", stream))
+	expect.Equal("43", cons.offsets["shard-0"])
+
+	msg := router.receive(t, 1)[0]
+	expect.Equal("payload", msg.String())
+
+	metadata := msg.GetMetadata()
+	for key, expected := range map[string]string{
+		"shard_id":        "shard-0",
+		"partition_key":   "key",
+		"sequence_number": "42",
+	} {
+		value, err := metadata.String(key)
+		expect.NoError(err)
+		expect.Equal(expected, value)
+	}
+}
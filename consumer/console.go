@@ -15,25 +15,40 @@
 package consumer
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"gollum/core"
+
 	"github.com/trivago/tgo"
 	"github.com/trivago/tgo/tio"
 )
 
 const (
 	consoleBufferGrowSize = 256
+	consoleMaxFrameSize   = 64 << 20
+)
+
+const (
+	consoleFramingDelimiter = "delimiter"
+	consoleFramingNetstring = "netstring"
+	consoleFramingVarint    = "varint"
+	consoleFramingUint32BE  = "uint32be"
 )
 
 // Console consumer
 //
-// This consumer reads from stdin or a named pipe. A message is generated after
-// each newline character.
+// This consumer reads from stdin or a named pipe. By default a message is
+// generated after each newline character. Binary data like protobuf or avro
+// records can be read by using a length prefixed framing.
 //
 // Metadata
 //
@@ -55,6 +70,24 @@ const (
 // pipe is closed, i.e. when EOF is detected.
 // By default this paramater is set to "true".
 //
+// - ReopenOnEOF: If set to true, a named pipe is reopened after EOF has been
+// detected, i.e. after the writer closed the pipe. The consumer then waits for
+// the next writer instead of triggering an exit. This setting takes precedence
+// over ExitOnEOF and has no effect when reading from stdin.
+// By default this paramater is set to "false".
+//
+// - Framing: Defines how messages are separated from the input stream.
+// "delimiter" generates a message after each newline character.
+// "netstring" reads netstrings like "5:hello,".
+// "varint" reads frames prefixed by their length as protobuf style unsigned
+// varint.
+// "uint32be" reads frames prefixed by their length as 32 bit big endian
+// unsigned integer.
+// Length prefixes and netstring separators are not part of the message.
+// Frames larger than 64 MB are treated as invalid. If invalid data is read,
+// all buffered data is discarded.
+// By default this paramater is set to "delimiter".
+//
 // - SetMetadata: When this value is set to "true", the fields mentioned in the metadata
 // section will be added to each message. Adding metadata will have a
 // performance impact on systems with high throughput.
@@ -68,6 +101,23 @@ const (
 //    Type: consumer.Console
 //    Streams: console
 //    Pipe: stdin
+//
+// This config reads length prefixed protobuf messages from a named pipe.
+//
+//  ProtobufIn:
+//    Type: consumer.Console
+//    Streams: protobuf
+//    Pipe: /var/run/gollum.pipe
+//    Framing: varint
+//
+// This config keeps reading from a named pipe that is written to by multiple,
+// consecutive writers, e.g. applications that reopen their log on rotation.
+//
+//  LogPipeIn:
+//    Type: consumer.Console
+//    Streams: logs
+//    Pipe: /var/run/app.log.pipe
+//    ReopenOnEOF: true
 type Console struct {
 	core.SimpleConsumer `gollumdoc:"embed_type"`
 	pipe                *os.File
@@ -75,6 +125,9 @@ type Console struct {
 	pipePerm            uint32 `config:"Permissions" default:"0644"`
 	hasToSetMetadata    bool   `config:"SetMetadata" default:"false"`
 	autoExit            bool   `config:"ExitOnEOF" default:"true"`
+	reopenOnEOF         bool   `config:"ReopenOnEOF" default:"false"`
+	framing             string `config:"Framing" default:"delimiter"`
+	readFrame           func(reader *bufio.Reader) ([]byte, error)
 }
 
 func init() {
@@ -90,6 +143,20 @@ func (cons *Console) Configure(conf core.PluginConfigReader) {
 	default:
 		cons.pipe = nil
 	}
+
+	cons.framing = strings.ToLower(cons.framing)
+	switch cons.framing {
+	case consoleFramingDelimiter:
+		cons.readFrame = nil
+	case consoleFramingNetstring:
+		cons.readFrame = readNetstringFrame
+	case consoleFramingVarint:
+		cons.readFrame = readVarintFrame
+	case consoleFramingUint32BE:
+		cons.readFrame = readUint32BEFrame
+	default:
+		conf.Errors.Pushf("Unknown framing: %s", cons.framing)
+	}
 }
 
 // Enqueue creates a new message
@@ -119,7 +186,13 @@ func (cons *Console) readPipe() {
 			return // ### return, try again ###
 		}
 
-		defer cons.pipe.Close()
+		// The pipe may be replaced by reopenPipe
+		defer func() { cons.pipe.Close() }()
+	}
+
+	if cons.readFrame != nil {
+		cons.readFrames()
+		return // ### return, done ###
 	}
 
 	buffer := tio.NewBufferedReader(consoleBufferGrowSize, 0, 0, "\n")
@@ -127,9 +200,11 @@ func (cons *Console) readPipe() {
 		err := buffer.ReadAll(cons.pipe, cons.Enqueue)
 		switch err {
 		case io.EOF:
-			if cons.autoExit {
-				cons.Logger.Info("Exit triggered by EOF.")
-				tgo.ShutdownCallback()
+			if cons.handleEOF() {
+				// Data not terminated by the previous writer is a message of its own
+				if data := buffer.ResetGetIncomplete(); len(data) > 0 {
+					cons.Enqueue(data)
+				}
 			}
 
 		case nil:
@@ -139,3 +214,130 @@ func (cons *Console) readPipe() {
 		}
 	}
 }
+
+func (cons *Console) readFrames() {
+	reader := bufio.NewReader(cons.pipe)
+	for cons.IsActive() {
+		data, err := cons.readFrame(reader)
+		switch err {
+		case nil:
+			cons.Enqueue(data)
+
+		case io.EOF, io.ErrUnexpectedEOF:
+			if err == io.ErrUnexpectedEOF {
+				cons.Logger.Warningf("Discarded %s frame truncated by EOF", cons.framing)
+			}
+			if cons.handleEOF() {
+				reader.Reset(cons.pipe)
+			}
+
+		default:
+			cons.Logger.Errorf("Failed to read %s frame: %s", cons.framing, err.Error())
+			reader.Reset(cons.pipe)
+		}
+	}
+}
+
+// handleEOF is called when EOF has been read from the pipe. Named pipes are
+// reopened if ReopenOnEOF is set, otherwise an exit is triggered if ExitOnEOF
+// is set. Returns true if the pipe has been reopened.
+func (cons *Console) handleEOF() bool {
+	if cons.reopenOnEOF && cons.pipeName != "stdin" && isNamedPipe(cons.pipe) {
+		cons.reopenPipe()
+		return true
+	}
+
+	if cons.autoExit {
+		cons.Logger.Info("Exit triggered by EOF.")
+		tgo.ShutdownCallback()
+	}
+	return false
+}
+
+// reopenPipe closes the pipe and opens it again. Opening a named pipe for
+// reading blocks until the next writer opens it.
+func (cons *Console) reopenPipe() {
+	cons.pipe.Close()
+	cons.Logger.Debugf("Reopening %s after EOF", cons.pipeName)
+
+	for cons.IsActive() {
+		pipe, err := os.OpenFile(cons.pipeName, os.O_RDONLY, 0)
+		if err == nil {
+			cons.pipe = pipe
+			return // ### return, reopened ###
+		}
+		cons.Logger.Error(err)
+		time.Sleep(3 * time.Second)
+	}
+}
+
+// isNamedPipe returns true if the given file is a named pipe (FIFO)
+func isNamedPipe(file *os.File) bool {
+	stats, err := file.Stat()
+	return err == nil && stats.Mode()&os.ModeNamedPipe != 0
+}
+
+// readNetstringFrame reads a frame formatted as "<length>:<data>,"
+func readNetstringFrame(reader *bufio.Reader) ([]byte, error) {
+	header, err := reader.ReadSlice(':')
+	switch {
+	case err == io.EOF && len(header) == 0:
+		return nil, io.EOF
+	case err == bufio.ErrBufferFull:
+		return nil, fmt.Errorf("netstring length too long")
+	case err != nil:
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	length, err := strconv.ParseUint(string(bytes.TrimSpace(header[:len(header)-1])), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid netstring length: %s", err.Error())
+	}
+
+	data, err := readFrameData(reader, length)
+	if err != nil {
+		return nil, err
+	}
+
+	terminator, err := reader.ReadByte()
+	if err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if terminator != ',' {
+		return nil, fmt.Errorf("netstring not terminated by ','")
+	}
+	return data, nil
+}
+
+// readVarintFrame reads a frame prefixed by its length as unsigned varint
+func readVarintFrame(reader *bufio.Reader) ([]byte, error) {
+	length, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	return readFrameData(reader, length)
+}
+
+// readUint32BEFrame reads a frame prefixed by its length as big endian uint32
+func readUint32BEFrame(reader *bufio.Reader) ([]byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+	return readFrameData(reader, uint64(binary.BigEndian.Uint32(header)))
+}
+
+func readFrameData(reader *bufio.Reader, length uint64) ([]byte, error) {
+	if length > consoleMaxFrameSize {
+		return nil, fmt.Errorf("frame size of %d bytes exceeds the limit", length)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data, nil
+}
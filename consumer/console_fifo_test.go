@@ -0,0 +1,143 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build !windows
+
+package consumer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo"
+	"github.com/trivago/tgo/ttesting"
+)
+
+// writeFIFO opens the named pipe for writing, writes data and closes it again
+func writeFIFO(t *testing.T, path string, data string) {
+	expect := ttesting.NewExpect(t)
+
+	pipe, err := os.OpenFile(path, os.O_WRONLY, 0)
+	expect.NoError(err)
+	_, err = pipe.Write([]byte(data))
+	expect.NoError(err)
+	expect.NoError(pipe.Close())
+}
+
+func TestConsoleReopenOnEOF(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-console")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "in.pipe")
+	expect.NoError(syscall.Mkfifo(path, 0600))
+
+	var exitCalls int32
+	defaultShutdown := tgo.ShutdownCallback
+	tgo.ShutdownCallback = func() { atomic.AddInt32(&exitCalls, 1) }
+	defer func() { tgo.ShutdownCallback = defaultShutdown }()
+
+	router := newMockRouter(t.Name(), 4)
+	config := core.NewPluginConfig(t.Name(), "consumer.Console")
+	config.Override("Streams", t.Name())
+	config.Override("Pipe", path)
+	config.Override("ReopenOnEOF", true)
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*Console)
+	expect.True(casted)
+
+	workers := new(sync.WaitGroup)
+	cons.SetWorkerWaitGroup(workers)
+	go cons.Consume(workers)
+
+	writeFIFO(t, path, "first\nsecond\n")
+	messages := router.receive(t, 2)
+	expect.Equal("first", messages[0].String())
+	expect.Equal("second", messages[1].String())
+
+	// The pipe has to be reopened to receive data from the next writer
+	writeFIFO(t, path, "third\nincomplete")
+	messages = router.receive(t, 1)
+	expect.Equal("third", messages[0].String())
+
+	writeFIFO(t, path, "fourth\n")
+	messages = router.receive(t, 2)
+	expect.Equal("incomplete", messages[0].String())
+	expect.Equal("fourth", messages[1].String())
+	expect.Equal(int32(0), atomic.LoadInt32(&exitCalls))
+
+	cons.Control() <- core.PluginControlStopConsumer
+	expect.True(waitForWorkers(workers, time.Second))
+
+	// Unblock the reader waiting for the next writer
+	if pipe, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0); err == nil {
+		pipe.Close()
+	}
+}
+
+func TestConsoleTruncatedFrameOnEOF(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-console")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "in.pipe")
+	expect.NoError(syscall.Mkfifo(path, 0600))
+
+	router := newMockRouter(t.Name(), 4)
+	config := core.NewPluginConfig(t.Name(), "consumer.Console")
+	config.Override("Streams", t.Name())
+	config.Override("Pipe", path)
+	config.Override("Framing", "netstring")
+	config.Override("ReopenOnEOF", true)
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*Console)
+	expect.True(casted)
+
+	workers := new(sync.WaitGroup)
+	cons.SetWorkerWaitGroup(workers)
+	go cons.Consume(workers)
+
+	writeFIFO(t, path, "5:hello,5:wor")
+	messages := router.receive(t, 1)
+	expect.Equal("hello", messages[0].String())
+
+	// The truncated frame is dropped and the next writer starts a new frame
+	writeFIFO(t, path, "5:world,")
+	messages = router.receive(t, 1)
+	expect.Equal("world", messages[0].String())
+
+	cons.Control() <- core.PluginControlStopConsumer
+	expect.True(waitForWorkers(workers, time.Second))
+
+	// Unblock the reader waiting for the next writer
+	if pipe, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0); err == nil {
+		pipe.Close()
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func readAllFrames(read func(*bufio.Reader) ([]byte, error), data []byte) ([]string, error) {
+	reader := bufio.NewReader(bytes.NewReader(data))
+	frames := []string{}
+	for {
+		frame, err := read(reader)
+		if err != nil {
+			if err == io.EOF {
+				err = nil
+			}
+			return frames, err
+		}
+		frames = append(frames, string(frame))
+	}
+}
+
+func TestConsoleFramingNetstring(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	frames, err := readAllFrames(readNetstringFrame, []byte("5:hello,0:,7:a\nb,c:d,"))
+	expect.NoError(err)
+	expect.Equal([]string{"hello", "", "a\nb,c:d"}, frames)
+
+	_, err = readAllFrames(readNetstringFrame, []byte("5:hello;"))
+	expect.NotNil(err)
+
+	_, err = readAllFrames(readNetstringFrame, []byte("x:hello,"))
+	expect.NotNil(err)
+
+	_, err = readAllFrames(readNetstringFrame, []byte("5:hel"))
+	expect.Equal(io.ErrUnexpectedEOF, err)
+}
+
+func TestConsoleFramingVarint(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	long := bytes.Repeat([]byte{'\n'}, 300)
+	data := []byte{}
+	for _, frame := range [][]byte{[]byte("foo\n"), long} {
+		header := make([]byte, binary.MaxVarintLen64)
+		headerLen := binary.PutUvarint(header, uint64(len(frame)))
+		data = append(data, header[:headerLen]...)
+		data = append(data, frame...)
+	}
+
+	frames, err := readAllFrames(readVarintFrame, data)
+	expect.NoError(err)
+	expect.Equal([]string{"foo\n", string(long)}, frames)
+
+	_, err = readAllFrames(readVarintFrame, data[:len(data)-1])
+	expect.Equal(io.ErrUnexpectedEOF, err)
+}
+
+func TestConsoleFramingUint32BE(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	data := []byte{0, 0, 0, 3, 'f', '\n', 'o', 0, 0, 0, 0, 0, 0, 0, 1, 'x'}
+	frames, err := readAllFrames(readUint32BEFrame, data)
+	expect.NoError(err)
+	expect.Equal([]string{"f\no", "", "x"}, frames)
+
+	_, err = readAllFrames(readUint32BEFrame, []byte{0xff, 0xff, 0xff, 0xff})
+	expect.NotNil(err)
+}
+
+func TestConsoleFramingConfig(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.Console")
+	config.Override("Framing", "VarInt")
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*Console)
+	expect.True(casted)
+	expect.NotNil(cons.readFrame)
+
+	config = core.NewPluginConfig(t.Name()+"Unknown", "consumer.Console")
+	config.Override("Framing", "unknown")
+	_, err = core.NewPluginWithConfig(config)
+	expect.NotNil(err)
+}
@@ -20,8 +20,66 @@ import (
 	_ "gollum/router"
 	"runtime/debug"
 	"testing"
+	"time"
 )
 
+// mockRouter collects all messages enqueued to a stream
+type mockRouter struct {
+	streamID core.MessageStreamID
+	messages chan *core.Message
+}
+
+func newMockRouter(stream string, capacity int) *mockRouter {
+	router := &mockRouter{
+		streamID: core.StreamRegistry.GetStreamID(stream),
+		messages: make(chan *core.Message, capacity),
+	}
+	core.StreamRegistry.Register(router, router.streamID)
+	return router
+}
+
+func (router *mockRouter) Modulate(msg *core.Message) core.ModulateResult {
+	return core.ModulateResultContinue
+}
+
+func (router *mockRouter) GetStreamID() core.MessageStreamID {
+	return router.streamID
+}
+
+func (router *mockRouter) GetID() string {
+	return "mockRouter"
+}
+
+func (router *mockRouter) AddProducer(producers ...core.Producer) {
+}
+
+func (router *mockRouter) Enqueue(msg *core.Message) error {
+	router.messages <- msg
+	return nil
+}
+
+func (router *mockRouter) GetTimeout() time.Duration {
+	return time.Second
+}
+
+func (router *mockRouter) Start() error {
+	return nil
+}
+
+// receive waits for count messages to be enqueued
+func (router *mockRouter) receive(t *testing.T, count int) []*core.Message {
+	messages := []*core.Message{}
+	for i := 0; i < count; i++ {
+		select {
+		case msg := <-router.messages:
+			messages = append(messages, msg)
+		case <-time.After(time.Second):
+			t.Fatal("message was not enqueued")
+		}
+	}
+	return messages
+}
+
 func TestConsumerInterface(t *testing.T) {
 	consumers := core.TypeRegistry.GetRegistered("consumer.")
 
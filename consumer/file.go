@@ -20,7 +20,6 @@ import (
 	"io/ioutil"
 	"path/filepath"
 	"regexp"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -77,6 +76,9 @@ const (
 // file offsets are stored. The filename will the name and extension of the
 // source file plus the extension ".offset". If the consumer is restarted,
 // these offset files are used to continue reading from the previous position.
+// On systems supporting it, device and inode of the file are stored along with
+// the offset. If the file has been replaced in the meantime, it is read from
+// the start.
 // To disable this setting, set it to "".
 // By default this parameter is set to "".
 //
@@ -128,6 +130,38 @@ const (
 // filename. The path checked is the one before symlink evaluation.
 // By default this parameter is set to "".
 //
+// - RotationGracePeriodMs: Defines the time in milliseconds the rotated
+// file is still read after a rotation (rename or remove) has been detected.
+// This allows processes to finish writing to the old file. After this period
+// the rotated file is read until EOF and the new file is opened.
+// A file that got truncated, e.g. by copy-truncate rotation, is always read
+// from the start.
+// By default this parameter is set to "0".
+//
+// - Multiline/Pattern: A regular expression used to join multiple lines into
+// one message, e.g. for stack traces. Lines are matched without delimiter.
+// If set to an empty string, every line is a message on its own.
+// By default this parameter is set to "".
+//
+// - Multiline/Negate: When set to true, lines NOT matching Multiline/Pattern
+// are treated as continuation lines.
+// By default this parameter is set to "false".
+//
+// - Multiline/Match: Defines how continuation lines are joined. "after"
+// appends continuation lines to the line before them. "before" prepends
+// continuation lines to the next line that is not a continuation line.
+// Joined lines are separated by Delimiter.
+// By default this parameter is set to "after".
+//
+// - Multiline/MaxLines: Defines the maximum number of lines joined into one
+// message. Further lines start a new message. Set to 0 to disable the limit.
+// By default this parameter is set to "500".
+//
+// - Multiline/TimeoutMs: Defines the time in milliseconds after which a
+// pending multiline message is sent if no new line arrives. Set to 0 to
+// only send a pending message when the next message starts.
+// By default this parameter is set to "1000".
+//
 // Examples
 //
 // This example will read all the `.log` files `/var/log/` into one stream and
@@ -143,6 +177,17 @@ const (
 //    ObserveMode: poll
 //    PollingDelay: 100
 //
+// This example joins java stack traces, i.e. all lines not starting with a
+// date, into one message:
+//
+//  JavaLogIn:
+//    Type: consumer.File
+//    Files: /var/log/app/error.log
+//    Multiline:
+//      Pattern: '^\d{4}-\d{2}-\d{2}'
+//      Negate: true
+//      Match: after
+//
 type File struct {
 	core.SimpleConsumer `gollumdoc:"embed_type"`
 
@@ -157,6 +202,13 @@ type File struct {
 	defaultOffset    string        `config:"DefaultOffset" default:"newest"`
 	blackListString  string        `config:"BlackList"`
 	whiteListString  string        `config:"WhiteList"`
+	rotationGrace    time.Duration `config:"RotationGracePeriodMs" default:"0" metric:"ms"`
+
+	multilinePattern  *regexp.Regexp
+	multilineNegate   bool          `config:"Multiline/Negate" default:"false"`
+	multilineMatch    string        `config:"Multiline/Match" default:"after"`
+	multilineMaxLines int           `config:"Multiline/MaxLines" default:"500"`
+	multilineTimeout  time.Duration `config:"Multiline/TimeoutMs" default:"1000" metric:"ms"`
 
 	observedFiles *sync.Map
 	done          chan struct{}
@@ -185,6 +237,23 @@ func (cons *File) Configure(conf core.PluginConfigReader) {
 	}
 
 	cons.configureBlacklist(conf)
+	cons.configureMultiline(conf)
+}
+
+func (cons *File) configureMultiline(conf core.PluginConfigReader) {
+	pattern := conf.GetString("Multiline/Pattern", "")
+	if len(pattern) == 0 {
+		return // ### return, multiline disabled ###
+	}
+
+	var err error
+	cons.multilinePattern, err = regexp.Compile(pattern)
+	conf.Errors.Push(err)
+
+	cons.multilineMatch = strings.ToLower(cons.multilineMatch)
+	if cons.multilineMatch != multilineMatchAfter && cons.multilineMatch != multilineMatchBefore {
+		conf.Errors.Pushf("Multiline/Match must be '%s' or '%s'", multilineMatchAfter, multilineMatchBefore)
+	}
 }
 
 func (cons *File) configureBlacklist(conf core.PluginConfigReader) {
@@ -229,6 +298,7 @@ func (cons *File) newObservedFile(name string, stopIfNotExist bool) *observableF
 	offsetFileName := ""
 	defaultOffset := strings.ToLower(cons.defaultOffset)
 	cursor := fileCursor{whence: io.SeekStart}
+	storedID := fileID{}
 
 	switch {
 	case cons.offsetFilePath != "":
@@ -236,10 +306,11 @@ func (cons *File) newObservedFile(name string, stopIfNotExist bool) *observableF
 		if offsetFileData, err := ioutil.ReadFile(offsetFileName); err != nil {
 			logger.WithError(err).Errorf("Failed to open offset file %s", offsetFileName)
 		} else {
-			if offset, err := strconv.ParseInt(string(offsetFileData), 10, 64); err != nil {
+			if offset, id, err := parseOffsetFile(offsetFileData); err != nil {
 				logger.WithError(err).Errorf("Error reading offset number from %s", offsetFileName)
 			} else {
 				cursor.offset = offset
+				storedID = id
 			}
 		}
 
@@ -256,6 +327,8 @@ func (cons *File) newObservedFile(name string, stopIfNotExist bool) *observableF
 		fileName:       name,
 		offsetFileName: offsetFileName,
 		cursor:         cursor,
+		storedID:       storedID,
+		rotationGrace:  cons.rotationGrace,
 		stopIfNotExist: stopIfNotExist,
 		retryDelay:     cons.retryDelay,
 		pollDelay:      cons.pollingDelay,
@@ -292,6 +365,13 @@ func (cons *File) observeFile(name string, stopIfNotExist bool) {
 		}
 	}
 
+	if cons.multilinePattern != nil {
+		joiner := newMultilineJoiner(cons.multilinePattern, cons.multilineNegate, cons.multilineMatch,
+			cons.multilineMaxLines, cons.multilineTimeout, cons.delimiter, enqueue)
+		defer joiner.close()
+		enqueue = joiner.add
+	}
+
 	switch cons.observeMode {
 	case observeModeWatch:
 		file.observeFSNotify(enqueue, cons.done)
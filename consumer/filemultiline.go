@@ -0,0 +1,132 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	multilineMatchAfter  = "after"
+	multilineMatchBefore = "before"
+)
+
+// multilineJoiner collects lines belonging to the same event and passes them
+// as one message to enqueue. It follows the semantics of Filebeat's
+// multiline setting: A line is a continuation line if it matches pattern
+// (or doesn't if negate is set). With matchBefore unset, continuation lines
+// are appended to the preceding line. With matchBefore set, continuation
+// lines are prepended to the next line that is not a continuation line.
+type multilineJoiner struct {
+	pattern     *regexp.Regexp
+	negate      bool
+	matchBefore bool
+	maxLines    int
+	delimiter   []byte
+	enqueue     func([]byte)
+
+	pending   []byte
+	numLines  int
+	timeout   time.Duration
+	flushTime *time.Timer
+	guard     *sync.Mutex
+}
+
+func newMultilineJoiner(pattern *regexp.Regexp, negate bool, match string, maxLines int, timeout time.Duration, delimiter string, enqueue func([]byte)) *multilineJoiner {
+	joiner := &multilineJoiner{
+		pattern:     pattern,
+		negate:      negate,
+		matchBefore: match == multilineMatchBefore,
+		maxLines:    maxLines,
+		delimiter:   []byte(delimiter),
+		enqueue:     enqueue,
+		timeout:     timeout,
+		guard:       new(sync.Mutex),
+	}
+
+	if timeout > 0 {
+		joiner.flushTime = time.AfterFunc(timeout, joiner.flush)
+		joiner.flushTime.Stop()
+	}
+	return joiner
+}
+
+// add processes a line read from the file
+func (joiner *multilineJoiner) add(line []byte) {
+	joiner.guard.Lock()
+	defer joiner.guard.Unlock()
+
+	isContinuation := joiner.pattern.Match(line) != joiner.negate
+
+	switch {
+	case joiner.matchBefore:
+		joiner.append(line)
+		if !isContinuation {
+			joiner.flushPending()
+		}
+
+	case !isContinuation || joiner.numLines == 0:
+		joiner.flushPending()
+		joiner.append(line)
+
+	default:
+		joiner.append(line)
+	}
+
+	if joiner.maxLines > 0 && joiner.numLines >= joiner.maxLines {
+		joiner.flushPending()
+	}
+
+	if joiner.flushTime != nil && joiner.numLines > 0 {
+		joiner.flushTime.Reset(joiner.timeout)
+	}
+}
+
+// flush passes all pending lines to enqueue
+func (joiner *multilineJoiner) flush() {
+	joiner.guard.Lock()
+	defer joiner.guard.Unlock()
+	joiner.flushPending()
+}
+
+// close stops the flush timer and passes all pending lines to enqueue
+func (joiner *multilineJoiner) close() {
+	if joiner.flushTime != nil {
+		joiner.flushTime.Stop()
+	}
+	joiner.flush()
+}
+
+// append adds a line to the pending message. Expects guard to be locked.
+func (joiner *multilineJoiner) append(line []byte) {
+	if joiner.numLines > 0 {
+		joiner.pending = append(joiner.pending, joiner.delimiter...)
+	}
+	joiner.pending = append(joiner.pending, line...)
+	joiner.numLines++
+}
+
+// flushPending enqueues the pending message. Expects guard to be locked.
+func (joiner *multilineJoiner) flushPending() {
+	if joiner.numLines == 0 {
+		return // ### return, nothing to do ###
+	}
+
+	joiner.enqueue(joiner.pending)
+	joiner.pending = joiner.pending[:0]
+	joiner.numLines = 0
+}
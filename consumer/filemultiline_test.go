@@ -0,0 +1,140 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+const javaExceptionLog = `2018-01-01 12:00:00 INFO Starting
+2018-01-01 12:00:01 ERROR Request failed
+java.lang.IllegalStateException: broken
+	at com.example.Foo.bar(Foo.java:42)
+	at com.example.Main.main(Main.java:7)
+Caused by: java.io.IOException: closed
+	... 2 more
+2018-01-01 12:00:02 INFO Done`
+
+type multilineCollector struct {
+	guard    sync.Mutex
+	messages []string
+}
+
+func (c *multilineCollector) enqueue(data []byte) {
+	c.guard.Lock()
+	defer c.guard.Unlock()
+	c.messages = append(c.messages, string(data))
+}
+
+func (c *multilineCollector) get() []string {
+	c.guard.Lock()
+	defer c.guard.Unlock()
+	return append([]string{}, c.messages...)
+}
+
+func TestMultilineJoinerNegateAfter(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	collector := &multilineCollector{}
+
+	pattern := regexp.MustCompile(`^\d{4}-\d{2}-\d{2}`)
+	joiner := newMultilineJoiner(pattern, true, multilineMatchAfter, 0, 0, "\n", collector.enqueue)
+
+	lines := strings.Split(javaExceptionLog, "\n")
+	for _, line := range lines {
+		joiner.add([]byte(line))
+	}
+
+	messages := collector.get()
+	expect.Equal(2, len(messages))
+	expect.Equal(lines[0], messages[0])
+	expect.Equal(strings.Join(lines[1:7], "\n"), messages[1])
+
+	joiner.close()
+	messages = collector.get()
+	expect.Equal(3, len(messages))
+	expect.Equal(lines[7], messages[2])
+}
+
+func TestMultilineJoinerAfter(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	collector := &multilineCollector{}
+
+	pattern := regexp.MustCompile(`^(\s|Caused by:|java\.)`)
+	joiner := newMultilineJoiner(pattern, false, multilineMatchAfter, 0, 0, "\n", collector.enqueue)
+
+	lines := strings.Split(javaExceptionLog, "\n")
+	for _, line := range lines {
+		joiner.add([]byte(line))
+	}
+	joiner.close()
+
+	messages := collector.get()
+	expect.Equal(3, len(messages))
+	expect.Equal(strings.Join(lines[1:7], "\n"), messages[1])
+}
+
+func TestMultilineJoinerBefore(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	collector := &multilineCollector{}
+
+	pattern := regexp.MustCompile(`\\$`)
+	joiner := newMultilineJoiner(pattern, false, multilineMatchBefore, 0, 0, "\n", collector.enqueue)
+
+	for _, line := range []string{"a \\", "b \\", "c", "d"} {
+		joiner.add([]byte(line))
+	}
+
+	messages := collector.get()
+	expect.Equal(2, len(messages))
+	expect.Equal("a \\\nb \\\nc", messages[0])
+	expect.Equal("d", messages[1])
+}
+
+func TestMultilineJoinerMaxLines(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	collector := &multilineCollector{}
+
+	pattern := regexp.MustCompile(`^\s`)
+	joiner := newMultilineJoiner(pattern, false, multilineMatchAfter, 2, 0, "\n", collector.enqueue)
+
+	for _, line := range []string{"a", " 1", " 2", " 3"} {
+		joiner.add([]byte(line))
+	}
+	joiner.close()
+
+	expect.Equal([]string{"a\n 1", " 2\n 3"}, collector.get())
+}
+
+func TestMultilineJoinerTimeout(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	collector := &multilineCollector{}
+
+	pattern := regexp.MustCompile(`^\s`)
+	joiner := newMultilineJoiner(pattern, false, multilineMatchAfter, 0, 10*time.Millisecond, "\n", collector.enqueue)
+	defer joiner.close()
+
+	joiner.add([]byte("exception"))
+	joiner.add([]byte("  at foo"))
+	expect.Equal(0, len(collector.get()))
+
+	time.Sleep(100 * time.Millisecond)
+	expect.Equal([]string{"exception\n  at foo"}, collector.get())
+}
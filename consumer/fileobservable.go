@@ -15,11 +15,13 @@
 package consumer
 
 import (
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
@@ -36,6 +38,11 @@ type observableFile struct {
 	buffer         *tio.BufferedReader
 	stopIfNotExist bool
 
+	id            fileID
+	storedID      fileID
+	rotatedSince  time.Time
+	rotationGrace time.Duration
+
 	lastStatCheck time.Time
 	retryDelay    time.Duration
 	pollDelay     time.Duration
@@ -47,6 +54,48 @@ type fileCursor struct {
 	offset int64
 }
 
+// fileID identifies a file independent of its name
+type fileID struct {
+	device uint64
+	inode  uint64
+}
+
+func (id fileID) isValid() bool {
+	return id.inode != 0
+}
+
+// parseOffsetFile reads the contents of an offset file. Offset files contain
+// the offset optionally followed by device and inode of the file the offset
+// belongs to, e.g. "1024 2049 1337".
+func parseOffsetFile(data []byte) (int64, fileID, error) {
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, fileID{}, fmt.Errorf("offset file is empty")
+	}
+
+	offset, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || len(fields) < 3 {
+		return offset, fileID{}, err
+	}
+
+	id := fileID{}
+	if id.device, err = strconv.ParseUint(fields[1], 10, 64); err != nil {
+		return offset, fileID{}, err
+	}
+	if id.inode, err = strconv.ParseUint(fields[2], 10, 64); err != nil {
+		return offset, fileID{}, err
+	}
+	return offset, id, nil
+}
+
+// formatOffsetFile creates the contents of an offset file
+func formatOffsetFile(offset int64, id fileID) []byte {
+	if !id.isValid() {
+		return []byte(strconv.FormatInt(offset, 10))
+	}
+	return []byte(fmt.Sprintf("%d %d %d", offset, id.device, id.inode))
+}
+
 func (fs *observableFile) close() error {
 	if fs.handle != nil {
 		return fs.handle.Close()
@@ -85,6 +134,32 @@ func (fs *observableFile) hasRotated(currentName string) bool {
 	return newStatErr != oldStatErr || !os.SameFile(newStat, oldStat)
 }
 
+// isTruncated returns true if the file is smaller than the current read
+// position, e.g. after a copy-truncate rotation.
+func (fs *observableFile) isTruncated() bool {
+	info, err := fs.handle.Stat()
+	if err != nil {
+		return false
+	}
+	position, err := fs.handle.Seek(0, io.SeekCurrent)
+	return err == nil && info.Size() < position
+}
+
+// isRotationDone returns true if the file has been rotated and the rotated
+// file has been read for at least rotationGrace.
+func (fs *observableFile) isRotationDone(currentName string) bool {
+	if fs.rotatedSince.IsZero() {
+		if !fs.hasRotated(currentName) {
+			return false
+		}
+		fs.rotatedSince = time.Now()
+		if fs.rotationGrace > 0 {
+			fs.log.Infof("File rotated, continue reading for %v", fs.rotationGrace)
+		}
+	}
+	return time.Since(fs.rotatedSince) >= fs.rotationGrace
+}
+
 func (fs *observableFile) storeOffset() {
 	fs.cursor.offset, _ = fs.handle.Seek(0, io.SeekCurrent)
 	fs.saveOffset(fs.cursor.offset)
@@ -94,8 +169,7 @@ func (fs *observableFile) saveOffset(offset int64) {
 	if len(fs.offsetFileName) == 0 {
 		return
 	}
-	offsetAsString := strconv.FormatInt(offset, 10)
-	if err := ioutil.WriteFile(fs.offsetFileName, []byte(offsetAsString), 0644); err != nil {
+	if err := ioutil.WriteFile(fs.offsetFileName, formatOffsetFile(offset, fs.id), 0644); err != nil {
 		fs.log.WithError(err).Error("Failed to store offset")
 	}
 }
@@ -110,6 +184,18 @@ func (fs *observableFile) scrape(fileName string, enqueue func([]byte), onRotate
 			return // wait between retries
 		}
 
+		fs.id = fileID{}
+		if info, err := handle.Stat(); err == nil {
+			fs.id, _ = getFileID(info)
+		}
+
+		// The offset is only valid for the file it was stored for
+		if fs.storedID.isValid() && fs.id.isValid() && fs.storedID != fs.id {
+			fs.log.Info("File changed since offset was stored, reading from start")
+			fs.cursor = fileCursor{whence: io.SeekStart}
+		}
+		fs.storedID = fileID{}
+
 		if fs.cursor.offset, err = handle.Seek(fs.cursor.offset, fs.cursor.whence); err != nil {
 			fs.log.WithError(err).Warning("Failed to seek to given offset")
 		}
@@ -122,11 +208,21 @@ func (fs *observableFile) scrape(fileName string, enqueue func([]byte), onRotate
 	switch err {
 	case nil:
 	case io.EOF:
-		if fs.hasRotated(fileName) {
+		switch {
+		case fs.isTruncated():
+			fs.log.Info("File truncated")
+			fs.buffer.Reset(0)
+			fs.cursor.whence = io.SeekStart
+			fs.cursor.offset, _ = fs.handle.Seek(0, io.SeekStart)
+			fs.saveOffset(fs.cursor.offset)
+
+		case fs.isRotationDone(fileName):
 			fs.log.Info("File rotated")
 			fs.handle.Close()
 			fs.handle = nil
 			fs.buffer.Reset(0)
+			fs.id = fileID{}
+			fs.rotatedSince = time.Time{}
 
 			fs.cursor.whence = io.SeekStart
 			fs.cursor.offset = 0
@@ -0,0 +1,219 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/trivago/tgo/tio"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func newTestObservableFile(fileName string, grace time.Duration) *observableFile {
+	return &observableFile{
+		fileName:      fileName,
+		cursor:        fileCursor{whence: io.SeekStart},
+		rotationGrace: grace,
+		retryDelay:    time.Millisecond,
+		buffer:        tio.NewBufferedReader(fileBufferGrowSize, tio.BufferedReaderFlagDelimiter, 0, "\n"),
+		log:           logrus.StandardLogger(),
+	}
+}
+
+func appendToFile(t *testing.T, fileName string, data string) {
+	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(data); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestObservableFileRenameAndCreate(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	fileName := filepath.Join(dir, "test.log")
+	appendToFile(t, fileName, "a\nb\n")
+
+	file := newTestObservableFile(fileName, 0)
+	defer file.close()
+
+	lines := []string{}
+	enqueue := func(data []byte) { lines = append(lines, string(data)) }
+	rotations := 0
+	onRotate := func() { rotations++ }
+
+	file.scrape(fileName, enqueue, onRotate)
+	expect.Equal([]string{"a", "b"}, lines)
+
+	// Late write to the rotated file must still be read
+	expect.NoError(os.Rename(fileName, fileName+".1"))
+	appendToFile(t, fileName+".1", "c\n")
+	appendToFile(t, fileName, "d\n")
+
+	file.scrape(fileName, enqueue, onRotate)
+	expect.Equal([]string{"a", "b", "c"}, lines)
+	expect.Equal(0, rotations)
+
+	file.scrape(fileName, enqueue, onRotate) // EOF, detects rotation
+	expect.Equal(1, rotations)
+
+	file.scrape(fileName, enqueue, onRotate)
+	expect.Equal([]string{"a", "b", "c", "d"}, lines)
+}
+
+func TestObservableFileRotationGracePeriod(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	fileName := filepath.Join(dir, "test.log")
+	appendToFile(t, fileName, "a\n")
+
+	file := newTestObservableFile(fileName, 50*time.Millisecond)
+	defer file.close()
+
+	lines := []string{}
+	enqueue := func(data []byte) { lines = append(lines, string(data)) }
+
+	file.scrape(fileName, enqueue, func() {})
+	expect.NoError(os.Rename(fileName, fileName+".1"))
+	appendToFile(t, fileName, "c\n")
+
+	// Rotation detected, but the old file is kept open
+	file.scrape(fileName, enqueue, func() {})
+	appendToFile(t, fileName+".1", "b\n")
+	file.scrape(fileName, enqueue, func() {})
+	expect.Equal([]string{"a", "b"}, lines)
+	expect.NotNil(file.handle)
+
+	time.Sleep(60 * time.Millisecond)
+	file.scrape(fileName, enqueue, func() {})
+	expect.Nil(file.handle)
+
+	file.scrape(fileName, enqueue, func() {})
+	expect.Equal([]string{"a", "b", "c"}, lines)
+}
+
+func TestObservableFileCopyTruncate(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	fileName := filepath.Join(dir, "test.log")
+	appendToFile(t, fileName, "first\nsecond\n")
+
+	file := newTestObservableFile(fileName, 0)
+	defer file.close()
+
+	lines := []string{}
+	enqueue := func(data []byte) { lines = append(lines, string(data)) }
+
+	file.scrape(fileName, enqueue, func() {})
+	expect.Equal([]string{"first", "second"}, lines)
+
+	expect.NoError(os.Truncate(fileName, 0))
+	appendToFile(t, fileName, "third\n")
+
+	file.scrape(fileName, enqueue, func() {}) // detects truncation
+	file.scrape(fileName, enqueue, func() {})
+	expect.Equal([]string{"first", "second", "third"}, lines)
+}
+
+func TestObservableFileStoredID(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	fileName := filepath.Join(dir, "test.log")
+	appendToFile(t, fileName, "a\nb\n")
+
+	file := newTestObservableFile(fileName, 0)
+	file.offsetFileName = filepath.Join(dir, "test.log.offset")
+
+	lines := []string{}
+	enqueue := func(data []byte) { lines = append(lines, string(data)) }
+
+	file.scrape(fileName, enqueue, func() {})
+	file.storeOffset()
+	file.close()
+
+	data, err := ioutil.ReadFile(file.offsetFileName)
+	expect.NoError(err)
+	offset, id, err := parseOffsetFile(data)
+	expect.NoError(err)
+	expect.Equal(int64(4), offset)
+	expect.Equal(file.id, id)
+
+	// Same file: continue at offset
+	appendToFile(t, fileName, "c\n")
+	file = newTestObservableFile(fileName, 0)
+	file.cursor.offset = offset
+	file.storedID = id
+	lines = lines[:0]
+	file.scrape(fileName, enqueue, func() {})
+	file.close()
+	expect.Equal([]string{"c"}, lines)
+
+	if !id.isValid() {
+		return // file ids not supported on this platform
+	}
+
+	// Replaced file: start from the beginning
+	expect.NoError(os.Rename(fileName, fileName+".1"))
+	appendToFile(t, fileName, "x\ny\n")
+	file = newTestObservableFile(fileName, 0)
+	file.cursor.offset = offset
+	file.storedID = id
+	lines = lines[:0]
+	file.scrape(fileName, enqueue, func() {})
+	file.close()
+	expect.Equal([]string{"x", "y"}, lines)
+}
+
+func TestParseOffsetFile(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	offset, id, err := parseOffsetFile([]byte("1024"))
+	expect.NoError(err)
+	expect.Equal(int64(1024), offset)
+	expect.False(id.isValid())
+
+	offset, id, err = parseOffsetFile(formatOffsetFile(42, fileID{device: 1, inode: 2}))
+	expect.NoError(err)
+	expect.Equal(int64(42), offset)
+	expect.Equal(fileID{device: 1, inode: 2}, id)
+
+	_, _, err = parseOffsetFile([]byte(""))
+	expect.NotNil(err)
+}
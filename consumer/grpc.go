@@ -0,0 +1,156 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"sync"
+
+	"gollum/consumer/grpcpb"
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// GRPC consumer plugin
+//
+// This consumer starts a gRPC server implementing the "gollum.Ingest" service
+// defined in consumer/grpcpb/record.proto. Clients open a stream by calling
+// Push and send one Record per message. Each record is enqueued as a message
+// containing the record's data. Once the client closes the stream the number
+// of received records is returned.
+// As records are only read after the previous one has been enqueued, clients
+// are slowed down by gRPC flow control if gollum cannot keep up.
+//
+// Parameters
+//
+// - Address: Defines the TCP port and optional IP address to listen on.
+// By default this parameter is set to ":5880".
+//
+// - SetMetadata: When set to true, the fields of a record are stored as
+// metadata of the message.
+// By default this parameter is set to false.
+//
+// - Certificate: Path to an X509 formatted certificate file. If defined, turns
+// on TLS support in the gRPC server. Requires PrivateKey to be set.
+//
+// - PrivateKey: Path to an X509 formatted private key file. Meaningful only in
+// conjunction with Certificate.
+//
+// Examples
+//
+// This example listens on port 5880 and stores record fields as metadata.
+//
+//  GrpcIn:
+//    Type: consumer.GRPC
+//    Streams: grpc_in
+//    Address: ":5880"
+//    SetMetadata: true
+type GRPC struct {
+	core.SimpleConsumer `gollumdoc:"embed_type"`
+	address             string `config:"Address" default:":5880"`
+	setMetadata         bool   `config:"SetMetadata" default:"false"`
+	certificate         *tls.Config
+	server              *grpc.Server
+}
+
+func init() {
+	core.TypeRegistry.Register(GRPC{})
+}
+
+// Configure initializes this consumer with values from a plugin config.
+func (cons *GRPC) Configure(conf core.PluginConfigReader) {
+	certificateFile := conf.GetString("Certificate", "")
+	keyFile := conf.GetString("PrivateKey", "")
+
+	if certificateFile != "" || keyFile != "" {
+		if certificateFile == "" || keyFile == "" {
+			conf.Errors.Pushf("There must always be a certificate and a private key or none of both")
+		} else {
+			keypair, err := tls.LoadX509KeyPair(certificateFile, keyFile)
+			if !conf.Errors.Push(err) {
+				cons.certificate = &tls.Config{
+					Certificates: []tls.Certificate{keypair},
+				}
+			}
+		}
+	}
+
+	options := []grpc.ServerOption{}
+	if cons.certificate != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(cons.certificate)))
+	}
+
+	cons.server = grpc.NewServer(options...)
+	grpcpb.RegisterIngestServer(cons.server, cons)
+}
+
+// Push implements grpcpb.IngestServer. Records are enqueued until the client
+// closes the stream.
+func (cons *GRPC) Push(stream grpcpb.Ingest_PushServer) error {
+	count := uint64(0)
+	for {
+		record, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&grpcpb.PushResponse{Count: count})
+		}
+		if err != nil {
+			return err // ### return, stream broken ###
+		}
+
+		cons.enqueueRecord(record)
+		count++
+	}
+}
+
+func (cons *GRPC) enqueueRecord(record *grpcpb.Record) {
+	if !cons.setMetadata || len(record.Fields) == 0 {
+		cons.Enqueue(record.Data)
+		return
+	}
+
+	metadata := tcontainer.MarshalMap{}
+	for key, value := range record.Fields {
+		metadata[key] = value
+	}
+	cons.EnqueueWithMetadata(record.Data, metadata)
+}
+
+func (cons *GRPC) serve(listener net.Listener) {
+	defer cons.WorkerDone()
+
+	if err := cons.server.Serve(listener); err != nil && err != grpc.ErrServerStopped {
+		cons.Logger.Error(err)
+	}
+}
+
+// Consume starts the gRPC server and listens on the configured address
+func (cons *GRPC) Consume(workers *sync.WaitGroup) {
+	listener, err := net.Listen("tcp", cons.address)
+	if err != nil {
+		cons.Logger.Error(err)
+		return // ### return, could not listen ###
+	}
+
+	cons.AddMainWorker(workers)
+	go cons.serve(listener)
+	defer cons.server.Stop()
+
+	cons.ControlLoop()
+}
@@ -0,0 +1,119 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"gollum/consumer/grpcpb"
+	"gollum/core"
+
+	"github.com/trivago/tgo/ttesting"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func pushGRPCRecords(t *testing.T, cons *GRPC, records []*grpcpb.Record) uint64 {
+	expect := ttesting.NewExpect(t)
+
+	listener := bufconn.Listen(1024 * 1024)
+	go cons.server.Serve(listener)
+	defer cons.server.Stop()
+
+	dialer := func(ctx context.Context, address string) (net.Conn, error) {
+		return listener.Dial()
+	}
+	conn, err := grpc.Dial("bufconn", grpc.WithContextDialer(dialer), grpc.WithInsecure())
+	expect.NoError(err)
+	defer conn.Close()
+
+	stream, err := grpcpb.NewIngestClient(conn).Push(context.Background())
+	expect.NoError(err)
+	for _, record := range records {
+		expect.NoError(stream.Send(record))
+	}
+
+	response, err := stream.CloseAndRecv()
+	expect.NoError(err)
+
+	return response.GetCount()
+}
+
+func TestGRPCPush(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	router := newMockRouter(t.Name(), 2)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.GRPC")
+	config.Override("Streams", t.Name())
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*GRPC)
+	expect.True(casted)
+
+	count := pushGRPCRecords(t, cons, []*grpcpb.Record{
+		{Data: []byte("first")},
+		{Data: []byte("second"), Fields: map[string]string{"key": "value"}},
+	})
+
+	expect.Equal(uint64(2), count)
+
+	messages := router.receive(t, 2)
+	expect.Equal("first", messages[0].String())
+	expect.Equal("second", messages[1].String())
+	expect.Equal(0, len(messages[1].GetMetadata()))
+}
+
+func TestGRPCPushSetMetadata(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	router := newMockRouter(t.Name(), 1)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.GRPC")
+	config.Override("Streams", t.Name())
+	config.Override("SetMetadata", true)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*GRPC)
+	expect.True(casted)
+
+	count := pushGRPCRecords(t, cons, []*grpcpb.Record{
+		{Data: []byte("data"), Fields: map[string]string{"host": "localhost", "level": "info"}},
+	})
+
+	expect.Equal(uint64(1), count)
+
+	messages := router.receive(t, 1)
+	expect.Equal("data", messages[0].String())
+
+	metadata := messages[0].GetMetadata()
+	expect.MapEqual(metadata, "host", "localhost")
+	expect.MapEqual(metadata, "level", "info")
+}
+
+func TestGRPCConfigureTLS(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.GRPC")
+	config.Override("Certificate", "cert.pem")
+	_, err := core.NewPluginWithConfig(config)
+	expect.NotNil(err)
+}
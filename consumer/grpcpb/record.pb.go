@@ -0,0 +1,208 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// source: record.proto
+
+/*
+Package grpcpb is a generated protocol buffer package.
+
+It is generated from these files:
+	record.proto
+
+It has these top-level messages:
+	Record
+	PushResponse
+*/
+package grpcpb
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+import (
+	context "golang.org/x/net/context"
+	grpc "google.golang.org/grpc"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+// Record is a single message sent to consumer.GRPC.
+type Record struct {
+	Data []byte `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	// Optional fields stored as message metadata if SetMetadata is enabled.
+	Fields map[string]string `protobuf:"bytes,2,rep,name=fields" json:"fields,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+}
+
+func (m *Record) Reset()                    { *m = Record{} }
+func (m *Record) String() string            { return proto.CompactTextString(m) }
+func (*Record) ProtoMessage()               {}
+func (*Record) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+func (m *Record) GetData() []byte {
+	if m != nil {
+		return m.Data
+	}
+	return nil
+}
+
+func (m *Record) GetFields() map[string]string {
+	if m != nil {
+		return m.Fields
+	}
+	return nil
+}
+
+// PushResponse is sent once the client has closed the stream.
+type PushResponse struct {
+	Count uint64 `protobuf:"varint,1,opt,name=count,proto3" json:"count,omitempty"`
+}
+
+func (m *PushResponse) Reset()                    { *m = PushResponse{} }
+func (m *PushResponse) String() string            { return proto.CompactTextString(m) }
+func (*PushResponse) ProtoMessage()               {}
+func (*PushResponse) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *PushResponse) GetCount() uint64 {
+	if m != nil {
+		return m.Count
+	}
+	return 0
+}
+
+func init() {
+	proto.RegisterType((*Record)(nil), "gollum.Record")
+	proto.RegisterType((*PushResponse)(nil), "gollum.PushResponse")
+}
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ context.Context
+var _ grpc.ClientConn
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+const _ = grpc.SupportPackageIsVersion4
+
+// Client API for Ingest service
+
+type IngestClient interface {
+	Push(ctx context.Context, opts ...grpc.CallOption) (Ingest_PushClient, error)
+}
+
+type ingestClient struct {
+	cc *grpc.ClientConn
+}
+
+func NewIngestClient(cc *grpc.ClientConn) IngestClient {
+	return &ingestClient{cc}
+}
+
+func (c *ingestClient) Push(ctx context.Context, opts ...grpc.CallOption) (Ingest_PushClient, error) {
+	stream, err := grpc.NewClientStream(ctx, &_Ingest_serviceDesc.Streams[0], c.cc, "/gollum.Ingest/Push", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &ingestPushClient{stream}
+	return x, nil
+}
+
+type Ingest_PushClient interface {
+	Send(*Record) error
+	CloseAndRecv() (*PushResponse, error)
+	grpc.ClientStream
+}
+
+type ingestPushClient struct {
+	grpc.ClientStream
+}
+
+func (x *ingestPushClient) Send(m *Record) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *ingestPushClient) CloseAndRecv() (*PushResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(PushResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Server API for Ingest service
+
+type IngestServer interface {
+	Push(Ingest_PushServer) error
+}
+
+func RegisterIngestServer(s *grpc.Server, srv IngestServer) {
+	s.RegisterService(&_Ingest_serviceDesc, srv)
+}
+
+func _Ingest_Push_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(IngestServer).Push(&ingestPushServer{stream})
+}
+
+type Ingest_PushServer interface {
+	SendAndClose(*PushResponse) error
+	Recv() (*Record, error)
+	grpc.ServerStream
+}
+
+type ingestPushServer struct {
+	grpc.ServerStream
+}
+
+func (x *ingestPushServer) SendAndClose(m *PushResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *ingestPushServer) Recv() (*Record, error) {
+	m := new(Record)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+var _Ingest_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "gollum.Ingest",
+	HandlerType: (*IngestServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Push",
+			Handler:       _Ingest_Push_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "record.proto",
+}
+
+func init() { proto.RegisterFile("record.proto", fileDescriptor0) }
+
+var fileDescriptor0 = []byte{
+	// 220 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x54, 0x50, 0x4f, 0x4b, 0xc3, 0x30,
+	0x14, 0x27, 0x5d, 0x0d, 0xf8, 0x56, 0x44, 0x1e, 0x43, 0x4a, 0x4f, 0x63, 0x78, 0xe8, 0x29, 0x83,
+	0x7a, 0x99, 0x1e, 0x05, 0x05, 0x6f, 0x92, 0xa3, 0xb7, 0xae, 0x7d, 0x56, 0x31, 0x4b, 0x42, 0xfe,
+	0x08, 0xfb, 0x0c, 0x7e, 0x69, 0x69, 0xa2, 0xb0, 0xdd, 0x7e, 0xff, 0x79, 0x3c, 0xa8, 0x1c, 0x0d,
+	0xc6, 0x8d, 0xc2, 0x3a, 0x13, 0x0c, 0xf2, 0xc9, 0x28, 0x15, 0x0f, 0x9b, 0x1f, 0x06, 0x5c, 0x26,
+	0x03, 0x11, 0xca, 0xb1, 0x0f, 0x7d, 0xcd, 0xd6, 0xac, 0xad, 0x64, 0xc2, 0xd8, 0x01, 0x7f, 0xff,
+	0x24, 0x35, 0xfa, 0xba, 0x58, 0x2f, 0xda, 0x65, 0xd7, 0x88, 0xdc, 0x13, 0xb9, 0x23, 0x9e, 0x93,
+	0xf9, 0xa4, 0x83, 0x3b, 0xca, 0xbf, 0x64, 0x73, 0x0f, 0xcb, 0x13, 0x19, 0xaf, 0x61, 0xf1, 0x45,
+	0xc7, 0xb4, 0x7a, 0x29, 0x67, 0x88, 0x2b, 0xb8, 0xf8, 0xee, 0x55, 0xa4, 0xba, 0x48, 0x5a, 0x26,
+	0x0f, 0xc5, 0x8e, 0x6d, 0x6e, 0xa1, 0x7a, 0x8d, 0xfe, 0x43, 0x92, 0xb7, 0x46, 0x7b, 0x9a, 0x93,
+	0x83, 0x89, 0x3a, 0xa4, 0x76, 0x29, 0x33, 0xe9, 0x76, 0xc0, 0x5f, 0xf4, 0x44, 0x3e, 0xa0, 0x80,
+	0x72, 0xce, 0xe3, 0xd5, 0xf9, 0x59, 0xcd, 0xea, 0x9f, 0x9f, 0xae, 0xb5, 0xec, 0xb1, 0x7e, 0xbb,
+	0xc9, 0xc6, 0x76, 0x30, 0xda, 0xc7, 0x03, 0xb9, 0xed, 0xe4, 0xec, 0x60, 0xf7, 0x7b, 0x9e, 0xde,
+	0x72, 0xf7, 0x3b, 0x00, 0xc9, 0x82, 0x14, 0xae, 0x26, 0x01, 0x00, 0x00,
+}
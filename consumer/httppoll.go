@@ -0,0 +1,359 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+)
+
+// HTTPPoll consumer plugin
+//
+// This consumer periodically requests a URL via HTTP GET and enqueues the
+// response body as a message. If ItemsPath is set, the response is parsed as
+// JSON and each element of the addressed array is enqueued as a separate
+// message.
+// Requests are sent with the ETag and Last-Modified values of the previous
+// response, so unchanged responses are not enqueued again. Paginated
+// responses are followed via a "Link" header with rel="next" or the value
+// addressed by NextPath.
+//
+// Metadata
+//
+// *NOTE: The metadata will only set if the parameter `SetMetadata` is active.*
+//
+// - url: Contains the URL the message was read from
+//
+// - status: Contains the HTTP status code of the response
+//
+// Parameters
+//
+// - URL: Defines the URL to request.
+// By default this parameter is set to "http://localhost/".
+//
+// - IntervalMs: Defines the time in milliseconds between two polls.
+// By default this parameter is set to "60000".
+//
+// - TimeoutMs: Defines the timeout in milliseconds for each request.
+// By default this parameter is set to "10000".
+//
+// - Headers: Defines a map of additional request headers, e.g. to send an
+// "Authorization" header.
+// By default this parameter is set to an empty map.
+//
+// - User, Password: Define the credentials used for HTTP basic
+// authentication. Basic authentication is only used if User is set.
+// By default these parameters are set to "".
+//
+// - ItemsPath: Defines the path to an array inside the JSON response. Each
+// element of this array is enqueued as JSON encoded message. Nested fields
+// can be addressed by a path like "data/items". Set this value to "." if the
+// response itself is an array. If empty, the response body is enqueued as-is.
+// By default this parameter is set to "".
+//
+// - NextPath: Defines the path to a value inside the JSON response that
+// points to the next page. The value can be an absolute or relative URL. If
+// CursorParam is set, the value is added to URL as query parameter instead.
+// Pagination stops if the value is missing or empty.
+// By default this parameter is set to "".
+//
+// - CursorParam: Defines the name of the query parameter used to pass the
+// value of NextPath to the next request.
+// By default this parameter is set to "".
+//
+// - MaxPages: Defines the maximum number of pages requested per poll.
+// By default this parameter is set to "100".
+//
+// - SetMetadata: When this value is set to "true", the fields mentioned in the
+// metadata section will be added to each message.
+// By default this parameter is set to "false".
+//
+// Examples
+//
+// This example polls a paginated REST API every minute and enqueues each
+// element of the "events" array.
+//
+//  EventsIn:
+//    Type: consumer.HTTPPoll
+//    Streams: events
+//    URL: https://api.example.com/v1/events
+//    IntervalMs: 60000
+//    Headers:
+//      Authorization: "Bearer secret"
+//    ItemsPath: events
+//    NextPath: meta/next_cursor
+//    CursorParam: cursor
+//    SetMetadata: true
+type HTTPPoll struct {
+	core.SimpleConsumer `gollumdoc:"embed_type"`
+	interval            time.Duration `config:"IntervalMs" default:"60000" metric:"ms"`
+	user                string        `config:"User"`
+	password            string        `config:"Password"`
+	itemsPath           string        `config:"ItemsPath"`
+	nextPath            string        `config:"NextPath"`
+	cursorParam         string        `config:"CursorParam"`
+	maxPages            int           `config:"MaxPages" default:"100"`
+	hasToSetMetadata    bool          `config:"SetMetadata" default:"false"`
+	pollURL             *url.URL
+	headers             map[string]string
+	client              *http.Client
+	etag                string
+	lastModified        string
+	pollGuard           *sync.Mutex
+}
+
+func init() {
+	core.TypeRegistry.Register(HTTPPoll{})
+}
+
+// Configure initializes this consumer with values from a plugin config.
+func (cons *HTTPPoll) Configure(conf core.PluginConfigReader) {
+	cons.pollURL = conf.GetURL("URL", "http://localhost/")
+	cons.headers = conf.GetStringMap("Headers", map[string]string{})
+	cons.client = &http.Client{
+		Timeout: conf.GetDuration("TimeoutMs", 10*time.Second, time.Millisecond),
+	}
+	cons.pollGuard = new(sync.Mutex)
+
+	if cons.pollURL == nil || !cons.pollURL.IsAbs() {
+		conf.Errors.Pushf("URL must be an absolute URL")
+	}
+	if cons.interval <= 0 {
+		conf.Errors.Pushf("IntervalMs must be greater than 0")
+	}
+	if cons.cursorParam != "" && cons.nextPath == "" {
+		conf.Errors.Pushf("CursorParam requires NextPath to be set")
+	}
+}
+
+// newRequest creates a GET request for the given URL. Conditional headers are
+// only sent for the first page.
+func (cons *HTTPPoll) newRequest(pageURL *url.URL, firstPage bool) (*http.Request, error) {
+	req, err := http.NewRequest(http.MethodGet, pageURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, value := range cons.headers {
+		req.Header.Set(name, value)
+	}
+	if cons.user != "" {
+		req.SetBasicAuth(cons.user, cons.password)
+	}
+
+	if firstPage {
+		if cons.etag != "" {
+			req.Header.Set("If-None-Match", cons.etag)
+		}
+		if cons.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cons.lastModified)
+		}
+	}
+	return req, nil
+}
+
+// getItems returns the messages contained in the given response body and
+// the decoded body if it has been parsed as JSON.
+func (cons *HTTPPoll) getItems(body []byte) ([][]byte, interface{}, error) {
+	if cons.itemsPath == "" && cons.nextPath == "" {
+		return [][]byte{body}, nil, nil // ### return, no parsing required ###
+	}
+
+	var document interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return nil, nil, err
+	}
+
+	if cons.itemsPath == "" {
+		return [][]byte{body}, document, nil // ### return, body as-is ###
+	}
+
+	value, exists := getJSONPath(document, cons.itemsPath)
+	if !exists {
+		return [][]byte{}, document, nil // ### return, no items ###
+	}
+
+	items, isArray := value.([]interface{})
+	if !isArray {
+		return nil, document, fmt.Errorf("%s is not an array", cons.itemsPath)
+	}
+
+	messages := make([][]byte, 0, len(items))
+	for _, item := range items {
+		data, err := json.Marshal(item)
+		if err != nil {
+			return nil, document, err
+		}
+		messages = append(messages, data)
+	}
+	return messages, document, nil
+}
+
+// getJSONPath returns the value at the given path inside a decoded JSON
+// document. The path "." addresses the document itself.
+func getJSONPath(document interface{}, path string) (interface{}, bool) {
+	if path == "." {
+		return document, true
+	}
+
+	object, isObject := document.(map[string]interface{})
+	if !isObject {
+		return nil, false
+	}
+	return core.GetValuePath(tcontainer.MarshalMap(object), path)
+}
+
+// getNextURL returns the URL of the page following the given response or
+// nil if there is none.
+func (cons *HTTPPoll) getNextURL(pageURL *url.URL, resp *http.Response, document interface{}) (*url.URL, error) {
+	if cons.nextPath == "" {
+		if link := parseNextLink(resp.Header.Get("Link")); link != "" {
+			return pageURL.Parse(link)
+		}
+		return nil, nil // ### return, no next link ###
+	}
+
+	value, exists := getJSONPath(document, cons.nextPath)
+	if !exists || value == nil {
+		return nil, nil // ### return, last page ###
+	}
+
+	next := string(core.ConvertToBytes(value))
+	if next == "" {
+		return nil, nil // ### return, last page ###
+	}
+
+	if cons.cursorParam == "" {
+		return pageURL.Parse(next)
+	}
+
+	nextURL := *cons.pollURL
+	query := nextURL.Query()
+	query.Set(cons.cursorParam, next)
+	nextURL.RawQuery = query.Encode()
+	return &nextURL, nil
+}
+
+// parseNextLink returns the URL marked with rel="next" in a Link header as
+// defined by RFC 8288.
+func parseNextLink(header string) string {
+	for _, link := range strings.Split(header, ",") {
+		parts := strings.Split(link, ";")
+		target := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue // ### continue, invalid link ###
+		}
+
+		for _, param := range parts[1:] {
+			param = strings.Replace(strings.TrimSpace(param), " ", "", -1)
+			if param == `rel="next"` || param == "rel=next" {
+				return target[1 : len(target)-1]
+			}
+		}
+	}
+	return ""
+}
+
+// fetchPage requests a single page and enqueues its items. The URL of the
+// next page is returned if there is one.
+func (cons *HTTPPoll) fetchPage(pageURL *url.URL, firstPage bool) (*url.URL, error) {
+	req, err := cons.newRequest(pageURL, firstPage)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := cons.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, nil // ### return, nothing changed ###
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%s returned status %s", pageURL.Redacted(), resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	items, document, err := cons.getItems(body)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		if cons.hasToSetMetadata {
+			metaData := core.NewMetadata()
+			metaData.Set("url", pageURL.Redacted())
+			metaData.Set("status", resp.StatusCode)
+			cons.EnqueueWithMetadata(item, metaData)
+		} else {
+			cons.Enqueue(item)
+		}
+	}
+
+	if firstPage {
+		cons.etag = resp.Header.Get("ETag")
+		cons.lastModified = resp.Header.Get("Last-Modified")
+	}
+
+	return cons.getNextURL(pageURL, resp, document)
+}
+
+// poll requests the configured URL and all following pages.
+func (cons *HTTPPoll) poll() {
+	cons.pollGuard.Lock()
+	defer cons.pollGuard.Unlock()
+
+	pageURL := cons.pollURL
+	for page := 0; pageURL != nil; page++ {
+		if page == cons.maxPages {
+			cons.Logger.Warningf("Stopped after %d pages", cons.maxPages)
+			return // ### return, too many pages ###
+		}
+
+		nextURL, err := cons.fetchPage(pageURL, page == 0)
+		if err != nil {
+			cons.Logger.WithError(err).Error("Failed to poll URL")
+			return // ### return, request failed ###
+		}
+		pageURL = nextURL
+	}
+}
+
+// Consume starts polling the configured URL.
+func (cons *HTTPPoll) Consume(workers *sync.WaitGroup) {
+	cons.AddMainWorker(workers)
+	defer cons.WorkerDone()
+
+	cons.TickerControlLoop(cons.interval, cons.poll)
+}
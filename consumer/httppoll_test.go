@@ -0,0 +1,217 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func getPayloads(messages []*core.Message) []string {
+	payloads := []string{}
+	for _, msg := range messages {
+		payloads = append(payloads, msg.String())
+	}
+	return payloads
+}
+
+func TestHTTPPollBody(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		fmt.Fprintf(w, "%s %s:%s %s", r.Method, user, password, r.Header.Get("X-Api-Key"))
+	}))
+	defer server.Close()
+
+	router := newMockRouter(t.Name(), 1)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.HTTPPoll")
+	config.Override("Streams", t.Name())
+	config.Override("URL", server.URL+"/data")
+	config.Override("User", "gollum")
+	config.Override("Password", "secret")
+	config.Override("Headers", map[string]string{"X-Api-Key": "key"})
+	config.Override("SetMetadata", true)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*HTTPPoll)
+	expect.True(casted)
+
+	cons.poll()
+	msg := router.receive(t, 1)[0]
+	expect.Equal("GET gollum:secret key", msg.String())
+	expect.MapEqual(msg.GetMetadata(), "url", server.URL+"/data")
+	expect.MapEqual(msg.GetMetadata(), "status", http.StatusOK)
+}
+
+func TestHTTPPollItems(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"data":{"items":[{"id":1},{"id":2},"three"]}}`)
+	}))
+	defer server.Close()
+
+	router := newMockRouter(t.Name(), 3)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.HTTPPoll")
+	config.Override("Streams", t.Name())
+	config.Override("URL", server.URL)
+	config.Override("ItemsPath", "data/items")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*HTTPPoll)
+	expect.True(casted)
+
+	cons.poll()
+	expect.Equal([]string{`{"id":1}`, `{"id":2}`, `"three"`}, getPayloads(router.receive(t, 3)))
+
+	// A top-level array is addressed by "."
+	cons.itemsPath = "."
+	items, _, err := cons.getItems([]byte(`[1,2]`))
+	expect.NoError(err)
+	expect.Equal(2, len(items))
+}
+
+func TestHTTPPollNotModified(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, "content")
+	}))
+	defer server.Close()
+
+	router := newMockRouter(t.Name(), 2)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.HTTPPoll")
+	config.Override("Streams", t.Name())
+	config.Override("URL", server.URL)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*HTTPPoll)
+	expect.True(casted)
+
+	cons.poll()
+	expect.Equal([]string{"content"}, getPayloads(router.receive(t, 1)))
+
+	cons.poll()
+	expect.Equal(2, requests)
+	expect.Equal(0, len(router.messages))
+}
+
+func TestHTTPPollLinkHeader(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "" {
+			w.Header().Set("Link", `</items?page=2>; rel="next", </items>; rel="first"`)
+			fmt.Fprint(w, "first")
+			return
+		}
+		fmt.Fprint(w, "second")
+	}))
+	defer server.Close()
+
+	router := newMockRouter(t.Name(), 2)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.HTTPPoll")
+	config.Override("Streams", t.Name())
+	config.Override("URL", server.URL+"/items")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*HTTPPoll)
+	expect.True(casted)
+
+	cons.poll()
+	expect.Equal([]string{"first", "second"}, getPayloads(router.receive(t, 2)))
+}
+
+func TestHTTPPollCursor(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	pages := map[string]string{
+		"":   `{"items":["a","b"],"meta":{"next":"c1"}}`,
+		"c1": `{"items":["c"],"meta":{"next":"c2"}}`,
+		"c2": `{"items":["d"],"meta":{"next":null}}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expect.Equal("json", r.URL.Query().Get("format"))
+		fmt.Fprint(w, pages[r.URL.Query().Get("cursor")])
+	}))
+	defer server.Close()
+
+	router := newMockRouter(t.Name(), 4)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.HTTPPoll")
+	config.Override("Streams", t.Name())
+	config.Override("URL", server.URL+"/?format=json")
+	config.Override("ItemsPath", "items")
+	config.Override("NextPath", "meta/next")
+	config.Override("CursorParam", "cursor")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*HTTPPoll)
+	expect.True(casted)
+
+	cons.poll()
+	expect.Equal([]string{`"a"`, `"b"`, `"c"`, `"d"`}, getPayloads(router.receive(t, 4)))
+
+	// Pagination is limited by MaxPages
+	cons.maxPages = 2
+	cons.poll()
+	expect.Equal([]string{`"a"`, `"b"`, `"c"`}, getPayloads(router.receive(t, 3)))
+	expect.Equal(0, len(router.messages))
+}
+
+func TestHTTPPollConfigErrors(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	for idx, settings := range []map[string]interface{}{
+		{"URL": "/relative"},
+		{"IntervalMs": 0},
+		{"CursorParam": "cursor"},
+	} {
+		config := core.NewPluginConfig(fmt.Sprintf("%s%d", t.Name(), idx), "consumer.HTTPPoll")
+		for key, value := range settings {
+			config.Override(key, value)
+		}
+		_, err := core.NewPluginWithConfig(config)
+		expect.NotNil(err)
+	}
+}
@@ -15,12 +15,15 @@
 package consumer
 
 import (
+	"context"
 	"crypto/tls"
-	"crypto/x509"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -28,9 +31,12 @@ import (
 	"time"
 
 	"gollum/core"
+	"gollum/core/components"
 
 	kafka "github.com/Shopify/sarama"
 	cluster "github.com/bsm/sarama-cluster"
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/trivago/tgo/tcontainer"
 	"github.com/trivago/tgo/tsync"
 )
 
@@ -41,8 +47,17 @@ const (
 
 // Kafka consumer
 //
-// This consumer reads data from a kafka topic. It is based on the sarama
-// library; most settings are mapped to the settings from this library.
+// This consumer reads data from one or more kafka topics. It is based on the
+// sarama library; most settings are mapped to the settings from this library.
+// If GroupId is not set, the lag of each partition, i.e. the number of
+// messages not yet read, is exposed as the metric "<Topic>.<Partition>.lag".
+// The high-water mark used to calculate the lag is queried every
+// PresistTimoutMs.
+//
+// Topics can be given explicitly by Topic and Topics or by TopicPattern.
+// Topics matching TopicPattern are looked up every MetadataRefreshMs, so
+// topics created later on are read, too. Topics that have been read once are
+// read until the consumer is stopped, even if they are deleted.
 //
 // Metadata
 //
@@ -52,6 +67,9 @@ const (
 //
 // - key: Contains the key of the kafka message
 //
+// - header.<name>: Contains the value of the record header <name> as byte
+// slice. Record headers require Version to be at least 0.11.
+//
 // Parameters
 //
 // - Servers: Defines the list of all kafka brokers to initially connect to when
@@ -59,9 +77,18 @@ const (
 // ideally contains all the brokers in the cluster.
 // By default this parameter is set to ["localhost:9092"].
 //
-// - Topic: Defines the kafka topic to read from.
+// - Topic: Defines the kafka topic to read from. This topic is not read if
+// Topics or TopicPattern are set and Topic is not set explicitly.
 // By default this parameter is set to "default".
 //
+// - Topics: Defines a list of additional kafka topics to read from.
+// By default this parameter is set to an empty list.
+//
+// - TopicPattern: Defines a regular expression matched against the names of
+// all topics in the cluster. All matching topics are read. Please note that
+// this includes internal topics like "__consumer_offsets" if they match.
+// By default this parameter is set to "".
+//
 // - ClientId: Sets the client id used in requests by this consumer.
 // By default this parameter is set to "gollum".
 //
@@ -75,6 +102,28 @@ const (
 // version is chosen. If GroupId is set to a value < "0.9", "0.9.0.1" will be used.
 // By default this parameter is set to "0.8.2".
 //
+// - RebalanceStrategy: Defines how partitions are assigned to the members of
+// a consumer group. Only used if GroupId is set. "range" assigns consecutive
+// partitions of a topic to each member, which can lead to an uneven
+// distribution. "roundrobin" spreads partitions evenly across all members.
+// "sticky" spreads partitions evenly, too, but keeps as many partitions as
+// possible on their current member during a rebalance. This requires Version
+// to be set to 0.10.2 or later. Note that every rebalance stops consumption of
+// the whole group until all members have joined again.
+// By default this parameter is set to "range".
+//
+// - SessionTimeoutMs: Defines the time in milliseconds after which a group
+// member is considered dead if no heartbeat was received. Higher values
+// reduce rebalances caused by short hiccups but delay the takeover of
+// partitions from crashed members. Only used if GroupId is set.
+// By default this parameter is set to 30000.
+//
+// - HeartbeatIntervalMs: Defines the interval in milliseconds in which
+// heartbeats are sent to the group coordinator. This value must be lower than
+// SessionTimeoutMs and should not be more than a third of it. Only used if
+// GroupId is set.
+// By default this parameter is set to 3000.
+//
 // - SetMetadata: When this value is set to "true", the fields mentioned in the metadata
 // section will be added to each message. Adding metadata will have a
 // performance impact on systems with high throughput.
@@ -90,18 +139,43 @@ const (
 // given partition. If the consumer is restarted, reading continues from that
 // offset. To disable this setting, set it to "". Please note that offsets
 // stored in the file might be outdated. In that case DefaultOffset "oldest"
-// will be used.
+// will be used. Offsets of Topic are stored by partition, offsets of all
+// other topics by "<topic>:<partition>".
 // By default this parameter is set to "".
 //
 // - FolderPermissions: Used to create the path to the offset file if necessary.
 // By default this parameter is set to "0755".
 //
+// - CommitToKafka: When set to true and GroupId is not set, the offsets of all
+// partitions are committed to Kafka every PresistTimoutMs using the group
+// given by CommitGroupId. This allows external tools like burrow to observe
+// the consumer lag. The committed offsets are never read by this consumer, i.e.
+// reading still starts at the offsets stored in OffsetFile or DefaultOffset.
+// The group does not join the consumer group protocol, so it must not be used
+// by other consumers. OffsetFile can be used in parallel. This setting is
+// ignored if GroupId is set as offsets are committed for consumer groups
+// anyway.
+// By default this parameter is set to false.
+//
+// - CommitGroupId: Defines the name of the group offsets are committed to when
+// CommitToKafka is set to true. If empty, "gollum-<Topic>" is used if a
+// single topic is read and "gollum-<PluginId>" otherwise.
+// By default this parameter is set to "".
+//
 // - Ordered: Forces partitions to be read one-by-one in a round robin fashion
 // instead of reading them all in parallel. Please note that this may restore
 // the original ordering but does not necessarily do so. The term "ordered" refers
 // to an ordered reading of all partitions, as opposed to reading them randomly.
 // By default this parameter is set to false.
 //
+// - MaxWorkers: Defines the maximum number of go routines reading partitions
+// when GroupId is not set. Partitions are assigned to the workers round robin
+// and each worker reads its partitions one-by-one as done by Ordered. Set to 0
+// to read each partition in its own go routine. This setting is ignored if
+// Ordered is set to true, as this implies a single worker. Workers are
+// started per topic, so this limit applies to each topic separately.
+// By default this parameter is set to 0.
+//
 // - MaxOpenRequests: Defines the number of simultaneous connections to a
 // broker at a time.
 // By default this parameter is set to 5.
@@ -151,15 +225,30 @@ const (
 // By default this parameter is set to false.
 //
 // - TlsKeyLocation: Defines the path to the client's PEM-formatted private key
-// used for TLS based authentication.
+// used for TLS based authentication. Cannot be used together with TlsKeyPem.
+// By default this parameter is set to "".
+//
+// - TlsKeyPem: Defines the client's PEM-formatted private key used for TLS
+// based authentication. Can be used instead of TlsKeyLocation, e.g. when the
+// key is passed via an environment variable.
 // By default this parameter is set to "".
 //
 // - TlsCertificateLocation: Defines the path to the client's PEM-formatted
-// public key used for TLS based authentication.
+// public key used for TLS based authentication. Cannot be used together with
+// TlsCertificatePem.
+// By default this parameter is set to "".
+//
+// - TlsCertificatePem: Defines the client's PEM-formatted public key used for
+// TLS based authentication. Can be used instead of TlsCertificateLocation.
 // By default this parameter is set to "".
 //
 // - TlsCaLocation: Defines the path to the CA certificate(s) for verifying a
-// broker's key when using TLS based authentication.
+// broker's key when using TLS based authentication. Cannot be used together
+// with TlsCaPem.
+// By default this parameter is set to "".
+//
+// - TlsCaPem: Defines the PEM-formatted CA certificate(s) for verifying a
+// broker's key. Can be used instead of TlsCaLocation.
 // By default this parameter is set to "".
 //
 // - TlsServerName: Defines the expected hostname used by hostname verification
@@ -196,6 +285,19 @@ const (
 //      - "kafka1:9092"
 //      - "kafka2:9092"
 //      - "kafka3:9092"
+//
+// This config reads all topics starting with "logs-" as a consumer group,
+// including topics created while gollum is running.
+//
+//  kafkaIn:
+//    Type: consumer.Kafka
+//    Streams: logs
+//    TopicPattern: "^logs-"
+//    GroupId: gollum
+//    Version: "0.10"
+//    SetMetadata: true
+//    Servers:
+//      - "kafka0:9092"
 type Kafka struct {
 	core.SimpleConsumer `gollumdoc:"embed_type"`
 	client              kafka.Client
@@ -203,17 +305,48 @@ type Kafka struct {
 	config              *kafka.Config
 	groupClient         *cluster.Client
 	groupConfig         *cluster.Config
-	offsets             map[int32]*int64
+	saramaGroup         kafka.ConsumerGroup
+	topics              map[string]*kafkaTopic
+	topicsGuard         *sync.Mutex
+	offsetManager       kafka.OffsetManager
+	metricsRegistry     metrics.Registry
+	topicPattern        *regexp.Regexp
 	servers             []string `config:"Servers"`
 	topic               string   `config:"Topic" default:"default"`
+	topicList           []string `config:"Topics"`
 	group               string   `config:"GroupId"`
 	offsetFile          string   `config:"OffsetFile"`
+	commitToKafka       bool     `config:"CommitToKafka"`
+	commitGroup         string   `config:"CommitGroupId"`
 	defaultOffset       int64
 	persistTimeout      time.Duration `config:"PresistTimoutMs" default:"5000" metric:"ms"`
 	folderPermissions   os.FileMode   `config:"FolderPermissions" default:"0755"`
 	MaxPartitionID      int32
 	orderedRead         bool `config:"Ordered"`
+	maxWorkers          int  `config:"MaxWorkers" default:"0"`
 	hasToSetMetadata    bool `config:"SetMetadata" default:"false"`
+	useSaramaGroup      bool
+}
+
+// kafkaTopic holds the offsets and lag metrics of all partitions of a topic
+// read without consumer group
+type kafkaTopic struct {
+	name             string
+	offsets          map[int32]*int64
+	partitionOffsets map[int32]kafka.PartitionOffsetManager
+	partitionLags    map[int32]*kafkaPartitionLag
+	started          bool
+}
+
+type kafkaPartitionLag struct {
+	highWaterMark int64
+	metricsLag    metrics.Gauge
+}
+
+// kafkaGroupHandler passes all messages of a sarama group session to the
+// consumer and marks them as consumed.
+type kafkaGroupHandler struct {
+	cons *Kafka
 }
 
 func init() {
@@ -222,7 +355,9 @@ func init() {
 
 // Configure initializes this consumer with values from a plugin config.
 func (cons *Kafka) Configure(conf core.PluginConfigReader) {
-	cons.offsets = make(map[int32]*int64)
+	cons.topics = make(map[string]*kafkaTopic)
+	cons.topicsGuard = new(sync.Mutex)
+	cons.metricsRegistry = core.NewMetricsRegistryForPlugin(cons)
 	cons.MaxPartitionID = 0
 
 	cons.config = kafka.NewConfig()
@@ -266,35 +401,22 @@ func (cons *Kafka) Configure(conf core.PluginConfigReader) {
 	if cons.config.Net.TLS.Enable {
 		cons.config.Net.TLS.Config = &tls.Config{}
 
-		keyFile := conf.GetString("TlsKeyLocation", "")
-		certFile := conf.GetString("TlsCertificateLocation", "")
-		if keyFile != "" && certFile != "" {
-			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
-			if conf.Errors.Push(err) {
-				return
-			}
-			cons.config.Net.TLS.Config.Certificates = []tls.Certificate{cert}
-		} else if certFile == "" {
-			conf.Errors.Pushf("Cannot specify TlsKeyLocation without TlsCertificateLocation")
-			return
-		} else if keyFile == "" {
-			conf.Errors.Pushf("Cannot specify TlsCertificateLocation without TlsKeyLocation")
+		cert, err := components.ReadTLSKeyPair(conf)
+		if conf.Errors.Push(err) {
 			return
 		}
-
-		caFile := conf.GetString("TlsCaLocation", "")
-		if caFile == "" {
-			conf.Errors.Pushf("TlsEnable is set to true, but no TlsCaLocation was specified")
-			return
+		if cert != nil {
+			cons.config.Net.TLS.Config.Certificates = []tls.Certificate{*cert}
 		}
 
-		caCert, err := ioutil.ReadFile(caFile)
+		caCertPool, err := components.ReadTLSCertPool(conf)
 		if conf.Errors.Push(err) {
 			return
 		}
-
-		caCertPool := x509.NewCertPool()
-		caCertPool.AppendCertsFromPEM(caCert)
+		if caCertPool == nil {
+			conf.Errors.Pushf("TlsEnable is set to true, but neither TlsCaLocation nor TlsCaPem was specified")
+			return
+		}
 		cons.config.Net.TLS.Config.RootCAs = caCertPool
 
 		serverName := conf.GetString("TlsServerName", "")
@@ -320,6 +442,11 @@ func (cons *Kafka) Configure(conf core.PluginConfigReader) {
 	cons.config.Consumer.Fetch.Default = int32(conf.GetInt("DefaultFetchSizeByte", 32768))
 	cons.config.Consumer.MaxWaitTime = time.Duration(conf.GetInt("FetchTimeoutMs", 250)) * time.Millisecond
 
+	cons.topicPattern = conf.GetRegexp("TopicPattern", "")
+	if conf.HasValue("Topic") || (len(cons.topicList) == 0 && cons.topicPattern == nil) {
+		cons.topicList = append([]string{cons.topic}, cons.topicList...)
+	}
+
 	if cons.group != "" {
 		cons.offsetFile = "" // forcibly ignore this option
 		switch cons.config.Version {
@@ -330,6 +457,54 @@ func (cons *Kafka) Configure(conf core.PluginConfigReader) {
 
 		cons.groupConfig = cluster.NewConfig()
 		cons.groupConfig.Config = *cons.config
+
+		switch strategy := strings.ToLower(conf.GetString("RebalanceStrategy", "range")); strategy {
+		case "range":
+			cons.groupConfig.Group.PartitionStrategy = cluster.StrategyRange
+		case "roundrobin":
+			cons.groupConfig.Group.PartitionStrategy = cluster.StrategyRoundRobin
+		case "sticky":
+			// The cluster client does not support sticky assignment, so the
+			// consumer group of sarama is used instead.
+			if !cons.config.Version.IsAtLeast(kafka.V0_10_2_0) {
+				conf.Errors.Pushf("RebalanceStrategy sticky requires Version 0.10.2 or later")
+			}
+			cons.groupConfig.Consumer.Group.Rebalance.Strategy = kafka.BalanceStrategySticky
+			cons.useSaramaGroup = true
+		default:
+			conf.Errors.Pushf("Unknown RebalanceStrategy \"%s\"", strategy)
+		}
+
+		cons.groupConfig.Group.Topics.Whitelist = cons.topicPattern
+		cons.groupConfig.Group.Session.Timeout = time.Duration(conf.GetInt("SessionTimeoutMs", 30000)) * time.Millisecond
+		cons.groupConfig.Group.Heartbeat.Interval = time.Duration(conf.GetInt("HeartbeatIntervalMs", 3000)) * time.Millisecond
+		cons.groupConfig.Consumer.Group.Session.Timeout = cons.groupConfig.Group.Session.Timeout
+		cons.groupConfig.Consumer.Group.Heartbeat.Interval = cons.groupConfig.Group.Heartbeat.Interval
+
+		switch {
+		case cons.groupConfig.Group.Heartbeat.Interval <= 0 || cons.groupConfig.Group.Session.Timeout <= 0:
+			conf.Errors.Pushf("SessionTimeoutMs and HeartbeatIntervalMs must be greater than 0")
+		case cons.groupConfig.Group.Heartbeat.Interval >= cons.groupConfig.Group.Session.Timeout:
+			conf.Errors.Pushf("HeartbeatIntervalMs must be lower than SessionTimeoutMs")
+		case cons.groupConfig.Group.Heartbeat.Interval > cons.groupConfig.Group.Session.Timeout/3:
+			cons.Logger.Warning("HeartbeatIntervalMs should not be more than a third of SessionTimeoutMs")
+		}
+	}
+
+	if cons.commitToKafka && cons.group != "" {
+		cons.Logger.Warning("CommitToKafka is ignored as GroupId is set")
+		cons.commitToKafka = false
+	}
+	if cons.commitToKafka {
+		if cons.commitGroup == "" {
+			if len(cons.topicList) == 1 && cons.topicPattern == nil {
+				cons.commitGroup = "gollum-" + cons.topicList[0]
+			} else {
+				cons.commitGroup = "gollum-" + cons.GetID()
+			}
+		}
+		// Offsets are committed together with the offset file
+		cons.config.Consumer.Offsets.AutoCommit.Enable = false
 	}
 
 	offsetValue := strings.ToLower(conf.GetString("DefaultOffset", kafkaOffsetNewest))
@@ -357,12 +532,16 @@ func (cons *Kafka) Configure(conf core.PluginConfigReader) {
 			}
 
 			for k, v := range encodedOffsets {
-				id, err := strconv.Atoi(k)
+				topicName, partition := cons.topic, k
+				if sep := strings.LastIndex(k, ":"); sep >= 0 {
+					topicName, partition = k[:sep], k[sep+1:]
+				}
+				id, err := strconv.Atoi(partition)
 				if conf.Errors.Push(err) {
 					return
 				}
 				startOffset := v
-				cons.offsets[int32(id)] = &startOffset
+				cons.getTopic(topicName).offsets[int32(id)] = &startOffset
 			}
 		}
 	}
@@ -370,6 +549,37 @@ func (cons *Kafka) Configure(conf core.PluginConfigReader) {
 	kafka.Logger = cons.Logger.WithField("Scope", "Sarama")
 }
 
+// getTopic returns the state of the given topic and creates it if necessary.
+// Expects topicsGuard to be locked after Configure.
+func (cons *Kafka) getTopic(name string) *kafkaTopic {
+	topic, exists := cons.topics[name]
+	if !exists {
+		topic = &kafkaTopic{
+			name:             name,
+			offsets:          make(map[int32]*int64),
+			partitionOffsets: make(map[int32]kafka.PartitionOffsetManager),
+			partitionLags:    make(map[int32]*kafkaPartitionLag),
+		}
+		cons.topics[name] = topic
+	}
+	return topic
+}
+
+// getStartedTopics returns all topics currently read. The partitions of these
+// topics do not change anymore.
+func (cons *Kafka) getStartedTopics() []*kafkaTopic {
+	cons.topicsGuard.Lock()
+	defer cons.topicsGuard.Unlock()
+
+	topics := make([]*kafkaTopic, 0, len(cons.topics))
+	for _, topic := range cons.topics {
+		if topic.started {
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
 func (cons *Kafka) restartGroup() {
 	time.Sleep(cons.persistTimeout)
 	cons.readFromGroup()
@@ -377,10 +587,10 @@ func (cons *Kafka) restartGroup() {
 
 // Main fetch loop for kafka events
 func (cons *Kafka) readFromGroup() {
-	consumer, err := cluster.NewConsumerFromClient(cons.groupClient, cons.group, []string{cons.topic})
+	consumer, err := cluster.NewConsumerFromClient(cons.groupClient, cons.group, cons.topicList)
 	if err != nil {
 		defer cons.restartGroup()
-		cons.Logger.Errorf("Restarting kafka consumer (%s:%s) - %s", cons.topic, cons.group, err.Error())
+		cons.Logger.Errorf("Restarting kafka consumer (%s:%s) - %s", strings.Join(cons.topicList, ","), cons.group, err.Error())
 		return // ### return, stop and retry ###
 	}
 
@@ -415,15 +625,121 @@ func (cons *Kafka) readFromGroup() {
 	}
 }
 
-func (cons *Kafka) startConsumerForPartition(partitionID int32) kafka.PartitionConsumer {
+// readFromSaramaGroup is used instead of readFromGroup for rebalance
+// strategies not supported by the cluster client. A group session ends with
+// every rebalance, so a new session is started until the group is closed.
+func (cons *Kafka) readFromSaramaGroup() {
+	cons.AddWorker()
+	defer cons.WorkerDone()
+
+	handler := kafkaGroupHandler{cons: cons}
+	for {
+		topics, err := cons.getGroupTopics()
+		if err == nil {
+			ctx, cancel := context.WithCancel(context.Background())
+			if cons.topicPattern != nil {
+				go cons.watchGroupTopics(ctx, cancel, topics)
+			}
+			err = cons.saramaGroup.Consume(ctx, topics, handler)
+			cancel()
+		}
+
+		switch {
+		case err == kafka.ErrClosedConsumerGroup:
+			return // ### return, group closed ###
+		case err != nil:
+			cons.Logger.Errorf("Restarting kafka consumer (%s:%s) - %s", strings.Join(topics, ","), cons.group, err.Error())
+			time.Sleep(cons.persistTimeout)
+		}
+	}
+}
+
+// Setup is called before a group session starts consuming.
+func (handler kafkaGroupHandler) Setup(kafka.ConsumerGroupSession) error {
+	return nil
+}
+
+// Cleanup is called after all claims of a group session have been consumed.
+func (handler kafkaGroupHandler) Cleanup(kafka.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim reads all messages of a partition assigned to this member
+// until the group session ends.
+func (handler kafkaGroupHandler) ConsumeClaim(session kafka.ConsumerGroupSession, claim kafka.ConsumerGroupClaim) error {
+	for event := range claim.Messages() {
+		handler.cons.enqueueEvent(event)
+		session.MarkMessage(event, "")
+	}
+	return nil
+}
+
+// getGroupTopics returns the topics to read with readFromSaramaGroup, i.e.
+// Topics and all topics matching TopicPattern.
+func (cons *Kafka) getGroupTopics() ([]string, error) {
+	if cons.topicPattern == nil {
+		return cons.topicList, nil
+	}
+
+	allTopics, err := cons.client.Topics()
+	if err != nil {
+		return nil, err
+	}
+
+	matching := make(map[string]bool)
+	for _, name := range cons.topicList {
+		matching[name] = true
+	}
+	for _, name := range allTopics {
+		if cons.topicPattern.MatchString(name) {
+			matching[name] = true
+		}
+	}
+
+	topics := make([]string, 0, len(matching))
+	for name := range matching {
+		topics = append(topics, name)
+	}
+	sort.Strings(topics)
+	return topics, nil
+}
+
+// watchGroupTopics cancels the current group session if the topics matching
+// TopicPattern changed. The topics are checked every MetadataRefreshMs until
+// the session ends.
+func (cons *Kafka) watchGroupTopics(ctx context.Context, cancel context.CancelFunc, topics []string) {
+	if cons.config.Metadata.RefreshFrequency <= 0 {
+		return // ### return, metadata is never refreshed ###
+	}
+
+	ticker := time.NewTicker(cons.config.Metadata.RefreshFrequency)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return // ### return, session ended ###
+
+		case <-ticker.C:
+			newTopics, err := cons.getGroupTopics()
+			if err == nil && strings.Join(newTopics, ",") != strings.Join(topics, ",") {
+				cons.Logger.Info("Topics matching TopicPattern changed, rejoining group")
+				cancel()
+				return // ### return, session canceled ###
+			}
+		}
+	}
+}
+
+func (cons *Kafka) startConsumerForPartition(topic *kafkaTopic, partitionID int32) kafka.PartitionConsumer {
 	for !cons.client.Closed() {
-		startOffset := atomic.LoadInt64(cons.offsets[partitionID])
-		consumer, err := cons.consumer.ConsumePartition(cons.topic, partitionID, startOffset)
+		startOffset := atomic.LoadInt64(topic.offsets[partitionID])
+		consumer, err := cons.consumer.ConsumePartition(topic.name, partitionID, startOffset)
 		if err == nil {
 			return consumer // ### return, success ###
 		}
 
-		cons.Logger.Errorf("Failed to start kafka consumer (%s:%d) - %s", cons.topic, startOffset, err.Error())
+		cons.Logger.Errorf("Failed to start kafka consumer (%s:%d) - %s", topic.name, startOffset, err.Error())
 
 		// Reset offset to default value if we have an offset error
 		if err == kafka.ErrOffsetOutOfRange {
@@ -431,7 +747,7 @@ func (cons *Kafka) startConsumerForPartition(partitionID int32) kafka.PartitionC
 			// and choose OffsetOldest or OffsetNewset accordingly.
 			// At the moment we stick to the most common case here.
 			startOffset = kafka.OffsetOldest
-			atomic.StoreInt64(cons.offsets[partitionID], startOffset)
+			atomic.StoreInt64(topic.offsets[partitionID], startOffset)
 		} else {
 			time.Sleep(cons.persistTimeout)
 		}
@@ -441,11 +757,11 @@ func (cons *Kafka) startConsumerForPartition(partitionID int32) kafka.PartitionC
 }
 
 // Main fetch loop for kafka events
-func (cons *Kafka) readFromPartition(partitionID int32) {
+func (cons *Kafka) readFromPartition(topic *kafkaTopic, partitionID int32) {
 	cons.AddWorker()
 	defer cons.WorkerDone()
 
-	partCons := cons.startConsumerForPartition(partitionID)
+	partCons := cons.startConsumerForPartition(topic, partitionID)
 	spin := tsync.NewSpinner(tsync.SpinPriorityLow)
 
 	for !cons.client.Closed() {
@@ -455,16 +771,17 @@ func (cons *Kafka) readFromPartition(partitionID int32) {
 			//Added some verbose information so that we can investigate reasons of
 			//exception. Probably it might happen when sarama close the channel
 			//so we will get nil message from the channel.
-			if event == nil || cons.offsets == nil || cons.offsets[partitionID] == nil {
+			if event == nil || topic.offsets == nil || topic.offsets[partitionID] == nil {
 				cons.Logger.Errorf("Kafka consumer failed to store offset. Trace : event : %+v, cons.partCons: %+v, partitionID: %d\n",
-					event, cons.offsets, partitionID)
+					event, topic.offsets, partitionID)
 
 				partCons.Close()
-				partCons = cons.startConsumerForPartition(partitionID)
+				partCons = cons.startConsumerForPartition(topic, partitionID)
 				continue
 			}
 
-			atomic.StoreInt64(cons.offsets[partitionID], event.Offset)
+			atomic.StoreInt64(topic.offsets[partitionID], event.Offset)
+			cons.updateLag(topic, partitionID, event.Offset)
 			cons.enqueueEvent(event)
 
 		case err := <-partCons.Errors():
@@ -472,7 +789,7 @@ func (cons *Kafka) readFromPartition(partitionID int32) {
 			if !cons.client.Closed() {
 				partCons.Close()
 			}
-			partCons = cons.startConsumerForPartition(partitionID)
+			partCons = cons.startConsumerForPartition(topic, partitionID)
 
 		default:
 			spin.Yield()
@@ -480,7 +797,7 @@ func (cons *Kafka) readFromPartition(partitionID int32) {
 	}
 }
 
-func (cons *Kafka) readPartitions(partitions []int32) {
+func (cons *Kafka) readPartitions(topic *kafkaTopic, partitions []int32) {
 	cons.AddWorker()
 	defer cons.WorkerDone()
 
@@ -488,7 +805,7 @@ func (cons *Kafka) readPartitions(partitions []int32) {
 
 	consumers := []kafka.PartitionConsumer{}
 	for _, partitionID := range partitions {
-		consumer := cons.startConsumerForPartition(partitionID)
+		consumer := cons.startConsumerForPartition(topic, partitionID)
 		consumers = append(consumers, consumer)
 	}
 
@@ -502,7 +819,8 @@ func (cons *Kafka) readPartitions(partitions []int32) {
 
 			select {
 			case event := <-consumer.Messages():
-				atomic.StoreInt64(cons.offsets[partition], event.Offset)
+				atomic.StoreInt64(topic.offsets[partition], event.Offset)
+				cons.updateLag(topic, partition, event.Offset)
 				cons.enqueueEvent(event)
 
 			case err := <-consumer.Errors():
@@ -511,7 +829,7 @@ func (cons *Kafka) readPartitions(partitions []int32) {
 					consumer.Close()
 				}
 
-				consumer = cons.startConsumerForPartition(partition)
+				consumer = cons.startConsumerForPartition(topic, partition)
 				consumers[idx] = consumer
 
 			default:
@@ -523,48 +841,204 @@ func (cons *Kafka) readPartitions(partitions []int32) {
 
 func (cons *Kafka) enqueueEvent(event *kafka.ConsumerMessage) {
 	if cons.hasToSetMetadata {
-		metaData := core.NewMetadata()
+		cons.EnqueueWithMetadata(event.Value, cons.getEventMetadata(event))
+	} else {
+		cons.SimpleConsumer.Enqueue(event.Value)
+	}
+}
+
+func (cons *Kafka) getEventMetadata(event *kafka.ConsumerMessage) tcontainer.MarshalMap {
+	metaData := core.NewMetadata()
+
+	metaData.Set("topic", event.Topic)
+	metaData.Set("key", event.Key)
+
+	// Header names are stored as-is, so path characters must not be resolved
+	for _, header := range event.Headers {
+		if header == nil {
+			continue
+		}
+		value := make([]byte, len(header.Value))
+		copy(value, header.Value)
+		metaData["header."+string(header.Key)] = value
+	}
 
-		metaData.Set("topic", event.Topic)
-		metaData.Set("key", event.Key)
+	return metaData
+}
+
+func (cons *Kafka) registerPartitionLag(topic *kafkaTopic, partitionID int32) {
+	lag := &kafkaPartitionLag{
+		highWaterMark: -1,
+		metricsLag:    metrics.NewGauge(),
+	}
+	topic.partitionLags[partitionID] = lag
+	cons.metricsRegistry.Register(fmt.Sprintf("%s.%d.lag", topic.name, partitionID), lag.metricsLag)
+}
 
-		cons.EnqueueWithMetadata(event.Value, metaData)
+// Update the lag metric after the message at the given offset has been read
+func (cons *Kafka) updateLag(topic *kafkaTopic, partitionID int32, offset int64) {
+	lag, registered := topic.partitionLags[partitionID]
+	if !registered {
+		return // ### return, unknown partition ###
+	}
+
+	highWaterMark := atomic.LoadInt64(&lag.highWaterMark)
+	if highWaterMark < 0 || offset < 0 {
+		return // ### return, lag unknown ###
+	}
+
+	// The high-water mark is the offset of the next message to be written
+	if behind := highWaterMark - offset - 1; behind > 0 {
+		lag.metricsLag.Update(behind)
 	} else {
-		cons.SimpleConsumer.Enqueue(event.Value)
+		lag.metricsLag.Update(0)
+	}
+}
+
+// Query the high-water mark of all partitions and update the lag metrics
+func (cons *Kafka) updateHighWaterMarks() {
+	if cons.client == nil {
+		return // ### return, using consumer groups ###
+	}
+
+	for _, topic := range cons.getStartedTopics() {
+		for partitionID, lag := range topic.partitionLags {
+			highWaterMark, err := cons.client.GetOffset(topic.name, partitionID, kafka.OffsetNewest)
+			if err != nil {
+				cons.Logger.WithError(err).Warningf("Failed to get high-water mark of partition %s:%d", topic.name, partitionID)
+				continue // ### continue, try again next time ###
+			}
+
+			atomic.StoreInt64(&lag.highWaterMark, highWaterMark)
+			cons.updateLag(topic, partitionID, atomic.LoadInt64(topic.offsets[partitionID]))
+		}
 	}
 }
 
-func (cons *Kafka) startReadTopic(topic string) {
-	partitions, err := cons.client.Partitions(topic)
+func (cons *Kafka) startReadTopic(name string) {
+	partitions, err := cons.client.Partitions(name)
 	if err != nil {
 		cons.Logger.Error(err)
-		time.AfterFunc(cons.persistTimeout, func() { cons.startReadTopic(topic) })
+		time.AfterFunc(cons.persistTimeout, func() { cons.startReadTopic(name) })
 		return
 	}
 
+	cons.topicsGuard.Lock()
+	topic := cons.getTopic(name)
+	if topic.started {
+		cons.topicsGuard.Unlock()
+		return // ### return, already reading ###
+	}
+
 	for _, partitionID := range partitions {
-		if _, mapped := cons.offsets[partitionID]; !mapped {
+		if _, mapped := topic.offsets[partitionID]; !mapped {
 			startOffset := cons.defaultOffset
-			cons.offsets[partitionID] = &startOffset
+			topic.offsets[partitionID] = &startOffset
+		}
+		if _, registered := topic.partitionLags[partitionID]; !registered {
+			cons.registerPartitionLag(topic, partitionID)
 		}
 		if partitionID > cons.MaxPartitionID {
 			cons.MaxPartitionID = partitionID
 		}
 	}
+	topic.started = true
+	cons.topicsGuard.Unlock()
 
-	if cons.orderedRead {
-		go cons.readPartitions(partitions)
-	} else {
-		for _, partitionID := range partitions {
-			go cons.readFromPartition(partitionID)
+	for _, group := range cons.getPartitionGroups(partitions) {
+		if len(group) == 1 && !cons.orderedRead {
+			go cons.readFromPartition(topic, group[0])
+		} else {
+			go cons.readPartitions(topic, group)
+		}
+	}
+}
+
+// getNewTopics returns all topics matching TopicPattern that are not read yet
+func (cons *Kafka) getNewTopics() ([]string, error) {
+	topics, err := cons.client.Topics()
+	if err != nil {
+		return nil, err
+	}
+
+	cons.topicsGuard.Lock()
+	defer cons.topicsGuard.Unlock()
+
+	newTopics := []string{}
+	for _, name := range topics {
+		if !cons.topicPattern.MatchString(name) {
+			continue
+		}
+		if topic, known := cons.topics[name]; !known || !topic.started {
+			newTopics = append(newTopics, name)
+		}
+	}
+	return newTopics, nil
+}
+
+// readTopicPattern starts reading all topics matching TopicPattern. New
+// topics are looked up every MetadataRefreshMs until the client is closed.
+func (cons *Kafka) readTopicPattern() {
+	for !cons.client.Closed() {
+		topics, err := cons.getNewTopics()
+		if err != nil {
+			cons.Logger.WithError(err).Error("Failed to get topics matching TopicPattern")
+		}
+
+		for _, name := range topics {
+			cons.Logger.Infof("Reading topic %s matching TopicPattern", name)
+			cons.startReadTopic(name)
 		}
+
+		if cons.config.Metadata.RefreshFrequency <= 0 {
+			return // ### return, metadata is never refreshed ###
+		}
+		time.Sleep(cons.config.Metadata.RefreshFrequency)
 	}
 }
 
+// getPartitionGroups assigns the given partitions round robin to the number
+// of workers defined by Ordered and MaxWorkers. Each group is read by one
+// go routine.
+func (cons *Kafka) getPartitionGroups(partitions []int32) [][]int32 {
+	numWorkers := len(partitions)
+	switch {
+	case cons.orderedRead:
+		numWorkers = 1
+	case cons.maxWorkers > 0 && cons.maxWorkers < numWorkers:
+		numWorkers = cons.maxWorkers
+	}
+
+	if numWorkers == 0 {
+		return [][]int32{}
+	}
+
+	groups := make([][]int32, numWorkers)
+	for idx, partitionID := range partitions {
+		groups[idx%numWorkers] = append(groups[idx%numWorkers], partitionID)
+	}
+	return groups
+}
+
 // Start one consumer per partition as a go routine
 func (cons *Kafka) startAllConsumers() error {
 	var err error
 
+	if cons.group != "" && cons.useSaramaGroup {
+		cons.client, err = kafka.NewClient(cons.servers, &cons.groupConfig.Config)
+		if err != nil {
+			return err
+		}
+
+		cons.saramaGroup, err = kafka.NewConsumerGroupFromClient(cons.group, cons.client)
+		if err != nil {
+			return err
+		}
+
+		go cons.readFromSaramaGroup()
+		return nil // ### return, group processing ###
+	}
+
 	if cons.group != "" {
 		cons.groupClient, err = cluster.NewClient(cons.servers, cons.groupConfig)
 		if err != nil {
@@ -585,18 +1059,43 @@ func (cons *Kafka) startAllConsumers() error {
 		return err
 	}
 
-	cons.startReadTopic(cons.topic)
+	if cons.commitToKafka {
+		cons.offsetManager, err = kafka.NewOffsetManagerFromClient(cons.commitGroup, cons.client)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, topic := range cons.topicList {
+		cons.startReadTopic(topic)
+	}
+	if cons.topicPattern != nil {
+		go cons.readTopicPattern()
+	}
 
 	return nil
 }
 
+// getOffsetKey returns the key used to store the offset of the given
+// partition in the offset file
+func (cons *Kafka) getOffsetKey(topic *kafkaTopic, partitionID int32) string {
+	if topic.name == cons.topic {
+		return strconv.Itoa(int(partitionID))
+	}
+	return fmt.Sprintf("%s:%d", topic.name, partitionID)
+}
+
 // Write index file to disc
 func (cons *Kafka) dumpIndex() {
 	if cons.offsetFile != "" {
 		encodedOffsets := make(map[string]int64)
-		for k := range cons.offsets {
-			encodedOffsets[strconv.Itoa(int(k))] = atomic.LoadInt64(cons.offsets[k])
+		cons.topicsGuard.Lock()
+		for _, topic := range cons.topics {
+			for k := range topic.offsets {
+				encodedOffsets[cons.getOffsetKey(topic, k)] = atomic.LoadInt64(topic.offsets[k])
+			}
 		}
+		cons.topicsGuard.Unlock()
 
 		data, err := json.Marshal(encodedOffsets)
 		if err != nil {
@@ -616,7 +1115,59 @@ func (cons *Kafka) dumpIndex() {
 	}
 }
 
-// Consume starts a kafka consumer per partition for this topic
+// Commit the current offsets to kafka
+func (cons *Kafka) commitOffsets() {
+	if cons.offsetManager == nil {
+		return // ### return, not committing ###
+	}
+
+	for _, topic := range cons.getStartedTopics() {
+		for partitionID, offset := range topic.offsets {
+			lastOffset := atomic.LoadInt64(offset)
+			if lastOffset < 0 {
+				continue // ### continue, nothing read yet ###
+			}
+
+			partitionOffset, isManaged := topic.partitionOffsets[partitionID]
+			if !isManaged {
+				var err error
+				if partitionOffset, err = cons.offsetManager.ManagePartition(topic.name, partitionID); err != nil {
+					cons.Logger.WithError(err).Errorf("Failed to manage offsets of partition %s:%d", topic.name, partitionID)
+					continue // ### continue, try again next time ###
+				}
+				topic.partitionOffsets[partitionID] = partitionOffset
+			}
+
+			// Kafka expects the offset of the next message to read
+			partitionOffset.MarkOffset(lastOffset+1, "")
+		}
+	}
+
+	cons.offsetManager.Commit()
+}
+
+func (cons *Kafka) closeOffsetManager() {
+	if cons.offsetManager == nil {
+		return // ### return, not committing ###
+	}
+
+	cons.commitOffsets()
+	for _, topic := range cons.getStartedTopics() {
+		for _, partitionOffset := range topic.partitionOffsets {
+			partitionOffset.AsyncClose()
+		}
+	}
+	cons.offsetManager.Close()
+}
+
+// Write the current offsets to all configured targets and update the lag
+func (cons *Kafka) persistOffsets() {
+	cons.dumpIndex()
+	cons.commitOffsets()
+	cons.updateHighWaterMarks()
+}
+
+// Consume starts a kafka consumer per partition for all topics
 func (cons *Kafka) Consume(workers *sync.WaitGroup) {
 	cons.SetWorkerWaitGroup(workers)
 
@@ -627,9 +1178,13 @@ func (cons *Kafka) Consume(workers *sync.WaitGroup) {
 	}
 
 	defer func() {
+		cons.closeOffsetManager()
+		if cons.saramaGroup != nil {
+			cons.saramaGroup.Close()
+		}
 		cons.client.Close()
 		cons.dumpIndex()
 	}()
 
-	cons.TickerControlLoop(cons.persistTimeout, cons.dumpIndex)
+	cons.TickerControlLoop(cons.persistTimeout, cons.persistOffsets)
 }
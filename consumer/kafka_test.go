@@ -0,0 +1,542 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gollum/core"
+
+	kafka "github.com/Shopify/sarama"
+	cluster "github.com/bsm/sarama-cluster"
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestKafkaEventMetadataHeaders(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.Kafka")
+	config.Override("SetMetadata", true)
+	config.Override("Version", "0.11")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*Kafka)
+	expect.True(casted)
+
+	binaryValue := []byte{0, 0xff, '\n', 1}
+	event := &kafka.ConsumerMessage{
+		Topic: "test",
+		Key:   []byte("key"),
+		Value: []byte("payload"),
+		Headers: []*kafka.RecordHeader{
+			{Key: []byte("traceparent"), Value: []byte("00-abc-def-01")},
+			{Key: []byte("binary"), Value: binaryValue},
+			{Key: []byte("a/b"), Value: []byte("path")},
+			nil,
+		},
+	}
+
+	metadata := cons.getEventMetadata(event)
+	binaryValue[0] = 42 // must not modify the metadata
+
+	topic, err := metadata.String("topic")
+	expect.NoError(err)
+	expect.Equal("test", topic)
+
+	traceparent, err := metadata.Bytes("header.traceparent")
+	expect.NoError(err)
+	expect.Equal("00-abc-def-01", string(traceparent))
+
+	binary, err := metadata.Bytes("header.binary")
+	expect.NoError(err)
+	expect.Equal([]byte{0, 0xff, '\n', 1}, binary)
+
+	expect.Equal([]byte("path"), metadata["header.a/b"])
+}
+
+type mockOffsetManager struct {
+	partitions map[int32]*mockPartitionOffsetManager
+	commits    int
+	closed     bool
+}
+
+func (om *mockOffsetManager) ManagePartition(topic string, partition int32) (kafka.PartitionOffsetManager, error) {
+	if partition == 2 {
+		return nil, fmt.Errorf("coordinator not available")
+	}
+	pom := &mockPartitionOffsetManager{offset: -1}
+	om.partitions[partition] = pom
+	return pom, nil
+}
+
+func (om *mockOffsetManager) Commit() {
+	om.commits++
+}
+
+func (om *mockOffsetManager) Close() error {
+	om.closed = true
+	return nil
+}
+
+type mockPartitionOffsetManager struct {
+	offset int64
+	closed bool
+}
+
+func (pom *mockPartitionOffsetManager) NextOffset() (int64, string) {
+	return pom.offset, ""
+}
+
+func (pom *mockPartitionOffsetManager) MarkOffset(offset int64, metadata string) {
+	pom.offset = offset
+}
+
+func (pom *mockPartitionOffsetManager) ResetOffset(offset int64, metadata string) {
+	pom.offset = offset
+}
+
+func (pom *mockPartitionOffsetManager) Errors() <-chan *kafka.ConsumerError {
+	return nil
+}
+
+func (pom *mockPartitionOffsetManager) AsyncClose() {
+	pom.closed = true
+}
+
+func (pom *mockPartitionOffsetManager) Close() error {
+	pom.closed = true
+	return nil
+}
+
+func TestKafkaCommitToKafka(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.Kafka")
+	config.Override("Topic", "logs")
+	config.Override("CommitToKafka", true)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*Kafka)
+	expect.True(casted)
+	expect.Equal("gollum-logs", cons.commitGroup)
+	expect.False(cons.config.Consumer.Offsets.AutoCommit.Enable)
+
+	offsetManager := &mockOffsetManager{partitions: map[int32]*mockPartitionOffsetManager{}}
+	cons.offsetManager = offsetManager
+
+	topic := cons.getTopic("logs")
+	topic.started = true
+	offsets := []int64{41, kafka.OffsetNewest, 7}
+	for partitionID := range offsets {
+		topic.offsets[int32(partitionID)] = &offsets[partitionID]
+	}
+
+	// Partitions without a consumed message or a coordinator are skipped
+	cons.commitOffsets()
+	expect.Equal(1, offsetManager.commits)
+	expect.Equal(1, len(offsetManager.partitions))
+	expect.Equal(int64(42), offsetManager.partitions[0].offset)
+
+	offsets[0] = 50
+	offsets[1] = 3
+	cons.closeOffsetManager()
+	expect.Equal(2, offsetManager.commits)
+	expect.Equal(int64(51), offsetManager.partitions[0].offset)
+	expect.Equal(int64(4), offsetManager.partitions[1].offset)
+	expect.True(offsetManager.partitions[0].closed)
+	expect.True(offsetManager.partitions[1].closed)
+	expect.True(offsetManager.closed)
+}
+
+func TestKafkaCommitToKafkaWithGroup(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.Kafka")
+	config.Override("GroupId", "logreader")
+	config.Override("CommitToKafka", true)
+	config.Override("CommitGroupId", "observer")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*Kafka)
+	expect.True(casted)
+	expect.False(cons.commitToKafka)
+
+	// Nothing is committed without an offset manager
+	cons.commitOffsets()
+	cons.closeOffsetManager()
+}
+
+func TestKafkaRebalanceStrategy(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	strategies := map[string]cluster.Strategy{
+		"range":      cluster.StrategyRange,
+		"roundrobin": cluster.StrategyRoundRobin,
+		"RoundRobin": cluster.StrategyRoundRobin,
+	}
+
+	for name, strategy := range strategies {
+		config := core.NewPluginConfig("", "consumer.Kafka")
+		config.Override("GroupId", "logreader")
+		config.Override("Version", "0.10.2")
+		config.Override("RebalanceStrategy", name)
+		config.Override("SessionTimeoutMs", 10000)
+		config.Override("HeartbeatIntervalMs", 1000)
+
+		plugin, err := core.NewPluginWithConfig(config)
+		expect.NoError(err)
+
+		cons, casted := plugin.(*Kafka)
+		expect.True(casted)
+		expect.Equal(strategy, cons.groupConfig.Group.PartitionStrategy)
+		expect.Equal(10*time.Second, cons.groupConfig.Group.Session.Timeout)
+		expect.Equal(time.Second, cons.groupConfig.Group.Heartbeat.Interval)
+	}
+}
+
+func TestKafkaRebalanceStrategySticky(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "consumer.Kafka")
+	config.Override("GroupId", "logreader")
+	config.Override("Version", "0.10.2")
+	config.Override("RebalanceStrategy", "sticky")
+	config.Override("SessionTimeoutMs", 10000)
+	config.Override("HeartbeatIntervalMs", 1000)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*Kafka)
+	expect.True(casted)
+	expect.True(cons.useSaramaGroup)
+	expect.Equal(kafka.BalanceStrategySticky, cons.groupConfig.Consumer.Group.Rebalance.Strategy)
+	expect.Equal(10*time.Second, cons.groupConfig.Consumer.Group.Session.Timeout)
+	expect.Equal(time.Second, cons.groupConfig.Consumer.Group.Heartbeat.Interval)
+
+	// The sarama consumer group requires at least 0.10.2
+	config.Override("Version", "0.10.1")
+	_, err = core.NewPluginWithConfig(config)
+	expect.NotNil(err)
+}
+
+func TestKafkaRebalanceStrategyErrors(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	invalid := []map[string]interface{}{
+		{"RebalanceStrategy": "foo"},
+		{"SessionTimeoutMs": 3000, "HeartbeatIntervalMs": 3000},
+		{"HeartbeatIntervalMs": 0},
+	}
+
+	for _, settings := range invalid {
+		config := core.NewPluginConfig("", "consumer.Kafka")
+		config.Override("GroupId", "logreader")
+		config.Override("Version", "0.10.2")
+		for key, value := range settings {
+			config.Override(key, value)
+		}
+
+		_, err := core.NewPluginWithConfig(config)
+		expect.NotNil(err)
+	}
+}
+
+type mockKafkaClient struct {
+	kafka.Client
+	highWaterMarks map[int32]int64
+	topics         []string
+}
+
+func (client *mockKafkaClient) Topics() ([]string, error) {
+	if client.topics == nil {
+		return nil, kafka.ErrOutOfBrokers
+	}
+	return client.topics, nil
+}
+
+func (client *mockKafkaClient) GetOffset(topic string, partitionID int32, time int64) (int64, error) {
+	if offset, exists := client.highWaterMarks[partitionID]; exists && time == kafka.OffsetNewest {
+		return offset, nil
+	}
+	return 0, kafka.ErrUnknownTopicOrPartition
+}
+
+func TestKafkaPartitionLag(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.Kafka")
+	config.Override("Topic", "logs")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*Kafka)
+	expect.True(casted)
+
+	cons.client = &mockKafkaClient{
+		highWaterMarks: map[int32]int64{0: 100, 1: 10},
+	}
+
+	topic := cons.getTopic("logs")
+	topic.started = true
+	offsets := []int64{89, kafka.OffsetNewest, 5}
+	for partitionID := range offsets {
+		topic.offsets[int32(partitionID)] = &offsets[partitionID]
+		cons.registerPartitionLag(topic, int32(partitionID))
+	}
+
+	getLag := func(partitionID int) int64 {
+		metric := cons.metricsRegistry.Get(fmt.Sprintf("logs.%d.lag", partitionID))
+		expect.NotNil(metric)
+		gauge, isGauge := metric.(metrics.Gauge)
+		expect.True(isGauge)
+		return gauge.Value()
+	}
+
+	// The lag is unknown until the high-water mark has been queried
+	cons.updateLag(topic, 0, 95)
+	expect.Equal(int64(0), getLag(0))
+
+	cons.updateHighWaterMarks()
+	expect.Equal(int64(10), getLag(0))
+	expect.Equal(int64(0), getLag(1))
+	expect.Equal(int64(0), getLag(2))
+
+	// Reading messages reduces the lag
+	cons.updateLag(topic, 0, 95)
+	expect.Equal(int64(4), getLag(0))
+	cons.updateLag(topic, 1, 9)
+	expect.Equal(int64(0), getLag(1))
+	cons.updateLag(topic, 1, 4)
+	expect.Equal(int64(5), getLag(1))
+}
+
+func TestKafkaMaxWorkers(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	partitions := []int32{0, 1, 2, 3, 4, 5, 6}
+
+	for _, testCase := range []struct {
+		maxWorkers int
+		ordered    bool
+		expected   [][]int32
+	}{
+		{0, false, [][]int32{{0}, {1}, {2}, {3}, {4}, {5}, {6}}},
+		{3, false, [][]int32{{0, 3, 6}, {1, 4}, {2, 5}}},
+		{10, false, [][]int32{{0}, {1}, {2}, {3}, {4}, {5}, {6}}},
+		{3, true, [][]int32{{0, 1, 2, 3, 4, 5, 6}}},
+	} {
+		config := core.NewPluginConfig("", "consumer.Kafka")
+		config.Override("MaxWorkers", testCase.maxWorkers)
+		config.Override("Ordered", testCase.ordered)
+
+		plugin, err := core.NewPluginWithConfig(config)
+		expect.NoError(err)
+		cons := plugin.(*Kafka)
+
+		groups := cons.getPartitionGroups(partitions)
+		expect.Equal(testCase.expected, groups)
+
+		// No more than MaxWorkers readers are started and every partition is
+		// read by exactly one of them.
+		if testCase.maxWorkers > 0 {
+			expect.Leq(len(groups), testCase.maxWorkers)
+		}
+		assigned := map[int32]int{}
+		for _, group := range groups {
+			for _, partitionID := range group {
+				assigned[partitionID]++
+			}
+		}
+		for _, partitionID := range partitions {
+			expect.Equal(1, assigned[partitionID])
+		}
+	}
+
+	cons := &Kafka{maxWorkers: 3}
+	expect.Equal(0, len(cons.getPartitionGroups([]int32{})))
+}
+
+func TestKafkaTopics(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	for idx, testCase := range []struct {
+		settings    map[string]interface{}
+		topics      []string
+		commitGroup string
+	}{
+		{map[string]interface{}{}, []string{"default"}, "gollum-default"},
+		{map[string]interface{}{"Topic": "logs"}, []string{"logs"}, "gollum-logs"},
+		{map[string]interface{}{"Topics": []string{"a", "b"}}, []string{"a", "b"}, "gollum-" + t.Name() + "2"},
+		{map[string]interface{}{"Topic": "logs", "Topics": []string{"a"}}, []string{"logs", "a"}, "gollum-" + t.Name() + "3"},
+		{map[string]interface{}{"TopicPattern": "^logs-"}, []string{}, "gollum-" + t.Name() + "4"},
+	} {
+		config := core.NewPluginConfig(fmt.Sprintf("%s%d", t.Name(), idx), "consumer.Kafka")
+		config.Override("CommitToKafka", true)
+		for key, value := range testCase.settings {
+			config.Override(key, value)
+		}
+
+		plugin, err := core.NewPluginWithConfig(config)
+		expect.NoError(err)
+
+		cons, casted := plugin.(*Kafka)
+		expect.True(casted)
+		expect.Equal(testCase.topics, append([]string{}, cons.topicList...))
+		expect.Equal(testCase.commitGroup, cons.commitGroup)
+	}
+
+	config := core.NewPluginConfig("", "consumer.Kafka")
+	config.Override("GroupId", "logreader")
+	config.Override("TopicPattern", "^logs-")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons := plugin.(*Kafka)
+	expect.NotNil(cons.groupConfig.Group.Topics.Whitelist)
+	expect.True(cons.groupConfig.Group.Topics.Whitelist.MatchString("logs-app"))
+
+	config = core.NewPluginConfig("", "consumer.Kafka")
+	config.Override("TopicPattern", "(")
+	_, err = core.NewPluginWithConfig(config)
+	expect.NotNil(err)
+}
+
+func TestKafkaTopicPattern(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.Kafka")
+	config.Override("Topics", []string{"logs-web"})
+	config.Override("TopicPattern", "^logs-")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*Kafka)
+	expect.True(casted)
+
+	client := &mockKafkaClient{}
+	cons.client = client
+
+	_, err = cons.getNewTopics()
+	expect.NotNil(err)
+
+	client.topics = []string{"logs-web", "logs-app", "metrics", "__consumer_offsets", "app-logs-old"}
+	cons.getTopic("logs-web").started = true
+
+	topics, err := cons.getNewTopics()
+	expect.NoError(err)
+	expect.Equal([]string{"logs-app"}, topics)
+
+	// Topics created later on are discovered with the next metadata response
+	cons.getTopic("logs-app").started = true
+	client.topics = append(client.topics, "logs-db")
+
+	topics, err = cons.getNewTopics()
+	expect.NoError(err)
+	expect.Equal([]string{"logs-db"}, topics)
+}
+
+func TestKafkaGroupTopics(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.Kafka")
+	config.Override("GroupId", "logreader")
+	config.Override("Version", "0.10.2")
+	config.Override("RebalanceStrategy", "sticky")
+	config.Override("Topics", []string{"logs-web", "metrics"})
+	config.Override("TopicPattern", "^logs-")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*Kafka)
+	expect.True(casted)
+
+	client := &mockKafkaClient{}
+	cons.client = client
+
+	_, err = cons.getGroupTopics()
+	expect.NotNil(err)
+
+	client.topics = []string{"logs-web", "logs-app", "__consumer_offsets", "app-logs-old"}
+
+	topics, err := cons.getGroupTopics()
+	expect.NoError(err)
+	expect.Equal([]string{"logs-app", "logs-web", "metrics"}, topics)
+
+	// Without TopicPattern the topic list is used as is
+	cons.topicPattern = nil
+	topics, err = cons.getGroupTopics()
+	expect.NoError(err)
+	expect.Equal([]string{"logs-web", "metrics"}, topics)
+}
+
+func TestKafkaOffsetFileTopics(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-kafka")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	offsetFile := filepath.Join(dir, "offsets.json")
+	expect.NoError(ioutil.WriteFile(offsetFile, []byte(`{"0":10,"1":11,"logs-app:0":20}`), 0644))
+
+	config := core.NewPluginConfig(t.Name(), "consumer.Kafka")
+	config.Override("Topic", "logs")
+	config.Override("TopicPattern", "^logs-")
+	config.Override("OffsetFile", offsetFile)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*Kafka)
+	expect.True(casted)
+
+	expect.Equal(int64(10), *cons.getTopic("logs").offsets[0])
+	expect.Equal(int64(11), *cons.getTopic("logs").offsets[1])
+	expect.Equal(int64(20), *cons.getTopic("logs-app").offsets[0])
+
+	offset := int64(30)
+	cons.getTopic("logs-db").offsets[2] = &offset
+	cons.dumpIndex()
+
+	data, err := ioutil.ReadFile(offsetFile)
+	expect.NoError(err)
+
+	encodedOffsets := map[string]int64{}
+	expect.NoError(json.Unmarshal(data, &encodedOffsets))
+	expect.Equal(map[string]int64{"0": 10, "1": 11, "logs-app:0": 20, "logs-db:2": 30}, encodedOffsets)
+
+	expect.NoError(ioutil.WriteFile(offsetFile, []byte(`{"logs-app:x":20}`), 0644))
+	config = core.NewPluginConfig("", "consumer.Kafka")
+	config.Override("OffsetFile", offsetFile)
+	_, err = core.NewPluginWithConfig(config)
+	expect.NotNil(err)
+}
@@ -0,0 +1,165 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"encoding/json"
+	"regexp"
+	"sync"
+	"time"
+
+	"gollum/core"
+
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+var metricsPercentiles = []float64{0.5, 0.95, 0.99}
+
+// Metrics consumer plugin
+//
+// This consumer periodically takes a snapshot of gollum's internal metrics
+// and enqueues it as a JSON message. This allows shipping metrics to the same
+// backends as other messages without a separate scraper.
+//
+// Each message contains the time of the snapshot as RFC3339 string and an
+// object holding all metrics by name, e.g.
+// {"time":"2018-03-05T12:00:00Z","metrics":{"routed":42,"workers":8}}.
+// Counters and gauges are written as numbers. Meters are written as object
+// with the fields "count" and "rate1". Histograms and timers are written as
+// object with the fields "count", "min", "max", "mean", "p50", "p95" and
+// "p99". Timer values are given in milliseconds.
+//
+// Parameters
+//
+// - IntervalMs: Defines the time in milliseconds between two snapshots.
+// By default this parameter is set to "10000".
+//
+// - Filter: Defines a regular expression matched against metric names. Only
+// matching metrics are part of the snapshot. When left empty, all metrics
+// are part of the snapshot.
+// By default this parameter is set to "".
+//
+// Examples
+//
+// This example sends the message counters of gollum every minute to the
+// "metrics" stream.
+//
+//  MetricsIn:
+//    Type: consumer.Metrics
+//    Streams: metrics
+//    IntervalMs: 60000
+//    Filter: "^(routed|enqueued|discarded)$"
+type Metrics struct {
+	core.SimpleConsumer `gollumdoc:"embed_type"`
+	interval            time.Duration `config:"IntervalMs" default:"10000" metric:"ms"`
+	filter              *regexp.Regexp
+	registry            metrics.Registry
+}
+
+type metricsSnapshot struct {
+	Time    string                 `json:"time"`
+	Metrics map[string]interface{} `json:"metrics"`
+}
+
+func init() {
+	core.TypeRegistry.Register(Metrics{})
+}
+
+// Configure initializes this consumer with values from a plugin config.
+func (cons *Metrics) Configure(conf core.PluginConfigReader) {
+	cons.registry = core.MetricsRegistry
+
+	if filter := conf.GetString("Filter", ""); filter != "" {
+		var err error
+		cons.filter, err = regexp.Compile(filter)
+		conf.Errors.Push(err)
+	}
+}
+
+// getSnapshot returns the current values of all metrics matching Filter
+func (cons *Metrics) getSnapshot(now time.Time) metricsSnapshot {
+	snapshot := metricsSnapshot{
+		Time:    now.UTC().Format(time.RFC3339),
+		Metrics: make(map[string]interface{}),
+	}
+
+	cons.registry.Each(func(name string, value interface{}) {
+		if cons.filter != nil && !cons.filter.MatchString(name) {
+			return // ### return, filtered ###
+		}
+
+		switch metric := value.(type) {
+		case metrics.Counter:
+			snapshot.Metrics[name] = metric.Count()
+
+		case metrics.Gauge:
+			snapshot.Metrics[name] = metric.Value()
+
+		case metrics.GaugeFloat64:
+			snapshot.Metrics[name] = metric.Value()
+
+		case metrics.Meter:
+			snap := metric.Snapshot()
+			snapshot.Metrics[name] = map[string]interface{}{
+				"count": snap.Count(),
+				"rate1": snap.Rate1(),
+			}
+
+		case metrics.Histogram:
+			snap := metric.Snapshot()
+			snapshot.Metrics[name] = getMetricsDistribution(snap.Count(), snap.Min(), snap.Max(),
+				snap.Mean(), snap.Percentiles(metricsPercentiles), 1)
+
+		case metrics.Timer:
+			snap := metric.Snapshot()
+			snapshot.Metrics[name] = getMetricsDistribution(snap.Count(), snap.Min(), snap.Max(),
+				snap.Mean(), snap.Percentiles(metricsPercentiles), float64(time.Millisecond))
+		}
+	})
+
+	return snapshot
+}
+
+// getMetricsDistribution returns the values of a histogram or timer with all
+// values except count divided by scale
+func getMetricsDistribution(count, min, max int64, mean float64, percentiles []float64, scale float64) map[string]interface{} {
+	return map[string]interface{}{
+		"count": count,
+		"min":   float64(min) / scale,
+		"max":   float64(max) / scale,
+		"mean":  mean / scale,
+		"p50":   percentiles[0] / scale,
+		"p95":   percentiles[1] / scale,
+		"p99":   percentiles[2] / scale,
+	}
+}
+
+// sendSnapshot enqueues the current snapshot as JSON message
+func (cons *Metrics) sendSnapshot() {
+	data, err := json.Marshal(cons.getSnapshot(time.Now()))
+	if err != nil {
+		cons.Logger.WithError(err).Error("Failed to encode metrics")
+		return // ### return, invalid snapshot ###
+	}
+	cons.Enqueue(data)
+}
+
+// Consume starts sending metric snapshots.
+func (cons *Metrics) Consume(workers *sync.WaitGroup) {
+	cons.AddMainWorker(workers)
+	defer cons.WorkerDone()
+
+	cons.TickerControlLoop(cons.interval, cons.sendSnapshot)
+}
@@ -0,0 +1,148 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"gollum/core"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func newMetricsTestRegistry() metrics.Registry {
+	registry := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("routed", registry).Inc(42)
+	metrics.NewRegisteredGauge("workers", registry).Update(8)
+	metrics.NewRegisteredGaugeFloat64("load", registry).Update(0.5)
+
+	histogram := metrics.NewRegisteredHistogram("size", registry, metrics.NewUniformSample(10))
+	for _, value := range []int64{10, 20, 30} {
+		histogram.Update(value)
+	}
+
+	timer := metrics.NewRegisteredTimer("latency", registry)
+	timer.Update(2 * time.Millisecond)
+	timer.Update(4 * time.Millisecond)
+
+	child := metrics.NewPrefixedChildRegistry(registry, "kafka.")
+	metrics.NewRegisteredCounter("sent", child).Inc(3)
+	return registry
+}
+
+func TestMetricsSnapshot(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.Metrics")
+	config.Override("Streams", t.Name())
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*Metrics)
+	expect.True(casted)
+
+	cons.registry = newMetricsTestRegistry()
+
+	now := time.Date(2018, 3, 5, 12, 0, 0, 0, time.UTC)
+	snapshot := cons.getSnapshot(now)
+	expect.Equal("2018-03-05T12:00:00Z", snapshot.Time)
+	expect.Equal(6, len(snapshot.Metrics))
+	expect.Equal(int64(42), snapshot.Metrics["routed"])
+	expect.Equal(int64(8), snapshot.Metrics["workers"])
+	expect.Equal(0.5, snapshot.Metrics["load"])
+	expect.Equal(int64(3), snapshot.Metrics["kafka.sent"])
+
+	size, isMap := snapshot.Metrics["size"].(map[string]interface{})
+	expect.True(isMap)
+	expect.Equal(int64(3), size["count"])
+	expect.Equal(10.0, size["min"])
+	expect.Equal(30.0, size["max"])
+	expect.Equal(20.0, size["mean"])
+	expect.Equal(20.0, size["p50"])
+
+	latency, isMap := snapshot.Metrics["latency"].(map[string]interface{})
+	expect.True(isMap)
+	expect.Equal(int64(2), latency["count"])
+	expect.Equal(2.0, latency["min"])
+	expect.Equal(4.0, latency["max"])
+	expect.Equal(3.0, latency["mean"])
+}
+
+func TestMetricsFilter(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.Metrics")
+	config.Override("Streams", t.Name())
+	config.Override("Filter", "^(routed|kafka\\..*)$")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*Metrics)
+	expect.True(casted)
+
+	cons.registry = newMetricsTestRegistry()
+
+	snapshot := cons.getSnapshot(time.Now())
+	expect.Equal(2, len(snapshot.Metrics))
+	expect.Equal(int64(42), snapshot.Metrics["routed"])
+	expect.Equal(int64(3), snapshot.Metrics["kafka.sent"])
+
+	config = core.NewPluginConfig(t.Name()+"Invalid", "consumer.Metrics")
+	config.Override("Filter", "(")
+	_, err = core.NewPluginWithConfig(config)
+	expect.NotNil(err)
+}
+
+func TestMetricsConsume(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	router := newMockRouter(t.Name(), 4)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.Metrics")
+	config.Override("Streams", t.Name())
+	config.Override("IntervalMs", 10)
+	config.Override("Filter", "^routed$")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*Metrics)
+	expect.True(casted)
+
+	cons.registry = newMetricsTestRegistry()
+
+	workers := new(sync.WaitGroup)
+	go cons.Consume(workers)
+
+	messages := router.receive(t, 2)
+	cons.Control() <- core.PluginControlStopConsumer
+	expect.True(waitForWorkers(workers, time.Second))
+
+	snapshot := struct {
+		Time    string           `json:"time"`
+		Metrics map[string]int64 `json:"metrics"`
+	}{}
+	expect.NoError(json.Unmarshal(messages[1].GetPayload(), &snapshot))
+	expect.Equal(map[string]int64{"routed": 42}, snapshot.Metrics)
+
+	_, err = time.Parse(time.RFC3339, snapshot.Time)
+	expect.NoError(err)
+}
@@ -0,0 +1,304 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"gollum/core"
+	"gollum/core/components"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/trivago/tgo/tcontainer"
+)
+
+// MQTT consumer plugin
+//
+// This consumer subscribes to one or more topic filters on an MQTT broker.
+// Each received MQTT message is enqueued as one message. Lost connections are
+// reestablished with an increasing backoff and all topic filters are
+// subscribed again after each reconnect.
+//
+// Metadata
+//
+// *NOTE: The metadata will only set if the parameter `SetMetadata` is active.*
+//
+// - topic: Contains the topic the message was published to
+//
+// - retained: Contains "true" if the message was a retained message, "false"
+// otherwise
+//
+// Parameters
+//
+// - Servers: Defines a list of broker URIs like "tcp://host:1883". Servers
+// are tried in the given order when connecting. Use "ssl://" to connect via
+// TLS or "ws://" and "wss://" to connect via websockets.
+// By default this parameter is set to "tcp://localhost:1883".
+//
+// - Topics: Defines a list of topic filters to subscribe to. Topic filters
+// may contain the wildcards "+" and "#".
+// By default this parameter is set to "gollum/#".
+//
+// - QoS: Defines the MQTT quality of service level used for subscribing.
+// Valid values are 0 (at most once), 1 (at least once) and 2 (exactly once).
+// By default this parameter is set to 1.
+//
+// - ClientID: Defines the client identifier sent to the broker. If empty, the
+// broker assigns an identifier. A client identifier is required if
+// CleanSession is set to false.
+// By default this parameter is set to "".
+//
+// - CleanSession: When set to false the broker keeps subscriptions and queued
+// QoS 1 and 2 messages of this client while it is disconnected, so that no
+// messages are lost between reconnects or restarts.
+// By default this parameter is set to true.
+//
+// - Username: Defines the username used for authentication.
+// By default this parameter is set to "".
+//
+// - Password: Defines the password used for authentication.
+// By default this parameter is set to "".
+//
+// - SetMetadata: When this value is set to "true", the fields mentioned in the
+// metadata section will be added to each message.
+// By default this parameter is set to "false".
+//
+// - KeepAliveSec: Defines the interval in seconds in which the client pings
+// the broker when no other messages are sent.
+// By default this parameter is set to "30".
+//
+// - TimeoutMs: Defines the timeout in milliseconds for connecting to a server
+// and for disconnecting on shutdown.
+// By default this parameter is set to "5000".
+//
+// - ReconnectDelayMs: Defines the delay in milliseconds before a failed
+// initial connection attempt is repeated.
+// By default this parameter is set to "500".
+//
+// - ReconnectDelayMaxMs: Defines the maximum delay between two reconnect
+// attempts in milliseconds. The delay starts at one second and is doubled
+// with each failed attempt.
+// By default this parameter is set to "30000".
+//
+// - TlsKeyLocation, TlsKeyPem: The client's private key used for TLS based
+// authentication, given as path or PEM encoded string.
+// By default these parameters are set to "".
+//
+// - TlsCertificateLocation, TlsCertificatePem: The client's public key used
+// for TLS based authentication, given as path or PEM encoded string.
+// By default these parameters are set to "".
+//
+// - TlsCaLocation, TlsCaPem: The CA certificate(s) used for verifying the
+// server's key, given as path or PEM encoded string. If not set, the
+// system's root certificates are used.
+// By default these parameters are set to "".
+//
+// - TlsServerName: Used to verify the hostname on the server's certificate
+// unless TlsInsecureSkipVerify is true. If not set, the host of the server
+// URI is used.
+// By default this parameter is set to "".
+//
+// - TlsInsecureSkipVerify: Disables server certificate chain and host name
+// verification.
+// By default this parameter is set to false.
+//
+// Examples
+//
+// This example consumes all sensor readings of all buildings using a
+// persistent session, so that readings sent while gollum is restarted are
+// not lost.
+//
+//  MQTTIn:
+//    Type: consumer.MQTT
+//    Streams: sensors
+//    Servers:
+//      - ssl://mqtt.example.com:8883
+//    Topics:
+//      - "buildings/+/sensors/#"
+//    QoS: 1
+//    ClientID: gollum-sensors
+//    CleanSession: false
+//    SetMetadata: true
+type MQTT struct {
+	core.SimpleConsumer `gollumdoc:"embed_type"`
+	servers             []string      `config:"Servers" default:"tcp://localhost:1883"`
+	topics              []string      `config:"Topics" default:"gollum/#"`
+	qos                 int           `config:"QoS" default:"1"`
+	clientID            string        `config:"ClientID"`
+	cleanSession        bool          `config:"CleanSession" default:"true"`
+	username            string        `config:"Username"`
+	password            string        `config:"Password"`
+	hasToSetMetadata    bool          `config:"SetMetadata" default:"false"`
+	keepAlive           time.Duration `config:"KeepAliveSec" default:"30" metric:"sec"`
+	timeout             time.Duration `config:"TimeoutMs" default:"5000" metric:"ms"`
+	reconnectDelay      time.Duration `config:"ReconnectDelayMs" default:"500" metric:"ms"`
+	reconnectDelayMax   time.Duration `config:"ReconnectDelayMaxMs" default:"30000" metric:"ms"`
+	tlsConfig           *tls.Config
+	client              mqtt.Client
+}
+
+func init() {
+	core.TypeRegistry.Register(MQTT{})
+}
+
+// Configure initializes this consumer with values from a plugin config.
+func (cons *MQTT) Configure(conf core.PluginConfigReader) {
+	cons.SetStopCallback(cons.close)
+
+	if len(cons.servers) == 0 {
+		conf.Errors.Pushf("At least one server is required")
+	}
+	for _, server := range cons.servers {
+		if err := validateMQTTServer(server); err != nil {
+			conf.Errors.Pushf("Invalid server '%s': %s", server, err.Error())
+		}
+	}
+
+	if len(cons.topics) == 0 {
+		conf.Errors.Pushf("At least one topic is required")
+	}
+	if cons.qos < 0 || cons.qos > 2 {
+		conf.Errors.Pushf("QoS must be 0, 1 or 2")
+	}
+	if !cons.cleanSession && cons.clientID == "" {
+		conf.Errors.Pushf("ClientID is required if CleanSession is false")
+	}
+
+	cons.tlsConfig = &tls.Config{
+		ServerName:         conf.GetString("TlsServerName", ""),
+		InsecureSkipVerify: conf.GetBool("TlsInsecureSkipVerify", false),
+	}
+
+	cert, err := components.ReadTLSKeyPair(conf)
+	if !conf.Errors.Push(err) && cert != nil {
+		cons.tlsConfig.Certificates = []tls.Certificate{*cert}
+	}
+
+	caCertPool, err := components.ReadTLSCertPool(conf)
+	if !conf.Errors.Push(err) {
+		cons.tlsConfig.RootCAs = caCertPool
+	}
+}
+
+// validateMQTTServer returns an error if the given server URI cannot be used
+// to connect to an MQTT broker.
+func validateMQTTServer(server string) error {
+	uri, err := url.Parse(server)
+	if err != nil {
+		return err
+	}
+
+	switch uri.Scheme {
+	case "tcp", "mqtt", "ssl", "tls", "mqtts", "tcps", "ws", "wss":
+		return nil
+	default:
+		return fmt.Errorf("unsupported scheme '%s'", uri.Scheme)
+	}
+}
+
+// newClientOptions returns the options used to connect to the broker.
+func (cons *MQTT) newClientOptions() *mqtt.ClientOptions {
+	options := mqtt.NewClientOptions()
+	for _, server := range cons.servers {
+		options.AddBroker(server)
+	}
+
+	options.SetClientID(cons.clientID)
+	options.SetUsername(cons.username)
+	options.SetPassword(cons.password)
+	options.SetCleanSession(cons.cleanSession)
+	options.SetTLSConfig(cons.tlsConfig.Clone())
+	options.SetKeepAlive(cons.keepAlive)
+	options.SetConnectTimeout(cons.timeout)
+
+	options.SetConnectRetry(true)
+	options.SetConnectRetryInterval(cons.reconnectDelay)
+	options.SetAutoReconnect(true)
+	options.SetMaxReconnectInterval(cons.reconnectDelayMax)
+
+	// Subscriptions are bound to the default handler so that messages queued
+	// in a persistent session are handled directly after connecting.
+	options.SetDefaultPublishHandler(cons.onMessage)
+	options.SetOnConnectHandler(cons.onConnect)
+	options.SetConnectionLostHandler(cons.onConnectionLost)
+	return options
+}
+
+// onConnect (re)subscribes to all topic filters after a connection has been
+// established.
+func (cons *MQTT) onConnect(client mqtt.Client) {
+	filters := make(map[string]byte, len(cons.topics))
+	for _, topic := range cons.topics {
+		filters[topic] = byte(cons.qos)
+	}
+
+	token := client.SubscribeMultiple(filters, nil)
+	if !token.WaitTimeout(cons.timeout) {
+		cons.Logger.Error("Timeout while subscribing to topics")
+		return
+	}
+	if err := token.Error(); err != nil {
+		cons.Logger.WithError(err).Error("Failed to subscribe to topics")
+		return
+	}
+	cons.Logger.Debugf("Subscribed to %d topics", len(filters))
+}
+
+func (cons *MQTT) onConnectionLost(client mqtt.Client, err error) {
+	cons.Logger.WithError(err).Warning("Connection lost, reconnecting")
+}
+
+// getMessageMetadata returns the metadata for the given MQTT message.
+func (cons *MQTT) getMessageMetadata(msg mqtt.Message) tcontainer.MarshalMap {
+	metaData := core.NewMetadata()
+
+	// Topics contain "/", so path characters must not be resolved
+	metaData["topic"] = msg.Topic()
+	metaData["retained"] = strconv.FormatBool(msg.Retained())
+
+	return metaData
+}
+
+// onMessage enqueues a message received from the broker. The message is
+// acknowledged by the client after this function returns.
+func (cons *MQTT) onMessage(client mqtt.Client, msg mqtt.Message) {
+	if cons.hasToSetMetadata {
+		cons.EnqueueWithMetadata(msg.Payload(), cons.getMessageMetadata(msg))
+	} else {
+		cons.Enqueue(msg.Payload())
+	}
+}
+
+func (cons *MQTT) close() {
+	defer cons.WorkerDone()
+	if cons.client != nil {
+		cons.client.Disconnect(uint(cons.timeout / time.Millisecond))
+	}
+}
+
+// Consume connects to the broker and subscribes to the configured topics.
+func (cons *MQTT) Consume(workers *sync.WaitGroup) {
+	cons.client = mqtt.NewClient(cons.newClientOptions())
+	cons.AddMainWorker(workers)
+
+	// Failed connection attempts are retried until the consumer is stopped
+	cons.client.Connect()
+	cons.ControlLoop()
+}
@@ -0,0 +1,203 @@
+// +build integration
+
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"gollum/core"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+	"github.com/trivago/tgo/ttesting"
+)
+
+// mockMQTTBroker is a minimal MQTT broker accepting a single client at a time.
+// It records subscriptions and acknowledgements and allows publishing
+// messages to the connected client.
+type mockMQTTBroker struct {
+	listener   net.Listener
+	guard      *sync.Mutex
+	conn       net.Conn
+	messageID  uint16
+	subscribed chan []string
+	acked      chan uint16
+}
+
+func newMockMQTTBroker(t *testing.T) *mockMQTTBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	broker := &mockMQTTBroker{
+		listener:   listener,
+		guard:      new(sync.Mutex),
+		subscribed: make(chan []string, 10),
+		acked:      make(chan uint16, 10),
+	}
+	go broker.accept()
+	return broker
+}
+
+func (broker *mockMQTTBroker) address() string {
+	return "tcp://" + broker.listener.Addr().String()
+}
+
+func (broker *mockMQTTBroker) accept() {
+	for {
+		conn, err := broker.listener.Accept()
+		if err != nil {
+			return // ### return, closed ###
+		}
+		broker.guard.Lock()
+		broker.conn = conn
+		broker.guard.Unlock()
+		go broker.serve(conn)
+	}
+}
+
+func (broker *mockMQTTBroker) write(packet packets.ControlPacket) error {
+	broker.guard.Lock()
+	defer broker.guard.Unlock()
+	return packet.Write(broker.conn)
+}
+
+func (broker *mockMQTTBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := packets.ReadPacket(conn)
+		if err != nil {
+			return // ### return, connection closed ###
+		}
+
+		switch request := packet.(type) {
+		case *packets.ConnectPacket:
+			broker.write(packets.NewControlPacket(packets.Connack))
+
+		case *packets.SubscribePacket:
+			response := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+			response.MessageID = request.MessageID
+			response.ReturnCodes = request.Qoss
+			broker.write(response)
+			broker.subscribed <- request.Topics
+
+		case *packets.PingreqPacket:
+			broker.write(packets.NewControlPacket(packets.Pingresp))
+
+		case *packets.PubackPacket:
+			broker.acked <- request.MessageID
+
+		case *packets.DisconnectPacket:
+			return // ### return, client disconnected ###
+		}
+	}
+}
+
+// publish sends a QoS 1 message to the connected client.
+func (broker *mockMQTTBroker) publish(topic string, payload string, retained bool) uint16 {
+	broker.guard.Lock()
+	broker.messageID++
+	messageID := broker.messageID
+	broker.guard.Unlock()
+
+	packet := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	packet.TopicName = topic
+	packet.Payload = []byte(payload)
+	packet.Retain = retained
+	packet.Qos = 1
+	packet.MessageID = messageID
+	broker.write(packet)
+	return messageID
+}
+
+// dropConnection closes the connection to the current client.
+func (broker *mockMQTTBroker) dropConnection() {
+	broker.guard.Lock()
+	defer broker.guard.Unlock()
+	broker.conn.Close()
+}
+
+func (broker *mockMQTTBroker) close() {
+	broker.listener.Close()
+}
+
+func waitForSubscription(t *testing.T, broker *mockMQTTBroker) []string {
+	select {
+	case topics := <-broker.subscribed:
+		return topics
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout while waiting for subscription")
+		return nil
+	}
+}
+
+func waitForAck(t *testing.T, broker *mockMQTTBroker) uint16 {
+	select {
+	case messageID := <-broker.acked:
+		return messageID
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout while waiting for acknowledgement")
+		return 0
+	}
+}
+
+func TestMQTTConsumeAndResubscribe(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	broker := newMockMQTTBroker(t)
+	defer broker.close()
+
+	router := newMockRouter(t.Name(), 2)
+	cons := newMQTTTestConsumer(t, map[string]interface{}{
+		"Servers":             []string{broker.address()},
+		"Topics":              []string{"sensors/#", "alerts/+"},
+		"SetMetadata":         true,
+		"ReconnectDelayMaxMs": 100,
+	})
+
+	workers := new(sync.WaitGroup)
+	go cons.Consume(workers)
+	defer func() {
+		cons.Control() <- core.PluginControlStopConsumer
+		expect.True(waitForWorkers(workers, 5*time.Second))
+	}()
+
+	topics := waitForSubscription(t, broker)
+	expect.Equal(2, len(topics))
+
+	messageID := broker.publish("sensors/kitchen", "21.5", true)
+	msg := router.receive(t, 1)[0]
+	expect.Equal("21.5", msg.String())
+	expect.Equal("sensors/kitchen", msg.GetMetadata()["topic"])
+	expect.Equal("true", msg.GetMetadata()["retained"])
+	expect.Equal(messageID, waitForAck(t, broker))
+
+	// All topics are subscribed again after the connection has been lost
+	broker.dropConnection()
+	topics = waitForSubscription(t, broker)
+	expect.Equal(2, len(topics))
+
+	messageID = broker.publish("alerts/fire", "kitchen", false)
+	msg = router.receive(t, 1)[0]
+	expect.Equal("kitchen", msg.String())
+	expect.Equal("alerts/fire", msg.GetMetadata()["topic"])
+	expect.Equal("false", msg.GetMetadata()["retained"])
+	expect.Equal(messageID, waitForAck(t, broker))
+}
@@ -0,0 +1,156 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+// mockMQTTMessage implements mqtt.Message
+type mockMQTTMessage struct {
+	topic    string
+	retained bool
+	payload  []byte
+	acked    bool
+}
+
+func (msg *mockMQTTMessage) Duplicate() bool   { return false }
+func (msg *mockMQTTMessage) Qos() byte         { return 1 }
+func (msg *mockMQTTMessage) Retained() bool    { return msg.retained }
+func (msg *mockMQTTMessage) Topic() string     { return msg.topic }
+func (msg *mockMQTTMessage) MessageID() uint16 { return 1 }
+func (msg *mockMQTTMessage) Payload() []byte   { return msg.payload }
+func (msg *mockMQTTMessage) Ack()              { msg.acked = true }
+
+func TestMQTTMetadata(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	router := newMockRouter(t.Name(), 2)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.MQTT")
+	config.Override("Streams", t.Name())
+	config.Override("Topics", []string{"sensors/#"})
+	config.Override("SetMetadata", true)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*MQTT)
+	expect.True(casted)
+
+	cons.onMessage(nil, &mockMQTTMessage{
+		topic:    "sensors/kitchen/temperature",
+		retained: true,
+		payload:  []byte("21.5"),
+	})
+	cons.onMessage(nil, &mockMQTTMessage{
+		topic:   "sensors/hall/temperature",
+		payload: []byte("19.0"),
+	})
+
+	messages := router.receive(t, 2)
+	expect.Equal("21.5", messages[0].String())
+	expect.Equal("sensors/kitchen/temperature", messages[0].GetMetadata()["topic"])
+	expect.Equal("true", messages[0].GetMetadata()["retained"])
+
+	expect.Equal("19.0", messages[1].String())
+	expect.Equal("sensors/hall/temperature", messages[1].GetMetadata()["topic"])
+	expect.Equal("false", messages[1].GetMetadata()["retained"])
+}
+
+func TestMQTTWithoutMetadata(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	router := newMockRouter(t.Name(), 1)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.MQTT")
+	config.Override("Streams", t.Name())
+	config.Override("Topics", []string{"sensors/#"})
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*MQTT)
+	expect.True(casted)
+
+	cons.onMessage(nil, &mockMQTTMessage{
+		topic:   "sensors/kitchen/temperature",
+		payload: []byte("21.5"),
+	})
+
+	msg := router.receive(t, 1)[0]
+	expect.Equal("21.5", msg.String())
+	expect.Equal(0, len(msg.GetMetadata()))
+}
+
+func TestMQTTStopWhileConnecting(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	// Reserve a port nobody listens on
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	expect.NoError(err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	config := core.NewPluginConfig(t.Name(), "consumer.MQTT")
+	config.Override("Streams", t.Name())
+	config.Override("Topics", []string{"sensors/#"})
+	config.Override("Servers", []string{"tcp://" + address})
+	config.Override("ReconnectDelayMs", 10)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*MQTT)
+	expect.True(casted)
+
+	workers := new(sync.WaitGroup)
+	go cons.Consume(workers)
+
+	for start := time.Now(); cons.GetState() != core.PluginStateActive && time.Since(start) < time.Second; {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	cons.Control() <- core.PluginControlStopConsumer
+	expect.True(waitForWorkers(workers, time.Second))
+	expect.False(cons.client.IsConnected())
+}
+
+func TestMQTTConfigErrors(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	for idx, settings := range []map[string]interface{}{
+		{"Topics": []string{"a"}, "Servers": []string{}},
+		{"Topics": []string{"a"}, "Servers": []string{"http://localhost"}},
+		{"Topics": []string{}},
+		{"Topics": []string{"a"}, "QoS": 3},
+		{"Topics": []string{"a"}, "CleanSession": false},
+	} {
+		config := core.NewPluginConfig(fmt.Sprintf("%s%d", t.Name(), idx), "consumer.MQTT")
+		for key, value := range settings {
+			config.Override(key, value)
+		}
+		_, err := core.NewPluginWithConfig(config)
+		expect.NotNil(err)
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gollum/core"
+	"gollum/core/components/pubsub"
+
+	cloudpubsub "cloud.google.com/go/pubsub"
+	"github.com/trivago/tgo"
+	"github.com/trivago/tgo/tcontainer"
+)
+
+// PubSub consumer plugin
+//
+// This consumer reads messages from a Google Cloud Pub/Sub subscription using
+// streaming pull. Each message is acknowledged after it has been enqueued.
+// If the producers are not able to keep up, no more than
+// MaxOutstandingMessages messages are received before older ones have been
+// enqueued. The ack deadline of these messages is extended for up to
+// MaxExtensionSec, after which Pub/Sub redelivers them. Messages received
+// while the consumer is shutting down are nacked so that Pub/Sub redelivers
+// them right away.
+//
+// Requests are authorized with the credentials file given by CredentialsFile.
+// If no file is set, application default credentials are used, i.e. the file
+// named by the GOOGLE_APPLICATION_CREDENTIALS environment variable, the
+// gcloud user credentials or the service account of the compute instance
+// gollum is running on. If the PUBSUB_EMULATOR_HOST environment variable is
+// set, the emulator is used without authentication.
+//
+// Metadata
+//
+// *NOTE: The metadata will only set if the parameter `SetMetadata` is active.*
+//
+// - message_id: Contains the ID assigned to the message by Pub/Sub
+//
+// - publish_time: Contains the time the message was published in RFC3339
+// format with nanoseconds
+//
+// - ordering_key: Contains the ordering key of the message, if any
+//
+// - attribute.<name>: Contains the value of the message attribute <name>
+//
+// Parameters
+//
+// - Subscription: Defines the subscription to consume from. Either a
+// subscription ID or a fully qualified name like
+// "projects/<project>/subscriptions/<subscription>".
+// By default this parameter is set to "gollum".
+//
+// - ProjectID: Defines the project of the subscription if it is not given as
+// a fully qualified name. If empty, the project of the credentials or the
+// GOOGLE_CLOUD_PROJECT environment variable is used.
+// By default this parameter is set to "".
+//
+// - CredentialsFile: Defines the path to a service account or authorized
+// user JSON key file. If empty, application default credentials are used.
+// By default this parameter is set to "".
+//
+// - Endpoint: Defines the address of the Pub/Sub gRPC API, e.g.
+// "europe-west1-pubsub.googleapis.com:443". If empty, the public endpoint is
+// used. This setting is ignored when using the emulator.
+// By default this parameter is set to "".
+//
+// - MaxOutstandingMessages: Defines the maximum number of messages that have
+// been received but not yet acknowledged or nacked.
+// By default this parameter is set to 1000.
+//
+// - Workers: Defines the number of go routines receiving messages from the
+// streaming pull connection.
+// By default this parameter is set to 1.
+//
+// - MaxExtensionSec: Defines the maximum number of seconds the ack deadline
+// of a received message is extended while it waits to be enqueued.
+// By default this parameter is set to 600.
+//
+// - SetMetadata: When this value is set to "true", the fields mentioned in the
+// metadata section will be added to each message.
+// By default this parameter is set to "false".
+//
+// - RetryDelayMs: Defines the delay in milliseconds before a failed streaming
+// pull is restarted. The delay is doubled with each failed attempt.
+// By default this parameter is set to "500".
+//
+// - RetryDelayMaxMs: Defines the maximum delay between two failed streaming
+// pulls in milliseconds.
+// By default this parameter is set to "30000".
+//
+// Examples
+//
+// This example consumes the subscription "gollum-logs" of the project
+// "my-project" using a service account key file.
+//
+//  PubSubIn:
+//    Type: consumer.PubSub
+//    Streams: logs
+//    Subscription: gollum-logs
+//    ProjectID: my-project
+//    CredentialsFile: /etc/gollum/pubsub-key.json
+//    MaxOutstandingMessages: 5000
+//    Workers: 4
+//    SetMetadata: true
+type PubSub struct {
+	core.SimpleConsumer `gollumdoc:"embed_type"`
+	subscriptionName    string        `config:"Subscription" default:"gollum"`
+	projectID           string        `config:"ProjectID"`
+	credentialsFile     string        `config:"CredentialsFile"`
+	endpoint            string        `config:"Endpoint"`
+	maxOutstanding      int           `config:"MaxOutstandingMessages" default:"1000"`
+	workers             int           `config:"Workers" default:"1"`
+	maxExtension        time.Duration `config:"MaxExtensionSec" default:"600" metric:"sec"`
+	hasToSetMetadata    bool          `config:"SetMetadata" default:"false"`
+	retryDelay          time.Duration `config:"RetryDelayMs" default:"500" metric:"ms"`
+	retryDelayMax       time.Duration `config:"RetryDelayMaxMs" default:"30000" metric:"ms"`
+	client              *cloudpubsub.Client
+	subscription        *cloudpubsub.Subscription
+	received            int32
+	context             context.Context
+	cancel              context.CancelFunc
+}
+
+func init() {
+	core.TypeRegistry.Register(PubSub{})
+}
+
+// Configure initializes this consumer with values from a plugin config.
+func (cons *PubSub) Configure(conf core.PluginConfigReader) {
+	cons.SetStopCallback(cons.close)
+	cons.context, cons.cancel = context.WithCancel(context.Background())
+
+	if cons.subscriptionName == "" {
+		conf.Errors.Pushf("Subscription must not be empty")
+	}
+	if cons.maxOutstanding < 1 {
+		conf.Errors.Pushf("MaxOutstandingMessages must be at least 1")
+	}
+	if cons.workers < 1 {
+		conf.Errors.Pushf("Workers must be at least 1")
+	}
+	if cons.maxExtension < time.Second {
+		conf.Errors.Pushf("MaxExtensionSec must be at least 1")
+	}
+
+	project, subscriptionID := pubsub.SplitResourceName(cons.subscriptionName)
+	if project == "" {
+		project = cons.projectID
+	}
+
+	client, err := pubsub.NewClient(cons.context, pubsub.Credentials{
+		ProjectID: project,
+		File:      cons.credentialsFile,
+		Endpoint:  cons.endpoint,
+	})
+	if conf.Errors.Push(err) {
+		return // ### return, no client ###
+	}
+
+	cons.client = client
+	cons.subscription = client.Subscription(subscriptionID)
+	cons.subscription.ReceiveSettings.MaxOutstandingMessages = cons.maxOutstanding
+	cons.subscription.ReceiveSettings.NumGoroutines = cons.workers
+	cons.subscription.ReceiveSettings.MaxExtension = cons.maxExtension
+}
+
+// getMessageMetadata returns the metadata for the given Pub/Sub message.
+func (cons *PubSub) getMessageMetadata(msg *cloudpubsub.Message) tcontainer.MarshalMap {
+	metaData := core.NewMetadata()
+
+	metaData.Set("message_id", msg.ID)
+	metaData.Set("publish_time", msg.PublishTime.Format(time.RFC3339Nano))
+	if msg.OrderingKey != "" {
+		metaData.Set("ordering_key", msg.OrderingKey)
+	}
+
+	// Attribute names are stored as-is, so path characters must not be resolved
+	for name, value := range msg.Attributes {
+		metaData["attribute."+name] = value
+	}
+
+	return metaData
+}
+
+// handleMessage enqueues and acknowledges the given message. The message is
+// nacked if the consumer is shutting down.
+func (cons *PubSub) handleMessage(ctx context.Context, msg *cloudpubsub.Message) {
+	if cons.GetState() >= core.PluginStateStopping || ctx.Err() != nil {
+		msg.Nack()
+		return // ### return, shutting down ###
+	}
+
+	if cons.hasToSetMetadata {
+		cons.EnqueueWithMetadata(msg.Data, cons.getMessageMetadata(msg))
+	} else {
+		cons.Enqueue(msg.Data)
+	}
+	msg.Ack()
+	atomic.StoreInt32(&cons.received, 1)
+}
+
+// waitForRetry sleeps for the given delay and returns false if the consumer
+// has been stopped in the meantime.
+func (cons *PubSub) waitForRetry(delay time.Duration) bool {
+	select {
+	case <-cons.context.Done():
+		return false
+	case <-time.After(delay):
+		return true
+	}
+}
+
+// receive runs the streaming pull until the consumer is stopped. The
+// streaming pull is restarted if it fails.
+func (cons *PubSub) receive() {
+	defer cons.WorkerDone()
+	defer cons.client.Close()
+	delay := time.Duration(0)
+
+	for {
+		err := cons.subscription.Receive(cons.context, cons.handleMessage)
+		if cons.context.Err() != nil {
+			return // ### return, stopped ###
+		}
+
+		cons.GetErrorMetrics().CountConnectFailure()
+		cons.Logger.WithError(err).Error("Failed to receive messages")
+
+		switch {
+		case atomic.SwapInt32(&cons.received, 0) == 1:
+			delay = cons.retryDelay
+		case delay == 0:
+			delay = cons.retryDelay
+		case delay < cons.retryDelayMax:
+			delay *= 2
+		}
+		if delay > cons.retryDelayMax {
+			delay = cons.retryDelayMax
+		}
+
+		if !cons.waitForRetry(delay) {
+			return // ### return, stopped ###
+		}
+	}
+}
+
+func (cons *PubSub) close() {
+	cons.cancel()
+}
+
+// Consume starts receiving from the configured subscription.
+func (cons *PubSub) Consume(workers *sync.WaitGroup) {
+	cons.AddMainWorker(workers)
+	go tgo.WithRecoverShutdown(cons.receive)
+	cons.ControlLoop()
+}
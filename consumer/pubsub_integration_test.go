@@ -0,0 +1,167 @@
+// +build integration
+
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"gollum/core"
+
+	cloudpubsub "cloud.google.com/go/pubsub"
+	"github.com/trivago/tgo/ttesting"
+)
+
+// newPubSubEmulatorClient returns a client for the emulator used for
+// integration tests, e.g. started by
+// "gcloud beta emulators pubsub start --host-port=localhost:8085".
+func newPubSubEmulatorClient(t *testing.T) *cloudpubsub.Client {
+	if os.Getenv("PUBSUB_EMULATOR_HOST") == "" {
+		t.Skip("PUBSUB_EMULATOR_HOST is not set")
+	}
+
+	client, err := cloudpubsub.NewClient(context.Background(), pubsubTestProject)
+	ttesting.NewExpect(t).NoError(err)
+	return client
+}
+
+// newPubSubEmulatorSubscription creates a topic and a subscription named
+// after the test.
+func newPubSubEmulatorSubscription(t *testing.T, client *cloudpubsub.Client) (*cloudpubsub.Topic, *cloudpubsub.Subscription) {
+	expect := ttesting.NewExpect(t)
+
+	topic, err := client.CreateTopic(context.Background(), t.Name())
+	expect.NoError(err)
+	subscription, err := client.CreateSubscription(context.Background(), t.Name(), cloudpubsub.SubscriptionConfig{
+		Topic:       topic,
+		AckDeadline: time.Minute,
+	})
+	expect.NoError(err)
+	return topic, subscription
+}
+
+func deletePubSubEmulatorSubscription(topic *cloudpubsub.Topic, subscription *cloudpubsub.Subscription) {
+	subscription.Delete(context.Background())
+	topic.Stop()
+	topic.Delete(context.Background())
+}
+
+func publishPubSubEmulatorMessage(t *testing.T, topic *cloudpubsub.Topic, data string) {
+	_, err := topic.Publish(context.Background(), &cloudpubsub.Message{
+		Data:       []byte(data),
+		Attributes: map[string]string{"source": "test"},
+	}).Get(context.Background())
+	ttesting.NewExpect(t).NoError(err)
+}
+
+// receivePubSubEmulatorMessages returns the messages received within the
+// given time without acknowledging them.
+func receivePubSubEmulatorMessages(subscription *cloudpubsub.Subscription, timeout time.Duration, handle func(context.Context, *cloudpubsub.Message)) int {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	received := 0
+	guard := new(sync.Mutex)
+	subscription.Receive(ctx, func(ctx context.Context, msg *cloudpubsub.Message) {
+		guard.Lock()
+		received++
+		guard.Unlock()
+		handle(ctx, msg)
+	})
+	return received
+}
+
+func TestPubSubEmulatorConsumeAndAck(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	client := newPubSubEmulatorClient(t)
+	defer client.Close()
+
+	topic, subscription := newPubSubEmulatorSubscription(t, client)
+	defer deletePubSubEmulatorSubscription(topic, subscription)
+
+	router := newMockRouter(t.Name(), 1)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.PubSub")
+	config.Override("Streams", t.Name())
+	config.Override("ProjectID", pubsubTestProject)
+	config.Override("Subscription", t.Name())
+	config.Override("SetMetadata", true)
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*PubSub)
+	expect.True(casted)
+
+	workers := new(sync.WaitGroup)
+	go cons.Consume(workers)
+
+	publishPubSubEmulatorMessage(t, topic, "message")
+
+	msg := router.receive(t, 1)[0]
+	expect.Equal("message", msg.String())
+	expect.Equal("test", msg.GetMetadata()["attribute.source"])
+
+	cons.Control() <- core.PluginControlStopConsumer
+	expect.True(waitForWorkers(workers, 5*time.Second))
+
+	// The message has been acknowledged and is not delivered again
+	redelivered := receivePubSubEmulatorMessages(subscription, 2*time.Second, func(ctx context.Context, msg *cloudpubsub.Message) {
+		msg.Nack()
+	})
+	expect.Equal(0, redelivered)
+}
+
+func TestPubSubEmulatorNackRedelivers(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	client := newPubSubEmulatorClient(t)
+	defer client.Close()
+
+	topic, subscription := newPubSubEmulatorSubscription(t, client)
+	defer deletePubSubEmulatorSubscription(topic, subscription)
+
+	router := newMockRouter(t.Name(), 1)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.PubSub")
+	config.Override("Streams", t.Name())
+	config.Override("ProjectID", pubsubTestProject)
+	config.Override("Subscription", t.Name())
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*PubSub)
+	expect.True(casted)
+
+	workers := new(sync.WaitGroup)
+	go cons.Consume(workers)
+	cons.Control() <- core.PluginControlStopConsumer
+	expect.True(waitForWorkers(workers, 5*time.Second))
+
+	publishPubSubEmulatorMessage(t, topic, "message")
+
+	// The ack deadline of the subscription is 60 seconds, so the message is
+	// only delivered again right away if it has been nacked.
+	received := receivePubSubEmulatorMessages(subscription, 2*time.Second, func(ctx context.Context, msg *cloudpubsub.Message) {
+		cons.handleMessage(ctx, msg)
+	})
+	expect.Greater(received, 1)
+	expect.Equal(0, len(router.messages))
+}
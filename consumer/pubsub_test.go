@@ -0,0 +1,208 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"gollum/core"
+
+	cloudpubsub "cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/trivago/tgo/ttesting"
+)
+
+const pubsubTestProject = "gollum-test"
+
+// startPubSubTestServer starts an in-memory Pub/Sub server with a topic and
+// a subscription named after the test. PUBSUB_EMULATOR_HOST points to the
+// server until the returned function is called.
+func startPubSubTestServer(t *testing.T) (*pstest.Server, func()) {
+	expect := ttesting.NewExpect(t)
+
+	server := pstest.NewServer()
+	os.Setenv("PUBSUB_EMULATOR_HOST", server.Addr)
+
+	client, err := cloudpubsub.NewClient(context.Background(), pubsubTestProject)
+	expect.NoError(err)
+	defer client.Close()
+
+	topic, err := client.CreateTopic(context.Background(), t.Name())
+	expect.NoError(err)
+	_, err = client.CreateSubscription(context.Background(), t.Name(), cloudpubsub.SubscriptionConfig{
+		Topic:       topic,
+		AckDeadline: time.Minute,
+	})
+	expect.NoError(err)
+
+	return server, func() {
+		os.Unsetenv("PUBSUB_EMULATOR_HOST")
+		server.Close()
+	}
+}
+
+func TestPubSubAckOnEnqueue(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	server, stopServer := startPubSubTestServer(t)
+	defer stopServer()
+
+	topic := "projects/" + pubsubTestProject + "/topics/" + t.Name()
+	firstID := server.PublishOrdered(topic, []byte("message1"), map[string]string{"trace.id": "abc"}, "user42")
+	secondID := server.Publish(topic, []byte("message2"), nil)
+
+	router := newMockRouter(t.Name(), 2)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.PubSub")
+	config.Override("Streams", t.Name())
+	config.Override("ProjectID", pubsubTestProject)
+	config.Override("Subscription", t.Name())
+	config.Override("SetMetadata", true)
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*PubSub)
+	expect.True(casted)
+
+	workers := new(sync.WaitGroup)
+	go cons.Consume(workers)
+
+	received := map[string]*core.Message{}
+	for _, msg := range router.receive(t, 2) {
+		received[msg.String()] = msg
+	}
+
+	cons.Control() <- core.PluginControlStopConsumer
+	expect.True(waitForWorkers(workers, 5*time.Second))
+
+	expect.Equal(1, server.Message(firstID).Acks)
+	expect.Equal(1, server.Message(secondID).Acks)
+
+	first, exists := received["message1"]
+	expect.True(exists)
+	metadata := first.GetMetadata()
+	expect.MapEqual(metadata, "message_id", firstID)
+	expect.MapEqual(metadata, "publish_time", server.Message(firstID).PublishTime.UTC().Format(time.RFC3339Nano))
+	expect.MapEqual(metadata, "ordering_key", "user42")
+	expect.Equal("abc", metadata["attribute.trace.id"])
+
+	second, exists := received["message2"]
+	expect.True(exists)
+	_, exists = second.GetMetadata()["ordering_key"]
+	expect.False(exists)
+}
+
+func TestPubSubNackOnStop(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	server, stopServer := startPubSubTestServer(t)
+	defer stopServer()
+
+	router := newMockRouter(t.Name(), 1)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.PubSub")
+	config.Override("Streams", t.Name())
+	config.Override("ProjectID", pubsubTestProject)
+	config.Override("Subscription", t.Name())
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*PubSub)
+	expect.True(casted)
+
+	workers := new(sync.WaitGroup)
+	go cons.Consume(workers)
+
+	for start := time.Now(); cons.GetState() != core.PluginStateActive && time.Since(start) < time.Second; {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cons.Control() <- core.PluginControlStopConsumer
+	expect.True(waitForWorkers(workers, 5*time.Second))
+
+	// Pass a message received after the consumer has been stopped
+	id := server.Publish("projects/"+pubsubTestProject+"/topics/"+t.Name(), []byte("message"), nil)
+
+	client, err := cloudpubsub.NewClient(context.Background(), pubsubTestProject)
+	expect.NoError(err)
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err = client.Subscription(t.Name()).Receive(ctx, func(ctx context.Context, msg *cloudpubsub.Message) {
+		cons.handleMessage(ctx, msg)
+		cancel()
+	})
+	expect.NoError(err)
+
+	msg := server.Message(id)
+	expect.Equal(0, msg.Acks)
+	expect.Equal(0, len(router.messages))
+
+	nacked := false
+	for _, modack := range msg.Modacks {
+		nacked = nacked || modack.AckDeadline == 0
+	}
+	expect.True(nacked)
+}
+
+func TestPubSubReceiveSettings(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	_, stopServer := startPubSubTestServer(t)
+	defer stopServer()
+
+	config := core.NewPluginConfig(t.Name(), "consumer.PubSub")
+	config.Override("ProjectID", pubsubTestProject)
+	config.Override("Subscription", "projects/other/subscriptions/logs")
+	config.Override("MaxOutstandingMessages", 2)
+	config.Override("Workers", 3)
+	config.Override("MaxExtensionSec", 30)
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*PubSub)
+	expect.True(casted)
+
+	expect.Equal("projects/other/subscriptions/logs", cons.subscription.String())
+	expect.Equal(2, cons.subscription.ReceiveSettings.MaxOutstandingMessages)
+	expect.Equal(3, cons.subscription.ReceiveSettings.NumGoroutines)
+	expect.Equal(30*time.Second, cons.subscription.ReceiveSettings.MaxExtension)
+}
+
+func TestPubSubConfigErrors(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	_, stopServer := startPubSubTestServer(t)
+	defer stopServer()
+
+	for idx, settings := range []map[string]interface{}{
+		{"Subscription": ""},
+		{"MaxOutstandingMessages": 0},
+		{"Workers": 0},
+		{"MaxExtensionSec": 0},
+	} {
+		config := core.NewPluginConfig(fmt.Sprintf("%s%d", t.Name(), idx), "consumer.PubSub")
+		config.Override("ProjectID", pubsubTestProject)
+		for key, value := range settings {
+			config.Override(key, value)
+		}
+		_, err := core.NewPluginWithConfig(config)
+		expect.NotNil(err)
+	}
+}
@@ -30,7 +30,8 @@ import (
 )
 
 const (
-	socketBufferGrowSize = 256
+	socketBufferGrowSize  = 256
+	socketMaxDatagramSize = 65536
 )
 
 // Socket consumer plugin
@@ -45,6 +46,9 @@ const (
 // This can either be any ip address and port like "localhost:5880" or a file
 // like "unix:///var/gollum.socket". Valid protocols can be derived from the
 // golang net package documentation. Common values are "udp", "tcp" and "unix".
+// UNIX domain datagram sockets can be opened by using "unixgram://<path>".
+// Each datagram received on such a socket is treated as one message, i.e.
+// the partitioner is not used. The socket file is removed on shutdown.
 // By default this parameter is set to "tcp://0.0.0.0:5880".
 //
 // - Permissions: This value sets the filesystem permissions for UNIX domain
@@ -53,7 +57,8 @@ const (
 //
 // - Acknowledge: This value can be set to a non-empty value to inform the writer
 // that data has been accepted. On success, the given string is sent. Any error
-// will close the connection. Acknowledge does not work with UDP based sockets.
+// will close the connection. Acknowledge does not work with UDP or unixgram
+// based sockets.
 // By default this parameter is set to "".
 //
 // - Partitioner: This value defines the algorithm used to read messages from the
@@ -93,7 +98,7 @@ const (
 // By default this parameter is set to "2".
 //
 // - RemoveOldSocket: If set to true, any existing file with the same name as the
-// socket (unix://<path>) is removed prior to connecting.
+// socket (unix://<path> or unixgram://<path>) is removed prior to connecting.
 // By default this parameter is set to "true".
 //
 //
@@ -107,6 +112,14 @@ const (
 //    Partitioner: fixed
 //    Size: 256
 //
+// This example receives syslog-style datagrams on a local socket that is
+// writable for all users:
+//
+//  datagramIn:
+//    Type: consumer.Socket
+//    Address: unixgram:///var/run/gollum.sock
+//    Permissions: "0666"
+//
 type Socket struct {
 	sync.Mutex
 	core.SimpleConsumer `gollumdoc:"embed_type"`
@@ -131,14 +144,19 @@ func init() {
 
 // Configure initializes this consumer with values from a plugin config.
 func (cons *Socket) Configure(conf core.PluginConfigReader) {
-	if len(cons.acknowledge) > 0 && cons.protocol == "udp" {
-		conf.Errors.Pushf("UDP sockets do not support acknowledgment.")
-	}
-
 	address := conf.GetString("Address", "tcp://0.0.0.0:5880")
 	cons.protocol, cons.address = tnet.ParseAddress(address, "tcp")
 	cons.flags = 0
 
+	if len(cons.acknowledge) > 0 {
+		switch cons.protocol {
+		case "udp":
+			conf.Errors.Pushf("UDP sockets do not support acknowledgment.")
+		case "unixgram":
+			conf.Errors.Pushf("Unixgram sockets do not support acknowledgment.")
+		}
+	}
+
 	partitioner := conf.GetString("Partitioner", "delimiter")
 	switch strings.ToLower(partitioner) {
 	case "binary_be":
@@ -206,6 +224,71 @@ func (cons *Socket) listenUDP() {
 	}
 }
 
+func (cons *Socket) listenUnixgram() {
+	defer cons.WorkerDone()
+
+	addr := &net.UnixAddr{Name: cons.address, Net: cons.protocol}
+	buffer := make([]byte, socketMaxDatagramSize)
+
+	for cons.IsActive() {
+		// (re)open the socket
+		var socket *net.UnixConn
+		for cons.listener == nil {
+			if !cons.IsActive() {
+				return // return, abort
+			}
+
+			var err error
+			socket, err = net.ListenUnixgram(cons.protocol, addr)
+			if err == nil {
+				if err = os.Chmod(cons.address, cons.fileFlags); err != nil {
+					socket.Close()
+					os.Remove(cons.address)
+				}
+			}
+
+			if err == nil {
+				cons.setListener(socket)
+				cons.Logger.Debugf("Listening to %s", cons.address)
+				break // break, listening
+			}
+
+			cons.Logger.WithError(err).Errorf("Failed to listen to %s", cons.address)
+			if cons.clearSocket {
+				cons.tryRemoveUnixSocket()
+			}
+			time.Sleep(cons.reconnectTime)
+		}
+
+		cons.readDatagrams(socket, buffer)
+		cons.closeListener()
+	}
+}
+
+func (cons *Socket) readDatagrams(socket *net.UnixConn, buffer []byte) {
+	for cons.IsActive() {
+		// Time out in regular intervals so we can stop the loop on shutdown
+		socket.SetReadDeadline(time.Now().Add(cons.readTimeout))
+		size, _, err := socket.ReadFrom(buffer)
+		if err != nil {
+			netErr, isNetErr := err.(net.Error)
+			switch {
+			case !cons.IsActive():
+				return // return, shutdown
+
+			case isNetErr && netErr.Timeout():
+				continue
+
+			default:
+				cons.Logger.WithError(err).Errorf("Failed to read from %s", cons.address)
+				return // return, reopen socket
+			}
+		}
+
+		cons.Enqueue(buffer[:size])
+	}
+}
+
 func (cons *Socket) listen() {
 	defer cons.WorkerDone()
 
@@ -321,6 +404,12 @@ func (cons *Socket) sendACK(conn net.Conn) error {
 	return err
 }
 
+func (cons *Socket) setListener(listener io.Closer) {
+	cons.Lock()
+	defer cons.Unlock()
+	cons.listener = listener
+}
+
 func (cons *Socket) closeListener() {
 	cons.Lock()
 	defer cons.Unlock()
@@ -331,6 +420,13 @@ func (cons *Socket) closeListener() {
 	cons.Logger.Debugf("Closing socket %s", cons.address)
 	cons.listener.Close()
 	cons.listener = nil
+
+	// Datagram sockets do not remove their socket file when being closed
+	if cons.protocol == "unixgram" {
+		if err := os.Remove(cons.address); err != nil && !os.IsNotExist(err) {
+			cons.Logger.WithError(err).Errorf("Failed to remove %s", cons.address)
+		}
+	}
 }
 
 func (cons *Socket) tryRemoveUnixSocket() {
@@ -358,9 +454,12 @@ func (cons *Socket) Consume(workers *sync.WaitGroup) {
 	cons.AddMainWorker(workers)
 	defer cons.closeListener()
 
-	if cons.protocol == "udp" {
+	switch cons.protocol {
+	case "udp":
 		go tgo.WithRecoverShutdown(cons.listenUDP)
-	} else {
+	case "unixgram":
+		go tgo.WithRecoverShutdown(cons.listenUnixgram)
+	default:
 		go tgo.WithRecoverShutdown(cons.listen)
 	}
 
@@ -0,0 +1,135 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package consumer
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+// startUnixgramSocket starts a socket consumer on the given path and waits
+// for the socket to become available. The returned function stops the
+// consumer.
+func startUnixgramSocket(t *testing.T, path string) (stop func()) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.Socket")
+	config.Override("Streams", t.Name())
+	config.Override("Address", "unixgram://"+path)
+	config.Override("Permissions", "0660")
+	config.Override("ReconnectAfterSec", 0)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*Socket)
+	expect.True(casted)
+
+	workers := new(sync.WaitGroup)
+	go cons.Consume(workers)
+
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(10 * time.Millisecond) {
+		if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			break
+		}
+	}
+
+	return func() {
+		cons.Control() <- core.PluginControlStopConsumer
+		workers.Wait()
+	}
+}
+
+func sendDatagrams(t *testing.T, path string, datagrams ...string) {
+	expect := ttesting.NewExpect(t)
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	expect.NoError(err)
+	defer conn.Close()
+
+	for _, datagram := range datagrams {
+		_, err := conn.Write([]byte(datagram))
+		expect.NoError(err)
+	}
+}
+
+func TestSocketUnixgram(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-socket")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "gollum.sock")
+	router := newMockRouter(t.Name(), 4)
+	stop := startUnixgramSocket(t, path)
+
+	info, err := os.Stat(path)
+	expect.NoError(err)
+	expect.Equal(os.FileMode(0660), info.Mode().Perm())
+
+	// Each datagram is one message, delimiters are not evaluated
+	sendDatagrams(t, path, "first\nline", "second")
+	messages := router.receive(t, 2)
+	expect.Equal("first\nline", messages[0].String())
+	expect.Equal("second", messages[1].String())
+
+	stop()
+	_, err = os.Stat(path)
+	expect.True(os.IsNotExist(err))
+}
+
+func TestSocketUnixgramRemoveOldSocket(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-socket")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	// Simulate a socket file left behind by a crashed instance
+	path := filepath.Join(dir, "gollum.sock")
+	expect.NoError(ioutil.WriteFile(path, []byte{}, 0644))
+
+	router := newMockRouter(t.Name(), 1)
+	stop := startUnixgramSocket(t, path)
+	defer stop()
+
+	info, err := os.Stat(path)
+	expect.NoError(err)
+	expect.Equal(os.FileMode(0660), info.Mode().Perm())
+
+	sendDatagrams(t, path, "message")
+	expect.Equal("message", router.receive(t, 1)[0].String())
+}
+
+func TestSocketUnixgramAcknowledge(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.Socket")
+	config.Override("Address", "unixgram:///tmp/gollum.sock")
+	config.Override("Acknowledge", "OK")
+
+	_, err := core.NewPluginWithConfig(config)
+	expect.NotNil(err)
+}
@@ -15,6 +15,7 @@
 package consumer
 
 import (
+	"net"
 	"os"
 	"strings"
 	"sync"
@@ -47,12 +48,14 @@ import (
 // By default this parameter is set to "udp://0.0.0.0:514"
 //
 // - Format: Defines which syslog standard the server will support.
-// Three standards, listed below, are currently available.  All
-// standards support listening to UDP and UNIX domain sockets.
-// RFC6587 additionally supports TCP sockets. Default: "RFC6587".
+// The standards listed below are currently available. All standards support
+// listening to UDP and UNIX domain sockets. RFC6587 and Auto additionally
+// support TCP sockets. The value is not case sensitive.
 // * RFC3164 (https://tools.ietf.org/html/rfc3164) - unix, udp
 // * RFC5424 (https://tools.ietf.org/html/rfc5424) - unix, udp
 // * RFC6587 (https://tools.ietf.org/html/rfc6587) - unix, upd, tcp
+// * Auto - unix, udp, tcp. Detects RFC3164 or RFC5424 messages as well as
+// octet-counting or non-transparent framing for every message.
 // By default this parameter is set to "RFC6587".
 //
 // - Permissions: This value sets the filesystem permissions
@@ -64,7 +67,11 @@ import (
 // the message. The metadata fields added depend on the protocol version used.
 // RFC3164 supports: tag, timestamp, hostname, priority, facility, severity.
 // RFC5424 and RFC6587 support: app_name, version, proc_id , msg_id, timestamp,
-// hostname, priority, facility, severity.
+// hostname, priority, facility, severity, structured_data. Every parameter of
+// the structured data elements is added as a metadata field, too.
+// When using Auto, the fields depend on the format of each message.
+// Messages that cannot be parsed are sent as-is and the metadata field
+// "malformed" is set to true, regardless of this setting.
 // By default this parameter is set to "false".
 //
 // - TimestampFormat: When using SetMetadata this string denotes the go time
@@ -89,9 +96,18 @@ import (
 //    Address: "tcp://0.0.0.0:5599"
 //    Format: "RFC6587"
 //
+// Accept any kind of syslog message on a TCP socket
+//
+//  SyslogdAutoConsumer:
+//    Type: consumer.Syslogd
+//    Streams: "tcp_syslog"
+//    Address: "tcp://0.0.0.0:5599"
+//    Format: "Auto"
+//    SetMetadata: true
+//
 type Syslogd struct {
 	core.SimpleConsumer `gollumdoc:"embed_type"`
-	format              format.Format // RFC3164, RFC5424 or RFC6587?
+	format              format.Format // RFC3164, RFC5424, RFC6587 or Automatic?
 	protocol            string
 	address             string
 	withMetadata        bool        `config:"SetMetadata" default:"false"`
@@ -116,7 +132,7 @@ func (cons *Syslogd) Configure(conf core.PluginConfigReader) {
 		conf.Errors.Pushf("Unknown protocol type %s", cons.protocol) // ### return, unknown protocol ###
 	}
 
-	switch syslogFormat {
+	switch strings.ToUpper(syslogFormat) {
 	// http://www.ietf.org/rfc/rfc3164.txt
 	case "RFC3164":
 		cons.format = syslog.RFC3164
@@ -135,11 +151,39 @@ func (cons *Syslogd) Configure(conf core.PluginConfigReader) {
 	case "RFC6587":
 		cons.format = syslog.RFC6587
 
+	case "AUTO", "AUTOMATIC":
+		cons.format = syslog.Automatic
+
 	default:
 		conf.Errors.Pushf("Format %s is not supported", syslogFormat)
 	}
 }
 
+// syslogRawFormat wraps a syslog format so that the unparsed line is passed
+// to Handle as "raw" part. This allows to forward messages that could not be
+// parsed.
+type syslogRawFormat struct {
+	format.Format
+}
+
+type syslogRawParser struct {
+	format.LogParser
+	line []byte
+}
+
+func (f syslogRawFormat) GetParser(line []byte) format.LogParser {
+	return syslogRawParser{
+		LogParser: f.Format.GetParser(line),
+		line:      line,
+	}
+}
+
+func (p syslogRawParser) Dump() format.LogParts {
+	parts := p.LogParser.Dump()
+	parts["raw"] = p.line
+	return parts
+}
+
 func parseCustomFields(data string, metadata *tcontainer.MarshalMap) {
 	if len(data) == 0 {
 		return
@@ -208,12 +252,23 @@ func parseCustomFields(data string, metadata *tcontainer.MarshalMap) {
 
 // Handle implements the syslog handle interface
 func (cons *Syslogd) Handle(parts format.LogParts, code int64, err error) {
+	if err != nil {
+		raw, _ := parts["raw"].([]byte)
+		cons.Logger.WithError(err).Debug("Failed to parse syslog message")
+
+		metaData := core.NewMetadata()
+		metaData.Set("malformed", true)
+		cons.EnqueueWithMetadata(raw, metaData)
+		return // ### return, malformed message ###
+	}
+
 	content := ""
 	isString := false
 	metaData := core.NewMetadata()
 
-	switch cons.format {
-	case syslog.RFC3164:
+	// The parts depend on the parser used. For syslog.Automatic this can
+	// change with every message.
+	if _, isRFC3164 := parts["content"]; isRFC3164 {
 		content, isString = parts["content"].(string)
 
 		if cons.withMetadata {
@@ -224,6 +279,15 @@ func (cons *Syslogd) Handle(parts format.LogParts, code int64, err error) {
 			severity, _ := parts["severity"].(int)
 			timestamp, _ := parts["timestamp"].(time.Time)
 
+			// RFC3164 allows to omit the hostname
+			if client, _ := parts["client"].(string); hostname == "" && client != "" {
+				if host, _, err := net.SplitHostPort(client); err == nil {
+					hostname = host
+				} else {
+					hostname = client
+				}
+			}
+
 			metaData.Set("tag", tag)
 			metaData.Set("timestamp", timestamp.Format(cons.timestampFormat))
 
@@ -232,14 +296,13 @@ func (cons *Syslogd) Handle(parts format.LogParts, code int64, err error) {
 			metaData.Set("facility", facility)
 			metaData.Set("severity", severity)
 		}
-
-	case syslog.RFC5424, syslog.RFC6587:
+	} else {
 		content, isString = parts["message"].(string)
 
 		if cons.withMetadata {
 			hostname, _ := parts["hostname"].(string)
 			app, _ := parts["app_name"].(string)
-			version, _ := parts["version"].(string)
+			version, _ := parts["version"].(int)
 			procID, _ := parts["proc_id"].(string)
 			msgID, _ := parts["msg_id"].(string)
 			priority, _ := parts["priority"].(int)
@@ -263,9 +326,6 @@ func (cons *Syslogd) Handle(parts format.LogParts, code int64, err error) {
 			metaData.Set("facility", facility)
 			metaData.Set("severity", severity)
 		}
-
-	default:
-		cons.Logger.Error("Could not determine the format to retrieve message/content")
 	}
 
 	if !isString {
@@ -284,7 +344,7 @@ func (cons *Syslogd) Handle(parts format.LogParts, code int64, err error) {
 // Messages are expected to be separated by \n.
 func (cons *Syslogd) Consume(workers *sync.WaitGroup) {
 	server := syslog.NewServer()
-	server.SetFormat(cons.format)
+	server.SetFormat(syslogRawFormat{cons.format})
 	server.SetHandler(cons)
 
 	switch cons.protocol {
@@ -15,12 +15,31 @@
 package consumer
 
 import (
+	"fmt"
+	"net"
+	"sync"
 	"testing"
+	"time"
+
+	"gollum/core"
 
 	"github.com/trivago/tgo/tcontainer"
 	"github.com/trivago/tgo/ttesting"
 )
 
+const (
+	syslogSampleRFC5424 = `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"] An application event log entry`
+	syslogSampleRFC3164 = `<34>Oct 11 22:14:15 mymachine su: 'su root' failed for lonvick on /dev/pts/8`
+)
+
+// handleSyslogLine passes a single frame to the consumer like the syslog
+// server does.
+func handleSyslogLine(cons *Syslogd, line string) {
+	parser := syslogRawFormat{cons.format}.GetParser([]byte(line))
+	err := parser.Parse()
+	cons.Handle(parser.Dump(), int64(len(line)), err)
+}
+
 func TestSyslogStructuredDataParser(t *testing.T) {
 	expect := ttesting.NewExpect(t)
 
@@ -39,3 +58,139 @@ func TestSyslogStructuredDataParser(t *testing.T) {
 	expect.MapEqual(metadata, "key", "value")
 	expect.MapEqual(metadata, "key2", "value")
 }
+
+func TestSyslogdRFC5424Metadata(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	router := newMockRouter(t.Name(), 1)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.Syslogd")
+	config.Override("Streams", t.Name())
+	config.Override("Format", "rfc5424")
+	config.Override("SetMetadata", true)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*Syslogd)
+	expect.True(casted)
+
+	handleSyslogLine(cons, syslogSampleRFC5424)
+	msg := router.receive(t, 1)[0]
+	expect.Equal("An application event log entry", msg.String())
+
+	metadata := msg.GetMetadata()
+	expect.MapEqual(metadata, "hostname", "mymachine.example.com")
+	expect.MapEqual(metadata, "app_name", "evntslog")
+	expect.MapEqual(metadata, "proc_id", "-")
+	expect.MapEqual(metadata, "msg_id", "ID47")
+	expect.MapEqual(metadata, "version", 1)
+	expect.MapEqual(metadata, "priority", 165)
+	expect.MapEqual(metadata, "facility", 20)
+	expect.MapEqual(metadata, "severity", 5)
+	expect.MapEqual(metadata, "iut", "3")
+	expect.MapEqual(metadata, "eventSource", "Application")
+	expect.MapEqual(metadata, "eventID", "1011")
+	expect.MapEqual(metadata, "timestamp", "2003-10-11T22:14:15.003 UTC")
+
+	_, malformed := metadata.Value("malformed")
+	expect.False(malformed)
+}
+
+func TestSyslogdAutoFormat(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	router := newMockRouter(t.Name(), 2)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.Syslogd")
+	config.Override("Streams", t.Name())
+	config.Override("Format", "Auto")
+	config.Override("SetMetadata", true)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*Syslogd)
+	expect.True(casted)
+
+	handleSyslogLine(cons, syslogSampleRFC3164)
+	handleSyslogLine(cons, syslogSampleRFC5424)
+	messages := router.receive(t, 2)
+
+	expect.Equal("'su root' failed for lonvick on /dev/pts/8", messages[0].String())
+	expect.MapEqual(messages[0].GetMetadata(), "tag", "su")
+	expect.MapEqual(messages[0].GetMetadata(), "hostname", "mymachine")
+	expect.MapEqual(messages[0].GetMetadata(), "priority", 34)
+
+	expect.Equal("An application event log entry", messages[1].String())
+	expect.MapEqual(messages[1].GetMetadata(), "app_name", "evntslog")
+}
+
+func TestSyslogdMalformed(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	router := newMockRouter(t.Name(), 1)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.Syslogd")
+	config.Override("Streams", t.Name())
+	config.Override("Format", "RFC5424")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*Syslogd)
+	expect.True(casted)
+
+	handleSyslogLine(cons, "not a syslog message")
+	msg := router.receive(t, 1)[0]
+
+	expect.Equal("not a syslog message", msg.String())
+	expect.MapEqual(msg.GetMetadata(), "malformed", true)
+}
+
+func TestSyslogdFraming(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	// Reserve a free port for the server
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	expect.NoError(err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	router := newMockRouter(t.Name(), 3)
+
+	config := core.NewPluginConfig(t.Name(), "consumer.Syslogd")
+	config.Override("Streams", t.Name())
+	config.Override("Address", "tcp://"+address)
+	config.Override("Format", "auto")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*Syslogd)
+	expect.True(casted)
+
+	workers := new(sync.WaitGroup)
+	go cons.Consume(workers)
+	defer func() {
+		cons.Control() <- core.PluginControlStopConsumer
+		workers.Wait()
+	}()
+
+	var conn net.Conn
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(10 * time.Millisecond) {
+		if conn, err = net.Dial("tcp", address); err == nil {
+			break
+		}
+	}
+	expect.NoError(err)
+	defer conn.Close()
+
+	// Octet-counting framing as defined by RFC6587 section 3.4.1
+	fmt.Fprintf(conn, "%d %s", len(syslogSampleRFC5424), syslogSampleRFC5424)
+	// Non-transparent framing as defined by RFC6587 section 3.4.2
+	fmt.Fprintf(conn, "%s\n", syslogSampleRFC3164)
+	fmt.Fprintf(conn, "%d %s", len(syslogSampleRFC3164), syslogSampleRFC3164)
+
+	messages := router.receive(t, 3)
+	expect.Equal("An application event log entry", messages[0].String())
+	expect.Equal("'su root' failed for lonvick on /dev/pts/8", messages[1].String())
+	expect.Equal("'su root' failed for lonvick on /dev/pts/8", messages[2].String())
+}
@@ -0,0 +1,266 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build linux,cgo,!unit
+
+package native
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"gollum/core"
+
+	"github.com/coreos/go-systemd/sdjournal"
+	"github.com/trivago/tgo"
+)
+
+// Journal consumer plugin
+//
+// NOTICE: This consumer is not included in standard builds. To enable it
+// you need to trigger a custom build with native plugins enabled.
+// The journal consumer reads entries from the systemd journal via
+// sd-journal and enqueues the MESSAGE field of each entry as payload. The
+// cursor of the last enqueued entry can be stored in a file so that reading
+// continues after the last entry when gollum is restarted.
+//
+// Metadata
+//
+// *NOTE: The metadata will only set if the parameter `SetMetadata` is active.*
+//
+// Each field listed in Fields is stored in lower case without leading
+// underscores, e.g. "_SYSTEMD_UNIT" is stored as "systemd_unit". Fields not
+// present in an entry are not set.
+//
+// - cursor: Contains the journal cursor of the entry
+//
+// Parameters
+//
+// - Units: Defines a list of systemd units to read entries from. If empty,
+// entries of all units are read.
+// By default this parameter is set to an empty list.
+//
+// - Matches: Defines a list of additional journal matches in the form
+// "FIELD=value". Matches for different fields must all apply, matches for
+// the same field are alternatives, as are the entries of Units.
+// By default this parameter is set to an empty list.
+//
+// - DefaultOffset: Defines where to start reading if no cursor has been
+// stored. Valid values are "oldest" and "newest".
+// By default this parameter is set to "newest".
+//
+// - CursorFile: Defines the path to a file storing the cursor of the last
+// enqueued entry. If the file exists, reading continues after that entry and
+// DefaultOffset is ignored. Set this parameter to "" to disable the file.
+// By default this parameter is set to "".
+//
+// - CursorSyncIntervalMs: Defines the minimum time in milliseconds between
+// two writes of CursorFile. The cursor is always written on shutdown.
+// By default this parameter is set to 1000.
+//
+// - Fields: Defines the journal fields copied to the metadata.
+// By default this parameter is set to "_SYSTEMD_UNIT", "PRIORITY",
+// "_HOSTNAME", "SYSLOG_IDENTIFIER" and "_PID".
+//
+// - SetMetadata: When this value is set to "true", the fields mentioned in
+// the metadata section will be added to each message.
+// By default this parameter is set to "false".
+//
+// Examples
+//
+// This example reads all entries of sshd and nginx with a priority of
+// "err" and keeps track of the last entry read.
+//
+//  JournalIn:
+//    Type: native.Journal
+//    Streams: journal
+//    Units:
+//      - sshd.service
+//      - nginx.service
+//    Matches:
+//      - "PRIORITY=3"
+//    CursorFile: /var/lib/gollum/journal.cursor
+//    SetMetadata: true
+type Journal struct {
+	core.SimpleConsumer `gollumdoc:"embed_type"`
+	units               []string      `config:"Units"`
+	matches             []string      `config:"Matches"`
+	defaultOffset       string        `config:"DefaultOffset" default:"newest"`
+	cursorFileName      string        `config:"CursorFile"`
+	cursorSyncInterval  time.Duration `config:"CursorSyncIntervalMs" default:"1000" metric:"ms"`
+	fields              []string      `config:"Fields" default:"_SYSTEMD_UNIT,PRIORITY,_HOSTNAME,SYSLOG_IDENTIFIER,_PID"`
+	hasToSetMetadata    bool          `config:"SetMetadata" default:"false"`
+	journal             *sdjournal.Journal
+	cursorFile          *journalCursorFile
+}
+
+func init() {
+	core.TypeRegistry.Register(Journal{})
+}
+
+// Configure initializes this consumer with values from a plugin config.
+func (cons *Journal) Configure(conf core.PluginConfigReader) {
+	cons.defaultOffset = strings.ToLower(cons.defaultOffset)
+	if cons.defaultOffset != sdOffsetHead && cons.defaultOffset != sdOffsetTail {
+		conf.Errors.Pushf("DefaultOffset must be either %s or %s", sdOffsetHead, sdOffsetTail)
+	}
+
+	for _, match := range cons.matches {
+		if !strings.Contains(match, "=") {
+			conf.Errors.Pushf("Match '%s' must be of the form FIELD=value", match)
+		}
+	}
+
+	if cons.cursorFileName != "" {
+		cons.cursorFile = newJournalCursorFile(cons.cursorFileName, cons.cursorSyncInterval)
+	}
+}
+
+// open opens the journal, applies all matches and seeks to the first entry
+// to read.
+func (cons *Journal) open() error {
+	journal, err := sdjournal.NewJournal()
+	if err != nil {
+		return err
+	}
+	cons.journal = journal
+
+	for _, unit := range cons.units {
+		if err := journal.AddMatch("_SYSTEMD_UNIT=" + unit); err != nil {
+			return err
+		}
+	}
+	for _, match := range cons.matches {
+		if err := journal.AddMatch(match); err != nil {
+			return err
+		}
+	}
+
+	if cons.cursorFile != nil {
+		cursor, err := cons.cursorFile.load()
+		if err != nil {
+			cons.Logger.WithError(err).Errorf("Failed to read cursor file %s", cons.cursorFileName)
+		} else if cursor != "" {
+			return cons.seekCursor(cursor)
+		}
+	}
+
+	if cons.defaultOffset == sdOffsetHead {
+		return journal.SeekHead()
+	}
+
+	if err := journal.SeekTail(); err != nil {
+		return err
+	}
+	// The tail is positioned after the last entry, so step back to it. The
+	// first call to Next will move past it.
+	_, err = journal.Previous()
+	return err
+}
+
+// seekCursor moves the journal to the entry stored in cursor. The entry
+// itself has already been enqueued, so it is skipped.
+func (cons *Journal) seekCursor(cursor string) error {
+	if err := cons.journal.SeekCursor(cursor); err != nil {
+		return err
+	}
+	if _, err := cons.journal.Next(); err != nil {
+		return err
+	}
+	if err := cons.journal.TestCursor(cursor); err != nil {
+		// The entry does not exist anymore, e.g. after rotation. Go back so
+		// the entry the journal is positioned at is not skipped.
+		cons.Logger.Warning("Stored cursor not found, continuing at the nearest entry")
+		_, err = cons.journal.Previous()
+		return err
+	}
+	return nil
+}
+
+// enqueueEntry enqueues the MESSAGE field of the given entry.
+func (cons *Journal) enqueueEntry(entry *sdjournal.JournalEntry) {
+	payload := []byte(entry.Fields[sdjournal.SD_JOURNAL_FIELD_MESSAGE])
+
+	if cons.hasToSetMetadata {
+		metaData := core.NewMetadata()
+		metaData.Set("cursor", entry.Cursor)
+		for _, field := range cons.fields {
+			if value, exists := entry.Fields[field]; exists {
+				metaData.Set(getJournalMetadataKey(field), value)
+			}
+		}
+		cons.EnqueueWithMetadata(payload, metaData)
+	} else {
+		cons.Enqueue(payload)
+	}
+
+	if cons.cursorFile != nil {
+		if err := cons.cursorFile.update(entry.Cursor); err != nil {
+			cons.Logger.WithError(err).Errorf("Failed to write cursor file %s", cons.cursorFileName)
+		}
+	}
+}
+
+func (cons *Journal) read() {
+	defer cons.WorkerDone()
+	defer cons.close()
+
+	if err := cons.open(); err != nil {
+		cons.Logger.WithError(err).Error("Failed to open journal")
+		return // ### return, journal not available ###
+	}
+
+	for cons.IsActive() {
+		count, err := cons.journal.Next()
+		if err != nil {
+			cons.Logger.WithError(err).Error("Failed to advance journal")
+			time.Sleep(time.Second)
+			continue // ### continue, try again ###
+		}
+
+		if count == 0 {
+			cons.journal.Wait(time.Second)
+			continue // ### continue, reached end of journal ###
+		}
+
+		entry, err := cons.journal.GetEntry()
+		if err != nil {
+			cons.Logger.WithError(err).Error("Failed to read journal entry")
+			continue // ### continue, skip entry ###
+		}
+		cons.enqueueEntry(entry)
+	}
+}
+
+// close stores the cursor of the last enqueued entry and closes the journal.
+// It is called by the reading go routine so the cursor is never accessed
+// concurrently.
+func (cons *Journal) close() {
+	if cons.cursorFile != nil {
+		if err := cons.cursorFile.flush(); err != nil {
+			cons.Logger.WithError(err).Errorf("Failed to write cursor file %s", cons.cursorFileName)
+		}
+	}
+	if cons.journal != nil {
+		cons.journal.Close()
+	}
+}
+
+// Consume starts reading from the journal.
+func (cons *Journal) Consume(workers *sync.WaitGroup) {
+	cons.AddMainWorker(workers)
+	go tgo.WithRecoverShutdown(cons.read)
+	cons.ControlLoop()
+}
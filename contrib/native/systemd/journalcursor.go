@@ -0,0 +1,102 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package native
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// journalCursorFile stores the cursor of the last journal entry that has
+// been enqueued. Writes are throttled to syncInterval, flush always writes
+// the most recent cursor.
+type journalCursorFile struct {
+	path         string
+	syncInterval time.Duration
+	cursor       string
+	stored       string
+	lastSync     time.Time
+}
+
+func newJournalCursorFile(path string, syncInterval time.Duration) *journalCursorFile {
+	return &journalCursorFile{
+		path:         path,
+		syncInterval: syncInterval,
+	}
+}
+
+// load returns the stored cursor. An empty string is returned if no cursor
+// has been stored yet.
+func (file *journalCursorFile) load() (string, error) {
+	data, err := ioutil.ReadFile(file.path)
+	if os.IsNotExist(err) {
+		return "", nil // ### return, nothing stored yet ###
+	}
+	if err != nil {
+		return "", err
+	}
+
+	file.stored = strings.TrimSpace(string(data))
+	file.cursor = file.stored
+	return file.cursor, nil
+}
+
+// update sets the current cursor and writes it if the last write is at least
+// syncInterval ago.
+func (file *journalCursorFile) update(cursor string) error {
+	file.cursor = cursor
+	if time.Since(file.lastSync) < file.syncInterval {
+		return nil // ### return, written recently ###
+	}
+	return file.flush()
+}
+
+// flush writes the current cursor if it has changed since the last write.
+// The file is replaced atomically so a crash never leaves a partial cursor.
+func (file *journalCursorFile) flush() error {
+	if file.cursor == file.stored {
+		return nil // ### return, nothing to do ###
+	}
+
+	tmpFile, err := ioutil.TempFile(filepath.Dir(file.path), filepath.Base(file.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err := tmpFile.WriteString(file.cursor); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFile.Name(), file.path); err != nil {
+		return err
+	}
+
+	file.stored = file.cursor
+	file.lastSync = time.Now()
+	return nil
+}
+
+// getJournalMetadataKey converts a journal field name like "_SYSTEMD_UNIT"
+// into a metadata key like "systemd_unit".
+func getJournalMetadataKey(field string) string {
+	return strings.ToLower(strings.TrimLeft(field, "_"))
+}
@@ -0,0 +1,95 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package native
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestJournalCursorFile(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-journal")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "journal.cursor")
+	file := newJournalCursorFile(path, time.Hour)
+
+	// A missing file is not an error
+	cursor, err := file.load()
+	expect.NoError(err)
+	expect.Equal("", cursor)
+
+	// The first update is written immediately
+	expect.NoError(file.update("s=1;i=1"))
+	data, err := ioutil.ReadFile(path)
+	expect.NoError(err)
+	expect.Equal("s=1;i=1", string(data))
+
+	// Following updates are throttled until flush is called
+	expect.NoError(file.update("s=1;i=2"))
+	data, _ = ioutil.ReadFile(path)
+	expect.Equal("s=1;i=1", string(data))
+
+	expect.NoError(file.flush())
+	data, _ = ioutil.ReadFile(path)
+	expect.Equal("s=1;i=2", string(data))
+
+	// No temporary files are left behind
+	entries, err := ioutil.ReadDir(dir)
+	expect.NoError(err)
+	expect.Equal(1, len(entries))
+
+	// A restarted consumer continues at the stored cursor
+	restarted := newJournalCursorFile(path, 0)
+	cursor, err = restarted.load()
+	expect.NoError(err)
+	expect.Equal("s=1;i=2", cursor)
+
+	expect.NoError(restarted.update("s=1;i=3"))
+	cursor, err = newJournalCursorFile(path, 0).load()
+	expect.NoError(err)
+	expect.Equal("s=1;i=3", cursor)
+}
+
+func TestJournalCursorFileError(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-journal")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	file := newJournalCursorFile(filepath.Join(dir, "missing", "journal.cursor"), 0)
+	expect.NotNil(file.update("s=1;i=1"))
+
+	// The cursor is written as soon as the directory exists
+	expect.NoError(os.Mkdir(filepath.Join(dir, "missing"), 0755))
+	expect.NoError(file.flush())
+}
+
+func TestJournalMetadataKey(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	expect.Equal("systemd_unit", getJournalMetadataKey("_SYSTEMD_UNIT"))
+	expect.Equal("priority", getJournalMetadataKey("PRIORITY"))
+	expect.Equal("source_realtime_timestamp", getJournalMetadataKey("_SOURCE_REALTIME_TIMESTAMP"))
+}
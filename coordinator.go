@@ -15,6 +15,7 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"os/signal"
 	"reflect"
@@ -26,6 +27,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"github.com/trivago/tgo"
+	"github.com/trivago/tgo/thealthcheck"
 )
 
 const (
@@ -45,9 +47,20 @@ const (
 	signalRoll = signalType(iota)
 )
 
+// shutdownReportInterval defines how often plugins that did not stop yet are
+// logged during shutdown.
+const shutdownReportInterval = time.Second
+
 type coordinatorState byte
 type signalType byte
 
+// dialResult stores the result of a PluginWithDial.Dial call
+type dialResult struct {
+	pluginID string
+	typename string
+	err      error
+}
+
 // Coordinator is the main gollum instance taking care of starting and stopping
 // plugins.
 type Coordinator struct {
@@ -59,6 +72,8 @@ type Coordinator struct {
 	logConsumer    *core.LogConsumer
 	state          coordinatorState
 	signal         chan os.Signal
+	config         *core.Config
+	configFile     string
 }
 
 // NewCoordinator creates a new multplexer
@@ -105,9 +120,42 @@ func (co *Coordinator) Configure(conf *core.Config) error {
 	// created beyond this point must use StreamRegistry.AddWildcardProducersToRouter.
 
 	core.StreamRegistry.AddAllWildcardProducersToAllRouters()
+	co.config = conf
 	return errors.OrNil()
 }
 
+// DialPlugins calls Dial on all configured producers and consumers that
+// implement core.PluginWithDial. Plugins without a backend are skipped.
+func (co *Coordinator) DialPlugins() []dialResult {
+	plugins := []core.Plugin{}
+	for _, producer := range co.producers {
+		plugins = append(plugins, producer)
+	}
+	for _, consumer := range co.consumers {
+		plugins = append(plugins, consumer)
+	}
+
+	results := []dialResult{}
+	for _, plugin := range plugins {
+		dialer, canDial := plugin.(core.PluginWithDial)
+		if !canDial {
+			continue // ### continue, no backend ###
+		}
+
+		result := dialResult{
+			typename: reflect.TypeOf(plugin).Elem().String(),
+		}
+		if pluginWithID, hasID := plugin.(core.PluginWithID); hasID {
+			result.pluginID = pluginWithID.GetID()
+		}
+
+		logrus.Debugf("Dialing backend of '%s'", result.pluginID)
+		result.err = dialer.Dial()
+		results = append(results, result)
+	}
+	return results
+}
+
 // StartPlugins starts all plugins in the correct order.
 func (co *Coordinator) StartPlugins() {
 	// Launch routers
@@ -121,11 +169,7 @@ func (co *Coordinator) StartPlugins() {
 	// Launch producers
 	co.state = coordinatorStateStartProducers
 	for _, producer := range co.producers {
-		producer := producer
-		go tgo.WithRecoverShutdown(func() {
-			logrus.Debug("Starting ", reflect.TypeOf(producer))
-			producer.Produce(co.producerWorker)
-		})
+		co.startProducer(producer)
 	}
 
 	// Set final log target and purge the intermediate buffer
@@ -145,16 +189,27 @@ func (co *Coordinator) StartPlugins() {
 	// Launch consumers
 	co.state = coordinatorStateStartConsumers
 	for _, consumer := range co.consumers {
-		consumer := consumer
-		go tgo.WithRecoverShutdown(func() {
-			logrus.Debug("Starting ", reflect.TypeOf(consumer))
-			consumer.Consume(co.consumerWorker)
-		})
+		co.startConsumer(consumer)
 	}
 }
 
+func (co *Coordinator) startProducer(producer core.Producer) {
+	go tgo.WithRecoverShutdown(func() {
+		logrus.Debug("Starting ", reflect.TypeOf(producer))
+		producer.Produce(co.producerWorker)
+	})
+}
+
+func (co *Coordinator) startConsumer(consumer core.Consumer) {
+	go tgo.WithRecoverShutdown(func() {
+		logrus.Debug("Starting ", reflect.TypeOf(consumer))
+		consumer.Consume(co.consumerWorker)
+	})
+}
+
 // Run is essentially the Coordinator main loop.
-// It listens for shutdown signals and updates global metrics
+// It listens for shutdown signals and updates global metrics.
+// A roll signal is passed to all plugins and triggers a config reload.
 func (co *Coordinator) Run() {
 	co.signal = newSignalHandler()
 	defer signal.Stop(co.signal)
@@ -175,6 +230,7 @@ func (co *Coordinator) Run() {
 			for _, producer := range co.producers {
 				producer.Control() <- core.PluginControlRoll
 			}
+			co.Reload()
 
 		default:
 		}
@@ -238,55 +294,68 @@ func (co *Coordinator) configureProducers(conf *core.Config) bool {
 	co.state = coordinatorStateStartProducers
 	allFine := true
 
-	// All producers are added to the wildcard stream so that consumers can send
-	// to all producers if required. The wildcard producer list is required
-	// to add producers listening to all routers to all streams that are used.
-	wildcardStream := core.StreamRegistry.GetRouterOrFallback(core.WildcardStreamID)
 	producerConfigs := conf.GetProducers()
-
 	for _, config := range producerConfigs {
-		if _, hasStreams := config.Settings.Value("Streams"); !hasStreams {
-			logrus.Errorf("Producer '%s' has no streams set", config.ID)
-			allFine = false
-			continue // ### continue ###
-		}
-
-		logrus.Debug("Instantiating ", config.ID)
-		plugin, err := core.NewPluginWithConfig(config)
+		producer, err := co.newProducer(config)
 		if err != nil {
 			logrus.WithError(err).Errorf("Failed to instantiate producer '%s'", config.ID)
 			allFine = false
 			continue // ### continue ###
 		}
 
-		producer, _ := plugin.(core.Producer)
 		co.producers = append(co.producers, producer)
-		core.MetricProducers.Inc(1)
-
-		// Attach producer to streams
-		streams := producer.Streams()
-		for _, streamID := range streams {
-			if streamID == core.WildcardStreamID {
-				core.StreamRegistry.RegisterWildcardProducer(producer)
-			} else {
-				router := core.StreamRegistry.GetRouterOrFallback(streamID)
-				router.AddProducer(producer)
-			}
-		}
+		co.attachProducer(producer)
+	}
 
-		// Add producer to wildcard stream unless it only listens to internal streams
-	searchinternal:
-		for _, streamID := range streams {
-			switch streamID {
-			case core.LogInternalStreamID:
-			default:
-				wildcardStream.AddProducer(producer)
-				break searchinternal
-			}
+	return allFine
+}
+
+// newProducer instantiates a producer and registers its health check
+func (co *Coordinator) newProducer(config core.PluginConfig) (core.Producer, error) {
+	if _, hasStreams := config.Settings.Value("Streams"); !hasStreams {
+		return nil, fmt.Errorf("producer '%s' has no streams set", config.ID)
+	}
+
+	logrus.Debug("Instantiating ", config.ID)
+	plugin, err := core.NewPluginWithConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	producer, _ := plugin.(core.Producer)
+	core.MetricProducers.Inc(1)
+	addPluginHealthCheck(config.ID, producer.HealthCheck)
+	return producer, nil
+}
+
+// attachProducer adds a producer to all routers of its streams.
+func (co *Coordinator) attachProducer(producer core.Producer) {
+	// All producers are added to the wildcard stream so that consumers can send
+	// to all producers if required. The wildcard producer list is required
+	// to add producers listening to all routers to all streams that are used.
+	wildcardStream := core.StreamRegistry.GetRouterOrFallback(core.WildcardStreamID)
+
+	// Attach producer to streams
+	streams := producer.Streams()
+	for _, streamID := range streams {
+		if streamID == core.WildcardStreamID {
+			core.StreamRegistry.RegisterWildcardProducer(producer)
+		} else {
+			router := core.StreamRegistry.GetRouterOrFallback(streamID)
+			router.AddProducer(producer)
 		}
 	}
 
-	return allFine
+	// Add producer to wildcard stream unless it only listens to internal streams
+searchinternal:
+	for _, streamID := range streams {
+		switch streamID {
+		case core.LogInternalStreamID:
+		default:
+			wildcardStream.AddProducer(producer)
+			break searchinternal
+		}
+	}
 }
 
 func (co *Coordinator) configureConsumers(conf *core.Config) bool {
@@ -295,28 +364,37 @@ func (co *Coordinator) configureConsumers(conf *core.Config) bool {
 
 	consumerConfigs := conf.GetConsumers()
 	for _, config := range consumerConfigs {
-		if _, hasStreams := config.Settings.Value("Streams"); !hasStreams {
-			logrus.Errorf("Consumer '%s' has no streams set", config.ID)
-			allFine = false
-			continue
-		}
-
-		logrus.Debug("Instantiating ", config.ID)
-		plugin, err := core.NewPluginWithConfig(config)
+		consumer, err := co.newConsumer(config)
 		if err != nil {
-			logrus.WithError(err).Errorf("Failed to instantiate producer '%s'", config.ID)
+			logrus.WithError(err).Errorf("Failed to instantiate consumer '%s'", config.ID)
 			allFine = false
 			continue // ### continue ###
 		}
 
-		consumer, _ := plugin.(core.Consumer)
 		co.consumers = append(co.consumers, consumer)
-		core.MetricConsumers.Inc(1)
 	}
 
 	return allFine
 }
 
+// newConsumer instantiates a consumer and registers its health check
+func (co *Coordinator) newConsumer(config core.PluginConfig) (core.Consumer, error) {
+	if _, hasStreams := config.Settings.Value("Streams"); !hasStreams {
+		return nil, fmt.Errorf("consumer '%s' has no streams set", config.ID)
+	}
+
+	logrus.Debug("Instantiating ", config.ID)
+	plugin, err := core.NewPluginWithConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	consumer, _ := plugin.(core.Consumer)
+	core.MetricConsumers.Inc(1)
+	addPluginHealthCheck(config.ID, consumer.HealthCheck)
+	return consumer, nil
+}
+
 func (co *Coordinator) configureLogConsumer() bool {
 	config := core.NewPluginConfig("", "core.LogConsumer")
 	configReader := core.NewPluginConfigReader(&config)
@@ -330,6 +408,11 @@ func (co *Coordinator) configureLogConsumer() bool {
 	return false
 }
 
+// addPluginHealthCheck serves the health check of a plugin at "/<plugin_id>".
+func addPluginHealthCheck(pluginID string, callback thealthcheck.CallbackFunc) {
+	core.AddHealthCheckEndpoint("/"+pluginID, callback)
+}
+
 func (co *Coordinator) shutdownConsumers(stateAtShutdown coordinatorState) {
 	if stateAtShutdown >= coordinatorStateStartConsumers {
 		co.state = coordinatorStateStopConsumers
@@ -355,7 +438,14 @@ func (co *Coordinator) shutdownConsumers(stateAtShutdown coordinatorState) {
 			// No logs in _GOLLUM_ after this point
 		}
 
-		if !tgo.ReturnAfter(waitTimeout, co.consumerWorker.Wait) {
+		plugins := make([]core.PluginWithWorkers, 0, len(co.consumers))
+		for _, cons := range co.consumers {
+			if plugin, hasWorkers := cons.(core.PluginWithWorkers); hasWorkers {
+				plugins = append(plugins, plugin)
+			}
+		}
+
+		if !co.waitForShutdown("consumers", plugins, waitTimeout, co.consumerWorker.Wait) {
 			logrus.Error("At least one consumer found to be blocking.")
 		}
 	}
@@ -377,8 +467,26 @@ func (co *Coordinator) shutdownProducers(stateAtShutdown coordinatorState) {
 
 		waitTimeout *= 10
 		logrus.Debugf("Waiting for producers to stop. Forced shutdown after %.2f seconds.", waitTimeout.Seconds())
-		if !tgo.ReturnAfter(waitTimeout, co.producerWorker.Wait) {
+		plugins := make([]core.PluginWithWorkers, 0, len(co.producers))
+		for _, prod := range co.producers {
+			if plugin, hasWorkers := prod.(core.PluginWithWorkers); hasWorkers {
+				plugins = append(plugins, plugin)
+			}
+		}
+
+		if !co.waitForShutdown("producers", plugins, waitTimeout, co.producerWorker.Wait) {
 			logrus.Error("At least one producer found to be blocking.")
 		}
 	}
 }
+
+// waitForShutdown calls wait and returns false if it did not return after the
+// given timeout. The shutdown progress of the given plugins is logged while
+// waiting.
+func (co *Coordinator) waitForShutdown(group string, plugins []core.PluginWithWorkers, timeout time.Duration, wait func()) bool {
+	reporter := core.NewShutdownReporter(group, plugins, shutdownReportInterval, timeout, logrus.StandardLogger())
+	reporter.Start()
+	defer reporter.Stop()
+
+	return tgo.ReturnAfter(timeout, wait)
+}
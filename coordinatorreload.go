@@ -0,0 +1,314 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"time"
+
+	"gollum/core"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Reload re-reads the config file or URL and restarts all producers and consumers
+// whose configuration changed. Unchanged plugins keep running. Restarted
+// plugins are stopped like during shutdown, i.e. producers drain their queue
+// to their backend or fallback.
+// Routers cannot be replaced during runtime, so router changes cancel the
+// reload and require a restart.
+func (co *Coordinator) Reload() {
+	if co.configFile == "" || co.config == nil {
+		return // ### return, nothing to reload ###
+	}
+	if co.configFile == "-" {
+		logrus.Warning("Config read from stdin cannot be reloaded")
+		return
+	}
+
+	config, err := loadConfig(co.configFile)
+	if err == nil {
+		err = config.Validate()
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Failed to reload config, keeping the current one")
+		return
+	}
+
+	if routers := core.DiffPluginConfigs(co.config.GetRouters(), config.GetRouters()); !routers.IsEmpty() {
+		logrus.Error("Router changes require a restart, keeping the current config")
+		return
+	}
+
+	producers := core.DiffPluginConfigs(co.config.GetProducers(), config.GetProducers())
+	consumers := core.DiffPluginConfigs(co.config.GetConsumers(), config.GetConsumers())
+	if producers.IsEmpty() && consumers.IsEmpty() {
+		logrus.Debug("Config did not change")
+		return
+	}
+
+	logrus.Infof("Reloading config: %d producers and %d consumers added, changed or removed",
+		len(producers.Added)+len(producers.Changed)+len(producers.Removed),
+		len(consumers.Added)+len(consumers.Changed)+len(consumers.Removed))
+
+	// Producers are replaced first, so that new consumers can already send to
+	// new producers.
+	co.reloadProducers(producers)
+	co.reloadConsumers(consumers)
+
+	// Consumers might have created new fallback routers
+	core.StreamRegistry.AddAllWildcardProducersToAllRouters()
+	co.config = config
+}
+
+func (co *Coordinator) reloadProducers(diff core.PluginConfigDiff) {
+	for _, config := range diff.Removed {
+		if idx := findPlugin(co.producers, config.ID); idx >= 0 {
+			co.removeProducer(idx)
+		}
+	}
+
+	for _, config := range append(diff.Changed, diff.Added...) {
+		idx := findPlugin(co.producers, config.ID)
+		var oldProducer core.Producer
+		if idx >= 0 {
+			oldProducer = co.producers[idx]
+			core.PluginRegistry.Unregister(config.ID)
+		}
+
+		producer, err := co.newProducer(config)
+		if err != nil {
+			logrus.WithError(err).Errorf("Failed to reload producer '%s'", config.ID)
+			if oldProducer != nil {
+				core.PluginRegistry.RegisterUnique(oldProducer, config.ID)
+			}
+			continue // ### continue, keep old producer ###
+		}
+
+		logrus.Infof("Starting producer '%s'", config.ID)
+		if oldProducer == nil {
+			co.attachProducer(producer)
+			co.startProducer(producer)
+			co.producers = append(co.producers, producer)
+			continue // ### continue, new producer ###
+		}
+
+		co.replaceProducer(oldProducer, producer)
+		co.startProducer(producer)
+		stopProducer(oldProducer)
+		core.MetricProducers.Dec(1)
+		co.producers[idx] = producer
+	}
+}
+
+func (co *Coordinator) reloadConsumers(diff core.PluginConfigDiff) {
+	for _, config := range diff.Removed {
+		if idx := findPlugin(co.consumers, config.ID); idx >= 0 {
+			co.removeConsumer(idx)
+		}
+	}
+
+	for _, config := range append(diff.Changed, diff.Added...) {
+		idx := findPlugin(co.consumers, config.ID)
+		var oldConsumer core.Consumer
+		if idx >= 0 {
+			oldConsumer = co.consumers[idx]
+			core.PluginRegistry.Unregister(config.ID)
+		}
+
+		consumer, err := co.newConsumer(config)
+		if err != nil {
+			logrus.WithError(err).Errorf("Failed to reload consumer '%s'", config.ID)
+			if oldConsumer != nil {
+				core.PluginRegistry.RegisterUnique(oldConsumer, config.ID)
+			}
+			continue // ### continue, keep old consumer ###
+		}
+
+		// The old consumer has to be stopped first as both might e.g. bind
+		// to the same port.
+		if oldConsumer != nil {
+			stopConsumer(oldConsumer)
+			core.MetricConsumers.Dec(1)
+			co.consumers[idx] = consumer
+		} else {
+			co.consumers = append(co.consumers, consumer)
+		}
+
+		logrus.Infof("Starting consumer '%s'", config.ID)
+		co.startConsumer(consumer)
+	}
+}
+
+func (co *Coordinator) removeProducer(idx int) {
+	producer := co.producers[idx]
+	pluginID := getPluginID(producer)
+	logrus.Infof("Removing producer '%s'", pluginID)
+
+	co.detachProducer(producer)
+	stopProducer(producer)
+
+	co.producers = append(co.producers[:idx], co.producers[idx+1:]...)
+	core.PluginRegistry.Unregister(pluginID)
+	core.MetricProducers.Dec(1)
+	core.RemovePluginHealthChecks(pluginID)
+}
+
+func (co *Coordinator) removeConsumer(idx int) {
+	consumer := co.consumers[idx]
+	pluginID := getPluginID(consumer)
+	logrus.Infof("Removing consumer '%s'", pluginID)
+
+	stopConsumer(consumer)
+
+	co.consumers = append(co.consumers[:idx], co.consumers[idx+1:]...)
+	core.PluginRegistry.Unregister(pluginID)
+	core.MetricConsumers.Dec(1)
+	core.RemovePluginHealthChecks(pluginID)
+}
+
+// detachProducer removes a producer from all routers so that it does not
+// receive new messages.
+func (co *Coordinator) detachProducer(producer core.Producer) {
+	core.StreamRegistry.UnregisterWildcardProducer(producer)
+	core.StreamRegistry.ForEachStream(func(streamID core.MessageStreamID, router core.Router) {
+		if removable, canRemove := router.(core.RouterWithProducerRemoval); canRemove {
+			removable.RemoveProducer(producer)
+		} else {
+			logrus.Warningf("Router '%s' does not support removing producers", router.GetID())
+		}
+	})
+}
+
+// replaceProducer attaches newProducer to all routers it listens to and
+// detaches oldProducer from all routers. Routers receiving messages for both
+// swap them atomically, so that no message is sent to both producers.
+func (co *Coordinator) replaceProducer(oldProducer core.Producer, newProducer core.Producer) {
+	routers := getProducerRouters(newProducer)
+
+	core.StreamRegistry.UnregisterWildcardProducer(oldProducer)
+	for _, streamID := range newProducer.Streams() {
+		if streamID == core.WildcardStreamID {
+			core.StreamRegistry.RegisterWildcardProducer(newProducer)
+		}
+	}
+
+	core.StreamRegistry.ForEachStream(func(streamID core.MessageStreamID, router core.Router) {
+		removable, canRemove := router.(core.RouterWithProducerRemoval)
+		switch {
+		case !canRemove:
+			logrus.Warningf("Router '%s' does not support removing producers", router.GetID())
+			if routers[router] {
+				router.AddProducer(newProducer)
+			}
+		case routers[router]:
+			removable.ReplaceProducer(oldProducer, newProducer)
+		default:
+			removable.RemoveProducer(oldProducer)
+		}
+	})
+}
+
+// getProducerRouters returns all routers a producer is attached to by
+// attachProducer and AddAllWildcardProducersToAllRouters. Missing routers are
+// created.
+func getProducerRouters(producer core.Producer) map[core.Router]bool {
+	routers := make(map[core.Router]bool)
+	isWildcard := false
+	onlyInternal := true
+
+	for _, streamID := range producer.Streams() {
+		if streamID == core.WildcardStreamID {
+			isWildcard = true
+		} else {
+			routers[core.StreamRegistry.GetRouterOrFallback(streamID)] = true
+		}
+		if streamID != core.LogInternalStreamID {
+			onlyInternal = false
+		}
+	}
+
+	if !onlyInternal {
+		routers[core.StreamRegistry.GetRouterOrFallback(core.WildcardStreamID)] = true
+	}
+
+	if isWildcard {
+		core.StreamRegistry.ForEachStream(func(streamID core.MessageStreamID, router core.Router) {
+			if streamID != core.LogInternalStreamID {
+				routers[router] = true
+			}
+		})
+	}
+	return routers
+}
+
+func stopProducer(producer core.Producer) {
+	producer.Control() <- core.PluginControlStopProducer
+	if !waitForPluginStop(producer, producer.GetShutdownTimeout()*10) {
+		logrus.Errorf("Producer '%s' found to be blocking", getPluginID(producer))
+	}
+}
+
+func stopConsumer(consumer core.Consumer) {
+	consumer.Control() <- core.PluginControlStopConsumer
+	if !waitForPluginStop(consumer, consumer.GetShutdownTimeout()*10) {
+		logrus.Errorf("Consumer '%s' found to be blocking", getPluginID(consumer))
+	}
+}
+
+// waitForPluginStop waits until a plugin reports to be dead. Plugins without
+// state are expected to stop immediately. Returns false if the timeout has
+// been reached.
+func waitForPluginStop(plugin core.Plugin, timeout time.Duration) bool {
+	pluginWithState, hasState := plugin.(core.PluginWithState)
+	if !hasState {
+		return true
+	}
+
+	deadline := time.Now().Add(timeout)
+	for pluginWithState.GetState() != core.PluginStateDead {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return true
+}
+
+func getPluginID(plugin interface{}) string {
+	if pluginWithID, hasID := plugin.(core.PluginWithID); hasID {
+		return pluginWithID.GetID()
+	}
+	return ""
+}
+
+// findPlugin returns the index of the plugin with the given ID or -1.
+// plugins has to be a slice of core.Producer or core.Consumer.
+func findPlugin(plugins interface{}, pluginID string) int {
+	switch list := plugins.(type) {
+	case []core.Producer:
+		for idx, producer := range list {
+			if getPluginID(producer) == pluginID {
+				return idx
+			}
+		}
+	case []core.Consumer:
+		for idx, consumer := range list {
+			if getPluginID(consumer) == pluginID {
+				return idx
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,77 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+const reloadTestConfig = `
+reloadIn:
+  Type: consumer.Profiler
+  Streams: reload
+  Runs: 1
+  Batches: 1
+  KeepRunning: true
+  Message: "%s"
+
+reloadOut:
+  Type: producer.Null
+  Streams: reload
+  ShutdownTimeoutMs: %s
+`
+
+func TestReloadKeepsPluginMetrics(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-reload")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "config.yaml")
+	expect.NoError(ioutil.WriteFile(configFile, []byte(fmt.Sprintf(reloadTestConfig, "first", "100")), 0644))
+
+	config, err := loadConfig(configFile)
+	expect.NoError(err)
+
+	defer core.PluginRegistry.Unregister("reloadIn")
+	defer core.PluginRegistry.Unregister("reloadOut")
+
+	co := NewCoordinator()
+	co.configFile = configFile
+	expect.NoError(co.Configure(config))
+	co.StartPlugins()
+	defer co.Shutdown()
+
+	producers := core.MetricProducers.Count()
+	consumers := core.MetricConsumers.Count()
+
+	// Change one producer and one consumer, so both get replaced
+	expect.NoError(ioutil.WriteFile(configFile, []byte(fmt.Sprintf(reloadTestConfig, "second", "200")), 0644))
+	co.Reload()
+
+	expect.Equal(2, len(co.consumers))
+	expect.Equal(1, len(co.producers))
+	expect.Equal(producers, core.MetricProducers.Count())
+	expect.Equal(consumers, core.MetricConsumers.Count())
+}
@@ -43,6 +43,9 @@ import (
 // - Batch/TimeoutSec: Defines the maximum time in seconds messages can stay in
 // the internal buffer before being flushed.
 // By default this parameter is set to 5.
+//
+// Batched producers do not support a write ahead log, so setting WAL/Path
+// or any other WAL setting is reported as a configuration error.
 type BatchedProducer struct {
 	DirectProducer  `gollumdoc:"embed_type"`
 	Batch           MessageBatch
@@ -56,6 +59,10 @@ type BatchedProducer struct {
 func (prod *BatchedProducer) Configure(conf PluginConfigReader) {
 	prod.SetStopCallback(prod.DefaultClose)
 
+	if conf.HasValue("WAL") {
+		conf.Errors.Pushf("WAL is not supported by batched producers")
+	}
+
 	prod.batchFlushCount = tmath.MinI(prod.batchFlushCount, prod.batchMaxCount)
 	prod.Batch = NewMessageBatch(prod.batchMaxCount)
 }
@@ -72,7 +79,7 @@ func (prod *BatchedProducer) Enqueue(msg *Message, timeout time.Duration) {
 		return // ### return, closing down ###
 	}
 
-	if !prod.HasContinueAfterModulate(msg) {
+	if !prod.HasContinueAfterModulate(msg) || prod.DropIfExpired(msg) {
 		return
 	}
 
@@ -97,6 +104,13 @@ func (prod *BatchedProducer) flushBatchOnTimeOut() {
 	}
 }
 
+// SetBatchTimeout overrides the time messages can stay in the internal buffer
+// before being flushed. This function has to be called before
+// BatchMessageLoop is started.
+func (prod *BatchedProducer) SetBatchTimeout(timeout time.Duration) {
+	prod.batchTimeout = timeout
+}
+
 // BatchMessageLoop start the TickerMessageControlLoop() for batch producer
 func (prod *BatchedProducer) BatchMessageLoop(workers *sync.WaitGroup, onBatchFlush func() AssemblyFunc) {
 	prod.onBatchFlush = onBatchFlush
@@ -105,8 +119,13 @@ func (prod *BatchedProducer) BatchMessageLoop(workers *sync.WaitGroup, onBatchFl
 	prod.TickerMessageControlLoop(prod.appendMessage, prod.batchTimeout, prod.flushBatchOnTimeOut)
 }
 
-// DefaultClose defines the default closing process
+// DefaultClose defines the default closing process. A flush that does not
+// finish before the drain deadline is abandoned. Messages still batched are
+// counted as drained.
 func (prod *BatchedProducer) DefaultClose() {
 	defer prod.WorkerDone()
-	prod.Batch.Close(prod.onBatchFlush(), prod.GetShutdownTimeout())
+	prod.countDrained(prod.Batch.getActiveBufferCount())
+	prod.RunBeforeDrainDeadline(func() {
+		prod.Batch.Close(prod.onBatchFlush(), prod.GetShutdownTimeout())
+	})
 }
@@ -68,6 +68,16 @@ func TestBatchedProducerConfigure(t *testing.T) {
 	reader := NewPluginConfigReader(&mockConf)
 	err := reader.Configure(&mockProducer)
 	expect.NoError(err)
+
+	// The write ahead log is not supported
+	mockProducer = mockBatchedProducer{}
+	mockConf = NewPluginConfig("mockBatchedWAL", "mockBatchedProducer")
+	mockConf.Override("Streams", []string{"testBoundStream"})
+	mockConf.Override("WAL", map[string]interface{}{"Path": "/tmp"})
+
+	reader = NewPluginConfigReader(&mockConf)
+	err = reader.Configure(&mockProducer)
+	expect.NotNil(err)
 }
 
 func TestBatchedProducerState(t *testing.T) {
@@ -219,4 +229,5 @@ func TestBatchedProducerClose(t *testing.T) {
 
 	// expect execution of flush method
 	expect.Equal(true, onBatchFlushExecuted)
+	expect.Equal(int64(2), mockP.GetDrainCount())
 }
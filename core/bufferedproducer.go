@@ -15,6 +15,7 @@
 package core
 
 import (
+	"path/filepath"
 	"time"
 
 	"github.com/trivago/tgo"
@@ -35,10 +36,36 @@ import (
 // parameter to 0.
 // By default this parameter is set to "0".
 //
+// - WAL/Path: This value defines a directory used to store a write ahead log
+// for this producer. When set, messages are written to disk before being
+// queued and are only removed after the producer has processed them.
+// Messages that were not processed when gollum stopped or crashed are
+// replayed on the next start. As of this, messages may be delivered twice
+// after a crash. When the producer is replaced by a config reload, the new
+// producer takes over the write ahead log of the old one. When left empty,
+// messages are only kept in memory.
+// By default this parameter is set to "".
+//
+// - WAL/MaxSizeMB: This value defines the maximum size of the write ahead
+// log in MB. Messages that do not fit into the log are sent to the fallback.
+// Set to 0 to disable the limit.
+// By default this parameter is set to "1024".
+//
+// - WAL/SyncMs: This value defines the interval in milliseconds in which the
+// write ahead log is synced to disk. Messages written after the last sync
+// survive a crash of gollum but may be lost on power failure. Set to 0 to
+// sync after every message.
+// By default this parameter is set to "1000".
+//
+// The number of queued messages and its maximum are exposed as the metrics
+// "<ID>.queue.depth" and "<ID>.queue.max".
 //
 type BufferedProducer struct {
 	DirectProducer `gollumdoc:"embed_type"`
 	messages       MessageQueue
+	queueMetrics   *MessageQueueMetrics
+	wal            *WriteAheadLog
+	manualAck      bool
 	channelTimeout time.Duration `config:"ChannelTimeoutMs" default:"0" metric:"ms"`
 }
 
@@ -47,6 +74,74 @@ func (prod *BufferedProducer) Configure(conf PluginConfigReader) {
 	prod.onPrepareStop = prod.DefaultDrain
 	prod.onStop = prod.DefaultClose
 	prod.messages = NewMessageQueue(int(conf.GetInt("Channel", 8192)))
+	prod.queueMetrics = NewMessageQueueMetrics(prod.messages, conf.GetID())
+
+	if walPath := conf.GetString("WAL/Path", ""); walPath != "" {
+		maxSize := conf.GetInt("WAL/MaxSizeMB", 1024) << 20
+		syncInterval := time.Duration(conf.GetInt("WAL/SyncMs", 1000)) * time.Millisecond
+
+		wal, err := NewWriteAheadLog(filepath.Join(walPath, conf.GetID()), maxSize, syncInterval, conf.GetLogger())
+		if !conf.Errors.Push(err) {
+			prod.wal = wal
+		}
+	}
+}
+
+// EnableManualAck stops messages from being acknowledged in the write ahead
+// log as soon as the message handling function returns. This has to be
+// called by producers that send messages asynchronously. These producers
+// have to call AckMessage after a message has been delivered or sent to the
+// fallback.
+func (prod *BufferedProducer) EnableManualAck() {
+	prod.manualAck = true
+}
+
+// AckMessage removes a message from the write ahead log, if one is used.
+// This function has to be called for every message that left the producer.
+func (prod *BufferedProducer) AckMessage(msg *Message) {
+	if prod.wal != nil {
+		prod.wal.Ack(msg)
+	}
+}
+
+// ackHandledMessage acknowledges a message passed to the message handling
+// function unless the producer acknowledges messages itself.
+func (prod *BufferedProducer) ackHandledMessage(msg *Message) {
+	if !prod.manualAck {
+		prod.AckMessage(msg)
+	}
+}
+
+// replayMessages passes all messages left in the write ahead log by a
+// previous run to onMessage.
+func (prod *BufferedProducer) replayMessages(onMessage func(*Message)) {
+	if prod.wal == nil {
+		return // ### return, no write ahead log ###
+	}
+
+	for _, msg := range prod.wal.GetReplay() {
+		if prod.DropIfExpired(msg) {
+			prod.AckMessage(msg)
+		} else {
+			onMessage(msg)
+			prod.ackHandledMessage(msg)
+		}
+	}
+}
+
+// closeWriteAheadLog closes the write ahead log, if one is used.
+func (prod *BufferedProducer) closeWriteAheadLog() {
+	if prod.wal != nil {
+		if err := prod.wal.Close(); err != nil {
+			prod.Logger.WithError(err).Error("Failed to close write ahead log")
+		}
+	}
+}
+
+func (prod *BufferedProducer) updateQueueMetrics() {
+	if prod.queueMetrics != nil {
+		prod.queueMetrics.Update()
+	}
 }
 
 // GetQueueTimeout returns the duration this producer will block before a
@@ -78,16 +173,27 @@ func (prod *BufferedProducer) Enqueue(msg *Message, timeout time.Duration) {
 		usedTimeout = timeout
 	}
 
+	if prod.wal != nil {
+		if err := prod.wal.Append(msg); err != nil {
+			prod.Logger.WithError(err).Error("Failed to write message to write ahead log")
+			prod.TryFallback(msg)
+			return // ### return, not persisted ###
+		}
+	}
+
 	switch prod.messages.Push(msg, usedTimeout) {
 	case MessageQueueTimeout:
+		prod.AckMessage(msg)
 		prod.TryFallback(msg)
 		prod.setState(PluginStateWaiting)
 
 	case MessageQueueDiscard:
+		prod.AckMessage(msg)
 		MetricMessagesDiscarded.Inc(1)
 		prod.setState(PluginStateWaiting)
 
 	default:
+		prod.updateQueueMetrics()
 		prod.setState(PluginStateActive)
 	}
 
@@ -108,10 +214,15 @@ func (prod *BufferedProducer) DefaultDrain() {
 // after the queue being empty for a given amount of time or when the queue
 // has been closed and no more messages are available. The return value
 // indicates wether the channel is empty or not.
+// If a drain deadline is set, this function returns after the deadline has
+// been reached or handleMessage got stuck.
 func (prod *BufferedProducer) DrainMessageChannel(handleMessage func(*Message), timeout time.Duration) bool {
 	for {
-		if msg, ok := prod.messages.PopWithTimeout(timeout); ok {
-			if !tgo.ReturnAfter(prod.shutdownTimeout, func() { handleMessage(msg) }) {
+		if prod.IsDrainDeadlineExceeded() {
+			return prod.messages.IsEmpty() // ### return, deadline reached ###
+		}
+		if msg, ok := prod.messages.PopWithTimeout(prod.limitToDrainDeadline(timeout)); ok {
+			if !prod.drainMessage(msg, handleMessage) && !prod.HasDrainDeadline() {
 				return false // ### return, done ###
 			}
 		} else {
@@ -120,6 +231,44 @@ func (prod *BufferedProducer) DrainMessageChannel(handleMessage func(*Message),
 	}
 }
 
+// drainMessage passes a message to handleMessage or to the fallback if the
+// drain deadline has been reached. False is returned if handleMessage did not
+// return in time. In that case all following messages are sent to the fallback
+// if a drain deadline is set, so handleMessage is never called concurrently.
+func (prod *BufferedProducer) drainMessage(msg *Message, handleMessage func(*Message)) bool {
+	prod.countDrained(1)
+
+	if prod.IsDrainDeadlineExceeded() {
+		prod.AckMessage(msg)
+		prod.TryFallback(msg)
+		return true // ### return, deadline reached ###
+	}
+
+	if prod.DropIfExpired(msg) {
+		prod.AckMessage(msg)
+		return true // ### return, expired ###
+	}
+
+	if !tgo.ReturnAfter(prod.limitToDrainDeadline(prod.shutdownTimeout), func() { handleMessage(msg) }) {
+		prod.drainAbandoned = prod.HasDrainDeadline()
+		return false // ### return, handleMessage is stuck ###
+	}
+	prod.ackHandledMessage(msg)
+	return true
+}
+
+// limitToDrainDeadline returns the given timeout or the time left until the
+// drain deadline, whichever is shorter.
+func (prod *BufferedProducer) limitToDrainDeadline(timeout time.Duration) time.Duration {
+	if !prod.HasDrainDeadline() {
+		return timeout
+	}
+	if remaining := time.Until(prod.drainDeadline); remaining < timeout {
+		return remaining
+	}
+	return timeout
+}
+
 // DefaultClose is the function registered to onStop by default.
 // It calls CloseMessageChannel with the message handling function passed to
 // Any of the control functions. If no such call happens, this function does
@@ -134,10 +283,13 @@ func (prod *BufferedProducer) DefaultClose() {
 // closes the channel afterwards and calls DrainMessageChannel again to make
 // sure all messages are actually gone. The return value indicates wether
 // the channel is empty or not.
+// If a drain deadline is set, messages popped after the deadline or after
+// handleMessage got stuck are sent to the fallback.
 func (prod *BufferedProducer) CloseMessageChannel(handleMessage func(*Message)) (empty bool) {
 	prod.DrainMessageChannel(handleMessage, prod.shutdownTimeout)
 	prod.messages.Close()
 
+	defer prod.closeWriteAheadLog()
 	defer func() {
 		if !prod.messages.IsEmpty() {
 			prod.Logger.Errorf("%d messages left after closing.", prod.messages.GetNumQueued())
@@ -146,7 +298,7 @@ func (prod *BufferedProducer) CloseMessageChannel(handleMessage func(*Message))
 
 	for {
 		if msg, ok := prod.messages.Pop(); ok {
-			if !tgo.ReturnAfter(prod.shutdownTimeout, func() { handleMessage(msg) }) {
+			if !prod.drainMessage(msg, handleMessage) && !prod.HasDrainDeadline() {
 				return false // ### return, failed to handle message ###
 			}
 		} else {
@@ -176,10 +328,18 @@ func (prod *BufferedProducer) TickerMessageControlLoop(onMessage func(*Message),
 
 func (prod *BufferedProducer) messageLoop(onMessage func(*Message)) {
 	prod.onMessage = onMessage
+	prod.replayMessages(onMessage)
+
 	for prod.IsActive() {
 		msg, more := prod.messages.Pop()
 		if more {
-			onMessage(msg)
+			prod.updateQueueMetrics()
+			if prod.DropIfExpired(msg) {
+				prod.AckMessage(msg)
+			} else {
+				onMessage(msg)
+				prod.ackHandledMessage(msg)
+			}
 		}
 	}
 }
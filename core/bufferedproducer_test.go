@@ -15,7 +15,10 @@
 package core
 
 import (
+	"io/ioutil"
 	"math"
+	"os"
+	"path/filepath"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -285,3 +288,285 @@ func TestProducerControlLoop(t *testing.T) {
 	expect.Equal(atomic.LoadInt32(roll), int32(1))
 
 }
+
+type mockCountingRouter struct {
+	mockRouter
+	count *int32
+}
+
+func (router *mockCountingRouter) Enqueue(msg *Message) error {
+	atomic.AddInt32(router.count, 1)
+	return nil
+}
+
+func TestProducerCloseMessageChannelDrainDeadline(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockP := getMockBufferedProducer()
+	mockP.messages = NewMessageQueue(4)
+	mockP.shutdownTimeout = time.Second
+	mockP.drainTimeout = 50 * time.Millisecond
+
+	fallback := mockCountingRouter{
+		mockRouter: getMockRouter(),
+		count:      new(int32),
+	}
+	mockP.fallbackStream = &fallback
+
+	mockP.setState(PluginStateActive)
+	for i := 0; i < 3; i++ {
+		mockP.Enqueue(NewMessage(nil, []byte("drainDeadline"), nil, 1), time.Duration(0))
+	}
+
+	// Simulate an upload that never finishes
+	blocked := make(chan struct{})
+	defer close(blocked)
+	handleMessage := func(msg *Message) {
+		<-blocked
+	}
+
+	mockP.startDrain()
+	start := time.Now()
+	expect.True(mockP.CloseMessageChannel(handleMessage))
+
+	expect.Less(int64(time.Since(start)), int64(mockP.GetShutdownTimeout()))
+	expect.True(mockP.IsDrainDeadlineExceeded())
+	expect.Equal(int32(2), atomic.LoadInt32(fallback.count))
+}
+
+func TestProducerRunBeforeDrainDeadline(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockP := getMockBufferedProducer()
+
+	// Without a deadline the callback is called synchronously
+	called := false
+	expect.True(mockP.RunBeforeDrainDeadline(func() { called = true }))
+	expect.True(called)
+
+	mockP.drainTimeout = 20 * time.Millisecond
+	mockP.startDrain()
+
+	blocked := make(chan struct{})
+	defer close(blocked)
+
+	start := time.Now()
+	expect.False(mockP.RunBeforeDrainDeadline(func() { <-blocked }))
+	expect.Less(int64(time.Since(start)), int64(time.Second))
+}
+
+func TestProducerQueueMetrics(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	mockProducer := mockBufferedProducer{}
+	mockConf := NewPluginConfig(t.Name(), "mockBufferedProducer")
+	mockConf.Override("Streams", []string{"testBoundStream"})
+	mockConf.Override("Channel", 8)
+
+	reader := NewPluginConfigReader(&mockConf)
+	expect.NoError(reader.Configure(&mockProducer))
+	mockProducer.setState(PluginStateActive)
+
+	depth := MetricsRegistry.Get(t.Name() + ".queue.depth")
+	expect.Equal(mockProducer.queueMetrics.Depth, depth)
+	highWaterMark := MetricsRegistry.Get(t.Name() + ".queue.max")
+	expect.Equal(mockProducer.queueMetrics.HighWaterMark, highWaterMark)
+
+	for i := 0; i < 5; i++ {
+		mockProducer.Enqueue(NewMessage(nil, []byte("message"), nil, 1), time.Second)
+	}
+	expect.Equal(int64(5), mockProducer.queueMetrics.Depth.Value())
+	expect.Equal(int64(5), mockProducer.queueMetrics.HighWaterMark.Value())
+
+	// Draining the queue lowers the depth but keeps the high-water mark
+	handled := new(sync.WaitGroup)
+	handled.Add(5)
+	go mockProducer.messageLoop(func(msg *Message) {
+		handled.Done()
+	})
+	handled.Wait()
+
+	expect.Equal(int64(0), mockProducer.queueMetrics.Depth.Value())
+	expect.Equal(int64(5), mockProducer.queueMetrics.HighWaterMark.Value())
+
+	mockProducer.setState(PluginStateStopping)
+	mockProducer.messages.Close()
+}
+
+func TestProducerMaxAge(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockP := getMockBufferedProducer()
+	mockP.messages = NewMessageQueue(4)
+	mockP.maxAge = time.Second
+
+	expired := mockCountingRouter{
+		mockRouter: getMockRouter(),
+		count:      new(int32),
+	}
+	mockP.expiredStream = &expired
+
+	freshMsg := NewMessage(nil, []byte("fresh"), nil, 1)
+	oldMsg := NewMessage(nil, []byte("old"), nil, 1)
+	oldMsg.timestamp = time.Now().Add(-2 * time.Second).UnixNano()
+
+	expect.False(mockP.IsExpired(freshMsg))
+	expect.True(mockP.IsExpired(oldMsg))
+
+	droppedBefore := MetricMessagesExpired.Count()
+	mockP.setState(PluginStateActive)
+	mockP.messages.Push(oldMsg, -1)
+	mockP.messages.Push(freshMsg, -1)
+
+	handled := []string{}
+	mockP.messageLoop(func(msg *Message) {
+		handled = append(handled, msg.String())
+		mockP.setState(PluginStateDead)
+	})
+
+	expect.Equal([]string{"fresh"}, handled)
+	expect.Equal(int32(1), atomic.LoadInt32(expired.count))
+	expect.Equal(droppedBefore+1, MetricMessagesExpired.Count())
+
+	// Without an expired stream messages are dropped, too
+	mockP.expiredStream = nil
+	expect.True(mockP.DropIfExpired(oldMsg))
+	expect.Equal(droppedBefore+2, MetricMessagesExpired.Count())
+
+	// A max age of 0 disables the check
+	mockP.maxAge = 0
+	expect.False(mockP.DropIfExpired(oldMsg))
+}
+
+func TestProducerErrorMetrics(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	mockProducer := mockBufferedProducer{}
+	mockConf := NewPluginConfig(t.Name(), "mockBufferedProducer")
+	mockConf.Override("Streams", []string{"testBoundStream"})
+
+	reader := NewPluginConfigReader(&mockConf)
+	expect.NoError(reader.Configure(&mockProducer))
+
+	errorMetrics := mockProducer.GetErrorMetrics()
+	expect.Equal(errorMetrics.Fallbacks, MetricsRegistry.Get(t.Name()+".fallback"))
+	expect.Equal(errorMetrics.ConnectFailures, MetricsRegistry.Get(t.Name()+".errors.connect"))
+	expect.Equal(errorMetrics.SendFailures, MetricsRegistry.Get(t.Name()+".errors.send"))
+
+	// Messages are counted even if no fallback stream is set
+	mockProducer.TryFallback(NewMessage(nil, []byte("first"), nil, 1))
+	mockProducer.TryFallback(NewMessage(nil, []byte("second"), nil, 1))
+	expect.Equal(int64(2), errorMetrics.Fallbacks.Count())
+
+	errorMetrics.CountConnectFailure()
+	errorMetrics.CountSendFailure()
+	expect.Equal(int64(1), errorMetrics.ConnectFailures.Count())
+	expect.Equal(int64(1), errorMetrics.SendFailures.Count())
+
+	// Producers created without Configure do not count
+	unconfigured := getMockBufferedProducer()
+	expect.Nil(unconfigured.GetErrorMetrics())
+	unconfigured.GetErrorMetrics().CountConnectFailure()
+}
+
+func TestProducerWriteAheadLog(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-wal")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+	basePath := filepath.Join(dir, "producer")
+
+	mockP := getMockBufferedProducer()
+	mockP.messages = NewMessageQueue(4)
+	mockP.wal = newTestWriteAheadLog(t, basePath, 0)
+	mockP.setState(PluginStateActive)
+
+	for _, payload := range []string{"a", "b", "c"} {
+		mockP.Enqueue(NewMessage(nil, []byte(payload), nil, 1), -1)
+	}
+
+	// Process one message and crash while the others are still queued
+	handled := []string{}
+	mockP.messageLoop(func(msg *Message) {
+		handled = append(handled, msg.String())
+		mockP.setState(PluginStateDead)
+	})
+	expect.Equal([]string{"a"}, handled)
+	mockP.wal.crash()
+
+	restartedP := getMockBufferedProducer()
+	restartedP.wal = newTestWriteAheadLog(t, basePath, 0)
+	restartedP.setState(PluginStateActive)
+	restartedP.Enqueue(NewMessage(nil, []byte("d"), nil, 1), -1)
+
+	handled = []string{}
+	restartedP.messageLoop(func(msg *Message) {
+		handled = append(handled, msg.String())
+		if len(handled) == 3 {
+			restartedP.setState(PluginStateDead)
+		}
+	})
+
+	expect.Equal([]string{"b", "c", "d"}, handled)
+	expect.Equal(0, restartedP.wal.GetNumInFlight())
+	expect.NoError(restartedP.wal.Close())
+
+	restartedP.wal = newTestWriteAheadLog(t, basePath, 0)
+	expect.Equal(0, len(restartedP.wal.GetReplay()))
+	expect.NoError(restartedP.wal.Close())
+}
+
+func TestProducerWriteAheadLogConfigure(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-wal")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	mockProducer := mockBufferedProducer{}
+	mockConf := NewPluginConfig(t.Name(), "mockBufferedProducer")
+	mockConf.Override("Streams", []string{"testBoundStream"})
+	mockConf.Override("WAL", map[string]interface{}{
+		"Path":      dir,
+		"MaxSizeMB": 1,
+		"SyncMs":    0,
+	})
+
+	reader := NewPluginConfigReader(&mockConf)
+	err = reader.Configure(&mockProducer)
+	expect.NoError(err)
+	expect.NotNil(mockProducer.wal)
+	expect.Equal(int64(1<<20), mockProducer.wal.maxSize)
+	expect.Equal(time.Duration(0), mockProducer.wal.syncInterval)
+	expect.NoError(mockProducer.wal.Close())
+
+	_, err = os.Stat(filepath.Join(dir, t.Name()+".ack"))
+	expect.NoError(err)
+}
+
+func TestProducerWriteAheadLogManualAck(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-wal")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	mockP := getMockBufferedProducer()
+	mockP.messages = NewMessageQueue(4)
+	mockP.wal = newTestWriteAheadLog(t, filepath.Join(dir, "producer"), 0)
+	mockP.EnableManualAck()
+	mockP.setState(PluginStateActive)
+
+	mockP.Enqueue(NewMessage(nil, []byte("a"), nil, 1), -1)
+
+	// Messages stay in the log after being handled until acknowledged
+	handled := []*Message{}
+	mockP.messageLoop(func(msg *Message) {
+		handled = append(handled, msg)
+		mockP.setState(PluginStateDead)
+	})
+	expect.Equal(1, len(handled))
+	expect.Equal(1, mockP.wal.GetNumInFlight())
+
+	mockP.AckMessage(handled[0])
+	expect.Equal(0, mockP.wal.GetNumInFlight())
+	expect.NoError(mockP.wal.Close())
+}
@@ -98,6 +98,18 @@ func (bwa *BatchedWriterAssembly) SetWriter(writer BatchedWriter) {
 	bwa.Created = time.Now()
 }
 
+// SetErrorHandler sets a callback that is called if the writer returned an
+// error. HandleError needs to return true to prevent messages to be flushed.
+func (bwa *BatchedWriterAssembly) SetErrorHandler(handleError func(error) bool) {
+	bwa.assembly.SetErrorHandler(handleError)
+}
+
+// SetEncoder sets a callback that creates the data written for a message.
+// See core.WriterAssembly.SetEncoder.
+func (bwa *BatchedWriterAssembly) SetEncoder(encode func(*core.Message) ([]byte, error)) {
+	bwa.assembly.SetEncoder(encode)
+}
+
 // UnsetWriter unset the current writer
 func (bwa *BatchedWriterAssembly) UnsetWriter() {
 	bwa.writer = nil
@@ -0,0 +1,167 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package components
+
+import (
+	"sync"
+	"time"
+
+	"gollum/core"
+
+	"github.com/rcrowley/go-metrics"
+)
+
+// CircuitBreaker protects a backend from being flooded with requests while
+// it is not available. Producers call Allow before sending a message and
+// report the result via Success or Failure. After FailThreshold consecutive
+// failures the breaker opens and Allow returns false for Cooldown. After
+// that the breaker becomes half-open and allows a single probe. A successful
+// probe closes the breaker, a failed probe opens it again.
+//
+// Parameters
+//
+// - Breaker/FailThreshold: Defines the number of consecutive send failures
+// after which the breaker opens. While open, messages are passed to the
+// fallback without contacting the backend. Set to 0 to disable the breaker.
+// By default this parameter is set to "0".
+//
+// - Breaker/CooldownMs: Defines the time in milliseconds the breaker stays
+// open before a probe message is sent to the backend.
+// By default this parameter is set to "5000".
+//
+type CircuitBreaker struct {
+	FailThreshold int           `config:"Breaker/FailThreshold" default:"0"`
+	Cooldown      time.Duration `config:"Breaker/CooldownMs" default:"5000" metric:"ms"`
+
+	guard        sync.Mutex
+	failures     int
+	openedAt     time.Time
+	probeStart   time.Time
+	isProbing    bool
+	metricsOpen  metrics.Gauge
+	metricsTrips metrics.Counter
+	now          func() time.Time
+}
+
+// Configure method for interface implementation
+func (breaker *CircuitBreaker) Configure(conf core.PluginConfigReader) {
+	if breaker.FailThreshold < 0 {
+		conf.Errors.Pushf("Breaker/FailThreshold must not be negative")
+	}
+}
+
+// IsEnabled returns true if a fail threshold has been set
+func (breaker *CircuitBreaker) IsEnabled() bool {
+	return breaker.FailThreshold > 0
+}
+
+// RegisterMetrics adds the metrics "BreakerOpen" (1 if open, 0 if closed)
+// and "BreakerTrips" (number of times the breaker opened) to the given
+// registry.
+func (breaker *CircuitBreaker) RegisterMetrics(registry metrics.Registry) {
+	breaker.guard.Lock()
+	defer breaker.guard.Unlock()
+
+	breaker.metricsOpen = metrics.NewGauge()
+	breaker.metricsTrips = metrics.NewCounter()
+	registry.Register("BreakerOpen", breaker.metricsOpen)
+	registry.Register("BreakerTrips", breaker.metricsTrips)
+}
+
+// IsOpen returns true if the breaker is open or half-open
+func (breaker *CircuitBreaker) IsOpen() bool {
+	breaker.guard.Lock()
+	defer breaker.guard.Unlock()
+	return !breaker.openedAt.IsZero()
+}
+
+// Allow returns true if a message may be sent to the backend. If the
+// breaker is half-open, only one caller per Cooldown gets true.
+func (breaker *CircuitBreaker) Allow() bool {
+	if !breaker.IsEnabled() {
+		return true // ### return, breaker disabled ###
+	}
+
+	breaker.guard.Lock()
+	defer breaker.guard.Unlock()
+
+	if breaker.openedAt.IsZero() {
+		return true // ### return, closed ###
+	}
+
+	now := breaker.getNow()
+	if now.Sub(breaker.openedAt) < breaker.Cooldown {
+		return false // ### return, open ###
+	}
+
+	// Half-open: allow one probe. If the probe result is never reported,
+	// another probe is allowed after Cooldown.
+	if breaker.isProbing && now.Sub(breaker.probeStart) < breaker.Cooldown {
+		return false // ### return, probe running ###
+	}
+
+	breaker.isProbing = true
+	breaker.probeStart = now
+	return true
+}
+
+// Success reports a successful send and closes the breaker
+func (breaker *CircuitBreaker) Success() {
+	if !breaker.IsEnabled() {
+		return // ### return, breaker disabled ###
+	}
+
+	breaker.guard.Lock()
+	defer breaker.guard.Unlock()
+
+	breaker.failures = 0
+	breaker.isProbing = false
+	breaker.openedAt = time.Time{}
+	if breaker.metricsOpen != nil {
+		breaker.metricsOpen.Update(0)
+	}
+}
+
+// Failure reports a failed send. The breaker opens if FailThreshold
+// consecutive failures have been reported or if a probe failed.
+func (breaker *CircuitBreaker) Failure() {
+	if !breaker.IsEnabled() {
+		return // ### return, breaker disabled ###
+	}
+
+	breaker.guard.Lock()
+	defer breaker.guard.Unlock()
+
+	breaker.failures++
+	wasOpen := !breaker.openedAt.IsZero()
+	if !wasOpen && breaker.failures < breaker.FailThreshold {
+		return // ### return, below threshold ###
+	}
+
+	breaker.openedAt = breaker.getNow()
+	breaker.isProbing = false
+
+	if !wasOpen && breaker.metricsTrips != nil {
+		breaker.metricsTrips.Inc(1)
+		breaker.metricsOpen.Update(1)
+	}
+}
+
+func (breaker *CircuitBreaker) getNow() time.Time {
+	if breaker.now != nil {
+		return breaker.now()
+	}
+	return time.Now()
+}
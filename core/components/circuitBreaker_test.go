@@ -0,0 +1,101 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package components
+
+import (
+	"testing"
+	"time"
+
+	"github.com/rcrowley/go-metrics"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func newTestCircuitBreaker(threshold int, cooldown time.Duration) (*CircuitBreaker, *time.Time) {
+	now := time.Now()
+	breaker := &CircuitBreaker{
+		FailThreshold: threshold,
+		Cooldown:      cooldown,
+		now:           func() time.Time { return now },
+	}
+	return breaker, &now
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	breaker, _ := newTestCircuitBreaker(0, time.Second)
+
+	for i := 0; i < 10; i++ {
+		breaker.Failure()
+	}
+	expect.True(breaker.Allow())
+	expect.False(breaker.IsOpen())
+}
+
+func TestCircuitBreakerOpenAndProbe(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	breaker, now := newTestCircuitBreaker(3, time.Second)
+
+	registry := metrics.NewRegistry()
+	breaker.RegisterMetrics(registry)
+	open := registry.Get("BreakerOpen").(metrics.Gauge)
+	trips := registry.Get("BreakerTrips").(metrics.Counter)
+
+	breaker.Failure()
+	breaker.Failure()
+	breaker.Success() // resets the consecutive failures
+	breaker.Failure()
+	breaker.Failure()
+	expect.True(breaker.Allow())
+	expect.False(breaker.IsOpen())
+
+	breaker.Failure()
+	expect.True(breaker.IsOpen())
+	expect.False(breaker.Allow())
+	expect.Equal(int64(1), open.Value())
+	expect.Equal(int64(1), trips.Count())
+
+	// Half-open: only one probe is allowed
+	*now = now.Add(time.Second)
+	expect.True(breaker.Allow())
+	expect.False(breaker.Allow())
+
+	// Failed probe opens the breaker again
+	breaker.Failure()
+	expect.False(breaker.Allow())
+	expect.Equal(int64(1), trips.Count())
+
+	*now = now.Add(time.Second)
+	expect.True(breaker.Allow())
+	breaker.Success()
+	expect.False(breaker.IsOpen())
+	expect.True(breaker.Allow())
+	expect.True(breaker.Allow())
+	expect.Equal(int64(0), open.Value())
+}
+
+func TestCircuitBreakerLostProbe(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	breaker, now := newTestCircuitBreaker(1, time.Second)
+
+	breaker.Failure()
+	*now = now.Add(time.Second)
+	expect.True(breaker.Allow())
+
+	// The probe result is never reported
+	*now = now.Add(500 * time.Millisecond)
+	expect.False(breaker.Allow())
+	*now = now.Add(500 * time.Millisecond)
+	expect.True(breaker.Allow())
+}
@@ -0,0 +1,207 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package components
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+)
+
+const (
+	// EnvelopeFormatNone disables the envelope
+	EnvelopeFormatNone = ""
+	// EnvelopeFormatJSON wraps payload and metadata into a JSON object
+	EnvelopeFormatJSON = "json"
+	// EnvelopeFormatKeyValue writes metadata and payload as key=value pairs
+	EnvelopeFormatKeyValue = "key=value"
+	// EnvelopeFormatMsgpack wraps payload and metadata into a msgpack map
+	EnvelopeFormatMsgpack = "msgpack"
+)
+
+// EnvelopeConfig defines settings for writing messages together with their
+// metadata
+//
+// Parameters
+//
+// - Envelope/Format: Defines the format used to combine payload and metadata
+// into one record. Can be "json", "key=value" or "msgpack". If left empty,
+// only the payload is written.
+// JSON and msgpack records contain a map with the payload stored as string
+// below PayloadKey and the metadata stored below MetadataKey. Key=value
+// records contain one pair per metadata field followed by the payload pair,
+// all separated by spaces. Values are quoted if necessary.
+// By default this parameter is set to "".
+//
+// - Envelope/Fields: A list of metadata keys to include in the record. If
+// left empty, all metadata fields are included.
+// By default this parameter is set to an empty list.
+//
+// - Envelope/PayloadKey: The key used to store the payload.
+// By default this parameter is set to "payload".
+//
+// - Envelope/MetadataKey: The key used to store the metadata in JSON and
+// msgpack records.
+// By default this parameter is set to "metadata".
+//
+// - Envelope/Delimiter: Defines a string appended to each JSON or key=value
+// record. Msgpack records are not delimited as they are self-describing.
+// By default this parameter is set to "\n".
+//
+// - Envelope/Base64Payload: When set to true, the payload is stored base64
+// encoded. This is required for binary payloads, as the payload is otherwise
+// stored as UTF-8 string and invalid characters are replaced.
+// By default this parameter is set to false.
+//
+// The record is created when a message is written. Messages passed to the
+// fallback still contain the original payload.
+//
+type EnvelopeConfig struct {
+	Format        string   `config:"Envelope/Format" default:""`
+	Fields        []string `config:"Envelope/Fields"`
+	PayloadKey    string   `config:"Envelope/PayloadKey" default:"payload"`
+	MetadataKey   string   `config:"Envelope/MetadataKey" default:"metadata"`
+	Delimiter     string   `config:"Envelope/Delimiter" default:"\n"`
+	Base64Payload bool     `config:"Envelope/Base64Payload" default:"false"`
+}
+
+// Configure method for interface implementation
+func (envelope *EnvelopeConfig) Configure(conf core.PluginConfigReader) {
+	envelope.Format = strings.ToLower(envelope.Format)
+	switch envelope.Format {
+	case EnvelopeFormatNone, EnvelopeFormatJSON, EnvelopeFormatKeyValue, EnvelopeFormatMsgpack:
+		// Everything is fine
+	default:
+		conf.Errors.Pushf("Unknown envelope format '%s'", envelope.Format)
+	}
+}
+
+// IsEnabled returns true if an envelope format has been set
+func (envelope *EnvelopeConfig) IsEnabled() bool {
+	return envelope.Format != EnvelopeFormatNone
+}
+
+// Encode creates a record containing the payload and the selected metadata
+// fields of the given message. The message is not changed. If no format is
+// set, the payload is returned.
+func (envelope *EnvelopeConfig) Encode(msg *core.Message) ([]byte, error) {
+	metadata := envelope.getMetadata(msg)
+
+	switch envelope.Format {
+	case EnvelopeFormatJSON:
+		record, err := json.Marshal(map[string]interface{}{
+			envelope.PayloadKey:  envelope.getPayload(msg),
+			envelope.MetadataKey: metadata,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return append(record, envelope.Delimiter...), nil
+
+	case EnvelopeFormatKeyValue:
+		return envelope.encodeKeyValue(metadata, envelope.getPayload(msg))
+
+	case EnvelopeFormatMsgpack:
+		return MarshalMsgpack(map[string]interface{}{
+			envelope.PayloadKey:  envelope.getPayload(msg),
+			envelope.MetadataKey: map[string]interface{}(metadata),
+		})
+
+	default:
+		return msg.GetPayload(), nil
+	}
+}
+
+// getPayload returns the payload of the given message as stored in a record
+func (envelope *EnvelopeConfig) getPayload(msg *core.Message) string {
+	if envelope.Base64Payload {
+		return base64.StdEncoding.EncodeToString(msg.GetPayload())
+	}
+	return string(msg.GetPayload())
+}
+
+// getMetadata returns all metadata fields that should be part of the record
+func (envelope *EnvelopeConfig) getMetadata(msg *core.Message) tcontainer.MarshalMap {
+	metadata := msg.TryGetMetadata()
+	if metadata == nil {
+		return tcontainer.NewMarshalMap()
+	}
+
+	if len(envelope.Fields) == 0 {
+		return metadata
+	}
+
+	selected := tcontainer.NewMarshalMap()
+	for _, key := range envelope.Fields {
+		if value, exists := metadata.Value(key); exists {
+			selected[key] = value
+		}
+	}
+	return selected
+}
+
+func (envelope *EnvelopeConfig) encodeKeyValue(metadata tcontainer.MarshalMap, payload string) ([]byte, error) {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	record := bytes.Buffer{}
+	for _, key := range keys {
+		value, err := keyValueString(metadata[key])
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&record, "%s=%s ", key, quoteKeyValue(value))
+	}
+
+	fmt.Fprintf(&record, "%s=%s%s", envelope.PayloadKey, quoteKeyValue(payload), envelope.Delimiter)
+	return record.Bytes(), nil
+}
+
+// keyValueString converts a metadata value to a string. Nested values are
+// converted to JSON.
+func keyValueString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprint(v), nil
+	default:
+		data, err := json.Marshal(v)
+		return string(data), err
+	}
+}
+
+// quoteKeyValue quotes values that are empty or would break key=value parsing
+func quoteKeyValue(value string) string {
+	if len(value) == 0 || strings.ContainsAny(value, " \t\r\n\"=") {
+		return strconv.Quote(value)
+	}
+	return value
+}
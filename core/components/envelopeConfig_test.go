@@ -0,0 +1,176 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package components
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func newTestEnvelopeMessage() *core.Message {
+	metadata := tcontainer.MarshalMap{
+		"host":  "web01",
+		"level": "error",
+		"code":  500,
+	}
+	return core.NewMessage(nil, []byte("disk full"), metadata, core.InvalidStreamID)
+}
+
+func TestEnvelopeNone(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "components.EnvelopeConfig")
+
+	envelope := EnvelopeConfig{}
+	reader := core.NewPluginConfigReader(&config)
+	expect.NoError(reader.Configure(&envelope))
+
+	msg := newTestEnvelopeMessage()
+
+	expect.False(envelope.IsEnabled())
+	record, err := envelope.Encode(msg)
+	expect.NoError(err)
+	expect.Equal("disk full", string(record))
+}
+
+func TestEnvelopeJSON(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "components.EnvelopeConfig")
+	config.Override("Envelope/Format", "json")
+	config.Override("Envelope/Fields", []string{"host", "level", "missing"})
+
+	envelope := EnvelopeConfig{}
+	reader := core.NewPluginConfigReader(&config)
+	expect.NoError(reader.Configure(&envelope))
+
+	msg := newTestEnvelopeMessage()
+
+	record, err := envelope.Encode(msg)
+	expect.NoError(err)
+	expect.Equal(`{"metadata":{"host":"web01","level":"error"},"payload":"disk full"}`+"\n", string(record))
+
+	// The message is not changed
+	expect.Equal("disk full", msg.String())
+
+	fields := map[string]interface{}{}
+	expect.NoError(json.Unmarshal(record, &fields))
+	expect.Equal("disk full", fields["payload"])
+}
+
+func TestEnvelopeBase64Payload(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "components.EnvelopeConfig")
+	config.Override("Envelope/Format", "json")
+	config.Override("Envelope/Fields", []string{"host"})
+	config.Override("Envelope/Base64Payload", true)
+
+	envelope := EnvelopeConfig{}
+	reader := core.NewPluginConfigReader(&config)
+	expect.NoError(reader.Configure(&envelope))
+
+	binary := []byte{0xff, 0x00, 0xfe, 'a'}
+	msg := core.NewMessage(nil, binary, tcontainer.MarshalMap{"host": "web01"}, core.InvalidStreamID)
+
+	record, err := envelope.Encode(msg)
+	expect.NoError(err)
+
+	fields := map[string]interface{}{}
+	expect.NoError(json.Unmarshal(record, &fields))
+	payload, err := base64.StdEncoding.DecodeString(fields["payload"].(string))
+	expect.NoError(err)
+	expect.Equal(binary, payload)
+}
+
+func TestEnvelopeKeyValue(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "components.EnvelopeConfig")
+	config.Override("Envelope/Format", "key=value")
+	config.Override("Envelope/Delimiter", "")
+
+	envelope := EnvelopeConfig{}
+	reader := core.NewPluginConfigReader(&config)
+	expect.NoError(reader.Configure(&envelope))
+
+	msg := newTestEnvelopeMessage()
+
+	record, err := envelope.Encode(msg)
+	expect.NoError(err)
+	expect.Equal(`code=500 host=web01 level=error payload="disk full"`, string(record))
+}
+
+func TestEnvelopeMsgpack(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "components.EnvelopeConfig")
+	config.Override("Envelope/Format", "msgpack")
+	config.Override("Envelope/Fields", []string{"code"})
+
+	envelope := EnvelopeConfig{}
+	reader := core.NewPluginConfigReader(&config)
+	expect.NoError(reader.Configure(&envelope))
+
+	msg := newTestEnvelopeMessage()
+
+	record, err := envelope.Encode(msg)
+	expect.NoError(err)
+
+	expected := []byte{
+		0x82,                                               // map with 2 entries
+		0xa8, 'm', 'e', 't', 'a', 'd', 'a', 't', 'a', 0x81, // "metadata": map with 1 entry
+		0xa4, 'c', 'o', 'd', 'e', 0xcd, 0x01, 0xf4, // "code": uint16(500)
+		0xa7, 'p', 'a', 'y', 'l', 'o', 'a', 'd', // "payload"
+		0xa9, 'd', 'i', 's', 'k', ' ', 'f', 'u', 'l', 'l', // "disk full"
+	}
+	expect.Equal(expected, record)
+}
+
+func TestEnvelopeInvalidFormat(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "components.EnvelopeConfig")
+	config.Override("Envelope/Format", "xml")
+
+	envelope := EnvelopeConfig{}
+	reader := core.NewPluginConfigReader(&config)
+	expect.NotNil(reader.Configure(&envelope))
+}
+
+func TestMarshalMsgpackTypes(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	data, err := MarshalMsgpack([]interface{}{nil, true, -1, -200, 1.5, []byte{1}})
+	expect.NoError(err)
+	expect.Equal([]byte{
+		0x96,             // array with 6 entries
+		0xc0,             // nil
+		0xc3,             // true
+		0xff,             // negative fixint -1
+		0xd1, 0xff, 0x38, // int16 -200
+		0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0, // float64 1.5
+		0xc4, 0x01, 0x01, // bin8
+	}, data)
+
+	_, err = MarshalMsgpack(make(chan int))
+	expect.NotNil(err)
+}
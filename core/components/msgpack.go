@@ -0,0 +1,201 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package components
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// MarshalMsgpack encodes the given value using the msgpack format.
+// Supported are nil, booleans, numbers, strings, byte slices, slices and maps
+// with string keys. Map keys are written in sorted order.
+func MarshalMsgpack(value interface{}) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	if err := writeMsgpack(&buffer, reflect.ValueOf(value)); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func writeMsgpack(buffer *bytes.Buffer, value reflect.Value) error {
+	if !value.IsValid() {
+		buffer.WriteByte(0xc0)
+		return nil // ### return, nil ###
+	}
+
+	switch value.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if value.IsNil() {
+			buffer.WriteByte(0xc0)
+			return nil // ### return, nil ###
+		}
+		return writeMsgpack(buffer, value.Elem())
+
+	case reflect.Bool:
+		if value.Bool() {
+			buffer.WriteByte(0xc3)
+		} else {
+			buffer.WriteByte(0xc2)
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeMsgpackInt(buffer, value.Int())
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		writeMsgpackUint(buffer, value.Uint())
+
+	case reflect.Float32:
+		buffer.WriteByte(0xca)
+		binary.Write(buffer, binary.BigEndian, math.Float32bits(float32(value.Float())))
+
+	case reflect.Float64:
+		buffer.WriteByte(0xcb)
+		binary.Write(buffer, binary.BigEndian, math.Float64bits(value.Float()))
+
+	case reflect.String:
+		writeMsgpackString(buffer, value.String())
+
+	case reflect.Slice, reflect.Array:
+		if value.Type().Elem().Kind() == reflect.Uint8 {
+			data := make([]byte, value.Len())
+			reflect.Copy(reflect.ValueOf(data), value)
+			writeMsgpackBinary(buffer, data)
+			return nil // ### return, byte slice ###
+		}
+
+		writeMsgpackHeader(buffer, value.Len(), 0x90, 0xdc, 0xdd)
+		for i := 0; i < value.Len(); i++ {
+			if err := writeMsgpack(buffer, value.Index(i)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		keys := make([]string, 0, value.Len())
+		values := make(map[string]reflect.Value, value.Len())
+		for _, key := range value.MapKeys() {
+			name := fmt.Sprint(key.Interface())
+			keys = append(keys, name)
+			values[name] = value.MapIndex(key)
+		}
+		sort.Strings(keys)
+
+		writeMsgpackHeader(buffer, len(keys), 0x80, 0xde, 0xdf)
+		for _, key := range keys {
+			writeMsgpackString(buffer, key)
+			if err := writeMsgpack(buffer, values[key]); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return fmt.Errorf("msgpack: unsupported type %s", value.Type())
+	}
+	return nil
+}
+
+// writeMsgpackHeader writes a length header using the fixed format for small
+// lengths and the 16 or 32 bit format for larger ones.
+func writeMsgpackHeader(buffer *bytes.Buffer, length int, fixed, format16, format32 byte) {
+	switch {
+	case length < 16:
+		buffer.WriteByte(fixed | byte(length))
+	case length <= math.MaxUint16:
+		buffer.WriteByte(format16)
+		binary.Write(buffer, binary.BigEndian, uint16(length))
+	default:
+		buffer.WriteByte(format32)
+		binary.Write(buffer, binary.BigEndian, uint32(length))
+	}
+}
+
+func writeMsgpackString(buffer *bytes.Buffer, value string) {
+	length := len(value)
+	switch {
+	case length < 32:
+		buffer.WriteByte(0xa0 | byte(length))
+	case length <= math.MaxUint8:
+		buffer.WriteByte(0xd9)
+		buffer.WriteByte(byte(length))
+	case length <= math.MaxUint16:
+		buffer.WriteByte(0xda)
+		binary.Write(buffer, binary.BigEndian, uint16(length))
+	default:
+		buffer.WriteByte(0xdb)
+		binary.Write(buffer, binary.BigEndian, uint32(length))
+	}
+	buffer.WriteString(value)
+}
+
+func writeMsgpackBinary(buffer *bytes.Buffer, value []byte) {
+	length := len(value)
+	switch {
+	case length <= math.MaxUint8:
+		buffer.WriteByte(0xc4)
+		buffer.WriteByte(byte(length))
+	case length <= math.MaxUint16:
+		buffer.WriteByte(0xc5)
+		binary.Write(buffer, binary.BigEndian, uint16(length))
+	default:
+		buffer.WriteByte(0xc6)
+		binary.Write(buffer, binary.BigEndian, uint32(length))
+	}
+	buffer.Write(value)
+}
+
+func writeMsgpackInt(buffer *bytes.Buffer, value int64) {
+	switch {
+	case value >= 0:
+		writeMsgpackUint(buffer, uint64(value))
+	case value >= -32:
+		buffer.WriteByte(byte(int8(value)))
+	case value >= math.MinInt8:
+		buffer.WriteByte(0xd0)
+		buffer.WriteByte(byte(int8(value)))
+	case value >= math.MinInt16:
+		buffer.WriteByte(0xd1)
+		binary.Write(buffer, binary.BigEndian, int16(value))
+	case value >= math.MinInt32:
+		buffer.WriteByte(0xd2)
+		binary.Write(buffer, binary.BigEndian, int32(value))
+	default:
+		buffer.WriteByte(0xd3)
+		binary.Write(buffer, binary.BigEndian, value)
+	}
+}
+
+func writeMsgpackUint(buffer *bytes.Buffer, value uint64) {
+	switch {
+	case value < 128:
+		buffer.WriteByte(byte(value))
+	case value <= math.MaxUint8:
+		buffer.WriteByte(0xcc)
+		buffer.WriteByte(byte(value))
+	case value <= math.MaxUint16:
+		buffer.WriteByte(0xcd)
+		binary.Write(buffer, binary.BigEndian, uint16(value))
+	case value <= math.MaxUint32:
+		buffer.WriteByte(0xce)
+		binary.Write(buffer, binary.BigEndian, uint32(value))
+	default:
+		buffer.WriteByte(0xcf)
+		binary.Write(buffer, binary.BigEndian, value)
+	}
+}
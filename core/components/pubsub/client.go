@@ -0,0 +1,107 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/pubsub"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
+)
+
+const (
+	emulatorEnv = "PUBSUB_EMULATOR_HOST"
+	projectEnv  = "GOOGLE_CLOUD_PROJECT"
+)
+
+// Credentials holds the settings used to access Pub/Sub
+type Credentials struct {
+	// ProjectID is used for topic and subscription names that are not fully
+	// qualified. If empty, the project of the credentials or the
+	// GOOGLE_CLOUD_PROJECT environment variable is used.
+	ProjectID string
+
+	// File is the path to a service account or authorized user JSON key
+	// file. If empty, application default credentials are used.
+	File string
+
+	// Endpoint overrides the address of the Pub/Sub gRPC API.
+	Endpoint string
+}
+
+// NewClient creates a new client for the given credentials. If the
+// PUBSUB_EMULATOR_HOST environment variable is set, the emulator is used
+// without authentication. Otherwise requests are authorized using the given
+// credentials file or application default credentials, including the service
+// account of a compute instance.
+func NewClient(ctx context.Context, credentials Credentials) (*pubsub.Client, error) {
+	projectID := credentials.ProjectID
+	options := []option.ClientOption{}
+	if credentials.Endpoint != "" {
+		options = append(options, option.WithEndpoint(credentials.Endpoint))
+	}
+
+	if os.Getenv(emulatorEnv) == "" {
+		googleCredentials, err := findCredentials(ctx, credentials.File)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, option.WithCredentials(googleCredentials))
+		if projectID == "" {
+			projectID = googleCredentials.ProjectID
+		}
+	}
+
+	if projectID == "" {
+		projectID = os.Getenv(projectEnv)
+	}
+	return pubsub.NewClient(ctx, projectID, options...)
+}
+
+// findCredentials reads the given credentials file or looks up application
+// default credentials if no file is given. If no application default
+// credentials are found, the service account of the compute instance is used
+// once the metadata server becomes reachable.
+func findCredentials(ctx context.Context, path string) (*google.Credentials, error) {
+	if path == "" {
+		if credentials, err := google.FindDefaultCredentials(ctx, pubsub.ScopePubSub); err == nil {
+			return credentials, nil // ### return, default credentials ###
+		}
+		return &google.Credentials{
+			TokenSource: google.ComputeTokenSource("", pubsub.ScopePubSub),
+		}, nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return google.CredentialsFromJSON(ctx, data, pubsub.ScopePubSub)
+}
+
+// SplitResourceName returns the project and the ID of a fully qualified
+// topic or subscription name like "projects/<project>/topics/<topic>".
+// Names that are not fully qualified are returned as ID without project.
+func SplitResourceName(name string) (project string, id string) {
+	parts := strings.Split(name, "/")
+	if len(parts) == 4 && parts[0] == "projects" {
+		return parts[1], parts[3]
+	}
+	return "", name
+}
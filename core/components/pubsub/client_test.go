@@ -0,0 +1,100 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestSplitResourceName(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	project, id := SplitResourceName("logs")
+	expect.Equal("", project)
+	expect.Equal("logs", id)
+
+	project, id = SplitResourceName("projects/gollum/subscriptions/logs")
+	expect.Equal("gollum", project)
+	expect.Equal("logs", id)
+}
+
+func TestNewClientEmulator(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	server := pstest.NewServer()
+	defer server.Close()
+
+	os.Setenv(emulatorEnv, server.Addr)
+	defer os.Unsetenv(emulatorEnv)
+	os.Setenv(projectEnv, "gollum")
+	defer os.Unsetenv(projectEnv)
+
+	// No credentials are required when using the emulator
+	client, err := NewClient(context.Background(), Credentials{File: "/does/not/exist"})
+	expect.NoError(err)
+	defer client.Close()
+
+	expect.Equal("projects/gollum/topics/logs", client.Topic("logs").String())
+
+	_, err = client.CreateTopic(context.Background(), "logs")
+	expect.NoError(err)
+}
+
+func TestNewClientCredentialsFile(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	expect.NoError(err)
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	keyFile, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "gollum",
+		"private_key_id": "key1",
+		"private_key":    string(keyPem),
+		"client_email":   "gollum@gollum.iam.gserviceaccount.com",
+		"token_uri":      "https://oauth2.googleapis.com/token",
+	})
+	expect.NoError(err)
+
+	path := filepath.Join(t.TempDir(), "key.json")
+	expect.NoError(ioutil.WriteFile(path, keyFile, 0600))
+
+	// The project is read from the key file unless it is set explicitly
+	client, err := NewClient(context.Background(), Credentials{File: path})
+	expect.NoError(err)
+	expect.Equal("projects/gollum/subscriptions/logs", client.Subscription("logs").String())
+	client.Close()
+
+	client, err = NewClient(context.Background(), Credentials{File: path, ProjectID: "other"})
+	expect.NoError(err)
+	expect.Equal("projects/other/subscriptions/logs", client.Subscription("logs").String())
+	client.Close()
+
+	_, err = NewClient(context.Background(), Credentials{File: filepath.Join(t.TempDir(), "missing.json")})
+	expect.NotNil(err)
+}
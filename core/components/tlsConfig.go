@@ -0,0 +1,89 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package components
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"gollum/core"
+)
+
+// ReadTLSKeyPair reads the client certificate configured either by the files
+// set in "TlsCertificateLocation" and "TlsKeyLocation" or by the PEM encoded
+// strings set in "TlsCertificatePem" and "TlsKeyPem". File and PEM form of a
+// value cannot be used together.
+// Nil is returned if no certificate has been configured.
+func ReadTLSKeyPair(conf core.PluginConfigReader) (*tls.Certificate, error) {
+	certPEM, err := readTLSPEM(conf, "TlsCertificateLocation", "TlsCertificatePem")
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := readTLSPEM(conf, "TlsKeyLocation", "TlsKeyPem")
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case certPEM == nil && keyPEM == nil:
+		return nil, nil
+	case certPEM == nil:
+		return nil, fmt.Errorf("Cannot specify a TLS key without TlsCertificateLocation or TlsCertificatePem")
+	case keyPEM == nil:
+		return nil, fmt.Errorf("Cannot specify a TLS certificate without TlsKeyLocation or TlsKeyPem")
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// ReadTLSCertPool reads the CA certificates configured either by the file set
+// in "TlsCaLocation" or by the PEM encoded string set in "TlsCaPem". Both
+// cannot be used together.
+// Nil is returned if no CA has been configured.
+func ReadTLSCertPool(conf core.PluginConfigReader) (*x509.CertPool, error) {
+	caPEM, err := readTLSPEM(conf, "TlsCaLocation", "TlsCaPem")
+	if err != nil || caPEM == nil {
+		return nil, err
+	}
+
+	caCertPool := x509.NewCertPool()
+	if !caCertPool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("No valid CA certificate found in TlsCaLocation or TlsCaPem")
+	}
+	return caCertPool, nil
+}
+
+// readTLSPEM returns the contents of the file set in fileKey or the string set
+// in pemKey. Nil is returned if neither is set.
+func readTLSPEM(conf core.PluginConfigReader, fileKey string, pemKey string) ([]byte, error) {
+	file := conf.GetString(fileKey, "")
+	pem := conf.GetString(pemKey, "")
+
+	switch {
+	case file != "" && pem != "":
+		return nil, fmt.Errorf("Cannot specify both %s and %s", fileKey, pemKey)
+	case pem != "":
+		return []byte(pem), nil
+	case file != "":
+		return ioutil.ReadFile(file)
+	}
+	return nil, nil
+}
@@ -0,0 +1,162 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package components
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+// newTestTLSKeyPair creates a PEM encoded, self-signed certificate and key
+func newTestTLSKeyPair(t *testing.T) (certPEM string, keyPEM string) {
+	expect := ttesting.NewExpect(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	expect.NoError(err)
+
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gollum"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	expect.NoError(err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	expect.NoError(err)
+
+	certPEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}))
+	keyPEM = string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return certPEM, keyPEM
+}
+
+func TestTLSFromPEM(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	certPEM, keyPEM := newTestTLSKeyPair(t)
+
+	config := core.NewPluginConfig("", "components.TLS")
+	config.Override("TlsCertificatePem", certPEM)
+	config.Override("TlsKeyPem", keyPEM)
+	config.Override("TlsCaPem", certPEM)
+	conf := core.NewPluginConfigReader(&config)
+
+	cert, err := ReadTLSKeyPair(conf)
+	expect.NoError(err)
+	expect.NotNil(cert)
+	expect.Equal(1, len(cert.Certificate))
+
+	pool, err := ReadTLSCertPool(conf)
+	expect.NoError(err)
+	expect.NotNil(pool)
+}
+
+func TestTLSFromFile(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	certPEM, keyPEM := newTestTLSKeyPair(t)
+
+	dir, err := ioutil.TempDir("", "gollum-tls")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	expect.NoError(ioutil.WriteFile(certFile, []byte(certPEM), 0600))
+	expect.NoError(ioutil.WriteFile(keyFile, []byte(keyPEM), 0600))
+
+	// File and PEM forms can be mixed across different values
+	config := core.NewPluginConfig("", "components.TLS")
+	config.Override("TlsCertificateLocation", certFile)
+	config.Override("TlsKeyPem", keyPEM)
+	config.Override("TlsCaLocation", certFile)
+	conf := core.NewPluginConfigReader(&config)
+
+	cert, err := ReadTLSKeyPair(conf)
+	expect.NoError(err)
+	expect.NotNil(cert)
+
+	pool, err := ReadTLSCertPool(conf)
+	expect.NoError(err)
+	expect.NotNil(pool)
+}
+
+func TestTLSNotConfigured(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "components.TLS")
+	conf := core.NewPluginConfigReader(&config)
+
+	cert, err := ReadTLSKeyPair(conf)
+	expect.NoError(err)
+	expect.Nil(cert)
+
+	pool, err := ReadTLSCertPool(conf)
+	expect.NoError(err)
+	expect.Nil(pool)
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	certPEM, keyPEM := newTestTLSKeyPair(t)
+
+	for _, settings := range []map[string]interface{}{
+		{"TlsCertificatePem": certPEM, "TlsCertificateLocation": "cert.pem", "TlsKeyPem": keyPEM},
+		{"TlsCertificatePem": certPEM, "TlsKeyPem": keyPEM, "TlsKeyLocation": "key.pem"},
+		{"TlsCertificatePem": certPEM},
+		{"TlsKeyPem": keyPEM},
+		{"TlsCertificatePem": keyPEM, "TlsKeyPem": certPEM},
+		{"TlsCertificateLocation": "/does/not/exist.pem", "TlsKeyPem": keyPEM},
+	} {
+		config := core.NewPluginConfig("", "components.TLS")
+		for key, value := range settings {
+			config.Override(key, value)
+		}
+		conf := core.NewPluginConfigReader(&config)
+
+		_, err := ReadTLSKeyPair(conf)
+		expect.NotNil(err)
+	}
+
+	for _, settings := range []map[string]interface{}{
+		{"TlsCaPem": certPEM, "TlsCaLocation": "ca.pem"},
+		{"TlsCaPem": "no certificate"},
+	} {
+		config := core.NewPluginConfig("", "components.TLS")
+		for key, value := range settings {
+			config.Override(key, value)
+		}
+		conf := core.NewPluginConfigReader(&config)
+
+		_, err := ReadTLSCertPool(conf)
+		expect.NotNil(err)
+	}
+}
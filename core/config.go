@@ -16,8 +16,14 @@ package core
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"github.com/trivago/tgo"
@@ -26,7 +32,10 @@ import (
 	yaml "gopkg.in/yaml.v2"
 )
 
-const pluginAggregate = "Aggregate"
+const (
+	pluginAggregate    = "Aggregate"
+	configFetchTimeout = 30 * time.Second
+)
 
 var (
 	consumerInterface = reflect.TypeOf((*Consumer)(nil)).Elem()
@@ -41,9 +50,33 @@ type Config struct {
 }
 
 // ReadConfig creates a config from a yaml byte stream.
+// Environment variables used as "${NAME}" or "${NAME:-default}" inside of
+// string values are replaced by their value. An error is returned if a
+// variable without default is not set. Use "$${NAME}" to keep the expression
+// as-is.
 func ReadConfig(buffer []byte) (*Config, error) {
-	config := new(Config)
-	if err := yaml.Unmarshal(buffer, &config.Values); err != nil {
+	values := make(map[string]tcontainer.MarshalMap)
+	if err := yaml.Unmarshal(buffer, &values); err != nil {
+		return nil, err
+	}
+	return newConfig(values)
+}
+
+// newConfig creates a config from the plugin configs read from one or more
+// yaml files.
+func newConfig(values map[string]tcontainer.MarshalMap) (*Config, error) {
+	config := &Config{
+		Values: values,
+	}
+
+	// Resolve environment variables before plugin configs are created so
+	// that all getters and aggregated plugins see the final values.
+	envErrors := tgo.NewErrorStack()
+	envErrors.SetFormat(tgo.ErrorStackFormatCSV)
+	for pluginID, configValues := range config.Values {
+		interpolateEnvValue(configValues, pluginID, &envErrors)
+	}
+	if err := envErrors.OrNil(); err != nil {
 		return nil, err
 	}
 
@@ -94,14 +127,139 @@ func ReadConfig(buffer []byte) (*Config, error) {
 	return config, nil
 }
 
+// ReadConfigFromReader parses YAML read from the given reader into a new
+// Config struct.
+func ReadConfigFromReader(reader io.Reader) (*Config, error) {
+	buffer, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	return ReadConfig(buffer)
+}
+
 // ReadConfigFromFile parses a YAML config file into a new Config struct.
+// If path is a directory, all "*.yaml" files in this directory are merged
+// as done by ReadConfigFromDirectory.
 func ReadConfigFromFile(path string) (*Config, error) {
-	buffer, err := ioutil.ReadFile(path)
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return ReadConfigFromDirectory(path)
+	}
+
+	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
+	defer file.Close()
 
-	return ReadConfig(buffer)
+	return ReadConfigFromReader(file)
+}
+
+// ReadConfigFromURL fetches a YAML config from the given http(s) URL. The
+// given header is added to the request, e.g. to pass an authorization token.
+// The fetched config is validated before it is returned. If cachePath is
+// set, a valid config is written to this file and the cached config is used
+// if the URL cannot be fetched or does not contain a valid config.
+func ReadConfigFromURL(address string, header http.Header, cachePath string) (*Config, error) {
+	buffer, config, err := fetchConfig(address, header)
+	if err != nil {
+		if cachePath == "" {
+			return nil, err
+		}
+		if _, statErr := os.Stat(cachePath); statErr != nil {
+			return nil, err
+		}
+		logrus.WithError(err).Warningf("Failed to fetch config from %s, using cached config %s", address, cachePath)
+		return ReadConfigFromFile(cachePath)
+	}
+
+	if cachePath != "" {
+		if err := ioutil.WriteFile(cachePath, buffer, 0600); err != nil {
+			logrus.WithError(err).Warningf("Failed to write config cache %s", cachePath)
+		}
+	}
+	return config, nil
+}
+
+// fetchConfig downloads, parses and validates the config at the given URL.
+func fetchConfig(address string, header http.Header) ([]byte, *Config, error) {
+	request, err := http.NewRequest(http.MethodGet, address, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	for key, values := range header {
+		for _, value := range values {
+			request.Header.Add(key, value)
+		}
+	}
+
+	client := &http.Client{Timeout: configFetchTimeout}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return nil, nil, fmt.Errorf("fetching %s returned %s", address, response.Status)
+	}
+
+	buffer, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config, err := ReadConfig(buffer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return buffer, config, nil
+}
+
+// ReadConfigFromDirectory merges all "*.yaml" files in the given directory
+// into a new Config struct. Files are read in sorted order.
+func ReadConfigFromDirectory(path string) (*Config, error) {
+	files, err := filepath.Glob(filepath.Join(path, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no *.yaml files found in %s", path)
+	}
+
+	sort.Strings(files)
+	return ReadConfigFromFiles(files...)
+}
+
+// ReadConfigFromFiles merges the given YAML config files into a new Config
+// struct. Plugin IDs must be unique across all files.
+func ReadConfigFromFiles(paths ...string) (*Config, error) {
+	values := make(map[string]tcontainer.MarshalMap)
+	definedIn := make(map[string]string)
+
+	for _, path := range paths {
+		buffer, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		fileValues := make(map[string]tcontainer.MarshalMap)
+		if err := yaml.Unmarshal(buffer, &fileValues); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err.Error())
+		}
+
+		for pluginID, configValues := range fileValues {
+			if otherPath, exists := definedIn[pluginID]; exists {
+				return nil, fmt.Errorf("plugin '%s' in %s is already defined in %s", pluginID, path, otherPath)
+			}
+			definedIn[pluginID] = path
+			values[pluginID] = configValues
+		}
+	}
+
+	return newConfig(values)
 }
 
 // Validate checks all plugin configs and plugins on validity. I.e. it checks
@@ -215,6 +373,55 @@ func (conf *Config) GetRouters() []PluginConfig {
 	return configs
 }
 
+// PluginConfigDiff lists the differences between two sets of plugin configs.
+// Plugins are matched by their ID.
+type PluginConfigDiff struct {
+	Added     []PluginConfig
+	Removed   []PluginConfig
+	Changed   []PluginConfig
+	Unchanged []PluginConfig
+}
+
+// IsEmpty returns true if no plugin has been added, removed or changed
+func (diff PluginConfigDiff) IsEmpty() bool {
+	return len(diff.Added) == 0 && len(diff.Removed) == 0 && len(diff.Changed) == 0
+}
+
+// DiffPluginConfigs compares the currently used plugin configs with a new set
+// of configs. Changed and unchanged plugins are returned with their new
+// config, removed plugins with their old config.
+func DiffPluginConfigs(oldConfigs []PluginConfig, newConfigs []PluginConfig) PluginConfigDiff {
+	diff := PluginConfigDiff{}
+	oldConfigByID := make(map[string]PluginConfig)
+	for _, config := range oldConfigs {
+		oldConfigByID[config.ID] = config
+	}
+
+	newIDs := make(map[string]bool)
+	for _, config := range newConfigs {
+		newIDs[config.ID] = true
+		oldConfig, exists := oldConfigByID[config.ID]
+		switch {
+		case !exists:
+			diff.Added = append(diff.Added, config)
+		case oldConfig.Typename != config.Typename ||
+			oldConfig.Enable != config.Enable ||
+			!reflect.DeepEqual(oldConfig.Settings, config.Settings):
+			diff.Changed = append(diff.Changed, config)
+		default:
+			diff.Unchanged = append(diff.Unchanged, config)
+		}
+	}
+
+	for _, config := range oldConfigs {
+		if !newIDs[config.ID] {
+			diff.Removed = append(diff.Removed, config)
+		}
+	}
+
+	return diff
+}
+
 func getClosestMatch(pluginType reflect.Type, errors *tgo.ErrorStack) {
 	consumerMatch, consumerMissing := treflect.GetMissingMethods(pluginType, consumerInterface)
 	producerMatch, producerMissing := treflect.GetMissingMethods(pluginType, producerInterface)
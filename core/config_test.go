@@ -15,6 +15,13 @@
 package core
 
 import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"testing"
@@ -162,3 +169,225 @@ func TestConfigGetPluginTypeMethods(t *testing.T) {
 		expect.Equal("core.TypeMockB", pluginConf.Typename)
 	}
 }
+
+func getPluginConfigIDs(configs []PluginConfig) []string {
+	IDs := []string{}
+	for _, config := range configs {
+		IDs = append(IDs, config.ID)
+	}
+	sort.Strings(IDs)
+	return IDs
+}
+
+func TestDiffPluginConfigs(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	oldConf, err := ReadConfig([]byte(`
+unchanged: {Type: consumer.Console, Streams: foo}
+settings: {Type: producer.Console, Streams: foo, Modulators: [format.Envelope]}
+typename: {Type: producer.Console, Streams: foo}
+disabled: {Type: producer.Console, Streams: foo}
+removed: {Type: consumer.Console, Streams: bar}
+`))
+	expect.NoError(err)
+
+	newConf, err := ReadConfig([]byte(`
+unchanged: {Type: consumer.Console, Streams: foo}
+settings: {Type: producer.Console, Streams: foo, Modulators: [format.Base64Encode]}
+typename: {Type: producer.File, Streams: foo}
+disabled: {Type: producer.Console, Streams: foo, Enable: false}
+added: {Type: consumer.Console, Streams: bar}
+`))
+	expect.NoError(err)
+
+	diff := DiffPluginConfigs(oldConf.Plugins, newConf.Plugins)
+	expect.False(diff.IsEmpty())
+	expect.Equal([]string{"added"}, getPluginConfigIDs(diff.Added))
+	expect.Equal([]string{"removed"}, getPluginConfigIDs(diff.Removed))
+	expect.Equal([]string{"disabled", "settings", "typename"}, getPluginConfigIDs(diff.Changed))
+	expect.Equal([]string{"unchanged"}, getPluginConfigIDs(diff.Unchanged))
+
+	// Changed plugins are returned with their new config
+	for _, config := range diff.Changed {
+		if config.ID == "typename" {
+			expect.Equal("producer.File", config.Typename)
+		}
+	}
+
+	// Comparing a config with itself yields no changes
+	diff = DiffPluginConfigs(newConf.Plugins, newConf.Plugins)
+	expect.True(diff.IsEmpty())
+	expect.Equal(len(newConf.Plugins), len(diff.Unchanged))
+}
+
+func writeConfigFiles(t *testing.T, files map[string]string) string {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-config")
+	expect.NoError(err)
+
+	for name, content := range files {
+		expect.NoError(ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestReadConfigFromDirectory(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	dir := writeConfigFiles(t, map[string]string{
+		"10-consumers.yaml": "in: {Type: core.TypeMockA, Streams: foo}",
+		"20-producers.yaml": "out: {Type: core.TypeMockC, Streams: foo}",
+		"ignored.txt":       "other: {Type: core.TypeMockC, Streams: foo}",
+	})
+	defer os.RemoveAll(dir)
+
+	TypeRegistry.Register(TypeMockA{})
+	TypeRegistry.Register(TypeMockC{})
+
+	conf, err := ReadConfigFromDirectory(dir)
+	expect.NoError(err)
+	expect.Equal(2, len(conf.Plugins))
+	expect.Equal(1, len(conf.GetConsumers()))
+	expect.Equal(1, len(conf.GetProducers()))
+
+	// Directories passed to ReadConfigFromFile are merged, too
+	conf, err = ReadConfigFromFile(dir)
+	expect.NoError(err)
+	expect.Equal(2, len(conf.Plugins))
+
+	emptyDir := writeConfigFiles(t, map[string]string{})
+	defer os.RemoveAll(emptyDir)
+
+	_, err = ReadConfigFromDirectory(emptyDir)
+	expect.NotNil(err)
+}
+
+func TestReadConfigFromDirectoryDuplicates(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	dir := writeConfigFiles(t, map[string]string{
+		"b.yaml": "dup: {Type: core.TypeMockC, Streams: bar}",
+		"a.yaml": "dup: {Type: core.TypeMockA, Streams: foo}",
+	})
+	defer os.RemoveAll(dir)
+
+	// Files are read in sorted order, so the later file is reported
+	_, err := ReadConfigFromDirectory(dir)
+	expect.NotNil(err)
+	if err != nil {
+		expect.Equal(fmt.Sprintf("plugin 'dup' in %s is already defined in %s",
+			filepath.Join(dir, "b.yaml"), filepath.Join(dir, "a.yaml")), err.Error())
+	}
+}
+
+func TestReadConfigFromFilesOrder(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	dir := writeConfigFiles(t, map[string]string{
+		"team1.yaml": "in: {Type: core.TypeMockA, Streams: foo}",
+		"team2.yaml": "in: {Type: core.TypeMockA, Streams: bar}",
+		"team3.yaml": "out: {Type: core.TypeMockC, Streams: \"${GOLLUM_TEST_UNSET:-foo}\"}",
+	})
+	defer os.RemoveAll(dir)
+
+	TypeRegistry.Register(TypeMockA{})
+	TypeRegistry.Register(TypeMockC{})
+
+	_, err := ReadConfigFromFiles(filepath.Join(dir, "team2.yaml"), filepath.Join(dir, "team1.yaml"))
+	expect.NotNil(err)
+	if err != nil {
+		expect.Equal(fmt.Sprintf("plugin 'in' in %s is already defined in %s",
+			filepath.Join(dir, "team1.yaml"), filepath.Join(dir, "team2.yaml")), err.Error())
+	}
+
+	conf, err := ReadConfigFromFiles(filepath.Join(dir, "team2.yaml"), filepath.Join(dir, "team3.yaml"))
+	expect.NoError(err)
+	expect.Equal(2, len(conf.Plugins))
+
+	producers := conf.GetProducers()
+	expect.Equal(1, len(producers))
+	reader := NewPluginConfigReader(&producers[0])
+	expect.Equal("foo", reader.GetString("Streams", ""))
+}
+
+func TestReadConfigFromReader(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	TypeRegistry.Register(TypeMockA{})
+
+	// Simulate stdin with a pipe
+	reader, writer, err := os.Pipe()
+	expect.NoError(err)
+	go func() {
+		writer.Write([]byte("in: {Type: core.TypeMockA, Streams: foo}"))
+		writer.Close()
+	}()
+
+	conf, err := ReadConfigFromReader(reader)
+	expect.NoError(err)
+	expect.Equal(1, len(conf.GetConsumers()))
+
+	_, err = ReadConfigFromReader(strings.NewReader("in: [invalid"))
+	expect.NotNil(err)
+}
+
+func TestReadConfigFromURL(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	TypeRegistry.Register(TypeMockA{})
+
+	body := "in: {Type: core.TypeMockA, Streams: foo}"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer secret")
+
+	conf, err := ReadConfigFromURL(server.URL, header, "")
+	expect.NoError(err)
+	expect.Equal(1, len(conf.GetConsumers()))
+
+	_, err = ReadConfigFromURL(server.URL, http.Header{}, "")
+	expect.NotNil(err)
+
+	// Invalid configs are not applied
+	body = "in: {Type: core.TypeDoesNotExist, Streams: foo}"
+	_, err = ReadConfigFromURL(server.URL, header, "")
+	expect.NotNil(err)
+}
+
+func TestReadConfigFromURLCache(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	TypeRegistry.Register(TypeMockA{})
+
+	dir := writeConfigFiles(t, map[string]string{})
+	defer os.RemoveAll(dir)
+	cachePath := filepath.Join(dir, "cache.yaml")
+
+	body := "in: {Type: core.TypeMockA, Streams: foo}"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	_, err := ReadConfigFromURL(server.URL, nil, cachePath)
+	expect.NoError(err)
+
+	cached, err := ioutil.ReadFile(cachePath)
+	expect.NoError(err)
+	expect.Equal(body, string(cached))
+
+	// Invalid remote configs fall back to the cache
+	body = "in: [invalid"
+	conf, err := ReadConfigFromURL(server.URL, nil, cachePath)
+	expect.NoError(err)
+	expect.Equal(1, len(conf.GetConsumers()))
+
+	// Unreachable URLs fall back to the cache
+	server.Close()
+	conf, err = ReadConfigFromURL(server.URL, nil, cachePath)
+	expect.NoError(err)
+	expect.Equal(1, len(conf.GetConsumers()))
+}
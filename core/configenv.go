@@ -0,0 +1,93 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package core
+
+import (
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/trivago/tgo"
+	"github.com/trivago/tgo/tcontainer"
+)
+
+// envVarExp matches "${NAME}" and "${NAME:-default}". A leading "$" escapes
+// the expression, i.e. "$${NAME}" is kept as "${NAME}".
+var envVarExp = regexp.MustCompile(`\$(\$?)\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// interpolateEnv replaces all environment variable expressions in the given
+// string. Variables without a default that are not set are pushed to errors.
+// All other occurrences of "$" are kept as-is.
+func interpolateEnv(value string, pluginID string, errors *tgo.ErrorStack) string {
+	if !strings.Contains(value, "${") {
+		return value // ### return, nothing to replace ###
+	}
+
+	result := strings.Builder{}
+	start := 0
+	for _, match := range envVarExp.FindAllStringSubmatchIndex(value, -1) {
+		result.WriteString(value[start:match[0]])
+		start = match[1]
+
+		if match[3] > match[2] {
+			result.WriteString(value[match[0]+1 : match[1]])
+			continue // ### continue, escaped ###
+		}
+
+		name := value[match[4]:match[5]]
+		envValue, isSet := os.LookupEnv(name)
+		switch {
+		case match[6] >= 0 && envValue == "":
+			result.WriteString(value[match[8]:match[9]])
+		case isSet:
+			result.WriteString(envValue)
+		default:
+			errors.Pushf("Environment variable '%s' used by '%s' is not set", name, pluginID)
+		}
+	}
+	result.WriteString(value[start:])
+	return result.String()
+}
+
+// interpolateEnvValue replaces environment variable expressions in all
+// strings stored in the given config value.
+func interpolateEnvValue(value interface{}, pluginID string, errors *tgo.ErrorStack) interface{} {
+	switch v := value.(type) {
+	case string:
+		return interpolateEnv(v, pluginID, errors)
+
+	case []interface{}:
+		for i, item := range v {
+			v[i] = interpolateEnvValue(item, pluginID, errors)
+		}
+
+	case map[interface{}]interface{}:
+		for key, item := range v {
+			v[key] = interpolateEnvValue(item, pluginID, errors)
+		}
+
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = interpolateEnvValue(item, pluginID, errors)
+		}
+
+	case tcontainer.MarshalMap:
+		for key, item := range v {
+			v[key] = interpolateEnvValue(item, pluginID, errors)
+		}
+	}
+	return value
+}
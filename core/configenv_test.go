@@ -0,0 +1,88 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package core
+
+import (
+	"os"
+	"testing"
+
+	"github.com/trivago/tgo"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestInterpolateEnv(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	os.Setenv("GOLLUM_TEST_PASSWORD", "secret")
+	os.Setenv("GOLLUM_TEST_EMPTY", "")
+	defer os.Unsetenv("GOLLUM_TEST_PASSWORD")
+	defer os.Unsetenv("GOLLUM_TEST_EMPTY")
+
+	errors := tgo.NewErrorStack()
+	expect.Equal("secret", interpolateEnv("${GOLLUM_TEST_PASSWORD}", "test", &errors))
+	expect.Equal("user:secret@host", interpolateEnv("user:${GOLLUM_TEST_PASSWORD}@host", "test", &errors))
+	expect.Equal("localhost:9092", interpolateEnv("${GOLLUM_TEST_UNSET:-localhost:9092}", "test", &errors))
+	expect.Equal("default", interpolateEnv("${GOLLUM_TEST_EMPTY:-default}", "test", &errors))
+	expect.Equal("secret", interpolateEnv("${GOLLUM_TEST_PASSWORD:-default}", "test", &errors))
+	expect.Equal("", interpolateEnv("${GOLLUM_TEST_EMPTY}", "test", &errors))
+	expect.Equal("", interpolateEnv("${GOLLUM_TEST_UNSET:-}", "test", &errors))
+	expect.NoError(errors.OrNil())
+
+	expect.Equal("", interpolateEnv("${GOLLUM_TEST_UNSET}", "test", &errors))
+	expect.NotNil(errors.OrNil())
+}
+
+func TestInterpolateEnvEscaping(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	os.Setenv("GOLLUM_TEST_PASSWORD", "secret")
+	defer os.Unsetenv("GOLLUM_TEST_PASSWORD")
+
+	errors := tgo.NewErrorStack()
+	expect.Equal("${GOLLUM_TEST_PASSWORD}", interpolateEnv("$${GOLLUM_TEST_PASSWORD}", "test", &errors))
+	expect.Equal("price: 5$", interpolateEnv("price: 5$", "test", &errors))
+	expect.Equal("^[a-z]+$", interpolateEnv("^[a-z]+$", "test", &errors))
+	expect.Equal("time: ${1}", interpolateEnv("time: ${1}", "test", &errors))
+	expect.Equal("$HOME", interpolateEnv("$HOME", "test", &errors))
+	expect.Equal("${}", interpolateEnv("${}", "test", &errors))
+	expect.NoError(errors.OrNil())
+}
+
+func TestReadConfigEnv(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	os.Setenv("GOLLUM_TEST_PASSWORD", "secret")
+	defer os.Unsetenv("GOLLUM_TEST_PASSWORD")
+
+	conf, err := ReadConfig([]byte(`
+kafka:
+  Type: Aggregate
+  Servers:
+    - ${GOLLUM_TEST_SERVER:-localhost:9092}
+  Plugins:
+    consumer:
+      Type: consumer.Kafka
+      SaslPassword: ${GOLLUM_TEST_PASSWORD}
+      Template: "$${GOLLUM_TEST_PASSWORD} ${1}"
+`))
+	expect.NoError(err)
+	expect.Equal(1, len(conf.Plugins))
+
+	reader := NewPluginConfigReader(&conf.Plugins[0])
+	expect.Equal("secret", reader.GetString("SaslPassword", ""))
+	expect.Equal("${GOLLUM_TEST_PASSWORD} ${1}", reader.GetString("Template", ""))
+	expect.Equal([]string{"localhost:9092"}, reader.GetStringArray("Servers", []string{}))
+
+	_, err = ReadConfig([]byte("consumer: {Type: consumer.Kafka, SaslPassword: ${GOLLUM_TEST_UNSET}}"))
+	expect.NotNil(err)
+}
@@ -45,7 +45,7 @@ func (prod *DirectProducer) Enqueue(msg *Message, timeout time.Duration) {
 		return // ### return, closing down ###
 	}
 
-	if !prod.HasContinueAfterModulate(msg) {
+	if !prod.HasContinueAfterModulate(msg) || prod.DropIfExpired(msg) {
 		return
 	}
 
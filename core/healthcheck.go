@@ -0,0 +1,69 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/trivago/tgo/thealthcheck"
+)
+
+var (
+	healthChecks      = make(map[string]thealthcheck.CallbackFunc)
+	healthChecksGuard = new(sync.RWMutex)
+)
+
+// AddHealthCheckEndpoint serves a health check at the given path. Other than
+// thealthcheck.AddEndpoint an already registered path is not rejected but gets
+// its callback replaced. This allows plugins to be recreated with the same ID,
+// e.g. when the configuration is reloaded.
+func AddHealthCheckEndpoint(path string, callback thealthcheck.CallbackFunc) {
+	healthChecksGuard.Lock()
+	defer healthChecksGuard.Unlock()
+
+	if _, registered := healthChecks[path]; !registered {
+		thealthcheck.AddEndpoint(path, func() (code int, body string) {
+			return callHealthCheck(path)
+		})
+	}
+	healthChecks[path] = callback
+}
+
+// RemovePluginHealthChecks disables all health checks of the given plugin.
+// Disabled endpoints report "REMOVED" until they are added again. They do not
+// fail, so that the aggregated health check at "/_ALL_" is not affected.
+func RemovePluginHealthChecks(pluginID string) {
+	healthChecksGuard.Lock()
+	defer healthChecksGuard.Unlock()
+
+	pluginPath := "/" + pluginID
+	for path := range healthChecks {
+		if path == pluginPath || strings.HasPrefix(path, pluginPath+"/") {
+			healthChecks[path] = nil
+		}
+	}
+}
+
+func callHealthCheck(path string) (code int, body string) {
+	healthChecksGuard.RLock()
+	callback := healthChecks[path]
+	healthChecksGuard.RUnlock()
+
+	if callback == nil {
+		return thealthcheck.StatusOK, "REMOVED"
+	}
+	return callback()
+}
@@ -23,6 +23,7 @@ import (
 
 	"github.com/rcrowley/go-metrics"
 	"github.com/sirupsen/logrus"
+	"github.com/trivago/tgo/thealthcheck"
 )
 
 // LogConsumer is an internal consumer plugin used indirectly by the gollum log
@@ -90,6 +91,11 @@ func (cons *LogConsumer) GetShutdownTimeout() time.Duration {
 	return time.Millisecond
 }
 
+// HealthCheck always returns StatusOK
+func (cons *LogConsumer) HealthCheck() (code int, body string) {
+	return thealthcheck.StatusOK, "OK"
+}
+
 // Control returns a handle to the control channel
 func (cons *LogConsumer) Control() chan<- PluginControl {
 	return cons.control
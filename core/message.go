@@ -41,6 +41,8 @@ type Message struct {
 	origStreamID MessageStreamID
 	source       MessageSource
 	timestamp    int64
+	traceID      string
+	spanID       string
 }
 
 // NewMessage creates a new message from a given data stream by copying data.
@@ -122,6 +124,31 @@ func (msg *Message) GetSource() MessageSource {
 	return msg.source
 }
 
+// GetTraceID returns the ID of the trace this message belongs to or an empty
+// string if no trace ID has been set.
+func (msg *Message) GetTraceID() string {
+	return msg.traceID
+}
+
+// SetTraceID sets the ID of the trace this message belongs to. Other than
+// metadata, the trace ID is not affected by formatters and is always
+// preserved by Serialize.
+func (msg *Message) SetTraceID(traceID string) {
+	msg.traceID = traceID
+}
+
+// GetSpanID returns the ID of the span this message belongs to or an empty
+// string if no span ID has been set.
+func (msg *Message) GetSpanID() string {
+	return msg.spanID
+}
+
+// SetSpanID sets the ID of the span this message belongs to. The span ID is
+// preserved by Serialize, too.
+func (msg *Message) SetSpanID(spanID string) {
+	msg.spanID = spanID
+}
+
 // String implements the stringer interface
 func (msg *Message) String() string {
 	return string(msg.data.payload)
@@ -217,6 +244,14 @@ func (msg *Message) FreezeOriginal() {
 	}
 }
 
+// ResetOriginal discards the original data stored by FreezeOriginal, so that
+// the next call to FreezeOriginal or CloneOriginal stores the message state at
+// that point in time. This is e.g. required when a message is routed again
+// after it has been passed to a fallback.
+func (msg *Message) ResetOriginal() {
+	msg.orig = nil
+}
+
 // Serialize generates a new payload containing all data that can be preserved
 // over shutdown (i.e. no data directly referencing runtime components). The
 // serialized data is based on the current message state and does not preserve
@@ -242,6 +277,13 @@ func (msg *Message) Serialize() ([]byte, error) {
 		},
 	}
 
+	if msg.traceID != "" {
+		serializable.TraceID = proto.String(msg.traceID)
+	}
+	if msg.spanID != "" {
+		serializable.SpanID = proto.String(msg.spanID)
+	}
+
 	if msg.orig != nil {
 		origMetaBuffer := bytes.NewBuffer([]byte{})
 		if len(msg.orig.metadata) > 0 {
@@ -272,6 +314,8 @@ func DeserializeMessage(data []byte) (*Message, error) {
 		prevStreamID: MessageStreamID(serializable.GetPrevStreamID()),
 		origStreamID: MessageStreamID(serializable.GetOrigStreamID()),
 		timestamp:    serializable.GetTimestamp(),
+		traceID:      serializable.GetTraceID(),
+		spanID:       serializable.GetSpanID(),
 	}
 
 	if msgData := serializable.GetData(); msgData != nil {
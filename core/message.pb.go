@@ -61,6 +61,8 @@ type SerializedMessage struct {
 	OrigStreamID     *uint64                `protobuf:"varint,4,opt,name=OrigStreamID" json:"OrigStreamID,omitempty"`
 	Timestamp        *int64                 `protobuf:"varint,5,opt,name=Timestamp" json:"Timestamp,omitempty"`
 	Original         *SerializedMessageData `protobuf:"bytes,6,opt,name=Original" json:"Original,omitempty"`
+	TraceID          *string                `protobuf:"bytes,7,opt,name=TraceID" json:"TraceID,omitempty"`
+	SpanID           *string                `protobuf:"bytes,8,opt,name=SpanID" json:"SpanID,omitempty"`
 	XXX_unrecognized []byte                 `json:"-"`
 }
 
@@ -111,6 +113,20 @@ func (m *SerializedMessage) GetOriginal() *SerializedMessageData {
 	return nil
 }
 
+func (m *SerializedMessage) GetTraceID() string {
+	if m != nil && m.TraceID != nil {
+		return *m.TraceID
+	}
+	return ""
+}
+
+func (m *SerializedMessage) GetSpanID() string {
+	if m != nil && m.SpanID != nil {
+		return *m.SpanID
+	}
+	return ""
+}
+
 func init() {
 	proto.RegisterType((*SerializedMessageData)(nil), "serializedMessageData")
 	proto.RegisterType((*SerializedMessage)(nil), "serializedMessage")
@@ -119,19 +135,20 @@ func init() {
 func init() { proto.RegisterFile("message.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 210 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0xcd, 0x4d, 0x2d, 0x2e,
-	0x4e, 0x4c, 0x4f, 0xd5, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x57, 0x72, 0xe7, 0x12, 0x2d, 0x4e, 0x2d,
-	0xca, 0x4c, 0xcc, 0xc9, 0xac, 0x4a, 0x4d, 0xf1, 0x85, 0x48, 0xb9, 0x24, 0x96, 0x24, 0x0a, 0x09,
-	0x71, 0xb1, 0x80, 0x68, 0x09, 0x46, 0x05, 0x26, 0x0d, 0x9e, 0x20, 0x30, 0x5b, 0x48, 0x8a, 0x8b,
-	0xc3, 0x37, 0xb5, 0x24, 0x31, 0x05, 0x24, 0xce, 0xac, 0xc0, 0xa8, 0xc1, 0x13, 0x04, 0xe7, 0x2b,
-	0x7d, 0x65, 0xe4, 0x12, 0xc4, 0x30, 0x09, 0xa4, 0x23, 0xb8, 0xa4, 0x28, 0x35, 0x31, 0xd7, 0xd3,
-	0x05, 0x6c, 0x12, 0x4b, 0x10, 0x9c, 0x2f, 0xa4, 0x05, 0xb5, 0x81, 0x49, 0x81, 0x49, 0x83, 0xdb,
-	0x48, 0x4c, 0x0f, 0xab, 0x3b, 0xa0, 0x36, 0x2b, 0x71, 0xf1, 0x04, 0x14, 0xa5, 0x96, 0xc1, 0xcd,
-	0x02, 0xd9, 0xce, 0x12, 0x84, 0x22, 0x06, 0x52, 0xe3, 0x5f, 0x94, 0x99, 0x0e, 0x57, 0xc3, 0x02,
-	0x51, 0x83, 0x2c, 0x26, 0x24, 0xc3, 0xc5, 0x19, 0x92, 0x99, 0x9b, 0x5a, 0x5c, 0x92, 0x98, 0x5b,
-	0x20, 0xc1, 0xaa, 0xc0, 0xa8, 0xc1, 0x1c, 0x84, 0x10, 0x10, 0x32, 0xe2, 0xe2, 0x00, 0xa9, 0xce,
-	0xcc, 0x4b, 0xcc, 0x91, 0x60, 0x53, 0x60, 0xc4, 0xe3, 0x2a, 0xb8, 0x3a, 0x27, 0xb6, 0x28, 0x96,
-	0xe4, 0xfc, 0xa2, 0x54, 0x40, 0x00, 0x00, 0x00, 0xff, 0xff, 0x1a, 0xe9, 0xdd, 0x67, 0x58, 0x01,
-	0x00, 0x00,
+	// 240 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x8e, 0x41, 0x4b, 0x03, 0x31,
+	0x10, 0x85, 0xc9, 0x36, 0x6e, 0xb7, 0xe3, 0x7a, 0x30, 0x60, 0x09, 0xe2, 0x21, 0xec, 0x29, 0x78,
+	0xe8, 0xa1, 0x3f, 0x41, 0x16, 0x64, 0x0f, 0x45, 0x49, 0x7b, 0xf2, 0x36, 0xb4, 0x43, 0x09, 0x74,
+	0xbb, 0x4b, 0x12, 0x3c, 0xf8, 0x87, 0xfc, 0x9b, 0x92, 0xdd, 0x35, 0x2a, 0x8a, 0xa7, 0xe4, 0xbd,
+	0xf9, 0xe6, 0xbd, 0x81, 0xab, 0x96, 0xbc, 0xc7, 0x23, 0xad, 0x7a, 0xd7, 0x85, 0xae, 0x7a, 0x84,
+	0x1b, 0x4f, 0xce, 0xe2, 0xc9, 0xbe, 0xd1, 0x61, 0x33, 0x8e, 0x6a, 0x0c, 0x28, 0x04, 0xf0, 0xf8,
+	0x4a, 0xa6, 0x32, 0x5d, 0x9a, 0xe1, 0x2f, 0x6e, 0xa1, 0xd8, 0x50, 0xc0, 0x43, 0xf4, 0x67, 0x8a,
+	0xe9, 0xd2, 0x24, 0x5d, 0xbd, 0x67, 0x70, 0xfd, 0x2b, 0x29, 0x6e, 0x6c, 0x83, 0x23, 0x6c, 0x9b,
+	0x7a, 0x48, 0xe2, 0x26, 0x69, 0x71, 0x3f, 0x35, 0x64, 0x2a, 0xd3, 0x97, 0xeb, 0xe5, 0xea, 0xcf,
+	0x3b, 0xa6, 0xe6, 0x0a, 0xca, 0x67, 0x47, 0xaf, 0x29, 0x2b, 0xb6, 0x73, 0xf3, 0xc3, 0x8b, 0xcc,
+	0x93, 0xb3, 0xc7, 0xc4, 0xf0, 0x91, 0xf9, 0xee, 0x89, 0x3b, 0x58, 0xec, 0x6c, 0x4b, 0x3e, 0x60,
+	0xdb, 0xcb, 0x0b, 0xc5, 0xf4, 0xcc, 0x7c, 0x19, 0x62, 0x0d, 0x45, 0xa4, 0xed, 0x19, 0x4f, 0x32,
+	0x57, 0xec, 0x9f, 0xab, 0x12, 0x27, 0x24, 0xcc, 0x77, 0x0e, 0xf7, 0xd4, 0xd4, 0x72, 0xae, 0x98,
+	0x5e, 0x98, 0x4f, 0x29, 0x96, 0x90, 0x6f, 0x7b, 0x3c, 0x37, 0xb5, 0x2c, 0x86, 0xc1, 0xa4, 0x1e,
+	0xf2, 0x17, 0xbe, 0xef, 0x1c, 0x7d, 0x0c, 0x00, 0xa4, 0x3b, 0xb7, 0x7a, 0x8a, 0x01, 0x00, 0x00,
 }
@@ -177,6 +177,26 @@ func TestMessageCloneOriginalMetadata(t *testing.T) {
 	expect.Equal(msgString, string(clone.GetPayload()))
 }
 
+func TestMessageResetOriginal(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	msg := NewMessage(nil, []byte("original"), tcontainer.MarshalMap{"foo": "original_bar"}, 1)
+	msg.FreezeOriginal()
+
+	msg.StorePayload([]byte("changed"))
+	msg.GetMetadata().Set("foo", "bar")
+	msg.ResetOriginal()
+	expect.Nil(msg.orig)
+
+	// The current state becomes the new original
+	clone := msg.CloneOriginal()
+	expect.Equal("changed", clone.String())
+
+	value, err := clone.GetMetadata().String("foo")
+	expect.NoError(err)
+	expect.Equal("bar", value)
+}
+
 func TestMessageMetadata(t *testing.T) {
 	expect := ttesting.NewExpect(t)
 
@@ -259,3 +279,33 @@ func TestMessageSerialize(t *testing.T) {
 	expect.Equal(testMessage.orig.payload, readMessage.orig.payload)
 	expect.Equal(testMessage.orig.metadata, readMessage.orig.metadata)
 }
+
+func TestMessageSerializeTraceID(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	testMessage := NewMessage(nil, []byte("payload"), nil, 1)
+
+	data, err := testMessage.Serialize()
+	expect.NoError(err)
+
+	readMessage, err := DeserializeMessage(data)
+	expect.NoError(err)
+	expect.Equal("", readMessage.GetTraceID())
+	expect.Equal("", readMessage.GetSpanID())
+
+	testMessage.SetTraceID("4bf92f3577b34da6a3ce929d0e0e4736")
+	testMessage.SetSpanID("00f067aa0ba902b7")
+
+	// Trace IDs are kept when cloning, even if metadata is reset
+	clone := testMessage.CloneOriginal()
+	expect.Equal("4bf92f3577b34da6a3ce929d0e0e4736", clone.GetTraceID())
+	expect.Equal("00f067aa0ba902b7", clone.GetSpanID())
+
+	data, err = testMessage.Serialize()
+	expect.NoError(err)
+
+	readMessage, err = DeserializeMessage(data)
+	expect.NoError(err)
+	expect.Equal("4bf92f3577b34da6a3ce929d0e0e4736", readMessage.GetTraceID())
+	expect.Equal("00f067aa0ba902b7", readMessage.GetSpanID())
+	expect.Equal(testMessage.data.payload, readMessage.data.payload)
+}
@@ -39,7 +39,7 @@ func getMetadataContent(msg *Message, key string) interface{} {
 	if metadata == nil {
 		return []byte{}
 	}
-	if data, ok := metadata.Value(key); ok {
+	if data, ok := GetValuePath(metadata, key); ok {
 		return data
 	}
 	return []byte{}
@@ -78,11 +78,17 @@ func forceMetadataRoot(msg *Message, root string) tcontainer.MarshalMap {
 		return rootValue
 	}
 
+	if rootValue, isMap := val.(tcontainer.MarshalMap); isMap {
+		return rootValue // ### return, modifications apply to the message ###
+	}
+
+	// Conversion creates a new map, so it has to be stored for modifications
+	// to apply to the message.
 	rootValue, err := tcontainer.ConvertToMarshalMap(val, nil)
 	if err != nil {
 		rootValue = tcontainer.MarshalMap{}
-		metadata.Set(root, rootValue)
 	}
+	metadata.Set(root, rootValue)
 	return rootValue
 }
 
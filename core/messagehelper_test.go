@@ -62,3 +62,24 @@ func TestGetTargetDataFromMetadata(t *testing.T) {
 
 	expect.Equal("foo content", resultFunc(msg).(string))
 }
+
+func TestForceMetadataRoot(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	resultFunc := NewForceMetadataRootGetterFor("foo")
+
+	msg := NewMessage(nil, []byte("message payload"), nil, 1)
+	msg.GetMetadata().Set("foo", map[string]interface{}{"a": "b"})
+	resultFunc(msg).Set("c", "d")
+
+	root, err := msg.GetMetadata().MarshalMap("foo")
+	expect.NoError(err)
+	expect.MapEqual(root, "a", "b")
+	expect.MapEqual(root, "c", "d")
+
+	msg.GetMetadata().Set("foo", "not a map")
+	resultFunc(msg).Set("c", "d")
+
+	root, err = msg.GetMetadata().MarshalMap("foo")
+	expect.NoError(err)
+	expect.MapEqual(root, "c", "d")
+}
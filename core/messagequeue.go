@@ -15,8 +15,11 @@
 package core
 
 import (
-	"github.com/trivago/tgo/tsync"
+	"sync/atomic"
 	"time"
+
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/trivago/tgo/tsync"
 )
 
 // MessageQueue is the type used for transferring messages between plugins
@@ -34,11 +37,52 @@ const (
 	MessageQueueDiscard = MessageQueueResult(iota)
 )
 
+// MessageQueueMetrics exposes the fill level of a MessageQueue as metrics.
+// Depth holds the number of messages queued at the last update, HighWaterMark
+// holds the highest number of queued messages seen so far.
+type MessageQueueMetrics struct {
+	queue         MessageQueue
+	maxQueued     int64
+	Depth         metrics.Gauge
+	HighWaterMark metrics.Gauge
+}
+
 // NewMessageQueue creates a new message buffer of the given capacity
 func NewMessageQueue(capacity int) MessageQueue {
 	return make(MessageQueue, capacity)
 }
 
+// NewMessageQueueMetrics creates metrics for the given queue and registers
+// them as "<prefix>.queue.depth" and "<prefix>.queue.max", where prefix is
+// usually the ID of the plugin owning the queue.
+func NewMessageQueueMetrics(queue MessageQueue, prefix string) *MessageQueueMetrics {
+	registry := NewMetricsRegistry(prefix)
+	return &MessageQueueMetrics{
+		queue:         queue,
+		Depth:         metrics.GetOrRegisterGauge("queue.depth", registry),
+		HighWaterMark: metrics.GetOrRegisterGauge("queue.max", registry),
+	}
+}
+
+// Update sets the metrics to the current fill level of the queue. This
+// function should be called whenever messages are pushed to or popped from
+// the queue.
+func (queueMetrics *MessageQueueMetrics) Update() {
+	queued := int64(queueMetrics.queue.GetNumQueued())
+	queueMetrics.Depth.Update(queued)
+
+	for {
+		maxQueued := atomic.LoadInt64(&queueMetrics.maxQueued)
+		if queued <= maxQueued {
+			return // ### return, no new maximum ###
+		}
+		if atomic.CompareAndSwapInt64(&queueMetrics.maxQueued, maxQueued, queued) {
+			queueMetrics.HighWaterMark.Update(queued)
+			return // ### return, new maximum ###
+		}
+	}
+}
+
 // Push adds a message to the MessageStream.
 // waiting for a timeout instead of just blocking.
 // Passing a timeout of -1 will discard the message.
@@ -14,9 +14,61 @@
 
 package core
 
-import "github.com/trivago/tgo/tcontainer"
+import (
+	"strings"
+
+	"github.com/trivago/tgo/tcontainer"
+)
 
 // NewMetadata returns an empty metadata container
 func NewMetadata() tcontainer.MarshalMap {
 	return tcontainer.NewMarshalMap()
 }
+
+// GetValuePath returns the metadata value stored at the given path.
+// Paths use the same notation as the config reader, i.e. nested fields are
+// separated by "/" and arrays are addressed by "[<index>]", e.g. "user/id" or
+// "items[0]/name". A key that contains a "/" is still found if it is stored
+// directly, so flat keys keep working.
+func GetValuePath(metadata tcontainer.MarshalMap, path string) (interface{}, bool) {
+	if metadata == nil {
+		return nil, false
+	}
+	if value, exists := metadata.Value(path); exists {
+		return value, true
+	}
+
+	// MarshalMap expects no separator after an array index, i.e. "items[0]name"
+	if arrayPath := strings.Replace(path, "]/", "]", -1); arrayPath != path {
+		return metadata.Value(arrayPath)
+	}
+	return nil, false
+}
+
+// SetValuePath stores a metadata value at the given path. Other than
+// MarshalMap.Set, missing or non-map parents are replaced by empty maps, so
+// e.g. "user/id" can be set on empty metadata. Paths addressing array
+// elements are passed to MarshalMap.Set and require the array to exist.
+func SetValuePath(metadata tcontainer.MarshalMap, path string, value interface{}) {
+	if strings.ContainsRune(path, tcontainer.MarshalMapArrayBegin) {
+		metadata.Set(path, value)
+		return // ### return, array path ###
+	}
+
+	if _, exists := metadata[path]; exists {
+		metadata[path] = value
+		return // ### return, flat key ###
+	}
+
+	keys := strings.Split(path, string(tcontainer.MarshalMapSeparator))
+	parent := metadata
+	for _, key := range keys[:len(keys)-1] {
+		child, err := tcontainer.ConvertToMarshalMap(parent[key], nil)
+		if err != nil || child == nil {
+			child = tcontainer.NewMarshalMap()
+		}
+		parent[key] = child
+		parent = child
+	}
+	parent[keys[len(keys)-1]] = value
+}
@@ -17,6 +17,7 @@ package core
 import (
 	"testing"
 
+	"github.com/trivago/tgo/tcontainer"
 	"github.com/trivago/tgo/ttesting"
 )
 
@@ -53,3 +54,64 @@ func TestMetadataSetGet(t *testing.T) {
 	expect.True(exists)
 	expect.Equal("foo_value", ifaceVal.(string))
 }
+
+func TestMetadataValuePath(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	meta := NewMetadata()
+	meta.Set("user", tcontainer.MarshalMap{
+		"id":    "42",
+		"roles": []interface{}{"admin", "dev"},
+	})
+	meta["flat/key"] = "flat"
+
+	val, exists := GetValuePath(meta, "user/id")
+	expect.True(exists)
+	expect.Equal("42", val)
+
+	val, exists = GetValuePath(meta, "user/roles[1]")
+	expect.True(exists)
+	expect.Equal("dev", val)
+
+	meta.Set("items", []interface{}{
+		tcontainer.MarshalMap{"name": "first"},
+		tcontainer.MarshalMap{"name": "second"},
+	})
+
+	val, exists = GetValuePath(meta, "items[1]/name")
+	expect.True(exists)
+	expect.Equal("second", val)
+
+	val, exists = GetValuePath(meta, "items[1]name")
+	expect.True(exists)
+	expect.Equal("second", val)
+
+	val, exists = GetValuePath(meta, "flat/key")
+	expect.True(exists)
+	expect.Equal("flat", val)
+
+	_, exists = GetValuePath(meta, "user/name")
+	expect.False(exists)
+
+	_, exists = GetValuePath(nil, "user/id")
+	expect.False(exists)
+
+	SetValuePath(meta, "user/name", "bob")
+	val, exists = GetValuePath(meta, "user/name")
+	expect.True(exists)
+	expect.Equal("bob", val)
+
+	SetValuePath(meta, "a/b/c", 1)
+	val, exists = GetValuePath(meta, "a/b/c")
+	expect.True(exists)
+	expect.Equal(1, val)
+
+	SetValuePath(meta, "flat/key", "changed")
+	expect.Equal("changed", meta["flat/key"])
+
+	// Non-map parents are replaced
+	SetValuePath(meta, "user/id/value", "43")
+	val, exists = GetValuePath(meta, "user/id/value")
+	expect.True(exists)
+	expect.Equal("43", val)
+}
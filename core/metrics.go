@@ -71,6 +71,18 @@ var (
 	MetricMessagesEnqued metrics.Counter
 	// MetricMessagesDiscarded holds the total number of discarded messages
 	MetricMessagesDiscarded metrics.Counter
+	// MetricMessagesExpired holds the total number of messages dropped by
+	// producers because they exceeded MaxAgeSec
+	MetricMessagesExpired metrics.Counter
+	// MetricMessagesOversizeDropped holds the total number of messages dropped
+	// by consumers because they exceeded MaxMessageBytes
+	MetricMessagesOversizeDropped metrics.Counter
+	// MetricMessagesOversizeTruncated holds the total number of messages
+	// truncated by consumers because they exceeded MaxMessageBytes
+	MetricMessagesOversizeTruncated metrics.Counter
+	// MetricMessagesOverflowDropped holds the total number of messages dropped
+	// by consumers because of their OverflowPolicy
+	MetricMessagesOverflowDropped metrics.Counter
 )
 
 func init() {
@@ -83,6 +95,10 @@ func init() {
 	MetricMessagesRouted = metrics.NewRegisteredCounter("routed", MetricsRegistry)
 	MetricMessagesEnqued = metrics.NewRegisteredCounter("enqueued", MetricsRegistry)
 	MetricMessagesDiscarded = metrics.NewRegisteredCounter("discarded", MetricsRegistry)
+	MetricMessagesExpired = metrics.NewRegisteredCounter("dropped_expired", MetricsRegistry)
+	MetricMessagesOversizeDropped = metrics.NewRegisteredCounter("oversize_dropped", MetricsRegistry)
+	MetricMessagesOversizeTruncated = metrics.NewRegisteredCounter("oversize_truncated", MetricsRegistry)
+	MetricMessagesOverflowDropped = metrics.NewRegisteredCounter("overflow_dropped", MetricsRegistry)
 	MetricActiveWorkers = metrics.NewRegisteredCounter("workers", MetricsRegistry)
 
 	pluginMetricsRegistry = NewMetricsRegistry("plugins")
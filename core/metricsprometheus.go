@@ -0,0 +1,143 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+var prometheusQuantiles = []float64{0.5, 0.75, 0.95, 0.99, 0.999}
+
+// PrometheusCollector exports all metrics of a go-metrics registry in the
+// Prometheus format. Values are read from the registry on each scrape, so
+// metrics registered later on, e.g. by NewMetricsRegistryForPlugin, are
+// exported as well.
+// Metric names are prefixed with the namespace and all characters not valid
+// in Prometheus metric names are replaced by "_", i.e. the metric "sent" of
+// the plugin "kafka-out" is exported as "gollum_kafka_out_sent".
+// Counters and gauges are exported as is, meters as "<name>_total" counter
+// and "<name>_rate1" gauge, histograms as summary and timers as summary with
+// values in seconds named "<name>_seconds".
+type PrometheusCollector struct {
+	registry  metrics.Registry
+	namespace string
+}
+
+// NewPrometheusCollector creates a collector for the given registry
+func NewPrometheusCollector(registry metrics.Registry, namespace string) *PrometheusCollector {
+	return &PrometheusCollector{
+		registry:  registry,
+		namespace: namespace,
+	}
+}
+
+// Describe sends no descriptions, making this an unchecked collector as the
+// set of metrics changes at runtime.
+func (c *PrometheusCollector) Describe(chan<- *prometheus.Desc) {
+}
+
+// Collect sends the current values of all metrics in the registry
+func (c *PrometheusCollector) Collect(ch chan<- prometheus.Metric) {
+	seen := make(map[string]bool)
+	send := func(name string, help string, newMetric func(*prometheus.Desc) (prometheus.Metric, error)) {
+		if seen[name] {
+			return // ### return, duplicate name after sanitizing ###
+		}
+		seen[name] = true
+		if metric, err := newMetric(prometheus.NewDesc(name, help, nil, nil)); err == nil {
+			ch <- metric
+		}
+	}
+
+	c.registry.Each(func(key string, value interface{}) {
+		name := GetPrometheusMetricName(c.namespace, key)
+
+		switch metric := value.(type) {
+		case metrics.Counter:
+			send(name, key, func(desc *prometheus.Desc) (prometheus.Metric, error) {
+				return prometheus.NewConstMetric(desc, prometheus.CounterValue, float64(metric.Count()))
+			})
+
+		case metrics.Gauge:
+			send(name, key, func(desc *prometheus.Desc) (prometheus.Metric, error) {
+				return prometheus.NewConstMetric(desc, prometheus.GaugeValue, float64(metric.Value()))
+			})
+
+		case metrics.GaugeFloat64:
+			send(name, key, func(desc *prometheus.Desc) (prometheus.Metric, error) {
+				return prometheus.NewConstMetric(desc, prometheus.GaugeValue, metric.Value())
+			})
+
+		case metrics.Meter:
+			snap := metric.Snapshot()
+			send(name+"_total", key, func(desc *prometheus.Desc) (prometheus.Metric, error) {
+				return prometheus.NewConstMetric(desc, prometheus.CounterValue, float64(snap.Count()))
+			})
+			send(name+"_rate1", key, func(desc *prometheus.Desc) (prometheus.Metric, error) {
+				return prometheus.NewConstMetric(desc, prometheus.GaugeValue, snap.Rate1())
+			})
+
+		case metrics.Histogram:
+			snap := metric.Snapshot()
+			send(name, key, func(desc *prometheus.Desc) (prometheus.Metric, error) {
+				return prometheus.NewConstSummary(desc, uint64(snap.Count()), float64(snap.Sum()),
+					getPrometheusQuantiles(snap.Percentiles(prometheusQuantiles), 1))
+			})
+
+		case metrics.Timer:
+			snap := metric.Snapshot()
+			scale := 1 / float64(time.Second)
+			send(name+"_seconds", key, func(desc *prometheus.Desc) (prometheus.Metric, error) {
+				return prometheus.NewConstSummary(desc, uint64(snap.Count()), float64(snap.Sum())*scale,
+					getPrometheusQuantiles(snap.Percentiles(prometheusQuantiles), scale))
+			})
+		}
+	})
+}
+
+func getPrometheusQuantiles(values []float64, scale float64) map[float64]float64 {
+	quantiles := make(map[float64]float64, len(prometheusQuantiles))
+	for i, q := range prometheusQuantiles {
+		quantiles[q] = values[i] * scale
+	}
+	return quantiles
+}
+
+// GetPrometheusMetricName converts a go-metrics name to a valid Prometheus
+// metric name, i.e. a name matching [a-zA-Z_:][a-zA-Z0-9_:]*.
+func GetPrometheusMetricName(namespace, key string) string {
+	name := key
+	if len(namespace) > 0 {
+		name = namespace + "_" + key
+	}
+
+	sanitized := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == ':':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+
+	if len(sanitized) == 0 || (sanitized[0] >= '0' && sanitized[0] <= '9') {
+		return "_" + sanitized
+	}
+	return sanitized
+}
@@ -0,0 +1,99 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	metrics "github.com/rcrowley/go-metrics"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func gatherPrometheusMetrics(t *testing.T, registry metrics.Registry) map[string]*dto.MetricFamily {
+	expect := ttesting.NewExpect(t)
+
+	promRegistry := prometheus.NewRegistry()
+	expect.NoError(promRegistry.Register(NewPrometheusCollector(registry, "gollum")))
+
+	families, err := promRegistry.Gather()
+	expect.NoError(err)
+
+	result := make(map[string]*dto.MetricFamily)
+	for _, family := range families {
+		result[family.GetName()] = family
+	}
+	return result
+}
+
+func TestPrometheusMetricName(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	expect.Equal("gollum_kafka_out_topic_1_sent", GetPrometheusMetricName("gollum", "kafka-out.topic/1.sent"))
+	expect.Equal("gollum_routed", GetPrometheusMetricName("gollum", "routed"))
+	expect.Equal("_1abc", GetPrometheusMetricName("", "1abc"))
+	expect.Equal("a_b", GetPrometheusMetricName("", "a b"))
+}
+
+func TestPrometheusCollector(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	registry := metrics.NewRegistry()
+	pluginRegistry := metrics.NewPrefixedChildRegistry(registry, "kafka-out.")
+
+	counter := metrics.NewRegisteredCounter("topic.sent", pluginRegistry)
+	gauge := metrics.NewRegisteredGauge("BreakerOpen", pluginRegistry)
+	timer := metrics.NewRegisteredTimer("topic.rtt", pluginRegistry)
+
+	counter.Inc(5)
+	gauge.Update(1)
+	timer.Update(2 * time.Second)
+
+	families := gatherPrometheusMetrics(t, registry)
+
+	sent, exists := families["gollum_kafka_out_topic_sent"]
+	expect.True(exists)
+	expect.Equal(dto.MetricType_COUNTER, sent.GetType())
+	expect.Equal(float64(5), sent.GetMetric()[0].GetCounter().GetValue())
+
+	open, exists := families["gollum_kafka_out_BreakerOpen"]
+	expect.True(exists)
+	expect.Equal(dto.MetricType_GAUGE, open.GetType())
+	expect.Equal(float64(1), open.GetMetric()[0].GetGauge().GetValue())
+
+	rtt, exists := families["gollum_kafka_out_topic_rtt_seconds"]
+	expect.True(exists)
+	expect.Equal(dto.MetricType_SUMMARY, rtt.GetType())
+	expect.Equal(uint64(1), rtt.GetMetric()[0].GetSummary().GetSampleCount())
+	expect.Equal(float64(2), rtt.GetMetric()[0].GetSummary().GetSampleSum())
+
+	// Values are read on each scrape and must not accumulate
+	counter.Inc(1)
+	families = gatherPrometheusMetrics(t, registry)
+	expect.Equal(float64(6), families["gollum_kafka_out_topic_sent"].GetMetric()[0].GetCounter().GetValue())
+}
+
+func TestPrometheusCollectorDuplicateNames(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	registry := metrics.NewRegistry()
+	metrics.NewRegisteredCounter("a.b", registry).Inc(1)
+	metrics.NewRegisteredCounter("a-b", registry).Inc(2)
+
+	families := gatherPrometheusMetrics(t, registry)
+	expect.Equal(1, len(families))
+}
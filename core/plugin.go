@@ -84,8 +84,9 @@ var (
 // threading primitives that enable gollum to wait for a plugin top properly
 // shut down.
 type PluginRunState struct {
-	workers *sync.WaitGroup
-	state   int32 // Pluginstate
+	workers     *sync.WaitGroup
+	state       int32 // Pluginstate
+	workerCount int32
 }
 
 // Plugin is the base class for any runtime class that can be configured and
@@ -107,6 +108,22 @@ type PluginWithID interface {
 	GetID() string
 }
 
+// PluginWithWorkers is implemented by plugins that report the number of
+// workers that have not returned yet
+type PluginWithWorkers interface {
+	PluginWithID
+	// GetWorkerCount returns the number of active workers
+	GetWorkerCount() int
+}
+
+// PluginWithDial is implemented by plugins connecting to an external backend
+type PluginWithDial interface {
+	Plugin
+	// Dial checks if the backend is reachable with the current configuration.
+	// Connections opened by Dial have to be closed before returning.
+	Dial() error
+}
+
 // NewPluginRunState creates a new plugin state helper
 func NewPluginRunState() *PluginRunState {
 	stateToMetric[PluginStateInitializing].Inc(1)
@@ -144,16 +161,24 @@ func (state *PluginRunState) SetWorkerWaitGroup(workers *sync.WaitGroup) {
 // AddWorker adds a worker to the waitgroup configured by SetWorkerWaitGroup.
 func (state *PluginRunState) AddWorker() {
 	state.workers.Add(1)
+	atomic.AddInt32(&state.workerCount, 1)
 	MetricActiveWorkers.Inc(1)
 }
 
 // WorkerDone removes a worker from the waitgroup configured by
 // SetWorkerWaitGroup.
 func (state *PluginRunState) WorkerDone() {
+	atomic.AddInt32(&state.workerCount, -1)
 	state.workers.Done()
 	MetricActiveWorkers.Dec(1)
 }
 
+// GetWorkerCount returns the number of workers added by AddWorker that have
+// not called WorkerDone yet.
+func (state *PluginRunState) GetWorkerCount() int {
+	return int(atomic.LoadInt32(&state.workerCount))
+}
+
 // NewPluginWithConfig creates a new plugin from the type information stored in its
 // config. This function internally calls NewPluginWithType.
 func NewPluginWithConfig(config PluginConfig) (Plugin, error) {
@@ -17,7 +17,9 @@ package core
 import (
 	"github.com/trivago/tgo/tcontainer"
 	"github.com/trivago/tgo/ttesting"
+	"strings"
 	"testing"
+	"time"
 )
 
 // Function checks if non-predefined exists and has been accessed or not
@@ -343,6 +345,120 @@ func TestPluginConfigGetInt(t *testing.T) {
 	expect.Equal(int64(2), value)
 }
 
+// Function gets a duration value for a key or default value if non-existent
+// Plan: similar to TestPluginConfigGetInt, using duration strings and numbers
+func TestPluginConfigGetDuration(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockPluginCfg := NewPluginConfig("", "core.mockPlugin")
+	mockPluginCfgReader := NewPluginConfigReaderWithError(&mockPluginCfg)
+
+	value, err := mockPluginCfgReader.GetDuration("durationkey", time.Second)
+	expect.NoError(err)
+	expect.Equal(time.Second, value)
+
+	mockPluginCfg.Override("durationkey", "1500ms")
+	value, err = mockPluginCfgReader.GetDuration("durationkey", 0)
+	expect.NoError(err)
+	expect.Equal(1500*time.Millisecond, value)
+
+	mockPluginCfg.Override("durationkey", 250)
+	value, err = mockPluginCfgReader.GetDuration("durationkey", 0)
+	expect.NoError(err)
+	expect.Equal(250*time.Millisecond, value)
+
+	mockPluginCfg.Override("durationkey", "30")
+	value, err = mockPluginCfgReader.GetDuration("durationkey", 0, time.Second)
+	expect.NoError(err)
+	expect.Equal(30*time.Second, value)
+
+	mockPluginCfg.Override("durationkey", 1.5)
+	value, err = mockPluginCfgReader.GetDuration("durationkey", 0, time.Second)
+	expect.NoError(err)
+	expect.Equal(1500*time.Millisecond, value)
+
+	mockPluginCfg.Override("durationkey", "soon")
+	_, err = mockPluginCfgReader.GetDuration("durationkey", 0)
+	expect.NotNil(err)
+}
+
+// Function gets a byte size for a key or default value if non-existent
+// Plan: similar to TestPluginConfigGetInt, using SI and IEC units
+func TestPluginConfigGetByteSize(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockPluginCfg := NewPluginConfig("", "core.mockPlugin")
+	mockPluginCfgReader := NewPluginConfigReaderWithError(&mockPluginCfg)
+
+	value, err := mockPluginCfgReader.GetByteSize("sizekey", 1024)
+	expect.NoError(err)
+	expect.Equal(int64(1024), value)
+
+	for input, expected := range map[interface{}]int64{
+		4096:      4096,
+		"4096":    4096,
+		"10B":     10,
+		"1KB":     1000,
+		"1kb":     1000,
+		"1.5 MB":  1500000,
+		"1GB":     1000000000,
+		"2TB":     2000000000000,
+		"512KiB":  512 << 10,
+		"1MiB":    1 << 20,
+		"1.5 GiB": 3 << 29,
+		"1TiB":    1 << 40,
+	} {
+		mockPluginCfg.Override("sizekey", input)
+		value, err = mockPluginCfgReader.GetByteSize("sizekey", 0)
+		expect.NoError(err)
+		expect.Equal(expected, value)
+	}
+
+	for _, input := range []string{"", "GB", "1XB", "1.2.3MB", "-1KB"} {
+		mockPluginCfg.Override("sizekey", input)
+		_, err = mockPluginCfgReader.GetByteSize("sizekey", 0)
+		expect.NotNil(err)
+	}
+
+	// The non-error reader collects the error
+	reader := NewPluginConfigReader(&mockPluginCfg)
+	expect.Equal(int64(0), reader.GetByteSize("sizekey", 0))
+	expect.NotNil(reader.Errors.OrNil())
+}
+
+// Function gets a compiled regular expression for a key or default value if
+// non-existent
+// Plan: similar to TestPluginConfigGetByteSize, invalid patterns name the
+// plugin and key
+func TestPluginConfigGetRegexp(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockPluginCfg := NewPluginConfig("regexpPlugin", "core.mockPlugin")
+	mockPluginCfgReader := NewPluginConfigReaderWithError(&mockPluginCfg)
+
+	exp, err := mockPluginCfgReader.GetRegexp("regexpkey", "^a+$")
+	expect.NoError(err)
+	expect.True(exp.MatchString("aaa"))
+
+	exp, err = mockPluginCfgReader.GetRegexp("regexpkey", "")
+	expect.NoError(err)
+	expect.Nil(exp)
+
+	mockPluginCfg.Override("regexpkey", "(?P<level>[A-Z]+):")
+	exp, err = mockPluginCfgReader.GetRegexp("regexpkey", "")
+	expect.NoError(err)
+	expect.Equal([]string{"ERROR:", "ERROR"}, exp.FindStringSubmatch("ERROR: failed"))
+
+	mockPluginCfg.Override("regexpkey", "([a-z")
+	exp, err = mockPluginCfgReader.GetRegexp("regexpkey", "")
+	expect.Nil(exp)
+	expect.NotNil(err)
+	expect.True(strings.Contains(err.Error(), "regexpPlugin"))
+	expect.True(strings.Contains(err.Error(), "regexpkey"))
+
+	// The non-error reader collects the error
+	reader := NewPluginConfigReader(&mockPluginCfg)
+	expect.Nil(reader.GetRegexp("regexpkey", ""))
+	expect.NotNil(reader.Errors.OrNil())
+}
+
 // Function gets an bool value for a key or default if non-existent
 // Plan: similar to TestPluginConfigGetInt
 func TestPluginConfigGetBool(t *testing.T) {
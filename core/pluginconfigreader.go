@@ -18,6 +18,8 @@ import (
 	"fmt"
 	"net/url"
 	"reflect"
+	"regexp"
+	"time"
 	"unsafe"
 
 	"github.com/sirupsen/logrus"
@@ -112,6 +114,15 @@ func (reader *PluginConfigReader) GetURL(key string, defaultValue string) *url.U
 	return value
 }
 
+// GetRegexp tries to read a regular expression from a PluginConfig and
+// compiles it. If that value is not found defaultValue is compiled.
+// If the resulting expression is empty nil is returned.
+func (reader *PluginConfigReader) GetRegexp(key string, defaultValue string) *regexp.Regexp {
+	value, err := reader.WithError.GetRegexp(key, defaultValue)
+	reader.Errors.Push(err)
+	return value
+}
+
 // GetInt tries to read a integer value from a PluginConfig.
 // If that value is not found defaultValue is returned.
 func (reader *PluginConfigReader) GetInt(key string, defaultValue int64) int64 {
@@ -128,6 +139,34 @@ func (reader *PluginConfigReader) GetUint(key string, defaultValue uint64) uint6
 	return value
 }
 
+// GetDuration tries to read a duration value from a PluginConfig.
+// Strings are parsed as Go durations like "1500ms" or "30s". Bare numbers are
+// multiplied by the optional unit, which defaults to time.Millisecond.
+// If that value is not found defaultValue is returned.
+func (reader *PluginConfigReader) GetDuration(key string, defaultValue time.Duration, unit ...time.Duration) time.Duration {
+	value, err := reader.WithError.GetDuration(key, defaultValue, unit...)
+	reader.Errors.Push(err)
+	return value
+}
+
+// GetByteSize tries to read a size in bytes from a PluginConfig.
+// Strings may carry an SI (KB, MB, GB, TB) or IEC (KiB, MiB, GiB, TiB) unit,
+// bare numbers are treated as bytes.
+// If that value is not found defaultValue is returned.
+func (reader *PluginConfigReader) GetByteSize(key string, defaultValue int64) int64 {
+	value, err := reader.WithError.GetByteSize(key, defaultValue)
+	reader.Errors.Push(err)
+	return value
+}
+
+// GetFloat tries to read a float value from a PluginConfig.
+// If that value is not found defaultValue is returned.
+func (reader *PluginConfigReader) GetFloat(key string, defaultValue float64) float64 {
+	value, err := reader.WithError.GetFloat(key, defaultValue)
+	reader.Errors.Push(err)
+	return value
+}
+
 // GetBool tries to read a boolean value from a PluginConfig.
 // If that value is not found defaultValue is returned.
 func (reader *PluginConfigReader) GetBool(key string, defaultValue bool) bool {
@@ -319,7 +358,14 @@ func (reader *PluginConfigReader) configureField(fieldVal reflect.Value, key str
 		treflect.SetValue(fieldVal, reader.GetString(key, tags.GetString()))
 
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-		treflect.SetValue(fieldVal, reader.GetInt(key, tags.GetInt())*tags.GetMetricScale())
+		scale := tags.GetMetricScale()
+		if fieldVal.Type() == reflect.TypeOf(time.Duration(0)) {
+			// Accept duration strings, numbers are still scaled by the metric tag
+			unit := time.Duration(scale)
+			treflect.SetValue(fieldVal, reader.GetDuration(key, time.Duration(tags.GetInt())*unit, unit))
+		} else {
+			treflect.SetValue(fieldVal, reader.GetInt(key, tags.GetInt())*scale)
+		}
 
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 		var value uint64
@@ -21,8 +21,49 @@ import (
 	"github.com/trivago/tgo/tcontainer"
 	"github.com/trivago/tgo/tstrings"
 	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
+var byteSizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"kb":  1000,
+	"mb":  1000 * 1000,
+	"gb":  1000 * 1000 * 1000,
+	"tb":  1000 * 1000 * 1000 * 1000,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+// parseByteSize converts strings like "512KiB" or "1.5 GB" to bytes.
+// SI units (KB, MB, ...) are based on 1000, IEC units (KiB, MiB, ...) on 1024.
+func parseByteSize(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	unitIdx := strings.IndexFunc(value, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if unitIdx == -1 {
+		unitIdx = len(value)
+	}
+
+	number, err := strconv.ParseFloat(value[:unitIdx], 64)
+	if err != nil {
+		return 0, fmt.Errorf("\"%s\" is not a valid byte size", value)
+	}
+
+	unit := strings.ToLower(strings.TrimSpace(value[unitIdx:]))
+	scale, known := byteSizeUnits[unit]
+	if !known {
+		return 0, fmt.Errorf("\"%s\" has an unknown byte size unit", value)
+	}
+	return int64(number * float64(scale)), nil
+}
+
 // PluginConfigReaderWithError is a read-only wrapper on top of a plugin config
 // that provides convenience functions for accessing values from the
 // wrapped config.
@@ -99,6 +140,24 @@ func (reader PluginConfigReaderWithError) GetURL(key string, defaultValue string
 	return urlValue, nil
 }
 
+// GetRegexp tries to read a regular expression from a PluginConfig and
+// compiles it. If that value is not found defaultValue is compiled. If the
+// resulting expression is empty nil is returned.
+func (reader PluginConfigReaderWithError) GetRegexp(key string, defaultValue string) (*regexp.Regexp, error) {
+	value, err := reader.GetString(key, defaultValue)
+	if err != nil {
+		return nil, err
+	}
+	if value == "" {
+		return nil, nil
+	}
+	exp, err := regexp.Compile(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s is not a valid regular expression: %s", reader.GetID(), key, err.Error())
+	}
+	return exp, nil
+}
+
 // GetInt tries to read a integer value from a PluginConfig.
 // If that value is not found defaultValue is returned.
 func (reader PluginConfigReaderWithError) GetInt(key string, defaultValue int64) (int64, error) {
@@ -135,6 +194,59 @@ func (reader PluginConfigReaderWithError) GetFloat(key string, defaultValue floa
 	return defaultValue, nil
 }
 
+// GetDuration tries to read a duration value from a PluginConfig.
+// Strings are parsed as Go durations like "1500ms" or "30s". Bare numbers are
+// multiplied by the optional unit, which defaults to time.Millisecond.
+// If that value is not found defaultValue is returned.
+func (reader PluginConfigReaderWithError) GetDuration(key string, defaultValue time.Duration, unit ...time.Duration) (time.Duration, error) {
+	key = reader.config.registerKey(key)
+	if !reader.HasValue(key) {
+		return defaultValue, nil
+	}
+
+	scale := time.Millisecond
+	if len(unit) > 0 {
+		scale = unit[0]
+	}
+
+	if strVal, err := reader.config.Settings.String(key); err == nil {
+		if number, err := tstrings.AtoI64(strVal); err == nil {
+			return time.Duration(number) * scale, nil // Allow string to number conversion
+		}
+		value, err := time.ParseDuration(strVal)
+		if err != nil {
+			return defaultValue, fmt.Errorf("%s is not a valid duration: %s", key, err.Error())
+		}
+		return value, nil
+	}
+
+	number, err := reader.config.Settings.Float(key)
+	if err != nil {
+		return defaultValue, err
+	}
+	return time.Duration(number * float64(scale)), nil
+}
+
+// GetByteSize tries to read a size in bytes from a PluginConfig.
+// Strings may carry an SI (KB, MB, GB, TB) or IEC (KiB, MiB, GiB, TiB) unit,
+// bare numbers are treated as bytes.
+// If that value is not found defaultValue is returned.
+func (reader PluginConfigReaderWithError) GetByteSize(key string, defaultValue int64) (int64, error) {
+	key = reader.config.registerKey(key)
+	if !reader.HasValue(key) {
+		return defaultValue, nil
+	}
+
+	if strVal, err := reader.config.Settings.String(key); err == nil {
+		value, err := parseByteSize(strVal)
+		if err != nil {
+			return defaultValue, fmt.Errorf("%s: %s", key, err.Error())
+		}
+		return value, nil
+	}
+	return reader.config.Settings.Int(key)
+}
+
 // GetBool tries to read a boolean value from a PluginConfig.
 // If that value is not found defaultValue is returned.
 func (reader PluginConfigReaderWithError) GetBool(key string, defaultValue bool) (bool, error) {
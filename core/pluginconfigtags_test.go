@@ -28,6 +28,7 @@ type testPluginAutoConfig struct {
 	UintValue      uint64            `config:"uintValue"`
 	OctValue       int64             `config:"octValue"`
 	DurationValue  time.Duration     `config:"durationValue" metric:"sec"`
+	DurationString time.Duration     `config:"durationString" metric:"sec"`
 	MbValue        int64             `config:"mbValue" metric:"kb"`
 	StringValue    string            `config:"stringValue"`
 	StringArray    []string          `config:"stringArray"`
@@ -65,6 +66,7 @@ func TestConfigReaderAutoConfig(t *testing.T) {
 	values["uintValue"] = uint64(2)
 	values["octValue"] = "017"
 	values["durationValue"] = int64(3)
+	values["durationString"] = "1500ms"
 	values["mbValue"] = int64(4)
 	values["stringValue"] = "test"
 	values["stringArray"] = []string{"foo", "bar"}
@@ -101,6 +103,7 @@ func TestConfigReaderAutoConfig(t *testing.T) {
 	expect.Equal(uint64(2), myStruct.UintValue)
 	expect.Equal(int64(15), myStruct.OctValue)
 	expect.Equal(3*time.Second, myStruct.DurationValue)
+	expect.Equal(1500*time.Millisecond, myStruct.DurationString)
 	expect.Equal(int64(4096), myStruct.MbValue)
 	expect.Equal("test", myStruct.StringValue)
 	expect.Equal([]string{"foo", "bar"}, myStruct.StringArray)
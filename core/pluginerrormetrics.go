@@ -0,0 +1,65 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	metrics "github.com/rcrowley/go-metrics"
+)
+
+// PluginErrorMetrics holds counters for errors common to most plugins.
+// ConnectFailures counts failed attempts to connect to a service,
+// SendFailures counts failed attempts to write or read data and Fallbacks
+// counts messages routed to a producer's fallback stream.
+type PluginErrorMetrics struct {
+	ConnectFailures metrics.Counter
+	SendFailures    metrics.Counter
+	Fallbacks       metrics.Counter
+}
+
+// NewPluginErrorMetrics creates error counters and registers them as
+// "<prefix>.errors.connect", "<prefix>.errors.send" and "<prefix>.fallback",
+// where prefix is usually the ID of the plugin.
+func NewPluginErrorMetrics(prefix string) *PluginErrorMetrics {
+	registry := NewMetricsRegistry(prefix)
+	return &PluginErrorMetrics{
+		ConnectFailures: metrics.GetOrRegisterCounter("errors.connect", registry),
+		SendFailures:    metrics.GetOrRegisterCounter("errors.send", registry),
+		Fallbacks:       metrics.GetOrRegisterCounter("fallback", registry),
+	}
+}
+
+// CountConnectFailure increases the ConnectFailures counter.
+// Calling this function on nil is valid and does nothing.
+func (errorMetrics *PluginErrorMetrics) CountConnectFailure() {
+	if errorMetrics != nil {
+		errorMetrics.ConnectFailures.Inc(1)
+	}
+}
+
+// CountSendFailure increases the SendFailures counter.
+// Calling this function on nil is valid and does nothing.
+func (errorMetrics *PluginErrorMetrics) CountSendFailure() {
+	if errorMetrics != nil {
+		errorMetrics.SendFailures.Inc(1)
+	}
+}
+
+// CountFallback increases the Fallbacks counter.
+// Calling this function on nil is valid and does nothing.
+func (errorMetrics *PluginErrorMetrics) CountFallback() {
+	if errorMetrics != nil {
+		errorMetrics.Fallbacks.Inc(1)
+	}
+}
@@ -43,6 +43,14 @@ func (registry *pluginRegistry) RegisterUnique(plugin Plugin, ID string) bool {
 	return false
 }
 
+// Unregister removes the plugin stored for the given ID, so that the ID can be
+// used again, e.g. when a plugin is recreated during a config reload.
+func (registry *pluginRegistry) Unregister(ID string) {
+	registry.guard.Lock()
+	defer registry.guard.Unlock()
+	delete(registry.plugins, ID)
+}
+
 // GetPlugin returns a plugin by name or nil if not found.
 func (registry *pluginRegistry) GetPlugin(ID string) Plugin {
 	registry.guard.RLock()
@@ -41,4 +41,10 @@ func TestPluginRegistry(t *testing.T) {
 	ret = PluginRegistry.GetPluginWithState("aPlugin")
 	expect.Nil(ret)
 	// TODO: create mock PluginState with state and then test notnil
+
+	// Test for Unregister
+	PluginRegistry.Unregister("aPlugin")
+	expect.Equal(registered, len(PluginRegistry.plugins))
+	expect.Nil(PluginRegistry.GetPlugin("aPlugin"))
+	expect.True(PluginRegistry.RegisterUnique(plugin, "aPlugin"))
 }
@@ -45,4 +45,9 @@ type Producer interface {
 	// GetShutdownTimeout returns the duration gollum will wait for this producer
 	// before canceling the shutdown process.
 	GetShutdownTimeout() time.Duration
+
+	// HealthCheck reports whether this plugin is able to do its work, e.g.
+	// if the connection to its backend is established. It is served by the
+	// health check service at "/<plugin_id>".
+	HealthCheck() (code int, body string)
 }
@@ -16,6 +16,7 @@ package core
 
 import (
 	"fmt"
+	"sync"
 	"time"
 )
 
@@ -45,6 +46,42 @@ type Router interface {
 	Start() error
 }
 
+// RouterWithProducerRemoval is implemented by routers that allow producers to
+// be detached during runtime, e.g. when the configuration is reloaded.
+type RouterWithProducerRemoval interface {
+	Router
+
+	// RemoveProducer removes one or more producers from this stream.
+	RemoveProducer(producers ...Producer)
+
+	// ReplaceProducer replaces a producer by another one, so that no message
+	// is sent to both of them. If oldProducer is not attached to this stream,
+	// newProducer is added.
+	ReplaceProducer(oldProducer Producer, newProducer Producer)
+}
+
+// orderedRouter is implemented by routers that can guarantee the order of
+// messages passed to their producers.
+type orderedRouter interface {
+	Router
+
+	// IsOrdered returns true if messages are processed one at a time.
+	IsOrdered() bool
+
+	// getOrderGuard returns the mutex held by Route while a message is
+	// processed or nil if messages may be processed in parallel.
+	getOrderGuard() *sync.Mutex
+}
+
+// IsOrderedRouter returns true if the given router processes one message at
+// a time. Route holds a lock on such routers while a message is processed, so
+// routing to the same router from within a modulator of that router or its
+// producers blocks forever.
+func IsOrderedRouter(router Router) bool {
+	ordered, isOrdered := router.(orderedRouter)
+	return isOrdered && ordered.IsOrdered()
+}
+
 // Route tries to enqueue a message to the given stream. This function also
 // handles redirections enforced by formatters.
 func Route(msg *Message, router Router) error {
@@ -53,6 +90,13 @@ func Route(msg *Message, router Router) error {
 		return nil
 	}
 
+	if ordered, isOrdered := router.(orderedRouter); isOrdered {
+		if guard := ordered.getOrderGuard(); guard != nil {
+			guard.Lock()
+			defer guard.Unlock()
+		}
+	}
+
 	action := router.Modulate(msg)
 	streamName := msg.GetStreamID().GetName()
 
@@ -16,6 +16,9 @@ package core
 
 import (
 	//	"sync"
+	"math/rand"
+	"strconv"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -147,3 +150,138 @@ func TestRouteOriginal(t *testing.T) {
 	expect.Equal("foo", mockB.lastMessageData)
 
 }
+
+func TestRouterRemoveProducer(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	router := getMockRouter()
+
+	producer1 := new(mockBufferedProducer)
+	producer2 := new(mockBufferedProducer)
+	router.AddProducer(producer1, producer2)
+	producers := router.GetProducers()
+
+	router.RemoveProducer(producer1)
+	expect.Equal([]Producer{producer2}, router.GetProducers())
+
+	// Previously returned lists are not modified
+	expect.Equal([]Producer{producer1, producer2}, producers)
+
+	router.RemoveProducer(producer2)
+	expect.Equal(0, len(router.GetProducers()))
+}
+
+func TestRouterReplaceProducer(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	router := getMockRouter()
+
+	producer1 := new(mockBufferedProducer)
+	producer2 := new(mockBufferedProducer)
+	producer3 := new(mockBufferedProducer)
+	router.AddProducer(producer1, producer2)
+	producers := router.GetProducers()
+
+	router.ReplaceProducer(producer1, producer3)
+	expect.Equal([]Producer{producer3, producer2}, router.GetProducers())
+
+	// Previously returned lists are not modified
+	expect.Equal([]Producer{producer1, producer2}, producers)
+
+	// Producers not attached are added
+	router.ReplaceProducer(producer1, producer1)
+	expect.Equal([]Producer{producer3, producer2, producer1}, router.GetProducers())
+
+	// The new producer is not added twice
+	router.ReplaceProducer(producer1, producer2)
+	expect.Equal([]Producer{producer3, producer2}, router.GetProducers())
+}
+
+// mockOrderedRouter records the payloads of all messages in the order they
+// were enqueued. The payloads are not guarded, so this router may only be used
+// with strict ordering.
+type mockOrderedRouter struct {
+	SimpleRouter
+	payloads []string
+	count    *int32
+}
+
+func (router *mockOrderedRouter) Configure(config PluginConfigReader) {
+}
+
+func (router *mockOrderedRouter) Enqueue(msg *Message) error {
+	router.payloads = append(router.payloads, msg.String())
+	atomic.AddInt32(router.count, 1)
+	return nil
+}
+
+func (router *mockOrderedRouter) Start() error {
+	return nil
+}
+
+// mockDelayFormatter delays each message by a random duration to provoke
+// messages being reordered by parallel modulator routines.
+type mockDelayFormatter struct {
+	SimpleFormatter
+}
+
+func (formatter *mockDelayFormatter) ApplyFormatter(msg *Message) error {
+	time.Sleep(time.Duration(rand.Intn(200)) * time.Microsecond)
+	return nil
+}
+
+func TestRouterOrdering(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	for ordering, isOrdered := range map[string]bool{"none": false, "strict": true, "Strict": true} {
+		router := getMockRouter()
+		mockConf := NewPluginConfig("", "mockRouter")
+		mockConf.Override("Ordering", ordering)
+
+		reader := NewPluginConfigReader(&mockConf)
+		expect.NoError(reader.Configure(&router))
+		expect.Equal(isOrdered, router.IsOrdered())
+	}
+
+	router := getMockRouter()
+	mockConf := NewPluginConfig("", "mockRouter")
+	mockConf.Override("Ordering", "sometimes")
+
+	reader := NewPluginConfigReader(&mockConf)
+	expect.NotNil(reader.Configure(&router))
+}
+
+func TestRouteStrictOrdering(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	TypeRegistry.Register(mockDelayFormatter{})
+
+	router := &mockOrderedRouter{count: new(int32)}
+	routerConf := NewPluginConfig("", "mockOrderedRouter")
+	routerConf.Override("Stream", t.Name())
+	routerConf.Override("Ordering", "strict")
+
+	reader := NewPluginConfigReader(&routerConf)
+	expect.NoError(reader.Configure(router))
+	StreamRegistry.Register(router, router.GetStreamID())
+
+	consConf := NewPluginConfig(t.Name(), "mockSimpleConsumer")
+	consConf.Override("Streams", []string{t.Name()})
+	consConf.Override("ModulatorRoutines", 4)
+	consConf.Override("Modulators", []interface{}{"core.mockDelayFormatter"})
+
+	cons, err := getSimpleConsumer(consConf)
+	expect.NoError(err)
+	defer close(cons.modulatorQueue)
+
+	numMessages := 200
+	for i := 0; i < numMessages; i++ {
+		cons.Enqueue([]byte(strconv.Itoa(i)))
+	}
+
+	for start := time.Now(); atomic.LoadInt32(router.count) < int32(numMessages) && time.Since(start) < 5*time.Second; {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	expect.Equal(numMessages, len(router.payloads))
+	for i, payload := range router.payloads {
+		expect.Equal(strconv.Itoa(i), payload)
+	}
+}
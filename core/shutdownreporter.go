@@ -0,0 +1,141 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// PluginWithDrainCount is implemented by plugins that count the messages
+// handled while draining during shutdown
+type PluginWithDrainCount interface {
+	PluginWithID
+	// GetDrainCount returns the number of drained messages
+	GetDrainCount() int64
+}
+
+// ShutdownReporter logs the progress of stopping a group of plugins.
+// While running, the plugins with workers that did not return yet are logged
+// on every tick together with the time left until the shutdown is forced.
+// When stopped, a summary with the plugins still running and the number of
+// messages drained by each plugin is logged.
+type ShutdownReporter struct {
+	group    string
+	plugins  []PluginWithWorkers
+	interval time.Duration
+	timeout  time.Duration
+	logger   logrus.FieldLogger
+	start    time.Time
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewShutdownReporter creates a reporter for the given plugins. The group is
+// used in log messages, e.g. "producers". Progress is logged every interval
+// until Stop is called. The timeout denotes the time after which the shutdown
+// is forced.
+func NewShutdownReporter(group string, plugins []PluginWithWorkers, interval, timeout time.Duration, logger logrus.FieldLogger) *ShutdownReporter {
+	return &ShutdownReporter{
+		group:    group,
+		plugins:  plugins,
+		interval: interval,
+		timeout:  timeout,
+		logger:   logger,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start starts logging the progress in a separate go routine.
+func (reporter *ShutdownReporter) Start() {
+	reporter.start = time.Now()
+	go reporter.run()
+}
+
+// Stop stops logging the progress and logs the summary.
+func (reporter *ShutdownReporter) Stop() {
+	close(reporter.stop)
+	<-reporter.done
+	reporter.reportSummary()
+}
+
+// GetPending returns the IDs of all plugins with active workers together with
+// the number of workers, e.g. "kafkaOut (2 workers)".
+func (reporter *ShutdownReporter) GetPending() []string {
+	pending := []string{}
+	for _, plugin := range reporter.plugins {
+		if workers := plugin.GetWorkerCount(); workers > 0 {
+			pending = append(pending, fmt.Sprintf("%s (%d workers)", plugin.GetID(), workers))
+		}
+	}
+	return pending
+}
+
+func (reporter *ShutdownReporter) run() {
+	defer close(reporter.done)
+
+	ticker := time.NewTicker(reporter.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-reporter.stop:
+			return // ### return, stopped ###
+		case <-ticker.C:
+			reporter.reportProgress()
+		}
+	}
+}
+
+func (reporter *ShutdownReporter) reportProgress() {
+	pending := reporter.GetPending()
+	if len(pending) == 0 {
+		return // ### return, nothing to report ###
+	}
+
+	elapsed := time.Since(reporter.start)
+	remaining := reporter.timeout - elapsed
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	reporter.logger.Warningf("Waiting for %s to stop for %.1fs, forced shutdown in %.1fs: %s",
+		reporter.group, elapsed.Seconds(), remaining.Seconds(), strings.Join(pending, ", "))
+}
+
+func (reporter *ShutdownReporter) reportSummary() {
+	elapsed := time.Since(reporter.start)
+
+	if pending := reporter.GetPending(); len(pending) > 0 {
+		reporter.logger.Errorf("Stopping %s did not finish after %.1fs: %s",
+			reporter.group, elapsed.Seconds(), strings.Join(pending, ", "))
+	} else {
+		reporter.logger.Debugf("Stopped %s after %.1fs", reporter.group, elapsed.Seconds())
+	}
+
+	drained := []string{}
+	for _, plugin := range reporter.plugins {
+		if counter, hasDrainCount := plugin.(PluginWithDrainCount); hasDrainCount {
+			drained = append(drained, fmt.Sprintf("%s=%d", plugin.GetID(), counter.GetDrainCount()))
+		}
+	}
+	if len(drained) > 0 {
+		reporter.logger.Infof("Messages drained by %s: %s", reporter.group, strings.Join(drained, ", "))
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/trivago/tgo/ttesting"
+)
+
+// slowPlugin is a fake plugin whose worker returns after a given delay
+type slowPlugin struct {
+	PluginRunState
+	id      string
+	drained int64
+}
+
+func newSlowPlugin(id string, workers *sync.WaitGroup) *slowPlugin {
+	plugin := &slowPlugin{id: id}
+	plugin.SetWorkerWaitGroup(workers)
+	return plugin
+}
+
+func (plugin *slowPlugin) Configure(conf PluginConfigReader) {
+}
+
+func (plugin *slowPlugin) GetID() string {
+	return plugin.id
+}
+
+func (plugin *slowPlugin) GetDrainCount() int64 {
+	return atomic.LoadInt64(&plugin.drained)
+}
+
+func (plugin *slowPlugin) run(delay time.Duration, drained int64) {
+	plugin.AddWorker()
+	go func() {
+		defer plugin.WorkerDone()
+		time.Sleep(delay)
+		atomic.StoreInt64(&plugin.drained, drained)
+	}()
+}
+
+// syncBuffer guards a buffer written by the reporter go routine
+type syncBuffer struct {
+	guard  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (buffer *syncBuffer) Write(data []byte) (int, error) {
+	buffer.guard.Lock()
+	defer buffer.guard.Unlock()
+	return buffer.buffer.Write(data)
+}
+
+func (buffer *syncBuffer) String() string {
+	buffer.guard.Lock()
+	defer buffer.guard.Unlock()
+	return buffer.buffer.String()
+}
+
+func newShutdownReporterTestLogger() (*logrus.Logger, *syncBuffer) {
+	output := new(syncBuffer)
+	logger := logrus.New()
+	logger.Out = output
+	logger.Formatter = &logrus.TextFormatter{DisableColors: true}
+	logger.Level = logrus.DebugLevel
+	return logger, output
+}
+
+func TestPluginRunStateWorkerCount(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	state := PluginRunState{}
+	state.SetWorkerWaitGroup(new(sync.WaitGroup))
+	expect.Equal(0, state.GetWorkerCount())
+
+	state.AddWorker()
+	state.AddWorker()
+	expect.Equal(2, state.GetWorkerCount())
+
+	state.WorkerDone()
+	expect.Equal(1, state.GetWorkerCount())
+	state.WorkerDone()
+	expect.Equal(0, state.GetWorkerCount())
+}
+
+func TestShutdownReporterProgress(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	logger, output := newShutdownReporterTestLogger()
+
+	workers := new(sync.WaitGroup)
+	fast := newSlowPlugin("fast", workers)
+	slow := newSlowPlugin("slow", workers)
+	fast.run(0, 3)
+	slow.run(200*time.Millisecond, 7)
+
+	reporter := NewShutdownReporter("producers", []PluginWithWorkers{fast, slow}, 20*time.Millisecond, time.Second, logger)
+	reporter.Start()
+	time.Sleep(100 * time.Millisecond)
+
+	expect.Equal([]string{"slow (1 workers)"}, reporter.GetPending())
+
+	workers.Wait()
+	reporter.Stop()
+
+	expect.Equal([]string{}, reporter.GetPending())
+
+	log := output.String()
+	expect.Contains(log, "Waiting for producers to stop")
+	expect.Contains(log, "slow (1 workers)")
+	expect.False(strings.Contains(log, "fast (1 workers)"))
+	expect.Contains(log, "Stopped producers")
+	expect.Contains(log, "Messages drained by producers: fast=3, slow=7")
+}
+
+func TestShutdownReporterBlocking(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	logger, output := newShutdownReporterTestLogger()
+
+	workers := new(sync.WaitGroup)
+	blocking := newSlowPlugin("blocking", workers)
+	blocking.run(time.Second, 0)
+
+	reporter := NewShutdownReporter("consumers", []PluginWithWorkers{blocking}, time.Hour, 50*time.Millisecond, logger)
+	reporter.Start()
+	reporter.Stop()
+
+	log := output.String()
+	expect.False(strings.Contains(log, "Waiting for consumers"))
+	expect.Contains(log, "Stopping consumers did not finish")
+	expect.Contains(log, "blocking (1 workers)")
+	expect.Contains(log, "blocking=0")
+}
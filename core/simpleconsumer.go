@@ -17,19 +17,29 @@ package core
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	metrics "github.com/rcrowley/go-metrics"
 	"github.com/sirupsen/logrus"
 	"github.com/trivago/tgo"
 	"github.com/trivago/tgo/tcontainer"
 	"github.com/trivago/tgo/thealthcheck"
 )
 
+const (
+	overflowPolicyBlock      = "block"
+	overflowPolicyDropNewest = "drop_newest"
+	overflowPolicyDropOldest = "drop_oldest"
+)
+
 // SimpleConsumer consumer
 //
 // This type defines a common baseclass for all consumers. All consumer plugins
 // should derive from this class as all required basic functions are already
 // implemented in a general way.
+// Failed connection attempts and failed reads are counted by the metrics
+// "<ID>.errors.connect" and "<ID>.errors.send". See GetErrorMetrics.
 //
 // Parameters
 //
@@ -52,26 +62,67 @@ import (
 // - ModulatorRoutines: Defines the number of go routines reserved for
 // modulating messages. Setting this parameter to 0 will use as many go routines
 // as the specific consumer plugin is using for fetching data. Any other value
-// will force the given number fo go routines to be used.
+// will force the given number fo go routines to be used. If one of the streams
+// has Ordering set to strict, at most one go routine is used.
 // By default this parameter is set to 0
 //
 // - ModulatorQueueSize: Defines the size of the channel used to buffer messages
 // before they are fetched by the next free modulator go routine. If the
 // ModulatorRoutines parameter is set to 0 this parameter is ignored.
+// The number of queued messages and its maximum are exposed as the metrics
+// "<ID>.queue.depth" and "<ID>.queue.max".
 // By default this parameter is set to 1024.
+//
+// - MaxMessageBytes: Defines the maximum size of a message payload in bytes.
+// Larger messages are dropped when they are enqueued, i.e. before any
+// modulator is applied, and counted by the metrics "oversize_dropped" and
+// "<ID>.oversize_dropped".
+// Set to 0 to disable this check.
+// By default this parameter is set to 0.
+//
+// - TruncateOversize: When set to true, messages larger than MaxMessageBytes
+// are truncated to MaxMessageBytes instead of being dropped. Truncated
+// messages are counted by the metrics "oversize_truncated" and
+// "<ID>.oversize_truncated".
+// By default this parameter is set to false.
+//
+// - EnqueueTimeoutMs: Defines the number of milliseconds to wait for a free
+// slot in the modulator queue before OverflowPolicy is applied. If set to 0
+// the consumer blocks until the message can be queued. If this parameter is
+// set and ModulatorRoutines is 0, one modulator routine is used.
+// By default this parameter is set to 0.
+//
+// - OverflowPolicy: Defines what happens to a message that could not be queued
+// within EnqueueTimeoutMs. "block" waits until the message can be queued,
+// "drop_newest" drops the message and "drop_oldest" drops the oldest queued
+// messages until the message can be queued. Dropped messages are counted by
+// the metric "overflow_dropped". A warning is logged when the queue starts to
+// overflow and a notice once messages can be queued again.
+// By default this parameter is set to "block".
 type SimpleConsumer struct {
-	id              string
-	control         chan PluginControl
-	runState        *PluginRunState
-	routers         []Router       `config:"Streams"`
-	modulators      ModulatorArray `config:"Modulators"`
-	onRoll          func()
-	onPrepareStop   func()
-	onStop          func()
-	enqueueMessage  func(*Message)
-	modulatorQueue  MessageQueue
-	Logger          logrus.FieldLogger
-	shutdownTimeout time.Duration `config:"ShutdownTimeoutMs" default:"1000" metric:"ms"`
+	id               string
+	control          chan PluginControl
+	runState         *PluginRunState
+	routers          []Router       `config:"Streams"`
+	modulators       ModulatorArray `config:"Modulators"`
+	onRoll           func()
+	onPrepareStop    func()
+	onStop           func()
+	enqueueMessage   func(*Message)
+	modulatorQueue   MessageQueue
+	queueMetrics     *MessageQueueMetrics
+	errorMetrics     *PluginErrorMetrics
+	oversizeDropped  metrics.Counter
+	oversizeTruncate metrics.Counter
+	Logger           logrus.FieldLogger
+	shutdownTimeout  time.Duration `config:"ShutdownTimeoutMs" default:"1000" metric:"ms"`
+	maxMessageBytes  int           `config:"MaxMessageBytes" default:"0"`
+	truncateOversize bool          `config:"TruncateOversize" default:"false"`
+	enqueueTimeout   time.Duration `config:"EnqueueTimeoutMs" default:"0" metric:"ms"`
+	overflowPolicy   string        `config:"OverflowPolicy" default:"block"`
+	overflowing      int32
+
+	healthCheck thealthcheck.CallbackFunc
 }
 
 // Configure initializes standard consumer values from a plugin config.
@@ -80,13 +131,35 @@ func (cons *SimpleConsumer) Configure(conf PluginConfigReader) {
 	cons.Logger = conf.GetLogger()
 	cons.runState = NewPluginRunState()
 	cons.control = make(chan PluginControl, 1)
+	cons.errorMetrics = NewPluginErrorMetrics(cons.id)
+
+	metricsRegistry := NewMetricsRegistry(cons.id)
+	cons.oversizeDropped = metrics.GetOrRegisterCounter("oversize_dropped", metricsRegistry)
+	cons.oversizeTruncate = metrics.GetOrRegisterCounter("oversize_truncated", metricsRegistry)
 
 	numRoutines := conf.GetInt("ModulatorRoutines", 0)
 	queueSize := conf.GetInt("ModulatorQueueSize", 1024)
 
+	switch cons.overflowPolicy {
+	case overflowPolicyBlock, overflowPolicyDropNewest, overflowPolicyDropOldest:
+	default:
+		conf.Errors.Pushf("Unknown OverflowPolicy \"%s\"", cons.overflowPolicy)
+	}
+
+	if numRoutines == 0 && cons.enqueueTimeout > 0 {
+		cons.Logger.Debug("Using one modulator routine to apply EnqueueTimeoutMs")
+		numRoutines = 1
+	}
+
+	if numRoutines > 1 && cons.hasOrderedRouter() {
+		cons.Logger.Warning("Using one modulator routine to keep the order of messages on strictly ordered streams")
+		numRoutines = 1
+	}
+
 	if numRoutines > 0 {
 		cons.Logger.Debugf("Using %d modulator routines", numRoutines)
 		cons.modulatorQueue = NewMessageQueue(int(queueSize))
+		cons.queueMetrics = NewMessageQueueMetrics(cons.modulatorQueue, cons.id)
 		for i := 0; i < int(numRoutines); i++ {
 			go cons.processQueue()
 		}
@@ -106,15 +179,41 @@ func (cons *SimpleConsumer) Configure(conf PluginConfigReader) {
 	})
 }
 
+// hasOrderedRouter returns true if one of the routers of this consumer
+// requires messages to be kept in order.
+func (cons *SimpleConsumer) hasOrderedRouter() bool {
+	for _, router := range cons.routers {
+		if ordered, isOrdered := router.(orderedRouter); isOrdered && ordered.IsOrdered() {
+			return true
+		}
+	}
+	return false
+}
+
 // GetLogger returns the logger scoped to this plugin
 func (cons *SimpleConsumer) GetLogger() logrus.FieldLogger {
 	return cons.Logger
 }
 
+// AddHealthCheck sets the health check served at the default URL
+// (http://<addr>:<port>/<plugin_id>). See HealthCheck.
+func (cons *SimpleConsumer) AddHealthCheck(callback thealthcheck.CallbackFunc) {
+	cons.healthCheck = callback
+}
+
+// HealthCheck calls the callback set by AddHealthCheck. If no callback has
+// been set the consumer is always reported as healthy.
+func (cons *SimpleConsumer) HealthCheck() (code int, body string) {
+	if cons.healthCheck == nil {
+		return thealthcheck.StatusOK, "OK"
+	}
+	return cons.healthCheck()
+}
+
 // AddHealthCheckAt adds a health check at a subpath
 // (http://<addr>:<port>/<plugin_id><path>)
 func (cons *SimpleConsumer) AddHealthCheckAt(path string, callback thealthcheck.CallbackFunc) {
-	thealthcheck.AddEndpoint("/"+cons.GetID()+path, callback)
+	AddHealthCheckEndpoint("/"+cons.GetID()+path, callback)
 }
 
 // GetID returns the ID of this consumer
@@ -122,6 +221,12 @@ func (cons *SimpleConsumer) GetID() string {
 	return cons.id
 }
 
+// GetErrorMetrics returns the error counters of this consumer. Plugins should
+// count failed connection attempts and failed reads here.
+func (cons *SimpleConsumer) GetErrorMetrics() *PluginErrorMetrics {
+	return cons.errorMetrics
+}
+
 // GetShutdownTimeout returns the duration gollum will wait for this producer
 // before canceling the shutdown process.
 func (cons *SimpleConsumer) GetShutdownTimeout() time.Duration {
@@ -198,6 +303,12 @@ func (cons *SimpleConsumer) WorkerDone() {
 	cons.runState.WorkerDone()
 }
 
+// GetWorkerCount returns the number of workers of this plugin that have not
+// returned yet.
+func (cons *SimpleConsumer) GetWorkerCount() int {
+	return cons.runState.GetWorkerCount()
+}
+
 // Enqueue creates a new message from a given byte slice and passes it to
 // EnqueueMessage. Data is copied to the message.
 func (cons *SimpleConsumer) Enqueue(data []byte) {
@@ -206,17 +317,76 @@ func (cons *SimpleConsumer) Enqueue(data []byte) {
 
 // EnqueueWithMetadata works like EnqueueWithSequence and allows to set meta data directly
 func (cons *SimpleConsumer) EnqueueWithMetadata(data []byte, metaData tcontainer.MarshalMap) {
+	if cons.maxMessageBytes > 0 && len(data) > cons.maxMessageBytes {
+		if !cons.truncateOversize {
+			MetricMessagesOversizeDropped.Inc(1)
+			cons.oversizeDropped.Inc(1)
+			return // ### return, drop oversized message ###
+		}
+		MetricMessagesOversizeTruncated.Inc(1)
+		cons.oversizeTruncate.Inc(1)
+		data = data[:cons.maxMessageBytes]
+	}
+
 	msg := NewMessage(cons, data, metaData, InvalidStreamID)
 	cons.enqueueMessage(msg)
 }
 
 func (cons *SimpleConsumer) parallelEnqueue(msg *Message) {
-	cons.modulatorQueue.Push(msg, 0)
+	if cons.enqueueTimeout <= 0 || cons.modulatorQueue.Push(msg, cons.enqueueTimeout) != MessageQueueOk {
+		cons.enqueueOverflow(msg)
+	} else if atomic.CompareAndSwapInt32(&cons.overflowing, 1, 0) {
+		cons.Logger.Info("Modulator queue accepts messages again")
+	}
+	cons.queueMetrics.Update()
+}
+
+// enqueueOverflow applies the overflow policy to a message that could not be
+// queued within EnqueueTimeoutMs. If no timeout is set, the message is pushed
+// blocking.
+func (cons *SimpleConsumer) enqueueOverflow(msg *Message) {
+	if cons.enqueueTimeout <= 0 {
+		cons.modulatorQueue.Push(msg, 0)
+		return // ### return, no timeout ###
+	}
+
+	// Only log state changes as this is called for every message while the
+	// queue is full.
+	if atomic.CompareAndSwapInt32(&cons.overflowing, 0, 1) {
+		cons.Logger.Warningf("Modulator queue is full, applying OverflowPolicy \"%s\"", cons.overflowPolicy)
+	}
+
+	switch cons.overflowPolicy {
+	case overflowPolicyDropNewest:
+		MetricMessagesOverflowDropped.Inc(1)
+
+	case overflowPolicyDropOldest:
+		for {
+			switch cons.modulatorQueue.Push(msg, -1) {
+			case MessageQueueOk:
+				return // ### return, queued ###
+			case MessageQueueTimeout:
+				MetricMessagesOverflowDropped.Inc(1)
+				return // ### return, queue closed ###
+			}
+
+			select {
+			case <-cons.modulatorQueue:
+				MetricMessagesOverflowDropped.Inc(1)
+			default:
+				// Messages have been fetched in the meantime, retry
+			}
+		}
+
+	default:
+		cons.modulatorQueue.Push(msg, 0)
+	}
 }
 
 func (cons *SimpleConsumer) processQueue() {
 loop:
 	if msg, hasMore := cons.modulatorQueue.Pop(); hasMore {
+		cons.queueMetrics.Update()
 		cons.directEnqueue(msg)
 		goto loop
 	}
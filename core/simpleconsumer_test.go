@@ -15,6 +15,7 @@
 package core
 
 import (
+	"github.com/trivago/tgo/thealthcheck"
 	"github.com/trivago/tgo/ttesting"
 	"testing"
 	"time"
@@ -65,6 +66,159 @@ func TestSimpleConsumerConfigureWithModulatorRoutines(t *testing.T) {
 	expect.Equal(PluginStateInitializing, mockSimpleConsumer.runState.GetState())
 }
 
+func TestSimpleConsumerQueueMetrics(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	mockConf := NewPluginConfig(t.Name(), "mockSimpleConsumer")
+	mockConf.Override("Streams", []string{"testBoundStream"})
+	mockConf.Override("ModulatorRoutines", 0)
+
+	registerMockRouter("testBoundStream")
+
+	mockSimpleConsumer, err := getSimpleConsumer(mockConf)
+	expect.NoError(err)
+	expect.Nil(mockSimpleConsumer.queueMetrics)
+
+	// Fill a queue nobody reads from to check the metrics under load
+	mockSimpleConsumer.modulatorQueue = NewMessageQueue(16)
+	mockSimpleConsumer.queueMetrics = NewMessageQueueMetrics(mockSimpleConsumer.modulatorQueue, t.Name())
+
+	for i := 0; i < 10; i++ {
+		mockSimpleConsumer.parallelEnqueue(NewMessage(nil, []byte("message"), nil, InvalidStreamID))
+	}
+	expect.Equal(int64(10), mockSimpleConsumer.queueMetrics.Depth.Value())
+	expect.Equal(int64(10), mockSimpleConsumer.queueMetrics.HighWaterMark.Value())
+	expect.Equal(mockSimpleConsumer.queueMetrics.Depth, MetricsRegistry.Get(t.Name()+".queue.depth"))
+
+	mockSimpleConsumer.modulatorQueue.Pop()
+	mockSimpleConsumer.queueMetrics.Update()
+	expect.Equal(int64(9), mockSimpleConsumer.queueMetrics.Depth.Value())
+	expect.Equal(int64(10), mockSimpleConsumer.queueMetrics.HighWaterMark.Value())
+}
+
+// getOverflowTestConsumer returns a consumer enqueueing to a full queue of
+// two messages nobody reads from.
+func getOverflowTestConsumer(t *testing.T, policy string) (*SimpleConsumer, []*Message) {
+	expect := ttesting.NewExpect(t)
+
+	mockConf := NewPluginConfig(t.Name(), "mockSimpleConsumer")
+	mockConf.Override("Streams", []string{"testBoundStream"})
+	mockConf.Override("OverflowPolicy", policy)
+
+	registerMockRouter("testBoundStream")
+
+	mockSimpleConsumer, err := getSimpleConsumer(mockConf)
+	expect.NoError(err)
+
+	mockSimpleConsumer.modulatorQueue = NewMessageQueue(2)
+	mockSimpleConsumer.queueMetrics = NewMessageQueueMetrics(mockSimpleConsumer.modulatorQueue, t.Name())
+	mockSimpleConsumer.enqueueTimeout = 10 * time.Millisecond
+
+	queued := []*Message{
+		NewMessage(nil, []byte("first"), nil, InvalidStreamID),
+		NewMessage(nil, []byte("second"), nil, InvalidStreamID),
+	}
+	for _, msg := range queued {
+		mockSimpleConsumer.parallelEnqueue(msg)
+	}
+	return &mockSimpleConsumer, queued
+}
+
+func TestSimpleConsumerOverflowBlock(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockSimpleConsumer, queued := getOverflowTestConsumer(t, "block")
+	dropped := MetricMessagesOverflowDropped.Count()
+
+	done := make(chan struct{})
+	go func() {
+		mockSimpleConsumer.parallelEnqueue(NewMessage(nil, []byte("third"), nil, InvalidStreamID))
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		t.Error("Enqueue did not block on a full queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	msg, _ := mockSimpleConsumer.modulatorQueue.Pop()
+	expect.Equal(queued[0], msg)
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Enqueue did not resume after a message has been fetched")
+	}
+
+	msg, _ = mockSimpleConsumer.modulatorQueue.Pop()
+	expect.Equal(queued[1], msg)
+	msg, _ = mockSimpleConsumer.modulatorQueue.Pop()
+	expect.Equal("third", msg.String())
+	expect.Equal(dropped, MetricMessagesOverflowDropped.Count())
+}
+
+func TestSimpleConsumerOverflowDropNewest(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockSimpleConsumer, queued := getOverflowTestConsumer(t, "drop_newest")
+	dropped := MetricMessagesOverflowDropped.Count()
+
+	mockSimpleConsumer.parallelEnqueue(NewMessage(nil, []byte("third"), nil, InvalidStreamID))
+	expect.Equal(dropped+1, MetricMessagesOverflowDropped.Count())
+	expect.Equal(int64(2), mockSimpleConsumer.queueMetrics.Depth.Value())
+
+	expect.Equal(int32(1), mockSimpleConsumer.overflowing)
+
+	msg, _ := mockSimpleConsumer.modulatorQueue.Pop()
+	expect.Equal(queued[0], msg)
+
+	mockSimpleConsumer.parallelEnqueue(NewMessage(nil, []byte("fourth"), nil, InvalidStreamID))
+	expect.Equal(dropped+1, MetricMessagesOverflowDropped.Count())
+	expect.Equal(int32(0), mockSimpleConsumer.overflowing)
+
+	msg, _ = mockSimpleConsumer.modulatorQueue.Pop()
+	expect.Equal(queued[1], msg)
+	msg, _ = mockSimpleConsumer.modulatorQueue.Pop()
+	expect.Equal("fourth", msg.String())
+}
+
+func TestSimpleConsumerOverflowDropOldest(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	mockSimpleConsumer, queued := getOverflowTestConsumer(t, "drop_oldest")
+	dropped := MetricMessagesOverflowDropped.Count()
+
+	mockSimpleConsumer.parallelEnqueue(NewMessage(nil, []byte("third"), nil, InvalidStreamID))
+	expect.Equal(dropped+1, MetricMessagesOverflowDropped.Count())
+	expect.Equal(int64(2), mockSimpleConsumer.queueMetrics.Depth.Value())
+
+	msg, _ := mockSimpleConsumer.modulatorQueue.Pop()
+	expect.Equal(queued[1], msg)
+	msg, _ = mockSimpleConsumer.modulatorQueue.Pop()
+	expect.Equal("third", msg.String())
+}
+
+func TestSimpleConsumerOverflowPolicyConfig(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	mockConf := NewPluginConfig(t.Name(), "mockSimpleConsumer")
+	mockConf.Override("Streams", []string{"testBoundStream"})
+	mockConf.Override("OverflowPolicy", "drop_random")
+
+	registerMockRouter("testBoundStream")
+
+	_, err := getSimpleConsumer(mockConf)
+	expect.NotNil(err)
+
+	// A timeout without modulator routines starts one routine
+	mockConf = NewPluginConfig(t.Name()+"Timeout", "mockSimpleConsumer")
+	mockConf.Override("Streams", []string{"testBoundStream"})
+	mockConf.Override("EnqueueTimeoutMs", 100)
+
+	mockSimpleConsumer, err := getSimpleConsumer(mockConf)
+	expect.NoError(err)
+	expect.Equal(100*time.Millisecond, mockSimpleConsumer.enqueueTimeout)
+	expect.NotNil(mockSimpleConsumer.modulatorQueue)
+}
+
 func TestSimpleConsumerGetShutdownTimeout(t *testing.T) {
 	expect := ttesting.NewExpect(t)
 
@@ -135,3 +289,82 @@ func TestSimpleConsumerStateMethods(t *testing.T) {
 	expect.True(mockSimpleConsumer.IsActiveOrStopping())
 	expect.True(mockSimpleConsumer.IsStopping())
 }
+
+func TestSimpleConsumerHealthCheck(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	mockConf := NewPluginConfig("mockSimpleConsumerHealthCheck", "mockSimpleConsumer")
+	mockConf.Override("Streams", []string{"testBoundStream"})
+
+	// Router needs to be configured to avoid unknown class errors
+	registerMockRouter("testBoundStream")
+
+	mockSimpleConsumer, err := getSimpleConsumer(mockConf)
+	expect.NoError(err)
+
+	code, _ := mockSimpleConsumer.HealthCheck()
+	expect.Equal(thealthcheck.StatusOK, code)
+
+	mockSimpleConsumer.AddHealthCheck(func() (int, string) {
+		return thealthcheck.StatusServiceUnavailable, "NOT_CONNECTED"
+	})
+
+	code, body := mockSimpleConsumer.HealthCheck()
+	expect.Equal(thealthcheck.StatusServiceUnavailable, code)
+	expect.Equal("NOT_CONNECTED", body)
+}
+
+func TestSimpleConsumerMaxMessageBytes(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	mockConf := NewPluginConfig(t.Name(), "mockSimpleConsumer")
+	mockConf.Override("Streams", []string{"testBoundStream"})
+	mockConf.Override("MaxMessageBytes", 4)
+
+	registerMockRouter("testBoundStream")
+
+	mockSimpleConsumer, err := getSimpleConsumer(mockConf)
+	expect.NoError(err)
+
+	enqueued := []string{}
+	mockSimpleConsumer.enqueueMessage = func(msg *Message) {
+		enqueued = append(enqueued, msg.String())
+	}
+
+	dropped := MetricMessagesOversizeDropped.Count()
+	mockSimpleConsumer.Enqueue([]byte("abc"))
+	mockSimpleConsumer.Enqueue([]byte("abcd"))
+	mockSimpleConsumer.Enqueue([]byte("abcde"))
+	mockSimpleConsumer.EnqueueWithMetadata([]byte("abcdef"), nil)
+
+	expect.Equal([]string{"abc", "abcd"}, enqueued)
+	expect.Equal(dropped+2, MetricMessagesOversizeDropped.Count())
+	expect.Equal(int64(2), mockSimpleConsumer.oversizeDropped.Count())
+}
+
+func TestSimpleConsumerTruncateOversize(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	mockConf := NewPluginConfig(t.Name(), "mockSimpleConsumer")
+	mockConf.Override("Streams", []string{"testBoundStream"})
+	mockConf.Override("MaxMessageBytes", 4)
+	mockConf.Override("TruncateOversize", true)
+
+	registerMockRouter("testBoundStream")
+
+	mockSimpleConsumer, err := getSimpleConsumer(mockConf)
+	expect.NoError(err)
+
+	enqueued := []string{}
+	mockSimpleConsumer.enqueueMessage = func(msg *Message) {
+		enqueued = append(enqueued, msg.String())
+	}
+
+	truncated := MetricMessagesOversizeTruncated.Count()
+	mockSimpleConsumer.Enqueue([]byte("abcd"))
+	mockSimpleConsumer.Enqueue([]byte("abcdef"))
+
+	expect.Equal([]string{"abcd", "abcd"}, enqueued)
+	expect.Equal(truncated+1, MetricMessagesOversizeTruncated.Count())
+	expect.Equal(int64(1), mockSimpleConsumer.oversizeTruncate.Count())
+}
@@ -89,6 +89,14 @@ type SimpleFormatter struct {
 
 	// SourceIsMetadata returns true if the source setting points to metadata
 	SourceIsMetadata func() bool
+
+	// GetSourceKey returns the metadata key denoted by the source setting or
+	// "" if the source is the payload
+	GetSourceKey func() string
+
+	// GetTargetKey returns the metadata key denoted by the target setting or
+	// "" if the target is the payload
+	GetTargetKey func() string
 }
 
 // Configure sets up all values required by SimpleFormatter.
@@ -130,6 +138,9 @@ func (format *SimpleFormatter) Configure(conf PluginConfigReader) {
 	} else {
 		format.SourceIsMetadata = func() bool { return true }
 	}
+
+	format.GetSourceKey = func() string { return source }
+	format.GetTargetKey = func() string { return target }
 }
 
 // CanBeApplied returns true if the formatter can be applied to this message
@@ -14,6 +14,12 @@
 
 package core
 
+import (
+	"testing"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
 type mockFormatter struct {
 	SimpleFormatter
 }
@@ -25,3 +31,43 @@ func (formatter *mockFormatter) ApplyFormatter(msg *Message) error {
 func (formatter *mockFormatter) Modulate(msg *Message) ModulateResult {
 	return ModulateResultContinue
 }
+
+func TestSimpleFormatterApplyTo(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	for _, testCase := range []struct {
+		settings map[string]interface{}
+		source   string
+		target   string
+	}{
+		{map[string]interface{}{}, "", ""},
+		{map[string]interface{}{"ApplyTo": "foo"}, "foo", "foo"},
+		{map[string]interface{}{"ApplyTo": "foo", "Target": "bar"}, "", "bar"},
+		{map[string]interface{}{"Source": "foo"}, "foo", ""},
+	} {
+		config := NewPluginConfig("", "mockFormatter")
+		for key, value := range testCase.settings {
+			config.Override(key, value)
+		}
+
+		formatter := mockFormatter{}
+		formatter.Configure(NewPluginConfigReader(&config))
+
+		expect.Equal(testCase.source, formatter.GetSourceKey())
+		expect.Equal(testCase.target, formatter.GetTargetKey())
+		expect.Equal(testCase.source != "", formatter.SourceIsMetadata())
+		expect.Equal(testCase.target != "", formatter.TargetIsMetadata())
+	}
+
+	config := NewPluginConfig("", "mockFormatter")
+	config.Override("ApplyTo", "foo")
+	formatter := mockFormatter{}
+	formatter.Configure(NewPluginConfigReader(&config))
+
+	msg := NewMessage(nil, []byte("payload"), nil, InvalidStreamID)
+	msg.GetMetadata().Set("foo", "metadata")
+	formatter.SetTargetData(msg, formatter.GetSourceDataAsString(msg)+"!")
+
+	expect.Equal("payload", msg.String())
+	expect.MapEqual(msg.GetMetadata(), "foo", "metadata!")
+}
@@ -17,6 +17,7 @@ package core
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -29,6 +30,9 @@ import (
 // This type defines a common baseclass for all producers. All producer plugins
 // should derive from this class as all required basic functions are already
 // implemented here in a general way.
+// Failed connection attempts, failed writes and messages sent to the fallback
+// are counted by the metrics "<ID>.errors.connect", "<ID>.errors.send" and
+// "<ID>.fallback". See GetErrorMetrics.
 //
 // Parameters
 //
@@ -48,6 +52,26 @@ import (
 // considered to have shut down.  Decreasing this value may lead to lost
 // messages during shutdown. Raising it may increase shutdown time.
 //
+// - ShutdownDrainTimeoutMs: Defines the maximum time in milliseconds a producer
+// is allowed to spend on writing pending messages during shutdown. Messages
+// that are still pending after this time are sent to the fallback. Writes that
+// are stuck, e.g. an upload to a slow backend, are abandoned. Setting this
+// parameter to 0 disables the deadline.
+// By default this parameter is set to 0.
+//
+// - MaxAgeSec: Defines the maximum age of a message in seconds. Messages that
+// are older when the producer starts to process them are dropped and counted
+// by the "dropped_expired" metric. The age is measured from the time the
+// message was created by the consumer. Setting this parameter to 0 disables
+// the check.
+// By default this parameter is set to 0.
+//
+// - ExpiredStream: Defines a stream to route messages to that have been
+// dropped because of MaxAgeSec. Like with FallbackStream, the message is
+// reset to its original state before being routed. Setting this parameter
+// to "" will cause expired messages to be discarded.
+// By default this parameter is set to "".
+//
 // - Modulators: Defines a list of modulators to be applied to a message when
 // it arrives at this producer. If a modulator changes the stream of a message
 // the message is NOT routed to this stream anymore.
@@ -60,10 +84,19 @@ type SimpleProducer struct {
 	modulators      ModulatorArray    `config:"Modulators"`
 	fallbackStream  Router            `config:"FallbackStream" default:""`
 	shutdownTimeout time.Duration     `config:"ShutdownTimeoutMs" default:"1000" metric:"ms"`
+	maxAge          time.Duration     `config:"MaxAgeSec" default:"0" metric:"sec"`
+	expiredStream   Router            `config:"ExpiredStream" default:""`
 	onRoll          func()
 	onPrepareStop   func()
 	onStop          func()
+	errorMetrics    *PluginErrorMetrics
 	Logger          logrus.FieldLogger
+
+	healthCheck    thealthcheck.CallbackFunc
+	drainTimeout   time.Duration `config:"ShutdownDrainTimeoutMs" default:"0" metric:"ms"`
+	drainDeadline  time.Time
+	drainAbandoned bool
+	drainCount     int64
 }
 
 // Configure initializes the standard producer config values.
@@ -72,6 +105,7 @@ func (prod *SimpleProducer) Configure(conf PluginConfigReader) {
 	prod.Logger = conf.GetLogger()
 	prod.runState = NewPluginRunState()
 	prod.control = make(chan PluginControl, 1)
+	prod.errorMetrics = NewPluginErrorMetrics(prod.id)
 
 	// Simple health check for the plugin state
 	//   Path: "/<plugin_id>/pluginState"
@@ -90,14 +124,30 @@ func (prod *SimpleProducer) GetLogger() logrus.FieldLogger {
 	return prod.Logger
 }
 
-// AddHealthCheck adds a health check at the default URL (http://<addr>:<port>/<plugin_id>)
+// AddHealthCheck sets the health check served at the default URL
+// (http://<addr>:<port>/<plugin_id>). See HealthCheck.
 func (prod *SimpleProducer) AddHealthCheck(callback thealthcheck.CallbackFunc) {
-	prod.AddHealthCheckAt("", callback)
+	prod.healthCheck = callback
+}
+
+// HealthCheck calls the callback set by AddHealthCheck. If no callback has
+// been set the producer is always reported as healthy.
+func (prod *SimpleProducer) HealthCheck() (code int, body string) {
+	if prod.healthCheck == nil {
+		return thealthcheck.StatusOK, "OK"
+	}
+	return prod.healthCheck()
 }
 
 // AddHealthCheckAt adds a health check at a subpath (http://<addr>:<port>/<plugin_id><path>)
 func (prod *SimpleProducer) AddHealthCheckAt(path string, callback thealthcheck.CallbackFunc) {
-	thealthcheck.AddEndpoint("/"+prod.GetID()+path, callback)
+	AddHealthCheckEndpoint("/"+prod.GetID()+path, callback)
+}
+
+// GetErrorMetrics returns the error counters of this producer. Plugins should
+// count failed connection attempts and failed writes here.
+func (prod *SimpleProducer) GetErrorMetrics() *PluginErrorMetrics {
+	return prod.errorMetrics
 }
 
 // GetID returns the ID of this producer
@@ -180,6 +230,12 @@ func (prod *SimpleProducer) WorkerDone() {
 	prod.runState.WorkerDone()
 }
 
+// GetWorkerCount returns the number of workers of this plugin that have not
+// returned yet.
+func (prod *SimpleProducer) GetWorkerCount() int {
+	return prod.runState.GetWorkerCount()
+}
+
 // GetShutdownTimeout returns the duration gollum will wait for this producer
 // before canceling the shutdown process.
 func (prod *SimpleProducer) GetShutdownTimeout() time.Duration {
@@ -223,11 +279,90 @@ func (prod *SimpleProducer) HasContinueAfterModulate(msg *Message) bool {
 
 // TryFallback routes the message to the configured fallback stream.
 func (prod *SimpleProducer) TryFallback(msg *Message) {
+	prod.errorMetrics.CountFallback()
 	if err := RouteOriginal(msg, prod.fallbackStream); err != nil {
 		prod.Logger.WithError(err).Error("Failed to route to fallback")
 	}
 }
 
+// IsExpired returns true if MaxAgeSec is set and the given message is older
+// than that.
+func (prod *SimpleProducer) IsExpired(msg *Message) bool {
+	return prod.maxAge > 0 && time.Since(msg.GetCreationTime()) > prod.maxAge
+}
+
+// DropIfExpired drops the given message if IsExpired returns true. Dropped
+// messages are routed to ExpiredStream if set. The return value indicates
+// whether the message has been dropped.
+func (prod *SimpleProducer) DropIfExpired(msg *Message) bool {
+	if !prod.IsExpired(msg) {
+		return false
+	}
+
+	MetricMessagesExpired.Inc(1)
+	if prod.expiredStream == nil {
+		DiscardMessage(msg, prod.GetID(), "Producer dropped expired message")
+		return true // ### return, no expired stream ###
+	}
+
+	if err := RouteOriginal(msg, prod.expiredStream); err != nil {
+		prod.Logger.WithError(err).Error("Failed to route expired message")
+	}
+	return true
+}
+
+// GetShutdownDrainTimeout returns the duration this producer may spend on
+// writing pending messages during shutdown. A value of 0 means no deadline.
+func (prod *SimpleProducer) GetShutdownDrainTimeout() time.Duration {
+	return prod.drainTimeout
+}
+
+// HasDrainDeadline returns true if ShutdownDrainTimeoutMs has been set and the
+// producer has started to shut down.
+func (prod *SimpleProducer) HasDrainDeadline() bool {
+	return !prod.drainDeadline.IsZero()
+}
+
+// IsDrainDeadlineExceeded returns true if the producer is shutting down and
+// pending messages should not be written anymore.
+func (prod *SimpleProducer) IsDrainDeadlineExceeded() bool {
+	return prod.HasDrainDeadline() && (prod.drainAbandoned || !time.Now().Before(prod.drainDeadline))
+}
+
+// RunBeforeDrainDeadline calls the given function and waits for it to return
+// until the drain deadline has been reached. If the function did not return in
+// time it is abandoned and false is returned. If there is no drain deadline
+// the function is called synchronously.
+func (prod *SimpleProducer) RunBeforeDrainDeadline(callback func()) bool {
+	if !prod.HasDrainDeadline() {
+		callback()
+		return true // ### return, no deadline ###
+	}
+	if !tgo.ReturnAfter(time.Until(prod.drainDeadline), callback) {
+		prod.Logger.Warning("Drain deadline reached. Abandoning pending writes.")
+		return false // ### return, deadline reached ###
+	}
+	return true
+}
+
+// GetDrainCount returns the number of messages handled while draining during
+// shutdown, including messages sent to the fallback.
+func (prod *SimpleProducer) GetDrainCount() int64 {
+	return atomic.LoadInt64(&prod.drainCount)
+}
+
+// countDrained adds to the number of messages returned by GetDrainCount.
+func (prod *SimpleProducer) countDrained(count int) {
+	atomic.AddInt64(&prod.drainCount, int64(count))
+}
+
+// startDrain sets the drain deadline if ShutdownDrainTimeoutMs has been set.
+func (prod *SimpleProducer) startDrain() {
+	if prod.drainTimeout > 0 {
+		prod.drainDeadline = time.Now().Add(prod.drainTimeout)
+	}
+}
+
 // ControlLoop listens to the control channel and triggers callbacks for these
 // messags. Upon stop control message doExit will be set to true.
 func (prod *SimpleProducer) ControlLoop() {
@@ -245,6 +380,7 @@ func (prod *SimpleProducer) ControlLoop() {
 		case PluginControlStopProducer:
 			prod.Logger.Debug("Preparing for stop")
 			prod.setState(PluginStatePrepareStop)
+			prod.startDrain()
 
 			if prod.onPrepareStop != nil {
 				if !tgo.ReturnAfter(prod.shutdownTimeout*5, prod.onPrepareStop) {
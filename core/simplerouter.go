@@ -18,6 +18,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/trivago/tgo/thealthcheck"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -38,13 +39,27 @@ import (
 // handled by the router. You can disable this behavior by setting it to "0".
 // By default this parameter is set to "0".
 //
+// - Ordering: This value defines the ordering guarantee of this stream. When
+// set to "strict", messages are filtered and passed to the producers one at a
+// time, in the order they were routed to this stream. Consumers sending to
+// this stream are limited to one modulator go routine, see ModulatorRoutines.
+// This limits the throughput of the stream to what a single go routine can
+// handle. Ordering inside of plugins, e.g. across Kafka partitions, is not
+// affected. When set to "none", messages may be processed in parallel.
+// Fallback streams of producers bound to a strict stream must not point to
+// the stream itself.
+// By default this parameter is set to "none".
+//
 type SimpleRouter struct {
-	id        string
-	Producers []Producer
-	filters   FilterArray     `config:"Filters"`
-	timeout   time.Duration   `config:"TimeoutMs" default:"0" metric:"ms"`
-	streamID  MessageStreamID `config:"Stream"`
-	Logger    logrus.FieldLogger
+	id            string
+	Producers     []Producer
+	filters       FilterArray     `config:"Filters"`
+	timeout       time.Duration   `config:"TimeoutMs" default:"0" metric:"ms"`
+	streamID      MessageStreamID `config:"Stream"`
+	ordering      string          `config:"Ordering" default:"none"`
+	Logger        logrus.FieldLogger
+	producerGuard sync.RWMutex
+	orderGuard    *sync.Mutex
 }
 
 // Configure sets up all values required by SimpleRouter.
@@ -55,6 +70,27 @@ func (router *SimpleRouter) Configure(conf PluginConfigReader) {
 	if router.streamID == WildcardStreamID && strings.Index(router.id, GeneratedRouterPrefix) != 0 {
 		router.Logger.Info("A wildcard stream configuration only affects the wildcard stream, not all routers")
 	}
+
+	switch strings.ToLower(router.ordering) {
+	case "none":
+		router.orderGuard = nil
+	case "strict":
+		router.orderGuard = new(sync.Mutex)
+	default:
+		conf.Errors.Pushf("Ordering must be one of none or strict")
+	}
+}
+
+// IsOrdered returns true if this router processes one message at a time,
+// i.e. if Ordering is set to strict.
+func (router *SimpleRouter) IsOrdered() bool {
+	return router.orderGuard != nil
+}
+
+// getOrderGuard returns the mutex held while a message is routed or nil if
+// messages may be routed in parallel.
+func (router *SimpleRouter) getOrderGuard() *sync.Mutex {
+	return router.orderGuard
 }
 
 // GetLogger returns the logging scope of this plugin
@@ -69,7 +105,7 @@ func (router *SimpleRouter) AddHealthCheck(callback thealthcheck.CallbackFunc) {
 
 // AddHealthCheckAt adds a health check at a subpath (http://<addr>:<port>/<plugin_id><path>)
 func (router *SimpleRouter) AddHealthCheckAt(path string, callback thealthcheck.CallbackFunc) {
-	thealthcheck.AddEndpoint("/"+router.GetID()+path, callback)
+	AddHealthCheckEndpoint("/"+router.GetID()+path, callback)
 }
 
 // GetID returns the ID of this router
@@ -90,6 +126,9 @@ func (router *SimpleRouter) GetTimeout() time.Duration {
 // AddProducer adds all producers to the list of known producers.
 // Duplicates will be filtered.
 func (router *SimpleRouter) AddProducer(producers ...Producer) {
+	router.producerGuard.Lock()
+	defer router.producerGuard.Unlock()
+
 	for _, prod := range producers {
 		for _, inListProd := range router.Producers {
 			if inListProd == prod {
@@ -100,8 +139,54 @@ func (router *SimpleRouter) AddProducer(producers ...Producer) {
 	}
 }
 
+// RemoveProducer removes all given producers from the list of known
+// producers. The list is copied so that callers of GetProducers are not
+// affected.
+func (router *SimpleRouter) RemoveProducer(producers ...Producer) {
+	router.producerGuard.Lock()
+	defer router.producerGuard.Unlock()
+
+	remaining := make([]Producer, 0, len(router.Producers))
+nextProd:
+	for _, inListProd := range router.Producers {
+		for _, prod := range producers {
+			if inListProd == prod {
+				continue nextProd
+			}
+		}
+		remaining = append(remaining, inListProd)
+	}
+	router.Producers = remaining
+}
+
+// ReplaceProducer replaces oldProducer by newProducer in the list of known
+// producers. If oldProducer is not in the list, newProducer is added. The list
+// is copied so that callers of GetProducers are not affected.
+func (router *SimpleRouter) ReplaceProducer(oldProducer Producer, newProducer Producer) {
+	router.producerGuard.Lock()
+	defer router.producerGuard.Unlock()
+
+	replaced := make([]Producer, 0, len(router.Producers)+1)
+	hasNewProducer := false
+	for _, inListProd := range router.Producers {
+		if inListProd != oldProducer && inListProd != newProducer {
+			replaced = append(replaced, inListProd)
+		} else if !hasNewProducer {
+			replaced = append(replaced, newProducer)
+			hasNewProducer = true
+		}
+	}
+
+	if !hasNewProducer {
+		replaced = append(replaced, newProducer)
+	}
+	router.Producers = replaced
+}
+
 // GetProducers returns the producers bound to this stream
 func (router *SimpleRouter) GetProducers() []Producer {
+	router.producerGuard.RLock()
+	defer router.producerGuard.RUnlock()
 	return router.Producers
 }
 
@@ -157,6 +157,18 @@ nextProd:
 	}
 }
 
+// UnregisterWildcardProducer removes a producer from the list of known
+// wildcard producers. Routers the producer has already been added to are not
+// changed.
+func (registry *streamRegistry) UnregisterWildcardProducer(producer Producer) {
+	for i, existing := range registry.wildcard {
+		if existing == producer {
+			registry.wildcard = append(registry.wildcard[:i:i], registry.wildcard[i+1:]...)
+			return
+		}
+	}
+}
+
 // AddWildcardProducersToRouter adds all known wildcard producers to a given
 // router. The state of the wildcard list is undefined during the configuration
 // phase.
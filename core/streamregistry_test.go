@@ -93,6 +93,13 @@ func TestStreamRegistryWildcardProducer(t *testing.T) {
 	mockSRegistry.RegisterWildcardProducer(producer1, producer2)
 
 	expect.True(mockSRegistry.WildcardProducersExist())
+
+	// UnregisterWildcardProducer()
+	mockSRegistry.UnregisterWildcardProducer(producer1)
+	expect.Equal([]Producer{producer2}, mockSRegistry.wildcard)
+	mockSRegistry.UnregisterWildcardProducer(producer1)
+	mockSRegistry.UnregisterWildcardProducer(producer2)
+	expect.False(mockSRegistry.WildcardProducersExist())
 }
 
 func TestStreamRegistryAddWildcardProducersToStream(t *testing.T) {
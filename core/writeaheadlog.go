@@ -0,0 +1,496 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	walRecordHeaderSize = 8
+	walAckFileSize      = 16
+)
+
+// ErrWriteAheadLogFull is returned by WriteAheadLog.Append if a message
+// does not fit into the log, even after all acknowledged messages have been
+// removed.
+var ErrWriteAheadLogFull = fmt.Errorf("write ahead log is full")
+
+var (
+	openWriteAheadLogs      = make(map[string]*WriteAheadLog)
+	openWriteAheadLogsGuard = new(sync.Mutex)
+)
+
+// WriteAheadLog persists messages to a local segment file before they are
+// processed, so that messages not acknowledged before a crash can be
+// replayed on restart.
+// Each record is stored as a 4 byte length, a 4 byte CRC32 checksum and
+// the serialized message. A separate ack file stores the segment number and
+// the offset of the first message that has not been acknowledged yet.
+// Messages may be acknowledged in any order, the ack offset only moves past
+// a message once all messages written before it have been acknowledged.
+// As of this, replayed messages may contain duplicates but no message is
+// lost as long as it has been appended.
+// A log is only opened once per process. Opening it again, e.g. when a
+// producer is replaced during a config reload, returns the open log, which
+// is closed after all users called Close.
+type WriteAheadLog struct {
+	basePath     string
+	registryKey  string
+	refCount     int
+	maxSize      int64
+	syncInterval time.Duration
+	segment      *os.File
+	segmentID    uint64
+	size         int64
+	ackOffset    int64
+	ackDirty     bool
+	lastSync     time.Time
+	lastAckSync  time.Time
+	entries      []*walEntry
+	inFlight     map[*Message]*walEntry
+	replay       []*Message
+	logger       logrus.FieldLogger
+	guard        sync.Mutex
+}
+
+type walEntry struct {
+	start int64
+	end   int64
+	acked bool
+}
+
+// NewWriteAheadLog opens or creates the log stored at basePath. The segment
+// files are named "<basePath>.<segment>.wal", the ack file "<basePath>.ack".
+// A maxSize of 0 does not limit the size of the log. A syncInterval of 0
+// syncs the log to disk after every write.
+// Messages that have not been acknowledged when the log was last used are
+// available via GetReplay.
+// If the log is already open, the open log is returned and maxSize and
+// syncInterval are updated. Messages to replay are only returned to the
+// first user.
+func NewWriteAheadLog(basePath string, maxSize int64, syncInterval time.Duration, logger logrus.FieldLogger) (*WriteAheadLog, error) {
+	registryKey, err := filepath.Abs(basePath)
+	if err != nil {
+		return nil, err
+	}
+
+	openWriteAheadLogsGuard.Lock()
+	defer openWriteAheadLogsGuard.Unlock()
+
+	if wal, isOpen := openWriteAheadLogs[registryKey]; isOpen {
+		wal.guard.Lock()
+		defer wal.guard.Unlock()
+
+		wal.refCount++
+		wal.maxSize = maxSize
+		wal.syncInterval = syncInterval
+		return wal, nil // ### return, take over open log ###
+	}
+
+	if err := os.MkdirAll(filepath.Dir(basePath), 0755); err != nil {
+		return nil, err
+	}
+
+	wal := &WriteAheadLog{
+		basePath:     basePath,
+		registryKey:  registryKey,
+		refCount:     1,
+		maxSize:      maxSize,
+		syncInterval: syncInterval,
+		inFlight:     make(map[*Message]*walEntry),
+		logger:       logger,
+	}
+
+	if err := wal.readAckFile(); err != nil {
+		return nil, err
+	}
+
+	records, err := wal.readRecords(wal.getSegmentPath(wal.segmentID), wal.ackOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start with a fresh segment that only contains unacknowledged messages
+	if err := wal.rotate(records); err != nil {
+		return nil, err
+	}
+
+	offset := int64(0)
+	for _, record := range records {
+		msg, err := DeserializeMessage(record[walRecordHeaderSize:])
+		if err != nil {
+			wal.logger.WithError(err).Error("Failed to deserialize message from write ahead log")
+			msg = nil
+		}
+
+		entry := &walEntry{start: offset, end: offset + int64(len(record))}
+		offset = entry.end
+		wal.entries = append(wal.entries, entry)
+
+		if msg == nil {
+			entry.acked = true
+		} else {
+			wal.inFlight[msg] = entry
+			wal.replay = append(wal.replay, msg)
+		}
+	}
+	wal.moveAckOffset()
+
+	if len(wal.replay) > 0 {
+		wal.logger.Infof("Replaying %d messages from write ahead log", len(wal.replay))
+	}
+
+	openWriteAheadLogs[registryKey] = wal
+	return wal, nil
+}
+
+// GetReplay returns all messages that were not acknowledged when the log was
+// last closed. These messages still need to be acknowledged after being
+// processed.
+func (wal *WriteAheadLog) GetReplay() []*Message {
+	wal.guard.Lock()
+	defer wal.guard.Unlock()
+
+	replay := wal.replay
+	wal.replay = nil
+	return replay
+}
+
+// GetNumInFlight returns the number of messages that have been appended but
+// not yet acknowledged.
+func (wal *WriteAheadLog) GetNumInFlight() int {
+	wal.guard.Lock()
+	defer wal.guard.Unlock()
+	return len(wal.inFlight)
+}
+
+// Append serializes the given message and writes it to the log. The message
+// has to be passed to Ack once it has been processed.
+func (wal *WriteAheadLog) Append(msg *Message) error {
+	data, err := msg.Serialize()
+	if err != nil {
+		return err
+	}
+
+	record := make([]byte, walRecordHeaderSize+len(data))
+	binary.BigEndian.PutUint32(record[0:], uint32(len(data)))
+	binary.BigEndian.PutUint32(record[4:], crc32.ChecksumIEEE(data))
+	copy(record[walRecordHeaderSize:], data)
+
+	wal.guard.Lock()
+	defer wal.guard.Unlock()
+
+	if wal.segment == nil {
+		return fmt.Errorf("write ahead log is closed")
+	}
+
+	if wal.maxSize > 0 && wal.size+int64(len(record)) > wal.maxSize {
+		if err := wal.compact(); err != nil {
+			return err
+		}
+		if wal.size+int64(len(record)) > wal.maxSize {
+			return ErrWriteAheadLogFull
+		}
+	}
+
+	if _, err := wal.segment.Write(record); err != nil {
+		return err
+	}
+
+	entry := &walEntry{start: wal.size, end: wal.size + int64(len(record))}
+	wal.size = entry.end
+	wal.entries = append(wal.entries, entry)
+	wal.inFlight[msg] = entry
+
+	if time.Since(wal.lastSync) >= wal.syncInterval {
+		wal.lastSync = time.Now()
+		return wal.segment.Sync()
+	}
+	return nil
+}
+
+// Ack marks the given message as processed. Messages that have not been
+// appended to the log are ignored.
+func (wal *WriteAheadLog) Ack(msg *Message) {
+	wal.guard.Lock()
+	defer wal.guard.Unlock()
+
+	entry, exists := wal.inFlight[msg]
+	if !exists {
+		return // ### return, not part of the log ###
+	}
+
+	delete(wal.inFlight, msg)
+	entry.acked = true
+	wal.moveAckOffset()
+
+	if wal.ackDirty && wal.segment != nil && time.Since(wal.lastAckSync) >= wal.syncInterval {
+		if err := wal.writeAckFile(); err != nil {
+			wal.logger.WithError(err).Error("Failed to write ack file of write ahead log")
+		}
+	}
+}
+
+// Close writes the current ack offset and closes the log. Messages that
+// have not been acknowledged will be replayed when the log is opened again.
+// If the log has been opened more than once, it stays open until the last
+// user calls Close.
+func (wal *WriteAheadLog) Close() error {
+	openWriteAheadLogsGuard.Lock()
+	defer openWriteAheadLogsGuard.Unlock()
+
+	wal.guard.Lock()
+	defer wal.guard.Unlock()
+
+	if wal.refCount > 1 {
+		wal.refCount--
+		return nil // ### return, still in use ###
+	}
+
+	wal.unregister()
+	if wal.segment == nil {
+		return nil // ### return, already closed ###
+	}
+
+	if err := wal.segment.Sync(); err != nil {
+		wal.logger.WithError(err).Error("Failed to sync write ahead log")
+	}
+	ackErr := wal.writeAckFile()
+	closeErr := wal.segment.Close()
+	wal.segment = nil
+
+	if ackErr != nil {
+		return ackErr
+	}
+	return closeErr
+}
+
+// unregister removes the log from the list of open logs, so that it is
+// opened again by the next call to NewWriteAheadLog.
+func (wal *WriteAheadLog) unregister() {
+	wal.refCount = 0
+	if openWriteAheadLogs[wal.registryKey] == wal {
+		delete(openWriteAheadLogs, wal.registryKey)
+	}
+}
+
+// moveAckOffset advances the ack offset past all leading acknowledged
+// entries.
+func (wal *WriteAheadLog) moveAckOffset() {
+	numAcked := 0
+	for _, entry := range wal.entries {
+		if !entry.acked {
+			break
+		}
+		numAcked++
+	}
+
+	if numAcked == 0 {
+		return // ### return, nothing to move ###
+	}
+
+	wal.ackOffset = wal.entries[numAcked-1].end
+	wal.entries = wal.entries[numAcked:]
+	wal.ackDirty = true
+}
+
+// compact moves all unacknowledged records to a new segment.
+func (wal *WriteAheadLog) compact() error {
+	if wal.ackOffset == 0 {
+		return nil // ### return, nothing to remove ###
+	}
+
+	if err := wal.segment.Sync(); err != nil {
+		return err
+	}
+
+	records, err := wal.readRecords(wal.getSegmentPath(wal.segmentID), wal.ackOffset)
+	if err != nil {
+		return err
+	}
+
+	shift := wal.ackOffset
+	if err := wal.rotate(records); err != nil {
+		return err
+	}
+
+	for _, entry := range wal.entries {
+		entry.start -= shift
+		entry.end -= shift
+	}
+	return nil
+}
+
+// rotate writes the given records to a new segment, points the ack file to
+// it and removes the previous segment. The new segment is only used after
+// the ack file has been written, so a crash during rotation either keeps
+// the old or uses the new segment.
+func (wal *WriteAheadLog) rotate(records [][]byte) error {
+	oldSegmentID := wal.segmentID
+	newSegmentID := oldSegmentID + 1
+	newPath := wal.getSegmentPath(newSegmentID)
+
+	segment, err := os.OpenFile(newPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	size := int64(0)
+	for _, record := range records {
+		if _, err := segment.Write(record); err != nil {
+			segment.Close()
+			return err
+		}
+		size += int64(len(record))
+	}
+
+	if err := segment.Sync(); err != nil {
+		segment.Close()
+		return err
+	}
+
+	oldSegment := wal.segment
+	wal.segment = segment
+	wal.segmentID = newSegmentID
+	wal.size = size
+	wal.ackOffset = 0
+
+	if err := wal.writeAckFile(); err != nil {
+		return err
+	}
+
+	if oldSegment != nil {
+		oldSegment.Close()
+	}
+	if err := os.Remove(wal.getSegmentPath(oldSegmentID)); err != nil && !os.IsNotExist(err) {
+		wal.logger.WithError(err).Warning("Failed to remove old write ahead log segment")
+	}
+
+	wal.lastSync = time.Now()
+	return nil
+}
+
+// readRecords returns all complete records of the given segment, starting
+// at offset. Reading stops at the first incomplete or corrupted record.
+func (wal *WriteAheadLog) readRecords(path string, offset int64) ([][]byte, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil // ### return, nothing written yet ###
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	records := [][]byte{}
+	reader := bufio.NewReader(file)
+	for {
+		header := make([]byte, walRecordHeaderSize)
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if err != io.EOF {
+				wal.logger.Warning("Ignoring incomplete record at the end of the write ahead log")
+			}
+			return records, nil // ### return, end of segment ###
+		}
+
+		record := make([]byte, walRecordHeaderSize+int(binary.BigEndian.Uint32(header[0:])))
+		copy(record, header)
+		if _, err := io.ReadFull(reader, record[walRecordHeaderSize:]); err != nil {
+			wal.logger.Warning("Ignoring incomplete record at the end of the write ahead log")
+			return records, nil // ### return, truncated record ###
+		}
+
+		if crc32.ChecksumIEEE(record[walRecordHeaderSize:]) != binary.BigEndian.Uint32(header[4:]) {
+			wal.logger.Warning("Ignoring corrupted records at the end of the write ahead log")
+			return records, nil // ### return, corrupted record ###
+		}
+		records = append(records, record)
+	}
+}
+
+// readAckFile loads segment and ack offset from disk. A missing ack file
+// is treated as an empty log.
+func (wal *WriteAheadLog) readAckFile() error {
+	data, err := ioutil.ReadFile(wal.getAckPath())
+	switch {
+	case os.IsNotExist(err):
+		return nil
+	case err != nil:
+		return err
+	case len(data) != walAckFileSize:
+		return fmt.Errorf("ack file %s is corrupted", wal.getAckPath())
+	}
+
+	wal.segmentID = binary.BigEndian.Uint64(data[0:])
+	wal.ackOffset = int64(binary.BigEndian.Uint64(data[8:]))
+	return nil
+}
+
+// writeAckFile atomically replaces the ack file with the current segment
+// and ack offset.
+func (wal *WriteAheadLog) writeAckFile() error {
+	data := make([]byte, walAckFileSize)
+	binary.BigEndian.PutUint64(data[0:], wal.segmentID)
+	binary.BigEndian.PutUint64(data[8:], uint64(wal.ackOffset))
+
+	tmpPath := wal.getAckPath() + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, wal.getAckPath()); err != nil {
+		return err
+	}
+
+	wal.ackDirty = false
+	wal.lastAckSync = time.Now()
+	return nil
+}
+
+func (wal *WriteAheadLog) getSegmentPath(segmentID uint64) string {
+	return fmt.Sprintf("%s.%d.wal", wal.basePath, segmentID)
+}
+
+func (wal *WriteAheadLog) getAckPath() string {
+	return wal.basePath + ".ack"
+}
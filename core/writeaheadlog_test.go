@@ -0,0 +1,200 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func newTestWriteAheadLog(t *testing.T, basePath string, maxSize int64) *WriteAheadLog {
+	expect := ttesting.NewExpect(t)
+	wal, err := NewWriteAheadLog(basePath, maxSize, 0, logrus.WithField("Scope", "test"))
+	expect.NoError(err)
+	return wal
+}
+
+// crash closes the segment without writing the ack file
+func (wal *WriteAheadLog) crash() {
+	openWriteAheadLogsGuard.Lock()
+	wal.unregister()
+	openWriteAheadLogsGuard.Unlock()
+
+	wal.segment.Close()
+	wal.segment = nil
+}
+
+func getPayloads(messages []*Message) []string {
+	payloads := []string{}
+	for _, msg := range messages {
+		payloads = append(payloads, msg.String())
+	}
+	return payloads
+}
+
+func TestWriteAheadLogReplay(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-wal")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+	basePath := filepath.Join(dir, "producer")
+
+	wal := newTestWriteAheadLog(t, basePath, 0)
+	expect.Equal(0, len(wal.GetReplay()))
+
+	messages := []*Message{}
+	for _, payload := range []string{"0", "1", "2", "3", "4"} {
+		msg := NewMessage(nil, []byte(payload), nil, 1)
+		msg.GetMetadata().Set("key", payload)
+		expect.NoError(wal.Append(msg))
+		messages = append(messages, msg)
+	}
+
+	wal.Ack(messages[1])
+	wal.Ack(messages[0])
+	wal.Ack(messages[3])
+	expect.Equal(2, wal.GetNumInFlight())
+	wal.crash()
+
+	// Message 3 has been acknowledged but lies behind message 2
+	wal = newTestWriteAheadLog(t, basePath, 0)
+	replay := wal.GetReplay()
+	expect.Equal([]string{"2", "3", "4"}, getPayloads(replay))
+	expect.Equal(3, wal.GetNumInFlight())
+
+	value, err := replay[0].GetMetadata().String("key")
+	expect.NoError(err)
+	expect.Equal("2", value)
+	expect.Equal(MessageStreamID(1), replay[0].GetStreamID())
+
+	// Replayed messages survive another crash until acknowledged
+	wal.Ack(replay[0])
+	wal.crash()
+
+	wal = newTestWriteAheadLog(t, basePath, 0)
+	replay = wal.GetReplay()
+	expect.Equal([]string{"3", "4"}, getPayloads(replay))
+
+	for _, msg := range replay {
+		wal.Ack(msg)
+	}
+	expect.NoError(wal.Close())
+
+	wal = newTestWriteAheadLog(t, basePath, 0)
+	expect.Equal(0, len(wal.GetReplay()))
+	expect.NoError(wal.Close())
+
+	segments, err := filepath.Glob(basePath + ".*.wal")
+	expect.NoError(err)
+	expect.Equal(1, len(segments))
+}
+
+func TestWriteAheadLogTakeOver(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-wal")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+	basePath := filepath.Join(dir, "producer")
+
+	oldWal := newTestWriteAheadLog(t, basePath, 0)
+	first := NewMessage(nil, []byte("first"), nil, 1)
+	second := NewMessage(nil, []byte("second"), nil, 1)
+	expect.NoError(oldWal.Append(first))
+	expect.NoError(oldWal.Append(second))
+	oldWal.Ack(first)
+
+	// Opening the log again, e.g. during a config reload, takes over the open
+	// log instead of rotating its segment.
+	newWal, err := NewWriteAheadLog(basePath, 1024, 0, logrus.WithField("Scope", "test"))
+	expect.NoError(err)
+	expect.True(oldWal == newWal)
+	expect.Equal(int64(1024), newWal.maxSize)
+	expect.Equal(0, len(newWal.GetReplay()))
+
+	third := NewMessage(nil, []byte("third"), nil, 1)
+	expect.NoError(newWal.Append(third))
+	expect.NoError(oldWal.Close())
+
+	// The log stays usable until the last user closes it
+	expect.NoError(newWal.Append(NewMessage(nil, []byte("fourth"), nil, 1)))
+	newWal.Ack(second)
+	newWal.Ack(third)
+	expect.NoError(newWal.Close())
+
+	wal := newTestWriteAheadLog(t, basePath, 0)
+	expect.Equal([]string{"fourth"}, getPayloads(wal.GetReplay()))
+	expect.NoError(wal.Close())
+}
+
+func TestWriteAheadLogCorruptedTail(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-wal")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+	basePath := filepath.Join(dir, "producer")
+
+	wal := newTestWriteAheadLog(t, basePath, 0)
+	expect.NoError(wal.Append(NewMessage(nil, []byte("first"), nil, 1)))
+	expect.NoError(wal.Append(NewMessage(nil, []byte("second"), nil, 1)))
+	segmentPath := wal.getSegmentPath(wal.segmentID)
+	wal.crash()
+
+	// Simulate a crash in the middle of writing a record
+	segment, err := os.OpenFile(segmentPath, os.O_APPEND|os.O_WRONLY, 0644)
+	expect.NoError(err)
+	_, err = segment.Write([]byte{0, 0, 1, 0, 1, 2, 3})
+	expect.NoError(err)
+	segment.Close()
+
+	wal = newTestWriteAheadLog(t, basePath, 0)
+	expect.Equal([]string{"first", "second"}, getPayloads(wal.GetReplay()))
+	expect.NoError(wal.Close())
+}
+
+func TestWriteAheadLogMaxSize(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-wal")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	wal := newTestWriteAheadLog(t, filepath.Join(dir, "producer"), 256)
+	defer wal.Close()
+
+	messages := []*Message{}
+	for {
+		msg := NewMessage(nil, []byte("0123456789"), nil, 1)
+		if err := wal.Append(msg); err != nil {
+			expect.Equal(ErrWriteAheadLogFull, err)
+			break
+		}
+		messages = append(messages, msg)
+	}
+	expect.Geq(len(messages), 2)
+
+	// Acknowledged messages are removed to make room for new ones
+	wal.Ack(messages[0])
+	expect.NoError(wal.Append(NewMessage(nil, []byte("0123456789"), nil, 1)))
+	expect.Equal(len(messages), wal.GetNumInFlight())
+	expect.Equal(ErrWriteAheadLogFull, wal.Append(NewMessage(nil, []byte("0123456789"), nil, 1)))
+}
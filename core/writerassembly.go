@@ -29,6 +29,7 @@ type WriterAssembly struct {
 	buffer      []byte
 	validate    func() bool
 	handleError func(error) bool
+	encode      func(*Message) ([]byte, error)
 	writerGuard *sync.Mutex
 }
 
@@ -55,6 +56,14 @@ func (asm *WriterAssembly) SetErrorHandler(handleError func(error) bool) {
 	asm.handleError = handleError
 }
 
+// SetEncoder sets a callback that creates the data written for a message.
+// The message itself is not changed, so messages passed to the flush function
+// still contain the original payload. Messages that cannot be encoded are
+// passed to the flush function. By default the payload is written.
+func (asm *WriterAssembly) SetEncoder(encode func(*Message) ([]byte, error)) {
+	asm.encode = encode
+}
+
 // SetWriter changes the writer interface used during Assemble
 func (asm *WriterAssembly) SetWriter(writer io.Writer) {
 	asm.writerGuard.Lock()
@@ -88,14 +97,24 @@ func (asm *WriterAssembly) Write(messages []*Message) {
 
 	// Format all messages
 	contentLen := 0
+	written := messages[:0:0]
 	for _, msg := range messages {
-		if contentLen+len(msg.GetPayload()) > len(asm.buffer) {
-			asm.buffer = append(asm.buffer[:contentLen], msg.GetPayload()...)
+		data, err := asm.getData(msg)
+		if err != nil {
+			logrus.WithError(err).Error("Failed to encode message")
+			asm.flush(msg)
+			continue // ### continue, not written ###
+		}
+
+		if contentLen+len(data) > len(asm.buffer) {
+			asm.buffer = append(asm.buffer[:contentLen], data...)
 		} else {
-			copy(asm.buffer[contentLen:], msg.GetPayload())
+			copy(asm.buffer[contentLen:], data)
 		}
-		contentLen += len(msg.GetPayload())
+		contentLen += len(data)
+		written = append(written, msg)
 	}
+	messages = written
 
 	// Route all messages if they could not be written
 	if _, err := writer.Write(asm.buffer[:contentLen]); err != nil {
@@ -115,6 +134,14 @@ func (asm *WriterAssembly) Write(messages []*Message) {
 	}
 }
 
+// getData returns the data to be written for the given message
+func (asm *WriterAssembly) getData(msg *Message) ([]byte, error) {
+	if asm.encode == nil {
+		return msg.GetPayload(), nil
+	}
+	return asm.encode(msg)
+}
+
 // Flush is an AssemblyFunc compatible implementation to pass all messages from
 // a MessageBatch to e.g. the Drop function of a producer.
 // Flush will also be called by Write if the io.Writer reported an error.
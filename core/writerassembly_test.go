@@ -15,6 +15,7 @@
 package core
 
 import (
+	"bytes"
 	"errors"
 	"testing"
 
@@ -122,3 +123,35 @@ func TestWriterAssemblyWrite(t *testing.T) {
 	wa.Write([]*Message{msg1})
 
 }
+
+func TestWriterAssemblySetEncoder(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	buffer := new(bytes.Buffer)
+	flushed := []string{}
+	wa := NewWriterAssembly(buffer, func(msg *Message) {
+		flushed = append(flushed, msg.String())
+	}, &mockFormatter{})
+
+	wa.SetEncoder(func(msg *Message) ([]byte, error) {
+		if msg.String() == "invalid" {
+			return nil, errors.New("invalid")
+		}
+		return []byte("<" + msg.String() + ">"), nil
+	})
+
+	valid := NewMessage(nil, []byte("abc"), nil, InvalidStreamID)
+	invalid := NewMessage(nil, []byte("invalid"), nil, InvalidStreamID)
+	wa.Write([]*Message{valid, invalid, valid})
+
+	// Messages are not changed by encoding
+	expect.Equal("<abc><abc>", buffer.String())
+	expect.Equal([]string{"invalid"}, flushed)
+	expect.Equal("abc", valid.String())
+
+	// Only written messages are flushed on error
+	flushed = []string{}
+	wa.SetWriter(secondMockIoWrite{})
+	wa.SetErrorHandler(func(error) bool { return false })
+	wa.Write([]*Message{valid, invalid})
+	expect.Equal([]string{"invalid", "abc"}, flushed)
+}
@@ -0,0 +1,149 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"gollum/core"
+)
+
+// Dedup filter plugin
+//
+// This plugin rejects messages that have already been seen within a given
+// time window. Messages are compared by a hash of their payload or of a
+// given metadata field. Seen hashes are stored in a ring buffer of bounded
+// size, so memory usage stays flat even for keys of high cardinality. If the
+// buffer is full, the oldest entries are evicted first, which may cause
+// duplicates to pass if more than MaxEntries distinct keys are seen within
+// the time window.
+//
+// Parameters
+//
+// - KeyFrom: Defines the metadata field to compare. When left empty, the
+// payload is compared.
+// By default this parameter is set to "".
+//
+// - WindowSec: Defines the number of seconds a key is remembered.
+// By default this parameter is set to "60".
+//
+// - MaxEntries: Defines the maximum number of keys remembered at once.
+// By default this parameter is set to "100000".
+//
+// Examples
+//
+// This example drops all messages carrying an already seen event id within
+// 5 minutes:
+//
+//  ExampleConsumer:
+//    Type: consumer.Console
+//    Streams: "*"
+//    Modulators:
+//      - filter.Dedup:
+//        KeyFrom: event_id
+//        WindowSec: 300
+type Dedup struct {
+	core.SimpleFilter `gollumdoc:"embed_type"`
+	window            time.Duration `config:"WindowSec" default:"60" metric:"sec"`
+	maxEntries        int           `config:"MaxEntries" default:"100000"`
+	getKey            core.GetDataAsBytesFunc
+	seen              map[uint64]time.Time
+	ring              []dedupEntry
+	ringHead          int
+	ringLen           int
+	guard             *sync.Mutex
+	now               func() time.Time
+}
+
+type dedupEntry struct {
+	hash uint64
+	time time.Time
+}
+
+func init() {
+	core.TypeRegistry.Register(Dedup{})
+}
+
+// Configure initializes this filter with values from a plugin config.
+func (filter *Dedup) Configure(conf core.PluginConfigReader) {
+	if filter.maxEntries < 1 {
+		conf.Errors.Pushf("MaxEntries must be greater than 0")
+		filter.maxEntries = 1
+	}
+
+	filter.getKey = core.NewBytesGetterFor(conf.GetString("KeyFrom", ""))
+	filter.seen = make(map[uint64]time.Time)
+	filter.ring = make([]dedupEntry, filter.maxEntries)
+	filter.guard = new(sync.Mutex)
+	filter.now = time.Now
+}
+
+// ApplyFilter check if all Filter wants to reject the message
+func (filter *Dedup) ApplyFilter(msg *core.Message) (core.FilterResult, error) {
+	hash := fnv.New64a()
+	hash.Write(filter.getKey(msg))
+
+	if filter.isDuplicate(hash.Sum64()) {
+		return filter.GetFilterResultMessageReject(), nil
+	}
+	return core.FilterResultMessageAccept, nil
+}
+
+// isDuplicate returns true if the given hash has been seen within the
+// window. If not, the hash is remembered.
+func (filter *Dedup) isDuplicate(hash uint64) bool {
+	filter.guard.Lock()
+	defer filter.guard.Unlock()
+
+	now := filter.now()
+	filter.evict(now.Add(-filter.window))
+
+	if _, exists := filter.seen[hash]; exists {
+		return true
+	}
+
+	if filter.ringLen == len(filter.ring) {
+		filter.evictOldest()
+	}
+
+	tail := (filter.ringHead + filter.ringLen) % len(filter.ring)
+	filter.ring[tail] = dedupEntry{hash: hash, time: now}
+	filter.ringLen++
+	filter.seen[hash] = now
+	return false
+}
+
+// evict removes all entries seen before the given time.
+// Expects guard to be locked.
+func (filter *Dedup) evict(before time.Time) {
+	for filter.ringLen > 0 && !filter.ring[filter.ringHead].time.After(before) {
+		filter.evictOldest()
+	}
+}
+
+// evictOldest removes the oldest entry from the ring buffer.
+// Expects guard to be locked.
+func (filter *Dedup) evictOldest() {
+	entry := filter.ring[filter.ringHead]
+	if seenAt, exists := filter.seen[entry.hash]; exists && seenAt.Equal(entry.time) {
+		delete(filter.seen, entry.hash)
+	}
+
+	filter.ring[filter.ringHead] = dedupEntry{}
+	filter.ringHead = (filter.ringHead + 1) % len(filter.ring)
+	filter.ringLen--
+}
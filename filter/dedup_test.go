@@ -0,0 +1,117 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter
+
+import (
+	"testing"
+	"time"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestFilterDedupWindow(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	conf := core.NewPluginConfig("", "filter.Dedup")
+	conf.Override("WindowSec", 10)
+
+	plugin, err := core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted := plugin.(*Dedup)
+	expect.True(casted)
+
+	now := time.Now()
+	filter.now = func() time.Time { return now }
+
+	msg := core.NewMessage(nil, []byte("foo"), nil, core.InvalidStreamID)
+	other := core.NewMessage(nil, []byte("bar"), nil, core.InvalidStreamID)
+
+	result, _ := filter.ApplyFilter(msg)
+	expect.Equal(core.FilterResultMessageAccept, result)
+
+	now = now.Add(5 * time.Second)
+	result, _ = filter.ApplyFilter(msg)
+	expect.Neq(core.FilterResultMessageAccept, result)
+
+	result, _ = filter.ApplyFilter(other)
+	expect.Equal(core.FilterResultMessageAccept, result)
+
+	// Window is measured from the first occurrence
+	now = now.Add(6 * time.Second)
+	result, _ = filter.ApplyFilter(msg)
+	expect.Equal(core.FilterResultMessageAccept, result)
+
+	result, _ = filter.ApplyFilter(other)
+	expect.Neq(core.FilterResultMessageAccept, result)
+}
+
+func TestFilterDedupKeyFrom(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	conf := core.NewPluginConfig("", "filter.Dedup")
+	conf.Override("KeyFrom", "id")
+
+	plugin, err := core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted := plugin.(*Dedup)
+	expect.True(casted)
+
+	msg1 := core.NewMessage(nil, []byte("foo"), tcontainer.MarshalMap{"id": "1"}, core.InvalidStreamID)
+	msg2 := core.NewMessage(nil, []byte("bar"), tcontainer.MarshalMap{"id": "1"}, core.InvalidStreamID)
+	msg3 := core.NewMessage(nil, []byte("foo"), tcontainer.MarshalMap{"id": "2"}, core.InvalidStreamID)
+
+	result, _ := filter.ApplyFilter(msg1)
+	expect.Equal(core.FilterResultMessageAccept, result)
+
+	result, _ = filter.ApplyFilter(msg2)
+	expect.Neq(core.FilterResultMessageAccept, result)
+
+	result, _ = filter.ApplyFilter(msg3)
+	expect.Equal(core.FilterResultMessageAccept, result)
+}
+
+func TestFilterDedupMaxEntries(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	conf := core.NewPluginConfig("", "filter.Dedup")
+	conf.Override("MaxEntries", 2)
+
+	plugin, err := core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted := plugin.(*Dedup)
+	expect.True(casted)
+
+	msgA := core.NewMessage(nil, []byte("a"), nil, core.InvalidStreamID)
+	msgB := core.NewMessage(nil, []byte("b"), nil, core.InvalidStreamID)
+	msgC := core.NewMessage(nil, []byte("c"), nil, core.InvalidStreamID)
+
+	filter.ApplyFilter(msgA)
+	filter.ApplyFilter(msgB)
+	filter.ApplyFilter(msgC) // evicts "a"
+
+	expect.Equal(2, len(filter.seen))
+
+	result, _ := filter.ApplyFilter(msgA)
+	expect.Equal(core.FilterResultMessageAccept, result)
+
+	result, _ = filter.ApplyFilter(msgC)
+	expect.Neq(core.FilterResultMessageAccept, result)
+}
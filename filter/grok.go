@@ -0,0 +1,106 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter
+
+import (
+	"gollum/core"
+
+	"github.com/trivago/grok"
+)
+
+// Grok filter
+//
+// This filter accepts or rejects messages based on a list of grok patterns.
+// Messages matching at least one of the patterns are passed on. This
+// behavior can be inverted by using the Reject parameter.
+// See https://www.elastic.co/guide/en/logstash/current/plugins-filters-grok.html#_grok_basics
+// for more information about Grok.
+//
+// Parameters
+//
+// - Patterns: A list of grok patterns to match messages against.
+// By default this parameter is set to an empty list.
+//
+// - Reject: When set to true, messages matching any of the patterns are
+// rejected and all other messages are passed on.
+// By default this parameter is set to "false".
+//
+// - Source: Defines which part of the message the filter is applied to.
+// When set to "", this filter is applied to the message's payload. All
+// other values denotes a metadata key.
+// By default this parameter is set to "".
+//
+// - SkipDefaultPatterns: When set to true, standard grok patterns will not be
+// included in the list of patterns.
+// By default this parameter is set to "false".
+//
+// Examples
+//
+// This example drops all health check requests from an access log.
+//
+//  ExampleConsumer:
+//    Type: consumer.Console
+//    Streams: console
+//    Modulators:
+//      - filter.Grok:
+//        Reject: true
+//        Patterns:
+//          - "%{WORD} /health(check)? HTTP/%{NUMBER}"
+type Grok struct {
+	core.SimpleFilter `gollumdoc:"embed_type"`
+	exp               []*grok.CompiledGrok
+	reject            bool `config:"Reject" default:"false"`
+	getSourceData     core.GetDataAsBytesFunc
+}
+
+func init() {
+	core.TypeRegistry.Register(Grok{})
+}
+
+// Configure initializes this filter with values from a plugin config.
+func (filter *Grok) Configure(conf core.PluginConfigReader) {
+	grokParser, err := grok.New(grok.Config{
+		SkipDefaultPatterns: conf.GetBool("SkipDefaultPatterns", false),
+	})
+	if conf.Errors.Push(err) {
+		return
+	}
+
+	for _, p := range conf.GetStringArray("Patterns", []string{}) {
+		exp, err := grokParser.Compile(p)
+		if !conf.Errors.Push(err) {
+			filter.exp = append(filter.exp, exp)
+		}
+	}
+
+	filter.getSourceData = core.NewBytesGetterFor(conf.GetString("Source", ""))
+}
+
+// ApplyFilter check if all Filter wants to reject the message
+func (filter *Grok) ApplyFilter(msg *core.Message) (core.FilterResult, error) {
+	if filter.matches(filter.getSourceData(msg)) != filter.reject {
+		return core.FilterResultMessageAccept, nil
+	}
+	return filter.GetFilterResultMessageReject(), nil
+}
+
+func (filter *Grok) matches(data []byte) bool {
+	for _, exp := range filter.exp {
+		if exp.Match(data) {
+			return true
+		}
+	}
+	return false
+}
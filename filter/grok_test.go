@@ -0,0 +1,113 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter
+
+import (
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestFilterGrok(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	conf := core.NewPluginConfig("", "filter.Grok")
+
+	conf.Override("Patterns", []string{`^%{IP} `, `^%{WORD:level}: `})
+	plugin, err := core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted := plugin.(*Grok)
+	expect.True(casted)
+
+	msg1 := core.NewMessage(nil, []byte("127.0.0.1 GET /"), nil, core.InvalidStreamID)
+	msg2 := core.NewMessage(nil, []byte("error: disk full"), nil, core.InvalidStreamID)
+	msg3 := core.NewMessage(nil, []byte("- no match"), nil, core.InvalidStreamID)
+
+	result, err := filter.ApplyFilter(msg1)
+	expect.NoError(err)
+	expect.Equal(core.FilterResultMessageAccept, result)
+
+	result, err = filter.ApplyFilter(msg2)
+	expect.NoError(err)
+	expect.Equal(core.FilterResultMessageAccept, result)
+
+	result, err = filter.ApplyFilter(msg3)
+	expect.NoError(err)
+	expect.Neq(core.FilterResultMessageAccept, result)
+}
+
+func TestFilterGrokReject(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	conf := core.NewPluginConfig("", "filter.Grok")
+
+	conf.Override("Patterns", []string{`^%{IP} `, `^%{WORD:level}: `})
+	conf.Override("Reject", true)
+	plugin, err := core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted := plugin.(*Grok)
+	expect.True(casted)
+
+	msg1 := core.NewMessage(nil, []byte("127.0.0.1 GET /"), nil, core.InvalidStreamID)
+	msg2 := core.NewMessage(nil, []byte("- no match"), nil, core.InvalidStreamID)
+
+	result, _ := filter.ApplyFilter(msg1)
+	expect.Neq(core.FilterResultMessageAccept, result)
+
+	result, _ = filter.ApplyFilter(msg2)
+	expect.Equal(core.FilterResultMessageAccept, result)
+}
+
+func TestFilterGrokSource(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	conf := core.NewPluginConfig("", "filter.Grok")
+
+	conf.Override("Patterns", []string{`^%{IP} `, `^%{WORD:level}: `})
+	conf.Override("Source", "client")
+	plugin, err := core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted := plugin.(*Grok)
+	expect.True(casted)
+
+	msg1 := core.NewMessage(nil, []byte("- no match"), tcontainer.MarshalMap{"client": "10.0.0.1 x"}, core.InvalidStreamID)
+	msg2 := core.NewMessage(nil, []byte("127.0.0.1 GET /"), tcontainer.MarshalMap{"client": "unknown"}, core.InvalidStreamID)
+
+	result, _ := filter.ApplyFilter(msg1)
+	expect.Equal(core.FilterResultMessageAccept, result)
+
+	result, _ = filter.ApplyFilter(msg2)
+	expect.Neq(core.FilterResultMessageAccept, result)
+}
+
+func BenchmarkFilterGrok(b *testing.B) {
+	conf := core.NewPluginConfig("", "filter.Grok")
+	conf.Override("Patterns", []string{`^%{IP} %{WORD:verb} %{URIPATH:path}`})
+	plugin, err := core.NewPluginWithConfig(conf)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	filter := plugin.(*Grok)
+	msg := core.NewMessage(nil, []byte("127.0.0.1 GET /foo/bar"), nil, core.InvalidStreamID)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		filter.ApplyFilter(msg)
+	}
+}
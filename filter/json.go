@@ -0,0 +1,255 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package filter
+
+import (
+	"bytes"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+)
+
+const (
+	jsonOperatorEq     = "eq"
+	jsonOperatorNeq    = "neq"
+	jsonOperatorIn     = "in"
+	jsonOperatorGt     = "gt"
+	jsonOperatorGe     = "ge"
+	jsonOperatorLt     = "lt"
+	jsonOperatorLe     = "le"
+	jsonOperatorExists = "exists"
+	jsonOperatorRegex  = "regex"
+)
+
+// JSON filter
+//
+// This filter accepts or rejects messages based on the value of a field
+// inside a JSON encoded payload or inside the message's metadata.
+// Messages fulfilling the condition are passed on. This behavior can be
+// inverted by using the Reject parameter. Messages not containing the field
+// never fulfill the condition, except for the "neq" operator.
+//
+// Parameters
+//
+// - Field: Defines the path of the field to check. Nested fields can be
+// addressed by a path like "request/status".
+// By default this parameter is set to "".
+//
+// - Operator: Defines the comparison to apply. Supported operators are
+// "eq", "neq", "in", "gt", "ge", "lt", "le", "exists" and "regex".
+// "eq", "neq" and "in" compare numbers numerically and all other values as
+// strings. "gt", "ge", "lt" and "le" require numeric values.
+// By default this parameter is set to "exists".
+//
+// - Values: Defines the values to compare against. The "in" operator accepts
+// any number of values, "exists" ignores this parameter and all other
+// operators require exactly one value. Numbers have to be given as strings.
+// By default this parameter is set to an empty list.
+//
+// - Reject: When set to true, messages fulfilling the condition are rejected
+// and all other messages are passed on.
+// By default this parameter is set to false.
+//
+// - FromMetadata: When set to true, Field is read from the message's metadata
+// instead of the payload.
+// By default this parameter is set to false.
+//
+// - AcceptInvalid: When set to true, messages with a payload that is not
+// valid JSON are passed on. Otherwise they are rejected.
+// By default this parameter is set to false.
+//
+// Examples
+//
+// This example only passes on log messages with level "error" or "fatal".
+//
+//  ExampleConsumer:
+//    Type: consumer.Console
+//    Streams: console
+//    Modulators:
+//      - filter.JSON:
+//        Field: level
+//        Operator: in
+//        Values:
+//          - error
+//          - fatal
+//
+// This example drops all requests answered with a status below 400.
+//
+//  ExampleConsumer:
+//    Type: consumer.Console
+//    Streams: console
+//    Modulators:
+//      - filter.JSON:
+//        Field: response/status
+//        Operator: lt
+//        Values: "400"
+//        Reject: true
+type JSON struct {
+	core.SimpleFilter `gollumdoc:"embed_type"`
+	field             string   `config:"Field"`
+	operator          string   `config:"Operator" default:"exists"`
+	values            []string `config:"Values"`
+	reject            bool     `config:"Reject" default:"false"`
+	fromMetadata      bool     `config:"FromMetadata" default:"false"`
+	acceptInvalid     bool     `config:"AcceptInvalid" default:"false"`
+	number            float64
+	expression        *regexp.Regexp
+}
+
+func init() {
+	core.TypeRegistry.Register(JSON{})
+}
+
+// Configure initializes this filter with values from a plugin config.
+func (filter *JSON) Configure(conf core.PluginConfigReader) {
+	filter.operator = strings.ToLower(filter.operator)
+
+	switch filter.operator {
+	case jsonOperatorExists:
+		return // ### return, no values required ###
+
+	case jsonOperatorIn:
+		if len(filter.values) == 0 {
+			conf.Errors.Pushf("Operator in requires at least one value")
+		}
+		return // ### return, any number of values ###
+
+	case jsonOperatorEq, jsonOperatorNeq, jsonOperatorGt, jsonOperatorGe,
+		jsonOperatorLt, jsonOperatorLe, jsonOperatorRegex:
+		if len(filter.values) != 1 {
+			conf.Errors.Pushf("Operator %s requires exactly one value", filter.operator)
+			return // ### return, invalid values ###
+		}
+
+	default:
+		conf.Errors.Pushf("Unknown operator '%s'", filter.operator)
+		return // ### return, invalid operator ###
+	}
+
+	var err error
+	switch filter.operator {
+	case jsonOperatorGt, jsonOperatorGe, jsonOperatorLt, jsonOperatorLe:
+		if filter.number, err = strconv.ParseFloat(filter.values[0], 64); err != nil {
+			conf.Errors.Pushf("Operator %s requires a numeric value", filter.operator)
+		}
+
+	case jsonOperatorRegex:
+		filter.expression, err = regexp.Compile(filter.values[0])
+		conf.Errors.Push(err)
+	}
+}
+
+// getFields returns the object to resolve Field against. False is returned
+// if the payload is not a valid JSON object.
+func (filter *JSON) getFields(msg *core.Message) (tcontainer.MarshalMap, bool) {
+	if filter.fromMetadata {
+		return msg.TryGetMetadata(), true
+	}
+
+	var object map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(msg.GetPayload()))
+	decoder.UseNumber()
+	if err := decoder.Decode(&object); err != nil {
+		return nil, false
+	}
+	return tcontainer.MarshalMap(object), true
+}
+
+// jsonToNumber converts numbers and numeric strings to float64.
+func jsonToNumber(value interface{}) (float64, bool) {
+	number, err := strconv.ParseFloat(core.ConvertToString(value), 64)
+	return number, err == nil
+}
+
+// equals compares the given value to a configured value. Numbers are
+// compared numerically, all other values as strings.
+func (filter *JSON) equals(value interface{}, expected string) bool {
+	if number, isNumber := jsonToNumber(value); isNumber {
+		if expectedNumber, err := strconv.ParseFloat(expected, 64); err == nil {
+			return number == expectedNumber
+		}
+	}
+	return core.ConvertToString(value) == expected
+}
+
+// matches returns true if the given value fulfills the condition.
+func (filter *JSON) matches(value interface{}, exists bool) bool {
+	if filter.operator == jsonOperatorNeq {
+		return !exists || !filter.equals(value, filter.values[0])
+	}
+	if !exists {
+		return false
+	}
+
+	switch filter.operator {
+	case jsonOperatorExists:
+		return true
+
+	case jsonOperatorEq:
+		return filter.equals(value, filter.values[0])
+
+	case jsonOperatorIn:
+		for _, expected := range filter.values {
+			if filter.equals(value, expected) {
+				return true
+			}
+		}
+		return false
+
+	case jsonOperatorRegex:
+		return filter.expression.MatchString(core.ConvertToString(value))
+	}
+
+	number, isNumber := jsonToNumber(value)
+	if !isNumber {
+		return false
+	}
+
+	switch filter.operator {
+	case jsonOperatorGt:
+		return number > filter.number
+	case jsonOperatorGe:
+		return number >= filter.number
+	case jsonOperatorLt:
+		return number < filter.number
+	case jsonOperatorLe:
+		return number <= filter.number
+	default:
+		return false
+	}
+}
+
+// ApplyFilter check if all Filter wants to reject the message
+func (filter *JSON) ApplyFilter(msg *core.Message) (core.FilterResult, error) {
+	fields, isValid := filter.getFields(msg)
+	if !isValid {
+		if filter.acceptInvalid {
+			return core.FilterResultMessageAccept, nil
+		}
+		return filter.GetFilterResultMessageReject(), nil
+	}
+
+	value, exists := core.GetValuePath(fields, filter.field)
+	if filter.matches(value, exists) != filter.reject {
+		return core.FilterResultMessageAccept, nil
+	}
+	return filter.GetFilterResultMessageReject(), nil
+}
@@ -0,0 +1,229 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter
+
+import (
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func applyJSONFilter(filter *JSON, payload string) bool {
+	msg := core.NewMessage(nil, []byte(payload), nil, core.InvalidStreamID)
+	result, _ := filter.ApplyFilter(msg)
+	return result == core.FilterResultMessageAccept
+}
+
+func TestFilterJSONEq(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	conf := core.NewPluginConfig("", "filter.JSON")
+	conf.Override("Field", "request/status")
+	conf.Override("Operator", "eq")
+	conf.Override("Values", "200")
+
+	plugin, err := core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted := plugin.(*JSON)
+	expect.True(casted)
+
+	expect.True(applyJSONFilter(filter, `{"request":{"status":200}}`))
+	expect.True(applyJSONFilter(filter, `{"request":{"status":"200"}}`))
+	expect.True(applyJSONFilter(filter, `{"request":{"status":200.0}}`))
+	expect.False(applyJSONFilter(filter, `{"request":{"status":404}}`))
+	expect.False(applyJSONFilter(filter, `{"request":{}}`))
+}
+
+func TestFilterJSONNeq(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	conf := core.NewPluginConfig("", "filter.JSON")
+	conf.Override("Field", "level")
+	conf.Override("Operator", "neq")
+	conf.Override("Values", "debug")
+
+	plugin, err := core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted := plugin.(*JSON)
+	expect.True(casted)
+
+	expect.True(applyJSONFilter(filter, `{"level":"info"}`))
+	expect.True(applyJSONFilter(filter, `{"message":"no level"}`))
+	expect.False(applyJSONFilter(filter, `{"level":"debug"}`))
+}
+
+func TestFilterJSONIn(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	conf := core.NewPluginConfig("", "filter.JSON")
+	conf.Override("Field", "level")
+	conf.Override("Operator", "in")
+	conf.Override("Values", []string{"error", "fatal"})
+
+	plugin, err := core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted := plugin.(*JSON)
+	expect.True(casted)
+
+	expect.True(applyJSONFilter(filter, `{"level":"error"}`))
+	expect.True(applyJSONFilter(filter, `{"level":"fatal"}`))
+	expect.False(applyJSONFilter(filter, `{"level":"info"}`))
+	expect.False(applyJSONFilter(filter, `{}`))
+}
+
+func TestFilterJSONNumeric(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	for operator, expected := range map[string][]bool{
+		"gt": {false, false, true},
+		"ge": {false, true, true},
+		"lt": {true, false, false},
+		"le": {true, true, false},
+	} {
+		conf := core.NewPluginConfig("", "filter.JSON")
+		conf.Override("Field", "duration")
+		conf.Override("Operator", operator)
+		conf.Override("Values", "1.5")
+
+		plugin, err := core.NewPluginWithConfig(conf)
+		expect.NoError(err)
+
+		filter, casted := plugin.(*JSON)
+		expect.True(casted)
+
+		expect.Equal(expected[0], applyJSONFilter(filter, `{"duration":1}`))
+		expect.Equal(expected[1], applyJSONFilter(filter, `{"duration":1.5}`))
+		expect.Equal(expected[2], applyJSONFilter(filter, `{"duration":"2"}`))
+		expect.False(applyJSONFilter(filter, `{"duration":"slow"}`))
+		expect.False(applyJSONFilter(filter, `{}`))
+	}
+}
+
+func TestFilterJSONExists(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	conf := core.NewPluginConfig("", "filter.JSON")
+	conf.Override("Field", "tags[1]")
+	conf.Override("Operator", "exists")
+
+	plugin, err := core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted := plugin.(*JSON)
+	expect.True(casted)
+
+	expect.True(applyJSONFilter(filter, `{"tags":["a","b"]}`))
+	expect.False(applyJSONFilter(filter, `{"tags":["a"]}`))
+}
+
+func TestFilterJSONRegex(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	conf := core.NewPluginConfig("", "filter.JSON")
+	conf.Override("Field", "path")
+	conf.Override("Operator", "regex")
+	conf.Override("Values", "^/api/")
+	conf.Override("Reject", true)
+
+	plugin, err := core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted := plugin.(*JSON)
+	expect.True(casted)
+
+	expect.False(applyJSONFilter(filter, `{"path":"/api/users"}`))
+	expect.True(applyJSONFilter(filter, `{"path":"/health"}`))
+}
+
+func TestFilterJSONInvalid(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	conf := core.NewPluginConfig("", "filter.JSON")
+	conf.Override("Field", "level")
+
+	plugin, err := core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted := plugin.(*JSON)
+	expect.True(casted)
+
+	expect.False(applyJSONFilter(filter, "not json"))
+	expect.False(applyJSONFilter(filter, `["level"]`))
+
+	conf = core.NewPluginConfig("", "filter.JSON")
+	conf.Override("Field", "level")
+	conf.Override("AcceptInvalid", true)
+
+	plugin, err = core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted = plugin.(*JSON)
+	expect.True(casted)
+
+	expect.True(applyJSONFilter(filter, "not json"))
+}
+
+func TestFilterJSONMetadata(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	conf := core.NewPluginConfig("", "filter.JSON")
+	conf.Override("Field", "kafka/partition")
+	conf.Override("Operator", "ge")
+	conf.Override("Values", "2")
+	conf.Override("FromMetadata", true)
+
+	plugin, err := core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted := plugin.(*JSON)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("not json"), tcontainer.MarshalMap{
+		"kafka": tcontainer.MarshalMap{"partition": 3},
+	}, core.InvalidStreamID)
+	result, err := filter.ApplyFilter(msg)
+	expect.NoError(err)
+	expect.Equal(core.FilterResultMessageAccept, result)
+
+	msg = core.NewMessage(nil, nil, nil, core.InvalidStreamID)
+	result, err = filter.ApplyFilter(msg)
+	expect.NoError(err)
+	expect.Neq(core.FilterResultMessageAccept, result)
+}
+
+func TestFilterJSONConfigErrors(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	for _, settings := range []map[string]interface{}{
+		{"Operator": "unknown"},
+		{"Operator": "eq"},
+		{"Operator": "in"},
+		{"Operator": "gt", "Values": "high"},
+		{"Operator": "regex", "Values": "("},
+	} {
+		conf := core.NewPluginConfig("", "filter.JSON")
+		for key, value := range settings {
+			conf.Override(key, value)
+		}
+		_, err := core.NewPluginWithConfig(conf)
+		expect.NotNil(err)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter
+
+import (
+	"sync"
+	"time"
+
+	"gollum/core"
+)
+
+// RateLimit filter plugin
+//
+// This plugin limits the number of messages per second by using a token
+// bucket per key. Each bucket is refilled with RatePerSec tokens per second
+// and can hold up to Burst tokens. Every message takes one token from its
+// bucket and is rejected if the bucket is empty.
+// Buckets that have not been used for IdleTTLSec are removed to keep
+// memory usage bounded when keys have a high cardinality.
+//
+// Parameters
+//
+// - RatePerSec: Defines the number of messages per second allowed to pass
+// for each key. Fractions like 0.5 are allowed.
+// By default this parameter is set to "100".
+//
+// - Burst: Defines the maximum number of messages that may pass at once
+// after a key has been idle. Values lower than 1 are set to 1.
+// By default this parameter is set to "100".
+//
+// - KeyFrom: Defines the metadata field used to separate buckets. When left
+// empty, one bucket per stream is used. Messages without the given field
+// share one bucket.
+// By default this parameter is set to "".
+//
+// - IdleTTLSec: Defines the number of seconds after which an unused bucket
+// is removed.
+// By default this parameter is set to "300".
+//
+// Examples
+//
+// This example allows 10 messages per second and host with bursts of up to
+// 50 messages:
+//
+//  ExampleConsumer:
+//    Type: consumer.Console
+//    Streams: "*"
+//    Modulators:
+//      - filter.RateLimit:
+//        RatePerSec: 10
+//        Burst: 50
+//        KeyFrom: host
+type RateLimit struct {
+	core.SimpleFilter `gollumdoc:"embed_type"`
+	keyFrom           string        `config:"KeyFrom"`
+	idleTTL           time.Duration `config:"IdleTTLSec" default:"300" metric:"sec"`
+	rate              float64
+	burst             float64
+	buckets           map[string]*tokenBucket
+	bucketsGuard      *sync.Mutex
+	lastCleanup       time.Time
+	now               func() time.Time
+}
+
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+func init() {
+	core.TypeRegistry.Register(RateLimit{})
+}
+
+// Configure initializes this filter with values from a plugin config.
+func (filter *RateLimit) Configure(conf core.PluginConfigReader) {
+	filter.rate = conf.GetFloat("RatePerSec", 100)
+	filter.burst = conf.GetFloat("Burst", 100)
+	if filter.rate <= 0 {
+		conf.Errors.Pushf("RatePerSec must be greater than 0")
+	}
+	if filter.burst < 1 {
+		filter.burst = 1
+	}
+
+	filter.buckets = make(map[string]*tokenBucket)
+	filter.bucketsGuard = new(sync.Mutex)
+	filter.now = time.Now
+	filter.lastCleanup = filter.now()
+}
+
+// ApplyFilter check if all Filter wants to reject the message
+func (filter *RateLimit) ApplyFilter(msg *core.Message) (core.FilterResult, error) {
+	if filter.take(filter.getKey(msg)) {
+		return core.FilterResultMessageAccept, nil
+	}
+	return filter.GetFilterResultMessageReject(), nil
+}
+
+func (filter *RateLimit) getKey(msg *core.Message) string {
+	if len(filter.keyFrom) == 0 {
+		return msg.GetStreamID().GetName()
+	}
+
+	metadata := msg.TryGetMetadata()
+	if metadata == nil {
+		return ""
+	}
+	key, _ := metadata.String(filter.keyFrom)
+	return key
+}
+
+// take removes a token from the bucket of the given key. If no token is
+// available false is returned.
+func (filter *RateLimit) take(key string) bool {
+	filter.bucketsGuard.Lock()
+	defer filter.bucketsGuard.Unlock()
+
+	now := filter.now()
+	if now.Sub(filter.lastCleanup) > filter.idleTTL {
+		filter.removeIdleBuckets(now)
+	}
+
+	bucket, exists := filter.buckets[key]
+	if !exists {
+		bucket = &tokenBucket{tokens: filter.burst, lastSeen: now}
+		filter.buckets[key] = bucket
+	} else {
+		elapsed := now.Sub(bucket.lastSeen).Seconds()
+		bucket.tokens += elapsed * filter.rate
+		if bucket.tokens > filter.burst {
+			bucket.tokens = filter.burst
+		}
+		bucket.lastSeen = now
+	}
+
+	if bucket.tokens < 1 {
+		return false
+	}
+	bucket.tokens--
+	return true
+}
+
+// removeIdleBuckets removes all buckets not used within the idle TTL.
+// Expects bucketsGuard to be locked.
+func (filter *RateLimit) removeIdleBuckets(now time.Time) {
+	for key, bucket := range filter.buckets {
+		if now.Sub(bucket.lastSeen) > filter.idleTTL {
+			delete(filter.buckets, key)
+		}
+	}
+	filter.lastCleanup = now
+}
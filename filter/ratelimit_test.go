@@ -0,0 +1,151 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestFilterRateLimitRefill(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	conf := core.NewPluginConfig("", "filter.RateLimit")
+	conf.Override("RatePerSec", 2)
+	conf.Override("Burst", 3)
+
+	plugin, err := core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted := plugin.(*RateLimit)
+	expect.True(casted)
+
+	now := time.Now()
+	filter.now = func() time.Time { return now }
+	filter.lastCleanup = now
+
+	// Burst is available immediately
+	expect.True(filter.take("a"))
+	expect.True(filter.take("a"))
+	expect.True(filter.take("a"))
+	expect.False(filter.take("a"))
+
+	// Half a second yields exactly one token
+	now = now.Add(500 * time.Millisecond)
+	expect.True(filter.take("a"))
+	expect.False(filter.take("a"))
+
+	// Refill is capped by burst
+	now = now.Add(10 * time.Second)
+	expect.True(filter.take("a"))
+	expect.True(filter.take("a"))
+	expect.True(filter.take("a"))
+	expect.False(filter.take("a"))
+}
+
+func TestFilterRateLimitKeyFrom(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	conf := core.NewPluginConfig("", "filter.RateLimit")
+	conf.Override("RatePerSec", 1)
+	conf.Override("Burst", 1)
+	conf.Override("KeyFrom", "host")
+
+	plugin, err := core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted := plugin.(*RateLimit)
+	expect.True(casted)
+
+	msgA := core.NewMessage(nil, []byte("a"), tcontainer.MarshalMap{"host": "a"}, core.InvalidStreamID)
+	msgB := core.NewMessage(nil, []byte("b"), tcontainer.MarshalMap{"host": "b"}, core.InvalidStreamID)
+
+	result, _ := filter.ApplyFilter(msgA)
+	expect.Equal(core.FilterResultMessageAccept, result)
+	result, _ = filter.ApplyFilter(msgA)
+	expect.Neq(core.FilterResultMessageAccept, result)
+
+	result, _ = filter.ApplyFilter(msgB)
+	expect.Equal(core.FilterResultMessageAccept, result)
+}
+
+func TestFilterRateLimitIdleCleanup(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	conf := core.NewPluginConfig("", "filter.RateLimit")
+	conf.Override("IdleTTLSec", 10)
+
+	plugin, err := core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted := plugin.(*RateLimit)
+	expect.True(casted)
+
+	now := time.Now()
+	filter.now = func() time.Time { return now }
+	filter.lastCleanup = now
+
+	filter.take("a")
+	filter.take("b")
+	expect.Equal(2, len(filter.buckets))
+
+	now = now.Add(5 * time.Second)
+	filter.take("b")
+
+	now = now.Add(6 * time.Second)
+	filter.take("c")
+	expect.Equal(2, len(filter.buckets))
+
+	_, exists := filter.buckets["a"]
+	expect.False(exists)
+}
+
+func TestFilterRateLimitConcurrency(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	conf := core.NewPluginConfig("", "filter.RateLimit")
+	conf.Override("RatePerSec", 1)
+	conf.Override("Burst", 100)
+
+	plugin, err := core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted := plugin.(*RateLimit)
+	expect.True(casted)
+
+	accepted := int64(0)
+	workers := new(sync.WaitGroup)
+	for i := 0; i < 10; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for n := 0; n < 50; n++ {
+				if filter.take("") {
+					atomic.AddInt64(&accepted, 1)
+				}
+			}
+		}()
+	}
+	workers.Wait()
+
+	expect.Equal(int64(100), accepted)
+}
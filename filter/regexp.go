@@ -15,9 +15,20 @@
 package filter
 
 import (
+	"bytes"
+	"encoding/json"
 	"regexp"
+	"strings"
 
 	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+)
+
+const (
+	regExpSourcePayload = "payload"
+	regExpSourceMeta    = "meta:"
+	regExpSourceJSON    = "json:"
 )
 
 // RegExp filter
@@ -36,11 +47,24 @@ import (
 // is checked before Expression.
 // By default this parameter is set to "".
 //
-// - ApplyTo: Defines which part of the message the filter is applied to.
+// - Target: Defines which part of the message the filter is applied to.
 // When set to "", this filter is applied to the message's payload. All
-// other values denotes a metadata key.
+// other values denotes a metadata key. This parameter is ignored if Source
+// is set.
 // By default this parameter is set to "".
 //
+// - Source: Defines the value the expressions are matched against. Set to
+// "payload" to use the message's payload, to "meta:<path>" to use a metadata
+// field or to "json:<path>" to use a field of the payload parsed as JSON
+// object. Nested fields can be addressed by a path like "meta:http/host".
+// Non-string values are converted to strings before matching.
+// By default this parameter is set to "".
+//
+// - AcceptMissing: Defines if messages are accepted when the value addressed
+// by Source does not exist. A payload that is not a valid JSON object is
+// treated like a missing value.
+// By default this parameter is set to false.
+//
 // Examples
 //
 // This example accepts only accesslog entries with a return status of
@@ -53,11 +77,24 @@ import (
 //      - filter.RegExp:
 //        ExpressionNot: " stage\\."
 //        Expression: "HTTP/1\\.1\\\" [23]\\d\\d"
+//
+// This example accepts only messages enriched with a hostname of a
+// production system.
+//
+//  ExampleConsumer:
+//    Type: consumer.Console
+//    Streams: console
+//    Modulators:
+//      - filter.RegExp:
+//        Source: "meta:hostname"
+//        Expression: "^prod-"
 type RegExp struct {
 	core.SimpleFilter `gollumdoc:"embed_type"`
 	exp               *regexp.Regexp
 	expNot            *regexp.Regexp
 	getTargetData     core.GetDataAsStringFunc
+	source            string `config:"Source"`
+	acceptMissing     bool   `config:"AcceptMissing" default:"false"`
 }
 
 func init() {
@@ -66,29 +103,73 @@ func init() {
 
 // Configure initializes this filter with values from a plugin config.
 func (filter *RegExp) Configure(conf core.PluginConfigReader) {
-	var err error
-	exp := conf.GetString("Expression", "")
-	if exp != "" {
-		filter.exp, err = regexp.Compile(exp)
-		conf.Errors.Push(err)
-	}
+	filter.exp = conf.GetRegexp("Expression", "")
+	filter.expNot = conf.GetRegexp("ExpressionNot", "")
+
+	filter.getTargetData = core.NewStringGetterFor(conf.GetString("Target", ""))
 
-	notExp := conf.GetString("ExpressionNot", "")
-	if notExp != "" {
-		filter.expNot, err = regexp.Compile(notExp)
-		conf.Errors.Push(err)
+	switch {
+	case filter.source == "", filter.source == regExpSourcePayload:
+	case strings.HasPrefix(filter.source, regExpSourceMeta):
+	case strings.HasPrefix(filter.source, regExpSourceJSON):
+	default:
+		conf.Errors.Pushf("Unknown source '%s'", filter.source)
 	}
+}
 
-	filter.getTargetData = core.NewStringGetterFor(conf.GetString("Target", ""))
+// getValue returns the string to match against. False is returned if the
+// value addressed by Source does not exist.
+func (filter *RegExp) getValue(msg *core.Message) (string, bool) {
+	switch {
+	case filter.source == "":
+		return filter.getTargetData(msg), true
+
+	case filter.source == regExpSourcePayload:
+		return msg.String(), true
+
+	case strings.HasPrefix(filter.source, regExpSourceMeta):
+		value, exists := core.GetValuePath(msg.TryGetMetadata(), filter.source[len(regExpSourceMeta):])
+		if !exists {
+			return "", false
+		}
+		return core.ConvertToString(value), true
+
+	default:
+		var object map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(msg.GetPayload()))
+		decoder.UseNumber()
+		if err := decoder.Decode(&object); err != nil {
+			return "", false // ### return, not a JSON object ###
+		}
+
+		value, exists := core.GetValuePath(tcontainer.MarshalMap(object), filter.source[len(regExpSourceJSON):])
+		if !exists || value == nil {
+			return "", false
+		}
+		if _, isString := value.(string); !isString {
+			if data, err := json.Marshal(value); err == nil {
+				return string(data), true
+			}
+		}
+		return core.ConvertToString(value), true
+	}
 }
 
 // ApplyFilter check if all Filter wants to reject the message
 func (filter *RegExp) ApplyFilter(msg *core.Message) (core.FilterResult, error) {
-	if filter.expNot != nil && filter.expNot.MatchString(filter.getTargetData(msg)) {
+	value, exists := filter.getValue(msg)
+	if !exists {
+		if filter.acceptMissing {
+			return core.FilterResultMessageAccept, nil
+		}
+		return filter.GetFilterResultMessageReject(), nil
+	}
+
+	if filter.expNot != nil && filter.expNot.MatchString(value) {
 		return filter.GetFilterResultMessageReject(), nil
 	}
 
-	if filter.exp != nil && !filter.exp.MatchString(filter.getTargetData(msg)) {
+	if filter.exp != nil && !filter.exp.MatchString(value) {
 		return filter.GetFilterResultMessageReject(), nil
 	}
 
@@ -19,6 +19,7 @@ import (
 
 	"gollum/core"
 
+	"github.com/trivago/tgo/tcontainer"
 	"github.com/trivago/tgo/ttesting"
 )
 
@@ -81,3 +82,96 @@ func TestFilterRegExp(t *testing.T) {
 	result, _ = filter.ApplyFilter(msg3)
 	expect.Neq(core.FilterResultMessageAccept, result)
 }
+
+func TestFilterRegExpSourcePayload(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	conf := core.NewPluginConfig("", "filter.RegExp")
+	conf.Override("Source", "payload")
+	conf.Override("Expression", "^accept")
+
+	plugin, err := core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted := plugin.(*RegExp)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("accept"), tcontainer.MarshalMap{"key": "reject"}, core.InvalidStreamID)
+	result, _ := filter.ApplyFilter(msg)
+	expect.Equal(core.FilterResultMessageAccept, result)
+
+	msg = core.NewMessage(nil, []byte("reject"), tcontainer.MarshalMap{"key": "accept"}, core.InvalidStreamID)
+	result, _ = filter.ApplyFilter(msg)
+	expect.Neq(core.FilterResultMessageAccept, result)
+}
+
+func TestFilterRegExpSourceMetadata(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	conf := core.NewPluginConfig("", "filter.RegExp")
+	conf.Override("Source", "meta:host/name")
+	conf.Override("ExpressionNot", "^stage-")
+
+	plugin, err := core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted := plugin.(*RegExp)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("stage-01"), tcontainer.MarshalMap{
+		"host": tcontainer.MarshalMap{"name": "prod-01"},
+	}, core.InvalidStreamID)
+	result, _ := filter.ApplyFilter(msg)
+	expect.Equal(core.FilterResultMessageAccept, result)
+
+	msg = core.NewMessage(nil, []byte("prod-01"), tcontainer.MarshalMap{
+		"host": tcontainer.MarshalMap{"name": []byte("stage-01")},
+	}, core.InvalidStreamID)
+	result, _ = filter.ApplyFilter(msg)
+	expect.Neq(core.FilterResultMessageAccept, result)
+
+	// Missing values are rejected by default
+	msg = core.NewMessage(nil, []byte("prod-01"), nil, core.InvalidStreamID)
+	result, _ = filter.ApplyFilter(msg)
+	expect.Neq(core.FilterResultMessageAccept, result)
+
+	filter.acceptMissing = true
+	result, _ = filter.ApplyFilter(msg)
+	expect.Equal(core.FilterResultMessageAccept, result)
+}
+
+func TestFilterRegExpSourceJSON(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	conf := core.NewPluginConfig("", "filter.RegExp")
+	conf.Override("Source", "json:response/status")
+	conf.Override("Expression", "^[23]\\d\\d$")
+	conf.Override("AcceptMissing", true)
+
+	plugin, err := core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted := plugin.(*RegExp)
+	expect.True(casted)
+
+	for payload, accepted := range map[string]bool{
+		`{"response":{"status":200}}`:   true,
+		`{"response":{"status":"301"}}`: true,
+		`{"response":{"status":404}}`:   false,
+		`{"response":{}}`:               true,
+		`not json`:                      true,
+	} {
+		msg := core.NewMessage(nil, []byte(payload), nil, core.InvalidStreamID)
+		result, _ := filter.ApplyFilter(msg)
+		expect.Equal(accepted, result == core.FilterResultMessageAccept)
+	}
+}
+
+func TestFilterRegExpUnknownSource(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	conf := core.NewPluginConfig("", "filter.RegExp")
+	conf.Override("Source", "header:host")
+
+	_, err := core.NewPluginWithConfig(conf)
+	expect.NotNil(err)
+}
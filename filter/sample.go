@@ -15,6 +15,9 @@
 package filter
 
 import (
+	"hash/fnv"
+	"math"
+	"math/rand"
 	"sync/atomic"
 
 	"gollum/core"
@@ -26,6 +29,16 @@ import (
 // This allows you to reduce the amount of messages; the plugin starts
 // blocking after a certain number of messages has been reached.
 //
+// Three sampling modes are supported: keeping the first n messages out of a
+// group of m messages (SampleRatePerGroup/SampleGroupSize), keeping every
+// n-th message (Every) or keeping messages with a given probability
+// (Probability). If KeyFrom is set, Every and Probability are applied to a
+// hash of the given metadata field instead, so that all messages sharing
+// the same key are either kept or dropped.
+//
+// This filter is safe to be used concurrently. Counters are updated
+// atomically and the random number generator used is synchronized.
+//
 // Parameters
 //
 // - SampleRatePerGroup: This value defines how many messages are passed through
@@ -40,6 +53,21 @@ import (
 // sampling. This is useful for e.g. producers listening to "*".
 // By default this parameter is set to an empty list.
 //
+// - Every: When set to a value greater than 0, every n-th message is passed
+// through the filter. SampleRatePerGroup and SampleGroupSize are ignored in
+// this case.
+// By default this parameter is set to "0".
+//
+// - Probability: When set to a value greater than 0, messages are passed
+// through the filter with the given probability, e.g. 0.01 for 1%.
+// This setting takes precedence over Every.
+// By default this parameter is set to "0".
+//
+// - KeyFrom: When set, Every and Probability are evaluated on a hash of the
+// given metadata field, making sampling deterministic per key. Messages
+// without this field are evaluated using an empty key.
+// By default this parameter is set to "".
+//
 // Examples
 //
 // This example will block 8 from 10 messages:
@@ -55,12 +83,26 @@ import (
 //          - foo
 //          - bar
 //
+// This example keeps ~1% of all requests, keeping or dropping all messages
+// belonging to the same request id:
+//
+//  exampleConsumer:
+//    Type: consumer.Console
+//    Streams: "*"
+//    Modulators:
+//      - filter.Sample:
+//        Probability: 0.01
+//        KeyFrom: request_id
+//
 type Sample struct {
 	core.SimpleFilter
-	rate   uint64 `config:"SampleRatePerGroup" default:"1"`
-	group  uint64 `config:"SampleGroupSize" default:"2"`
-	count  *uint64
-	ignore map[core.MessageStreamID]bool
+	rate        uint64 `config:"SampleRatePerGroup" default:"1"`
+	group       uint64 `config:"SampleGroupSize" default:"2"`
+	every       uint64 `config:"Every" default:"0"`
+	keyFrom     string `config:"KeyFrom"`
+	probability float64
+	count       *uint64
+	ignore      map[core.MessageStreamID]bool
 }
 
 func init() {
@@ -75,6 +117,17 @@ func (filter *Sample) Configure(conf core.PluginConfigReader) {
 	for _, stream := range ignore {
 		filter.ignore[stream] = true
 	}
+
+	filter.probability = conf.GetFloat("Probability", 0)
+	if filter.probability < 0 || filter.probability > 1 {
+		conf.Errors.Pushf("Probability must be between 0 and 1")
+	}
+
+	// Every n-th message equals one message per group of n
+	if filter.probability == 0 && filter.every > 0 {
+		filter.rate = 1
+		filter.group = filter.every
+	}
 }
 
 // ApplyFilter check if all Filter wants to reject the message
@@ -84,12 +137,48 @@ func (filter *Sample) ApplyFilter(msg *core.Message) (core.FilterResult, error)
 		return core.FilterResultMessageAccept, nil // ### return, do not limit ###
 	}
 
+	if filter.sample(msg) {
+		return core.FilterResultMessageAccept, nil // ### return, ok ###
+	}
+
+	return filter.GetFilterResultMessageReject(), nil
+}
+
+func (filter *Sample) sample(msg *core.Message) bool {
+	if len(filter.keyFrom) > 0 {
+		hash := filter.getKeyHash(msg)
+		if filter.probability > 0 {
+			return float64(hash) < filter.probability*math.MaxUint64
+		}
+		return hash%filter.group < filter.rate
+	}
+
+	if filter.probability > 0 {
+		return rand.Float64() < filter.probability
+	}
+
 	// Accept the first n messages of each group, reject the rest
 	// Overflow is not really an issue here as it will take years to get one
 	index := (atomic.AddUint64(filter.count, 1) - 1) % filter.group
-	if index < filter.rate {
-		return core.FilterResultMessageAccept, nil // ### return, ok ###
+	return index < filter.rate
+}
+
+func (filter *Sample) getKeyHash(msg *core.Message) uint64 {
+	key := ""
+	if metadata := msg.TryGetMetadata(); metadata != nil {
+		key, _ = metadata.String(filter.keyFrom)
 	}
 
-	return filter.GetFilterResultMessageReject(), nil
+	hash := fnv.New64a()
+	hash.Write([]byte(key))
+
+	// FNV does not distribute short keys evenly across all bits, so apply
+	// the murmur3 finalizer to get a uniform distribution.
+	value := hash.Sum64()
+	value ^= value >> 33
+	value *= 0xff51afd7ed558ccd
+	value ^= value >> 33
+	value *= 0xc4ceb9fe1a85ec53
+	value ^= value >> 33
+	return value
 }
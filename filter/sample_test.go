@@ -15,10 +15,12 @@
 package filter
 
 import (
+	"fmt"
 	"testing"
 
 	"gollum/core"
 
+	"github.com/trivago/tgo/tcontainer"
 	"github.com/trivago/tgo/ttesting"
 )
 
@@ -104,3 +106,80 @@ func TestFilterSampleIgnore(t *testing.T) {
 	expect.Equal(accept2, 5)
 	expect.Equal(deny2, 5)
 }
+
+func TestFilterSampleEvery(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	msg := core.NewMessage(nil, []byte{}, nil, 1)
+
+	conf := core.NewPluginConfig("", "filter.Sample")
+	conf.Override("Every", uint64(4))
+	plugin, err := core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted := plugin.(*Sample)
+	expect.True(casted)
+
+	accept := 0
+	for i := 0; i < 100; i++ {
+		result, _ := filter.ApplyFilter(msg)
+		if result == core.FilterResultMessageAccept {
+			accept++
+		}
+	}
+	expect.Equal(25, accept)
+}
+
+func TestFilterSampleProbability(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	msg := core.NewMessage(nil, []byte{}, nil, 1)
+
+	conf := core.NewPluginConfig("", "filter.Sample")
+	conf.Override("Probability", 0.1)
+	plugin, err := core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted := plugin.(*Sample)
+	expect.True(casted)
+
+	accept := 0
+	for i := 0; i < 10000; i++ {
+		result, _ := filter.ApplyFilter(msg)
+		if result == core.FilterResultMessageAccept {
+			accept++
+		}
+	}
+	expect.Geq(accept, 700)
+	expect.Leq(accept, 1300)
+
+	conf.Override("Probability", 1.5)
+	_, err = core.NewPluginWithConfig(conf)
+	expect.NotNil(err)
+}
+
+func TestFilterSampleKeyFrom(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	conf := core.NewPluginConfig("", "filter.Sample")
+	conf.Override("Probability", 0.5)
+	conf.Override("KeyFrom", "id")
+	plugin, err := core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted := plugin.(*Sample)
+	expect.True(casted)
+
+	accept := 0
+	for key := 0; key < 1000; key++ {
+		msg := core.NewMessage(nil, []byte{}, tcontainer.MarshalMap{"id": fmt.Sprint(key)}, 1)
+		first, _ := filter.ApplyFilter(msg)
+		for i := 0; i < 5; i++ {
+			result, _ := filter.ApplyFilter(msg)
+			expect.Equal(first, result)
+		}
+		if first == core.FilterResultMessageAccept {
+			accept++
+		}
+	}
+	expect.Geq(accept, 400)
+	expect.Leq(accept, 600)
+}
@@ -0,0 +1,262 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/treflect"
+)
+
+var timeWindowDays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// TimeWindow filter plugin
+//
+// This plugin accepts messages inside of a time window, e.g. during business
+// hours, and rejects all other messages. When Invert is set, messages inside
+// of the window are rejected instead, which can be used to mute alerts during
+// a maintenance window.
+//
+// The window starts at StartHour and ends before EndHour on each of the given
+// Days. If StartHour is greater than EndHour the window spans midnight and
+// ends on the following day, e.g. a window from 22 to 6 on "Fri" ends on
+// Saturday 6:00.
+//
+// Parameters
+//
+// - Days: Defines a list of weekdays the window starts on. Days are given as
+// english names or abbreviations like "Mon" or "Monday". Ranges like
+// "Mon-Fri" are supported, too. When left empty, the window starts on every day.
+// By default this parameter is set to an empty list.
+//
+// - StartHour: Defines the hour of the day the window starts at (0-23).
+// By default this parameter is set to "0".
+//
+// - EndHour: Defines the hour of the day the window ends at (0-24). The window
+// ends before this hour.
+// By default this parameter is set to "24".
+//
+// - Timezone: Defines the timezone StartHour, EndHour and Days are evaluated
+// in, e.g. "UTC" or "Europe/Berlin". When left empty, the local timezone is
+// used.
+// By default this parameter is set to "".
+//
+// - Invert: When set to true, messages inside of the window are rejected and
+// messages outside of the window are accepted.
+// By default this parameter is set to false.
+//
+// - TimeFrom: Defines the metadata field to read the message time from. The
+// value may be a time, a unix timestamp in seconds or a string formatted as
+// given by TimeFormat. When left empty, or if the field is missing or cannot
+// be parsed, the current time is used.
+// By default this parameter is set to "".
+//
+// - TimeFormat: Defines the Go time format string used to parse string values
+// of TimeFrom. When left empty, a unix timestamp is expected.
+// By default this parameter is set to "".
+//
+// Examples
+//
+// This example only passes messages during business hours:
+//
+//  exampleConsumer:
+//    Type: consumer.Console
+//    Streams: "*"
+//    Modulators:
+//      - filter.TimeWindow:
+//        Days: "Mon-Fri"
+//        StartHour: 9
+//        EndHour: 18
+//        Timezone: "Europe/Berlin"
+//
+// This example mutes alerts during the nightly maintenance window on
+// sundays, evaluated against the time the alert was raised:
+//
+//  exampleConsumer:
+//    Type: consumer.Console
+//    Streams: alerts
+//    Modulators:
+//      - filter.TimeWindow:
+//        Days: "Sun"
+//        StartHour: 23
+//        EndHour: 2
+//        Timezone: "UTC"
+//        Invert: true
+//        TimeFrom: raised_at
+//        TimeFormat: "2006-01-02T15:04:05Z07:00"
+type TimeWindow struct {
+	core.SimpleFilter `gollumdoc:"embed_type"`
+	startHour         int    `config:"StartHour" default:"0"`
+	endHour           int    `config:"EndHour" default:"24"`
+	invert            bool   `config:"Invert" default:"false"`
+	timeFrom          string `config:"TimeFrom"`
+	timeFormat        string `config:"TimeFormat"`
+	days              [7]bool
+	location          *time.Location
+	now               func() time.Time
+}
+
+func init() {
+	core.TypeRegistry.Register(TimeWindow{})
+}
+
+// Configure initializes this filter with values from a plugin config.
+func (filter *TimeWindow) Configure(conf core.PluginConfigReader) {
+	filter.now = time.Now
+
+	if filter.startHour < 0 || filter.startHour > 23 {
+		conf.Errors.Pushf("StartHour must be between 0 and 23")
+	}
+	if filter.endHour < 0 || filter.endHour > 24 {
+		conf.Errors.Pushf("EndHour must be between 0 and 24")
+	}
+	if filter.startHour == filter.endHour {
+		conf.Errors.Pushf("StartHour and EndHour must not be equal")
+	}
+
+	filter.location = time.Local
+	if timezone := conf.GetString("Timezone", ""); timezone != "" {
+		location, err := time.LoadLocation(timezone)
+		if !conf.Errors.Push(err) {
+			filter.location = location
+		}
+	}
+
+	days := conf.GetStringArray("Days", []string{})
+	if len(days) == 0 {
+		for day := range filter.days {
+			filter.days[day] = true
+		}
+	}
+	for _, days := range days {
+		if err := filter.addDays(days); err != nil {
+			conf.Errors.Push(err)
+		}
+	}
+}
+
+// addDays enables a single day or a range of days like "Mon-Fri".
+func (filter *TimeWindow) addDays(days string) error {
+	bounds := strings.SplitN(days, "-", 2)
+	first, err := parseWeekday(bounds[0])
+	if err != nil {
+		return err
+	}
+
+	last := first
+	if len(bounds) > 1 {
+		if last, err = parseWeekday(bounds[1]); err != nil {
+			return err
+		}
+	}
+
+	for day := first; ; day = (day + 1) % 7 {
+		filter.days[day] = true
+		if day == last {
+			return nil
+		}
+	}
+}
+
+func parseWeekday(name string) (time.Weekday, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if len(name) >= 3 {
+		if day, known := timeWindowDays[name[:3]]; known && strings.HasPrefix(strings.ToLower(day.String()), name) {
+			return day, nil
+		}
+	}
+	return time.Sunday, fmt.Errorf("Unknown day '%s'", name)
+}
+
+// isInside returns true if the given time is inside of the window.
+func (filter *TimeWindow) isInside(t time.Time) bool {
+	t = t.In(filter.location)
+	hour := t.Hour()
+	day := t.Weekday()
+
+	if filter.startHour < filter.endHour {
+		return filter.days[day] && hour >= filter.startHour && hour < filter.endHour
+	}
+
+	// Window spans midnight
+	switch {
+	case hour >= filter.startHour:
+		return filter.days[day]
+	case hour < filter.endHour:
+		return filter.days[(day+6)%7]
+	default:
+		return false
+	}
+}
+
+// getTime returns the time stored in TimeFrom or the current time.
+func (filter *TimeWindow) getTime(msg *core.Message) (time.Time, error) {
+	if filter.timeFrom == "" {
+		return filter.now(), nil
+	}
+
+	value, exists := core.GetValuePath(msg.TryGetMetadata(), filter.timeFrom)
+	if !exists || value == nil {
+		return filter.now(), fmt.Errorf("metadata field %s not found", filter.timeFrom)
+	}
+
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case string, []byte:
+		str := string(core.ConvertToBytes(v))
+		if filter.timeFormat != "" {
+			t, err := time.ParseInLocation(filter.timeFormat, str, filter.location)
+			if err != nil {
+				return filter.now(), err
+			}
+			return t, nil
+		}
+		unix, err := strconv.ParseInt(str, 10, 64)
+		if err != nil {
+			return filter.now(), err
+		}
+		return time.Unix(unix, 0), nil
+	}
+
+	if unix, isNumber := treflect.Int64(value); isNumber {
+		return time.Unix(unix, 0), nil
+	}
+	return filter.now(), fmt.Errorf("metadata field %s does not contain a time", filter.timeFrom)
+}
+
+// ApplyFilter checks if the message time is inside of the window. Messages
+// without a valid time in TimeFrom are checked against the current time and
+// an error is returned.
+func (filter *TimeWindow) ApplyFilter(msg *core.Message) (core.FilterResult, error) {
+	t, err := filter.getTime(msg)
+	if filter.isInside(t) != filter.invert {
+		return core.FilterResultMessageAccept, err
+	}
+	return filter.GetFilterResultMessageReject(), err
+}
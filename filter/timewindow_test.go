@@ -0,0 +1,248 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package filter
+
+import (
+	"testing"
+	"time"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+// applyTimeWindowAt runs the filter with the current time set to the given
+// UTC time string.
+func applyTimeWindowAt(filter *TimeWindow, now string) core.FilterResult {
+	filter.now = func() time.Time {
+		t, _ := time.Parse(time.RFC3339, now)
+		return t
+	}
+	msg := core.NewMessage(nil, []byte{}, nil, core.InvalidStreamID)
+	result, _ := filter.ApplyFilter(msg)
+	return result
+}
+
+func TestTimeWindowBusinessHours(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	reject := core.FilterResultMessageReject(core.InvalidStreamID)
+
+	conf := core.NewPluginConfig("", "filter.TimeWindow")
+	conf.Override("Days", []interface{}{"Mon-Fri"})
+	conf.Override("StartHour", 9)
+	conf.Override("EndHour", 18)
+	conf.Override("Timezone", "UTC")
+
+	plugin, err := core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted := plugin.(*TimeWindow)
+	expect.True(casted)
+
+	// 2018-03-05 is a monday
+	expect.Equal(core.FilterResultMessageAccept, applyTimeWindowAt(filter, "2018-03-05T09:00:00Z"))
+	expect.Equal(core.FilterResultMessageAccept, applyTimeWindowAt(filter, "2018-03-09T17:59:59Z"))
+	expect.Equal(reject, applyTimeWindowAt(filter, "2018-03-05T08:59:59Z"))
+	expect.Equal(reject, applyTimeWindowAt(filter, "2018-03-05T18:00:00Z"))
+	expect.Equal(reject, applyTimeWindowAt(filter, "2018-03-10T12:00:00Z"))
+	expect.Equal(reject, applyTimeWindowAt(filter, "2018-03-11T12:00:00Z"))
+}
+
+func TestTimeWindowTimezone(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	reject := core.FilterResultMessageReject(core.InvalidStreamID)
+
+	conf := core.NewPluginConfig("", "filter.TimeWindow")
+	conf.Override("Days", []interface{}{"Monday"})
+	conf.Override("StartHour", 0)
+	conf.Override("EndHour", 2)
+	conf.Override("Timezone", "Asia/Tokyo")
+
+	plugin, err := core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted := plugin.(*TimeWindow)
+	expect.True(casted)
+
+	// Monday 0:00-2:00 in Tokyo (UTC+9) is Sunday 15:00-17:00 in UTC
+	expect.Equal(core.FilterResultMessageAccept, applyTimeWindowAt(filter, "2018-03-04T15:00:00Z"))
+	expect.Equal(core.FilterResultMessageAccept, applyTimeWindowAt(filter, "2018-03-04T16:30:00Z"))
+	expect.Equal(reject, applyTimeWindowAt(filter, "2018-03-04T17:00:00Z"))
+	expect.Equal(reject, applyTimeWindowAt(filter, "2018-03-05T00:30:00Z"))
+
+	conf = core.NewPluginConfig("", "filter.TimeWindow")
+	conf.Override("Days", []interface{}{"Sun"})
+	conf.Override("StartHour", 22)
+	conf.Override("EndHour", 24)
+	conf.Override("Timezone", "America/New_York")
+
+	plugin, err = core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted = plugin.(*TimeWindow)
+	expect.True(casted)
+
+	// Sunday 22:00-24:00 in New York (UTC-5) is Monday 3:00-5:00 in UTC
+	expect.Equal(core.FilterResultMessageAccept, applyTimeWindowAt(filter, "2018-03-05T03:00:00Z"))
+	expect.Equal(core.FilterResultMessageAccept, applyTimeWindowAt(filter, "2018-03-05T04:59:59Z"))
+	expect.Equal(reject, applyTimeWindowAt(filter, "2018-03-05T05:00:00Z"))
+	expect.Equal(reject, applyTimeWindowAt(filter, "2018-03-04T23:00:00Z"))
+}
+
+func TestTimeWindowOvernight(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	reject := core.FilterResultMessageReject(core.InvalidStreamID)
+
+	conf := core.NewPluginConfig("", "filter.TimeWindow")
+	conf.Override("Days", []interface{}{"Fri"})
+	conf.Override("StartHour", 22)
+	conf.Override("EndHour", 6)
+	conf.Override("Timezone", "UTC")
+
+	plugin, err := core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted := plugin.(*TimeWindow)
+	expect.True(casted)
+
+	// 2018-03-09 is a friday
+	expect.Equal(reject, applyTimeWindowAt(filter, "2018-03-09T21:59:59Z"))
+	expect.Equal(core.FilterResultMessageAccept, applyTimeWindowAt(filter, "2018-03-09T22:00:00Z"))
+	expect.Equal(core.FilterResultMessageAccept, applyTimeWindowAt(filter, "2018-03-10T00:00:00Z"))
+	expect.Equal(core.FilterResultMessageAccept, applyTimeWindowAt(filter, "2018-03-10T05:59:59Z"))
+	expect.Equal(reject, applyTimeWindowAt(filter, "2018-03-10T06:00:00Z"))
+	expect.Equal(reject, applyTimeWindowAt(filter, "2018-03-10T22:00:00Z"))
+	expect.Equal(reject, applyTimeWindowAt(filter, "2018-03-09T03:00:00Z"))
+
+	// Sat-Sun wraps around the end of the week
+	conf = core.NewPluginConfig("", "filter.TimeWindow")
+	conf.Override("Days", []interface{}{"Sat-Sun"})
+	conf.Override("StartHour", 20)
+	conf.Override("EndHour", 4)
+	conf.Override("Timezone", "UTC")
+
+	plugin, err = core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted = plugin.(*TimeWindow)
+	expect.True(casted)
+
+	expect.Equal(core.FilterResultMessageAccept, applyTimeWindowAt(filter, "2018-03-11T21:00:00Z"))
+	expect.Equal(core.FilterResultMessageAccept, applyTimeWindowAt(filter, "2018-03-12T03:00:00Z"))
+	expect.Equal(reject, applyTimeWindowAt(filter, "2018-03-12T21:00:00Z"))
+	expect.Equal(reject, applyTimeWindowAt(filter, "2018-03-10T03:00:00Z"))
+}
+
+func TestTimeWindowInvert(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	conf := core.NewPluginConfig("", "filter.TimeWindow")
+	conf.Override("StartHour", 2)
+	conf.Override("EndHour", 4)
+	conf.Override("Timezone", "UTC")
+	conf.Override("Invert", true)
+	conf.Override("FilteredStream", "muted")
+
+	plugin, err := core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted := plugin.(*TimeWindow)
+	expect.True(casted)
+
+	expect.Equal(core.FilterResultMessageReject(core.GetStreamID("muted")), applyTimeWindowAt(filter, "2018-03-05T03:00:00Z"))
+	expect.Equal(core.FilterResultMessageAccept, applyTimeWindowAt(filter, "2018-03-05T04:00:00Z"))
+}
+
+func TestTimeWindowTimeFrom(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	reject := core.FilterResultMessageReject(core.InvalidStreamID)
+
+	conf := core.NewPluginConfig("", "filter.TimeWindow")
+	conf.Override("StartHour", 9)
+	conf.Override("EndHour", 18)
+	conf.Override("Timezone", "Europe/Berlin")
+	conf.Override("TimeFrom", "time")
+	conf.Override("TimeFormat", "2006-01-02 15:04")
+
+	plugin, err := core.NewPluginWithConfig(conf)
+	expect.NoError(err)
+
+	filter, casted := plugin.(*TimeWindow)
+	expect.True(casted)
+
+	filter.now = func() time.Time {
+		return time.Date(2018, 3, 5, 12, 0, 0, 0, time.UTC)
+	}
+
+	// Strings are parsed in the configured timezone
+	msg := core.NewMessage(nil, []byte{}, tcontainer.MarshalMap{"time": "2018-03-05 09:00"}, core.InvalidStreamID)
+	result, err := filter.ApplyFilter(msg)
+	expect.NoError(err)
+	expect.Equal(core.FilterResultMessageAccept, result)
+
+	msg = core.NewMessage(nil, []byte{}, tcontainer.MarshalMap{"time": "2018-03-05 08:59"}, core.InvalidStreamID)
+	result, err = filter.ApplyFilter(msg)
+	expect.NoError(err)
+	expect.Equal(reject, result)
+
+	msg = core.NewMessage(nil, []byte{}, tcontainer.MarshalMap{"time": time.Date(2018, 3, 5, 20, 0, 0, 0, time.UTC)}, core.InvalidStreamID)
+	result, err = filter.ApplyFilter(msg)
+	expect.NoError(err)
+	expect.Equal(reject, result)
+
+	// Missing or invalid times fall back to the current time
+	msg = core.NewMessage(nil, []byte{}, nil, core.InvalidStreamID)
+	result, err = filter.ApplyFilter(msg)
+	expect.NotNil(err)
+	expect.Equal(core.FilterResultMessageAccept, result)
+
+	msg = core.NewMessage(nil, []byte{}, tcontainer.MarshalMap{"time": "invalid"}, core.InvalidStreamID)
+	result, err = filter.ApplyFilter(msg)
+	expect.NotNil(err)
+	expect.Equal(core.FilterResultMessageAccept, result)
+
+	// Unix timestamps
+	filter.timeFormat = ""
+	msg = core.NewMessage(nil, []byte{}, tcontainer.MarshalMap{"time": int64(1520240400)}, core.InvalidStreamID)
+	result, err = filter.ApplyFilter(msg)
+	expect.NoError(err)
+	expect.Equal(core.FilterResultMessageAccept, result)
+
+	msg = core.NewMessage(nil, []byte{}, tcontainer.MarshalMap{"time": "1520269200"}, core.InvalidStreamID)
+	result, err = filter.ApplyFilter(msg)
+	expect.NoError(err)
+	expect.Equal(reject, result)
+}
+
+func TestTimeWindowConfigErrors(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	for _, settings := range []map[string]interface{}{
+		{"StartHour": 24},
+		{"EndHour": 25},
+		{"StartHour": 5, "EndHour": 5},
+		{"Days": []interface{}{"Funday"}},
+		{"Days": []interface{}{"Mon-Xyz"}},
+		{"Timezone": "Nowhere/Special"},
+	} {
+		conf := core.NewPluginConfig("", "filter.TimeWindow")
+		for key, value := range settings {
+			conf.Override(key, value)
+		}
+		_, err := core.NewPluginWithConfig(conf)
+		expect.NotNil(err)
+	}
+}
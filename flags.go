@@ -28,13 +28,18 @@ var (
 	flagVersion        = tflag.Switch("v", "version", "Print version information and quit.")
 	flagExtVersion     = tflag.Switch("r", "runtime", "Print runtime information and quit.")
 	flagModules        = tflag.Switch("l", "list", "Print plugin information and quit.")
-	flagConfigFile     = tflag.String("c", "config", "", "Use a given configuration file.")
+	flagConfigFile     = tflag.String("c", "config", "", "Use a given configuration file. Use \"-\" to read from stdin or an http(s) URL to fetch it remotely.")
+	flagConfigHeader   = tflag.String("ch", "config-header", "", "Header to send when fetching the configuration from a URL, e.g. \"Authorization: Bearer <token>\".")
+	flagConfigCache    = tflag.String("cc", "config-cache", "", "File to store the last valid configuration fetched from a URL. Used if the URL cannot be fetched.")
+	flagConfigDir      = tflag.String("cd", "config-dir", "", "Merge all *.yaml files in a given directory in sorted order and use them as configuration.")
 	flagTestConfigFile = tflag.String("tc", "testconfig", "", "Test the given configuration file and exit.")
+	flagDryRunFile     = tflag.String("dr", "dryrun", "", "Test the given configuration file, check if plugin backends are reachable and exit.")
 	flagLoglevel       = tflag.Int("ll", "loglevel", 2, "Set the loglevel [0-3] as in {0=Error, 1=+Warning, 2=+Info, 3=+Debug}.")
 	flagLogColors      = tflag.String("lc", "log-colors", "auto", "Use Logrus's \"colored\" log format. One of \"never\", \"auto\" (default), \"always\"")
+	flagLogRedact      = tflag.String("lr", "log-redact", "default", "Redact secrets from log messages. One of \"default\", \"none\" or a file with one additional regular expression per line.")
 	flagNumCPU         = tflag.Int("n", "numcpu", 0, "Number of CPUs to use. Set 0 for all CPUs (respects cgroup limits).")
 	flagPidFile        = tflag.String("p", "pidfile", "", "Write the process id into a given file.")
-	flagMetricsAddress = tflag.String("m", "metrics", "", "Address to use for metric queries. Disabled by default.")
+	flagMetricsAddress = tflag.String("m", "metrics", "", "Address to use for metric queries. Metrics are served at /metrics. Disabled by default.")
 	flagMetricsType    = tflag.String("mt", "metricstype", "", "Type of metrics to generate. Defaults to \"prometheus\"")
 	flagHealthCheck    = tflag.String("hc", "healthcheck", "", "Listening address ([IP]:PORT) to use for healthcheck HTTP endpoint. Disabled by default.")
 	flagCPUProfile     = tflag.String("pc", "profilecpu", "", "Write CPU profiler results to a given file.")
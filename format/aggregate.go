@@ -26,6 +26,8 @@ import (
 //
 // Aggregate is a formatter which can group up further formatter.
 // The `Source` setting will be passed on to all child formatters, overwriting any source value there (if set).
+// The `Target` setting is passed on to all child formatters that don't set a target themselves.
+// `ApplyTo` sets both, so all child formatters work on the same metadata field.
 // This plugin could be useful to setup complex configs with metadata handling in more readable format.
 //
 // Parameters
@@ -36,6 +38,11 @@ import (
 // This values is forced to be used by all child modulators.
 // By default this parameter is set to "".
 //
+// - Target: This value chooses the part of the message the child modulators
+// store their results to. Child modulators setting Target themselves are not
+// affected.
+// By default this parameter is set to "".
+//
 // - Modulators: Defines a list of child modulators to be applied to a message
 // when it arrives at this formatter. Please note that everything is still one
 // message. I.e. applying filters twice might not make sense.
@@ -94,10 +101,8 @@ func init() {
 
 // Configure initializes this formatter with values from a plugin config.
 func (format *Aggregate) Configure(conf core.PluginConfigReader) {
-	Source := conf.GetString("Source", "")
-
 	// init modulator array
-	modulatorSettings := format.getModulatorSettings(Source, conf)
+	modulatorSettings := format.getModulatorSettings(format.GetSourceKey(), format.GetTargetKey(), conf)
 
 	config := core.NewPluginConfig("", "format.Aggregate.Modulators")
 	config.Override("Modulators", modulatorSettings)
@@ -124,7 +129,7 @@ func (format *Aggregate) ApplyFormatter(msg *core.Message) error {
 	return nil
 }
 
-func (format *Aggregate) getModulatorSettings(Source string, conf core.PluginConfigReader) []interface{} {
+func (format *Aggregate) getModulatorSettings(Source string, Target string, conf core.PluginConfigReader) []interface{} {
 	finalModulatorMap := []interface{}{}
 
 	for _, childFormatterArray := range conf.GetArray("Modulators", []interface{}{}) {
@@ -136,6 +141,9 @@ func (format *Aggregate) getModulatorSettings(Source string, conf core.PluginCon
 			for childFormatterName, childFormatterItem := range childFormatter {
 				childFormatterItemMap := childFormatterItem.(tcontainer.MarshalMap)
 				childFormatterItemMap["Source"] = Source
+				if _, hasTarget := childFormatterItemMap["Target"]; !hasTarget && Target != "" {
+					childFormatterItemMap["Target"] = Target
+				}
 
 				finalModulatorMap = format.appendModulator(childFormatterName, childFormatterItemMap, finalModulatorMap)
 
@@ -143,6 +151,9 @@ func (format *Aggregate) getModulatorSettings(Source string, conf core.PluginCon
 		case string:
 			childFormatterItemMap := tcontainer.NewMarshalMap()
 			childFormatterItemMap["Source"] = Source
+			if Target != "" {
+				childFormatterItemMap["Target"] = Target
+			}
 
 			finalModulatorMap = format.appendModulator(childFormatter, childFormatterItemMap, finalModulatorMap)
 
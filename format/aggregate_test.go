@@ -122,3 +122,44 @@ func TestAggregate_ApplyFormatterWithTarget(t *testing.T) {
 	expect.NoError(err)
 	expect.Equal("payloadAB", val)
 }
+
+func TestAggregate_ApplyFormatterApplyTo(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	core.TypeRegistry.Register(applyFormatterMockA{})
+	core.TypeRegistry.Register(applyFormatterMockB{})
+
+	config := core.NewPluginConfig("", "format.Aggregate")
+	config.Override("ApplyTo", "foo")
+	config.Override("Modulators", []interface{}{
+		"format.applyFormatterMockA",
+		map[string]interface{}{
+			"format.applyFormatterMockB": map[string]interface{}{
+				"Value": "B",
+			},
+		},
+		map[string]interface{}{
+			"format.applyFormatterMockB": map[string]interface{}{
+				"Target": "bar",
+				"Value":  "C",
+			},
+		},
+	})
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+	formatter, casted := plugin.(*Aggregate)
+	expect.True(casted)
+
+	metadata := core.NewMetadata()
+	metadata.Set("foo", "metadata")
+
+	msg := core.NewMessage(nil, []byte("payload"), metadata, core.InvalidStreamID)
+
+	err = formatter.ApplyFormatter(msg)
+	expect.NoError(err)
+
+	expect.Equal("payload", string(msg.GetPayload()))
+	expect.MapEqual(msg.GetMetadata(), "foo", "metadataAB")
+	expect.MapEqual(msg.GetMetadata(), "bar", "metadataABC")
+}
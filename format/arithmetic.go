@@ -0,0 +1,120 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"math"
+	"strings"
+
+	"gollum/core"
+)
+
+// Arithmetic formatter
+//
+// This formatter applies a basic arithmetic operation with a constant value to
+// a number stored in a metadata field. Numbers stored as strings are parsed.
+// Values that are not a number are left unchanged and a warning is logged.
+//
+// Parameters
+//
+// - Operation: Defines the operation to apply. Can be one of "add", "mul" or
+// "div".
+// By default this parameter is set to "add".
+//
+// - Value: Defines the constant value used as second operand.
+// By default this parameter is set to 0.
+//
+// The result is an int if the field contains an integer and the operation is
+// "add" or "mul" with an integer Value. Otherwise the result is a float. Use
+// format.Cast to change the type of the result.
+//
+// Examples
+//
+// This example converts the response time stored in microseconds to
+// milliseconds and casts the result to int.
+//
+//  exampleConsumer:
+//    Type: consumer.Console
+//    Streams: stdin
+//    Modulators:
+//      - format.JSON
+//      - format.Arithmetic:
+//          ApplyTo: response_time
+//          Operation: div
+//          Value: 1000
+//      - format.Cast:
+//          ApplyTo: response_time
+//          ToType: int
+type Arithmetic struct {
+	core.SimpleFormatter `gollumdoc:"embed_type"`
+	operation            string `config:"Operation" default:"add"`
+	value                float64
+	valueIsInt           bool
+}
+
+func init() {
+	core.TypeRegistry.Register(Arithmetic{})
+}
+
+// Configure initializes this formatter with values from a plugin config.
+func (format *Arithmetic) Configure(conf core.PluginConfigReader) {
+	format.operation = strings.ToLower(format.operation)
+	format.value = conf.GetFloat("Value", 0)
+	format.valueIsInt = format.value == math.Trunc(format.value) && !math.IsInf(format.value, 0)
+
+	switch format.operation {
+	case "add", "mul":
+	case "div":
+		if format.value == 0 {
+			conf.Errors.Pushf("Value must not be 0 when using div")
+		}
+	default:
+		conf.Errors.Pushf("Operation must be one of add, mul or div")
+	}
+}
+
+// ApplyFormatter update message payload
+func (format *Arithmetic) ApplyFormatter(msg *core.Message) error {
+	intVal, floatVal, isInt, err := getNumber(format.GetSourceData(msg))
+	if err != nil {
+		format.Logger.WithError(err).Warningf("Cannot apply %s", format.operation)
+		return nil
+	}
+
+	if isInt && format.valueIsInt && format.operation != "div" {
+		format.SetTargetData(msg, format.applyInt(intVal, int64(format.value)))
+	} else {
+		format.SetTargetData(msg, format.applyFloat(floatVal))
+	}
+	return nil
+}
+
+func (format *Arithmetic) applyInt(value int64, operand int64) int64 {
+	if format.operation == "mul" {
+		return value * operand
+	}
+	return value + operand
+}
+
+func (format *Arithmetic) applyFloat(value float64) float64 {
+	switch format.operation {
+	case "mul":
+		return value * format.value
+	case "div":
+		return value / format.value
+	default:
+		return value + format.value
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func applyArithmetic(t *testing.T, operation string, operand interface{}, value interface{}) interface{} {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Arithmetic")
+	config.Override("ApplyTo", "foo")
+	config.Override("Operation", operation)
+	config.Override("Value", operand)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Arithmetic)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte{}, tcontainer.MarshalMap{"foo": value}, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+
+	result, _ := msg.GetMetadata().Value("foo")
+	return result
+}
+
+func TestArithmeticInt(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	expect.Equal(int64(45), applyArithmetic(t, "add", 3, 42))
+	expect.Equal(int64(39), applyArithmetic(t, "add", -3, "42"))
+	expect.Equal(int64(84), applyArithmetic(t, "mul", 2, int64(42)))
+
+	// Non-integer operands or division always result in a float
+	expect.Equal(42.5, applyArithmetic(t, "add", 0.5, 42))
+	expect.Equal(1.5, applyArithmetic(t, "div", 1000, 1500))
+	expect.Equal(float64(2), applyArithmetic(t, "div", 1000, "2000"))
+}
+
+func TestArithmeticFloat(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	expect.Equal(2.5, applyArithmetic(t, "add", 1, 1.5))
+	expect.Equal(3.0, applyArithmetic(t, "mul", 2, "1.5"))
+	expect.Equal(0.25, applyArithmetic(t, "div", 2, 0.5))
+}
+
+func TestArithmeticInvalid(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	// Values that are not a number are left unchanged
+	expect.Equal("foo", applyArithmetic(t, "add", 1, "foo"))
+
+	config := core.NewPluginConfig("", "format.Arithmetic")
+	config.Override("Operation", "div")
+	config.Override("Value", 0)
+	_, err := core.NewPluginWithConfig(config)
+	expect.NotNil(err)
+
+	config = core.NewPluginConfig("", "format.Arithmetic")
+	config.Override("Operation", "pow")
+	_, err = core.NewPluginWithConfig(config)
+	expect.NotNil(err)
+}
@@ -15,6 +15,8 @@
 package format
 
 import (
+	"bytes"
+	"encoding/base64"
 	"testing"
 
 	"gollum/core"
@@ -94,3 +96,151 @@ func TestBase64EncodeApplyHandling(t *testing.T) {
 	expect.NoError(err)
 	expect.Equal("dGVzdA==", string(val))
 }
+
+func TestBase64Dialects(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	payload := []byte{0xfb, 0xff, 0xbf, 'x'}
+	expected := map[string]string{
+		"std":    "+/+/eA==",
+		"url":    "-_-_eA==",
+		"raw":    "+/+/eA",
+		"rawurl": "-_-_eA",
+	}
+
+	for dialect, encoded := range expected {
+		encoderConfig := core.NewPluginConfig("", "format.Base64Encode")
+		encoderConfig.Override("Dialect", dialect)
+
+		plugin, err := core.NewPluginWithConfig(encoderConfig)
+		expect.NoError(err)
+
+		encoder, casted := plugin.(*Base64Encode)
+		expect.True(casted)
+
+		decoderConfig := core.NewPluginConfig("", "format.Base64Decode")
+		decoderConfig.Override("Dialect", dialect)
+
+		plugin, err = core.NewPluginWithConfig(decoderConfig)
+		expect.NoError(err)
+
+		decoder, casted := plugin.(*Base64Decode)
+		expect.True(casted)
+
+		msg := core.NewMessage(nil, payload, nil, core.InvalidStreamID)
+		expect.NoError(encoder.ApplyFormatter(msg))
+		expect.Equal(encoded, string(msg.GetPayload()))
+
+		expect.NoError(decoder.ApplyFormatter(msg))
+		expect.Equal(payload, msg.GetPayload())
+	}
+}
+
+func TestBase64RoundTrip(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	encoderConfig := core.NewPluginConfig("", "format.Base64Encode")
+
+	plugin, err := core.NewPluginWithConfig(encoderConfig)
+	expect.NoError(err)
+
+	encoder, casted := plugin.(*Base64Encode)
+	expect.True(casted)
+
+	decoderConfig := core.NewPluginConfig("", "format.Base64Decode")
+
+	plugin, err = core.NewPluginWithConfig(decoderConfig)
+	expect.NoError(err)
+
+	decoder, casted := plugin.(*Base64Decode)
+	expect.True(casted)
+
+	payload := make([]byte, 256)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+
+	for size := 0; size <= len(payload); size++ {
+		msg := core.NewMessage(nil, payload[:size], nil, core.InvalidStreamID)
+		expect.NoError(encoder.ApplyFormatter(msg))
+		expect.NoError(decoder.ApplyFormatter(msg))
+		expect.Equal(payload[:size], msg.GetPayload())
+	}
+}
+
+func TestBase64InvalidDialect(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Base64Encode")
+	config.Override("Dialect", "foo")
+	_, err := core.NewPluginWithConfig(config)
+	expect.NotNil(err)
+}
+
+func TestBase64DecodeMalformed(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Base64Decode")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	decoder, casted := plugin.(*Base64Decode)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("dGVz!A=="), nil, core.InvalidStreamID)
+
+	expect.NotNil(decoder.ApplyFormatter(msg))
+	expect.Equal("dGVz!A==", string(msg.GetPayload()))
+}
+
+func TestBase64DecodeErrorField(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Base64Decode")
+	config.Override("ErrorField", "error")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	decoder, casted := plugin.(*Base64Decode)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("dGVz!A=="), nil, core.InvalidStreamID)
+
+	expect.NoError(decoder.ApplyFormatter(msg))
+	expect.Equal("dGVz!A==", string(msg.GetPayload()))
+
+	errMsg, err := msg.GetMetadata().String("error")
+	expect.NoError(err)
+	expect.Equal("illegal base64 data at input byte 4", errMsg)
+}
+
+func benchmarkBase64(b *testing.B, typeName string, payload []byte) {
+	config := core.NewPluginConfig("", typeName)
+	plugin, err := core.NewPluginWithConfig(config)
+	if err != nil {
+		b.Fatal(err)
+	}
+	formatter := plugin.(core.Formatter)
+
+	msg := core.NewMessage(nil, payload, nil, core.InvalidStreamID)
+	b.SetBytes(int64(len(payload)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		msg.StorePayload(payload)
+		if err := formatter.ApplyFormatter(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBase64Encode(b *testing.B) {
+	benchmarkBase64(b, "format.Base64Encode", bytes.Repeat([]byte("gollum"), 1024))
+}
+
+func BenchmarkBase64Decode(b *testing.B) {
+	payload := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("gollum"), 1024))
+	benchmarkBase64(b, "format.Base64Decode", []byte(payload))
+}
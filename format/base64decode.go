@@ -24,12 +24,23 @@ import (
 //
 // Base64Decode is a formatter that decodes base64 encoded messages.
 // If a message is not or only partly base64 encoded an error will be logged
-// and the decoded part is returned. RFC 4648 is expected.
+// and the message is left unchanged. RFC 4648 is expected.
 //
 // Parameters
 //
-// - Base64Dictionary: This value defines the 64-character base64 lookup
-// dictionary to use. When left empty, a dictionary as defined by RFC4648 is used.
+// - Dialect: This value defines the RFC 4648 encoding to expect. Valid values
+// are "std" for standard encoding, "url" for URL and filename safe encoding and
+// "raw" or "rawurl" for the unpadded variants of both.
+// By default this parameter is set to "std".
+//
+// - Dictionary: This value defines the 64-character base64 lookup
+// dictionary to use. When set, this replaces the alphabet of the selected
+// dialect.
+// By default this parameter is set to "".
+//
+// - ErrorField: When set, decoding errors are written to this metadata field
+// and the message is passed on unchanged. When left empty, messages that
+// cannot be decoded are treated as a formatter error.
 // By default this parameter is set to "".
 //
 // Examples
@@ -46,6 +57,7 @@ import (
 //
 type Base64Decode struct {
 	core.SimpleFormatter `gollumdoc:"embed_type"`
+	errorField           string `config:"ErrorField"`
 	dictionary           *base64.Encoding
 }
 
@@ -55,21 +67,17 @@ func init() {
 
 // Configure initializes this formatter with values from a plugin config.
 func (format *Base64Decode) Configure(conf core.PluginConfigReader) {
-	dict := conf.GetString("Dictionary", "")
-	if dict == "" {
-		format.dictionary = base64.StdEncoding
-	} else {
-		if len(dict) != 64 {
-			conf.Errors.Pushf("Base64 dictionary must contain 64 characters.")
-		}
-		format.dictionary = base64.NewEncoding(dict)
-	}
+	format.dictionary = getBase64Encoding(conf)
 }
 
 // ApplyFormatter execute the formatter
 func (format *Base64Decode) ApplyFormatter(msg *core.Message) error {
 	decoded, err := format.getDecodedContent(format.GetSourceDataAsBytes(msg))
 	if err != nil {
+		if format.errorField != "" {
+			msg.GetMetadata().Set(format.errorField, err.Error())
+			return nil
+		}
 		return err
 	}
 
@@ -83,7 +91,7 @@ func (format *Base64Decode) getDecodedContent(content []byte) ([]byte, error) {
 
 	size, err := format.dictionary.Decode(decoded, content)
 	if err != nil {
-		format.Logger.Error(err)
+		format.Logger.Warning(err)
 		return nil, err
 	}
 
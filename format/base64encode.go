@@ -16,6 +16,7 @@ package format
 
 import (
 	"encoding/base64"
+	"strings"
 
 	"gollum/core"
 )
@@ -27,8 +28,13 @@ import (
 //
 // Parameters
 //
-// - Base64Dictionary: Defines the 64-character base64 lookup dictionary to use.
-// When left empty a RFC 4648 standard encoding is used.
+// - Dialect: Defines the RFC 4648 encoding to use. Valid values are "std" for
+// standard encoding, "url" for URL and filename safe encoding and "raw" or
+// "rawurl" for the unpadded variants of both.
+// By default this parameter is set to "std".
+//
+// - Dictionary: Defines the 64-character base64 lookup dictionary to use.
+// When set, this replaces the alphabet of the selected dialect.
 // By default this parameter is set to "".
 //
 // Examples
@@ -39,8 +45,8 @@ import (
 //    Type: consumer.Console
 //    Streams: console
 //    Modulators:
-//      - formatter.Base64Encode
-//        Dictionary: "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+//      - format.Base64Encode:
+//          Dialect: url
 //
 type Base64Encode struct {
 	core.SimpleFormatter `gollumdoc:"embed_type"`
@@ -53,15 +59,7 @@ func init() {
 
 // Configure initializes this formatter with values from a plugin config.
 func (format *Base64Encode) Configure(conf core.PluginConfigReader) {
-	dict := conf.GetString("Dictionary", "")
-	if dict == "" {
-		format.dictionary = base64.StdEncoding
-	} else {
-		if len(dict) != 64 {
-			conf.Errors.Pushf("Base64 dictionary must contain 64 characters.")
-		}
-		format.dictionary = base64.NewEncoding(dict)
-	}
+	format.dictionary = getBase64Encoding(conf)
 }
 
 // ApplyFormatter update message payload
@@ -79,3 +77,39 @@ func (format *Base64Encode) getEncodedContent(content []byte) []byte {
 	format.dictionary.Encode(encoded, content)
 	return encoded
 }
+
+// getBase64Encoding returns the encoding configured by the Dialect and
+// Dictionary parameters. Errors are pushed to the given config reader.
+func getBase64Encoding(conf core.PluginConfigReader) *base64.Encoding {
+	var encoding *base64.Encoding
+	dialect := strings.ToLower(conf.GetString("Dialect", "std"))
+
+	switch dialect {
+	case "std":
+		encoding = base64.StdEncoding
+	case "url":
+		encoding = base64.URLEncoding
+	case "raw":
+		encoding = base64.RawStdEncoding
+	case "rawurl":
+		encoding = base64.RawURLEncoding
+	default:
+		conf.Errors.Pushf("Unknown base64 dialect \"%s\"", dialect)
+		return base64.StdEncoding
+	}
+
+	dict := conf.GetString("Dictionary", "")
+	if dict == "" {
+		return encoding
+	}
+
+	if len(dict) != 64 {
+		conf.Errors.Pushf("Base64 dictionary must contain 64 characters.")
+		return encoding
+	}
+
+	if dialect == "raw" || dialect == "rawurl" {
+		return base64.NewEncoding(dict).WithPadding(base64.NoPadding)
+	}
+	return base64.NewEncoding(dict)
+}
@@ -0,0 +1,185 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gollum/core"
+)
+
+const (
+	caseLower = "lowercase"
+	caseUpper = "uppercase"
+	caseTitle = "titlecase"
+)
+
+// Case formatter
+//
+// This formatter changes the case of a string, e.g. to normalize fields for
+// case-insensitive indexing. Unicode characters are converted according to
+// their unicode case mapping. If the source contains an array, all string
+// elements or the elements selected by Elements are converted. Non-string
+// values are left unchanged.
+//
+// Parameters
+//
+// - Mode: Defines the case to convert to. Can be either "lowercase",
+// "uppercase" or "titlecase". Titlecase converts the first letter of each
+// word to title case and all other letters to lower case.
+// By default this parameter is set to "lowercase".
+//
+// - Elements: Defines a list of array indexes to convert if the source
+// contains an array. Negative indexes count from the end of the array. If
+// empty, all elements are converted.
+// By default this parameter is set to an empty list.
+//
+// Examples
+//
+// This example parses the payload as JSON and stores the "level" field as
+// well as the first element of the "tags" array in lower case.
+//
+//  exampleConsumer:
+//    Type: consumer.Console
+//    Streams: stdin
+//    Modulators:
+//      - format.JSON
+//      - format.Case:
+//        ApplyTo: level
+//      - format.Case:
+//        ApplyTo: tags
+//        Elements: [0]
+type Case struct {
+	core.SimpleFormatter `gollumdoc:"embed_type"`
+	mode                 string `config:"Mode" default:"lowercase"`
+	elements             []int
+	convert              func(string) string
+}
+
+func init() {
+	core.TypeRegistry.Register(Case{})
+}
+
+// Configure initializes this formatter with values from a plugin config.
+func (format *Case) Configure(conf core.PluginConfigReader) {
+	switch strings.ToLower(format.mode) {
+	case caseLower:
+		format.convert = strings.ToLower
+	case caseUpper:
+		format.convert = strings.ToUpper
+	case caseTitle:
+		format.convert = toTitleCase
+	default:
+		conf.Errors.Pushf("Mode must be one of %s, %s or %s", caseLower, caseUpper, caseTitle)
+	}
+
+	for _, element := range conf.GetArray("Elements", []interface{}{}) {
+		index, err := strconv.Atoi(core.ConvertToString(element))
+		if err != nil {
+			conf.Errors.Pushf("Element '%v' is not a valid array index", element)
+			continue
+		}
+		format.elements = append(format.elements, index)
+	}
+}
+
+// toTitleCase converts the first letter of each word to title case and all
+// other letters to lower case.
+func toTitleCase(value string) string {
+	wordStart := true
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsPunct(r) && r != '\'' {
+			wordStart = true
+			return r
+		}
+		if wordStart {
+			wordStart = false
+			return unicode.ToTitle(r)
+		}
+		return unicode.ToLower(r)
+	}, value)
+}
+
+// getIndexes returns the indexes of an array of the given length selected
+// by Elements.
+func (format *Case) getIndexes(length int) []int {
+	indexes := make([]int, 0, length)
+	if len(format.elements) == 0 {
+		for index := 0; index < length; index++ {
+			indexes = append(indexes, index)
+		}
+		return indexes
+	}
+
+	for _, index := range format.elements {
+		if index < 0 {
+			index += length
+		}
+		if index >= 0 && index < length {
+			indexes = append(indexes, index)
+		}
+	}
+	return indexes
+}
+
+// convertArray returns a copy of the given array with all selected string
+// elements converted.
+func (format *Case) convertArray(values []interface{}) []interface{} {
+	converted := make([]interface{}, len(values))
+	copy(converted, values)
+
+	for _, index := range format.getIndexes(len(values)) {
+		switch value := converted[index].(type) {
+		case string:
+			converted[index] = format.convert(value)
+		case []byte:
+			converted[index] = []byte(format.convert(string(value)))
+		default:
+			format.Logger.Debugf("Skipping non-string element %d of type %T", index, value)
+		}
+	}
+	return converted
+}
+
+// ApplyFormatter update message payload
+func (format *Case) ApplyFormatter(msg *core.Message) error {
+	switch value := format.GetSourceData(msg).(type) {
+	case string:
+		format.SetTargetData(msg, format.convert(value))
+
+	case []byte:
+		format.SetTargetData(msg, []byte(format.convert(string(value))))
+
+	case []string:
+		converted := make([]string, len(value))
+		copy(converted, value)
+		for _, index := range format.getIndexes(len(value)) {
+			converted[index] = format.convert(value[index])
+		}
+		format.SetTargetData(msg, converted)
+
+	case []interface{}:
+		format.SetTargetData(msg, format.convertArray(value))
+
+	case nil:
+		// Nothing to convert
+
+	default:
+		format.Logger.Debugf("Skipping non-string value of type %T", value)
+	}
+	return nil
+}
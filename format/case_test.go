@@ -0,0 +1,115 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestCaseModes(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	for mode, expected := range map[string]string{
+		"lowercase": "straße ǆemal été's-über",
+		"uppercase": "STRAßE ǄEMAL ÉTÉ'S-ÜBER",
+		"titlecase": "Straße ǅemal Été's-Über",
+	} {
+		config := core.NewPluginConfig("", "format.Case")
+		config.Override("Mode", mode)
+
+		plugin, err := core.NewPluginWithConfig(config)
+		expect.NoError(err)
+
+		formatter, casted := plugin.(*Case)
+		expect.True(casted)
+
+		msg := core.NewMessage(nil, []byte("Straße ǄEMAL ÉTÉ's-über"), nil, core.InvalidStreamID)
+		expect.NoError(formatter.ApplyFormatter(msg))
+		expect.Equal(expected, msg.String())
+	}
+}
+
+func TestCaseMetadata(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Case")
+	config.Override("ApplyTo", "level")
+	config.Override("Mode", "uppercase")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Case)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("payload"), tcontainer.MarshalMap{"level": "Warn"}, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.MapEqual(msg.GetMetadata(), "level", "WARN")
+	expect.Equal("payload", msg.String())
+
+	// Non-string values are skipped
+	msg = core.NewMessage(nil, []byte("payload"), tcontainer.MarshalMap{"level": 3}, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.MapEqual(msg.GetMetadata(), "level", 3)
+}
+
+func TestCaseArrayElements(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Case")
+	config.Override("ApplyTo", "tags")
+	config.Override("Elements", []interface{}{0, "-1", 7})
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Case)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, nil, tcontainer.MarshalMap{
+		"tags": []interface{}{"ÄRGER", "Keep", 42, "LAST"},
+	}, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.MapEqual(msg.GetMetadata(), "tags", []interface{}{"ärger", "Keep", 42, "last"})
+
+	// Without Elements all strings are converted
+	formatter.elements = nil
+	msg = core.NewMessage(nil, nil, tcontainer.MarshalMap{
+		"tags": []string{"ONE", "Two"},
+	}, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.MapEqual(msg.GetMetadata(), "tags", []string{"one", "two"})
+}
+
+func TestCaseConfigErrors(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	for _, settings := range []map[string]interface{}{
+		{"Mode": "camelcase"},
+		{"Elements": []interface{}{"first"}},
+	} {
+		config := core.NewPluginConfig("", "format.Case")
+		for key, value := range settings {
+			config.Override(key, value)
+		}
+		_, err := core.NewPluginWithConfig(config)
+		expect.NotNil(err)
+	}
+}
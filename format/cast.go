@@ -16,6 +16,7 @@ package format
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 
@@ -25,8 +26,10 @@ import (
 // Cast formatter
 //
 // This formatter casts a given metadata filed into another type.
+// Values that cannot be converted are left unchanged and a warning is logged.
 //
-// - AsType: The type to cast to. Can be either string, bytes, float or int.
+// - ToType: The type to cast to. Can be either string, bytes, float or int.
+// Casting a floating point number to int truncates the fractional part.
 // By default this parameter is set to "string".
 //
 // Examples
@@ -79,18 +82,26 @@ func (format *Cast) bytesCast(msg *core.Message) error {
 }
 
 func (format *Cast) intCast(msg *core.Message) error {
-	intVal, err := strconv.ParseInt(format.GetSourceDataAsString(msg), 10, 64)
+	intVal, floatVal, isInt, err := getNumber(format.GetSourceData(msg))
+	if err == nil && !isInt {
+		if math.IsNaN(floatVal) || floatVal >= math.MaxInt64 || floatVal < math.MinInt64 {
+			err = fmt.Errorf("%v is out of range for int", floatVal)
+		}
+		intVal = int64(floatVal)
+	}
 	if err != nil {
-		return err
+		format.Logger.WithError(err).Warning("Cannot cast to int")
+		return nil
 	}
 	format.SetTargetData(msg, intVal)
 	return nil
 }
 
 func (format *Cast) floatCast(msg *core.Message) error {
-	floatVal, err := strconv.ParseFloat(format.GetSourceDataAsString(msg), 64)
+	_, floatVal, _, err := getNumber(format.GetSourceData(msg))
 	if err != nil {
-		return err
+		format.Logger.WithError(err).Warning("Cannot cast to float")
+		return nil
 	}
 	format.SetTargetData(msg, floatVal)
 	return nil
@@ -104,3 +115,39 @@ func (format *Cast) noCast(msg *core.Message) error {
 func (format *Cast) ApplyFormatter(msg *core.Message) error {
 	return format.castMessage(msg)
 }
+
+// getNumber converts a number or a string containing a number. If the value
+// is an integer, isInt is true and intVal is set. floatVal is always set.
+func getNumber(value interface{}) (intVal int64, floatVal float64, isInt bool, err error) {
+	switch number := value.(type) {
+	case int:
+		return int64(number), float64(number), true, nil
+	case int8:
+		return int64(number), float64(number), true, nil
+	case int16:
+		return int64(number), float64(number), true, nil
+	case int32:
+		return int64(number), float64(number), true, nil
+	case int64:
+		return number, float64(number), true, nil
+	case uint8:
+		return int64(number), float64(number), true, nil
+	case uint16:
+		return int64(number), float64(number), true, nil
+	case uint32:
+		return int64(number), float64(number), true, nil
+	case float32:
+		return 0, float64(number), false, nil
+	case float64:
+		return 0, number, false, nil
+	}
+
+	str := strings.TrimSpace(core.ConvertToString(value))
+	if intVal, err := strconv.ParseInt(str, 10, 64); err == nil {
+		return intVal, float64(intVal), true, nil
+	}
+	if floatVal, err = strconv.ParseFloat(str, 64); err != nil {
+		return 0, 0, false, fmt.Errorf("%q is not a number", str)
+	}
+	return 0, floatVal, false, nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"math"
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func applyCast(t *testing.T, toType string, value interface{}) interface{} {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Cast")
+	config.Override("ApplyTo", "foo")
+	config.Override("ToType", toType)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Cast)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte{}, tcontainer.MarshalMap{"foo": value}, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+
+	result, _ := msg.GetMetadata().Value("foo")
+	return result
+}
+
+func TestCastInt(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	expect.Equal(int64(42), applyCast(t, "int", "42"))
+	expect.Equal(int64(-42), applyCast(t, "int", " -42 "))
+	expect.Equal(int64(42), applyCast(t, "int", []byte("42")))
+	expect.Equal(int64(42), applyCast(t, "int", 42))
+	expect.Equal(int64(12), applyCast(t, "int", 12.9))
+	expect.Equal(int64(-12), applyCast(t, "int", "-12.9"))
+	expect.Equal(int64(math.MaxInt64), applyCast(t, "int", "9223372036854775807"))
+
+	// Invalid values are left unchanged
+	expect.Equal("foo", applyCast(t, "int", "foo"))
+	expect.Equal(1e19, applyCast(t, "int", 1e19))
+	expect.Equal("NaN", applyCast(t, "int", "NaN"))
+}
+
+func TestCastFloat(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	expect.Equal(1.5, applyCast(t, "float", "1.5"))
+	expect.Equal(float64(42), applyCast(t, "float", 42))
+	expect.Equal(float64(42), applyCast(t, "float", int64(42)))
+	expect.Equal(1e-3, applyCast(t, "float", "1e-3"))
+
+	// Invalid values are left unchanged
+	expect.Equal("1,5", applyCast(t, "float", "1,5"))
+}
+
+func TestCastString(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	expect.Equal("42", applyCast(t, "string", 42))
+	expect.Equal("1.5", applyCast(t, "string", 1.5))
+	expect.Equal("foo", applyCast(t, "string", []byte("foo")))
+}
@@ -0,0 +1,217 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"strconv"
+	"unicode/utf8"
+
+	"gollum/core"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	chunkMetadataID    = "chunk_id"
+	chunkMetadataIndex = "chunk_index"
+	chunkMetadataCount = "chunk_count"
+)
+
+// Chunk formatter plugin
+//
+// Chunk splits messages with a payload larger than MaxBytes into multiple
+// messages of at most MaxBytes each. Messages that are small enough are
+// passed along unchanged.
+//
+// Each chunk is a copy of the original message with the payload replaced
+// and the metadata fields listed below set, so that the original payload can
+// be reassembled by ordering all chunks sharing a chunk_id by chunk_index.
+//
+// The last chunk replaces the payload of the original message and is passed
+// along. All other chunks are routed, in order and before the last chunk is
+// passed along, to ChunkStream or, if not set, to the stream of the original
+// message. These chunks pass the router of this stream and all modulators
+// following it like any other message. As chunks are never larger than
+// MaxBytes, they are not split again when passing this plugin.
+// When used as a producer modulator, routed chunks are sent to all producers
+// of the stream, so ChunkStream should point to a stream only this producer
+// listens to. Routers with Ordering set to "strict" must not route chunks to
+// their own stream.
+//
+// Metadata
+//
+// - chunk_id: Set to a random ID shared by all chunks of a message
+//
+// - chunk_index: Set to the position of the chunk, starting with 0
+//
+// - chunk_count: Set to the total number of chunks of a message
+//
+// Parameters
+//
+// - MaxBytes: Defines the maximum payload size of a message in bytes.
+// By default this parameter is set to "65536".
+//
+// - RuneBoundaries: When set to true, multibyte UTF-8 characters are never
+// split into two chunks. Chunks may be up to 3 bytes smaller than MaxBytes in
+// this case.
+// By default this parameter is set to true.
+//
+// - ChunkStream: Defines the stream all but the last chunk are routed to.
+// This parameter is required when this plugin is used as a consumer
+// modulator as consumers assign streams after modulating.
+// By default this parameter is set to "".
+//
+// Examples
+//
+// This example splits log lines into chunks of 8 KB before sending them to a
+// sink rejecting longer lines.
+//
+//  ExampleConsumer:
+//    Type: consumer.Console
+//    Streams: logs
+//    Modulators:
+//      - format.Chunk:
+//          MaxBytes: 8192
+//          ChunkStream: logs
+type Chunk struct {
+	Logger         logrus.FieldLogger
+	maxBytes       int  `config:"MaxBytes" default:"65536"`
+	runeBoundaries bool `config:"RuneBoundaries" default:"true"`
+	chunkStreamID  core.MessageStreamID
+	emit           func(chunk *core.Message)
+}
+
+func init() {
+	core.TypeRegistry.Register(Chunk{})
+}
+
+// Configure initializes this formatter with values from a plugin config.
+func (format *Chunk) Configure(conf core.PluginConfigReader) {
+	format.Logger = conf.GetSubLogger("Formatter")
+
+	if format.maxBytes <= 0 {
+		conf.Errors.Pushf("MaxBytes must be greater than 0")
+	}
+
+	format.chunkStreamID = core.InvalidStreamID
+	if chunkStream := conf.GetString("ChunkStream", ""); chunkStream != "" {
+		format.chunkStreamID = core.GetStreamID(chunkStream)
+	}
+
+	format.emit = format.routeChunk
+}
+
+// SetLogger sets the scoped logger to be used for this formatter
+func (format *Chunk) SetLogger(logger logrus.FieldLogger) {
+	format.Logger = logger
+}
+
+// Modulate splits the payload of the given message if it exceeds MaxBytes.
+func (format *Chunk) Modulate(msg *core.Message) core.ModulateResult {
+	if len(msg.GetPayload()) <= format.maxBytes {
+		return core.ModulateResultContinue // ### return, small enough ###
+	}
+
+	id, err := newRandomID(8)
+	if err != nil {
+		format.Logger.WithError(err).Error("Failed to generate chunk id")
+		return core.ModulateResultFallback
+	}
+
+	chunks := format.split(msg, id)
+	for _, chunk := range chunks[:len(chunks)-1] {
+		format.emit(chunk)
+	}
+	return core.ModulateResultContinue
+}
+
+// split returns one message per chunk. The original message is reused for
+// the last chunk.
+func (format *Chunk) split(msg *core.Message, id string) []*core.Message {
+	// Split a copy as StorePayload may reuse the buffer of the message
+	payload := append([]byte(nil), msg.GetPayload()...)
+	payloads := [][]byte{}
+	for len(payload) > 0 {
+		size := format.getChunkSize(payload)
+		payloads = append(payloads, payload[:size])
+		payload = payload[size:]
+	}
+
+	metadata := msg.GetMetadata()
+	metadata.Set(chunkMetadataID, id)
+	metadata.Set(chunkMetadataCount, strconv.Itoa(len(payloads)))
+
+	// Store the last chunk first so that cloning does not copy the complete
+	// payload for each chunk.
+	lastIdx := len(payloads) - 1
+	msg.StorePayload(payloads[lastIdx])
+
+	chunks := make([]*core.Message, len(payloads))
+	for i, part := range payloads[:lastIdx] {
+		chunks[i] = msg.Clone()
+		chunks[i].StorePayload(part)
+		chunks[i].GetMetadata().Set(chunkMetadataIndex, strconv.Itoa(i))
+	}
+	metadata.Set(chunkMetadataIndex, strconv.Itoa(lastIdx))
+	chunks[lastIdx] = msg
+	return chunks
+}
+
+// getChunkSize returns the size of the next chunk of the given payload. If
+// RuneBoundaries is set, the chunk ends before an incomplete UTF-8 sequence.
+func (format *Chunk) getChunkSize(payload []byte) int {
+	if len(payload) <= format.maxBytes {
+		return len(payload)
+	}
+
+	size := format.maxBytes
+	if !format.runeBoundaries {
+		return size
+	}
+
+	// Move back to the first byte of the character crossing the boundary.
+	// Stop after UTFMax bytes as the data is not valid UTF-8 in this case.
+	start := size
+	for start > 0 && size-start < utf8.UTFMax && !utf8.RuneStart(payload[start]) {
+		start--
+	}
+
+	if start == 0 || !utf8.RuneStart(payload[start]) {
+		return size // ### return, not a multibyte character or no space ###
+	}
+	if _, runeSize := utf8.DecodeRune(payload[start:]); start+runeSize <= size {
+		return size // ### return, character is not split ###
+	}
+	return start
+}
+
+// routeChunk routes the given chunk to ChunkStream or the stream of the
+// original message.
+func (format *Chunk) routeChunk(chunk *core.Message) {
+	if format.chunkStreamID != core.InvalidStreamID {
+		chunk.SetStreamID(format.chunkStreamID)
+	}
+
+	streamID := chunk.GetStreamID()
+	if streamID == core.InvalidStreamID {
+		format.Logger.Warning("Chunk discarded as the message has no stream. Please set ChunkStream.")
+		core.DiscardMessage(chunk, "format.Chunk", "No stream for chunk")
+		return
+	}
+
+	if err := core.Route(chunk, core.StreamRegistry.GetRouterOrFallback(streamID)); err != nil {
+		format.Logger.WithError(err).Error("Failed to route chunk")
+	}
+}
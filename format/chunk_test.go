@@ -0,0 +1,208 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+// chunkAll modulates the given payload and returns all chunks in order
+func chunkAll(formatter *Chunk, emitted *[]*core.Message, payload string) []*core.Message {
+	*emitted = (*emitted)[:0]
+	msg := core.NewMessage(nil, []byte(payload), nil, core.InvalidStreamID)
+	if formatter.Modulate(msg) != core.ModulateResultContinue {
+		return nil
+	}
+	return append(*emitted, msg)
+}
+
+func TestChunk(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Chunk")
+	config.Override("MaxBytes", 4)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Chunk)
+	expect.True(casted)
+
+	emitted := []*core.Message{}
+	formatter.emit = func(chunk *core.Message) {
+		emitted = append(emitted, chunk)
+	}
+
+	chunks := chunkAll(formatter, &emitted, "abcd")
+	expect.Equal(1, len(chunks))
+	expect.Equal("abcd", chunks[0].String())
+	expect.Nil(chunks[0].TryGetMetadata())
+
+	chunks = chunkAll(formatter, &emitted, "abcdefghij")
+	expect.Equal(3, len(chunks))
+
+	id, _ := chunks[0].GetMetadata().String(chunkMetadataID)
+	expect.Equal(16, len(id))
+
+	for i, payload := range []string{"abcd", "efgh", "ij"} {
+		metadata := chunks[i].GetMetadata()
+		expect.Equal(payload, chunks[i].String())
+		expect.MapEqual(metadata, chunkMetadataID, id)
+		expect.MapEqual(metadata, chunkMetadataIndex, string(rune('0'+i)))
+		expect.MapEqual(metadata, chunkMetadataCount, "3")
+	}
+
+	// Each message gets a new id
+	chunks = chunkAll(formatter, &emitted, "abcdefgh")
+	otherID, _ := chunks[0].GetMetadata().String(chunkMetadataID)
+	expect.True(otherID != id)
+}
+
+func TestChunkRuneBoundaries(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	// 2, 3 and 4 byte characters
+	payload := strings.Repeat("aä€😀", 20)
+
+	for maxBytes := 4; maxBytes <= 12; maxBytes++ {
+		config := core.NewPluginConfig("", "format.Chunk")
+		config.Override("MaxBytes", maxBytes)
+
+		plugin, err := core.NewPluginWithConfig(config)
+		expect.NoError(err)
+
+		formatter, casted := plugin.(*Chunk)
+		expect.True(casted)
+
+		emitted := []*core.Message{}
+		formatter.emit = func(chunk *core.Message) {
+			emitted = append(emitted, chunk)
+		}
+
+		chunks := chunkAll(formatter, &emitted, payload)
+		reassembled := ""
+		for i, chunk := range chunks {
+			expect.True(len(chunk.GetPayload()) <= maxBytes)
+			if i < len(chunks)-1 {
+				expect.True(len(chunk.GetPayload()) > maxBytes-utf8.UTFMax)
+			}
+			expect.True(utf8.Valid(chunk.GetPayload()))
+			reassembled += chunk.String()
+		}
+		expect.Equal(payload, reassembled)
+	}
+
+	// Without rune boundaries, chunks are cut at MaxBytes
+	config := core.NewPluginConfig("", "format.Chunk")
+	config.Override("MaxBytes", 4)
+	config.Override("RuneBoundaries", false)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Chunk)
+	expect.True(casted)
+
+	emitted := []*core.Message{}
+	formatter.emit = func(chunk *core.Message) {
+		emitted = append(emitted, chunk)
+	}
+
+	chunks := chunkAll(formatter, &emitted, "aä€")
+	expect.Equal(2, len(chunks))
+	expect.Equal("aä\xe2", chunks[0].String())
+	expect.Equal("\x82\xac", chunks[1].String())
+}
+
+func TestChunkInvalidUTF8(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Chunk")
+	config.Override("MaxBytes", 4)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Chunk)
+	expect.True(casted)
+
+	emitted := []*core.Message{}
+	formatter.emit = func(chunk *core.Message) {
+		emitted = append(emitted, chunk)
+	}
+
+	// Continuation bytes without a start byte are cut at MaxBytes
+	payload := "\x80\x80\x80\x80\x80\x80"
+	chunks := chunkAll(formatter, &emitted, payload)
+	expect.Equal(2, len(chunks))
+	expect.Equal(payload[:4], chunks[0].String())
+	expect.Equal(payload[4:], chunks[1].String())
+
+	// A character larger than MaxBytes is split
+	config = core.NewPluginConfig("", "format.Chunk")
+	config.Override("MaxBytes", 2)
+
+	plugin, err = core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted = plugin.(*Chunk)
+	expect.True(casted)
+
+	formatter.emit = func(chunk *core.Message) {
+		emitted = append(emitted, chunk)
+	}
+
+	chunks = chunkAll(formatter, &emitted, "😀")
+	expect.Equal(2, len(chunks))
+	expect.Equal("😀", chunks[0].String()+chunks[1].String())
+}
+
+func TestChunkStream(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Chunk")
+	config.Override("MaxBytes", 2)
+	config.Override("ChunkStream", "chunks")
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Chunk)
+	expect.True(casted)
+
+	router := &mockCollapseRepeatsRouter{streamID: core.GetStreamID("chunks")}
+	core.StreamRegistry.Register(router, router.streamID)
+
+	msg := core.NewMessage(nil, []byte("abcde"), nil, core.GetStreamID("chunkInput"))
+	expect.Equal(core.ModulateResultContinue, formatter.Modulate(msg))
+	expect.Equal("e", msg.String())
+	expect.Equal(core.GetStreamID("chunkInput"), msg.GetStreamID())
+
+	expect.Equal(2, len(router.enqueued))
+	expect.Equal("ab", router.enqueued[0].String())
+	expect.Equal("cd", router.enqueued[1].String())
+	expect.Equal(router.streamID, router.enqueued[0].GetStreamID())
+	expect.MapEqual(router.enqueued[1].GetMetadata(), chunkMetadataIndex, "1")
+
+	config = core.NewPluginConfig("", "format.Chunk")
+	config.Override("MaxBytes", 0)
+	_, err = core.NewPluginWithConfig(config)
+	expect.NotNil(err)
+}
@@ -0,0 +1,93 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package format
+
+import (
+	"gollum/core"
+)
+
+// Coalesce formatter
+//
+// This formatter sets a field to the first non-empty value found in a list
+// of other fields. This is useful to normalize logs where a value may appear
+// under different keys. Fields that do not exist or contain an empty string,
+// an empty list or an empty map are skipped.
+//
+// Parameters
+//
+// - Sources: Defines the list of fields to read from, in order of precedence.
+// Use "" to read from the message payload. Fields can be paths like "a/b".
+// By default this parameter is set to an empty list.
+//
+// - Default: Defines the value written to Target if all fields listed in
+// Sources are empty. If not set, Target is not changed in this case.
+// By default this parameter is set to "".
+//
+// Examples
+//
+// This example parses the payload as JSON and stores the client's IP address
+// in the field "client_ip", regardless of which key it was logged with.
+//
+//  exampleConsumer:
+//    Type: consumer.Console
+//    Streams: stdin
+//    Modulators:
+//      - format.JSON
+//      - format.Coalesce:
+//        Target: client_ip
+//        Sources:
+//          - client_ip
+//          - remote_addr
+//          - request/headers/x-forwarded-for
+//        Default: unknown
+type Coalesce struct {
+	core.SimpleFormatter `gollumdoc:"embed_type"`
+	defaultValue         string `config:"Default"`
+	getters              []core.GetDataFunc
+}
+
+func init() {
+	core.TypeRegistry.Register(Coalesce{})
+}
+
+// Configure initializes this formatter with values from a plugin config.
+func (format *Coalesce) Configure(conf core.PluginConfigReader) {
+	sources := conf.GetStringArray("Sources", []string{})
+	format.getters = make([]core.GetDataFunc, 0, len(sources))
+	for _, source := range sources {
+		format.getters = append(format.getters, core.NewGetterFor(source))
+	}
+}
+
+// ApplyFormatter update message payload
+func (format *Coalesce) ApplyFormatter(msg *core.Message) error {
+	for _, getSource := range format.getters {
+		if value := getSource(msg); !isEmptyValue(value) {
+			format.SetTargetData(msg, value)
+			return nil // ### return, found value ###
+		}
+	}
+
+	switch {
+	case format.defaultValue == "":
+		// Keep target as it is
+	case format.TargetIsMetadata():
+		format.SetTargetData(msg, format.defaultValue)
+	default:
+		format.SetTargetData(msg, []byte(format.defaultValue))
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestCoalesceFirstMatch(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Coalesce")
+	config.Override("Target", "ip")
+	config.Override("Sources", []string{"client_ip", "remote_addr", "headers/x-forwarded-for"})
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Coalesce)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("test"), tcontainer.MarshalMap{
+		"client_ip":   "",
+		"remote_addr": "10.0.0.1",
+		"headers": tcontainer.MarshalMap{
+			"x-forwarded-for": "10.0.0.2",
+		},
+	}, core.InvalidStreamID)
+
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal("10.0.0.1", msg.GetMetadata()["ip"])
+
+	msg = core.NewMessage(nil, []byte("test"), tcontainer.MarshalMap{
+		"headers": tcontainer.MarshalMap{
+			"x-forwarded-for": "10.0.0.2",
+		},
+	}, core.InvalidStreamID)
+
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal("10.0.0.2", msg.GetMetadata()["ip"])
+}
+
+func TestCoalesceNoMatch(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Coalesce")
+	config.Override("Target", "ip")
+	config.Override("Sources", []string{"client_ip", "remote_addr"})
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Coalesce)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("test"), tcontainer.MarshalMap{
+		"ip":        "10.0.0.3",
+		"client_ip": "",
+	}, core.InvalidStreamID)
+
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal("10.0.0.3", msg.GetMetadata()["ip"])
+
+	config = core.NewPluginConfig("", "format.Coalesce")
+	config.Override("Target", "ip")
+	config.Override("Sources", []string{"client_ip", "remote_addr"})
+	config.Override("Default", "unknown")
+
+	plugin, err = core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted = plugin.(*Coalesce)
+	expect.True(casted)
+
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal("unknown", msg.GetMetadata()["ip"])
+}
+
+func TestCoalescePayload(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Coalesce")
+	config.Override("Sources", []string{"message", "msg"})
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Coalesce)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte(""), tcontainer.MarshalMap{
+		"msg": "hello",
+	}, core.InvalidStreamID)
+
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal("hello", msg.String())
+}
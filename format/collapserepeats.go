@@ -0,0 +1,238 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"gollum/core"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CollapseRepeats formatter plugin
+//
+// CollapseRepeats suppresses consecutive messages with identical payloads
+// like syslog does for repeated log lines. The first message of a run is
+// passed along, all following identical messages are discarded. When the
+// run ends, i.e. a different message arrives or WindowMs have passed since
+// the first message of the run, a summary message "last message repeated N
+// times" is emitted. If a message is not repeated, no summary is emitted.
+//
+// The summary message is a copy of the last repeated message with the
+// payload replaced and the metadata field "repeated" set to N. It is routed
+// to SummaryStream or, if not set, to the stream the repeated messages were
+// in. The summary passes the router of this stream and all modulators
+// following it like any other message. Messages carrying a "repeated"
+// metadata field pass this plugin without affecting the current run, so
+// that summaries are never collapsed.
+//
+// Runs ending because of a different message are emitted before the
+// message ending the run is passed along. Summaries routed to a stream with
+// Ordering set to "strict" are routed asynchronously, as the stream might be
+// locked by the message ending the run. In this case the summary follows the
+// message ending the run. Please note that runs are tracked per plugin
+// instance, so messages of all streams passing this plugin are compared with
+// each other.
+//
+// Metadata
+//
+// - repeated: Set to the number of suppressed messages on summary messages
+//
+// Parameters
+//
+// - KeyFrom: Defines the metadata field to compare. When left empty, the
+// payload is compared.
+// By default this parameter is set to "".
+//
+// - WindowMs: Defines the maximum duration of a run in milliseconds. The
+// summary of a run is emitted after this time even if the message is still
+// repeated. The next repeated message will then start a new run.
+// By default this parameter is set to "30000".
+//
+// - SummaryStream: Defines the stream summary messages are routed to. This
+// parameter is required when this plugin is used as a consumer modulator as
+// consumers assign streams after modulating.
+// By default this parameter is set to "".
+//
+// Examples
+//
+// This example collapses repeated lines of a flapping service and sends
+// summaries to the same stream as the original lines:
+//
+//  ExampleConsumer:
+//    Type: consumer.Console
+//    Streams: "logs"
+//    Modulators:
+//      - format.CollapseRepeats:
+//          WindowMs: 10000
+//          SummaryStream: logs
+type CollapseRepeats struct {
+	Logger          logrus.FieldLogger
+	window          time.Duration `config:"WindowMs" default:"30000" metric:"ms"`
+	summaryStreamID core.MessageStreamID
+	getKey          core.GetDataAsBytesFunc
+	guard           *sync.Mutex
+	run             *collapseRun
+	now             func() time.Time
+	emit            func(summary *core.Message)
+}
+
+// collapseRun holds the state of a sequence of identical messages
+type collapseRun struct {
+	key      string
+	start    time.Time
+	repeated int
+	template *core.Message
+	timer    *time.Timer
+}
+
+const collapseRepeatsMetadata = "repeated"
+
+func init() {
+	core.TypeRegistry.Register(CollapseRepeats{})
+}
+
+// Configure initializes this formatter with values from a plugin config.
+func (format *CollapseRepeats) Configure(conf core.PluginConfigReader) {
+	format.Logger = conf.GetSubLogger("Formatter")
+
+	if format.window <= 0 {
+		conf.Errors.Pushf("WindowMs must be greater than 0")
+	}
+
+	format.summaryStreamID = core.InvalidStreamID
+	if summaryStream := conf.GetString("SummaryStream", ""); summaryStream != "" {
+		format.summaryStreamID = core.GetStreamID(summaryStream)
+	}
+
+	format.getKey = core.NewBytesGetterFor(conf.GetString("KeyFrom", ""))
+	format.guard = new(sync.Mutex)
+	format.now = time.Now
+	format.emit = format.routeSummary
+}
+
+// SetLogger sets the scoped logger to be used for this formatter
+func (format *CollapseRepeats) SetLogger(logger logrus.FieldLogger) {
+	format.Logger = logger
+}
+
+// Modulate discards the given message if it repeats the current run and
+// emits the summary of the previous run if the message starts a new one.
+func (format *CollapseRepeats) Modulate(msg *core.Message) core.ModulateResult {
+	if _, isSummary := msg.TryGetMetadata()[collapseRepeatsMetadata]; isSummary {
+		return core.ModulateResultContinue // ### return, never collapse summaries ###
+	}
+
+	key := string(format.getKey(msg))
+	isRepeated, summary := format.track(key, msg)
+
+	if summary != nil {
+		format.emit(summary)
+	}
+	if isRepeated {
+		return core.ModulateResultDiscard
+	}
+	return core.ModulateResultContinue
+}
+
+// track adds the given message to the current run or starts a new run.
+// It returns true if the message is repeated and the summary of the run
+// that ended, if any.
+func (format *CollapseRepeats) track(key string, msg *core.Message) (bool, *core.Message) {
+	format.guard.Lock()
+	defer format.guard.Unlock()
+
+	now := format.now()
+	run := format.run
+
+	if run != nil && run.key == key && now.Sub(run.start) < format.window {
+		if run.repeated == 0 {
+			run.timer = time.AfterFunc(format.window-now.Sub(run.start), func() {
+				format.onTimeout(run)
+			})
+		}
+		run.repeated++
+		run.template = msg.Clone()
+		return true, nil
+	}
+
+	format.run = &collapseRun{
+		key:   key,
+		start: now,
+	}
+	return false, format.endRun(run)
+}
+
+// onTimeout ends the given run if it is still the current one.
+func (format *CollapseRepeats) onTimeout(run *collapseRun) {
+	format.guard.Lock()
+	if format.run != run {
+		format.guard.Unlock()
+		return // ### return, run already ended ###
+	}
+	format.run = nil
+	summary := format.endRun(run)
+	format.guard.Unlock()
+
+	if summary != nil {
+		format.emit(summary)
+	}
+}
+
+// endRun stops the timer of the given run and returns its summary message
+// or nil if no message was repeated. Expects guard to be locked.
+func (format *CollapseRepeats) endRun(run *collapseRun) *core.Message {
+	if run == nil || run.repeated == 0 {
+		return nil
+	}
+	run.timer.Stop()
+
+	summary := run.template
+	summary.StorePayload([]byte(fmt.Sprintf("last message repeated %d times", run.repeated)))
+	summary.GetMetadata().Set(collapseRepeatsMetadata, strconv.Itoa(run.repeated))
+	return summary
+}
+
+// routeSummary routes the given summary message to SummaryStream or the
+// stream of the repeated messages.
+func (format *CollapseRepeats) routeSummary(summary *core.Message) {
+	if format.summaryStreamID != core.InvalidStreamID {
+		summary.SetStreamID(format.summaryStreamID)
+	}
+
+	streamID := summary.GetStreamID()
+	if streamID == core.InvalidStreamID {
+		format.Logger.Warning("Summary discarded as the message has no stream. Please set SummaryStream.")
+		core.DiscardMessage(summary, "format.CollapseRepeats", "No stream for summary")
+		return
+	}
+
+	router := core.StreamRegistry.GetRouterOrFallback(streamID)
+	if core.IsOrderedRouter(router) {
+		go format.route(summary, router)
+	} else {
+		format.route(summary, router)
+	}
+}
+
+func (format *CollapseRepeats) route(summary *core.Message, router core.Router) {
+	if err := core.Route(summary, router); err != nil {
+		format.Logger.WithError(err).Error("Failed to route summary")
+	}
+}
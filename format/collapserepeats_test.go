@@ -0,0 +1,324 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+type collapseRepeatsSink struct {
+	guard     sync.Mutex
+	summaries []*core.Message
+}
+
+func (sink *collapseRepeatsSink) emit(summary *core.Message) {
+	sink.guard.Lock()
+	defer sink.guard.Unlock()
+	sink.summaries = append(sink.summaries, summary)
+}
+
+func (sink *collapseRepeatsSink) get() []*core.Message {
+	sink.guard.Lock()
+	defer sink.guard.Unlock()
+	return append([]*core.Message{}, sink.summaries...)
+}
+
+func newTestCollapseRepeats(t *testing.T, config core.PluginConfig) (*CollapseRepeats, *collapseRepeatsSink) {
+	expect := ttesting.NewExpect(t)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*CollapseRepeats)
+	expect.True(casted)
+
+	sink := &collapseRepeatsSink{}
+	formatter.emit = sink.emit
+	return formatter, sink
+}
+
+func TestCollapseRepeatsRunBoundaries(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.CollapseRepeats")
+	formatter, sink := newTestCollapseRepeats(t, config)
+
+	now := time.Unix(0, 0)
+	formatter.now = func() time.Time { return now }
+
+	modulate := func(payload string) core.ModulateResult {
+		msg := core.NewMessage(nil, []byte(payload), nil, core.InvalidStreamID)
+		return formatter.Modulate(msg)
+	}
+
+	// A single message does not start a run
+	expect.Equal(core.ModulateResultContinue, modulate("a"))
+	expect.Equal(core.ModulateResultContinue, modulate("b"))
+	expect.Equal(0, len(sink.get()))
+
+	// Repeats are discarded and summarized when a different message arrives
+	expect.Equal(core.ModulateResultDiscard, modulate("b"))
+	expect.Equal(core.ModulateResultDiscard, modulate("b"))
+	expect.Equal(0, len(sink.get()))
+
+	expect.Equal(core.ModulateResultContinue, modulate("c"))
+	summaries := sink.get()
+	expect.Equal(1, len(summaries))
+	expect.Equal("last message repeated 2 times", summaries[0].String())
+	expect.Equal("2", summaries[0].GetMetadata()["repeated"])
+
+	// A message equal to the message before the last run is not a repeat
+	expect.Equal(core.ModulateResultContinue, modulate("b"))
+	expect.Equal(1, len(sink.get()))
+}
+
+func TestCollapseRepeatsWindow(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.CollapseRepeats")
+	config.Override("WindowMs", 1000)
+	formatter, sink := newTestCollapseRepeats(t, config)
+
+	now := time.Unix(0, 0)
+	formatter.now = func() time.Time { return now }
+
+	modulate := func(payload string) core.ModulateResult {
+		msg := core.NewMessage(nil, []byte(payload), nil, core.InvalidStreamID)
+		return formatter.Modulate(msg)
+	}
+
+	expect.Equal(core.ModulateResultContinue, modulate("a"))
+	now = now.Add(999 * time.Millisecond)
+	expect.Equal(core.ModulateResultDiscard, modulate("a"))
+
+	// The window is measured from the first message of the run
+	now = now.Add(time.Millisecond)
+	expect.Equal(core.ModulateResultContinue, modulate("a"))
+
+	summaries := sink.get()
+	expect.Equal(1, len(summaries))
+	expect.Equal("last message repeated 1 times", summaries[0].String())
+
+	// A run without repeats ends without a summary
+	now = now.Add(time.Second)
+	expect.Equal(core.ModulateResultContinue, modulate("a"))
+	expect.Equal(1, len(sink.get()))
+}
+
+func TestCollapseRepeatsTimeout(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.CollapseRepeats")
+	config.Override("WindowMs", 20)
+	formatter, sink := newTestCollapseRepeats(t, config)
+
+	msg := core.NewMessage(nil, []byte("a"), nil, core.InvalidStreamID)
+	expect.Equal(core.ModulateResultContinue, formatter.Modulate(msg.Clone()))
+	expect.Equal(core.ModulateResultDiscard, formatter.Modulate(msg.Clone()))
+	expect.Equal(core.ModulateResultDiscard, formatter.Modulate(msg.Clone()))
+
+	for start := time.Now(); len(sink.get()) == 0 && time.Since(start) < time.Second; {
+		time.Sleep(time.Millisecond)
+	}
+	expect.Equal(1, len(sink.get()))
+	expect.Equal("last message repeated 2 times", sink.get()[0].String())
+
+	// After a timeout the next message starts a new run
+	expect.Equal(core.ModulateResultContinue, formatter.Modulate(msg.Clone()))
+	time.Sleep(40 * time.Millisecond)
+	expect.Equal(1, len(sink.get()))
+}
+
+func TestCollapseRepeatsKeyFrom(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.CollapseRepeats")
+	config.Override("KeyFrom", "host")
+	formatter, sink := newTestCollapseRepeats(t, config)
+
+	modulate := func(payload, host string) core.ModulateResult {
+		msg := core.NewMessage(nil, []byte(payload), tcontainer.MarshalMap{"host": host}, core.InvalidStreamID)
+		return formatter.Modulate(msg)
+	}
+
+	expect.Equal(core.ModulateResultContinue, modulate("a", "web1"))
+	expect.Equal(core.ModulateResultDiscard, modulate("b", "web1"))
+	expect.Equal(core.ModulateResultContinue, modulate("a", "web2"))
+
+	summaries := sink.get()
+	expect.Equal(1, len(summaries))
+	expect.Equal("web1", summaries[0].GetMetadata()["host"])
+}
+
+func TestCollapseRepeatsIgnoresSummaries(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.CollapseRepeats")
+	formatter, sink := newTestCollapseRepeats(t, config)
+
+	// Summaries passing the formatter again must not end the current run
+	formatter.emit = func(summary *core.Message) {
+		sink.emit(summary)
+		expect.Equal(core.ModulateResultContinue, formatter.Modulate(summary))
+	}
+
+	modulate := func(payload string) core.ModulateResult {
+		msg := core.NewMessage(nil, []byte(payload), nil, core.InvalidStreamID)
+		return formatter.Modulate(msg)
+	}
+
+	expect.Equal(core.ModulateResultContinue, modulate("a"))
+	expect.Equal(core.ModulateResultDiscard, modulate("a"))
+	expect.Equal(core.ModulateResultContinue, modulate("b"))
+	expect.Equal(core.ModulateResultDiscard, modulate("b"))
+	expect.Equal(1, len(sink.get()))
+}
+
+func TestCollapseRepeatsSummaryStream(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.CollapseRepeats")
+	config.Override("SummaryStream", "collapseSummaries")
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*CollapseRepeats)
+	expect.True(casted)
+
+	core.StreamRegistry.Register(&mockCollapseRepeatsRouter{
+		streamID: core.GetStreamID("collapseSummaries"),
+	}, core.GetStreamID("collapseSummaries"))
+
+	router := core.StreamRegistry.GetRouterOrFallback(core.GetStreamID("collapseSummaries")).(*mockCollapseRepeatsRouter)
+	router.enqueued = nil
+
+	msg := core.NewMessage(nil, []byte("a"), nil, core.GetStreamID("collapseInput"))
+	expect.Equal(core.ModulateResultContinue, formatter.Modulate(msg.Clone()))
+	expect.Equal(core.ModulateResultDiscard, formatter.Modulate(msg.Clone()))
+	expect.Equal(core.ModulateResultContinue, formatter.Modulate(core.NewMessage(nil, []byte("b"), nil, msg.GetStreamID())))
+
+	expect.Equal(1, len(router.enqueued))
+	expect.Equal("last message repeated 1 times", router.enqueued[0].String())
+	expect.Equal(router.streamID, router.enqueued[0].GetStreamID())
+}
+
+type mockCollapseRepeatsRouter struct {
+	streamID core.MessageStreamID
+	enqueued []*core.Message
+}
+
+func (router *mockCollapseRepeatsRouter) Modulate(msg *core.Message) core.ModulateResult {
+	return core.ModulateResultContinue
+}
+
+func (router *mockCollapseRepeatsRouter) GetStreamID() core.MessageStreamID {
+	return router.streamID
+}
+
+func (router *mockCollapseRepeatsRouter) GetID() string {
+	return "mockCollapseRepeatsRouter"
+}
+
+func (router *mockCollapseRepeatsRouter) AddProducer(producers ...core.Producer) {
+}
+
+func (router *mockCollapseRepeatsRouter) Enqueue(msg *core.Message) error {
+	router.enqueued = append(router.enqueued, msg)
+	return nil
+}
+
+func (router *mockCollapseRepeatsRouter) GetTimeout() time.Duration {
+	return time.Second
+}
+
+func (router *mockCollapseRepeatsRouter) Start() error {
+	return nil
+}
+
+type mockOrderedCollapseRepeatsRouter struct {
+	core.SimpleRouter `gollumdoc:"embed_type"`
+	formatter         *CollapseRepeats
+	enqueued          chan string
+}
+
+// Enqueue applies the formatter like a producer's modulators would do.
+func (router *mockOrderedCollapseRepeatsRouter) Enqueue(msg *core.Message) error {
+	if router.formatter.Modulate(msg) == core.ModulateResultContinue {
+		router.enqueued <- msg.String()
+	}
+	return nil
+}
+
+func (router *mockOrderedCollapseRepeatsRouter) Start() error {
+	return nil
+}
+
+func TestCollapseRepeatsStrictOrdering(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	core.TypeRegistry.Register(mockOrderedCollapseRepeatsRouter{})
+
+	config := core.NewPluginConfig("", "format.mockOrderedCollapseRepeatsRouter")
+	config.Override("Stream", "collapseOrdered")
+	config.Override("Ordering", "strict")
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	router, casted := plugin.(*mockOrderedCollapseRepeatsRouter)
+	expect.True(casted)
+
+	plugin, err = core.NewPluginWithConfig(core.NewPluginConfig("", "format.CollapseRepeats"))
+	expect.NoError(err)
+
+	router.formatter, casted = plugin.(*CollapseRepeats)
+	expect.True(casted)
+	router.enqueued = make(chan string, 3)
+	core.StreamRegistry.Register(router, router.GetStreamID())
+
+	// The summary is routed to the stream locked by the message ending the
+	// run, so it has to be routed asynchronously.
+	routed := make(chan struct{})
+	go func() {
+		for _, payload := range []string{"a", "a", "b"} {
+			core.Route(core.NewMessage(nil, []byte(payload), nil, router.GetStreamID()), router)
+		}
+		close(routed)
+	}()
+
+	select {
+	case <-routed:
+	case <-time.After(time.Second):
+		expect.NoError(fmt.Errorf("routing blocked"))
+		return
+	}
+
+	expected := []string{"a", "b", "last message repeated 1 times"}
+	for _, payload := range expected {
+		select {
+		case enqueued := <-router.enqueued:
+			expect.Equal(payload, enqueued)
+		case <-time.After(time.Second):
+			expect.NoError(fmt.Errorf("%s has not been routed", payload))
+			return
+		}
+	}
+}
@@ -32,7 +32,10 @@ import (
 //
 // - Source: Defines the key to copy, i.e. the "source" of a copy operation.
 // Target will define the target of the copy, i.e. the "destination".
-// An empty string will use the message payload as source.
+// An empty string will use the message payload as source. The key can be a
+// path like "a/b[0]/c" to copy a nested value, e.g. to lift it to the top
+// level. Combine this with SkipIfEmpty to ignore messages where the path
+// does not exist.
 // By default this parameter is set to an empty string (i.e. payload).
 //
 // - Mode: Defines the copy mode to use. This can be one of "append",
@@ -58,6 +61,19 @@ import (
 //        Generator: hash
 //        Target: key
 //
+// This example parses a JSON payload into metadata and lifts the nested value
+// found at "request/headers[0]/host" to the top level field "host".
+//
+//  exampleConsumer:
+//    Type: consumer.Console
+//    Streams: "*"
+//    Modulators:
+//      - format.JSON
+//      - format.Copy:
+//          Source: request/headers[0]/host
+//          Target: host
+//          SkipIfEmpty: true
+//
 type Copy struct {
 	core.SimpleFormatter `gollumdoc:"embed_type"`
 	separator            []byte `config:"Separator"`
@@ -171,3 +171,42 @@ func TestCopyPayloadIntegrity(t *testing.T) {
 	expect.Equal("metadata", msg.String())
 	expect.Equal("xxx", string(foo))
 }
+
+func TestCopyNestedPath(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Copy")
+	config.Override("Source", "request/headers[1]/host")
+	config.Override("Target", "host")
+	config.Override("SkipIfEmpty", true)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Copy)
+	expect.True(casted)
+	modulator := core.NewFormatterModulator(formatter)
+
+	metadata := tcontainer.MarshalMap{
+		"request": tcontainer.MarshalMap{
+			"headers": []interface{}{
+				tcontainer.MarshalMap{"host": "first"},
+				tcontainer.MarshalMap{"host": "second"},
+			},
+		},
+	}
+	msg := core.NewMessage(nil, []byte("payload"), metadata, core.InvalidStreamID)
+
+	expect.Equal(core.ModulateResultContinue, modulator.Modulate(msg))
+	host, err := msg.GetMetadata().String("host")
+	expect.NoError(err)
+	expect.Equal("second", host)
+
+	// Missing paths leave the message unchanged
+	msg = core.NewMessage(nil, []byte("payload"), tcontainer.MarshalMap{"request": tcontainer.MarshalMap{}}, core.InvalidStreamID)
+
+	expect.Equal(core.ModulateResultContinue, modulator.Modulate(msg))
+	_, exists := msg.GetMetadata().Value("host")
+	expect.False(exists)
+	expect.Equal("payload", msg.String())
+}
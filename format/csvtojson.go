@@ -0,0 +1,229 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"gollum/core"
+)
+
+// CSVToJSON formatter
+//
+// CSVToJSON parses a CSV line and converts it to a JSON object that maps the
+// column names to the values of the line. Values are always written as
+// strings and columns keep their order.
+//
+// Parameters
+//
+// - Delimiter: Defines the character separating two values.
+// By default this parameter is set to ",".
+//
+// - Quote: Defines the character used to quote values. Quoted values may
+// contain the delimiter. A quote character inside a quoted value has to be
+// doubled. Set to "" to disable quoting.
+// By default this parameter is set to "\"".
+//
+// - Columns: Defines the list of column names. If this list is empty,
+// HeaderLine is always enabled.
+// By default this parameter is set to an empty list.
+//
+// - HeaderLine: When set to true, the first message of each stream is used as
+// header, i.e. the list of column names. This message is discarded. Columns is
+// ignored in this case.
+// By default this parameter is set to false.
+//
+// - ErrorField: Defines a metadata field to store an error message in if a
+// line does not have as many values as there are columns. The message is
+// left unchanged in this case. If this parameter is set to "" such messages
+// are discarded.
+// By default this parameter is set to "".
+//
+// Examples
+//
+// This example converts CSV lines read from a file with a header line to JSON.
+//
+//  ExampleConsumer:
+//    Type: consumer.File
+//    Streams: csv
+//    Files: /var/log/export.csv
+//    Modulators:
+//      - format.CSVToJSON:
+//          Delimiter: ";"
+//          HeaderLine: true
+//          ErrorField: csv_error
+//
+type CSVToJSON struct {
+	core.SimpleFormatter `gollumdoc:"embed_type"`
+	columns              []string `config:"Columns"`
+	useHeader            bool     `config:"HeaderLine" default:"false"`
+	errorField           string   `config:"ErrorField"`
+	delimiter            rune
+	quote                rune
+	headers              map[core.MessageStreamID][]string
+	headerGuard          *sync.Mutex
+}
+
+func init() {
+	core.TypeRegistry.Register(CSVToJSON{})
+}
+
+// Configure initializes this formatter with values from a plugin config.
+func (format *CSVToJSON) Configure(conf core.PluginConfigReader) {
+	format.delimiter = format.getRune(conf, "Delimiter", ",")
+	format.quote = format.getRune(conf, "Quote", "\"")
+	format.headers = make(map[core.MessageStreamID][]string)
+	format.headerGuard = new(sync.Mutex)
+
+	if format.delimiter == 0 {
+		conf.Errors.Pushf("Delimiter must not be empty")
+	}
+	if format.delimiter == format.quote {
+		conf.Errors.Pushf("Delimiter and Quote must be different characters")
+	}
+	if len(format.columns) == 0 {
+		format.useHeader = true
+	}
+}
+
+func (format *CSVToJSON) getRune(conf core.PluginConfigReader, key string, defaultValue string) rune {
+	value := conf.GetString(key, defaultValue)
+	if value == "" {
+		return 0
+	}
+	if utf8.RuneCountInString(value) != 1 {
+		conf.Errors.Pushf("%s must be a single character", key)
+	}
+	char, _ := utf8.DecodeRuneInString(value)
+	return char
+}
+
+// ApplyFormatter update message payload
+func (format *CSVToJSON) ApplyFormatter(msg *core.Message) error {
+	line := strings.TrimRight(format.GetSourceDataAsString(msg), "\r\n")
+	values, err := splitCSVLine(line, format.delimiter, format.quote)
+	if err != nil {
+		return format.handleInvalidLine(msg, err)
+	}
+
+	columns := format.columns
+	if format.useHeader {
+		var isHeader bool
+		if columns, isHeader = format.getOrStoreHeader(msg.GetStreamID(), values); isHeader {
+			return fmt.Errorf("stored CSV header for stream %s", core.StreamRegistry.GetStreamName(msg.GetStreamID()))
+		}
+	}
+
+	if len(values) != len(columns) {
+		return format.handleInvalidLine(msg, fmt.Errorf("expected %d values, got %d", len(columns), len(values)))
+	}
+
+	format.SetTargetData(msg, format.toJSON(columns, values))
+	return nil
+}
+
+// getOrStoreHeader returns the header of the given stream. If there is no
+// header for this stream yet, values is stored as header and true is returned.
+func (format *CSVToJSON) getOrStoreHeader(streamID core.MessageStreamID, values []string) ([]string, bool) {
+	format.headerGuard.Lock()
+	defer format.headerGuard.Unlock()
+
+	if header, exists := format.headers[streamID]; exists {
+		return header, false
+	}
+	format.headers[streamID] = values
+	return values, true
+}
+
+func (format *CSVToJSON) handleInvalidLine(msg *core.Message, err error) error {
+	format.Logger.WithError(err).Warning("Invalid CSV line")
+	if format.errorField == "" {
+		return err
+	}
+	msg.GetMetadata().Set(format.errorField, err.Error())
+	return nil
+}
+
+func (format *CSVToJSON) toJSON(columns []string, values []string) []byte {
+	buffer := bytes.NewBufferString("{")
+	for i, column := range columns {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+		key, _ := json.Marshal(column)
+		value, _ := json.Marshal(values[i])
+		buffer.Write(key)
+		buffer.WriteByte(':')
+		buffer.Write(value)
+	}
+	buffer.WriteByte('}')
+	return buffer.Bytes()
+}
+
+// splitCSVLine splits a line into values. Values starting with quote may
+// contain the delimiter and doubled quotes. Passing 0 as quote disables
+// quoting.
+func splitCSVLine(line string, delimiter rune, quote rune) ([]string, error) {
+	values := []string{}
+	value := strings.Builder{}
+	inQuotes := false
+	atValueStart := true
+	afterQuotes := false
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		char := runes[i]
+		switch {
+		case inQuotes && char == quote:
+			if i+1 < len(runes) && runes[i+1] == quote {
+				value.WriteRune(quote)
+				i++
+			} else {
+				inQuotes = false
+				afterQuotes = true
+			}
+
+		case inQuotes:
+			value.WriteRune(char)
+
+		case char == delimiter:
+			values = append(values, value.String())
+			value.Reset()
+			atValueStart = true
+			afterQuotes = false
+
+		case afterQuotes:
+			return nil, fmt.Errorf("unexpected character %q after quoted value at position %d", char, i)
+
+		case atValueStart && quote != 0 && char == quote:
+			inQuotes = true
+			atValueStart = false
+
+		default:
+			value.WriteRune(char)
+			atValueStart = false
+		}
+	}
+
+	if inQuotes {
+		return nil, fmt.Errorf("missing closing quote")
+	}
+	return append(values, value.String()), nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestCSVToJSON(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.CSVToJSON")
+	config.Override("Columns", []string{"name", "city", "comment"})
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*CSVToJSON)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte(`alice,"Berlin, Germany","says ""hi"""`+"\n"), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal(`{"name":"alice","city":"Berlin, Germany","comment":"says \"hi\""}`, msg.String())
+
+	msg = core.NewMessage(nil, []byte(`bob,,`), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal(`{"name":"bob","city":"","comment":""}`, msg.String())
+}
+
+func TestCSVToJSONDelimiterAndQuote(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.CSVToJSON")
+	config.Override("Columns", []string{"a", "b"})
+	config.Override("Delimiter", ";")
+	config.Override("Quote", "'")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*CSVToJSON)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte(`'x;y';"z"`), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal(`{"a":"x;y","b":"\"z\""}`, msg.String())
+}
+
+func TestCSVToJSONHeaderLine(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.CSVToJSON")
+	config.Override("HeaderLine", true)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*CSVToJSON)
+	expect.True(casted)
+
+	header := core.NewMessage(nil, []byte("id,value"), nil, 1)
+	expect.NotNil(formatter.ApplyFormatter(header))
+
+	msg := core.NewMessage(nil, []byte("1,foo"), nil, 1)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal(`{"id":"1","value":"foo"}`, msg.String())
+
+	// Each stream has its own header
+	header = core.NewMessage(nil, []byte("key"), nil, 2)
+	expect.NotNil(formatter.ApplyFormatter(header))
+
+	msg = core.NewMessage(nil, []byte("bar"), nil, 2)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal(`{"key":"bar"}`, msg.String())
+}
+
+func TestCSVToJSONColumnMismatch(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.CSVToJSON")
+	config.Override("Columns", []string{"a", "b"})
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*CSVToJSON)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("1,2,3"), nil, core.InvalidStreamID)
+	expect.NotNil(formatter.ApplyFormatter(msg))
+
+	config = core.NewPluginConfig("", "format.CSVToJSON")
+	config.Override("Columns", []string{"a", "b"})
+	config.Override("ErrorField", "error")
+
+	plugin, err = core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted = plugin.(*CSVToJSON)
+	expect.True(casted)
+
+	msg = core.NewMessage(nil, []byte("1,2,3"), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal("1,2,3", msg.String())
+
+	errorMsg, err := msg.GetMetadata().String("error")
+	expect.NoError(err)
+	expect.Equal("expected 2 values, got 3", errorMsg)
+}
+
+func TestSplitCSVLine(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	values, err := splitCSVLine(`a,"b,c",d`, ',', '"')
+	expect.NoError(err)
+	expect.Equal([]string{"a", "b,c", "d"}, values)
+
+	values, err = splitCSVLine(`a,"b,c",d`, ',', 0)
+	expect.NoError(err)
+	expect.Equal([]string{"a", `"b`, `c"`, "d"}, values)
+
+	values, err = splitCSVLine(``, ',', '"')
+	expect.NoError(err)
+	expect.Equal([]string{""}, values)
+
+	_, err = splitCSVLine(`a,"b`, ',', '"')
+	expect.NotNil(err)
+
+	_, err = splitCSVLine(`a,"b"c`, ',', '"')
+	expect.NotNil(err)
+}
@@ -0,0 +1,94 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package format
+
+import (
+	"reflect"
+
+	"gollum/core"
+)
+
+// Default formatter
+//
+// This formatter sets a field to a constant value if the field does not
+// exist or is empty, e.g. to normalize logs where a field is optional.
+// Fields containing an empty string, an empty list or an empty map are
+// treated as empty. Existing values are never changed.
+//
+// Parameters
+//
+// - Value: Defines the value written to Target if Target is empty.
+// By default this parameter is set to "".
+//
+// Examples
+//
+// This example parses the payload as JSON and sets the field "level" to
+// "info" for all messages that do not define a level.
+//
+//  exampleConsumer:
+//    Type: consumer.Console
+//    Streams: stdin
+//    Modulators:
+//      - format.JSON
+//      - format.Default:
+//        Target: level
+//        Value: info
+type Default struct {
+	core.SimpleFormatter `gollumdoc:"embed_type"`
+	value                string `config:"Value"`
+}
+
+func init() {
+	core.TypeRegistry.Register(Default{})
+}
+
+// Configure initializes this formatter with values from a plugin config.
+func (format *Default) Configure(conf core.PluginConfigReader) {
+}
+
+// isEmptyValue returns true if the given value is nil, an empty string or
+// an empty slice, array or map.
+func isEmptyValue(data interface{}) bool {
+	switch value := data.(type) {
+	case nil:
+		return true
+	case []byte:
+		return len(value) == 0
+	case string:
+		return len(value) == 0
+	}
+
+	value := reflect.ValueOf(data)
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return value.Len() == 0
+	}
+	return false
+}
+
+// ApplyFormatter update message payload
+func (format *Default) ApplyFormatter(msg *core.Message) error {
+	if !isEmptyValue(format.GetTargetData(msg)) {
+		return nil // ### return, value exists ###
+	}
+
+	if format.TargetIsMetadata() {
+		format.SetTargetData(msg, format.value)
+	} else {
+		format.SetTargetData(msg, []byte(format.value))
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package format
+
+import (
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestDefaultMetadata(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Default")
+	config.Override("Target", "level")
+	config.Override("Value", "info")
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Default)
+	expect.True(casted)
+
+	for _, metadata := range []tcontainer.MarshalMap{
+		nil,
+		{"level": nil},
+		{"level": ""},
+		{"level": []interface{}{}},
+	} {
+		msg := core.NewMessage(nil, []byte("test"), metadata, core.InvalidStreamID)
+		expect.NoError(formatter.ApplyFormatter(msg))
+		expect.Equal("info", msg.GetMetadata()["level"])
+		expect.Equal("test", msg.String())
+	}
+
+	msg := core.NewMessage(nil, []byte("test"), tcontainer.MarshalMap{"level": "error"}, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal("error", msg.GetMetadata()["level"])
+}
+
+func TestDefaultPayload(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Default")
+	config.Override("Value", "{}")
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Default)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte{}, nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal("{}", msg.String())
+
+	msg = core.NewMessage(nil, []byte("test"), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal("test", msg.String())
+}
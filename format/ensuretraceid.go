@@ -0,0 +1,114 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package format
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"gollum/core"
+)
+
+// EnsureTraceID formatter
+//
+// This formatter makes sure that each message carries a trace and a span ID.
+// IDs already set on a message are kept. Missing IDs are read from metadata
+// if configured or generated otherwise. Generated IDs follow the W3C trace
+// context format, i.e. a trace ID consists of 32 and a span ID of 16 lowercase
+// hex characters.
+// Other than metadata, trace and span IDs are always preserved when a message
+// is serialized, e.g. when spooling or by the native Kafka producer.
+//
+// Parameters
+//
+// - TraceIDFrom: Defines a metadata key to read the trace ID from if the
+// message does not have one, e.g. a header set by an upstream service. If the
+// key is not set or empty, a new trace ID is generated.
+// By default this parameter is set to "".
+//
+// - SpanIDFrom: Defines a metadata key to read the span ID from if the
+// message does not have one. If the key is not set or empty, a new span ID is
+// generated.
+// By default this parameter is set to "".
+//
+// Examples
+//
+// This example uses the trace ID passed by the client or starts a new trace.
+//
+//  exampleConsumer:
+//    Type: consumer.HTTP
+//    Streams: "*"
+//    Modulators:
+//      - format.EnsureTraceID:
+//        TraceIDFrom: "trace_id"
+type EnsureTraceID struct {
+	core.SimpleFormatter `gollumdoc:"embed_type"`
+	traceIDFrom          string `config:"TraceIDFrom"`
+	spanIDFrom           string `config:"SpanIDFrom"`
+}
+
+func init() {
+	core.TypeRegistry.Register(EnsureTraceID{})
+}
+
+// Configure initializes this formatter with values from a plugin config.
+func (format *EnsureTraceID) Configure(conf core.PluginConfigReader) {
+}
+
+// newRandomID returns a random, hex encoded ID of the given number of bytes.
+func newRandomID(size int) (string, error) {
+	id := make([]byte, size)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// getID returns the string stored at the given metadata key or a new random
+// ID if there is none.
+func (format *EnsureTraceID) getID(msg *core.Message, key string, size int) (string, error) {
+	if key != "" {
+		if metadata := msg.TryGetMetadata(); metadata != nil {
+			if value, exists := core.GetValuePath(metadata, key); exists {
+				if id := string(core.ConvertToBytes(value)); id != "" {
+					return id, nil // ### return, id from metadata ###
+				}
+			}
+		}
+	}
+	return newRandomID(size)
+}
+
+// ApplyFormatter update message payload
+func (format *EnsureTraceID) ApplyFormatter(msg *core.Message) error {
+	if msg.GetTraceID() == "" {
+		traceID, err := format.getID(msg, format.traceIDFrom, 16)
+		if err != nil {
+			return err
+		}
+		msg.SetTraceID(traceID)
+	}
+
+	if msg.GetSpanID() == "" {
+		spanID, err := format.getID(msg, format.spanIDFrom, 8)
+		if err != nil {
+			return err
+		}
+		msg.SetSpanID(spanID)
+	}
+
+	return nil
+}
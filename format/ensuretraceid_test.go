@@ -0,0 +1,85 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"regexp"
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestEnsureTraceIDGenerate(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.EnsureTraceID")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*EnsureTraceID)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("test"), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+
+	expect.True(regexp.MustCompile("^[0-9a-f]{32}$").MatchString(msg.GetTraceID()))
+	expect.True(regexp.MustCompile("^[0-9a-f]{16}$").MatchString(msg.GetSpanID()))
+	expect.Equal("test", msg.String())
+	expect.Nil(msg.TryGetMetadata())
+
+	// Existing IDs are kept
+	traceID, spanID := msg.GetTraceID(), msg.GetSpanID()
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal(traceID, msg.GetTraceID())
+	expect.Equal(spanID, msg.GetSpanID())
+
+	other := core.NewMessage(nil, []byte("test"), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(other))
+	expect.Neq(traceID, other.GetTraceID())
+}
+
+func TestEnsureTraceIDFromMetadata(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.EnsureTraceID")
+	config.Override("TraceIDFrom", "trace/id")
+	config.Override("SpanIDFrom", "span")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*EnsureTraceID)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("test"), tcontainer.MarshalMap{
+		"trace": tcontainer.MarshalMap{"id": "abc"},
+		"span":  "def",
+	}, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal("abc", msg.GetTraceID())
+	expect.Equal("def", msg.GetSpanID())
+
+	// Empty values are replaced by generated IDs
+	msg = core.NewMessage(nil, []byte("test"), tcontainer.MarshalMap{
+		"span": "",
+	}, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal(32, len(msg.GetTraceID()))
+	expect.Equal(16, len(msg.GetSpanID()))
+}
@@ -42,7 +42,7 @@ func init() {
 
 // Configure initializes this formatter with values from a plugin config.
 func (format *Flatten) Configure(conf core.PluginConfigReader) {
-	format.prefix = conf.GetString("Source", "")
+	format.prefix = format.GetSourceKey()
 
 	if len(format.prefix) > 0 {
 		format.prefix += format.separator
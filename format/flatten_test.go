@@ -57,3 +57,36 @@ func TestFlatten(t *testing.T) {
 	expect.MapEqual(metadata, "root.b", []interface{}{"1", "2", "3"})
 	expect.MapEqual(metadata, "root.c.a", "test")
 }
+
+func TestFlattenApplyTo(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Flatten")
+	config.Override("ApplyTo", "root")
+	config.Override("Separator", "_")
+	pluginConfig, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	plugin, casted := pluginConfig.(*Flatten)
+	expect.True(casted)
+
+	metadata := tcontainer.MarshalMap{
+		"root": tcontainer.MarshalMap{
+			"a": "test",
+			"c": tcontainer.MarshalMap{
+				"a": "test",
+			},
+		},
+	}
+
+	msg := core.NewMessage(nil, []byte("payload"), metadata, core.InvalidStreamID)
+	err = plugin.ApplyFormatter(msg)
+	expect.NoError(err)
+
+	expect.Equal("payload", msg.String())
+
+	root, err := msg.GetMetadata().MarshalMap("root")
+	expect.NoError(err)
+	expect.MapEqual(root, "root_a", "test")
+	expect.MapEqual(root, "root_c_a", "test")
+}
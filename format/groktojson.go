@@ -0,0 +1,147 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"gollum/core"
+
+	"github.com/trivago/grok"
+)
+
+// GrokToJSON formatter plugin
+//
+// GrokToJSON parses the message using a list of grok patterns and replaces
+// the data with a JSON object containing all captured fields. Patterns are
+// tried in the given order and the first matching pattern is used.
+// Type hints like "%{NUMBER:value:float}" are respected when generating JSON.
+// See https://www.elastic.co/guide/en/logstash/current/plugins-filters-grok.html#_grok_basics
+// for more information about Grok.
+//
+// Parameters
+//
+// - Patterns: A list of grok patterns that will be applied to messages.
+// The first matching pattern will be used to parse the message.
+//
+// - CustomPatterns: A map of additional named patterns that can be
+// referenced by Patterns, e.g. "MYAPP: %{WORD:app}-%{INT:build}".
+// By default this parameter is set to an empty map.
+//
+// - RemoveEmptyValues: When set to true, empty captures will not be returned.
+// By default this parameter is set to "true".
+//
+// - NamedCapturesOnly: When set to true, only named captures will be returned.
+// By default this parameter is set to "true".
+//
+// - SkipDefaultPatterns: When set to true, standard grok patterns will not be
+// included in the list of patterns.
+// By default this parameter is set to "false".
+//
+// - RemainderField: When set, all data following the matched part of the
+// message is stored in a field of this name.
+// By default this parameter is set to "".
+//
+// - ErrorField: When set, messages that don't match any pattern are not
+// discarded but passed on unchanged with a description of the error stored
+// in this metadata field. This allows e.g. a router.Metadata to send
+// unparsed messages to a dead letter stream.
+// By default this parameter is set to "".
+//
+// Examples
+//
+// This example parses apache style access logs to JSON and marks lines that
+// could not be parsed.
+//
+//  exampleConsumer:
+//    Type: consumer.Console
+//    Streams: "*"
+//    Modulators:
+//      - format.GrokToJSON:
+//        ErrorField: grok_error
+//        RemainderField: rest
+//        CustomPatterns:
+//          CLIENT: "%{IPORHOST:client} %{USER:ident} %{USER:auth}"
+//        Patterns:
+//          - ^%{CLIENT} \[%{HTTPDATE:time}\] "%{WORD:verb} %{NOTSPACE:request}" %{NUMBER:status:int}
+type GrokToJSON struct {
+	core.SimpleFormatter `gollumdoc:"embed_type"`
+	exp                  []*grok.CompiledGrok
+	remainderField       string `config:"RemainderField"`
+	errorField           string `config:"ErrorField"`
+}
+
+func init() {
+	core.TypeRegistry.Register(GrokToJSON{})
+}
+
+// Configure initializes this formatter with values from a plugin config.
+func (format *GrokToJSON) Configure(conf core.PluginConfigReader) {
+	grokParser, err := grok.New(grok.Config{
+		RemoveEmptyValues:   conf.GetBool("RemoveEmptyValues", true),
+		NamedCapturesOnly:   conf.GetBool("NamedCapturesOnly", true),
+		SkipDefaultPatterns: conf.GetBool("SkipDefaultPatterns", false),
+		Patterns:            conf.GetStringMap("CustomPatterns", map[string]string{}),
+	})
+	if conf.Errors.Push(err) {
+		return
+	}
+
+	patterns := conf.GetStringArray("Patterns", []string{})
+	for _, p := range patterns {
+		if len(format.remainderField) > 0 {
+			p = fmt.Sprintf("%s(?P<%s>(?s:.*))", p, format.remainderField)
+		}
+		exp, err := grokParser.Compile(p)
+		if !conf.Errors.Push(err) {
+			format.exp = append(format.exp, exp)
+		}
+	}
+}
+
+// ApplyFormatter update message payload
+func (format *GrokToJSON) ApplyFormatter(msg *core.Message) error {
+	content := format.GetSourceDataAsString(msg)
+
+	for _, exp := range format.exp {
+		values, err := exp.ParseStringTyped(content)
+		if err != nil {
+			return format.handleError(msg, err)
+		}
+
+		if len(values) > 0 {
+			data, err := json.Marshal(values)
+			if err != nil {
+				return format.handleError(msg, err)
+			}
+			format.SetTargetData(msg, data)
+			return nil
+		}
+	}
+
+	format.Logger.Debugf("Message does not match any pattern: %s", content)
+	return format.handleError(msg, fmt.Errorf("message does not match any grok pattern"))
+}
+
+// handleError stores the error in the configured error field or returns it
+// if no error field is set.
+func (format *GrokToJSON) handleError(msg *core.Message, err error) error {
+	if len(format.errorField) == 0 {
+		return err
+	}
+	msg.GetMetadata().Set(format.errorField, err.Error())
+	return nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestGrokToJSON(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.GrokToJSON")
+	config.Override("Patterns", []string{
+		`^%{WORD:level} %{INT:code:int}$`,
+		`^%{WORD:level} %{GREEDYDATA:text}$`,
+	})
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*GrokToJSON)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("error 42"), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+
+	result := map[string]interface{}{}
+	expect.NoError(json.Unmarshal(msg.GetPayload(), &result))
+	expect.Equal("error", result["level"])
+	expect.Equal(float64(42), result["code"])
+
+	msg = core.NewMessage(nil, []byte("warning disk is full"), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+
+	result = map[string]interface{}{}
+	expect.NoError(json.Unmarshal(msg.GetPayload(), &result))
+	expect.Equal("warning", result["level"])
+	expect.Equal("disk is full", result["text"])
+}
+
+func TestGrokToJSONCustomPatternsAndRemainder(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.GrokToJSON")
+	config.Override("CustomPatterns", map[string]string{
+		"APPID": `%{WORD:app}-%{INT:build}`,
+	})
+	config.Override("Patterns", []string{`^%{APPID}`})
+	config.Override("RemainderField", "rest")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*GrokToJSON)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("gollum-123 started\nin 5ms"), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+
+	result := map[string]interface{}{}
+	expect.NoError(json.Unmarshal(msg.GetPayload(), &result))
+	expect.Equal("gollum", result["app"])
+	expect.Equal("123", result["build"])
+	expect.Equal(" started\nin 5ms", result["rest"])
+}
+
+func TestGrokToJSONNoMatch(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.GrokToJSON")
+	config.Override("Patterns", []string{`^%{INT:code}$`})
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*GrokToJSON)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("not a number"), nil, core.InvalidStreamID)
+	expect.NotNil(formatter.ApplyFormatter(msg))
+
+	config.Override("ErrorField", "grok_error")
+	plugin, err = core.NewPluginWithConfig(config)
+	expect.NoError(err)
+	formatter = plugin.(*GrokToJSON)
+
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal("not a number", string(msg.GetPayload()))
+
+	errorText, err := msg.GetMetadata().String("grok_error")
+	expect.NoError(err)
+	expect.Equal("message does not match any grok pattern", errorText)
+}
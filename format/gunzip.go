@@ -0,0 +1,76 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+
+	"gollum/core"
+)
+
+// Gunzip formatter
+//
+// Gunzip is a formatter that decompresses gzip compressed messages.
+// If a message is not gzip compressed or cannot be decompressed, a warning is
+// logged and the data is left unchanged.
+//
+// Examples
+//
+// This example decompresses gzip compressed request bodies received over HTTP.
+//
+//  ExampleConsumer:
+//    Type: consumer.HTTP
+//    Streams: http
+//    Address: ":8080"
+//    Modulators:
+//      - format.Gunzip
+//
+type Gunzip struct {
+	core.SimpleFormatter `gollumdoc:"embed_type"`
+}
+
+func init() {
+	core.TypeRegistry.Register(Gunzip{})
+}
+
+// Configure initializes this formatter with values from a plugin config.
+func (format *Gunzip) Configure(conf core.PluginConfigReader) {
+}
+
+// ApplyFormatter update message payload
+func (format *Gunzip) ApplyFormatter(msg *core.Message) error {
+	content := format.GetSourceDataAsBytes(msg)
+
+	decompressed, err := format.getDecompressedContent(content)
+	if err != nil {
+		format.Logger.WithError(err).Warning("Failed to decompress data. Leaving data unchanged.")
+		decompressed = content
+	}
+
+	format.SetTargetData(msg, decompressed)
+	return nil
+}
+
+func (format *Gunzip) getDecompressedContent(content []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return ioutil.ReadAll(reader)
+}
@@ -0,0 +1,89 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"bytes"
+	"compress/gzip"
+
+	"gollum/core"
+)
+
+// Gzip formatter
+//
+// Gzip is a formatter that compresses messages using gzip.
+//
+// Parameters
+//
+// - Level: Defines the compression level to use. Valid values are -2
+// (huffman only), -1 (default compression), 0 (no compression) and 1 (best
+// speed) to 9 (best compression).
+// By default this parameter is set to -1.
+//
+// Examples
+//
+// This example compresses all messages before writing them to a socket.
+//
+//  ExampleProducer:
+//    Type: producer.Socket
+//    Streams: compressed
+//    Address: "unix:///var/gollum.socket"
+//    Modulators:
+//      - format.Gzip:
+//          Level: 9
+//
+type Gzip struct {
+	core.SimpleFormatter `gollumdoc:"embed_type"`
+	level                int `config:"Level" default:"-1"`
+}
+
+func init() {
+	core.TypeRegistry.Register(Gzip{})
+}
+
+// Configure initializes this formatter with values from a plugin config.
+func (format *Gzip) Configure(conf core.PluginConfigReader) {
+	if format.level < gzip.HuffmanOnly || format.level > gzip.BestCompression {
+		conf.Errors.Pushf("Level must be between %d and %d", gzip.HuffmanOnly, gzip.BestCompression)
+	}
+}
+
+// ApplyFormatter update message payload
+func (format *Gzip) ApplyFormatter(msg *core.Message) error {
+	compressed, err := format.getCompressedContent(format.GetSourceDataAsBytes(msg))
+	if err != nil {
+		return err
+	}
+
+	format.SetTargetData(msg, compressed)
+	return nil
+}
+
+func (format *Gzip) getCompressedContent(content []byte) ([]byte, error) {
+	buffer := bytes.NewBuffer(nil)
+	writer, err := gzip.NewWriterLevel(buffer, format.level)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := writer.Write(content); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestGzip(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Gzip")
+	config.Override("Level", 9)
+	pluginCompress, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	config = core.NewPluginConfig("", "format.Gunzip")
+	pluginDecompress, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	compressor, casted := pluginCompress.(*Gzip)
+	expect.True(casted)
+	decompressor, casted := pluginDecompress.(*Gunzip)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("test test test test"), nil, core.InvalidStreamID)
+	err = compressor.ApplyFormatter(msg)
+	expect.NoError(err)
+	expect.Equal([]byte{0x1f, 0x8b}, msg.GetPayload()[:2])
+
+	err = decompressor.ApplyFormatter(msg)
+	expect.NoError(err)
+	expect.Equal("test test test test", string(msg.GetPayload()))
+}
+
+func TestGzipInvalidLevel(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Gzip")
+	config.Override("Level", 10)
+	_, err := core.NewPluginWithConfig(config)
+	expect.NotNil(err)
+}
+
+func TestGunzipNotCompressed(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Gunzip")
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	decompressor, casted := plugin.(*Gunzip)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("not compressed"), nil, core.InvalidStreamID)
+	err = decompressor.ApplyFormatter(msg)
+	expect.NoError(err)
+	expect.Equal("not compressed", string(msg.GetPayload()))
+}
+
+func TestGzipApplyHandling(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Gzip")
+	config.Override("Target", "compressed")
+	pluginCompress, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	config = core.NewPluginConfig("", "format.Gunzip")
+	config.Override("Source", "compressed")
+	config.Override("Target", "decompressed")
+	pluginDecompress, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	compressor := pluginCompress.(*Gzip)
+	decompressor := pluginDecompress.(*Gunzip)
+
+	msg := core.NewMessage(nil, []byte("test"), nil, core.InvalidStreamID)
+	expect.NoError(compressor.ApplyFormatter(msg))
+	expect.NoError(decompressor.ApplyFormatter(msg))
+
+	expect.Equal("test", string(msg.GetPayload()))
+
+	val, err := msg.GetMetadata().Bytes("decompressed")
+	expect.NoError(err)
+	expect.Equal("test", string(val))
+}
@@ -34,7 +34,8 @@ import (
 // This my be one of the following values.
 // By default this parameter is set to "time"
 //
-//  - hash: The message payload will be hashed using fnv1a and returned as hex.
+//  - hash: The data denoted by Source will be hashed using fnv1a and returned
+//  as hex.
 //
 //  - time: The id will be formatted YYMMDDHHmmSSxxxxxxx where x denotes the
 //  current sequence number modulo 10000000. I.e. 10.000.000 messages per second
@@ -89,7 +90,7 @@ func (format *Identifier) Configure(conf core.PluginConfigReader) {
 
 func (format *Identifier) idHash(msg *core.Message) []byte {
 	hasher := fnv.New64a()
-	hasher.Write(msg.GetPayload())
+	hasher.Write(format.GetSourceDataAsBytes(msg))
 	return []byte(strconv.FormatUint(hasher.Sum64(), 16))
 }
 
@@ -53,13 +53,36 @@ func TestFormatterIdentifierTarget(t *testing.T) {
 	formatter, casted := plugin.(*Identifier)
 	expect.True(casted)
 
-	msg := core.NewMessage(nil, []byte("test"), nil, core.InvalidStreamID)
-	msg.GetMetadata().Set("foo", []byte(""))
+	msg := core.NewMessage(nil, []byte("payload"), nil, core.InvalidStreamID)
+	msg.GetMetadata().Set("foo", []byte("test"))
+	err = formatter.ApplyFormatter(msg)
+	expect.NoError(err)
+
+	val, err := msg.GetMetadata().Bytes("foo")
+	expect.NoError(err)
+	expect.Equal("f9e6e6ef197c2b25", string(val))
+	expect.Equal("payload", msg.String())
+}
+
+func TestFormatterIdentifierApplyTo(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Identifier")
+	config.Override("ApplyTo", "foo")
+	config.Override("Generator", "hash")
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Identifier)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("payload"), nil, core.InvalidStreamID)
+	msg.GetMetadata().Set("foo", "test")
 	err = formatter.ApplyFormatter(msg)
 	expect.NoError(err)
 
 	val, err := msg.GetMetadata().Bytes("foo")
 	expect.NoError(err)
 	expect.Equal("f9e6e6ef197c2b25", string(val))
-	expect.Equal("test", msg.String())
+	expect.Equal("payload", msg.String())
 }
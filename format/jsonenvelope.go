@@ -0,0 +1,189 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package format
+
+import (
+	"encoding/json"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+)
+
+// JSONEnvelope formatter
+//
+// This formatter wraps the payload into a JSON object together with the
+// message creation time, the current stream and metadata, e.g.
+// `{"meta":{...},"payload":"...","stream":"...","ts":"..."}`. This is useful
+// when shipping to log stores that expect such an envelope.
+// Byte slices stored in metadata are written as strings.
+//
+// Parameters
+//
+// - MetadataKeys: Defines a list of metadata keys or paths to include. Nested
+// paths like "user/id" keep their structure in the envelope. When left empty,
+// all metadata is included.
+// By default this parameter is set to an empty list.
+//
+// - PayloadAsJSON: When set to true, the payload is embedded as JSON instead
+// of a string. Payloads that are not valid JSON are still embedded as string.
+// By default this parameter is set to false.
+//
+// - TimestampFormat: Defines the Go time format string used for the message
+// creation time.
+// By default this parameter is set to "2006-01-02T15:04:05.999999999Z07:00".
+//
+// - PayloadField: Defines the name of the payload field.
+// By default this parameter is set to "payload".
+//
+// - TimestampField: Defines the name of the timestamp field. Set to "" to omit
+// the timestamp.
+// By default this parameter is set to "ts".
+//
+// - StreamField: Defines the name of the stream field. Set to "" to omit the
+// stream name.
+// By default this parameter is set to "stream".
+//
+// - MetadataField: Defines the name of the metadata field. Set to "" to omit
+// metadata.
+// By default this parameter is set to "meta".
+//
+// Examples
+//
+// This example wraps JSON log lines together with the hostname and the
+// kafka topic they were read from.
+//
+//  exampleConsumer:
+//    Type: consumer.Kafka
+//    Streams: logs
+//    SetMetadata: true
+//    Modulators:
+//      - format.Hostname:
+//        Target: host
+//        Separator: ""
+//      - format.JSONEnvelope:
+//        MetadataKeys:
+//          - host
+//          - topic
+//        PayloadAsJSON: true
+type JSONEnvelope struct {
+	core.SimpleFormatter `gollumdoc:"embed_type"`
+	metadataKeys         []string `config:"MetadataKeys"`
+	payloadAsJSON        bool     `config:"PayloadAsJSON" default:"false"`
+	timestampFormat      string   `config:"TimestampFormat" default:"2006-01-02T15:04:05.999999999Z07:00"`
+	payloadField         string   `config:"PayloadField" default:"payload"`
+	timestampField       string   `config:"TimestampField" default:"ts"`
+	streamField          string   `config:"StreamField" default:"stream"`
+	metadataField        string   `config:"MetadataField" default:"meta"`
+}
+
+func init() {
+	core.TypeRegistry.Register(JSONEnvelope{})
+}
+
+// Configure initializes this formatter with values from a plugin config.
+func (format *JSONEnvelope) Configure(conf core.PluginConfigReader) {
+	if format.payloadField == "" {
+		conf.Errors.Pushf("PayloadField must not be empty")
+	}
+}
+
+// toJSONValue converts byte slices to strings so they are not base64
+// encoded by the JSON encoder.
+func toJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+
+	case tcontainer.MarshalMap:
+		return toJSONObject(v)
+
+	case map[string]interface{}:
+		return toJSONObject(v)
+
+	case []interface{}:
+		array := make([]interface{}, len(v))
+		for i, item := range v {
+			array[i] = toJSONValue(item)
+		}
+		return array
+
+	default:
+		return value
+	}
+}
+
+func toJSONObject(object map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(object))
+	for key, value := range object {
+		result[key] = toJSONValue(value)
+	}
+	return result
+}
+
+// getMetadata returns the metadata to be added to the envelope.
+func (format *JSONEnvelope) getMetadata(msg *core.Message) map[string]interface{} {
+	metadata := msg.TryGetMetadata()
+	if metadata == nil {
+		return map[string]interface{}{}
+	}
+
+	if len(format.metadataKeys) == 0 {
+		return toJSONObject(metadata)
+	}
+
+	selected := core.NewMetadata()
+	for _, key := range format.metadataKeys {
+		if value, exists := core.GetValuePath(metadata, key); exists {
+			core.SetValuePath(selected, key, value)
+		}
+	}
+	return toJSONObject(selected)
+}
+
+// getPayload returns the payload to be added to the envelope.
+func (format *JSONEnvelope) getPayload(msg *core.Message) interface{} {
+	payload := format.GetSourceDataAsBytes(msg)
+	if format.payloadAsJSON && json.Valid(payload) {
+		return json.RawMessage(payload)
+	}
+	return string(payload)
+}
+
+// ApplyFormatter update message payload
+func (format *JSONEnvelope) ApplyFormatter(msg *core.Message) error {
+	envelope := map[string]interface{}{
+		format.payloadField: format.getPayload(msg),
+	}
+
+	if format.timestampField != "" {
+		envelope[format.timestampField] = msg.GetCreationTime().Format(format.timestampFormat)
+	}
+	if format.streamField != "" {
+		envelope[format.streamField] = msg.GetStreamID().GetName()
+	}
+	if format.metadataField != "" {
+		envelope[format.metadataField] = format.getMetadata(msg)
+	}
+
+	data, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	format.SetTargetData(msg, data)
+	return nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestJSONEnvelopeString(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.JSONEnvelope")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*JSONEnvelope)
+	expect.True(casted)
+
+	streamID := core.StreamRegistry.GetStreamID("envelopeStream")
+	msg := core.NewMessage(nil, []byte(`{"not":"parsed"}`), tcontainer.MarshalMap{
+		"host":   "web01",
+		"header": tcontainer.MarshalMap{"key": []byte("value")},
+	}, streamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+
+	envelope := tcontainer.NewMarshalMap()
+	expect.NoError(json.Unmarshal(msg.GetPayload(), &envelope))
+
+	expect.MapEqual(envelope, "payload", `{"not":"parsed"}`)
+	expect.MapEqual(envelope, "stream", "envelopeStream")
+	expect.MapEqual(envelope, "ts", msg.GetCreationTime().Format(time.RFC3339Nano))
+
+	meta, err := envelope.MarshalMap("meta")
+	expect.NoError(err)
+	expect.MapEqual(meta, "host", "web01")
+
+	header, err := meta.MarshalMap("header")
+	expect.NoError(err)
+	expect.MapEqual(header, "key", "value")
+}
+
+func TestJSONEnvelopeNestedJSON(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.JSONEnvelope")
+	config.Override("PayloadAsJSON", true)
+	config.Override("MetadataKeys", []string{"user/id", "missing"})
+	config.Override("PayloadField", "message")
+	config.Override("TimestampField", "")
+	config.Override("StreamField", "")
+	config.Override("MetadataField", "fields")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*JSONEnvelope)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte(`{"level":"info","count":3}`), tcontainer.MarshalMap{
+		"user":   tcontainer.MarshalMap{"id": 42, "name": "secret"},
+		"ignore": "me",
+	}, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal(`{"fields":{"user":{"id":42}},"message":{"level":"info","count":3}}`, msg.String())
+
+	// Invalid JSON is embedded as string
+	msg = core.NewMessage(nil, []byte("plain text"), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal(`{"fields":{},"message":"plain text"}`, msg.String())
+}
+
+func TestJSONEnvelopeTarget(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.JSONEnvelope")
+	config.Override("Target", "envelope")
+	config.Override("TimestampField", "")
+	config.Override("StreamField", "")
+	config.Override("MetadataField", "")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*JSONEnvelope)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("test"), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal("test", msg.String())
+
+	envelope, err := msg.GetMetadata().Bytes("envelope")
+	expect.NoError(err)
+	expect.Equal(`{"payload":"test"}`, string(envelope))
+}
@@ -0,0 +1,166 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+)
+
+// JSONToInfluxDB formatter
+//
+// This formatter parses a JSON object and stores measurement, tags, fields
+// and timestamp in the metadata fields used by producer.InfluxDB when
+// LineFromMetadata is enabled. The JSON object is read from the data denoted
+// by Source, which can be a metadata field holding a JSON string. The payload
+// is not changed. Messages that are not a JSON object are passed through
+// unchanged.
+//
+// Parameters
+//
+// - Measurement: Defines the measurement name. If empty, the name of the
+// message's stream is used.
+// By default this parameter is set to "".
+//
+// - MeasurementFrom: Defines the path of a JSON field containing the
+// measurement name. If set and present, this value overrides Measurement.
+// By default this parameter is set to "".
+//
+// - Tags: Defines a list of JSON fields stored as tags. Nested fields can be
+// addressed by a path like "request/host". The path is used as tag name.
+// By default this parameter is set to an empty list.
+//
+// - Fields: Defines a list of JSON fields stored as fields. Nested fields can
+// be addressed by a path like "response/duration". The path is used as field
+// name. If empty, all top level numbers, strings and booleans not used as
+// tag, measurement or timestamp are stored as fields.
+// By default this parameter is set to an empty list.
+//
+// - TimeFrom: Defines the path of a JSON field containing the timestamp as
+// unix time in milliseconds or as RFC3339 string. If empty or not present,
+// the message creation time is used.
+// By default this parameter is set to "".
+//
+// Examples
+//
+// This example converts '{"host":"web01","status":200,"duration":0.25}'
+// to a measurement "requests" with the tag "host" and the fields "status"
+// and "duration".
+//
+//  influxProducer:
+//    Type: producer.InfluxDB
+//    Streams: requests
+//    LineFromMetadata: true
+//    Modulators:
+//      - format.JSONToInfluxDB:
+//        Measurement: requests
+//        Tags:
+//          - host
+type JSONToInfluxDB struct {
+	core.SimpleFormatter `gollumdoc:"embed_type"`
+	measurement          string   `config:"Measurement"`
+	measurementFrom      string   `config:"MeasurementFrom"`
+	tags                 []string `config:"Tags"`
+	fields               []string `config:"Fields"`
+	timeFrom             string   `config:"TimeFrom"`
+}
+
+func init() {
+	core.TypeRegistry.Register(JSONToInfluxDB{})
+}
+
+// Configure initializes this formatter with values from a plugin config.
+func (format *JSONToInfluxDB) Configure(conf core.PluginConfigReader) {
+}
+
+// isInfluxDBFieldValue returns true if the given value can be stored as
+// field value.
+func isInfluxDBFieldValue(value interface{}) bool {
+	switch value.(type) {
+	case json.Number, string, bool:
+		return true
+	default:
+		return false
+	}
+}
+
+// getFields returns all values to store as fields.
+func (format *JSONToInfluxDB) getFields(values tcontainer.MarshalMap, tags tcontainer.MarshalMap) tcontainer.MarshalMap {
+	fields := tcontainer.NewMarshalMap()
+
+	if len(format.fields) > 0 {
+		for _, path := range format.fields {
+			if value, exists := core.GetValuePath(values, path); exists && isInfluxDBFieldValue(value) {
+				fields[path] = value
+			}
+		}
+		return fields // ### return, fields are configured ###
+	}
+
+	for key, value := range values {
+		_, isTag := tags[key]
+		switch {
+		case isTag, key == format.measurementFrom, key == format.timeFrom:
+		case isInfluxDBFieldValue(value):
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// ApplyFormatter update message payload
+func (format *JSONToInfluxDB) ApplyFormatter(msg *core.Message) error {
+	var values tcontainer.MarshalMap
+	decoder := json.NewDecoder(bytes.NewReader(format.GetSourceDataAsBytes(msg)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		format.Logger.WithError(err).Warning("Failed to parse JSON, message is passed through unchanged")
+		return nil
+	}
+
+	measurement := format.measurement
+	if measurement == "" {
+		measurement = msg.GetStreamID().GetName()
+	}
+	if format.measurementFrom != "" {
+		if value, exists := core.GetValuePath(values, format.measurementFrom); exists {
+			measurement = core.ConvertToString(value)
+		}
+	}
+
+	tags := tcontainer.NewMarshalMap()
+	for _, path := range format.tags {
+		if value, exists := core.GetValuePath(values, path); exists && value != nil {
+			tags[path] = core.ConvertToString(value)
+		}
+	}
+
+	metadata := msg.GetMetadata()
+	metadata["measurement"] = measurement
+	metadata["tags"] = tags
+	metadata["fields"] = format.getFields(values, tags)
+
+	if format.timeFrom != "" {
+		if value, exists := core.GetValuePath(values, format.timeFrom); exists {
+			metadata["time"] = core.ConvertToString(value)
+		}
+	}
+	return nil
+}
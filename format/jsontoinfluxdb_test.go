@@ -0,0 +1,105 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestJSONToInfluxDBAllFields(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.JSONToInfluxDB")
+	config.Override("Tags", []string{"host", "request/method"})
+	config.Override("MeasurementFrom", "type")
+	config.Override("TimeFrom", "time")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*JSONToInfluxDB)
+	expect.True(casted)
+
+	payload := `{"type":"requests","host":"web01","request":{"method":"GET"},"status":200,"duration":0.25,"cached":true,"time":1500000000000}`
+	msg := core.NewMessage(nil, []byte(payload), nil, core.StreamRegistry.GetStreamID("metrics"))
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal(payload, msg.String())
+
+	metadata := msg.GetMetadata()
+	expect.Equal("requests", metadata["measurement"])
+	expect.Equal("1500000000000", metadata["time"])
+	expect.Equal(tcontainer.MarshalMap{"host": "web01", "request/method": "GET"}, metadata["tags"])
+	expect.Equal(tcontainer.MarshalMap{
+		"status":   json.Number("200"),
+		"duration": json.Number("0.25"),
+		"cached":   true,
+	}, metadata["fields"])
+}
+
+func TestJSONToInfluxDBSelectedFields(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.JSONToInfluxDB")
+	config.Override("Fields", []string{"response/duration", "missing", "response"})
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*JSONToInfluxDB)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte(`{"response":{"duration":12}}`), nil, core.StreamRegistry.GetStreamID("metrics"))
+	expect.NoError(formatter.ApplyFormatter(msg))
+
+	metadata := msg.GetMetadata()
+	expect.Equal("metrics", metadata["measurement"])
+	expect.Equal(tcontainer.MarshalMap{"response/duration": json.Number("12")}, metadata["fields"])
+	_, hasTime := metadata["time"]
+	expect.False(hasTime)
+
+	// Invalid JSON is passed through
+	msg = core.NewMessage(nil, []byte("not json"), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal(0, len(msg.GetMetadata()))
+}
+
+func TestJSONToInfluxDBSource(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.JSONToInfluxDB")
+	config.Override("Source", "body")
+	config.Override("Tags", []string{"host"})
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*JSONToInfluxDB)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("GET /metrics"), nil, core.StreamRegistry.GetStreamID("metrics"))
+	msg.GetMetadata().Set("body", `{"host":"web01","status":200}`)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal("GET /metrics", msg.String())
+
+	metadata := msg.GetMetadata()
+	expect.Equal(tcontainer.MarshalMap{"host": "web01"}, metadata["tags"])
+	expect.Equal(tcontainer.MarshalMap{"status": json.Number("200")}, metadata["fields"])
+}
@@ -0,0 +1,213 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gollum/core"
+)
+
+// JSONToText formatter
+//
+// This formatter parses JSON data and renders it as a line of text using a
+// template. It is the inverse of format.JSON and can be used to write
+// enriched JSON data to plain text sinks. Data that is not valid JSON is
+// passed through unchanged.
+//
+// Parameters
+//
+// - Template: Defines the template used to render the parsed JSON object.
+// If the template contains "{{" it is treated as go template, see
+// https://golang.org/pkg/text/template/#hdr-Actions. Otherwise all "{field}"
+// placeholders are replaced by the value of the given field. Nested fields
+// are accessed by joining the keys with Separator, e.g. "{user.name}".
+// Array elements can be accessed by their index, e.g. "{tags.0}".
+// Objects and arrays are written as JSON.
+// By default this parameter is set to "".
+//
+// - Separator: Defines the separator used to access nested fields in
+// "{field}" placeholders.
+// By default this parameter is set to ".".
+//
+// - MissingKey: Defines how missing fields are rendered. Set to "empty" to
+// replace them with an empty string, "keep" to keep the placeholder or "fail"
+// to return an error. Go templates only support "fail", otherwise the go
+// template default is used.
+// By default this parameter is set to "empty".
+//
+// Examples
+//
+// This example writes access log lines from JSON encoded requests.
+//
+//  exampleProducer:
+//    Type: producer.File
+//    Streams: "*"
+//    File: /var/log/access.log
+//    Modulators:
+//      - format.JSONToText:
+//        Template: "{client.ip} {request.method} {request.path} {status}"
+type JSONToText struct {
+	core.SimpleFormatter `gollumdoc:"embed_type"`
+	separator            string `config:"Separator" default:"."`
+	missingKey           string
+	template             *template.Template
+	placeholders         []jsonToTextPlaceholder
+	literals             []string
+}
+
+type jsonToTextPlaceholder struct {
+	text string
+	path []string
+}
+
+const (
+	jsonToTextMissingEmpty = "empty"
+	jsonToTextMissingKeep  = "keep"
+	jsonToTextMissingFail  = "fail"
+)
+
+var jsonToTextPlaceholderExp = regexp.MustCompile(`\{([^{}]+)\}`)
+
+func init() {
+	core.TypeRegistry.Register(JSONToText{})
+}
+
+// Configure initializes this formatter with values from a plugin config.
+func (format *JSONToText) Configure(conf core.PluginConfigReader) {
+	tpl := conf.GetString("Template", "")
+
+	format.missingKey = strings.ToLower(conf.GetString("MissingKey", jsonToTextMissingEmpty))
+	switch format.missingKey {
+	case jsonToTextMissingEmpty, jsonToTextMissingKeep, jsonToTextMissingFail:
+	default:
+		conf.Errors.Pushf("MissingKey must be one of empty, keep or fail")
+	}
+
+	if strings.Contains(tpl, "{{") {
+		var err error
+		format.template = template.New("JSONToText")
+		if format.missingKey == jsonToTextMissingFail {
+			format.template.Option("missingkey=error")
+		}
+		format.template, err = format.template.Parse(tpl)
+		conf.Errors.Push(err)
+		return
+	}
+
+	matches := jsonToTextPlaceholderExp.FindAllStringSubmatchIndex(tpl, -1)
+	start := 0
+	for _, match := range matches {
+		format.literals = append(format.literals, tpl[start:match[0]])
+		format.placeholders = append(format.placeholders, jsonToTextPlaceholder{
+			text: tpl[match[0]:match[1]],
+			path: strings.Split(tpl[match[2]:match[3]], format.separator),
+		})
+		start = match[1]
+	}
+	format.literals = append(format.literals, tpl[start:])
+}
+
+// ApplyFormatter update message payload
+func (format *JSONToText) ApplyFormatter(msg *core.Message) error {
+	var values interface{}
+	decoder := json.NewDecoder(bytes.NewReader(format.GetSourceDataAsBytes(msg)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		format.Logger.WithError(err).Warning("Failed to parse JSON, message is passed through unchanged")
+		return nil
+	}
+
+	if format.template != nil {
+		text := bytes.Buffer{}
+		if err := format.template.Execute(&text, values); err != nil {
+			return err
+		}
+		format.SetTargetData(msg, text.String())
+		return nil
+	}
+
+	text := strings.Builder{}
+	for i, placeholder := range format.placeholders {
+		text.WriteString(format.literals[i])
+
+		value, found := jsonToTextLookup(values, placeholder.path)
+		switch {
+		case found:
+			text.WriteString(jsonToTextString(value))
+		case format.missingKey == jsonToTextMissingKeep:
+			text.WriteString(placeholder.text)
+		case format.missingKey == jsonToTextMissingFail:
+			return fmt.Errorf("field %s not found", placeholder.text)
+		}
+	}
+	text.WriteString(format.literals[len(format.literals)-1])
+
+	format.SetTargetData(msg, text.String())
+	return nil
+}
+
+// jsonToTextLookup returns the value found at the given path inside of a
+// decoded JSON value.
+func jsonToTextLookup(value interface{}, path []string) (interface{}, bool) {
+	for _, key := range path {
+		switch node := value.(type) {
+		case map[string]interface{}:
+			child, exists := node[key]
+			if !exists {
+				return nil, false
+			}
+			value = child
+
+		case []interface{}:
+			idx, err := strconv.Atoi(key)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return nil, false
+			}
+			value = node[idx]
+
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// jsonToTextString converts a decoded JSON value to a string. Objects and
+// arrays are converted back to JSON.
+func jsonToTextString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(encoded)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+const jsonToTextTestPayload = `{"status":200,"bytes":1048576,"ok":true,"request":{"method":"GET","path":"/index.html","headers":[{"host":"example.com"}]},"tags":["a","b"]}`
+
+func TestJSONToTextPlaceholders(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.JSONToText")
+	config.Override("Template", "{request.method} {request.path} {status} {bytes} {ok} host={request.headers.0.host} tags={tags}")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*JSONToText)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte(jsonToTextTestPayload), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal(`GET /index.html 200 1048576 true host=example.com tags=["a","b"]`, msg.String())
+}
+
+func TestJSONToTextSeparator(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.JSONToText")
+	config.Override("Template", "{request/method}|{request/headers/0}")
+	config.Override("Separator", "/")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*JSONToText)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte(jsonToTextTestPayload), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal(`GET|{"host":"example.com"}`, msg.String())
+}
+
+func TestJSONToTextGoTemplate(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.JSONToText")
+	config.Override("Template", "{{.request.method}} {{range .tags}}[{{.}}]{{end}} {{index .request.headers 0 \"host\"}}")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*JSONToText)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte(jsonToTextTestPayload), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal("GET [a][b] example.com", msg.String())
+}
+
+func TestJSONToTextMissingKey(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	template := "{status} {request.query} {tags.5}"
+
+	for policy, expected := range map[string]string{
+		"empty": "200  ",
+		"keep":  "200 {request.query} {tags.5}",
+	} {
+		config := core.NewPluginConfig("", "format.JSONToText")
+		config.Override("Template", template)
+		config.Override("MissingKey", policy)
+
+		plugin, err := core.NewPluginWithConfig(config)
+		expect.NoError(err)
+
+		formatter, casted := plugin.(*JSONToText)
+		expect.True(casted)
+
+		msg := core.NewMessage(nil, []byte(jsonToTextTestPayload), nil, core.InvalidStreamID)
+		expect.NoError(formatter.ApplyFormatter(msg))
+		expect.Equal(expected, msg.String())
+	}
+
+	config := core.NewPluginConfig("", "format.JSONToText")
+	config.Override("Template", template)
+	config.Override("MissingKey", "fail")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*JSONToText)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte(jsonToTextTestPayload), nil, core.InvalidStreamID)
+	expect.NotNil(formatter.ApplyFormatter(msg))
+
+	config = core.NewPluginConfig("", "format.JSONToText")
+	config.Override("Template", "{{.request.query}}")
+	config.Override("MissingKey", "fail")
+
+	plugin, err = core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted = plugin.(*JSONToText)
+	expect.True(casted)
+
+	expect.NotNil(formatter.ApplyFormatter(msg))
+}
+
+func TestJSONToTextInvalidJSON(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.JSONToText")
+	config.Override("Template", "{status}")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*JSONToText)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("not json"), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal("not json", msg.String())
+}
+
+func TestJSONToTextTarget(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.JSONToText")
+	config.Override("Template", "{request.method} {request.path}")
+	config.Override("Target", "line")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*JSONToText)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte(jsonToTextTestPayload), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal(jsonToTextTestPayload, msg.String())
+
+	line, err := msg.GetMetadata().String("line")
+	expect.NoError(err)
+	expect.Equal("GET /index.html", line)
+}
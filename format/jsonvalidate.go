@@ -0,0 +1,153 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"path/filepath"
+	"strings"
+
+	"gollum/core"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// JSONValidate formatter plugin
+//
+// JSONValidate validates JSON documents against a JSON Schema. Valid messages
+// are passed on unchanged. Invalid messages, including messages that are not
+// valid JSON, are rejected like messages rejected by a filter, i.e. they are
+// sent to FilteredStream or discarded if no FilteredStream is set.
+//
+// The schema is loaded and compiled once when the plugin is configured.
+// Schema drafts 4, 6 and 7 are supported. References to other schemas are
+// resolved relative to the location of the schema.
+//
+// Parameters
+//
+// - Schema: Defines the location of the JSON Schema to validate against.
+// This can be a file path or a URL like "https://example.com/event.json".
+// This parameter is mandatory. If it is not set, all messages are passed on.
+//
+// - Source: Defines the metadata field holding the document to validate.
+// Metadata fields can hold JSON encoded strings or nested fields. When left
+// empty, the payload is validated.
+// By default this parameter is set to "".
+//
+// - ErrorField: Defines the metadata field the validation errors of invalid
+// messages are stored in. Multiple errors are separated by "; ". When left
+// empty, errors are not stored.
+// By default this parameter is set to "".
+//
+// Examples
+//
+// This example validates incoming events against a schema and sends invalid
+// events together with the reason to a separate stream.
+//
+//  ExampleConsumer:
+//    Type: consumer.Console
+//    Streams: events
+//    Modulators:
+//      - format.JSONValidate:
+//          Schema: /etc/gollum/event.schema.json
+//          ErrorField: validation_error
+//          FilteredStream: invalid_events
+type JSONValidate struct {
+	core.SimpleFilter `gollumdoc:"embed_type"`
+	errorField        string `config:"ErrorField"`
+	getDocument       core.GetDataFunc
+	schema            *gojsonschema.Schema
+}
+
+func init() {
+	core.TypeRegistry.Register(JSONValidate{})
+}
+
+// Configure initializes this formatter with values from a plugin config.
+func (format *JSONValidate) Configure(conf core.PluginConfigReader) {
+	format.Logger = conf.GetSubLogger("Filter")
+	format.getDocument = core.NewGetterFor(conf.GetString("Source", ""))
+
+	location := conf.GetString("Schema", "")
+	if location == "" {
+		format.Logger.Error("setting a Schema is mandatory")
+		return // ### return, no schema ###
+	}
+
+	schema, err := gojsonschema.NewSchema(newJSONSchemaLoader(location))
+	if err != nil {
+		conf.Errors.Pushf("Failed to load schema %s: %s", location, err.Error())
+		return // ### return, invalid schema ###
+	}
+	format.schema = schema
+}
+
+// newJSONSchemaLoader returns a loader for the given schema URL or file path.
+// File paths are converted to file URLs so that relative references can be
+// resolved.
+func newJSONSchemaLoader(location string) gojsonschema.JSONLoader {
+	if strings.Contains(location, "://") {
+		return gojsonschema.NewReferenceLoader(location)
+	}
+	if path, err := filepath.Abs(location); err == nil {
+		location = path
+	}
+	return gojsonschema.NewReferenceLoader("file://" + filepath.ToSlash(location))
+}
+
+// newJSONDocumentLoader returns a loader for JSON encoded data or for
+// decoded values like nested metadata fields.
+func newJSONDocumentLoader(document interface{}) gojsonschema.JSONLoader {
+	switch doc := document.(type) {
+	case []byte:
+		return gojsonschema.NewBytesLoader(doc)
+	case string:
+		return gojsonschema.NewStringLoader(doc)
+	default:
+		return gojsonschema.NewGoLoader(doc)
+	}
+}
+
+// ApplyFilter rejects all messages that do not match the schema.
+func (format *JSONValidate) ApplyFilter(msg *core.Message) (core.FilterResult, error) {
+	if format.schema == nil {
+		format.Logger.Warn("no Schema loaded")
+		return core.FilterResultMessageAccept, nil
+	}
+
+	result, err := format.schema.Validate(newJSONDocumentLoader(format.getDocument(msg)))
+	if err != nil {
+		format.reject(msg, err.Error())
+		return format.GetFilterResultMessageReject(), nil
+	}
+
+	if result.Valid() {
+		return core.FilterResultMessageAccept, nil
+	}
+
+	errors := make([]string, 0, len(result.Errors()))
+	for _, resultErr := range result.Errors() {
+		errors = append(errors, resultErr.String())
+	}
+	format.reject(msg, strings.Join(errors, "; "))
+	return format.GetFilterResultMessageReject(), nil
+}
+
+// reject stores the given validation error in ErrorField if set.
+func (format *JSONValidate) reject(msg *core.Message, reason string) {
+	format.Logger.Debugf("Message failed validation: %s", reason)
+	if format.errorField != "" {
+		msg.GetMetadata().Set(format.errorField, reason)
+	}
+}
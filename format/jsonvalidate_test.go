@@ -0,0 +1,223 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+const jsonValidateTestSchema = `{
+	"$schema": "http://json-schema.org/draft-07/schema#",
+	"type": "object",
+	"required": ["event", "user"],
+	"properties": {
+		"event": {"type": "string", "enum": ["login", "logout"]},
+		"user": {"$ref": "user.json"}
+	}
+}`
+
+const jsonValidateTestUserSchema = `{
+	"type": "object",
+	"required": ["id"],
+	"properties": {
+		"id": {"type": "integer", "minimum": 1}
+	}
+}`
+
+// writeJSONValidateSchema writes the test schemas to a temporary directory
+// and returns the path of the main schema.
+func writeJSONValidateSchema(t *testing.T) (string, func()) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-jsonvalidate")
+	expect.NoError(err)
+
+	path := filepath.Join(dir, "event.json")
+	expect.NoError(ioutil.WriteFile(path, []byte(jsonValidateTestSchema), 0644))
+	expect.NoError(ioutil.WriteFile(filepath.Join(dir, "user.json"), []byte(jsonValidateTestUserSchema), 0644))
+
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestJSONValidate(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	schema, cleanup := writeJSONValidateSchema(t)
+	defer cleanup()
+
+	config := core.NewPluginConfig("", "format.JSONValidate")
+	config.Override("Schema", schema)
+	config.Override("ErrorField", "error")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*JSONValidate)
+	expect.True(casted)
+
+	payload := `{"event":"login","user":{"id":42}}`
+	msg := core.NewMessage(nil, []byte(payload), nil, core.InvalidStreamID)
+	result, err := formatter.ApplyFilter(msg)
+	expect.NoError(err)
+	expect.Equal(core.FilterResultMessageAccept, result)
+	expect.Equal(payload, msg.String())
+	expect.Nil(msg.TryGetMetadata())
+
+	for _, invalid := range []string{
+		`{"event":"crash","user":{"id":42}}`,
+		`{"event":"login","user":{"id":0}}`,
+		`{"event":"login"}`,
+		`not json`,
+	} {
+		msg := core.NewMessage(nil, []byte(invalid), nil, core.InvalidStreamID)
+		result, err := formatter.ApplyFilter(msg)
+		expect.NoError(err)
+		expect.Equal(core.FilterResultMessageReject(core.InvalidStreamID), result)
+		expect.Equal(invalid, msg.String())
+
+		reason, _ := msg.GetMetadata().String("error")
+		expect.True(reason != "")
+	}
+
+	msg = core.NewMessage(nil, []byte(`{"event":"login","user":{"id":0}}`), nil, core.InvalidStreamID)
+	formatter.ApplyFilter(msg)
+	reason, _ := msg.GetMetadata().String("error")
+	expect.Contains(reason, "user.id")
+}
+
+func TestJSONValidateFilteredStream(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	schema, cleanup := writeJSONValidateSchema(t)
+	defer cleanup()
+
+	config := core.NewPluginConfig("", "format.JSONValidate")
+	config.Override("Schema", schema)
+	config.Override("FilteredStream", "invalid")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*JSONValidate)
+	expect.True(casted)
+
+	modulator := core.NewFilterModulator(formatter)
+
+	msg := core.NewMessage(nil, []byte(`{"event":"login","user":{"id":42}}`), nil, core.InvalidStreamID)
+	expect.Equal(core.ModulateResultContinue, modulator.Modulate(msg))
+
+	msg = core.NewMessage(nil, []byte(`{}`), nil, core.InvalidStreamID)
+	expect.Equal(core.ModulateResultFallback, modulator.Modulate(msg))
+	expect.Equal(core.GetStreamID("invalid"), msg.GetStreamID())
+	expect.Nil(msg.TryGetMetadata())
+}
+
+func TestJSONValidateSource(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	schema, cleanup := writeJSONValidateSchema(t)
+	defer cleanup()
+
+	config := core.NewPluginConfig("", "format.JSONValidate")
+	config.Override("Schema", schema)
+	config.Override("Source", "doc")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*JSONValidate)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("payload"), tcontainer.MarshalMap{
+		"doc": `{"event":"logout","user":{"id":1}}`,
+	}, core.InvalidStreamID)
+	result, _ := formatter.ApplyFilter(msg)
+	expect.Equal(core.FilterResultMessageAccept, result)
+
+	msg = core.NewMessage(nil, []byte("payload"), tcontainer.MarshalMap{
+		"doc": tcontainer.MarshalMap{
+			"event": "logout",
+			"user":  tcontainer.MarshalMap{"id": 1},
+		},
+	}, core.InvalidStreamID)
+	result, _ = formatter.ApplyFilter(msg)
+	expect.Equal(core.FilterResultMessageAccept, result)
+
+	msg = core.NewMessage(nil, []byte(`{"event":"logout","user":{"id":1}}`), nil, core.InvalidStreamID)
+	result, _ = formatter.ApplyFilter(msg)
+	expect.Equal(core.FilterResultMessageReject(core.InvalidStreamID), result)
+}
+
+func TestJSONValidateSchemaURL(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/event.json"):
+			w.Write([]byte(jsonValidateTestSchema))
+		case strings.HasSuffix(r.URL.Path, "/user.json"):
+			w.Write([]byte(jsonValidateTestUserSchema))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	config := core.NewPluginConfig("", "format.JSONValidate")
+	config.Override("Schema", server.URL+"/schemas/event.json")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*JSONValidate)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte(`{"event":"login","user":{"id":42}}`), nil, core.InvalidStreamID)
+	result, _ := formatter.ApplyFilter(msg)
+	expect.Equal(core.FilterResultMessageAccept, result)
+
+	msg = core.NewMessage(nil, []byte(`{"event":"login","user":{}}`), nil, core.InvalidStreamID)
+	result, _ = formatter.ApplyFilter(msg)
+	expect.Equal(core.FilterResultMessageReject(core.InvalidStreamID), result)
+}
+
+func TestJSONValidateConfigErrors(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-jsonvalidate")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	invalid := filepath.Join(dir, "invalid.json")
+	expect.NoError(ioutil.WriteFile(invalid, []byte(`{"type": 42}`), 0644))
+
+	for _, schema := range []string{filepath.Join(dir, "missing.json"), invalid} {
+		config := core.NewPluginConfig("", "format.JSONValidate")
+		config.Override("Schema", schema)
+		_, err := core.NewPluginWithConfig(config)
+		expect.NotNil(err)
+	}
+}
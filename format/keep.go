@@ -0,0 +1,107 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+)
+
+// Keep formatter
+//
+// This formatter removes all metadata fields that are not listed in Fields.
+// It is the inverse of format.Delete and can be used to strip unexpected or
+// noisy fields before indexing. Like all formatters, Keep is applied in the
+// order given in the modulator list, i.e. fields renamed by a format.Move
+// listed before Keep have to be listed with their new name.
+//
+// Parameters
+//
+// - Fields: Defines the list of fields to keep. Fields can be paths like "a/b"
+// to keep only parts of a nested map. Array elements cannot be addressed.
+// By default this parameter is set to an empty list.
+//
+// - Target: Defines the metadata map to remove fields from. Use "" to filter
+// the top level of the metadata.
+// By default this parameter is set to "".
+//
+// Examples
+//
+// This example parses the payload as JSON and removes all fields but the
+// timestamp, the message and the user id.
+//
+//  exampleConsumer:
+//    Type: consumer.Console
+//    Streams: stdin
+//    Modulators:
+//      - format.JSON
+//      - format.Keep:
+//        Fields:
+//          - timestamp
+//          - message
+//          - user/id
+type Keep struct {
+	core.SimpleFormatter `gollumdoc:"embed_type"`
+	fields               []string `config:"Fields"`
+}
+
+func init() {
+	core.TypeRegistry.Register(Keep{})
+}
+
+// Configure initializes this formatter with values from a plugin config.
+func (format *Keep) Configure(conf core.PluginConfigReader) {
+}
+
+// ApplyFormatter update message payload
+func (format *Keep) ApplyFormatter(msg *core.Message) error {
+	metadata := msg.TryGetMetadata()
+	if metadata == nil {
+		return nil // ### return, nothing to remove ###
+	}
+
+	if format.TargetIsMetadata() {
+		if _, exists := core.GetValuePath(metadata, format.GetTargetKey()); !exists {
+			return nil // ### return, nothing to remove ###
+		}
+	}
+
+	root, err := format.GetTargetAsMetadata(msg)
+	if err != nil {
+		return err
+	}
+
+	kept := tcontainer.MarshalMap{}
+	for _, field := range format.fields {
+		if value, exists := core.GetValuePath(root, field); exists {
+			core.SetValuePath(kept, field, value)
+		}
+	}
+
+	for key := range root {
+		delete(root, key)
+	}
+	for key, value := range kept {
+		root[key] = value
+	}
+
+	// Nested maps of other types are converted to a copy, so the result has to
+	// be stored again.
+	if format.TargetIsMetadata() {
+		format.SetTargetData(msg, root)
+	}
+	return nil
+}
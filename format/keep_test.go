@@ -0,0 +1,149 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestKeep(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Keep")
+	config.Override("Fields", []string{"message", "user/id", "missing"})
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Keep)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("payload"), tcontainer.MarshalMap{
+		"message": "hello",
+		"level":   "debug",
+		"user": tcontainer.MarshalMap{
+			"id":   "42",
+			"name": "gollum",
+		},
+		"host": tcontainer.MarshalMap{
+			"name": "localhost",
+		},
+	}, core.InvalidStreamID)
+
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal(tcontainer.MarshalMap{
+		"message": "hello",
+		"user": tcontainer.MarshalMap{
+			"id": "42",
+		},
+	}, msg.GetMetadata())
+	expect.Equal("payload", msg.String())
+}
+
+func TestKeepTarget(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Keep")
+	config.Override("Target", "request")
+	config.Override("Fields", []string{"method", "headers/host"})
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Keep)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("payload"), tcontainer.MarshalMap{
+		"level": "debug",
+		"request": map[string]interface{}{
+			"method": "GET",
+			"path":   "/",
+			"headers": map[string]interface{}{
+				"host":   "localhost",
+				"cookie": "secret",
+			},
+		},
+	}, core.InvalidStreamID)
+
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal("debug", msg.GetMetadata()["level"])
+
+	request, err := msg.GetMetadata().MarshalMap("request")
+	expect.NoError(err)
+	expect.Equal(2, len(request))
+	expect.Equal("GET", request["method"])
+
+	headers, err := request.MarshalMap("headers")
+	expect.NoError(err)
+	expect.Equal(1, len(headers))
+	expect.Equal("localhost", headers["host"])
+
+	// A missing target is not created
+	msg = core.NewMessage(nil, []byte("payload"), tcontainer.MarshalMap{}, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal(0, len(msg.GetMetadata()))
+}
+
+func TestKeepAfterMove(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Move")
+	config.Override("Source", "msg")
+	config.Override("Target", "message")
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	move, casted := plugin.(*Move)
+	expect.True(casted)
+
+	config = core.NewPluginConfig("", "format.Keep")
+	config.Override("Fields", []string{"message"})
+	plugin, err = core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	keep, casted := plugin.(*Keep)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("payload"), tcontainer.MarshalMap{
+		"msg":   "hello",
+		"level": "debug",
+	}, core.InvalidStreamID)
+
+	// Keep sees the renamed field when applied after Move
+	modulators := core.ModulatorArray{
+		core.NewFormatterModulator(move),
+		core.NewFormatterModulator(keep),
+	}
+	expect.Equal(core.ModulateResultContinue, modulators.Modulate(msg))
+	expect.Equal(tcontainer.MarshalMap{"message": "hello"}, msg.GetMetadata())
+
+	msg = core.NewMessage(nil, []byte("payload"), tcontainer.MarshalMap{
+		"msg":   "hello",
+		"level": "debug",
+	}, core.InvalidStreamID)
+
+	// Applied before Move, the original field has already been removed
+	modulators = core.ModulatorArray{
+		core.NewFormatterModulator(keep),
+		core.NewFormatterModulator(move),
+	}
+	expect.Equal(core.ModulateResultContinue, modulators.Modulate(msg))
+	expect.Equal("", core.ConvertToString(msg.GetMetadata()["message"]))
+	_, exists := msg.GetMetadata().Value("level")
+	expect.False(exists)
+}
@@ -0,0 +1,113 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"unicode/utf8"
+
+	"gollum/core"
+)
+
+// Mask formatter
+//
+// This formatter partially redacts a string by replacing all characters
+// between a visible prefix and suffix with a mask character, e.g. to keep
+// the last four digits of a credit card number. Values that are not longer
+// than the visible prefix and suffix combined are masked completely.
+// Characters are counted as unicode code points. Non-string values are left
+// unchanged.
+//
+// Parameters
+//
+// - KeepPrefix: Defines the number of characters at the start of the value
+// that stay visible.
+// By default this parameter is set to "0".
+//
+// - KeepSuffix: Defines the number of characters at the end of the value
+// that stay visible.
+// By default this parameter is set to "4".
+//
+// - MaskChar: Defines the character used to replace hidden characters. Only
+// the first character of this string is used.
+// By default this parameter is set to "*".
+//
+// Examples
+//
+// This example parses the payload as JSON and masks all but the last four
+// digits of the "card/number" field.
+//
+//  exampleConsumer:
+//    Type: consumer.Console
+//    Streams: stdin
+//    Modulators:
+//      - format.JSON
+//      - format.Mask:
+//        ApplyTo: card/number
+//        KeepSuffix: 4
+type Mask struct {
+	core.SimpleFormatter `gollumdoc:"embed_type"`
+	keepPrefix           int    `config:"KeepPrefix" default:"0"`
+	keepSuffix           int    `config:"KeepSuffix" default:"4"`
+	maskString           string `config:"MaskChar" default:"*"`
+	maskChar             rune
+}
+
+func init() {
+	core.TypeRegistry.Register(Mask{})
+}
+
+// Configure initializes this formatter with values from a plugin config.
+func (format *Mask) Configure(conf core.PluginConfigReader) {
+	if format.keepPrefix < 0 || format.keepSuffix < 0 {
+		conf.Errors.Pushf("KeepPrefix and KeepSuffix must not be negative")
+	}
+
+	format.maskChar, _ = utf8.DecodeRuneInString(format.maskString)
+	if format.maskChar == utf8.RuneError {
+		conf.Errors.Pushf("MaskChar must be a valid character")
+	}
+}
+
+// mask replaces all characters but the visible prefix and suffix.
+func (format *Mask) mask(value string) string {
+	chars := []rune(value)
+	start, end := format.keepPrefix, len(chars)-format.keepSuffix
+	if start >= end {
+		start, end = 0, len(chars)
+	}
+
+	for idx := start; idx < end; idx++ {
+		chars[idx] = format.maskChar
+	}
+	return string(chars)
+}
+
+// ApplyFormatter update message payload
+func (format *Mask) ApplyFormatter(msg *core.Message) error {
+	switch value := format.GetSourceData(msg).(type) {
+	case string:
+		format.SetTargetData(msg, format.mask(value))
+
+	case []byte:
+		format.SetTargetData(msg, []byte(format.mask(string(value))))
+
+	case nil:
+		// Nothing to mask
+
+	default:
+		format.Logger.Debugf("Skipping non-string value of type %T", value)
+	}
+	return nil
+}
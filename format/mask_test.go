@@ -0,0 +1,110 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestMaskPayload(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Mask")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Mask)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("4111111111111111"), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal("************1111", msg.String())
+}
+
+func TestMaskBoundaries(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Mask")
+	config.Override("KeepPrefix", 2)
+	config.Override("KeepSuffix", 2)
+	config.Override("MaskChar", "#")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Mask)
+	expect.True(casted)
+
+	for value, expected := range map[string]string{
+		"":       "",
+		"a":      "#",
+		"abcd":   "####",
+		"abcde":  "ab#de",
+		"abcdef": "ab##ef",
+		"äöüßéè": "äö##éè",
+	} {
+		msg := core.NewMessage(nil, []byte(value), nil, core.InvalidStreamID)
+		expect.NoError(formatter.ApplyFormatter(msg))
+		expect.Equal(expected, msg.String())
+	}
+}
+
+func TestMaskMetadata(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Mask")
+	config.Override("ApplyTo", "card/number")
+	config.Override("KeepPrefix", 1)
+	config.Override("KeepSuffix", 0)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Mask)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("payload"), tcontainer.MarshalMap{
+		"card": tcontainer.MarshalMap{"number": "1234"},
+	}, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+
+	value, exists := core.GetValuePath(msg.GetMetadata(), "card/number")
+	expect.True(exists)
+	expect.Equal("1***", value)
+	expect.Equal("payload", msg.String())
+
+	// Non-string values are skipped
+	msg = core.NewMessage(nil, []byte("payload"), tcontainer.MarshalMap{
+		"card": tcontainer.MarshalMap{"number": 1234},
+	}, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	value, _ = core.GetValuePath(msg.GetMetadata(), "card/number")
+	expect.Equal(1234, value)
+}
+
+func TestMaskInvalidConfig(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Mask")
+	config.Override("KeepPrefix", -1)
+	_, err := core.NewPluginWithConfig(config)
+	expect.NotNil(err)
+}
@@ -0,0 +1,252 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package format
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+)
+
+const (
+	metricMissingSkip = "skip"
+	metricMissingZero = "zero"
+	metricMissingFail = "fail"
+)
+
+// MetricExtract formatter
+//
+// This formatter extracts numeric measurements from a JSON payload or from
+// the named groups of a regular expression. The result is stored in the
+// metadata fields "measurement", "tags", "fields" and "time", as used by
+// producer.InfluxDB with LineFromMetadata enabled. The payload is not
+// changed.
+// Messages that are not valid JSON or do not match Expression are passed
+// through unchanged.
+//
+// Parameters
+//
+// - Expression: Defines a regular expression with named groups, e.g.
+// "(?P<status>\d+) (?P<bytes>\d+)$". If set, sources refer to group names.
+// If empty, the payload is parsed as JSON and sources refer to JSON fields.
+// Nested fields can be addressed by a path like "response/status".
+// By default this parameter is set to "".
+//
+// - Measurement: Defines the measurement name. If empty, the name of the
+// message's stream is used.
+// By default this parameter is set to "".
+//
+// - MeasurementFrom: Defines the source of the measurement name. If set and
+// present, this value overrides Measurement.
+// By default this parameter is set to "".
+//
+// - Fields: Defines a map of field names to sources. Values are converted to
+// integers or floating point numbers.
+// By default this parameter is set to an empty map.
+//
+// - Tags: Defines a map of tag names to sources. Values are stored as strings.
+// Missing tags are not set.
+// By default this parameter is set to an empty map.
+//
+// - Missing: Defines how fields that are missing or not numeric are handled.
+// Set to "skip" to leave out the field, "zero" to set the field to 0 or "fail"
+// to discard the message.
+// By default this parameter is set to "skip".
+//
+// - TimeFrom: Defines the source of the timestamp. If empty or missing, the
+// message creation time is used.
+// By default this parameter is set to "".
+//
+// - TimeFormat: Defines the Go time format of the timestamp read from
+// TimeFrom. If empty, the timestamp is expected to be a unix timestamp in
+// milliseconds.
+// By default this parameter is set to "".
+//
+// Examples
+//
+// This example extracts status code and response size from access log lines.
+//
+//  exampleConsumer:
+//    Type: consumer.Console
+//    Streams: accesslog
+//    Modulators:
+//      - format.MetricExtract:
+//        Measurement: requests
+//        Expression: "\\[(?P<time>[^\\]]+)\\] \"(?P<method>\\w+) [^\"]+\" (?P<status>\\d+) (?P<bytes>\\d+)"
+//        TimeFrom: time
+//        TimeFormat: "02/Jan/2006:15:04:05 -0700"
+//        Tags:
+//          method: method
+//          status: status
+//        Fields:
+//          bytes: bytes
+type MetricExtract struct {
+	core.SimpleFormatter `gollumdoc:"embed_type"`
+	measurement          string `config:"Measurement"`
+	measurementFrom      string `config:"MeasurementFrom"`
+	missing              string `config:"Missing" default:"skip"`
+	timeFrom             string `config:"TimeFrom"`
+	timeFormat           string `config:"TimeFormat"`
+	expression           *regexp.Regexp
+	fields               map[string]string
+	tags                 map[string]string
+}
+
+func init() {
+	core.TypeRegistry.Register(MetricExtract{})
+}
+
+// Configure initializes this formatter with values from a plugin config.
+func (format *MetricExtract) Configure(conf core.PluginConfigReader) {
+	format.fields = conf.GetStringMap("Fields", map[string]string{})
+	format.tags = conf.GetStringMap("Tags", map[string]string{})
+
+	format.missing = strings.ToLower(format.missing)
+	switch format.missing {
+	case metricMissingSkip, metricMissingZero, metricMissingFail:
+	default:
+		conf.Errors.Pushf("Missing must be one of skip, zero or fail")
+	}
+
+	format.expression = conf.GetRegexp("Expression", "")
+}
+
+// getValues returns the values sources are resolved against or false if
+// the payload could not be parsed.
+func (format *MetricExtract) getValues(payload []byte) (tcontainer.MarshalMap, bool) {
+	if format.expression == nil {
+		var values tcontainer.MarshalMap
+		decoder := json.NewDecoder(bytes.NewReader(payload))
+		decoder.UseNumber()
+		if err := decoder.Decode(&values); err != nil {
+			return nil, false
+		}
+		return values, true
+	}
+
+	match := format.expression.FindSubmatch(payload)
+	if match == nil {
+		return nil, false
+	}
+
+	values := tcontainer.NewMarshalMap()
+	for idx, name := range format.expression.SubexpNames() {
+		if name != "" && match[idx] != nil {
+			values[name] = string(match[idx])
+		}
+	}
+	return values, true
+}
+
+// toMetricValue converts the given value to int64 or float64.
+func toMetricValue(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case int64, float64:
+		return v, true
+	case bool, nil:
+		return nil, false
+	}
+
+	str := strings.TrimSpace(core.ConvertToString(value))
+	if number, err := strconv.ParseInt(str, 10, 64); err == nil {
+		return number, true
+	}
+	if number, err := strconv.ParseFloat(str, 64); err == nil {
+		return number, true
+	}
+	return nil, false
+}
+
+// getTime returns the timestamp of the message in unix milliseconds.
+func (format *MetricExtract) getTime(msg *core.Message, values tcontainer.MarshalMap) (int64, error) {
+	value, exists := core.GetValuePath(values, format.timeFrom)
+	if format.timeFrom == "" || !exists {
+		return msg.GetCreationTime().UnixNano() / int64(time.Millisecond), nil
+	}
+
+	str := core.ConvertToString(value)
+	if format.timeFormat == "" {
+		return strconv.ParseInt(str, 10, 64)
+	}
+
+	timestamp, err := time.Parse(format.timeFormat, str)
+	if err != nil {
+		return 0, err
+	}
+	return timestamp.UnixNano() / int64(time.Millisecond), nil
+}
+
+// ApplyFormatter update message payload
+func (format *MetricExtract) ApplyFormatter(msg *core.Message) error {
+	values, isValid := format.getValues(format.GetSourceDataAsBytes(msg))
+	if !isValid {
+		return nil // ### return, nothing to extract ###
+	}
+
+	fields := tcontainer.NewMarshalMap()
+	for name, source := range format.fields {
+		value, exists := core.GetValuePath(values, source)
+		if exists {
+			value, exists = toMetricValue(value)
+		}
+
+		switch {
+		case exists:
+			fields[name] = value
+		case format.missing == metricMissingZero:
+			fields[name] = int64(0)
+		case format.missing == metricMissingFail:
+			return fmt.Errorf("field %s is missing or not numeric", name)
+		}
+	}
+
+	tags := tcontainer.NewMarshalMap()
+	for name, source := range format.tags {
+		if value, exists := core.GetValuePath(values, source); exists && value != nil {
+			tags[name] = core.ConvertToString(value)
+		}
+	}
+
+	timestamp, err := format.getTime(msg, values)
+	if err != nil {
+		return err
+	}
+
+	measurement := format.measurement
+	if measurement == "" {
+		measurement = msg.GetStreamID().GetName()
+	}
+	if format.measurementFrom != "" {
+		if value, exists := core.GetValuePath(values, format.measurementFrom); exists {
+			measurement = core.ConvertToString(value)
+		}
+	}
+
+	metadata := msg.GetMetadata()
+	metadata["measurement"] = measurement
+	metadata["tags"] = tags
+	metadata["fields"] = fields
+	metadata["time"] = timestamp
+	return nil
+}
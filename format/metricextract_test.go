@@ -0,0 +1,148 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestMetricExtractJSON(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.MetricExtract")
+	config.Override("MeasurementFrom", "type")
+	config.Override("TimeFrom", "ts")
+	config.Override("Fields", map[string]string{
+		"status":   "response/status",
+		"duration": "response/duration",
+		"size":     "response/size",
+		"host":     "host",
+	})
+	config.Override("Tags", map[string]string{
+		"host":   "host",
+		"region": "region",
+	})
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*MetricExtract)
+	expect.True(casted)
+
+	payload := `{"type":"requests","host":"web01","ts":1500000000000,"response":{"status":200,"duration":"0.25"}}`
+	msg := core.NewMessage(nil, []byte(payload), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal(payload, msg.String())
+
+	metadata := msg.GetMetadata()
+	expect.Equal("requests", metadata["measurement"])
+	expect.Equal(int64(1500000000000), metadata["time"])
+	expect.Equal(tcontainer.MarshalMap{"host": "web01"}, metadata["tags"])
+	expect.Equal(tcontainer.MarshalMap{"status": int64(200), "duration": 0.25}, metadata["fields"])
+}
+
+func TestMetricExtractRegex(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.MetricExtract")
+	config.Override("Measurement", "requests")
+	config.Override("Expression", `\[(?P<time>[^\]]+)\] "(?P<method>\w+) [^"]+" (?P<status>\d+) (?P<bytes>\d+|-)`)
+	config.Override("TimeFrom", "time")
+	config.Override("TimeFormat", "02/Jan/2006:15:04:05 -0700")
+	config.Override("Tags", map[string]string{"method": "method"})
+	config.Override("Fields", map[string]string{"status": "status", "bytes": "bytes"})
+	config.Override("Missing", "zero")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*MetricExtract)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte(`[10/Oct/2000:13:55:36 -0700] "GET /index.html HTTP/1.0" 200 -`), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+
+	timestamp, _ := time.Parse(time.RFC3339, "2000-10-10T13:55:36-07:00")
+	metadata := msg.GetMetadata()
+	expect.Equal("requests", metadata["measurement"])
+	expect.Equal(timestamp.Unix()*1000, metadata["time"])
+	expect.Equal(tcontainer.MarshalMap{"method": "GET"}, metadata["tags"])
+	expect.Equal(tcontainer.MarshalMap{"status": int64(200), "bytes": int64(0)}, metadata["fields"])
+
+	// Messages not matching are passed through
+	msg = core.NewMessage(nil, []byte("no match"), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal(0, len(msg.GetMetadata()))
+}
+
+func TestMetricExtractMissing(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.MetricExtract")
+	config.Override("Fields", map[string]string{"load": "load", "cpu": "cpu"})
+	config.Override("Missing", "fail")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*MetricExtract)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte(`{"load":1.5}`), nil, core.StreamRegistry.GetStreamID("system"))
+	expect.NotNil(formatter.ApplyFormatter(msg))
+
+	msg = core.NewMessage(nil, []byte(`{"load":1.5,"cpu":"high"}`), nil, core.InvalidStreamID)
+	expect.NotNil(formatter.ApplyFormatter(msg))
+
+	config = core.NewPluginConfig("", "format.MetricExtract")
+	config.Override("Fields", map[string]string{"load": "load", "cpu": "cpu"})
+
+	plugin, err = core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted = plugin.(*MetricExtract)
+	expect.True(casted)
+
+	msg = core.NewMessage(nil, []byte(`{"load":1.5}`), nil, core.StreamRegistry.GetStreamID("system"))
+	expect.NoError(formatter.ApplyFormatter(msg))
+
+	metadata := msg.GetMetadata()
+	expect.Equal("system", metadata["measurement"])
+	expect.Equal(msg.GetCreationTime().UnixNano()/int64(time.Millisecond), metadata["time"])
+	expect.Equal(tcontainer.MarshalMap{"load": 1.5}, metadata["fields"])
+}
+
+func TestMetricExtractConfigErrors(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	for idx, settings := range []map[string]interface{}{
+		{"Missing": "unknown"},
+		{"Expression": "("},
+	} {
+		config := core.NewPluginConfig(fmt.Sprintf("metricExtract%d", idx), "format.MetricExtract")
+		for key, value := range settings {
+			config.Override(key, value)
+		}
+		_, err := core.NewPluginWithConfig(config)
+		expect.NotNil(err)
+	}
+}
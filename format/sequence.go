@@ -15,7 +15,13 @@
 package format
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 
 	"gollum/core"
@@ -26,13 +32,33 @@ import (
 // This formatter prefixes data with a sequence number managed by the
 // formatter. All messages passing through an instance of the
 // formatter will get a unique number. The number is not persisted,
-// i.e. it restarts at 0 after each restart of gollum.
+// i.e. it restarts at 0 after each restart of gollum, unless PersistFile
+// is set.
 //
 // Parameters
 //
 // - Separator: Defines the separator string placed between number and data.
 // By default this parameter is set to ":".
 //
+// - SequenceField: When set, the sequence number is stored in this metadata
+// field instead of being prefixed to the data.
+// By default this parameter is set to "".
+//
+// - Scope: Defines whether all messages share one sequence ("global") or if
+// each stream gets its own sequence ("stream").
+// By default this parameter is set to "global".
+//
+// - PersistFile: When set, the sequence numbers are stored in this file and
+// continue after a restart. To avoid writing the file for every message,
+// the formatter reserves PersistGap numbers in advance. After a restart the
+// sequence continues after the last reserved number, so gaps may occur but
+// numbers are never reused.
+// By default this parameter is set to "".
+//
+// - PersistGap: Defines the number of sequence numbers reserved with each
+// write of PersistFile.
+// By default this parameter is set to "1000".
+//
 // Examples
 //
 // This example will insert the sequence number into an existing JSON payload.
@@ -49,10 +75,33 @@ import (
 //      - format.Envelope:
 //        Prefix: "{\"seq\":"
 //        Postfix: "}"
+//
+// This example stores a per-stream sequence number that survives restarts
+// in the metadata field "seq".
+//
+//  exampleConsumer:
+//    Type: consumer.Console
+//    Streams: "*"
+//    Modulators:
+//      - format.Sequence:
+//        SequenceField: seq
+//        Scope: stream
+//        PersistFile: /var/gollum/sequence.json
 type Sequence struct {
 	core.SimpleFormatter `gollumdoc:"embed_type"`
 	separator            []byte `config:"Separator" default:":"`
-	seq                  *int64
+	field                string `config:"SequenceField"`
+	persistFile          string `config:"PersistFile"`
+	persistGap           int64  `config:"PersistGap" default:"1000"`
+	perStream            bool
+	counters             map[core.MessageStreamID]*sequenceCounter
+	countersGuard        *sync.RWMutex
+	persistGuard         *sync.Mutex
+}
+
+type sequenceCounter struct {
+	value    int64
+	reserved int64
 }
 
 func init() {
@@ -61,13 +110,41 @@ func init() {
 
 // Configure initializes this formatter with values from a plugin config.
 func (format *Sequence) Configure(conf core.PluginConfigReader) {
-	format.seq = new(int64)
+	format.counters = make(map[core.MessageStreamID]*sequenceCounter)
+	format.countersGuard = new(sync.RWMutex)
+	format.persistGuard = new(sync.Mutex)
+
+	switch scope := strings.ToLower(conf.GetString("Scope", "global")); scope {
+	case "global":
+		format.perStream = false
+	case "stream":
+		format.perStream = true
+	default:
+		conf.Errors.Pushf("Unknown scope \"%s\"", scope)
+	}
+
+	if format.persistGap < 1 {
+		conf.Errors.Pushf("PersistGap must be greater than 0")
+	}
+
+	if format.persistFile != "" {
+		conf.Errors.Push(format.loadSequences())
+	}
 }
 
 // ApplyFormatter update message payload
 func (format *Sequence) ApplyFormatter(msg *core.Message) error {
-	seq := atomic.AddInt64(format.seq, 1)
+	seq, err := format.next(msg.GetStreamID())
+	if err != nil {
+		return err
+	}
 	sequenceStr := strconv.FormatInt(seq, 10)
+
+	if format.field != "" {
+		msg.GetMetadata().Set(format.field, sequenceStr)
+		return nil
+	}
+
 	content := format.GetSourceDataAsBytes(msg)
 
 	dataSize := len(sequenceStr) + len(format.separator) + len(content)
@@ -80,3 +157,104 @@ func (format *Sequence) ApplyFormatter(msg *core.Message) error {
 	format.SetTargetData(msg, payload)
 	return nil
 }
+
+// next returns the next sequence number for the given stream and reserves
+// new numbers in the persist file if necessary.
+func (format *Sequence) next(streamID core.MessageStreamID) (int64, error) {
+	if !format.perStream {
+		streamID = core.WildcardStreamID
+	}
+
+	counter := format.getCounter(streamID)
+	seq := atomic.AddInt64(&counter.value, 1)
+
+	if format.persistFile == "" || seq <= atomic.LoadInt64(&counter.reserved) {
+		return seq, nil // ### return, no need to persist ###
+	}
+
+	format.persistGuard.Lock()
+	defer format.persistGuard.Unlock()
+
+	if seq <= atomic.LoadInt64(&counter.reserved) {
+		return seq, nil // ### return, reserved by another call ###
+	}
+
+	atomic.StoreInt64(&counter.reserved, seq+format.persistGap)
+	if err := format.storeSequences(); err != nil {
+		format.Logger.WithError(err).Error("Failed to write sequence file")
+		return 0, err
+	}
+	return seq, nil
+}
+
+func (format *Sequence) getCounter(streamID core.MessageStreamID) *sequenceCounter {
+	format.countersGuard.RLock()
+	counter, exists := format.counters[streamID]
+	format.countersGuard.RUnlock()
+
+	if exists {
+		return counter // ### return, known stream ###
+	}
+
+	format.countersGuard.Lock()
+	defer format.countersGuard.Unlock()
+
+	if counter, exists = format.counters[streamID]; !exists {
+		counter = new(sequenceCounter)
+		format.counters[streamID] = counter
+	}
+	return counter
+}
+
+// loadSequences reads the reserved sequence numbers from the persist file.
+// A missing file is not treated as an error.
+func (format *Sequence) loadSequences() error {
+	data, err := ioutil.ReadFile(format.persistFile)
+	if os.IsNotExist(err) {
+		return nil // ### return, first start ###
+	}
+	if err != nil {
+		return err
+	}
+
+	sequences := make(map[string]int64)
+	if err := json.Unmarshal(data, &sequences); err != nil {
+		return err
+	}
+
+	for streamName, reserved := range sequences {
+		format.counters[core.StreamRegistry.GetStreamID(streamName)] = &sequenceCounter{
+			value:    reserved,
+			reserved: reserved,
+		}
+	}
+	return nil
+}
+
+// storeSequences atomically replaces the persist file with the reserved
+// sequence numbers of all streams. This function has to be called while
+// persistGuard is locked.
+func (format *Sequence) storeSequences() error {
+	sequences := make(map[string]int64)
+
+	format.countersGuard.RLock()
+	for streamID, counter := range format.counters {
+		sequences[streamID.GetName()] = atomic.LoadInt64(&counter.reserved)
+	}
+	format.countersGuard.RUnlock()
+
+	data, err := json.Marshal(sequences)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(format.persistFile), 0755); err != nil {
+		return err
+	}
+
+	tmpFile := format.persistFile + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, format.persistFile)
+}
@@ -15,6 +15,11 @@
 package format
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
 	"testing"
 
 	"gollum/core"
@@ -90,3 +95,144 @@ func TestSequenceTargetNoSeparator(t *testing.T) {
 	expect.Equal("PAYLOAD", string(msg.GetPayload()))
 	expect.Equal("1", string(foo))
 }
+
+func getSequenceField(t *testing.T, formatter *Sequence, streamID core.MessageStreamID) string {
+	expect := ttesting.NewExpect(t)
+
+	msg := core.NewMessage(nil, []byte("test"), nil, streamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal("test", string(msg.GetPayload()))
+
+	seq, err := msg.GetMetadata().String("seq")
+	expect.NoError(err)
+	return seq
+}
+
+func TestSequenceConcurrent(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Sequence")
+	config.Override("SequenceField", "seq")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Sequence)
+	expect.True(casted)
+
+	numWorkers := 8
+	numMessages := 1000
+	results := make(chan string, numWorkers*numMessages)
+	workers := new(sync.WaitGroup)
+
+	for w := 0; w < numWorkers; w++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for i := 0; i < numMessages; i++ {
+				msg := core.NewMessage(nil, []byte("test"), nil, core.InvalidStreamID)
+				formatter.ApplyFormatter(msg)
+				seq, _ := msg.GetMetadata().String("seq")
+				results <- seq
+			}
+		}()
+	}
+	workers.Wait()
+	close(results)
+
+	seen := make(map[string]bool)
+	for seq := range results {
+		expect.False(seen[seq])
+		seen[seq] = true
+	}
+
+	for i := 1; i <= numWorkers*numMessages; i++ {
+		expect.True(seen[strconv.Itoa(i)])
+	}
+}
+
+func TestSequenceScope(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	streamA := core.StreamRegistry.GetStreamID("a")
+	streamB := core.StreamRegistry.GetStreamID("b")
+
+	config := core.NewPluginConfig("", "format.Sequence")
+	config.Override("SequenceField", "seq")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	global, casted := plugin.(*Sequence)
+	expect.True(casted)
+
+	expect.Equal("1", getSequenceField(t, global, streamA))
+	expect.Equal("2", getSequenceField(t, global, streamB))
+	expect.Equal("3", getSequenceField(t, global, streamA))
+
+	config = core.NewPluginConfig("", "format.Sequence")
+	config.Override("SequenceField", "seq")
+	config.Override("Scope", "stream")
+
+	plugin, err = core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	perStream, casted := plugin.(*Sequence)
+	expect.True(casted)
+
+	expect.Equal("1", getSequenceField(t, perStream, streamA))
+	expect.Equal("1", getSequenceField(t, perStream, streamB))
+	expect.Equal("2", getSequenceField(t, perStream, streamA))
+
+	config = core.NewPluginConfig("", "format.Sequence")
+	config.Override("Scope", "foo")
+	_, err = core.NewPluginWithConfig(config)
+	expect.NotNil(err)
+}
+
+func TestSequencePersistFile(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-sequence")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	streamA := core.StreamRegistry.GetStreamID("a")
+	streamB := core.StreamRegistry.GetStreamID("b")
+
+	config := core.NewPluginConfig("", "format.Sequence")
+	config.Override("SequenceField", "seq")
+	config.Override("Scope", "stream")
+	config.Override("PersistFile", filepath.Join(dir, "sequence.json"))
+	config.Override("PersistGap", 10)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Sequence)
+	expect.True(casted)
+
+	for i := 1; i <= 12; i++ {
+		expect.Equal(strconv.Itoa(i), getSequenceField(t, formatter, streamA))
+	}
+	expect.Equal("1", getSequenceField(t, formatter, streamB))
+
+	// A restart continues after the last reserved number
+	plugin, err = core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted = plugin.(*Sequence)
+	expect.True(casted)
+
+	expect.Equal("23", getSequenceField(t, formatter, streamA))
+	expect.Equal("12", getSequenceField(t, formatter, streamB))
+
+	plugin, err = core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted = plugin.(*Sequence)
+	expect.True(casted)
+
+	expect.Equal("34", getSequenceField(t, formatter, streamA))
+	expect.Equal("23", getSequenceField(t, formatter, streamB))
+}
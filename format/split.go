@@ -12,6 +12,7 @@ import (
 // This formatter splits data into an array by using the given delimiter and
 // stores it at the metadata key denoted by target. Targeting the payload (by
 // not given a target or passing an empty string) will result in an error.
+// Use router.Split to send each part as a message of its own.
 //
 // Parameters
 //
@@ -0,0 +1,124 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"regexp"
+
+	"gollum/core"
+)
+
+// SplitToMetadata formatter
+//
+// This formatter applies a regular expression with named capture groups to
+// the data and stores each named group as a metadata field of the same name.
+// It is a lightweight alternative to format.Grok for one-off patterns.
+// Optional groups that did not participate in the match are not set.
+//
+// Parameters
+//
+// - Expression: Defines the regular expression to apply. Only named groups,
+// i.e. groups written as "(?P<name>...)", are stored. If no expression is
+// set, an error is logged and messages are passed on unchanged.
+// By default this parameter is set to "".
+//
+// - RemoveMatch: When set to true, the matched part of the data is removed
+// from the source after the named groups have been stored.
+// By default this parameter is set to false.
+//
+// - ErrorField: When set, a message is written to this metadata field if the
+// expression does not match. When left empty, non-matching messages are
+// passed on unchanged.
+// By default this parameter is set to "".
+//
+// Examples
+//
+// This example extracts the log level and an optional request id into the
+// metadata fields "log/level" and "log/request" and removes the prefix
+// containing both from the payload.
+//
+//  ExampleConsumer:
+//    Type: consumer.Console
+//    Streams: console
+//    Modulators:
+//      - format.SplitToMetadata:
+//        Target: log
+//        Expression: "^\\[(?P<level>[A-Z]+)\\](?: req=(?P<request>\\S+))? "
+//        RemoveMatch: true
+//        ErrorField: log_error
+type SplitToMetadata struct {
+	core.SimpleFormatter `gollumdoc:"embed_type"`
+	removeMatch          bool   `config:"RemoveMatch" default:"false"`
+	errorField           string `config:"ErrorField"`
+	expression           *regexp.Regexp
+	groups               []string
+}
+
+func init() {
+	core.TypeRegistry.Register(SplitToMetadata{})
+}
+
+// Configure initializes this formatter with values from a plugin config.
+func (format *SplitToMetadata) Configure(conf core.PluginConfigReader) {
+	format.expression = conf.GetRegexp("Expression", "")
+	if format.expression == nil {
+		format.Logger.Error("setting an Expression is mandatory")
+		return
+	}
+
+	format.groups = format.expression.SubexpNames()
+	hasNamedGroup := false
+	for _, name := range format.groups {
+		hasNamedGroup = hasNamedGroup || name != ""
+	}
+	if !hasNamedGroup {
+		conf.Errors.Pushf("Expression does not contain named groups")
+	}
+}
+
+// ApplyFormatter update message payload
+func (format *SplitToMetadata) ApplyFormatter(msg *core.Message) error {
+	if format.expression == nil {
+		return nil // ### return, not configured ###
+	}
+
+	data := format.GetSourceDataAsString(msg)
+	matches := format.expression.FindStringSubmatchIndex(data)
+	if matches == nil {
+		if format.errorField != "" {
+			msg.GetMetadata().Set(format.errorField, "expression did not match")
+		}
+		return nil // ### return, no match ###
+	}
+
+	tree := format.ForceTargetAsMetadata(msg)
+	for idx, name := range format.groups {
+		start, end := matches[2*idx], matches[2*idx+1]
+		if name == "" || start < 0 {
+			continue // ### continue, unnamed or optional group ###
+		}
+		tree.Set(name, data[start:end])
+	}
+
+	if format.removeMatch {
+		remainder := data[:matches[0]] + data[matches[1]:]
+		if format.SourceIsMetadata() {
+			format.SetSourceData(msg, remainder)
+		} else {
+			format.SetSourceData(msg, []byte(remainder))
+		}
+	}
+	return nil
+}
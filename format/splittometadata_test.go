@@ -0,0 +1,138 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestSplitToMetadataGroups(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.SplitToMetadata")
+	config.Override("Target", "log")
+	config.Override("Expression", `^\[(?P<level>[A-Z]+)\](?: req=(?P<request>\S+))? (?P<text>.*)$`)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*SplitToMetadata)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("[WARN] req=abc12 disk full"), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+
+	level, _ := msg.GetMetadata().String("log/level")
+	request, _ := msg.GetMetadata().String("log/request")
+	text, _ := msg.GetMetadata().String("log/text")
+	expect.Equal("WARN", level)
+	expect.Equal("abc12", request)
+	expect.Equal("disk full", text)
+	expect.Equal("[WARN] req=abc12 disk full", msg.String())
+
+	// Optional groups that did not match are not set
+	msg = core.NewMessage(nil, []byte("[INFO] started"), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+
+	level, _ = msg.GetMetadata().String("log/level")
+	expect.Equal("INFO", level)
+	_, exists := core.GetValuePath(msg.GetMetadata(), "log/request")
+	expect.False(exists)
+}
+
+func TestSplitToMetadataRemoveMatch(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.SplitToMetadata")
+	config.Override("Expression", `(?P<level>[A-Z]+): `)
+	config.Override("RemoveMatch", true)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*SplitToMetadata)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("12:00 ERROR: failed"), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+
+	level, _ := msg.GetMetadata().String("level")
+	expect.Equal("ERROR", level)
+	expect.Equal("12:00 failed", msg.String())
+}
+
+func TestSplitToMetadataNoMatch(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.SplitToMetadata")
+	config.Override("Expression", `^(?P<level>[A-Z]+): `)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*SplitToMetadata)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("no level"), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal(0, len(msg.GetMetadata()))
+	expect.Equal("no level", msg.String())
+
+	config = core.NewPluginConfig("", "format.SplitToMetadata")
+	config.Override("Expression", `^(?P<level>[A-Z]+): `)
+	config.Override("ErrorField", "error")
+
+	plugin, err = core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted = plugin.(*SplitToMetadata)
+	expect.True(casted)
+
+	msg = core.NewMessage(nil, []byte("no level"), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.MapEqual(msg.GetMetadata(), "error", "expression did not match")
+	expect.Equal("no level", msg.String())
+}
+
+func TestSplitToMetadataInvalidConfig(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	for _, expression := range []string{"([A-Z]+)", "(?P<level>"} {
+		config := core.NewPluginConfig("", "format.SplitToMetadata")
+		config.Override("Expression", expression)
+		_, err := core.NewPluginWithConfig(config)
+		expect.NotNil(err)
+	}
+}
+
+func TestSplitToMetadataNoExpression(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.SplitToMetadata")
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*SplitToMetadata)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("[INFO] test"), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal("[INFO] test", msg.String())
+	expect.Equal(0, len(msg.GetMetadata()))
+}
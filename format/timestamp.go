@@ -15,6 +15,10 @@
 package format
 
 import (
+	"fmt"
+	"strings"
+	"time"
+
 	"gollum/core"
 )
 
@@ -23,6 +27,8 @@ import (
 // Timestamp is a formatter that allows prefixing messages with a timestamp
 // (time of arrival at gollum). The timestamp format is freely configurable
 // and can e.g. contain a delimiter sequence at the end.
+// The time can be taken from the message creation time, the current time or
+// a metadata field and can be placed before or after the data or replace it.
 //
 // Parameters
 //
@@ -30,9 +36,31 @@ import (
 // ormat the timestamp.
 // By default this parameter is set to  "2006-01-02 15:04:05 MST | ".
 //
+// - TimeSource: Defines where the time is taken from. Set to "created" to use
+// the time the message was created, "now" to use the time the formatter is
+// applied or "metadata" to read the time from TimeField.
+// By default this parameter is set to "created".
+//
+// - TimeField: Defines the metadata key to read the time from if TimeSource is
+// set to "metadata". The value may be a time, a unix timestamp in seconds or a
+// string formatted as given by TimeFieldFormat.
+// By default this parameter is set to "".
+//
+// - TimeFieldFormat: Defines the Go time format string used to parse string
+// values of TimeField. When left empty, a unix timestamp is expected.
+// By default this parameter is set to "".
+//
+// - Timezone: Defines the timezone the timestamp is written in, e.g. "UTC" or
+// "Europe/Berlin". When left empty, the local timezone is used.
+// By default this parameter is set to "".
+//
+// - Position: Defines where the timestamp is placed. Set to "start" to prepend
+// it to the data, "end" to append it or "replace" to replace the data.
+// By default this parameter is set to "start".
+//
 // Examples
 //
-// This example will set a time string to the meta data field `time`:
+// This example will set a UTC time string to the meta data field `time`:
 //
 //  exampleConsumer:
 //    Type: consumer.Console
@@ -40,10 +68,30 @@ import (
 //    Modulators:
 //      - format.Timestamp:
 //        Timestamp: "2006-01-02T15:04:05.000 MST"
+//        Timezone: UTC
 //        Target: time
+//        Position: replace
+//
+// This example appends the time stored in the metadata field `sent` as unix
+// timestamp to the payload:
+//
+//  exampleConsumer:
+//    Type: consumer.Console
+//    Streams: "*"
+//    Modulators:
+//      - format.Timestamp:
+//        Timestamp: " @2006-01-02 15:04:05"
+//        TimeSource: metadata
+//        TimeField: sent
+//        Position: end
 type Timestamp struct {
 	core.SimpleFormatter `gollumdoc:"embed_type"`
 	timestampFormat      string `config:"Timestamp" default:"2006-01-02 15:04:05 MST | "`
+	timeField            string `config:"TimeField"`
+	timeFieldFormat      string `config:"TimeFieldFormat"`
+	getTime              func(msg *core.Message) (time.Time, error)
+	location             *time.Location
+	position             string
 }
 
 func init() {
@@ -52,18 +100,82 @@ func init() {
 
 // Configure initializes this formatter with values from a plugin config.
 func (format *Timestamp) Configure(conf core.PluginConfigReader) {
+	switch source := strings.ToLower(conf.GetString("TimeSource", "created")); source {
+	case "created":
+		format.getTime = format.getCreationTime
+	case "now":
+		format.getTime = format.getCurrentTime
+	case "metadata":
+		format.getTime = format.getMetadataTime
+		if format.timeField == "" {
+			conf.Errors.Pushf("TimeField must be set if TimeSource is metadata")
+		}
+	default:
+		conf.Errors.Pushf("Unknown TimeSource '%s'", source)
+	}
+
+	format.location = time.Local
+	if timezone := conf.GetString("Timezone", ""); timezone != "" {
+		location, err := time.LoadLocation(timezone)
+		if !conf.Errors.Push(err) {
+			format.location = location
+		}
+	}
+
+	format.position = strings.ToLower(conf.GetString("Position", "start"))
+	switch format.position {
+	case "start", "end", "replace":
+	default:
+		conf.Errors.Pushf("Unknown Position '%s'", format.position)
+	}
+}
+
+func (format *Timestamp) getCreationTime(msg *core.Message) (time.Time, error) {
+	return msg.GetCreationTime(), nil
+}
+
+func (format *Timestamp) getCurrentTime(msg *core.Message) (time.Time, error) {
+	return time.Now(), nil
+}
+
+func (format *Timestamp) getMetadataTime(msg *core.Message) (time.Time, error) {
+	value, exists := core.GetValuePath(msg.TryGetMetadata(), format.timeField)
+	if !exists {
+		return time.Time{}, fmt.Errorf("metadata field %s not found", format.timeField)
+	}
+
+	if t, isTime := value.(time.Time); isTime {
+		return t, nil
+	}
+	if format.timeFieldFormat == "" {
+		return numberToUnixtime(value)
+	}
+	return time.Parse(format.timeFieldFormat, string(core.ConvertToBytes(value)))
 }
 
 // ApplyFormatter update message payload
 func (format *Timestamp) ApplyFormatter(msg *core.Message) error {
-	timestampStr := msg.GetCreationTime().Format(format.timestampFormat)
-	content := format.GetSourceDataAsBytes(msg)
+	t, err := format.getTime(msg)
+	if err != nil {
+		return err
+	}
+
+	timestamp := []byte(t.In(format.location).Format(format.timestampFormat))
+	if format.position == "replace" {
+		format.SetTargetData(msg, timestamp)
+		return nil // ### return, timestamp only ###
+	}
 
-	dataSize := len(timestampStr) + len(content)
-	payload := make([]byte, dataSize)
+	content := format.GetSourceDataAsBytes(msg)
+	payload := make([]byte, 0, len(timestamp)+len(content))
 
-	offset := copy(payload, []byte(timestampStr))
-	copy(payload[offset:], content)
+	if format.position == "end" {
+		payload = append(payload, content...)
+		payload = append(payload, timestamp...)
+	} else {
+		payload = append(payload, timestamp...)
+		payload = append(payload, content...)
+	}
 
 	format.SetTargetData(msg, payload)
 	return nil
@@ -16,9 +16,11 @@ package format
 
 import (
 	"testing"
+	"time"
 
 	"gollum/core"
 
+	"github.com/trivago/tgo/tcontainer"
 	"github.com/trivago/tgo/ttesting"
 )
 
@@ -64,3 +66,115 @@ func TestTimestampTarget(t *testing.T) {
 	expect.Equal("test", msg.String())
 	expect.Equal(timestamp, string(foo))
 }
+
+func TestTimestampPosition(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	for position, expected := range map[string]string{
+		"start":   "2018-03-04 10:11:12|test",
+		"end":     "test2018-03-04 10:11:12|",
+		"replace": "2018-03-04 10:11:12|",
+	} {
+		config := core.NewPluginConfig("", "format.Timestamp")
+		config.Override("Timestamp", "2006-01-02 15:04:05|")
+		config.Override("TimeSource", "metadata")
+		config.Override("TimeField", "time")
+		config.Override("Timezone", "UTC")
+		config.Override("Position", position)
+
+		plugin, err := core.NewPluginWithConfig(config)
+		expect.NoError(err)
+
+		formatter, casted := plugin.(*Timestamp)
+		expect.True(casted)
+
+		msg := core.NewMessage(nil, []byte("test"), tcontainer.MarshalMap{
+			"time": int64(1520158272),
+		}, core.InvalidStreamID)
+		expect.NoError(formatter.ApplyFormatter(msg))
+		expect.Equal(expected, msg.String())
+	}
+}
+
+func TestTimestampMetadataSource(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Timestamp")
+	config.Override("Timestamp", "2006-01-02 15:04 MST")
+	config.Override("TimeSource", "metadata")
+	config.Override("TimeField", "event/time")
+	config.Override("TimeFieldFormat", time.RFC3339)
+	config.Override("Timezone", "Europe/Berlin")
+	config.Override("Target", "time")
+	config.Override("Position", "replace")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Timestamp)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("test"), tcontainer.MarshalMap{
+		"event": tcontainer.MarshalMap{"time": "2018-07-01T08:30:00Z"},
+	}, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.Equal("test", msg.String())
+	expect.MapEqual(msg.GetMetadata(), "time", []byte("2018-07-01 10:30 CEST"))
+
+	// time.Time values are used as-is
+	msg = core.NewMessage(nil, []byte("test"), tcontainer.MarshalMap{
+		"event": tcontainer.MarshalMap{"time": time.Date(2018, 1, 1, 12, 0, 0, 0, time.UTC)},
+	}, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	expect.MapEqual(msg.GetMetadata(), "time", []byte("2018-01-01 13:00 CET"))
+
+	// Missing or invalid values are reported as error
+	msg = core.NewMessage(nil, []byte("test"), nil, core.InvalidStreamID)
+	expect.NotNil(formatter.ApplyFormatter(msg))
+
+	msg = core.NewMessage(nil, []byte("test"), tcontainer.MarshalMap{
+		"event": tcontainer.MarshalMap{"time": "yesterday"},
+	}, core.InvalidStreamID)
+	expect.NotNil(formatter.ApplyFormatter(msg))
+}
+
+func TestTimestampNow(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Timestamp")
+	config.Override("Timestamp", time.RFC3339Nano)
+	config.Override("TimeSource", "now")
+	config.Override("Position", "replace")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Timestamp)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("test"), nil, core.InvalidStreamID)
+	time.Sleep(10 * time.Millisecond)
+	expect.NoError(formatter.ApplyFormatter(msg))
+
+	now, err := time.Parse(time.RFC3339Nano, msg.String())
+	expect.NoError(err)
+	expect.True(now.After(msg.GetCreationTime()))
+}
+
+func TestTimestampConfigErrors(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	for _, settings := range []map[string]interface{}{
+		{"TimeSource": "unknown"},
+		{"TimeSource": "metadata"},
+		{"Timezone": "Mars/Olympus_Mons"},
+		{"Position": "middle"},
+	} {
+		config := core.NewPluginConfig("", "format.Timestamp")
+		for key, value := range settings {
+			config.Override(key, value)
+		}
+		_, err := core.NewPluginWithConfig(config)
+		expect.NotNil(err)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"strings"
+	"unicode"
+
+	"gollum/core"
+)
+
+const tokenizerSkipField = "-"
+
+// Tokenizer formatter
+//
+// This formatter splits data into tokens and stores the tokens as metadata
+// fields by position. It is a lightweight alternative to format.Grok for
+// space or tab delimited log formats.
+//
+// Parameters
+//
+// - Delimiter: Defines the delimiter used to split the data. When set to "",
+// the data is split at any whitespace and consecutive whitespace is treated
+// as a single delimiter. Leading and trailing whitespace is ignored in this
+// case.
+// By default this parameter is set to "".
+//
+// - Fields: Defines the metadata keys tokens are stored at by position. A
+// field named "-" skips the token at its position. Tokens without a field
+// are ignored, fields without a token are not set.
+// By default this parameter is set to an empty list.
+//
+// - MaxSplit: Defines the maximum number of tokens. The last token contains
+// the remaining, unsplit data. Setting this parameter to the number of
+// Fields makes the last field capture the remainder of the line. Set this
+// parameter to 0 to split the data completely.
+// By default this parameter is set to 0.
+//
+// Examples
+//
+// This example parses lines like "10.0.0.1 - frank 2018-02-12T14:10:00Z GET
+// /index.html" into the fields ip, user, ts and request, the latter
+// containing "GET /index.html".
+//
+//  ExampleConsumer:
+//    Type: consumer.Console
+//    Streams: console
+//    Modulators:
+//      - format.Tokenizer:
+//        Target: access
+//        Fields: [ip, "-", user, ts, request]
+//        MaxSplit: 5
+type Tokenizer struct {
+	core.SimpleFormatter `gollumdoc:"embed_type"`
+	delimiter            string   `config:"Delimiter"`
+	fields               []string `config:"Fields"`
+	maxSplit             int      `config:"MaxSplit" default:"0"`
+}
+
+func init() {
+	core.TypeRegistry.Register(Tokenizer{})
+}
+
+// Configure initializes this formatter with values from a plugin config.
+func (format *Tokenizer) Configure(conf core.PluginConfigReader) {
+	if format.maxSplit < 0 {
+		conf.Errors.Pushf("MaxSplit must not be negative")
+	}
+}
+
+// splitWhitespace works like strings.Fields but returns at most maxSplit
+// tokens if maxSplit is greater than 0. The last token keeps the remaining
+// data without leading whitespace.
+func splitWhitespace(data string, maxSplit int) []string {
+	if maxSplit <= 0 {
+		return strings.Fields(data)
+	}
+
+	tokens := make([]string, 0, maxSplit)
+	data = strings.TrimLeftFunc(data, unicode.IsSpace)
+	for len(data) > 0 && len(tokens) < maxSplit-1 {
+		end := strings.IndexFunc(data, unicode.IsSpace)
+		if end < 0 {
+			break // ### break, last token ###
+		}
+		tokens = append(tokens, data[:end])
+		data = strings.TrimLeftFunc(data[end:], unicode.IsSpace)
+	}
+
+	if data = strings.TrimRightFunc(data, unicode.IsSpace); len(data) > 0 {
+		tokens = append(tokens, data)
+	}
+	return tokens
+}
+
+// split returns the tokens of the given data.
+func (format *Tokenizer) split(data string) []string {
+	switch {
+	case format.delimiter == "":
+		return splitWhitespace(data, format.maxSplit)
+	case format.maxSplit > 0:
+		return strings.SplitN(data, format.delimiter, format.maxSplit)
+	default:
+		return strings.Split(data, format.delimiter)
+	}
+}
+
+// ApplyFormatter update message payload
+func (format *Tokenizer) ApplyFormatter(msg *core.Message) error {
+	tokens := format.split(format.GetSourceDataAsString(msg))
+	tree := format.ForceTargetAsMetadata(msg)
+
+	for idx, field := range format.fields {
+		if idx >= len(tokens) {
+			break // ### break, no more tokens ###
+		}
+		if field != tokenizerSkipField {
+			tree.Set(field, tokens[idx])
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestTokenizerSkipFields(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Tokenizer")
+	config.Override("Fields", []string{"ip", "-", "user", "ts", "missing"})
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Tokenizer)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("  10.0.0.1 -\tfrank   2018-02-12T14:10:00Z "), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+
+	metadata := msg.GetMetadata()
+	expect.MapEqual(metadata, "ip", "10.0.0.1")
+	expect.MapEqual(metadata, "user", "frank")
+	expect.MapEqual(metadata, "ts", "2018-02-12T14:10:00Z")
+	expect.MapNotSet(metadata, "-")
+	expect.MapNotSet(metadata, "missing")
+	expect.Equal(3, len(metadata))
+}
+
+func TestTokenizerRemainder(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Tokenizer")
+	config.Override("Target", "access")
+	config.Override("Fields", []string{"ip", "-", "user", "request"})
+	config.Override("MaxSplit", 4)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Tokenizer)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("10.0.0.1 - frank  GET /index.html  HTTP/1.1 \n"), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+
+	access, err := msg.GetMetadata().MarshalMap("access")
+	expect.NoError(err)
+	expect.MapEqual(access, "ip", "10.0.0.1")
+	expect.MapEqual(access, "user", "frank")
+	expect.MapEqual(access, "request", "GET /index.html  HTTP/1.1")
+	expect.Equal("10.0.0.1 - frank  GET /index.html  HTTP/1.1 \n", msg.String())
+}
+
+func TestTokenizerDelimiter(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Tokenizer")
+	config.Override("Delimiter", "|")
+	config.Override("Fields", []string{"level", "-", "message"})
+	config.Override("MaxSplit", 3)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Tokenizer)
+	expect.True(casted)
+
+	// Empty tokens are kept when using a delimiter
+	msg := core.NewMessage(nil, []byte("warn||disk|full"), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+
+	metadata := msg.GetMetadata()
+	expect.MapEqual(metadata, "level", "warn")
+	expect.MapEqual(metadata, "message", "disk|full")
+}
+
+func TestTokenizerSplitWhitespace(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	expect.Equal([]string{"a", "b", "c"}, splitWhitespace(" a  b\tc ", 0))
+	expect.Equal([]string{"a", "b  c"}, splitWhitespace(" a  b  c ", 2))
+	expect.Equal([]string{"a"}, splitWhitespace("a", 3))
+	expect.Equal([]string{}, splitWhitespace("   ", 2))
+	expect.Equal(0, len(splitWhitespace("", 0)))
+}
+
+func TestTokenizerConfigError(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Tokenizer")
+	config.Override("MaxSplit", -1)
+
+	_, err := core.NewPluginWithConfig(config)
+	expect.NotNil(err)
+}
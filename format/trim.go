@@ -15,7 +15,7 @@
 package format
 
 import (
-	"strings"
+	"bytes"
 
 	"gollum/core"
 )
@@ -23,14 +23,34 @@ import (
 // Trim formatter plugin
 //
 // Trim removes a set of characters from the beginning and end of a metadata value
-// or the payload.
+// or the payload. In addition a fixed number of bytes or a given prefix or
+// suffix can be removed, e.g. to strip framing bytes or a byte order mark
+// before parsing. Bytes are removed first, followed by prefix and suffix and
+// finally the set of characters.
 //
 // Parameters
 //
 // - Characters: This value defines which characters should be removed from
 // both ends of the data. The data to operate on is expected to be a string.
+// Set to "" to keep all characters.
 // By default this is set to " \t\r\n\v\f".
 //
+// - LeftBytes: Defines the number of bytes to remove from the beginning of
+// the data. If the data is shorter, the result is empty.
+// By default this is set to 0.
+//
+// - RightBytes: Defines the number of bytes to remove from the end of the
+// data. If the data is shorter, the result is empty.
+// By default this is set to 0.
+//
+// - Prefix: Defines a string that is removed once from the beginning of the
+// data if present.
+// By default this is set to "".
+//
+// - Suffix: Defines a string that is removed once from the end of the data if
+// present.
+// By default this is set to "".
+//
 // Examples
 //
 // This example will trim spaces from the message payload:
@@ -40,9 +60,25 @@ import (
 //    Streams: "*"
 //    Modulators:
 //      - format.Trim: {}
+//
+// This example removes an UTF-8 byte order mark and a 4 byte length header
+// from the payload without trimming any other characters:
+//
+//  exampleConsumer:
+//    Type: consumer.Console
+//    Streams: "*"
+//    Modulators:
+//      - format.Trim:
+//        Characters: ""
+//        Prefix: "\uFEFF"
+//        LeftBytes: 4
 type Trim struct {
 	core.SimpleFormatter `gollumdoc:"embed_type"`
 	characters           string `config:"Characters" default:" \t\r\n\v\f"`
+	leftBytes            int    `config:"LeftBytes" default:"0"`
+	rightBytes           int    `config:"RightBytes" default:"0"`
+	prefix               []byte `config:"Prefix"`
+	suffix               []byte `config:"Suffix"`
 }
 
 func init() {
@@ -51,11 +87,31 @@ func init() {
 
 // Configure initializes this formatter with values from a plugin config.
 func (format *Trim) Configure(conf core.PluginConfigReader) {
+	if format.leftBytes < 0 {
+		conf.Errors.Pushf("LeftBytes must not be negative")
+	}
+	if format.rightBytes < 0 {
+		conf.Errors.Pushf("RightBytes must not be negative")
+	}
 }
 
 // ApplyFormatter update message payload
 func (format *Trim) ApplyFormatter(msg *core.Message) error {
-	content := format.GetSourceDataAsString(msg)
-	format.SetTargetData(msg, strings.Trim(content, format.characters))
+	content := format.GetSourceDataAsBytes(msg)
+
+	if format.leftBytes+format.rightBytes >= len(content) {
+		content = content[:0]
+	} else {
+		content = content[format.leftBytes : len(content)-format.rightBytes]
+	}
+
+	content = bytes.TrimPrefix(content, format.prefix)
+	content = bytes.TrimSuffix(content, format.suffix)
+
+	if format.characters != "" {
+		content = bytes.Trim(content, format.characters)
+	}
+
+	format.SetTargetData(msg, string(content))
 	return nil
 }
@@ -39,3 +39,110 @@ func TestTrim(t *testing.T) {
 
 	expect.Equal("test", string(msg.GetPayload()))
 }
+
+func applyTrim(t *testing.T, formatter *Trim, payload string) string {
+	expect := ttesting.NewExpect(t)
+	msg := core.NewMessage(nil, []byte(payload), nil, core.InvalidStreamID)
+	expect.NoError(formatter.ApplyFormatter(msg))
+	return msg.String()
+}
+
+func TestTrimCharacters(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Trim")
+	config.Override("Characters", "[]")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Trim)
+	expect.True(casted)
+
+	expect.Equal("test", applyTrim(t, formatter, "[[test]"))
+	expect.Equal(" [test] ", applyTrim(t, formatter, " [test] "))
+
+	config = core.NewPluginConfig("", "format.Trim")
+	config.Override("Characters", "")
+
+	plugin, err = core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted = plugin.(*Trim)
+	expect.True(casted)
+
+	expect.Equal(" test\n", applyTrim(t, formatter, " test\n"))
+}
+
+func TestTrimBytes(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Trim")
+	config.Override("Characters", "")
+	config.Override("LeftBytes", 2)
+	config.Override("RightBytes", 1)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Trim)
+	expect.True(casted)
+
+	expect.Equal("test", applyTrim(t, formatter, "\x00\x04test\n"))
+	expect.Equal("", applyTrim(t, formatter, "abc"))
+	expect.Equal("", applyTrim(t, formatter, "a"))
+	expect.Equal("", applyTrim(t, formatter, ""))
+
+	config = core.NewPluginConfig("", "format.Trim")
+	config.Override("RightBytes", 10)
+
+	plugin, err = core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted = plugin.(*Trim)
+	expect.True(casted)
+
+	expect.Equal("", applyTrim(t, formatter, "short"))
+}
+
+func TestTrimPrefixSuffix(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Trim")
+	config.Override("Prefix", "\uFEFF")
+	config.Override("Suffix", "\r\n")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted := plugin.(*Trim)
+	expect.True(casted)
+
+	expect.Equal("{\"a\":1}", applyTrim(t, formatter, "\uFEFF{\"a\":1} \r\n"))
+	expect.Equal("no bom", applyTrim(t, formatter, "no bom"))
+
+	// Prefix and suffix are only removed once
+	config = core.NewPluginConfig("", "format.Trim")
+	config.Override("Characters", "")
+	config.Override("Prefix", "--")
+	config.Override("Suffix", "--")
+
+	plugin, err = core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	formatter, casted = plugin.(*Trim)
+	expect.True(casted)
+
+	expect.Equal("--data--", applyTrim(t, formatter, "----data----"))
+}
+
+func TestTrimConfigErrors(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	for _, key := range []string{"LeftBytes", "RightBytes"} {
+		config := core.NewPluginConfig("", "format.Trim")
+		config.Override(key, -1)
+		_, err := core.NewPluginWithConfig(config)
+		expect.NotNil(err)
+	}
+}
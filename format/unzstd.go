@@ -0,0 +1,83 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"gollum/core"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Unzstd formatter
+//
+// Unzstd is a formatter that decompresses zstandard compressed messages.
+// All messages are decompressed by a single decoder that keeps a pool of
+// internal decoders, so no decoder is allocated per message.
+// If a message cannot be decompressed, e.g. because it is larger than
+// MaxDecompressedBytes, an error is returned and the message is discarded.
+//
+// Parameters
+//
+// - MaxDecompressedBytes: Defines the maximum size of a decompressed message.
+// Decompression stops as soon as this size is exceeded to protect against
+// decompression bombs.
+// By default this parameter is set to 67108864 (64 MB).
+//
+// Examples
+//
+// This example decompresses zstandard compressed messages read from Kafka.
+//
+//  ExampleConsumer:
+//    Type: consumer.Kafka
+//    Streams: kafka
+//    Topic: compressed
+//    Modulators:
+//      - format.Unzstd:
+//          MaxDecompressedBytes: 1048576
+//
+type Unzstd struct {
+	core.SimpleFormatter `gollumdoc:"embed_type"`
+	maxDecompressedBytes int64 `config:"MaxDecompressedBytes" default:"67108864"`
+	decoder              *zstd.Decoder
+}
+
+func init() {
+	core.TypeRegistry.Register(Unzstd{})
+}
+
+// Configure initializes this formatter with values from a plugin config.
+func (format *Unzstd) Configure(conf core.PluginConfigReader) {
+	if format.maxDecompressedBytes <= 0 {
+		conf.Errors.Pushf("MaxDecompressedBytes must be greater than 0")
+		return
+	}
+
+	decoder, err := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(uint64(format.maxDecompressedBytes)))
+	if !conf.Errors.Push(err) {
+		format.decoder = decoder
+	}
+}
+
+// ApplyFormatter update message payload
+func (format *Unzstd) ApplyFormatter(msg *core.Message) error {
+	decompressed, err := format.decoder.DecodeAll(format.GetSourceDataAsBytes(msg), nil)
+	if err != nil {
+		format.Logger.WithError(err).Error("Failed to decompress data")
+		return err
+	}
+
+	format.SetTargetData(msg, decompressed)
+	return nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"gollum/core"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Zstd formatter
+//
+// Zstd is a formatter that compresses messages using zstandard.
+// All messages are compressed by a single encoder that keeps a pool of
+// internal encoders, so no encoder is allocated per message.
+//
+// Parameters
+//
+// - Level: Defines the compression level to use. Valid values are "fastest",
+// "default", "better" and "best".
+// By default this parameter is set to "default".
+//
+// Examples
+//
+// This example compresses all messages before writing them to a socket.
+//
+//  ExampleProducer:
+//    Type: producer.Socket
+//    Streams: compressed
+//    Address: "unix:///var/gollum.socket"
+//    Modulators:
+//      - format.Zstd:
+//          Level: fastest
+//
+type Zstd struct {
+	core.SimpleFormatter `gollumdoc:"embed_type"`
+	encoder              *zstd.Encoder
+}
+
+func init() {
+	core.TypeRegistry.Register(Zstd{})
+}
+
+// Configure initializes this formatter with values from a plugin config.
+func (format *Zstd) Configure(conf core.PluginConfigReader) {
+	levelName := conf.GetString("Level", "default")
+	validLevel, level := zstd.EncoderLevelFromString(levelName)
+	if !validLevel {
+		conf.Errors.Pushf("Unknown compression level '%s'", levelName)
+		return
+	}
+
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(level))
+	if !conf.Errors.Push(err) {
+		format.encoder = encoder
+	}
+}
+
+// ApplyFormatter update message payload
+func (format *Zstd) ApplyFormatter(msg *core.Message) error {
+	compressed := format.encoder.EncodeAll(format.GetSourceDataAsBytes(msg), nil)
+	format.SetTargetData(msg, compressed)
+	return nil
+}
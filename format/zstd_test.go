@@ -0,0 +1,148 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package format
+
+import (
+	"bytes"
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestZstd(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Zstd")
+	config.Override("Level", "best")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	compressor, casted := plugin.(*Zstd)
+	expect.True(casted)
+
+	config = core.NewPluginConfig("", "format.Unzstd")
+
+	plugin, err = core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	decompressor, casted := plugin.(*Unzstd)
+	expect.True(casted)
+
+	payload := bytes.Repeat([]byte("test "), 100)
+	msg := core.NewMessage(nil, payload, nil, core.InvalidStreamID)
+
+	expect.NoError(compressor.ApplyFormatter(msg))
+	expect.Less(len(msg.GetPayload()), len(payload))
+
+	expect.NoError(decompressor.ApplyFormatter(msg))
+	expect.Equal(string(payload), string(msg.GetPayload()))
+}
+
+func TestZstdInvalidLevel(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Zstd")
+	config.Override("Level", "ultra")
+	_, err := core.NewPluginWithConfig(config)
+	expect.NotNil(err)
+}
+
+func TestUnzstdMaxDecompressedBytes(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Zstd")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	compressor, casted := plugin.(*Zstd)
+	expect.True(casted)
+
+	config = core.NewPluginConfig("", "format.Unzstd")
+	config.Override("MaxDecompressedBytes", 1024)
+
+	plugin, err = core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	decompressor, casted := plugin.(*Unzstd)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, make([]byte, 1025), nil, core.InvalidStreamID)
+	expect.NoError(compressor.ApplyFormatter(msg))
+	compressed := string(msg.GetPayload())
+
+	expect.NotNil(decompressor.ApplyFormatter(msg))
+	expect.Equal(compressed, string(msg.GetPayload()))
+}
+
+func TestUnzstdInvalidData(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "format.Unzstd")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	decompressor, casted := plugin.(*Unzstd)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("not compressed"), nil, core.InvalidStreamID)
+	expect.NotNil(decompressor.ApplyFormatter(msg))
+	expect.Equal("not compressed", string(msg.GetPayload()))
+}
+
+func benchmarkCompression(b *testing.B, compressType string, decompressType string) {
+	config := core.NewPluginConfig("", compressType)
+	plugin, err := core.NewPluginWithConfig(config)
+	if err != nil {
+		b.Fatal(err)
+	}
+	compressor := plugin.(core.Formatter)
+
+	config = core.NewPluginConfig("", decompressType)
+	plugin, err = core.NewPluginWithConfig(config)
+	if err != nil {
+		b.Fatal(err)
+	}
+	decompressor := plugin.(core.Formatter)
+
+	payload := bytes.Repeat([]byte(`{"level":"info","message":"request served","status":200}`), 32)
+	msg := core.NewMessage(nil, payload, nil, core.InvalidStreamID)
+
+	b.SetBytes(int64(len(payload)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		msg.StorePayload(payload)
+		if err := compressor.ApplyFormatter(msg); err != nil {
+			b.Fatal(err)
+		}
+		if err := decompressor.ApplyFormatter(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkZstd(b *testing.B) {
+	benchmarkCompression(b, "format.Zstd", "format.Unzstd")
+}
+
+func BenchmarkGzip(b *testing.B) {
+	benchmarkCompression(b, "format.Gzip", "format.Gunzip")
+}
@@ -3,7 +3,9 @@ module gollum
 go 1.16
 
 require (
-	github.com/CrowdStrike/go-metrics-prometheus v0.0.0-20190206080537-f2bb39ee2c39
+	cloud.google.com/go/pubsub v1.17.1
+	github.com/Azure/azure-storage-blob-go v0.14.0
+	github.com/Azure/go-autorest/autorest/adal v0.9.13
 	github.com/Shopify/sarama v1.29.0
 	github.com/abbot/go-http-auth v0.4.0
 	github.com/arbovm/levenshtein v0.0.0-20160628152529-48b4e1c0c4d0
@@ -13,10 +15,12 @@ require (
 	github.com/aws/aws-sdk-go v1.38.55
 	github.com/bsm/sarama-cluster v2.1.15+incompatible
 	github.com/coreos/go-systemd v0.0.0-20191104093116-d3cd4ed1dbcf
+	github.com/eclipse/paho.mqtt.golang v1.3.5
 	github.com/fsnotify/fsnotify v1.4.9
 	github.com/go-redis/redis v6.15.9+incompatible
 	github.com/golang/protobuf v1.5.2
 	github.com/gorilla/websocket v1.4.2
+	github.com/klauspost/compress v1.12.2
 	github.com/mgutz/ansi v0.0.0-20200706080929-d51e80ef957d // indirect
 	github.com/miekg/pcap v1.0.1
 	github.com/mmcloughlin/geohash v0.10.0
@@ -24,14 +28,21 @@ require (
 	github.com/oschwald/maxminddb-golang v1.8.0 // indirect
 	github.com/pkg/errors v0.9.1
 	github.com/prometheus/client_golang v1.10.0
+	github.com/prometheus/client_model v0.2.0
 	github.com/quipo/statsd v0.0.0-20180118161217-3d6a5565f314
+	github.com/rabbitmq/amqp091-go v1.9.0
 	github.com/rcrowley/go-metrics v0.0.0-20201227073835-cf1acfcdf475
 	github.com/sirupsen/logrus v1.8.1
 	github.com/trivago/grok v1.0.0
 	github.com/trivago/tgo v1.0.7
 	github.com/x-cray/logrus-prefixed-formatter v0.5.2
+	github.com/xeipuuv/gojsonschema v1.2.0
 	go.uber.org/automaxprocs v1.4.0
 	golang.org/x/crypto v0.0.0-20210513164829-c07d793c2f9a
+	golang.org/x/net v0.0.0-20210503060351-7fd8e65b6420
+	golang.org/x/oauth2 v0.0.0-20211005180243-6b3c2da341f1
+	google.golang.org/api v0.58.0
+	google.golang.org/grpc v1.43.0
 	gopkg.in/mcuadros/go-syslog.v2 v2.3.0
 	gopkg.in/olivere/elastic.v5 v5.0.86
 	gopkg.in/oschwald/geoip2-golang.v1 v1.3.0
@@ -0,0 +1,39 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package logger
+
+import (
+	"os"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// ColorMode defines if colored output is used. It is one of "never", "auto"
+// or "always" and set by the -log-colors parameter.
+var ColorMode = "auto"
+
+// UseColors returns true if colored output should be written to the given
+// file. In "auto" mode this is the case if the file is a terminal.
+func UseColors(file *os.File) bool {
+	switch ColorMode {
+	case "always":
+		return true
+	case "auto":
+		return file != nil && terminal.IsTerminal(int(file.Fd()))
+	default:
+		return false
+	}
+}
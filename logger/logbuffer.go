@@ -30,6 +30,7 @@ var FallbackLogDevice = os.Stdout
 type LogrusHookBuffer struct {
 	targetHook   logrus.Hook
 	targetWriter io.Writer
+	redactor     *Redactor
 	buffer       []*logrus.Entry
 }
 
@@ -45,6 +46,10 @@ func (lhb *LogrusHookBuffer) Levels() []logrus.Level {
 
 // Fire and Levels() implement the logrus.Hook interface.
 func (lhb *LogrusHookBuffer) Fire(logrusEntry *logrus.Entry) error {
+	if lhb.redactor != nil {
+		lhb.redactor.RedactEntry(logrusEntry)
+	}
+
 	if lhb.targetHook == nil && lhb.targetWriter == nil {
 		// Store entry in buffer and return
 		lhb.buffer = append(lhb.buffer, logrusEntry)
@@ -60,6 +65,12 @@ func (lhb *LogrusHookBuffer) SetTargetHook(hook logrus.Hook) {
 	lhb.targetHook = hook
 }
 
+// SetRedactor sets the Redactor applied to all messages before they are
+// stored or relayed. Passing nil disables redaction.
+func (lhb *LogrusHookBuffer) SetRedactor(redactor *Redactor) {
+	lhb.redactor = redactor
+}
+
 // SetTargetWriter sets the io.Writer where messages should be written
 func (lhb *LogrusHookBuffer) SetTargetWriter(writer io.Writer) {
 	lhb.targetWriter = writer
@@ -0,0 +1,129 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logger
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RedactReplacement is written in place of redacted secrets
+const RedactReplacement = "***"
+
+// DefaultRedactPatterns contains expressions for commonly logged secrets like
+// passwords in key/value pairs or URLs, AWS keys and bearer tokens.
+// If an expression contains capture groups only the captured parts are
+// replaced, otherwise the whole match is replaced.
+var DefaultRedactPatterns = []string{
+	`(?i)(?:passw(?:or)?d|pwd|secret(?:[_-]?access[_-]?key)?|api[_-]?key|token)["']?\s*[:=]\s*["']?([^\s"',;&]+)`,
+	`[a-zA-Z][a-zA-Z0-9+.-]*://[^/\s:@]+:([^/\s@]+)@`,
+	`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`,
+	`(?i)bearer\s+([a-zA-Z0-9\-._~+/]+=*)`,
+}
+
+// Redactor replaces secrets in log messages and fields
+type Redactor struct {
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor compiles the given expressions into a Redactor
+func NewRedactor(patterns []string) (*Redactor, error) {
+	redactor := &Redactor{}
+	for _, pattern := range patterns {
+		expr, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern \"%s\": %s", pattern, err.Error())
+		}
+		redactor.patterns = append(redactor.patterns, expr)
+	}
+	return redactor, nil
+}
+
+// ReadRedactPatterns reads one expression per line from the given file.
+// Empty lines and lines starting with "#" are ignored.
+func ReadRedactPatterns(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	patterns := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+	return patterns, scanner.Err()
+}
+
+// Redact returns text with all secrets replaced by RedactReplacement
+func (r *Redactor) Redact(text string) string {
+	for _, expr := range r.patterns {
+		text = redactMatches(expr, text)
+	}
+	return text
+}
+
+// RedactEntry redacts the message and all fields of the given entry.
+// Fields that contain a secret are replaced by their redacted string form.
+func (r *Redactor) RedactEntry(entry *logrus.Entry) {
+	entry.Message = r.Redact(entry.Message)
+	for key, value := range entry.Data {
+		switch value.(type) {
+		case string, error, fmt.Stringer:
+			text := fmt.Sprint(value)
+			if redacted := r.Redact(text); redacted != text {
+				entry.Data[key] = redacted
+			}
+		}
+	}
+}
+
+func redactMatches(expr *regexp.Regexp, text string) string {
+	matches := expr.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text
+	}
+
+	redacted := strings.Builder{}
+	start := 0
+	for _, match := range matches {
+		if len(match) == 2 {
+			redacted.WriteString(text[start:match[0]])
+			redacted.WriteString(RedactReplacement)
+			start = match[1]
+			continue
+		}
+		for group := 2; group < len(match); group += 2 {
+			if match[group] < start {
+				continue // ### continue, group did not match ###
+			}
+			redacted.WriteString(text[start:match[group]])
+			redacted.WriteString(RedactReplacement)
+			start = match[group+1]
+		}
+	}
+	redacted.WriteString(text[start:])
+	return redacted.String()
+}
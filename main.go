@@ -17,6 +17,7 @@ package main
 import (
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"runtime"
 	"runtime/pprof"
@@ -31,7 +32,6 @@ import (
 	"github.com/trivago/tgo/tnet"
 	"github.com/trivago/tgo/tos"
 	"go.uber.org/automaxprocs/maxprocs"
-	"golang.org/x/crypto/ssh/terminal"
 	_ "gollum/consumer"
 	"gollum/core"
 	_ "gollum/filter"
@@ -79,7 +79,7 @@ func mainWithExitCode() int {
 	logrus.Debug("GOLLUM STARTING")
 	defer logrus.Debug("GOLLUM STOPPED")
 
-	configFile, testConfigAndExit := getConfigFile()
+	configFile, testConfigAndExit, dialPlugins := getConfigFile()
 	config := readConfig(configFile)
 	if config == nil {
 		return tos.ExitError // ### exit, config failed to parse ###
@@ -89,7 +89,7 @@ func mainWithExitCode() int {
 		logrus.SetLevel(logrus.WarnLevel)
 		fmt.Println("Testing config", configFile)
 
-		if !testConfig(config) {
+		if !testConfig(config, dialPlugins) {
 			return tos.ExitError // ### exit, config test failed ###
 		}
 
@@ -120,6 +120,7 @@ func mainWithExitCode() int {
 	}
 
 	coordinator := NewCoordinator()
+	coordinator.configFile = configFile
 	defer coordinator.Shutdown()
 
 	if err := coordinator.Configure(config); err != nil {
@@ -132,15 +133,22 @@ func mainWithExitCode() int {
 	return tos.ExitSuccess
 }
 
-func getConfigFile() (configFile string, justTest bool) {
+func getConfigFile() (configFile string, justTest bool, dialPlugins bool) {
+	if *flagDryRunFile != "" {
+		return *flagDryRunFile, true, true
+	}
 	if *flagTestConfigFile != "" {
-		return *flagTestConfigFile, true
+		return *flagTestConfigFile, true, false
+	}
+	if *flagConfigFile == "" {
+		return *flagConfigDir, false, false
 	}
-	return *flagConfigFile, false
+	return *flagConfigFile, false, false
 }
 
-// testConfig test and validate config object
-func testConfig(config *core.Config) bool {
+// testConfig test and validate config object. If dialPlugins is set, all
+// plugins supporting it are checked for reachable backends, too.
+func testConfig(config *core.Config, dialPlugins bool) bool {
 	coordinator := NewCoordinator()
 	defer coordinator.Shutdown()
 
@@ -149,7 +157,21 @@ func testConfig(config *core.Config) bool {
 		return false
 	}
 
-	return true
+	if !dialPlugins {
+		return true
+	}
+
+	allReachable := true
+	for _, result := range coordinator.DialPlugins() {
+		if result.err != nil {
+			fmt.Printf("Backend of '%s' (%s) is not reachable: %s\n", result.pluginID, result.typename, result.err.Error())
+			allReachable = false
+		} else {
+			fmt.Printf("Backend of '%s' (%s) is reachable\n", result.pluginID, result.typename)
+		}
+	}
+
+	return allReachable
 }
 
 // initLogrus initializes the logging framework
@@ -162,6 +184,7 @@ func initLogrus() func() {
 	logrus.AddHook(&logrusHookBuffer)
 	logrus.SetOutput(ioutil.Discard)
 	logrus.SetLevel(getLogrusLevel(*flagLoglevel))
+	logrusHookBuffer.SetRedactor(getLogRedactor(*flagLogRedact))
 
 	switch *flagLogColors {
 	case "never", "auto", "always":
@@ -169,9 +192,9 @@ func initLogrus() func() {
 		fmt.Printf("Invalid parameter for -log-colors: '%s'\n", *flagLogColors)
 		*flagLogColors = "auto"
 	}
+	logger.ColorMode = *flagLogColors
 
-	if *flagLogColors == "always" ||
-		(*flagLogColors == "auto" && terminal.IsTerminal(int(logger.FallbackLogDevice.Fd()))) {
+	if logger.UseColors(logger.FallbackLogDevice) {
 		// Logrus doesn't know the final log device, so we hint the color option here
 		logrus.SetFormatter(logger.NewConsoleFormatter())
 	}
@@ -183,14 +206,39 @@ func initLogrus() func() {
 	}
 }
 
+// getLogRedactor creates the log redactor for the -log-redact parameter.
+// Invalid parameters fall back to the default patterns.
+func getLogRedactor(param string) *logger.Redactor {
+	patterns := logger.DefaultRedactPatterns
+	switch param {
+	case "none":
+		return nil
+	case "default", "":
+	default:
+		custom, err := logger.ReadRedactPatterns(param)
+		if err != nil {
+			fmt.Printf("Failed to read -log-redact patterns: %s\n", err.Error())
+			break
+		}
+		patterns = append(append([]string{}, patterns...), custom...)
+	}
+
+	redactor, err := logger.NewRedactor(patterns)
+	if err != nil {
+		fmt.Printf("Invalid parameter for -log-redact: %s\n", err.Error())
+		redactor, _ = logger.NewRedactor(logger.DefaultRedactPatterns)
+	}
+	return redactor
+}
+
 // readConfig reads and checks the config file for errors.
 func readConfig(configFile string) *core.Config {
 	if *flagHelp || configFile == "" {
-		logrus.Error("Please provide a config file")
+		logrus.Error("Please provide a config file or directory")
 		return nil
 	}
 
-	config, err := core.ReadConfigFromFile(configFile)
+	config, err := loadConfig(configFile)
 	if err != nil {
 		logrus.WithError(err).Error("Failed to read config")
 		return nil
@@ -204,6 +252,29 @@ func readConfig(configFile string) *core.Config {
 	return config
 }
 
+// loadConfig reads the config from the given source. Source may be "-" to
+// read from stdin, an http(s) URL, a file or a directory.
+func loadConfig(source string) (*core.Config, error) {
+	switch {
+	case source == "-":
+		return core.ReadConfigFromReader(os.Stdin)
+
+	case strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://"):
+		header := http.Header{}
+		if *flagConfigHeader != "" {
+			parts := strings.SplitN(*flagConfigHeader, ":", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("invalid config header '%s', expected \"Name: value\"", *flagConfigHeader)
+			}
+			header.Set(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+		}
+		return core.ReadConfigFromURL(source, header, *flagConfigCache)
+
+	default:
+		return core.ReadConfigFromFile(source)
+	}
+}
+
 // configureRuntime does various different settings that affect runtime
 // behavior or enables global functionality
 func configureRuntime() {
@@ -3,48 +3,35 @@ package main
 import (
 	"context"
 	"net/http"
-	"time"
 
 	"gollum/core"
 
-	promMetrics "github.com/CrowdStrike/go-metrics-prometheus"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 )
 
+// startPrometheusMetricsService serves all metrics in the Prometheus text
+// format at "/metrics". "/prometheus" is kept for compatibility.
 func startPrometheusMetricsService(address string) func() {
-	srv := &http.Server{Addr: address}
-	quit := make(chan struct{})
 	prometheusRegistry := prometheus.NewRegistry()
+	prometheusRegistry.MustRegister(core.NewPrometheusCollector(core.MetricsRegistry, "gollum"))
 
-	flushInterval := 3 * time.Second
-	promClient := promMetrics.NewPrometheusProvider(core.MetricsRegistry, "gollum", "", prometheusRegistry, flushInterval)
+	opts := promhttp.HandlerOpts{
+		ErrorLog:      logrus.StandardLogger(),
+		ErrorHandling: promhttp.ContinueOnError,
+	}
+	handler := promhttp.HandlerFor(prometheusRegistry, opts)
 
-	// Start updates
-	go func() {
-		for {
-			select {
-			case <-time.After(flushInterval):
-				if err := promClient.UpdatePrometheusMetricsOnce(); err != nil {
-					logrus.WithError(err).Warn("Error updating metrics")
-				}
-			case <-quit:
-				return
-			}
-		}
-	}()
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", handler)
+	mux.Handle("/prometheus", handler)
+	srv := &http.Server{Addr: address, Handler: mux}
 
 	// Start http
 	go func() {
-		opts := promhttp.HandlerOpts{
-			ErrorLog:      logrus.StandardLogger(),
-			ErrorHandling: promhttp.ContinueOnError,
-		}
-		http.Handle("/prometheus", promhttp.HandlerFor(prometheusRegistry, opts))
-
 		err := srv.ListenAndServe()
-		if err != nil {
+		if err != nil && err != http.ErrServerClosed {
 			logrus.WithError(err).Error("Failed to start metrics http server")
 		}
 	}()
@@ -53,7 +40,6 @@ func startPrometheusMetricsService(address string) func() {
 
 	// Return stop function
 	return func() {
-		close(quit)
 		if err := srv.Shutdown(context.Background()); err != nil {
 			logrus.WithError(err).Error("Failed to shutdown metrics http server")
 		}
@@ -15,24 +15,49 @@
 package producer
 
 import (
+	"encoding/json"
+	"fmt"
 	"gollum/core"
 	"io"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/trivago/tgo/tcontainer"
 )
 
 // InfluxDB producer
 //
 // This producer writes data to an influxDB endpoint. Data is not converted to
 // the correct influxDB format automatically. Proper formatting might be
-// required.
+// required. Alternatively, lines can be generated from metadata by enabling
+// LineFromMetadata. The format.JSONToInfluxDB formatter can be used to set
+// the required metadata from JSON messages.
+//
+// Metadata
+//
+// The following metadata fields are used if LineFromMetadata is enabled.
+//
+// - measurement: The name of the measurement
+//
+// - tags: A map of tag names to values (optional)
+//
+// - fields: A map of field names to values. At least one field is required.
+//
+// - time: The timestamp as unix time in milliseconds or as RFC3339 string
+// (optional). The message creation time is used if not set.
 //
 // Parameters
 //
 // - Version: Defines the InfluxDB protocol version to use. This can either be
-// 80-89 for 0.8.x, 90 for 0.9.0 or 91-100 for 0.9.1 or later.
+// 80-89 for 0.8.x, 90 for 0.9.0, 91-199 for 0.9.1 or later or 200 and above
+// for 2.x.
 // Be default this parameter is set to 100.
 //
-// - Host: Defines the host (and port) of the InfluxDB master.
+// - Host: Defines the host (and port) of the InfluxDB master. For 2.x a URL
+// like "https://influx:8086" can be used, too.
 // Be default this parameter is set to "localhost:8086".
 //
 // - User: Defines the InfluxDB username to use. If this is empty,
@@ -54,6 +79,26 @@ import (
 // InfluxDB retention policy allowed with this protocol version.
 // By default this parameter is set to "".
 //
+// - Org: Only used for 2.x. Defines the organization to write to.
+// By default this parameter is set to "".
+//
+// - Bucket: Only used for 2.x. Defines the bucket to write to. Database,
+// User, Password and TimeBasedName are not used for 2.x.
+// By default this parameter is set to "default".
+//
+// - Token: Only used for 2.x. Defines the API token used for authentication.
+// By default this parameter is set to "".
+//
+// - TimeoutSec: Only used for 2.x. Defines the timeout for a single write
+// request in seconds.
+// By default this parameter is set to 10.
+//
+// - LineFromMetadata: When set to true, each message is converted to one line
+// of line protocol using the fields described in the metadata section.
+// Messages that cannot be converted are sent to the fallback. Only supported
+// for 0.9.1 or later.
+// By default this parameter is set to false.
+//
 // Examples
 //
 //  metricsToInflux:
@@ -66,8 +111,28 @@ import (
 //      MaxCount: 2000
 //      FlushCount: 100
 //      TimeoutSec: 5
+//
+// This example writes JSON encoded request metrics to InfluxDB 2.x.
+//
+//  requestsToInflux:
+//    Type: producer.InfluxDB
+//    Streams: requests
+//    Version: 200
+//    Host: "https://influx01:8086"
+//    Org: trivago
+//    Bucket: requests
+//    Token: ${INFLUX_TOKEN}
+//    LineFromMetadata: true
+//    Modulators:
+//      - format.JSONToInfluxDB:
+//        Measurement: requests
+//        Tags:
+//          - host
+//          - status
+//        TimeFrom: time
 type InfluxDB struct {
 	core.BatchedProducer `gollumdoc:"embed_type"`
+	lineFromMetadata     bool `config:"LineFromMetadata" default:"false"`
 	writer               influxDBWriter
 	assembly             core.WriterAssembly
 }
@@ -87,6 +152,9 @@ func (prod *InfluxDB) Configure(conf core.PluginConfigReader) {
 	version := conf.GetInt("Version", 100)
 
 	switch {
+	case version >= 200:
+		prod.Logger.Debug("Using InfluxDB 2.x protocol")
+		prod.writer = new(influxDBWriter20)
 	case version < 90:
 		prod.Logger.Debug("Using InfluxDB 0.8.x protocol")
 		prod.writer = new(influxDBWriter08)
@@ -102,12 +170,198 @@ func (prod *InfluxDB) Configure(conf core.PluginConfigReader) {
 		return
 	}
 
+	if prod.lineFromMetadata && version < 91 {
+		conf.Errors.Pushf("LineFromMetadata requires Version 91 or later")
+	}
+
 	prod.assembly = core.NewWriterAssembly(prod.writer, prod.TryFallback, prod)
+	prod.assembly.SetErrorHandler(prod.onWriteError)
+}
+
+// onWriteError logs failed writes. Messages of failed writes are sent to the
+// fallback.
+func (prod *InfluxDB) onWriteError(err error) bool {
+	prod.Logger.WithError(err).Error("Failed to write to InfluxDB")
+	return false
+}
+
+var (
+	influxDBMeasurementEscaper = strings.NewReplacer(",", "\\,", " ", "\\ ")
+	influxDBKeyEscaper         = strings.NewReplacer(",", "\\,", "=", "\\=", " ", "\\ ")
+	influxDBStringEscaper      = strings.NewReplacer("\\", "\\\\", "\"", "\\\"")
+)
+
+// getInfluxDBMap returns the map stored in the given metadata key.
+func getInfluxDBMap(metadata tcontainer.MarshalMap, key string) (map[string]interface{}, error) {
+	value, exists := metadata[key]
+	if !exists {
+		return map[string]interface{}{}, nil
+	}
+	values, err := tcontainer.ConvertToMarshalMap(value, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a map", key)
+	}
+	return values, nil
+}
+
+// sortedInfluxDBKeys returns the keys of the given map in sorted order.
+func sortedInfluxDBKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatInfluxDBField converts a field value to line protocol. Integers are
+// written with an "i" suffix, strings are quoted.
+func formatInfluxDBField(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v) + "i", nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10) + "i", nil
+	case int64:
+		return strconv.FormatInt(v, 10) + "i", nil
+	case uint64:
+		return strconv.FormatUint(v, 10) + "i", nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return v.String() + "i", nil
+		}
+		if _, err := v.Float64(); err != nil {
+			return "", err
+		}
+		return v.String(), nil
+	case string:
+		return "\"" + influxDBStringEscaper.Replace(v) + "\"", nil
+	case []byte:
+		return "\"" + influxDBStringEscaper.Replace(string(v)) + "\"", nil
+	default:
+		return "", fmt.Errorf("unsupported field type %T", value)
+	}
+}
+
+// getInfluxDBTime returns the timestamp of the given message in milliseconds.
+func getInfluxDBTime(msg *core.Message, metadata tcontainer.MarshalMap) (int64, error) {
+	value, exists := metadata["time"]
+	if !exists {
+		return msg.GetCreationTime().UnixNano() / int64(time.Millisecond), nil
+	}
+
+	switch v := value.(type) {
+	case time.Time:
+		return v.UnixNano() / int64(time.Millisecond), nil
+	case string:
+		if timestamp, err := time.Parse(time.RFC3339Nano, v); err == nil {
+			return timestamp.UnixNano() / int64(time.Millisecond), nil
+		}
+	}
+
+	timestamp, err := strconv.ParseInt(core.ConvertToString(value), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time '%v'", value)
+	}
+	return timestamp, nil
+}
+
+// formatLine creates one line of line protocol from the metadata of the given
+// message.
+func (prod *InfluxDB) formatLine(msg *core.Message) ([]byte, error) {
+	metadata := msg.TryGetMetadata()
+	measurement := ""
+	if value, exists := metadata["measurement"]; exists {
+		measurement = core.ConvertToString(value)
+	}
+	if measurement == "" {
+		return nil, fmt.Errorf("measurement is not set")
+	}
+
+	tags, err := getInfluxDBMap(metadata, "tags")
+	if err != nil {
+		return nil, err
+	}
+	fields, err := getInfluxDBMap(metadata, "fields")
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no fields set")
+	}
+
+	timestamp, err := getInfluxDBTime(msg, metadata)
+	if err != nil {
+		return nil, err
+	}
+
+	line := strings.Builder{}
+	line.WriteString(influxDBMeasurementEscaper.Replace(measurement))
+
+	for _, key := range sortedInfluxDBKeys(tags) {
+		value := core.ConvertToString(tags[key])
+		if value == "" {
+			continue // ### continue, empty tags are not allowed ###
+		}
+		line.WriteByte(',')
+		line.WriteString(influxDBKeyEscaper.Replace(key))
+		line.WriteByte('=')
+		line.WriteString(influxDBKeyEscaper.Replace(value))
+	}
+
+	for idx, key := range sortedInfluxDBKeys(fields) {
+		value, err := formatInfluxDBField(fields[key])
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %s", key, err.Error())
+		}
+		if idx == 0 {
+			line.WriteByte(' ')
+		} else {
+			line.WriteByte(',')
+		}
+		line.WriteString(influxDBKeyEscaper.Replace(key))
+		line.WriteByte('=')
+		line.WriteString(value)
+	}
+
+	line.WriteByte(' ')
+	line.WriteString(strconv.FormatInt(timestamp, 10))
+	line.WriteByte('\n')
+	return []byte(line.String()), nil
+}
+
+// writeLines is an AssemblyFunc that converts all messages to line protocol
+// before passing them to the writer.
+func (prod *InfluxDB) writeLines(messages []*core.Message) {
+	lines := make([]*core.Message, 0, len(messages))
+	for _, msg := range messages {
+		line, err := prod.formatLine(msg)
+		if err != nil {
+			prod.Logger.WithError(err).Error("Failed to create line from metadata")
+			prod.TryFallback(msg)
+			continue
+		}
+		msg.StorePayload(line)
+		lines = append(lines, msg)
+	}
+
+	if len(lines) > 0 {
+		prod.assembly.Write(lines)
+	}
 }
 
 // sendBatch returns core.AssemblyFunc to flush batch
 func (prod *InfluxDB) sendBatch() core.AssemblyFunc {
 	if prod.writer.isConnectionUp() {
+		if prod.lineFromMetadata {
+			return prod.writeLines
+		}
 		return prod.assembly.Write
 	} else if prod.IsStopping() {
 		return prod.assembly.Flush
@@ -0,0 +1,116 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package producer
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gollum/core"
+
+	"github.com/sirupsen/logrus"
+)
+
+// influxDBWriter20 implements the io.Writer interface for InfluxDB 2.x
+// connections
+type influxDBWriter20 struct {
+	client       http.Client
+	writeURL     string
+	pingURL      string
+	host         string
+	token        string
+	connectionUp bool
+	logger       logrus.FieldLogger
+}
+
+// Configure sets the database connection values
+func (writer *influxDBWriter20) configure(conf core.PluginConfigReader, prod *InfluxDB) error {
+	writer.host = conf.GetString("Host", "localhost:8086")
+	writer.token = conf.GetString("Token", "")
+	writer.client.Timeout = conf.GetDuration("TimeoutSec", 10*time.Second, time.Second)
+	writer.logger = prod.Logger
+
+	org := conf.GetString("Org", "")
+	bucket := conf.GetString("Bucket", "default")
+	if bucket == "" {
+		conf.Errors.Pushf("Bucket must not be empty")
+	}
+
+	query := url.Values{}
+	query.Set("org", org)
+	query.Set("bucket", bucket)
+	query.Set("precision", "ms")
+
+	baseURL := writer.host
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "http://" + baseURL
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	writer.writeURL = fmt.Sprintf("%s/api/v2/write?%s", baseURL, query.Encode())
+	writer.pingURL = baseURL + "/ping"
+	return conf.Errors.OrNil()
+}
+
+func (writer *influxDBWriter20) isConnectionUp() bool {
+	if writer.connectionUp {
+		return true // ### return, connection not reported to be down ###
+	}
+
+	if response, err := writer.client.Get(writer.pingURL); err == nil && response != nil {
+		defer response.Body.Close()
+		if response.StatusCode >= 200 && response.StatusCode < 300 {
+			writer.connectionUp = true
+			writer.logger.Debug("Connected to " + writer.host)
+		}
+	}
+
+	return writer.connectionUp
+}
+
+func (writer *influxDBWriter20) Write(data []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, writer.writeURL, bytes.NewReader(data))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if writer.token != "" {
+		req.Header.Set("Authorization", "Token "+writer.token)
+	}
+
+	response, err := writer.client.Do(req)
+	if err != nil {
+		writer.connectionUp = false
+		return 0, err // ### return, failed to connect ###
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(response.Body)
+		if response.StatusCode >= 500 {
+			writer.connectionUp = false
+		}
+		return 0, fmt.Errorf("%s returned %s: %s", writer.writeURL, response.Status, string(body))
+	}
+
+	return len(data), nil
+}
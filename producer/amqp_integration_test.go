@@ -0,0 +1,92 @@
+// +build integration
+
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"gollum/core"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+// getAMQPTestServer returns the broker used for integration tests, e.g.
+// started by "docker run -p 5672:5672 rabbitmq:3".
+func getAMQPTestServer(t *testing.T) string {
+	server := os.Getenv("GOLLUM_AMQP_SERVER")
+	if server == "" {
+		t.Skip("GOLLUM_AMQP_SERVER is not set")
+	}
+	return server
+}
+
+func TestAMQPPublishConfirmed(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	server := getAMQPTestServer(t)
+
+	conn, err := amqp.Dial(server)
+	expect.NoError(err)
+	defer conn.Close()
+
+	channel, err := conn.Channel()
+	expect.NoError(err)
+	queue, err := channel.QueueDeclare("", false, true, true, false, nil)
+	expect.NoError(err)
+
+	prod := newAMQPTestProducer(t, map[string]interface{}{
+		"Servers":        []string{server},
+		"RoutingKeyFrom": "queue",
+	})
+	defer prod.closeConnection()
+
+	prod.sendMessage(core.NewMessage(nil, []byte("message"), tcontainer.MarshalMap{
+		"queue": queue.Name,
+	}, core.InvalidStreamID))
+
+	deliveries, err := channel.Consume(queue.Name, "", true, true, false, false, nil)
+	expect.NoError(err)
+
+	select {
+	case delivery := <-deliveries:
+		expect.Equal("message", string(delivery.Body))
+		expect.Equal(amqp.Persistent, delivery.DeliveryMode)
+	case <-time.After(time.Second):
+		t.Fatal("message was not received")
+	}
+}
+
+func TestAMQPReturnedToFallback(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	server := getAMQPTestServer(t)
+
+	fallback := newMockRouter(t.Name() + "Fallback")
+	prod := newAMQPTestProducer(t, map[string]interface{}{
+		"Servers":        []string{server},
+		"RoutingKey":     "gollum-unroutable-" + t.Name(),
+		"Mandatory":      true,
+		"FallbackStream": t.Name() + "Fallback",
+	})
+	defer prod.closeConnection()
+
+	prod.sendMessage(core.NewMessage(nil, []byte("unroutable"), nil, core.InvalidStreamID))
+	expect.Equal([]string{"unroutable"}, fallback.receive(t, 1))
+	expect.NotNil(prod.connection)
+}
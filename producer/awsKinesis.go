@@ -28,10 +28,26 @@ import (
 	metrics "github.com/rcrowley/go-metrics"
 )
 
+const (
+	kinesisMaxRecordSize      = 1 << 20
+	kinesisMaxRequestRecords  = 500
+	kinesisMaxRequestSize     = 5 << 20
+	kinesisShardRecordsPerSec = 1000
+	kinesisShardBytesPerSec   = 1 << 20
+)
+
+// kinesisPutClient is the subset of the kinesis API used by AwsKinesis
+type kinesisPutClient interface {
+	PutRecords(*kinesis.PutRecordsInput) (*kinesis.PutRecordsOutput, error)
+}
+
 // AwsKinesis producer plugin
 //
-// This producer sends data to an AWS kinesis stream.
-// Configuration example
+// This producer sends data to an AWS kinesis stream using the PutRecords
+// batch API. Records that fail individually, e.g. because a shard is
+// throttled, are retried while the rest of the batch is considered done.
+// Records larger than 1MB can't be written to kinesis and are sent to the
+// fallback.
 //
 // Parameters
 //
@@ -52,6 +68,24 @@ import (
 // batch send can be triggered.
 // By default this parameter is set to "1000".
 //
+// - KeyFrom: Defines the metadata field that contains the partition key of a
+// record. Messages are only joined into a record if they share the same key.
+// If the field is not set or empty, a unique key is generated per record.
+// By default this parameter is set to "".
+//
+// - MaxRetries: Defines how often records that failed within a PutRecords
+// call are retried before they are sent to the fallback.
+// By default this parameter is set to "3".
+//
+// - RetryWaitMs: Defines the time in milliseconds to wait before the first
+// retry. The wait time is doubled for every following retry.
+// By default this parameter is set to "100".
+//
+// - ShardCount: Defines the number of shards of the target streams. If set,
+// requests are throttled to stay below the write throughput of these shards,
+// i.e. 1000 records and 1MB per second and shard. Set to 0 to disable.
+// By default this parameter is set to "0".
+//
 // Examples
 //
 // This example set up a simple aws Kinesis producer:
@@ -69,6 +103,8 @@ import (
 //    RecordMaxMessages: 1
 //    RecordMessageDelimiter: "\n"
 //    SendTimeframeSec: 1
+//    KeyFrom: key
+//    ShardCount: 4
 //
 type AwsKinesis struct {
 	core.BatchedProducer `gollumdoc:"embed_type"`
@@ -79,15 +115,22 @@ type AwsKinesis struct {
 	recordMaxMessages int           `config:"RecordMaxMessages" default:"1"`
 	delimiter         []byte        `config:"RecordMessageDelimiter" default:"\n"`
 	sendTimeLimit     time.Duration `config:"SendTimeframeMs" default:"1000" metric:"ms"`
+	keyField          string        `config:"KeyFrom"`
+	maxRetries        int           `config:"MaxRetries" default:"3"`
+	retryWait         time.Duration `config:"RetryWaitMs" default:"100" metric:"ms"`
+	shardCount        int           `config:"ShardCount" default:"0"`
 
 	streamMap        map[core.MessageStreamID]string
 	metricCount      map[string]metrics.Counter
-	client           *kinesis.Kinesis
+	client           kinesisPutClient
 	lastSendTime     time.Time
 	counters         map[string]*int64
 	lastMetricUpdate time.Time
 	sequence         *int64
 	metricsRegistry  metrics.Registry
+	windowStart      time.Time
+	windowRecords    int
+	windowBytes      int
 }
 
 type streamData struct {
@@ -119,6 +162,10 @@ func (prod *AwsKinesis) Configure(conf core.PluginConfigReader) {
 		prod.Logger.Warning("RecordMessageDelimiter was empty. Defaulting to \"\\n\".")
 	}
 
+	if prod.maxRetries < 0 {
+		prod.maxRetries = 0
+	}
+
 	prod.streamMap = conf.GetStreamMap("StreamMapping", "")
 	for _, kinesisStreamName := range prod.streamMap {
 		counter := metrics.NewCounter()
@@ -156,12 +203,28 @@ func (prod *AwsKinesis) sendBatch() core.AssemblyFunc {
 	return prod.transformMessages
 }
 
+func (prod *AwsKinesis) getPartitionKey(msg *core.Message) string {
+	if prod.keyField != "" {
+		if key, exists := core.GetValuePath(msg.TryGetMetadata(), prod.keyField); exists {
+			if keyString := string(core.ConvertToBytes(key)); keyString != "" {
+				return keyString
+			}
+		}
+	}
+	return fmt.Sprintf("%X-%d", msg.GetStreamID(), atomic.AddInt64(prod.sequence, 1))
+}
+
 func (prod *AwsKinesis) transformMessages(messages []*core.Message) {
 	streamRecords := make(map[core.MessageStreamID]*streamData)
 
 	// Format and sort
 	for idx, msg := range messages {
-		messageHash := fmt.Sprintf("%X-%d", msg.GetStreamID(), atomic.AddInt64(prod.sequence, 1))
+		partitionKey := prod.getPartitionKey(msg)
+		if len(msg.GetPayload())+len(partitionKey) > kinesisMaxRecordSize {
+			prod.Logger.Errorf("Message of %d bytes exceeds the kinesis record size limit", len(msg.GetPayload()))
+			prod.TryFallback(msg)
+			continue
+		}
 
 		// Fetch buffer for this stream
 		records, recordsExists := streamRecords[msg.GetStreamID()]
@@ -192,20 +255,26 @@ func (prod *AwsKinesis) transformMessages(messages []*core.Message) {
 			streamRecords[msg.GetStreamID()] = records
 		}
 
-		// Fetch record for this buffer
+		// Fetch record for this buffer. Messages are only joined if they
+		// share a partition key and the record stays below the size limit.
 		var record *kinesis.PutRecordsRequestEntry
-		recordExists := len(records.content.Records) > 0
-		if !recordExists || records.lastRecordMessages+1 > prod.recordMaxMessages {
+		if numRecords := len(records.content.Records); numRecords > 0 {
+			record = records.content.Records[numRecords-1]
+		}
+
+		if record == nil ||
+			records.lastRecordMessages+1 > prod.recordMaxMessages ||
+			*record.PartitionKey != partitionKey ||
+			len(record.Data)+len(prod.delimiter)+len(msg.GetPayload())+len(partitionKey) > kinesisMaxRecordSize {
 			// Append record to stream
 			record = &kinesis.PutRecordsRequestEntry{
-				Data:         msg.GetPayload(),
-				PartitionKey: aws.String(messageHash),
+				Data:         make([]byte, 0, len(msg.GetPayload())),
+				PartitionKey: aws.String(partitionKey),
 			}
 			records.content.Records = append(records.content.Records, record)
 			records.original = append(records.original, make([]*core.Message, 0, prod.recordMaxMessages))
 			records.lastRecordMessages = 0
 		} else {
-			record = records.content.Records[len(records.content.Records)-1]
 			record.Data = append(record.Data, prod.delimiter...)
 		}
 
@@ -224,26 +293,137 @@ func (prod *AwsKinesis) transformMessages(messages []*core.Message) {
 	for _, records := range streamRecords {
 		prod.metricCount[*records.content.StreamName].Inc(int64(len(records.content.Records)))
 
-		result, err := prod.client.PutRecords(records.content)
+		start := 0
+		for _, end := range prod.splitRecords(records.content.Records) {
+			request := &kinesis.PutRecordsInput{
+				Records:    records.content.Records[start:end],
+				StreamName: records.content.StreamName,
+			}
+			prod.putRecords(request, records.original[start:end])
+			start = end
+		}
+	}
+}
+
+// splitRecords returns the end indexes of the requests required to send the
+// given records without violating the per request limits of PutRecords or
+// the throughput limits of the configured shards.
+func (prod *AwsKinesis) splitRecords(records []*kinesis.PutRecordsRequestEntry) []int {
+	maxRecords, maxSize := prod.getRequestLimits()
+	chunks := []int{}
+	numRecords, size := 0, 0
+
+	for idx, record := range records {
+		recordSize := len(record.Data) + len(*record.PartitionKey)
+		if numRecords > 0 && (numRecords+1 > maxRecords || size+recordSize > maxSize) {
+			chunks = append(chunks, idx)
+			numRecords, size = 0, 0
+		}
+		numRecords++
+		size += recordSize
+	}
+
+	if numRecords > 0 {
+		chunks = append(chunks, len(records))
+	}
+	return chunks
+}
+
+func (prod *AwsKinesis) getRequestLimits() (maxRecords int, maxSize int) {
+	maxRecords, maxSize = kinesisMaxRequestRecords, kinesisMaxRequestSize
+	if prod.shardCount > 0 {
+		if shardRecords := prod.shardCount * kinesisShardRecordsPerSec; shardRecords < maxRecords {
+			maxRecords = shardRecords
+		}
+		if shardBytes := prod.shardCount * kinesisShardBytesPerSec; shardBytes < maxSize {
+			maxSize = shardBytes
+		}
+	}
+	return maxRecords, maxSize
+}
+
+// throttle blocks until the given records can be sent without exceeding the
+// write throughput of the configured number of shards.
+func (prod *AwsKinesis) throttle(records []*kinesis.PutRecordsRequestEntry) {
+	if prod.shardCount <= 0 {
+		return // ### return, throttling disabled ###
+	}
+
+	size := 0
+	for _, record := range records {
+		size += len(record.Data) + len(*record.PartitionKey)
+	}
+
+	if time.Since(prod.windowStart) >= time.Second {
+		prod.windowStart = time.Now()
+		prod.windowRecords, prod.windowBytes = 0, 0
+	}
+
+	if prod.windowRecords+len(records) > prod.shardCount*kinesisShardRecordsPerSec ||
+		prod.windowBytes+size > prod.shardCount*kinesisShardBytesPerSec {
+		time.Sleep(time.Second - time.Since(prod.windowStart))
+		prod.windowStart = time.Now()
+		prod.windowRecords, prod.windowBytes = 0, 0
+	}
+
+	prod.windowRecords += len(records)
+	prod.windowBytes += size
+}
+
+// putRecords sends the given request and retries all records that failed
+// individually. Records still failing after MaxRetries are sent to the
+// fallback.
+func (prod *AwsKinesis) putRecords(request *kinesis.PutRecordsInput, original [][]*core.Message) {
+	for retry := 0; ; retry++ {
+		prod.throttle(request.Records)
+
+		result, err := prod.client.PutRecords(request)
 		if err != nil {
 			// Batch failed, fallback all
 			prod.Logger.WithError(err).Error("Failed to put records")
-			for _, messages := range records.original {
+			for _, messages := range original {
 				for _, msg := range messages {
 					prod.TryFallback(msg)
 				}
 			}
-			continue
+			return // ### return, request failed ###
 		}
 
-		// Check each message for errors
-		for msgIdx, record := range result.Records {
-			if record.ErrorMessage != nil {
-				prod.Logger.Error("AwsKinesis message write error: ", *record.ErrorMessage)
-				for _, msg := range records.original[msgIdx] {
-					prod.TryFallback(msg)
-				}
+		if aws.Int64Value(result.FailedRecordCount) == 0 {
+			return // ### return, all records written ###
+		}
+
+		// Collect failed records for retry
+		failedRecords := make([]*kinesis.PutRecordsRequestEntry, 0, aws.Int64Value(result.FailedRecordCount))
+		failedOriginal := make([][]*core.Message, 0, aws.Int64Value(result.FailedRecordCount))
+
+		for recordIdx, record := range result.Records {
+			if record.ErrorCode == nil {
+				continue
+			}
+			if retry < prod.maxRetries {
+				failedRecords = append(failedRecords, request.Records[recordIdx])
+				failedOriginal = append(failedOriginal, original[recordIdx])
+				continue
 			}
+
+			prod.Logger.Errorf("AwsKinesis message write error: %s %s", aws.StringValue(record.ErrorCode), aws.StringValue(record.ErrorMessage))
+			for _, msg := range original[recordIdx] {
+				prod.TryFallback(msg)
+			}
+		}
+
+		if len(failedRecords) == 0 {
+			return // ### return, nothing left to retry ###
+		}
+
+		prod.Logger.Warningf("Retrying %d failed records", len(failedRecords))
+		time.Sleep(prod.retryWait << uint(retry))
+
+		request = &kinesis.PutRecordsInput{
+			Records:    failedRecords,
+			StreamName: request.StreamName,
 		}
+		original = failedOriginal
 	}
 }
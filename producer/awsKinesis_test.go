@@ -0,0 +1,223 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"strings"
+	"testing"
+
+	"gollum/core"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/kinesis"
+	"github.com/trivago/tgo/ttesting"
+)
+
+// mockKinesisPutClient fails every record whose payload is listed in
+// failures until the number of failures for that payload reaches zero.
+type mockKinesisPutClient struct {
+	failures map[string]int
+	requests [][]string
+	keys     []string
+}
+
+func (client *mockKinesisPutClient) PutRecords(input *kinesis.PutRecordsInput) (*kinesis.PutRecordsOutput, error) {
+	output := &kinesis.PutRecordsOutput{FailedRecordCount: aws.Int64(0)}
+	request := []string{}
+
+	for _, record := range input.Records {
+		data := string(record.Data)
+		request = append(request, data)
+		client.keys = append(client.keys, *record.PartitionKey)
+
+		if client.failures[data] > 0 {
+			client.failures[data]--
+			*output.FailedRecordCount++
+			output.Records = append(output.Records, &kinesis.PutRecordsResultEntry{
+				ErrorCode:    aws.String("ProvisionedThroughputExceededException"),
+				ErrorMessage: aws.String("Rate exceeded"),
+			})
+			continue
+		}
+		output.Records = append(output.Records, &kinesis.PutRecordsResultEntry{
+			SequenceNumber: aws.String("1"),
+			ShardId:        aws.String("shardId-000000000000"),
+		})
+	}
+
+	client.requests = append(client.requests, request)
+	return output, nil
+}
+
+func newAwsKinesisTestMessage(payload string, key string) *core.Message {
+	msg := core.NewMessage(nil, []byte(payload), nil, core.StreamRegistry.GetStreamID("kinesisTest"))
+	if key != "" {
+		msg.GetMetadata().Set("key", key)
+	}
+	return msg
+}
+
+func TestAwsKinesisPartialRetry(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	client := &mockKinesisPutClient{
+		failures: map[string]int{"b": 1, "c": 2},
+	}
+	fallback := newMockRouter(t.Name() + "Fallback")
+
+	config := core.NewPluginConfig(t.Name(), "producer.AwsKinesis")
+	config.Override("SendTimeframeMs", 0)
+	config.Override("RetryWaitMs", 0)
+	config.Override("FallbackStream", t.Name()+"Fallback")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*AwsKinesis)
+	expect.True(casted)
+
+	prod.client = client
+
+	prod.transformMessages([]*core.Message{
+		newAwsKinesisTestMessage("a", ""),
+		newAwsKinesisTestMessage("b", ""),
+		newAwsKinesisTestMessage("c", ""),
+	})
+
+	// Only failed records are sent again
+	expect.Equal(3, len(client.requests))
+	expect.Equal([]string{"a", "b", "c"}, client.requests[0])
+	expect.Equal([]string{"b", "c"}, client.requests[1])
+	expect.Equal([]string{"c"}, client.requests[2])
+	expect.Equal(0, len(fallback.messages))
+}
+
+func TestAwsKinesisRetryExhausted(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	client := &mockKinesisPutClient{
+		failures: map[string]int{"b": 10},
+	}
+	fallback := newMockRouter(t.Name() + "Fallback")
+
+	config := core.NewPluginConfig(t.Name(), "producer.AwsKinesis")
+	config.Override("SendTimeframeMs", 0)
+	config.Override("RetryWaitMs", 0)
+	config.Override("FallbackStream", t.Name()+"Fallback")
+	config.Override("MaxRetries", 2)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*AwsKinesis)
+	expect.True(casted)
+
+	prod.client = client
+
+	prod.transformMessages([]*core.Message{
+		newAwsKinesisTestMessage("a", ""),
+		newAwsKinesisTestMessage("b", ""),
+	})
+
+	expect.Equal(3, len(client.requests))
+	expect.Equal([]string{"b"}, client.requests[2])
+	expect.Equal([]string{"b"}, fallback.receive(t, 1))
+}
+
+func TestAwsKinesisPartitionKey(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	client := &mockKinesisPutClient{}
+
+	config := core.NewPluginConfig(t.Name(), "producer.AwsKinesis")
+	config.Override("SendTimeframeMs", 0)
+	config.Override("RetryWaitMs", 0)
+	config.Override("KeyFrom", "key")
+	config.Override("RecordMaxMessages", 10)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*AwsKinesis)
+	expect.True(casted)
+
+	prod.client = client
+
+	prod.transformMessages([]*core.Message{
+		newAwsKinesisTestMessage("a", "k1"),
+		newAwsKinesisTestMessage("b", "k1"),
+		newAwsKinesisTestMessage("c", "k2"),
+	})
+
+	// Messages are only joined if they share a partition key
+	expect.Equal(1, len(client.requests))
+	expect.Equal([]string{"a\nb", "c"}, client.requests[0])
+	expect.Equal([]string{"k1", "k2"}, client.keys)
+}
+
+func TestAwsKinesisOversizedRecord(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	client := &mockKinesisPutClient{}
+	fallback := newMockRouter(t.Name() + "Fallback")
+
+	config := core.NewPluginConfig(t.Name(), "producer.AwsKinesis")
+	config.Override("SendTimeframeMs", 0)
+	config.Override("RetryWaitMs", 0)
+	config.Override("FallbackStream", t.Name()+"Fallback")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*AwsKinesis)
+	expect.True(casted)
+
+	prod.client = client
+
+	large := strings.Repeat("x", kinesisMaxRecordSize)
+	prod.transformMessages([]*core.Message{
+		newAwsKinesisTestMessage("a", ""),
+		newAwsKinesisTestMessage(large, ""),
+	})
+
+	expect.Equal(1, len(client.requests))
+	expect.Equal([]string{"a"}, client.requests[0])
+	expect.Equal([]string{large}, fallback.receive(t, 1))
+}
+
+func TestAwsKinesisSplitRecords(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "producer.AwsKinesis")
+	config.Override("SendTimeframeMs", 0)
+	config.Override("RetryWaitMs", 0)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*AwsKinesis)
+	expect.True(casted)
+
+	prod.client = &mockKinesisPutClient{}
+
+	records := make([]*kinesis.PutRecordsRequestEntry, 0, 1200)
+	for i := 0; i < 1200; i++ {
+		records = append(records, &kinesis.PutRecordsRequestEntry{
+			Data:         []byte("x"),
+			PartitionKey: aws.String("k"),
+		})
+	}
+	expect.Equal([]int{500, 1000, 1200}, prod.splitRecords(records))
+}
@@ -262,7 +262,9 @@ func (prod *AwsS3) rotateTargetFiles() {
 func (prod *AwsS3) close() {
 	defer prod.WorkerDone()
 
-	for _, batchedFile := range prod.files {
-		batchedFile.Close()
-	}
+	prod.RunBeforeDrainDeadline(func() {
+		for _, batchedFile := range prod.files {
+			batchedFile.Close()
+		}
+	})
 }
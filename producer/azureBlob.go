@@ -0,0 +1,333 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gollum/core"
+	"gollum/core/components"
+	"gollum/producer/azureblob"
+)
+
+// AzureBlob producer plugin
+//
+// This producer sends messages to Azure Blob Storage.
+//
+// Each "file" uses a configurable batch. Depending on the mode, batches are
+// either appended to an append blob or uploaded as separate block blobs.
+// Blobs are written directly, so no temporary storage on disk is required.
+// Like producer.AwsS3, rotation is mandatory in this producer.
+//
+// Parameters
+//
+// - Container: The blob container to upload to. A path prefix can be added
+// separated by "/", e.g. "logs/gollum".
+//
+// - File: This value is used as a template for final blob names. The string
+// " * " will replaced with the active stream name.
+// By default this parameter is set to "gollum_*.log"
+//
+// - Mode: Defines how batches are written. "append" appends all batches to
+// one append blob per rotation. "batch" uploads each batch as a new block
+// blob, numbered by the order of upload.
+// By default this parameter is set to "append".
+//
+// - Compress: When set to true, each batch is gzip compressed and ".gz" is
+// added to the blob name. In append mode the blob consists of concatenated
+// gzip members, which is still a valid gzip stream.
+// By default this parameter is set to false.
+//
+// - ConnectionString: Defines the storage account connection string as
+// shown in the Azure portal. When set, Account, AccountKey, SasToken and
+// Endpoint are read from this string.
+// By default this parameter is set to "".
+//
+// - Account: Defines the name of the storage account.
+// By default this parameter is set to "".
+//
+// - AccountKey: Defines the base64 encoded key of the storage account used
+// to sign requests.
+// By default this parameter is set to "".
+//
+// - SasToken: Defines a shared access signature used instead of the account
+// key. The token needs write and create permissions on the container.
+// By default this parameter is set to "".
+//
+// - ManagedIdentity: When set to true and neither an account key nor a SAS
+// token is set, requests are authorized with the managed identity of the
+// machine or app service gollum is running on. This requires an https
+// endpoint.
+// By default this parameter is set to false.
+//
+// - ManagedIdentityClientId: Defines the client id of a user assigned
+// managed identity. When left empty, the system assigned identity is used.
+// By default this parameter is set to "".
+//
+// - Endpoint: Defines the blob service endpoint. When left empty,
+// "https://<Account>.blob.core.windows.net" is used.
+// By default this parameter is set to "".
+//
+// - TimeoutSec: Defines the timeout in seconds for each request.
+// By default this parameter is set to 30.
+//
+// Examples
+//
+// This example sends all received messages from all streams to Azure,
+// appending to a separate blob for each stream:
+//
+//  AzureOut:
+//    Type: producer.AzureBlob
+//    Streams: "*"
+//    ConnectionString: "DefaultEndpointsProtocol=https;AccountName=gollum;AccountKey=..."
+//    Container: logs/gollum
+//    Compress: true
+//    Batch:
+//      TimeoutSec: 60
+//      MaxCount: 1000
+//      FlushCount: 500
+//    Rotation:
+//      Timestamp: 2006-01-02T15:04:05
+//      TimeoutMin: 60
+//      SizeMB: 512
+//    Modulators:
+//      - format.Envelope:
+//        Postfix: "\n"
+//
+type AzureBlob struct {
+	core.BufferedProducer `gollumdoc:"embed_type"`
+
+	// Rotate is public to make Pruner.Configure() callable (bug in treflect package)
+	// BatchConfig is public to make BatchedWriterConfig.Configure() callable (bug in treflect package)
+	Rotate      components.RotateConfig        `gollumdoc:"embed_type"`
+	BatchConfig components.BatchedWriterConfig `gollumdoc:"embed_type"`
+
+	// configurations
+	container       string        `config:"Container" default:""`
+	fileNamePattern string        `config:"File" default:"gollum_*.log"`
+	compress        bool          `config:"Compress" default:"false"`
+	timeout         time.Duration `config:"TimeoutSec" default:"30" metric:"sec"`
+	appendMode      bool
+	credentials     azureblob.Credentials
+
+	// properties
+	filesByStream    map[core.MessageStreamID]*components.BatchedWriterAssembly
+	files            map[string]*components.BatchedWriterAssembly
+	hasWildcard      bool
+	batchedFileGuard *sync.RWMutex
+	client           azureblob.Client
+}
+
+func init() {
+	core.TypeRegistry.Register(AzureBlob{})
+}
+
+// Configure initializes this producer with values from a plugin config.
+func (prod *AzureBlob) Configure(conf core.PluginConfigReader) {
+	prod.SetRollCallback(prod.rotateTargetFiles)
+	prod.SetStopCallback(prod.close)
+
+	prod.filesByStream = make(map[core.MessageStreamID]*components.BatchedWriterAssembly)
+	prod.files = make(map[string]*components.BatchedWriterAssembly)
+
+	prod.hasWildcard = strings.IndexByte(prod.fileNamePattern, '*') != -1
+	prod.Rotate.Enabled = true // force rotation
+
+	prod.batchedFileGuard = new(sync.RWMutex)
+
+	switch mode := strings.ToLower(conf.GetString("Mode", "append")); mode {
+	case "append":
+		prod.appendMode = true
+	case "batch":
+		prod.appendMode = false
+	default:
+		conf.Errors.Pushf("Unknown mode \"%s\"", mode)
+	}
+
+	if connectionString := conf.GetString("ConnectionString", ""); connectionString != "" {
+		credentials, err := azureblob.ParseConnectionString(connectionString)
+		conf.Errors.Push(err)
+		prod.credentials = credentials
+	} else {
+		prod.credentials = azureblob.Credentials{
+			Account:    conf.GetString("Account", ""),
+			AccountKey: conf.GetString("AccountKey", ""),
+			SasToken:   conf.GetString("SasToken", ""),
+			Endpoint:   conf.GetString("Endpoint", ""),
+		}
+	}
+	prod.credentials.ManagedIdentity = conf.GetBool("ManagedIdentity", false)
+	prod.credentials.ManagedIdentityClientID = conf.GetString("ManagedIdentityClientId", "")
+}
+
+// Produce writes batches of messages to Azure Blob Storage.
+func (prod *AzureBlob) Produce(workers *sync.WaitGroup) {
+	if err := prod.initClient(); err != nil {
+		prod.Logger.WithError(err).Error("Can't create blob storage client")
+	}
+
+	prod.AddMainWorker(workers)
+	prod.TickerMessageControlLoop(prod.writeMessage, prod.BatchConfig.BatchTimeout, prod.writeBatchOnTimeOut)
+}
+
+func (prod *AzureBlob) initClient() error {
+	if prod.container == "" {
+		return fmt.Errorf("no container set")
+	}
+
+	client, err := azureblob.NewServiceClient(prod.credentials, prod.timeout)
+	if err != nil {
+		return err
+	}
+
+	prod.client = client
+	return nil
+}
+
+func (prod *AzureBlob) getBatchedFile(streamID core.MessageStreamID, forceRotate bool) (*components.BatchedWriterAssembly, error) {
+	if prod.client == nil {
+		return nil, fmt.Errorf("no blob storage client")
+	}
+
+	// get batchedFile from filesByStream[streamID] map
+	prod.batchedFileGuard.RLock()
+	batchedFile, fileExists := prod.filesByStream[streamID]
+	prod.batchedFileGuard.RUnlock()
+	if fileExists {
+		if rotate, err := prod.needsRotate(batchedFile, forceRotate); !rotate {
+			return batchedFile, err // ### return, already open or error ###
+		}
+	}
+
+	prod.batchedFileGuard.Lock()
+	defer prod.batchedFileGuard.Unlock()
+
+	// check again to avoid race conditions
+	if batchedFile, fileExists = prod.filesByStream[streamID]; fileExists {
+		if rotate, err := prod.needsRotate(batchedFile, forceRotate); !rotate {
+			return batchedFile, err // ### return, already open or error ###
+		}
+	}
+
+	baseFileName := prod.getBaseFileName(streamID)
+
+	// get batchedFile from files[path] and assure the file is correctly mapped
+	batchedFile, fileExists = prod.files[baseFileName]
+	if !fileExists {
+		batchedFile = components.NewBatchedWriterAssembly(
+			prod.BatchConfig,
+			prod,
+			prod.TryFallback,
+			prod.Logger,
+		)
+		// Messages of failed uploads are sent to the fallback
+		batchedFile.SetErrorHandler(func(error) bool { return false })
+
+		prod.filesByStream[streamID] = batchedFile
+		prod.files[baseFileName] = batchedFile
+	}
+
+	// Close existing batchedFile.writer
+	if batchedFile.HasWriter() {
+		oldWriter := batchedFile.GetWriterAndUnset()
+
+		prod.Logger.Info("Rotated ", oldWriter.Name(), " -> ", baseFileName)
+		oldWriter.Close()
+	}
+
+	// Update BatchedWriterAssembly writer
+	writer := azureblob.NewBatchedBlobWriter(prod.client, prod.container, prod.getFinalFileName(baseFileName),
+		prod.appendMode, prod.compress, prod.Logger)
+	batchedFile.SetWriter(writer)
+
+	return batchedFile, nil
+}
+
+func (prod *AzureBlob) needsRotate(batchedFile *components.BatchedWriterAssembly, forceRotate bool) (bool, error) {
+	// run default rotation checks
+	if needsRotate, err := batchedFile.NeedsRotate(prod.Rotate, forceRotate); needsRotate {
+		return true, err
+	}
+
+	// append blobs are limited to 50000 blocks, keep a buffer as large
+	// batches are split into several blocks
+	writer, ok := batchedFile.GetWriter().(azureblob.BatchedBlobWriterInterface)
+	if ok && prod.appendMode && writer.GetBlockCount() > azureblob.MaxAppendBlocks-1000 {
+		prod.Logger.Debug("Rotate true: ", "block count reached limit of 50000")
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (prod *AzureBlob) getBaseFileName(streamID core.MessageStreamID) string {
+	if prod.hasWildcard {
+		streamName := core.StreamRegistry.GetStreamName(streamID)
+		return strings.Replace(prod.fileNamePattern, "*", streamName, -1)
+	}
+
+	return prod.fileNamePattern
+}
+
+func (prod *AzureBlob) getFinalFileName(baseFileName string) string {
+	fileExt := filepath.Ext(baseFileName)
+	fileName := baseFileName[:len(baseFileName)-len(fileExt)]
+
+	timestamp := time.Now().Format(prod.Rotate.Timestamp)
+	return fmt.Sprintf("%s_%s%s", fileName, timestamp, fileExt)
+}
+
+func (prod *AzureBlob) writeMessage(msg *core.Message) {
+	batchedFile, err := prod.getBatchedFile(msg.GetStreamID(), false)
+	if err != nil {
+		prod.Logger.Error("Write error: ", err)
+		prod.TryFallback(msg)
+		return // ### return, fallback ###
+	}
+
+	batchedFile.Batch.AppendOrFlush(msg, batchedFile.Flush, prod.IsActiveOrStopping, prod.TryFallback)
+}
+
+func (prod *AzureBlob) writeBatchOnTimeOut() {
+	prod.batchedFileGuard.RLock()
+	defer prod.batchedFileGuard.RUnlock()
+
+	for _, batchedFile := range prod.files {
+		batchedFile.FlushOnTimeOut()
+	}
+}
+
+func (prod *AzureBlob) rotateTargetFiles() {
+	for streamID := range prod.filesByStream {
+		if _, err := prod.getBatchedFile(streamID, true); err != nil {
+			prod.Logger.Error("Rotate error: ", err)
+		}
+	}
+}
+
+func (prod *AzureBlob) close() {
+	defer prod.WorkerDone()
+	prod.DefaultClose()
+
+	prod.RunBeforeDrainDeadline(func() {
+		for _, batchedFile := range prod.files {
+			batchedFile.Close()
+		}
+	})
+}
@@ -0,0 +1,153 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"testing"
+	"time"
+
+	"gollum/core"
+	"gollum/producer/azureblob"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+type mockAzureBlobClient struct {
+	blobs map[string]string
+}
+
+func (client *mockAzureBlobClient) PutBlockBlob(container, blob string, data []byte, properties azureblob.BlobProperties) error {
+	client.blobs[container+"/"+blob] = string(data)
+	return nil
+}
+
+func (client *mockAzureBlobClient) CreateAppendBlob(container, blob string, properties azureblob.BlobProperties) error {
+	client.blobs[container+"/"+blob] = ""
+	return nil
+}
+
+func (client *mockAzureBlobClient) AppendBlock(container, blob string, data []byte) error {
+	client.blobs[container+"/"+blob] += string(data)
+	return nil
+}
+
+func TestAzureBlobConfigure(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "producer.AzureBlob")
+	config.Override("Container", "logs/gollum")
+	config.Override("File", "*.log")
+	config.Override("Rotation/Timestamp", "2006")
+	config.Override("SasToken", "sig=abc")
+	config.Override("Endpoint", "http://127.0.0.1:10000/gollum")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*AzureBlob)
+	expect.True(casted)
+	expect.True(prod.appendMode)
+	expect.Equal("sig=abc", prod.credentials.SasToken)
+
+	config.Override("Mode", "batch")
+	config.Override("ConnectionString", "AccountName=gollum;AccountKey=a2V5")
+
+	plugin, err = core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted = plugin.(*AzureBlob)
+	expect.True(casted)
+	expect.False(prod.appendMode)
+	expect.Equal("gollum", prod.credentials.Account)
+	expect.Equal("https://gollum.blob.core.windows.net", prod.credentials.Endpoint)
+
+	expect.NoError(prod.initClient())
+	expect.NotNil(prod.client)
+
+	config.Override("Mode", "foo")
+	_, err = core.NewPluginWithConfig(config)
+	expect.NotNil(err)
+
+	config.Override("Mode", "batch")
+	config.Override("ConnectionString", "AccountKey=a2V5")
+	_, err = core.NewPluginWithConfig(config)
+	expect.NotNil(err)
+}
+
+func TestAzureBlobMissingSettings(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	// Missing settings are reported when the producer starts
+	for _, key := range []string{"Container", "SasToken"} {
+		config := core.NewPluginConfig("", "producer.AzureBlob")
+		config.Override("Container", "logs/gollum")
+		config.Override("File", "*.log")
+		config.Override("Rotation/Timestamp", "2006")
+		config.Override("SasToken", "sig=abc")
+		config.Override("Endpoint", "http://127.0.0.1:10000/gollum")
+		config.Override(key, "")
+
+		plugin, err := core.NewPluginWithConfig(config)
+		expect.NoError(err)
+
+		prod, casted := plugin.(*AzureBlob)
+		expect.True(casted)
+		expect.NotNil(prod.initClient())
+
+		_, err = prod.getBatchedFile(core.StreamRegistry.GetStreamID(t.Name()), false)
+		expect.NotNil(err)
+	}
+}
+
+func TestAzureBlobWriteMessage(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	for _, mode := range []string{"append", "batch"} {
+		config := core.NewPluginConfig("", "producer.AzureBlob")
+		config.Override("Container", "logs/gollum")
+		config.Override("File", "*.log")
+		config.Override("Rotation/Timestamp", "2006")
+		config.Override("SasToken", "sig=abc")
+		config.Override("Endpoint", "http://127.0.0.1:10000/gollum")
+		config.Override("Mode", mode)
+
+		plugin, err := core.NewPluginWithConfig(config)
+		expect.NoError(err)
+
+		prod, casted := plugin.(*AzureBlob)
+		expect.True(casted)
+
+		client := &mockAzureBlobClient{blobs: make(map[string]string)}
+		prod.client = client
+
+		streamID := core.StreamRegistry.GetStreamID(t.Name())
+		for _, payload := range []string{"a\n", "b\n"} {
+			prod.writeMessage(core.NewMessage(nil, []byte(payload), nil, streamID))
+		}
+
+		batchedFile, err := prod.getBatchedFile(streamID, false)
+		expect.NoError(err)
+		batchedFile.Flush()
+		batchedFile.Batch.WaitForFlush(time.Second)
+
+		expect.Equal(1, len(client.blobs))
+		for blob, content := range client.blobs {
+			expect.Equal("a\nb\n", content)
+			if mode == "append" {
+				expect.Equal("logs/gollum/"+prod.getFinalFileName(t.Name()+".log"), blob)
+			}
+		}
+	}
+}
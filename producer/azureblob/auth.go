@@ -0,0 +1,158 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azureblob
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+const (
+	defaultEndpointSuffix = "core.windows.net"
+	storageResource       = "https://storage.azure.com/"
+	tokenRefreshMargin    = 5 * time.Minute
+)
+
+// Credentials holds the account information used to access blob storage
+type Credentials struct {
+	Account                 string
+	AccountKey              string
+	SasToken                string
+	Endpoint                string
+	ManagedIdentity         bool
+	ManagedIdentityClientID string
+}
+
+// ParseConnectionString reads the account settings from an Azure storage
+// connection string, e.g. as shown in the Azure portal.
+func ParseConnectionString(connectionString string) (Credentials, error) {
+	settings := make(map[string]string)
+	for _, part := range strings.Split(connectionString, ";") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		keyValue := strings.SplitN(part, "=", 2)
+		if len(keyValue) != 2 {
+			return Credentials{}, fmt.Errorf("invalid connection string setting \"%s\"", part)
+		}
+		settings[strings.ToLower(keyValue[0])] = keyValue[1]
+	}
+
+	credentials := Credentials{
+		Account:    settings["accountname"],
+		AccountKey: settings["accountkey"],
+		SasToken:   settings["sharedaccesssignature"],
+		Endpoint:   settings["blobendpoint"],
+	}
+
+	if credentials.Endpoint == "" && credentials.Account != "" {
+		protocol, suffix := settings["defaultendpointsprotocol"], settings["endpointsuffix"]
+		if protocol == "" {
+			protocol = "https"
+		}
+		if suffix == "" {
+			suffix = defaultEndpointSuffix
+		}
+		credentials.Endpoint = fmt.Sprintf("%s://%s.blob.%s", protocol, credentials.Account, suffix)
+	}
+
+	if credentials.Endpoint == "" {
+		return Credentials{}, fmt.Errorf("connection string contains neither AccountName nor BlobEndpoint")
+	}
+	return credentials, nil
+}
+
+func (credentials Credentials) getEndpoint() (*url.URL, error) {
+	endpoint := credentials.Endpoint
+	if endpoint == "" {
+		if credentials.Account == "" {
+			return nil, fmt.Errorf("either an account or an endpoint is required")
+		}
+		endpoint = fmt.Sprintf("https://%s.blob.%s", credentials.Account, defaultEndpointSuffix)
+	}
+	return url.Parse(endpoint)
+}
+
+// newCredential returns the azblob credential used to authorize requests.
+// The account key, the SAS token or a managed identity is used, in this
+// order, depending on which of these are set. SAS tokens are not part of
+// the credential and have to be added to the endpoint instead.
+func (credentials Credentials) newCredential() (azblob.Credential, error) {
+	switch {
+	case credentials.AccountKey != "":
+		if credentials.Account == "" {
+			return nil, fmt.Errorf("an account name is required when using an account key")
+		}
+		return azblob.NewSharedKeyCredential(credentials.Account, credentials.AccountKey)
+
+	case credentials.SasToken != "":
+		return azblob.NewAnonymousCredential(), nil
+
+	case credentials.ManagedIdentity:
+		return newManagedIdentityCredential(credentials.ManagedIdentityClientID)
+
+	default:
+		return nil, fmt.Errorf("no credentials given, either an account key, a SAS token or a managed identity is required")
+	}
+}
+
+// newManagedIdentityCredential returns a token credential using the managed
+// identity assigned to the machine or app service gollum is running on. The
+// token is refreshed shortly before it expires.
+func newManagedIdentityCredential(clientID string) (azblob.Credential, error) {
+	token, err := adal.NewServicePrincipalTokenFromManagedIdentity(storageResource,
+		&adal.ManagedIdentityOptions{ClientID: clientID})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := token.EnsureFresh(); err != nil {
+		return nil, fmt.Errorf("managed identity token request failed: %s", err)
+	}
+
+	return azblob.NewTokenCredential("", func(credential azblob.TokenCredential) time.Duration {
+		if err := token.EnsureFresh(); err != nil {
+			return time.Minute // ### return, retry later ###
+		}
+		credential.SetToken(token.OAuthToken())
+
+		refreshIn := time.Until(token.Token().Expires()) - tokenRefreshMargin
+		if refreshIn < time.Minute {
+			return time.Minute
+		}
+		return refreshIn
+	}), nil
+}
+
+// getServiceURL returns the endpoint including the SAS token, if set.
+func (credentials Credentials) getServiceURL() (*url.URL, error) {
+	endpoint, err := credentials.getEndpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	if credentials.AccountKey == "" && credentials.SasToken != "" {
+		if _, err := url.ParseQuery(strings.TrimPrefix(credentials.SasToken, "?")); err != nil {
+			return nil, fmt.Errorf("invalid SAS token: %s", err)
+		}
+		endpoint.RawQuery = strings.TrimPrefix(credentials.SasToken, "?")
+	}
+	return endpoint, nil
+}
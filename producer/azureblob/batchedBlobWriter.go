@@ -0,0 +1,209 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azureblob
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"path"
+	"strings"
+
+	"gollum/core/components"
+
+	"github.com/sirupsen/logrus"
+)
+
+// MaxAppendBlocks is the maximum number of blocks an append blob can hold.
+// See https://docs.microsoft.com/rest/api/storageservices/append-block
+const MaxAppendBlocks = 50000
+
+// BatchedBlobWriterInterface extends the components.BatchedWriter interface for rotation checks
+type BatchedBlobWriterInterface interface {
+	components.BatchedWriter
+	GetBlockCount() int
+}
+
+// BatchedBlobWriter is the blob storage core.BatchedWriter implementation for the core.BatchedWriterAssembly.
+// In append mode all batches are appended to a single append blob. Otherwise
+// each batch is uploaded as a separate block blob.
+type BatchedBlobWriter struct {
+	client     Client
+	container  string
+	prefix     string
+	fileName   string
+	appendMode bool
+	compress   bool
+	logger     logrus.FieldLogger
+
+	blobCreated bool  // append blob has been created
+	blockCount  int   // number of blocks appended or blobs uploaded
+	totalSize   int64 // total size off all writes to this writer (need for rotations)
+}
+
+// NewBatchedBlobWriter returns a BatchedBlobWriter instance. The container
+// may contain a path prefix separated by "/".
+func NewBatchedBlobWriter(client Client, container string, fileName string, appendMode bool, compress bool, logger logrus.FieldLogger) *BatchedBlobWriter {
+	prefix := ""
+	if strings.Contains(container, "/") {
+		split := strings.SplitN(container, "/", 2)
+		container, prefix = split[0], split[1]
+	}
+
+	return &BatchedBlobWriter{
+		client:     client,
+		container:  container,
+		prefix:     prefix,
+		fileName:   fileName,
+		appendMode: appendMode,
+		compress:   compress,
+		logger:     logger,
+	}
+}
+
+// Write is part of the BatchedWriter interface. Each call uploads one batch.
+func (w *BatchedBlobWriter) Write(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil // ### return, nothing to write ###
+	}
+
+	data := p
+	if w.compress {
+		if data, err = compressData(p); err != nil {
+			return 0, err
+		}
+	}
+
+	if w.appendMode {
+		err = w.appendBlocks(data)
+	} else {
+		err = w.putBlob(data)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	w.totalSize += int64(len(p))
+	return len(p), nil
+}
+
+// Name is part of the BatchedWriter interface and returns the blob name
+func (w *BatchedBlobWriter) Name() string {
+	return w.fileName
+}
+
+// Size is part of the BatchedWriter interface and returns the number of uncompressed bytes written
+func (w *BatchedBlobWriter) Size() int64 {
+	return w.totalSize
+}
+
+// IsAccessible is part of the BatchedWriter interface. Blobs are written
+// synchronously, so the writer is always accessible.
+func (w *BatchedBlobWriter) IsAccessible() bool {
+	return true
+}
+
+// Close is part of the Close interface. As all writes are uploaded
+// directly, there is nothing left to do.
+func (w *BatchedBlobWriter) Close() error {
+	return nil
+}
+
+// GetBlockCount returns the number of blocks appended or blobs uploaded
+func (w *BatchedBlobWriter) GetBlockCount() int {
+	return w.blockCount
+}
+
+// GetBlobPath returns the path of the blob inside the container. In batch
+// mode the number of the batch is added to the file name.
+func (w *BatchedBlobWriter) GetBlobPath(batch int) string {
+	name := w.fileName
+	if !w.appendMode {
+		ext := path.Ext(name)
+		name = fmt.Sprintf("%s_%d%s", name[:len(name)-len(ext)], batch, ext)
+	}
+	if w.compress {
+		name += ".gz"
+	}
+	if w.prefix != "" {
+		return w.prefix + "/" + name
+	}
+	return name
+}
+
+func (w *BatchedBlobWriter) getProperties() BlobProperties {
+	if w.compress {
+		return BlobProperties{ContentEncoding: "gzip"}
+	}
+	return BlobProperties{}
+}
+
+func (w *BatchedBlobWriter) putBlob(data []byte) error {
+	blobPath := w.GetBlobPath(w.blockCount)
+	if err := w.client.PutBlockBlob(w.container, blobPath, data, w.getProperties()); err != nil {
+		w.logger.WithError(err).WithField("blob", blobPath).Error("Can't upload blob")
+		return err
+	}
+
+	w.blockCount++
+	w.logger.WithField("blob", blobPath).Debug("successfully uploaded blob")
+	return nil
+}
+
+func (w *BatchedBlobWriter) appendBlocks(data []byte) error {
+	blobPath := w.GetBlobPath(0)
+
+	if !w.blobCreated {
+		if err := w.client.CreateAppendBlob(w.container, blobPath, w.getProperties()); err != nil {
+			w.logger.WithError(err).WithField("blob", blobPath).Error("Can't create append blob")
+			return err
+		}
+		w.blobCreated = true
+	}
+
+	for len(data) > 0 {
+		blockSize := len(data)
+		if blockSize > MaxAppendBlockSize {
+			blockSize = MaxAppendBlockSize
+		}
+
+		if err := w.client.AppendBlock(w.container, blobPath, data[:blockSize]); err != nil {
+			w.logger.WithError(err).WithField("blob", blobPath).Error("Can't append block")
+			return err
+		}
+
+		w.blockCount++
+		data = data[blockSize:]
+	}
+
+	w.logger.WithField("blob", blobPath).Debug("successfully appended blocks")
+	return nil
+}
+
+// compressData returns data as a single gzip member. Members written by
+// consecutive calls can be concatenated to form a valid gzip stream.
+func compressData(data []byte) ([]byte, error) {
+	buffer := bytes.NewBuffer(make([]byte, 0, len(data)/2))
+	writer := gzip.NewWriter(buffer)
+
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
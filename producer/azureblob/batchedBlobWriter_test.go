@@ -0,0 +1,163 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azureblob
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/trivago/tgo/ttesting"
+)
+
+type mockClient struct {
+	blobs       map[string][]byte
+	blobTypes   map[string]string
+	properties  map[string]BlobProperties
+	appendCalls int
+	err         error
+}
+
+func newMockClient() *mockClient {
+	return &mockClient{
+		blobs:      make(map[string][]byte),
+		blobTypes:  make(map[string]string),
+		properties: make(map[string]BlobProperties),
+	}
+}
+
+func (client *mockClient) PutBlockBlob(container, blob string, data []byte, properties BlobProperties) error {
+	if client.err != nil {
+		return client.err
+	}
+	path := container + "/" + blob
+	client.blobs[path] = append([]byte{}, data...)
+	client.blobTypes[path] = "BlockBlob"
+	client.properties[path] = properties
+	return nil
+}
+
+func (client *mockClient) CreateAppendBlob(container, blob string, properties BlobProperties) error {
+	if client.err != nil {
+		return client.err
+	}
+	path := container + "/" + blob
+	client.blobs[path] = []byte{}
+	client.blobTypes[path] = "AppendBlob"
+	client.properties[path] = properties
+	return nil
+}
+
+func (client *mockClient) AppendBlock(container, blob string, data []byte) error {
+	if client.err != nil {
+		return client.err
+	}
+	path := container + "/" + blob
+	if client.blobTypes[path] != "AppendBlob" {
+		return fmt.Errorf("%s is not an append blob", path)
+	}
+	if len(data) > MaxAppendBlockSize {
+		return fmt.Errorf("block too large")
+	}
+	client.appendCalls++
+	client.blobs[path] = append(client.blobs[path], data...)
+	return nil
+}
+
+func TestBatchedBlobWriterAppend(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	client := newMockClient()
+
+	writer := NewBatchedBlobWriter(client, "logs/gollum", "test.log", true, false, logrus.WithField("Scope", "test"))
+	expect.Equal("gollum/test.log", writer.GetBlobPath(0))
+
+	n, err := writer.Write([]byte("first\n"))
+	expect.NoError(err)
+	expect.Equal(6, n)
+
+	large := bytes.Repeat([]byte("x"), MaxAppendBlockSize+10)
+	_, err = writer.Write(large)
+	expect.NoError(err)
+
+	expect.Equal(1, len(client.blobs))
+	expect.Equal("AppendBlob", client.blobTypes["logs/gollum/test.log"])
+	expect.Equal(append([]byte("first\n"), large...), client.blobs["logs/gollum/test.log"])
+	expect.Equal(3, client.appendCalls)
+	expect.Equal(3, writer.GetBlockCount())
+	expect.Equal(int64(6+len(large)), writer.Size())
+}
+
+func TestBatchedBlobWriterBatch(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	client := newMockClient()
+
+	writer := NewBatchedBlobWriter(client, "logs", "test.log", false, false, logrus.WithField("Scope", "test"))
+	_, err := writer.Write([]byte("first"))
+	expect.NoError(err)
+	_, err = writer.Write([]byte("second"))
+	expect.NoError(err)
+	_, err = writer.Write([]byte{})
+	expect.NoError(err)
+
+	expect.Equal(2, len(client.blobs))
+	expect.Equal("first", string(client.blobs["logs/test_0.log"]))
+	expect.Equal("second", string(client.blobs["logs/test_1.log"]))
+	expect.Equal("BlockBlob", client.blobTypes["logs/test_1.log"])
+	expect.Equal(2, writer.GetBlockCount())
+}
+
+func TestBatchedBlobWriterCompress(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	client := newMockClient()
+
+	writer := NewBatchedBlobWriter(client, "logs", "test.log", true, true, logrus.WithField("Scope", "test"))
+	_, err := writer.Write([]byte("first\n"))
+	expect.NoError(err)
+	_, err = writer.Write([]byte("second\n"))
+	expect.NoError(err)
+
+	blob, exists := client.blobs["logs/test.log.gz"]
+	expect.True(exists)
+	expect.Equal("gzip", client.properties["logs/test.log.gz"].ContentEncoding)
+
+	// Concatenated gzip members are read as one stream
+	reader, err := gzip.NewReader(bytes.NewReader(blob))
+	expect.NoError(err)
+	data, err := ioutil.ReadAll(reader)
+	expect.NoError(err)
+	expect.Equal("first\nsecond\n", string(data))
+	expect.Equal(int64(13), writer.Size())
+}
+
+func TestBatchedBlobWriterError(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	client := newMockClient()
+	client.err = fmt.Errorf("upload failed")
+
+	writer := NewBatchedBlobWriter(client, "logs", "test.log", true, false, logrus.WithField("Scope", "test"))
+	n, err := writer.Write([]byte("data"))
+	expect.NotNil(err)
+	expect.Equal(0, n)
+	expect.Equal(int64(0), writer.Size())
+
+	// The append blob is created with the first successful write
+	client.err = nil
+	_, err = writer.Write([]byte("data"))
+	expect.NoError(err)
+	expect.Equal("data", string(client.blobs["logs/test.log"]))
+}
@@ -0,0 +1,118 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azureblob
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+)
+
+const (
+	// MaxAppendBlockSize is the maximum number of bytes accepted by a single
+	// append block request.
+	MaxAppendBlockSize = 4 * 1024 * 1024
+)
+
+// Client defines the blob operations used by the AzureBlob producer
+type Client interface {
+	// PutBlockBlob creates or replaces a block blob with the given data.
+	PutBlockBlob(container, blob string, data []byte, properties BlobProperties) error
+
+	// CreateAppendBlob creates an empty append blob. Existing blobs are
+	// replaced.
+	CreateAppendBlob(container, blob string, properties BlobProperties) error
+
+	// AppendBlock appends data to an existing append blob. Data must not be
+	// larger than MaxAppendBlockSize.
+	AppendBlock(container, blob string, data []byte) error
+}
+
+// BlobProperties holds the optional properties set when creating a blob
+type BlobProperties struct {
+	ContentType     string
+	ContentEncoding string
+}
+
+// ServiceClient implements Client via the Azure Storage Blob SDK
+type ServiceClient struct {
+	service azblob.ServiceURL
+}
+
+// NewServiceClient creates a new client for the given credentials. Requests
+// are authorized using the account key, the SAS token or a managed identity,
+// in this order, depending on which of these are set. The timeout applies to
+// each request. Failed requests are not retried, as retrying an append
+// could write the same block twice.
+func NewServiceClient(credentials Credentials, timeout time.Duration) (*ServiceClient, error) {
+	endpoint, err := credentials.getServiceURL()
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := credentials.newCredential()
+	if err != nil {
+		return nil, err
+	}
+
+	pipeline := azblob.NewPipeline(credential, azblob.PipelineOptions{
+		Retry: azblob.RetryOptions{
+			MaxTries:   1,
+			TryTimeout: timeout,
+		},
+	})
+
+	return &ServiceClient{
+		service: azblob.NewServiceURL(*endpoint, pipeline),
+	}, nil
+}
+
+// PutBlockBlob implements Client.PutBlockBlob
+func (client *ServiceClient) PutBlockBlob(container, blob string, data []byte, properties BlobProperties) error {
+	blobURL := client.service.NewContainerURL(container).NewBlockBlobURL(blob)
+	_, err := blobURL.Upload(context.Background(), bytes.NewReader(data), properties.getHeaders(), azblob.Metadata{},
+		azblob.BlobAccessConditions{}, azblob.DefaultAccessTier, nil, azblob.ClientProvidedKeyOptions{})
+	return err
+}
+
+// CreateAppendBlob implements Client.CreateAppendBlob
+func (client *ServiceClient) CreateAppendBlob(container, blob string, properties BlobProperties) error {
+	blobURL := client.service.NewContainerURL(container).NewAppendBlobURL(blob)
+	_, err := blobURL.Create(context.Background(), properties.getHeaders(), azblob.Metadata{},
+		azblob.BlobAccessConditions{}, nil, azblob.ClientProvidedKeyOptions{})
+	return err
+}
+
+// AppendBlock implements Client.AppendBlock
+func (client *ServiceClient) AppendBlock(container, blob string, data []byte) error {
+	if len(data) > MaxAppendBlockSize {
+		return fmt.Errorf("block of %d bytes exceeds the maximum of %d bytes", len(data), MaxAppendBlockSize)
+	}
+
+	blobURL := client.service.NewContainerURL(container).NewAppendBlobURL(blob)
+	_, err := blobURL.AppendBlock(context.Background(), bytes.NewReader(data), azblob.AppendBlobAccessConditions{},
+		nil, azblob.ClientProvidedKeyOptions{})
+	return err
+}
+
+func (properties BlobProperties) getHeaders() azblob.BlobHTTPHeaders {
+	return azblob.BlobHTTPHeaders{
+		ContentType:     properties.ContentType,
+		ContentEncoding: properties.ContentEncoding,
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package azureblob
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/trivago/tgo/ttesting"
+)
+
+type recordedRequest struct {
+	method string
+	path   string
+	query  string
+	header http.Header
+	body   string
+}
+
+func newRecordingServer(requests *[]recordedRequest) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		*requests = append(*requests, recordedRequest{
+			method: r.Method,
+			path:   r.URL.Path,
+			query:  r.URL.RawQuery,
+			header: r.Header,
+			body:   string(body),
+		})
+		w.WriteHeader(http.StatusCreated)
+	}))
+}
+
+func TestParseConnectionString(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	credentials, err := ParseConnectionString("DefaultEndpointsProtocol=https;AccountName=gollum;AccountKey=a2V5;EndpointSuffix=core.chinacloudapi.cn")
+	expect.NoError(err)
+	expect.Equal("gollum", credentials.Account)
+	expect.Equal("a2V5", credentials.AccountKey)
+	expect.Equal("https://gollum.blob.core.chinacloudapi.cn", credentials.Endpoint)
+
+	credentials, err = ParseConnectionString("BlobEndpoint=http://127.0.0.1:10000/devstoreaccount1;SharedAccessSignature=sv=2019-12-12&sig=abc")
+	expect.NoError(err)
+	expect.Equal("http://127.0.0.1:10000/devstoreaccount1", credentials.Endpoint)
+	expect.Equal("sv=2019-12-12&sig=abc", credentials.SasToken)
+
+	_, err = ParseConnectionString("AccountKey=a2V5")
+	expect.NotNil(err)
+
+	_, err = ParseConnectionString("AccountName")
+	expect.NotNil(err)
+}
+
+func TestServiceClientSharedKey(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	requests := []recordedRequest{}
+	server := newRecordingServer(&requests)
+	defer server.Close()
+
+	client, err := NewServiceClient(Credentials{
+		Account:    "gollum",
+		AccountKey: "a2V5",
+		Endpoint:   server.URL + "/gollum",
+	}, time.Second)
+	expect.NoError(err)
+
+	expect.NoError(client.CreateAppendBlob("logs", "prefix/test.log.gz", BlobProperties{ContentEncoding: "gzip"}))
+	expect.NoError(client.AppendBlock("logs", "prefix/test.log.gz", []byte("hello world")))
+	expect.NoError(client.PutBlockBlob("logs", "test_0.log", []byte("batch"), BlobProperties{}))
+	expect.NotNil(client.AppendBlock("logs", "test.log", make([]byte, MaxAppendBlockSize+1)))
+
+	expect.Equal(3, len(requests))
+
+	create := requests[0]
+	expect.Equal(http.MethodPut, create.method)
+	expect.Equal("/gollum/logs/prefix/test.log.gz", create.path)
+	expect.Equal("AppendBlob", create.header.Get("x-ms-blob-type"))
+	expect.Equal("gzip", create.header.Get("x-ms-blob-content-encoding"))
+	expect.True(strings.HasPrefix(create.header.Get("Authorization"), "SharedKey gollum:"))
+
+	appendBlock := requests[1]
+	expect.True(strings.Contains(appendBlock.query, "comp=appendblock"))
+	expect.Equal("hello world", appendBlock.body)
+	expect.Equal("", appendBlock.header.Get("x-ms-blob-type"))
+
+	put := requests[2]
+	expect.Equal("/gollum/logs/test_0.log", put.path)
+	expect.Equal("BlockBlob", put.header.Get("x-ms-blob-type"))
+	expect.Equal("batch", put.body)
+
+	_, err = NewServiceClient(Credentials{Account: "gollum", AccountKey: "not base64!"}, time.Second)
+	expect.NotNil(err)
+}
+
+func TestServiceClientSasToken(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	requests := []recordedRequest{}
+	server := newRecordingServer(&requests)
+	defer server.Close()
+
+	client, err := NewServiceClient(Credentials{
+		SasToken: "?sv=2019-12-12&sp=cw&sig=abc%3D",
+		Endpoint: server.URL,
+	}, time.Second)
+	expect.NoError(err)
+
+	expect.NoError(client.AppendBlock("logs", "test.log", []byte("data")))
+	expect.Equal(1, len(requests))
+
+	query, err := url.ParseQuery(requests[0].query)
+	expect.NoError(err)
+	expect.Equal("appendblock", query.Get("comp"))
+	expect.Equal("abc=", query.Get("sig"))
+	expect.Equal("cw", query.Get("sp"))
+	expect.Equal("", requests[0].header.Get("Authorization"))
+}
+
+func TestManagedIdentityCredential(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	tokenRequests := 0
+	identityServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests++
+		expect.Equal("secret", r.Header.Get("secret"))
+		expect.Equal(storageResource, r.URL.Query().Get("resource"))
+		expect.Equal("client", r.URL.Query().Get("clientid"))
+		fmt.Fprintf(w, `{"access_token":"token","expires_on":"%d"}`, time.Now().Add(time.Hour).Unix())
+	}))
+	defer identityServer.Close()
+
+	// Let the identity server act as app service token endpoint
+	os.Setenv("MSI_ENDPOINT", identityServer.URL)
+	os.Setenv("MSI_SECRET", "secret")
+	defer os.Unsetenv("MSI_ENDPOINT")
+	defer os.Unsetenv("MSI_SECRET")
+
+	credential, err := Credentials{
+		ManagedIdentity:         true,
+		ManagedIdentityClientID: "client",
+	}.newCredential()
+	expect.NoError(err)
+
+	token, isToken := credential.(azblob.TokenCredential)
+	expect.True(isToken)
+	expect.Equal("token", token.Token())
+	expect.Equal(1, tokenRequests)
+}
+
+func TestServiceClientErrors(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("x-ms-error-code", "ContainerNotFound")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client, err := NewServiceClient(Credentials{SasToken: "sig=abc", Endpoint: server.URL}, time.Second)
+	expect.NoError(err)
+
+	err = client.PutBlockBlob("logs", "a.log", []byte("a"), BlobProperties{})
+	expect.NotNil(err)
+	expect.True(strings.Contains(err.Error(), "ContainerNotFound"))
+
+	_, err = NewServiceClient(Credentials{Account: "gollum"}, time.Second)
+	expect.NotNil(err)
+
+	_, err = NewServiceClient(Credentials{SasToken: "sig=abc"}, time.Second)
+	expect.NotNil(err)
+}
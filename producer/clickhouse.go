@@ -0,0 +1,311 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package producer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"gollum/core"
+	"gollum/core/components"
+
+	"github.com/trivago/tgo/tcontainer"
+)
+
+const (
+	clickHouseSourcePayload = "payload"
+	clickHouseSourceTime    = "time"
+	clickHouseSourceJSON    = "json:"
+	clickHouseSourceMeta    = "meta:"
+)
+
+// ClickHouse producer
+//
+// This producer inserts batches of rows into a ClickHouse table using the
+// HTTP interface. Each message is converted to one row and each batch is sent
+// as one INSERT statement using the JSONEachRow format. Messages that cannot
+// be converted and all messages of failed inserts are sent to the fallback.
+// Columns not set for a row are filled with the column's default value by
+// ClickHouse.
+//
+// Parameters
+//
+// - Address: Defines the URL of the ClickHouse HTTP interface. Use
+// "https://" to connect via TLS.
+// By default this parameter is set to "http://localhost:8123/".
+//
+// - Database: Defines the database of the target table.
+// By default this parameter is set to "default".
+//
+// - Table: Defines the table to insert into.
+// By default this parameter is set to "logs".
+//
+// - User, Password: Define the credentials used to authenticate.
+// By default these parameters are set to "default" and "".
+//
+// - ColumnsFrom: Defines a map of column names to the value to insert.
+// Values can be "payload" for the message payload as string, "time" for the
+// message creation time as unix timestamp, "json:<path>" for a field of the
+// JSON encoded payload or "meta:<path>" for a metadata field. Nested fields
+// are addressed by a path like "request/status". If no columns are set, each
+// message is expected to contain a JSON object that is inserted as-is.
+// By default this parameter is set to an empty map.
+//
+// - AsyncInsert: When set to true, ClickHouse buffers inserts on the server
+// side (async_insert=1). Requests return after the data has been written.
+// By default this parameter is set to false.
+//
+// - TimeoutSec: Defines the timeout for a single request in seconds.
+// By default this parameter is set to "10".
+//
+// - TlsKeyLocation, TlsKeyPem: The client's private key used for TLS based
+// authentication, given as path or PEM encoded string.
+// By default these parameters are set to "".
+//
+// - TlsCertificateLocation, TlsCertificatePem: The client's public key used
+// for TLS based authentication, given as path or PEM encoded string.
+// By default these parameters are set to "".
+//
+// - TlsCaLocation, TlsCaPem: The CA certificate(s) used for verifying the
+// server's key, given as path or PEM encoded string. If not set, the
+// system's root certificates are used.
+// By default these parameters are set to "".
+//
+// - TlsServerName: Used to verify the hostname on the server's certificate
+// unless TlsInsecureSkipVerify is true.
+// By default this parameter is set to "".
+//
+// - TlsInsecureSkipVerify: Disables server certificate chain and host name
+// verification.
+// By default this parameter is set to false.
+//
+// Examples
+//
+// This example writes JSON encoded access logs together with the kafka
+// topic they were read from.
+//
+//  accessLogToClickHouse:
+//    Type: producer.ClickHouse
+//    Streams: accesslog
+//    Address: "https://clickhouse:8443/"
+//    Database: logs
+//    Table: access
+//    User: gollum
+//    Password: ${CLICKHOUSE_PASSWORD}
+//    ColumnsFrom:
+//      timestamp: time
+//      status: json:response/status
+//      url: json:request/url
+//      topic: meta:topic
+//      raw: payload
+//    Batch:
+//      MaxCount: 10000
+//      FlushCount: 5000
+//      TimeoutSec: 2
+type ClickHouse struct {
+	core.BatchedProducer `gollumdoc:"embed_type"`
+	database             string        `config:"Database" default:"default"`
+	table                string        `config:"Table" default:"logs"`
+	user                 string        `config:"User" default:"default"`
+	password             string        `config:"Password"`
+	asyncInsert          bool          `config:"AsyncInsert" default:"false"`
+	timeout              time.Duration `config:"TimeoutSec" default:"10" metric:"sec"`
+	columns              map[string]string
+	hasJSONColumns       bool
+	insertURL            string
+	client               *http.Client
+}
+
+func init() {
+	core.TypeRegistry.Register(ClickHouse{})
+}
+
+// Configure initializes this producer with values from a plugin config.
+func (prod *ClickHouse) Configure(conf core.PluginConfigReader) {
+	address := conf.GetURL("Address", "http://localhost:8123/")
+	prod.columns = conf.GetStringMap("ColumnsFrom", map[string]string{})
+
+	if prod.table == "" {
+		conf.Errors.Pushf("Table must not be empty")
+	}
+
+	for column, source := range prod.columns {
+		switch {
+		case source == clickHouseSourcePayload, source == clickHouseSourceTime:
+		case strings.HasPrefix(source, clickHouseSourceJSON):
+			prod.hasJSONColumns = true
+		case strings.HasPrefix(source, clickHouseSourceMeta):
+		default:
+			conf.Errors.Pushf("Unknown source '%s' for column '%s'", source, column)
+		}
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         conf.GetString("TlsServerName", ""),
+		InsecureSkipVerify: conf.GetBool("TlsInsecureSkipVerify", false),
+	}
+
+	cert, err := components.ReadTLSKeyPair(conf)
+	if !conf.Errors.Push(err) && cert != nil {
+		tlsConfig.Certificates = []tls.Certificate{*cert}
+	}
+
+	caCertPool, err := components.ReadTLSCertPool(conf)
+	if !conf.Errors.Push(err) {
+		tlsConfig.RootCAs = caCertPool
+	}
+
+	prod.client = &http.Client{
+		Timeout:   prod.timeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+
+	if address == nil {
+		conf.Errors.Pushf("Invalid address")
+		return // ### return, invalid address ###
+	}
+
+	query := address.Query()
+	query.Set("query", fmt.Sprintf("INSERT INTO %s.%s FORMAT JSONEachRow",
+		quoteClickHouseIdentifier(prod.database), quoteClickHouseIdentifier(prod.table)))
+	if prod.asyncInsert {
+		query.Set("async_insert", "1")
+		query.Set("wait_for_async_insert", "1")
+	}
+	address.RawQuery = query.Encode()
+	prod.insertURL = address.String()
+}
+
+// quoteClickHouseIdentifier quotes a database or table name.
+func quoteClickHouseIdentifier(name string) string {
+	return "`" + strings.NewReplacer("\\", "\\\\", "`", "\\`").Replace(name) + "`"
+}
+
+// getClickHouseColumnValue returns the value for the given source or false if the
+// value is not set.
+func getClickHouseColumnValue(msg *core.Message, source string, document tcontainer.MarshalMap) (interface{}, bool) {
+	switch {
+	case source == clickHouseSourcePayload:
+		return msg.String(), true
+
+	case source == clickHouseSourceTime:
+		return msg.GetCreationTime().Unix(), true
+
+	case strings.HasPrefix(source, clickHouseSourceJSON):
+		return core.GetValuePath(document, source[len(clickHouseSourceJSON):])
+
+	default:
+		value, exists := core.GetValuePath(msg.TryGetMetadata(), source[len(clickHouseSourceMeta):])
+		if data, isBytes := value.([]byte); isBytes {
+			return string(data), exists
+		}
+		return value, exists
+	}
+}
+
+// assembleRow converts a message into one line of JSONEachRow data.
+func (prod *ClickHouse) assembleRow(msg *core.Message) ([]byte, error) {
+	if len(prod.columns) == 0 {
+		payload := bytes.TrimSpace(msg.GetPayload())
+		if len(payload) == 0 || payload[0] != '{' || !json.Valid(payload) {
+			return nil, fmt.Errorf("payload is not a JSON object")
+		}
+		return payload, nil // ### return, payload is the row ###
+	}
+
+	var document tcontainer.MarshalMap
+	if prod.hasJSONColumns {
+		decoder := json.NewDecoder(bytes.NewReader(msg.GetPayload()))
+		decoder.UseNumber()
+		if err := decoder.Decode(&document); err != nil {
+			return nil, err
+		}
+	}
+
+	row := make(map[string]interface{}, len(prod.columns))
+	for column, source := range prod.columns {
+		if value, exists := getClickHouseColumnValue(msg, source, document); exists {
+			row[column] = value
+		}
+	}
+	return json.Marshal(row)
+}
+
+// insert sends the given rows as one INSERT statement.
+func (prod *ClickHouse) insert(rows []byte) error {
+	req, err := http.NewRequest(http.MethodPost, prod.insertURL, bytes.NewReader(rows))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("X-ClickHouse-User", prod.user)
+	if prod.password != "" {
+		req.Header.Set("X-ClickHouse-Key", prod.password)
+	}
+
+	resp, err := prod.client.Do(req)
+	_, _, err = httpRequestWrapper(resp, err)
+	if resp != nil {
+		resp.Body.Close()
+	}
+	return err
+}
+
+// sendMessages is an AssemblyFunc that inserts all messages of a batch.
+func (prod *ClickHouse) sendMessages(messages []*core.Message) {
+	rows := bytes.Buffer{}
+	inserted := make([]*core.Message, 0, len(messages))
+
+	for _, msg := range messages {
+		row, err := prod.assembleRow(msg)
+		if err != nil {
+			prod.Logger.WithError(err).Error("Failed to convert message to row")
+			prod.TryFallback(msg)
+			continue
+		}
+
+		rows.Write(row)
+		rows.WriteByte('\n')
+		inserted = append(inserted, msg)
+	}
+
+	if len(inserted) == 0 {
+		return // ### return, nothing to insert ###
+	}
+
+	if err := prod.insert(rows.Bytes()); err != nil {
+		prod.Logger.WithError(err).Errorf("Failed to insert %d rows", len(inserted))
+		for _, msg := range inserted {
+			prod.TryFallback(msg)
+		}
+	}
+}
+
+func (prod *ClickHouse) sendBatch() core.AssemblyFunc {
+	return prod.sendMessages
+}
+
+// Produce starts a batched producer inserting collected messages on flush.
+func (prod *ClickHouse) Produce(workers *sync.WaitGroup) {
+	prod.BatchMessageLoop(workers, prod.sendBatch)
+}
@@ -0,0 +1,201 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+type clickHouseStub struct {
+	guard    sync.Mutex
+	queries  []string
+	bodies   []string
+	users    []string
+	failures int
+}
+
+func (stub *clickHouseStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	stub.guard.Lock()
+	defer stub.guard.Unlock()
+
+	if stub.failures > 0 {
+		stub.failures--
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, "Code: 60. DB::Exception: Table does not exist")
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	stub.queries = append(stub.queries, r.URL.Query().Get("query"))
+	stub.bodies = append(stub.bodies, string(body))
+	stub.users = append(stub.users, r.Header.Get("X-ClickHouse-User")+":"+r.Header.Get("X-ClickHouse-Key"))
+}
+
+func TestClickHouseRowFromColumns(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "producer.ClickHouse")
+	config.Override("ColumnsFrom", map[string]string{
+		"status":  "json:response/status",
+		"url":     "json:request/url",
+		"missing": "json:response/size",
+		"host":    "meta:host",
+		"topic":   "meta:kafka/topic",
+		"raw":     "payload",
+		"ts":      "time",
+	})
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*ClickHouse)
+	expect.True(casted)
+
+	payload := `{"request":{"url":"/index.html"},"response":{"status":200}}`
+	msg := core.NewMessage(nil, []byte(payload), tcontainer.MarshalMap{
+		"host":  []byte("web01"),
+		"kafka": tcontainer.MarshalMap{"topic": "access"},
+	}, core.InvalidStreamID)
+
+	row, err := prod.assembleRow(msg)
+	expect.NoError(err)
+
+	expected := fmt.Sprintf(`{"host":"web01","raw":%q,"status":200,"topic":"access","ts":%d,"url":"/index.html"}`,
+		payload, msg.GetCreationTime().Unix())
+	expect.Equal(expected, string(row))
+
+	// JSON columns require a JSON payload
+	msg = core.NewMessage(nil, []byte("not json"), nil, core.InvalidStreamID)
+	_, err = prod.assembleRow(msg)
+	expect.NotNil(err)
+}
+
+func TestClickHouseRowFromMetadataOnly(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "producer.ClickHouse")
+	config.Override("ColumnsFrom", map[string]string{
+		"message": "payload",
+		"level":   "meta:level",
+	})
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*ClickHouse)
+	expect.True(casted)
+
+	// The payload is not parsed if no JSON columns are used
+	msg := core.NewMessage(nil, []byte("plain text"), nil, core.InvalidStreamID)
+	row, err := prod.assembleRow(msg)
+	expect.NoError(err)
+	expect.Equal(`{"message":"plain text"}`, string(row))
+}
+
+func TestClickHouseRowFromPayload(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "producer.ClickHouse")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*ClickHouse)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte(" {\"a\":1}\n"), nil, core.InvalidStreamID)
+	row, err := prod.assembleRow(msg)
+	expect.NoError(err)
+	expect.Equal(`{"a":1}`, string(row))
+
+	for _, payload := range []string{"", "[1,2]", "{broken"} {
+		msg = core.NewMessage(nil, []byte(payload), nil, core.InvalidStreamID)
+		_, err = prod.assembleRow(msg)
+		expect.NotNil(err)
+	}
+}
+
+func TestClickHouseConfigErrors(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	for idx, settings := range []map[string]interface{}{
+		{"Table": ""},
+		{"ColumnsFrom": map[string]string{"a": "unknown"}},
+	} {
+		config := core.NewPluginConfig(fmt.Sprintf("%s%d", t.Name(), idx), "producer.ClickHouse")
+		for key, value := range settings {
+			config.Override(key, value)
+		}
+		_, err := core.NewPluginWithConfig(config)
+		expect.NotNil(err)
+	}
+}
+
+func TestClickHouseInsert(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	stub := &clickHouseStub{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	fallback := newMockRouter(t.Name() + "Fallback")
+
+	config := core.NewPluginConfig(t.Name(), "producer.ClickHouse")
+	config.Override("Address", server.URL)
+	config.Override("Database", "logs")
+	config.Override("Table", "access`log")
+	config.Override("User", "gollum")
+	config.Override("Password", "secret")
+	config.Override("AsyncInsert", true)
+	config.Override("FallbackStream", t.Name()+"Fallback")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*ClickHouse)
+	expect.True(casted)
+
+	expect.Contains(prod.insertURL, "async_insert=1")
+
+	prod.sendMessages([]*core.Message{
+		core.NewMessage(nil, []byte(`{"a":1}`), nil, core.InvalidStreamID),
+		core.NewMessage(nil, []byte("invalid"), nil, core.InvalidStreamID),
+		core.NewMessage(nil, []byte(`{"a":2}`), nil, core.InvalidStreamID),
+	})
+
+	expect.Equal([]string{"invalid"}, fallback.receive(t, 1))
+	expect.Equal([]string{"INSERT INTO `logs`.`access\\`log` FORMAT JSONEachRow"}, stub.queries)
+	expect.Equal([]string{"{\"a\":1}\n{\"a\":2}\n"}, stub.bodies)
+	expect.Equal([]string{"gollum:secret"}, stub.users)
+
+	// Failed inserts send all rows to the fallback
+	stub.failures = 1
+	prod.sendMessages([]*core.Message{
+		core.NewMessage(nil, []byte(`{"a":3}`), nil, core.InvalidStreamID),
+		core.NewMessage(nil, []byte(`{"a":4}`), nil, core.InvalidStreamID),
+	})
+	expect.Equal([]string{`{"a":3}`, `{"a":4}`}, fallback.receive(t, 2))
+	expect.Equal(1, len(stub.bodies))
+}
@@ -15,22 +15,57 @@
 package producer
 
 import (
+	"bytes"
 	"fmt"
 	"gollum/core"
+	"gollum/logger"
 	"os"
+	"regexp"
 	"strings"
 	"sync"
+	"text/template"
+
+	"github.com/trivago/tgo/tcontainer"
+)
+
+const (
+	consoleColorReset  = "\x1b[0m"
+	consoleColorRed    = "\x1b[31m"
+	consoleColorYellow = "\x1b[33m"
+	consoleColorBlue   = "\x1b[36m"
+	consoleColorGray   = "\x1b[37m"
 )
 
 // Console producer plugin
 //
 // The console producer writes messages to standard output or standard error.
+// For local development, messages can be colored by their log level.
 //
 // Parameters
 //
 // - Console: Chooses the output device; either "stdout" or "stderr".
 // By default this is set to "stdout".
 //
+// - Colorize: When set to true, messages are colored by their log level.
+// Colors are only used if the output device is a terminal and colors have
+// not been disabled via "-log-colors never". "-log-colors always" enables
+// colors for other devices, too.
+// By default this parameter is set to false.
+//
+// - LevelFrom: Defines the metadata key to read the log level from. If the
+// key is not set, LevelPattern is used.
+// By default this parameter is set to "".
+//
+// - LevelPattern: Defines a regular expression used to find the log level in
+// the payload. The first matching group, or the whole match if there is no
+// group, is used as level.
+// By default this parameter is set to "(?i)\b(trace|debug|info|warn|warning|error|fatal|panic)\b".
+//
+// - Template: Defines a go template used to render each line. The fields
+// .Payload, .Level, .Stream and .Metadata can be used. If empty, the payload
+// is written as-is.
+// By default this parameter is set to "".
+//
 // Examples
 //
 //   StdErrPrinter:
@@ -38,9 +73,30 @@ import (
 //     Streams: myerrorstream
 //     Console: stderr
 //
+// This example prints colored log lines with the stream name prepended.
+//
+//   DevPrinter:
+//     Type: producer.Console
+//     Streams: "*"
+//     Colorize: true
+//     LevelFrom: level
+//     Template: "[{{.Stream}}] {{.Payload}}"
+//
 type Console struct {
 	core.BufferedProducer `gollumdoc:"embed_type"`
+	colorize              bool   `config:"Colorize" default:"false"`
+	levelFrom             string `config:"LevelFrom"`
 	console               *os.File
+	levelPattern          *regexp.Regexp
+	template              *template.Template
+}
+
+// consoleLine defines the fields available in Console templates.
+type consoleLine struct {
+	Payload  string
+	Level    string
+	Stream   string
+	Metadata tcontainer.MarshalMap
 }
 
 func init() {
@@ -59,10 +115,107 @@ func (prod *Console) Configure(conf core.PluginConfigReader) {
 	case "stderr":
 		prod.console = os.Stderr
 	}
+
+	var err error
+	pattern := conf.GetString("LevelPattern", `(?i)\b(trace|debug|info|warn|warning|error|fatal|panic)\b`)
+	if prod.levelPattern, err = regexp.Compile(pattern); err != nil {
+		conf.Errors.Push(err)
+	}
+
+	if tpl := conf.GetString("Template", ""); tpl != "" {
+		prod.template, err = template.New("Console").Parse(tpl)
+		conf.Errors.Push(err)
+	}
+
+	prod.colorize = prod.colorize && logger.UseColors(prod.console)
+}
+
+// getLevel returns the lowercased log level of the given message or "" if
+// no level could be found.
+func (prod *Console) getLevel(msg *core.Message) string {
+	if prod.levelFrom != "" {
+		if metadata := msg.TryGetMetadata(); metadata != nil {
+			if value, exists := core.GetValuePath(metadata, prod.levelFrom); exists {
+				return strings.ToLower(string(core.ConvertToBytes(value)))
+			}
+		}
+	}
+
+	match := prod.levelPattern.FindSubmatch(msg.GetPayload())
+	switch {
+	case len(match) > 1:
+		return strings.ToLower(string(match[1]))
+	case len(match) == 1:
+		return strings.ToLower(string(match[0]))
+	default:
+		return ""
+	}
+}
+
+// getConsoleColor returns the ANSI color sequence for the given log level or "" if
+// the level is not known.
+func getConsoleColor(level string) string {
+	switch level {
+	case "trace", "debug":
+		return consoleColorGray
+	case "info", "notice":
+		return consoleColorBlue
+	case "warn", "warning":
+		return consoleColorYellow
+	case "error", "err", "fatal", "panic", "crit", "critical", "alert", "emerg":
+		return consoleColorRed
+	default:
+		return ""
+	}
+}
+
+// format renders the given message as it is written to the console.
+func (prod *Console) format(msg *core.Message) ([]byte, error) {
+	line := msg.GetPayload()
+	level := ""
+	if prod.colorize || prod.template != nil {
+		level = prod.getLevel(msg)
+	}
+
+	if prod.template != nil {
+		buffer := bytes.Buffer{}
+		err := prod.template.Execute(&buffer, consoleLine{
+			Payload:  msg.String(),
+			Level:    level,
+			Stream:   msg.GetStreamID().GetName(),
+			Metadata: msg.TryGetMetadata(),
+		})
+		if err != nil {
+			return nil, err
+		}
+		line = buffer.Bytes()
+	}
+
+	color := ""
+	if prod.colorize {
+		color = getConsoleColor(level)
+	}
+	if color == "" {
+		return line, nil // ### return, no color ###
+	}
+
+	// Keep trailing newlines outside of the colored text
+	text := bytes.TrimRight(line, "\r\n")
+	colored := make([]byte, 0, len(line)+len(color)+len(consoleColorReset))
+	colored = append(colored, color...)
+	colored = append(colored, text...)
+	colored = append(colored, consoleColorReset...)
+	return append(colored, line[len(text):]...), nil
 }
 
 func (prod *Console) printMessage(msg *core.Message) {
-	fmt.Fprint(prod.console, msg.String())
+	line, err := prod.format(msg)
+	if err != nil {
+		prod.Logger.WithError(err).Error("Failed to render message")
+		prod.TryFallback(msg)
+		return
+	}
+	fmt.Fprint(prod.console, string(line))
 }
 
 // Produce writes to stdout or stderr.
@@ -0,0 +1,143 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"gollum/core"
+	"gollum/logger"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestConsoleColorMode(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	defer func(mode string) { logger.ColorMode = mode }(logger.ColorMode)
+
+	file, err := ioutil.TempFile("", "gollum-console")
+	expect.NoError(err)
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	logger.ColorMode = "auto"
+	expect.False(logger.UseColors(file))
+
+	logger.ColorMode = "never"
+	expect.False(logger.UseColors(file))
+
+	config := core.NewPluginConfig("", "producer.Console")
+	config.Override("Colorize", true)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*Console)
+	expect.True(casted)
+
+	expect.False(prod.colorize)
+
+	logger.ColorMode = "always"
+	expect.True(logger.UseColors(file))
+
+	config = core.NewPluginConfig("", "producer.Console")
+	config.Override("Colorize", true)
+
+	plugin, err = core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted = plugin.(*Console)
+	expect.True(casted)
+
+	expect.True(prod.colorize)
+}
+
+func TestConsoleLevel(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "producer.Console")
+	config.Override("LevelFrom", "log/level")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*Console)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("error in payload"), tcontainer.MarshalMap{
+		"log": tcontainer.MarshalMap{"level": "WARN"},
+	}, core.InvalidStreamID)
+	expect.Equal("warn", prod.getLevel(msg))
+
+	msg = core.NewMessage(nil, []byte("2018-01-01 ERROR something failed"), nil, core.InvalidStreamID)
+	expect.Equal("error", prod.getLevel(msg))
+
+	msg = core.NewMessage(nil, []byte("no level here"), nil, core.InvalidStreamID)
+	expect.Equal("", prod.getLevel(msg))
+
+	expect.Equal(consoleColorRed, getConsoleColor("fatal"))
+	expect.Equal(consoleColorYellow, getConsoleColor("warning"))
+	expect.Equal(consoleColorBlue, getConsoleColor("info"))
+	expect.Equal(consoleColorGray, getConsoleColor("debug"))
+	expect.Equal("", getConsoleColor("unknown"))
+}
+
+func TestConsoleFormat(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	defer func(mode string) { logger.ColorMode = mode }(logger.ColorMode)
+
+	// Colors are not used for non-terminals by default
+	logger.ColorMode = "auto"
+
+	config := core.NewPluginConfig("", "producer.Console")
+	config.Override("Colorize", true)
+	config.Override("Template", "{{.Level}}: {{.Payload}}")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*Console)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("error occurred\n"), nil, core.InvalidStreamID)
+	line, err := prod.format(msg)
+	expect.NoError(err)
+	if !logger.UseColors(os.Stdout) {
+		expect.Equal("error: error occurred\n", string(line))
+	}
+
+	logger.ColorMode = "always"
+
+	config = core.NewPluginConfig("", "producer.Console")
+	config.Override("Colorize", true)
+
+	plugin, err = core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted = plugin.(*Console)
+	expect.True(casted)
+
+	line, err = prod.format(msg)
+	expect.NoError(err)
+	expect.Equal(consoleColorRed+"error occurred"+consoleColorReset+"\n", string(line))
+
+	msg = core.NewMessage(nil, []byte("plain"), nil, core.InvalidStreamID)
+	line, err = prod.format(msg)
+	expect.NoError(err)
+	expect.Equal("plain", string(line))
+}
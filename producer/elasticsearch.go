@@ -58,6 +58,20 @@ import (
 // - Password: This value used as the password for the elasticsearch server.
 // By default this parameter is set to "".
 //
+// - Bulk/MaxActions: Defines the maximum number of documents sent with a
+// single bulk request. Larger batches are split into multiple requests.
+// By default this parameter is set to "1000".
+//
+// - Bulk/MaxSizeBytes: Defines the maximum size of a single bulk request body
+// in bytes. Larger batches are split into multiple requests. A document that
+// exceeds this limit on its own is passed to the fallback. Keep this value
+// below the http.max_content_length setting of your cluster.
+// By default this parameter is set to "5242880" (5 MB).
+//
+// - Bulk/FlushIntervalMs: Defines the maximum time in milliseconds messages
+// are collected before they are sent. If set to 0, Batch/TimeoutSec is used.
+// By default this parameter is set to "0".
+//
 // - StreamProperties: This value defines the mapping and settings for each stream.
 // As index use the stream name here.
 //
@@ -94,6 +108,10 @@ import (
 //    Type: producer.ElasticSearch
 //    Streams: tweets_stream
 //    SetGzip: true
+//    Bulk:
+//      MaxActions: 500
+//      MaxSizeBytes: 10485760
+//      FlushIntervalMs: 1000
 //    Servers:
 //      - http://127.0.0.1:9200
 //    StreamProperties:
@@ -112,6 +130,17 @@ type ElasticSearch struct {
 	core.BatchedProducer `gollumdoc:"embed_type"`
 	connection           elasticConnection
 	indexMap             map[core.MessageStreamID]*indexMapItem
+	bulkMaxActions       int           `config:"Bulk/MaxActions" default:"1000"`
+	bulkMaxSize          int           `config:"Bulk/MaxSizeBytes" default:"5242880"`
+	bulkFlushInterval    time.Duration `config:"Bulk/FlushIntervalMs" default:"0" metric:"ms"`
+}
+
+// elasticBulkItem is a single bulk request action and the message it was
+// created from.
+type elasticBulkItem struct {
+	msg     *core.Message
+	request elastic.BulkableRequest
+	size    int
 }
 
 type indexMapItem struct {
@@ -188,6 +217,16 @@ func (prod *ElasticSearch) Configure(conf core.PluginConfigReader) {
 
 	prod.configureIndexSettings(conf.GetMap("StreamProperties", tcontainer.NewMarshalMap()), conf.Errors)
 	prod.configureRetrySettings(conf.GetInt("Retry/Count", 3), conf.GetInt("Retry/TimeToWaitSec", 3))
+
+	if prod.bulkMaxActions <= 0 {
+		conf.Errors.Pushf("Bulk/MaxActions must be greater than 0")
+	}
+	if prod.bulkMaxSize <= 0 {
+		conf.Errors.Pushf("Bulk/MaxSizeBytes must be greater than 0")
+	}
+	if prod.bulkFlushInterval > 0 {
+		prod.SetBatchTimeout(prod.bulkFlushInterval)
+	}
 }
 
 func (prod *ElasticSearch) configureRetrySettings(retry, timeToWaitSec int64) {
@@ -254,6 +293,22 @@ func (prod *ElasticSearch) getClient() *elastic.Client {
 	return prod.connection.client
 }
 
+// Dial checks if all configured servers respond to a ping
+func (prod *ElasticSearch) Dial() error {
+	conn := prod.connection
+	if err := conn.connect(); err != nil {
+		return err
+	}
+	defer conn.client.Stop()
+
+	for _, server := range conn.servers {
+		if _, _, err := conn.client.Ping(server).Do(context.Background()); err != nil {
+			return errors.Wrapf(err, "ping %s failed", server)
+		}
+	}
+	return nil
+}
+
 func (prod *ElasticSearch) indexExists(client *elastic.Client, indexName string) bool {
 	exists, err := client.IndexExists(indexName).Do(context.Background())
 	if err != nil {
@@ -303,6 +358,10 @@ func (prod *ElasticSearch) submitMessages(messages []*core.Message) {
 	client := prod.getClient()
 	if client == nil {
 		prod.Logger.Error("Failed to get client. Cannot send messages")
+		for _, msg := range messages {
+			prod.TryFallback(msg)
+		}
+		return // ### return, not connected ###
 	}
 
 	// Handle time based index creation
@@ -317,21 +376,85 @@ func (prod *ElasticSearch) submitMessages(messages []*core.Message) {
 		prod.createIndexIfRequired(indexName, settings)
 	}
 
-	// Send messages
-	bulkRequest := client.Bulk()
+	for _, bulk := range prod.splitBulks(messages) {
+		prod.submitBulk(client, bulk)
+	}
+}
+
+// newBulkItem creates the bulk request action for the given message. If no
+// index is configured for the message's stream, nil is returned.
+func (prod *ElasticSearch) newBulkItem(msg *core.Message) *elasticBulkItem {
+	indexMapItem, isSet := prod.indexMap[msg.GetStreamID()]
+	if !isSet {
+		prod.Logger.Warningf("No index setting for stream %s", msg.GetStreamID().GetName())
+		return nil
+	}
+
+	request := elastic.NewBulkIndexRequest().
+		Index(indexMapItem.GetIndexName(msg.GetCreationTime())).
+		Type(indexMapItem.typeName).
+		Doc(msg.String())
+
+	lines, err := request.Source()
+	if err != nil {
+		prod.Logger.WithError(err).Error("Failed to create bulk request")
+		prod.TryFallback(msg)
+		return nil
+	}
+
+	// Each line of the bulk body is terminated by a newline
+	size := 0
+	for _, line := range lines {
+		size += len(line) + 1
+	}
+
+	return &elasticBulkItem{
+		msg:     msg,
+		request: request,
+		size:    size,
+	}
+}
+
+// splitBulks converts the given messages into bulks that stay within the
+// limits set by Bulk/MaxActions and Bulk/MaxSizeBytes. Messages that exceed
+// Bulk/MaxSizeBytes on their own are passed to the fallback.
+func (prod *ElasticSearch) splitBulks(messages []*core.Message) [][]*elasticBulkItem {
+	bulks := [][]*elasticBulkItem{}
+	bulk := []*elasticBulkItem{}
+	bulkSize := 0
+
 	for _, msg := range messages {
-		indexMapItem, isSet := prod.indexMap[msg.GetStreamID()]
-		if !isSet {
-			prod.Logger.Warningf("No index setting for stream %s", msg.GetStreamID().GetName())
-			continue
+		item := prod.newBulkItem(msg)
+		if item == nil {
+			continue // ### continue, no valid request ###
+		}
+
+		if item.size > prod.bulkMaxSize {
+			prod.Logger.Warningf("Document of %d bytes exceeds Bulk/MaxSizeBytes of %d bytes", item.size, prod.bulkMaxSize)
+			prod.TryFallback(msg)
+			continue // ### continue, document too large ###
 		}
 
-		bulkIndexRequest := elastic.NewBulkIndexRequest()
-		bulkIndexRequest.Index(indexMapItem.GetIndexName(msg.GetCreationTime())).
-			Type(indexMapItem.typeName).
-			Doc(msg.String())
+		if len(bulk) == prod.bulkMaxActions || bulkSize+item.size > prod.bulkMaxSize {
+			bulks = append(bulks, bulk)
+			bulk = []*elasticBulkItem{}
+			bulkSize = 0
+		}
 
-		bulkRequest.Add(bulkIndexRequest)
+		bulk = append(bulk, item)
+		bulkSize += item.size
+	}
+
+	if len(bulk) > 0 {
+		bulks = append(bulks, bulk)
+	}
+	return bulks
+}
+
+func (prod *ElasticSearch) submitBulk(client *elastic.Client, bulk []*elasticBulkItem) {
+	bulkRequest := client.Bulk()
+	for _, item := range bulk {
+		bulkRequest.Add(item.request)
 	}
 
 	// NumberOfActions contains the number of requests in a bulk
@@ -0,0 +1,139 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"strings"
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func newElasticSearchTestMessages(t *testing.T, payloads ...string) []*core.Message {
+	messages := []*core.Message{}
+	for _, payload := range payloads {
+		messages = append(messages, core.NewMessage(nil, []byte(payload), nil, core.GetStreamID(t.Name())))
+	}
+	return messages
+}
+
+func getBulkPayloads(bulk []*elasticBulkItem) []string {
+	payloads := []string{}
+	for _, item := range bulk {
+		payloads = append(payloads, item.msg.String())
+	}
+	return payloads
+}
+
+func TestElasticSearchSplitBulksBySize(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	// Determine the size of a single bulk action for a 16 byte document
+	config := core.NewPluginConfig(t.Name(), "producer.ElasticSearch")
+	config.Override("StreamProperties", tcontainer.MarshalMap{
+		t.Name(): tcontainer.MarshalMap{
+			"Index": "gollum",
+			"Type":  "log",
+		},
+	})
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*ElasticSearch)
+	expect.True(casted)
+
+	item := prod.newBulkItem(newElasticSearchTestMessages(t, `{"doc":"0000000"}`)[0])
+	expect.NotNil(item)
+
+	prod.bulkMaxSize = 2*item.size + item.size/2
+
+	messages := newElasticSearchTestMessages(t,
+		`{"doc":"0000001"}`, `{"doc":"0000002"}`, `{"doc":"0000003"}`,
+		`{"doc":"0000004"}`, `{"doc":"0000005"}`)
+
+	bulks := prod.splitBulks(messages)
+	expect.Equal(3, len(bulks))
+	expect.Equal([]string{`{"doc":"0000001"}`, `{"doc":"0000002"}`}, getBulkPayloads(bulks[0]))
+	expect.Equal([]string{`{"doc":"0000003"}`, `{"doc":"0000004"}`}, getBulkPayloads(bulks[1]))
+	expect.Equal([]string{`{"doc":"0000005"}`}, getBulkPayloads(bulks[2]))
+}
+
+func TestElasticSearchSplitBulksByCount(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "producer.ElasticSearch")
+	config.Override("StreamProperties", tcontainer.MarshalMap{
+		t.Name(): tcontainer.MarshalMap{
+			"Index": "gollum",
+			"Type":  "log",
+		},
+	})
+	config.Override("Bulk/MaxActions", 2)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*ElasticSearch)
+	expect.True(casted)
+
+	bulks := prod.splitBulks(newElasticSearchTestMessages(t, `{}`, `{}`, `{}`))
+	expect.Equal(2, len(bulks))
+	expect.Equal(2, len(bulks[0]))
+	expect.Equal(1, len(bulks[1]))
+}
+
+func TestElasticSearchOversizedDocument(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	fallback := newMockRouter(t.Name() + "Fallback")
+
+	config := core.NewPluginConfig(t.Name(), "producer.ElasticSearch")
+	config.Override("StreamProperties", tcontainer.MarshalMap{
+		t.Name(): tcontainer.MarshalMap{
+			"Index": "gollum",
+			"Type":  "log",
+		},
+	})
+	config.Override("Bulk/MaxSizeBytes", 256)
+	config.Override("FallbackStream", t.Name()+"Fallback")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*ElasticSearch)
+	expect.True(casted)
+
+	oversized := `{"doc":"` + strings.Repeat("x", 256) + `"}`
+	bulks := prod.splitBulks(newElasticSearchTestMessages(t, `{"doc":"first"}`, oversized, `{"doc":"last"}`))
+
+	expect.Equal(1, len(bulks))
+	expect.Equal([]string{`{"doc":"first"}`, `{"doc":"last"}`}, getBulkPayloads(bulks[0]))
+	expect.Equal([]string{oversized}, fallback.receive(t, 1))
+}
+
+func TestElasticSearchBulkConfigErrors(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	for _, key := range []string{"Bulk/MaxActions", "Bulk/MaxSizeBytes"} {
+		config := core.NewPluginConfig(t.Name()+strings.Replace(key, "/", "", -1), "producer.ElasticSearch")
+		config.Override(key, 0)
+		_, err := core.NewPluginWithConfig(config)
+		expect.NotNil(err)
+	}
+}
@@ -66,15 +66,30 @@ import (
 //      FlushCount: 64
 //      TimeoutSec: 60
 //      FlushTimeoutSec: 3
+//
+// This example writes each message together with its "host" and "level"
+// metadata fields as one JSON object per line:
+//
+//  fileOut:
+//    Type: producer.File
+//    Streams: "*"
+//    File: /tmp/gollum.log
+//    Envelope:
+//      Format: json
+//      Fields:
+//        - host
+//        - level
 type File struct {
 	core.DirectProducer `gollumdoc:"embed_type"`
 
 	// Rotate is public to make Pruner.Configure() callable (bug in treflect package)
 	// Prune is public to make FileRotateConfig.Configure() callable (bug in treflect package)
 	// BatchConfig is public to make BatchedWriterConfig.Configure() callable (bug in treflect package)
+	// Envelope is public to make EnvelopeConfig.Configure() callable (bug in treflect package)
 	Rotate      components.RotateConfig        `gollumdoc:"embed_type"`
 	Pruner      file.Pruner                    `gollumdoc:"embed_type"`
 	BatchConfig components.BatchedWriterConfig `gollumdoc:"embed_type"`
+	Envelope    components.EnvelopeConfig      `gollumdoc:"embed_type"`
 
 	batchedFileGuard  *sync.RWMutex
 	filesByStream     map[core.MessageStreamID]*components.BatchedWriterAssembly // mapped files by stream
@@ -152,6 +167,9 @@ func (prod *File) getBatchedFile(streamID core.MessageStreamID) (*components.Bat
 			prod.TryFallback,
 			prod.Logger,
 		)
+		if prod.Envelope.IsEnabled() {
+			batchedFile.SetEncoder(prod.Envelope.Encode)
+		}
 
 		prod.files[streamTargetFile.GetOriginalPath()] = batchedFile
 		prod.filesByStream[streamID] = batchedFile
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sync/atomic"
 
 	"github.com/sirupsen/logrus"
 	"github.com/trivago/tgo/tio"
@@ -30,22 +31,30 @@ type BatchedFileWriter struct {
 	file            *os.File
 	compressOnClose bool
 	stats           os.FileInfo
+	size            *int64
 	logger          logrus.FieldLogger
 }
 
 // NewBatchedFileWriter returns a BatchedFileWriter instance
 func NewBatchedFileWriter(file *os.File, compressOnClose bool, logger logrus.FieldLogger) BatchedFileWriter {
-	return BatchedFileWriter{
-		file,
-		compressOnClose,
-		nil,
-		logger,
+	writer := BatchedFileWriter{
+		file:            file,
+		compressOnClose: compressOnClose,
+		size:            new(int64),
+		logger:          logger,
 	}
+
+	if stats, err := writer.getStats(); err == nil {
+		*writer.size = stats.Size()
+	}
+	return writer
 }
 
 // Write is part of the BatchedWriter interface and wraps the file.Write() implementation
 func (w *BatchedFileWriter) Write(p []byte) (n int, err error) {
-	return w.file.Write(p)
+	n, err = w.file.Write(p)
+	atomic.AddInt64(w.size, int64(n))
+	return n, err
 }
 
 // Name is part of the BatchedWriter interface and wraps the file.Name() implementation
@@ -53,13 +62,11 @@ func (w *BatchedFileWriter) Name() string {
 	return w.file.Name()
 }
 
-// Size is part of the BatchedWriter interface and wraps the file.Stat().Size() implementation
+// Size is part of the BatchedWriter interface and returns the size of the
+// file including all data written by this writer. The file stats are cached
+// so the size is tracked on write instead.
 func (w *BatchedFileWriter) Size() int64 {
-	stats, err := w.getStats()
-	if err != nil {
-		return 0
-	}
-	return stats.Size()
+	return atomic.LoadInt64(w.size)
 }
 
 // IsAccessible is part of the BatchedWriter interface and check if the writer can access his file
@@ -0,0 +1,256 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"gollum/core"
+	"gollum/core/components"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func getTestFile(t *testing.T, prod *File) *components.BatchedWriterAssembly {
+	expect := ttesting.NewExpect(t)
+
+	batchedFile, err := prod.getBatchedFile(core.GetStreamID(t.Name()))
+	expect.NoError(err)
+	expect.True(batchedFile.HasWriter())
+	return batchedFile
+}
+
+func closeTestFiles(prod *File) {
+	for _, batchedFile := range prod.files {
+		if batchedFile.HasWriter() {
+			batchedFile.GetWriter().Close()
+		}
+	}
+}
+
+// listLogFiles returns the sorted names of all regular files in dir.
+func listLogFiles(t *testing.T, dir string) []string {
+	expect := ttesting.NewExpect(t)
+
+	files, err := ioutil.ReadDir(dir)
+	expect.NoError(err)
+
+	names := []string{}
+	for _, file := range files {
+		if file.Mode().IsRegular() {
+			names = append(names, file.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// waitForLogFiles waits until dir contains exactly the expected files.
+func waitForLogFiles(t *testing.T, dir string, expected ...string) {
+	expect := ttesting.NewExpect(t)
+	sort.Strings(expected)
+
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(10 * time.Millisecond) {
+		if names := listLogFiles(t, dir); strings.Join(names, ",") == strings.Join(expected, ",") {
+			break
+		}
+	}
+	expect.Equal(expected, listLogFiles(t, dir))
+}
+
+func TestFileRotateBySize(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-file")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	config := core.NewPluginConfig(t.Name(), "producer.File")
+	config.Override("File", filepath.Join(dir, "gollum.log"))
+	config.Override("Rotation/Enable", true)
+	config.Override("Rotation/Timestamp", "2006")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*File)
+	expect.True(casted)
+
+	prod.Rotate.SizeByte = 10
+	defer closeTestFiles(prod)
+
+	year := time.Now().Format("2006")
+	batchedFile := getTestFile(t, prod)
+	firstName := batchedFile.GetWriter().Name()
+	expect.Equal(filepath.Join(dir, "gollum_"+year+".log"), firstName)
+
+	// Below the limit the file is kept
+	_, err = batchedFile.GetWriter().Write([]byte("123456789"))
+	expect.NoError(err)
+	expect.Equal(firstName, getTestFile(t, prod).GetWriter().Name())
+
+	// Reaching the limit triggers a rotation
+	_, err = batchedFile.GetWriter().Write([]byte("0"))
+	expect.NoError(err)
+	secondName := getTestFile(t, prod).GetWriter().Name()
+	expect.Equal(filepath.Join(dir, "gollum_"+year+"_1.log"), secondName)
+
+	content, err := ioutil.ReadFile(firstName)
+	expect.NoError(err)
+	expect.Equal("1234567890", string(content))
+}
+
+func TestFileRotateByTime(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-file")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	config := core.NewPluginConfig(t.Name(), "producer.File")
+	config.Override("File", filepath.Join(dir, "gollum.log"))
+	config.Override("Rotation/Enable", true)
+	config.Override("Rotation/Timestamp", "2006")
+	config.Override("Rotation/TimeoutMin", "100ms")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*File)
+	expect.True(casted)
+
+	defer closeTestFiles(prod)
+
+	firstName := getTestFile(t, prod).GetWriter().Name()
+	expect.Equal(firstName, getTestFile(t, prod).GetWriter().Name())
+
+	time.Sleep(150 * time.Millisecond)
+	expect.Neq(firstName, getTestFile(t, prod).GetWriter().Name())
+}
+
+func TestFileRotateCompress(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-file")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	config := core.NewPluginConfig(t.Name(), "producer.File")
+	config.Override("File", filepath.Join(dir, "gollum.log"))
+	config.Override("Rotation/Enable", true)
+	config.Override("Rotation/Timestamp", "2006")
+	config.Override("Rotation/Compress", true)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*File)
+	expect.True(casted)
+
+	prod.Rotate.SizeByte = 1
+	defer closeTestFiles(prod)
+
+	year := time.Now().Format("2006")
+	batchedFile := getTestFile(t, prod)
+	_, err = batchedFile.GetWriter().Write([]byte("data"))
+	expect.NoError(err)
+	getTestFile(t, prod)
+
+	// The rotated file is replaced by its compressed version
+	waitForLogFiles(t, dir, "gollum_"+year+".gz", "gollum_"+year+"_1.log")
+}
+
+func TestFileRotatePruneCount(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-file")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	config := core.NewPluginConfig(t.Name(), "producer.File")
+	config.Override("File", filepath.Join(dir, "gollum.log"))
+	config.Override("Rotation/Enable", true)
+	config.Override("Rotation/Timestamp", "2006")
+	config.Override("Prune/Count", 2)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*File)
+	expect.True(casted)
+
+	prod.Rotate.SizeByte = 1
+	defer closeTestFiles(prod)
+
+	year := time.Now().Format("2006")
+	for i := 0; i < 4; i++ {
+		batchedFile := getTestFile(t, prod)
+		_, err = batchedFile.GetWriter().Write([]byte("data"))
+		expect.NoError(err)
+
+		// Files are pruned by modification time
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// Only the newest files are kept, including the active one
+	waitForLogFiles(t, dir, "gollum_"+year+"_2.log", "gollum_"+year+"_3.log")
+}
+
+func TestFileEnvelope(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-file")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	fallback := newMockRouter(t.Name() + "Fallback")
+	config := core.NewPluginConfig(t.Name(), "producer.File")
+	config.Override("File", filepath.Join(dir, "gollum.log"))
+	config.Override("FallbackStream", t.Name()+"Fallback")
+	config.Override("Envelope/Format", "msgpack")
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*File)
+	expect.True(casted)
+	defer closeTestFiles(prod)
+
+	streamID := core.GetStreamID(t.Name())
+	valid := core.NewMessage(nil, []byte("valid"), tcontainer.MarshalMap{"host": "web01"}, streamID)
+	invalid := core.NewMessage(nil, []byte("invalid"), tcontainer.MarshalMap{"host": make(chan int)}, streamID)
+	prod.writeMessage(valid)
+	prod.writeMessage(invalid)
+
+	batchedFile := getTestFile(t, prod)
+	batchedFile.Flush()
+	batchedFile.Batch.WaitForFlush(time.Second)
+
+	// Messages that cannot be encoded are passed on without envelope
+	expect.Equal([]string{"invalid"}, fallback.receive(t, 1))
+
+	record, err := prod.Envelope.Encode(valid)
+	expect.NoError(err)
+	content, err := ioutil.ReadFile(batchedFile.GetWriter().Name())
+	expect.NoError(err)
+	expect.Equal(record, content)
+	expect.Equal("valid", valid.String())
+}
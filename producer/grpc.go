@@ -0,0 +1,254 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"gollum/consumer/grpcpb"
+	"gollum/core"
+
+	"github.com/trivago/tgo/tmath"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// GRPC producer plugin
+//
+// This producer sends messages to a server implementing the "gollum.Ingest"
+// service defined in consumer/grpcpb/record.proto, e.g. a remote gollum
+// running consumer.GRPC. Messages are collected in batches and each batch is
+// sent as one Push stream. A batch is considered delivered once the server
+// confirmed the number of records sent. If a batch fails, all of its messages
+// are sent to the fallback and the connection is reestablished with the next
+// batch.
+//
+// Parameters
+//
+// - Address: Defines the address of the gRPC server to connect to.
+// By default this parameter is set to "localhost:5880".
+//
+// - KeyFrom: Defines the metadata field that is forwarded as record field
+// of the same name. Nested fields can be addressed by a path like "user/id".
+// When set to an empty string no field is forwarded.
+// By default this parameter is set to "".
+//
+// - TimeoutMs: Defines the maximum time in milliseconds to wait for a batch to
+// be sent, including the time required to connect.
+// By default this parameter is set to "10000".
+//
+// - Batch/MaxCount: Defines the maximum number of messages that can be buffered
+// before a flush is mandatory. If the buffer is full and a flush is still
+// underway or cannot be triggered out of other reasons, the producer will block.
+// By default this parameter is set to "8192".
+//
+// - Batch/FlushCount: Defines the number of messages to be buffered before
+// they are sent. This setting is clamped to Batch/MaxCount.
+// By default this parameter is set to "4096".
+//
+// - Batch/TimeoutSec: Defines the maximum number of seconds to wait after the
+// last message arrived before a batch is flushed automatically.
+// By default this parameter is set to "5".
+//
+// - TlsEnable: Enables TLS communication with the server.
+// By default this parameter is set to false.
+//
+// - TlsCaLocation: Path to the CA certificate(s) used for verifying the
+// server's key. If not set, the system's root certificates are used.
+// By default this parameter is set to "".
+//
+// - TlsServerName: Used to verify the hostname on the server's certificate
+// unless TlsInsecureSkipVerify is true.
+// By default this parameter is set to "".
+//
+// - TlsInsecureSkipVerify: Disables server certificate chain and host name
+// verification.
+// By default this parameter is set to false.
+//
+// Examples
+//
+// This example forwards all messages to another gollum instance and passes
+// the metadata field "key" along with each message.
+//
+//  GrpcOut:
+//    Type: producer.GRPC
+//    Streams: "*"
+//    Address: "gollum.example.com:5880"
+//    KeyFrom: key
+//    Batch:
+//      MaxCount: 1024
+//      FlushCount: 512
+//      TimeoutSec: 1
+type GRPC struct {
+	core.BufferedProducer `gollumdoc:"embed_type"`
+	address               string        `config:"Address" default:"localhost:5880"`
+	keyField              string        `config:"KeyFrom"`
+	timeout               time.Duration `config:"TimeoutMs" default:"10000" metric:"ms"`
+	batchTimeout          time.Duration `config:"Batch/TimeoutSec" default:"5" metric:"sec"`
+	batchMaxCount         int           `config:"Batch/MaxCount" default:"8192"`
+	batchFlushCount       int           `config:"Batch/FlushCount" default:"4096"`
+	batch                 core.MessageBatch
+	dialOptions           []grpc.DialOption
+	connection            *grpc.ClientConn
+	client                grpcpb.IngestClient
+}
+
+func init() {
+	core.TypeRegistry.Register(GRPC{})
+}
+
+// Configure initializes this producer with values from a plugin config.
+func (prod *GRPC) Configure(conf core.PluginConfigReader) {
+	prod.SetStopCallback(prod.close)
+	prod.batchFlushCount = tmath.MinI(prod.batchFlushCount, prod.batchMaxCount)
+	prod.batch = core.NewMessageBatch(prod.batchMaxCount)
+
+	if !conf.GetBool("TlsEnable", false) {
+		prod.dialOptions = []grpc.DialOption{grpc.WithInsecure()}
+		return // ### return, no TLS ###
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         conf.GetString("TlsServerName", ""),
+		InsecureSkipVerify: conf.GetBool("TlsInsecureSkipVerify", false),
+	}
+
+	if caFile := conf.GetString("TlsCaLocation", ""); caFile != "" {
+		caCert, err := ioutil.ReadFile(caFile)
+		if conf.Errors.Push(err) {
+			return
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		tlsConfig.RootCAs.AppendCertsFromPEM(caCert)
+	}
+
+	prod.dialOptions = []grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig))}
+}
+
+func (prod *GRPC) tryConnect() bool {
+	if prod.connection != nil {
+		return true // ### return, connection active ###
+	}
+
+	conn, err := grpc.Dial(prod.address, prod.dialOptions...)
+	if err != nil {
+		prod.Logger.Error("Connection error: ", err)
+		return false // ### return, connection failed ###
+	}
+
+	prod.connection = conn
+	prod.client = grpcpb.NewIngestClient(conn)
+	return true
+}
+
+func (prod *GRPC) closeConnection() error {
+	if prod.connection != nil {
+		prod.connection.Close()
+		prod.connection = nil
+		prod.client = nil
+	}
+	return nil
+}
+
+func (prod *GRPC) newRecord(msg *core.Message) *grpcpb.Record {
+	record := &grpcpb.Record{
+		Data: msg.GetPayload(),
+	}
+
+	if len(prod.keyField) > 0 {
+		if key, exists := core.GetValuePath(msg.TryGetMetadata(), prod.keyField); exists {
+			record.Fields = map[string]string{
+				prod.keyField: string(core.ConvertToBytes(key)),
+			}
+		}
+	}
+	return record
+}
+
+func (prod *GRPC) push(messages []*core.Message) error {
+	if !prod.tryConnect() {
+		return fmt.Errorf("not connected to %s", prod.address)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), prod.timeout)
+	defer cancel()
+
+	stream, err := prod.client.Push(ctx, grpc.WaitForReady(true))
+	if err != nil {
+		return err
+	}
+
+	for _, msg := range messages {
+		if err := stream.Send(prod.newRecord(msg)); err != nil {
+			return err
+		}
+	}
+
+	response, err := stream.CloseAndRecv()
+	if err != nil {
+		return err
+	}
+
+	if response.GetCount() != uint64(len(messages)) {
+		return fmt.Errorf("server received %d of %d messages", response.GetCount(), len(messages))
+	}
+	return nil
+}
+
+func (prod *GRPC) sendBatch(messages []*core.Message) {
+	if err := prod.push(messages); err != nil {
+		prod.Logger.WithError(err).Error("Failed to send batch")
+		prod.closeConnection()
+		for _, msg := range messages {
+			prod.TryFallback(msg)
+		}
+	}
+}
+
+func (prod *GRPC) sendMessage(msg *core.Message) {
+	prod.batch.AppendOrFlush(msg, prod.flushBatch, prod.IsActiveOrStopping, prod.TryFallback)
+}
+
+func (prod *GRPC) flushBatch() {
+	prod.batch.Flush(prod.sendBatch)
+}
+
+func (prod *GRPC) flushBatchOnTimeOut() {
+	if prod.batch.ReachedTimeThreshold(prod.batchTimeout) || prod.batch.ReachedSizeThreshold(prod.batchFlushCount) {
+		prod.flushBatch()
+	}
+}
+
+func (prod *GRPC) close() {
+	defer func() {
+		prod.batch.AfterFlushDo(prod.closeConnection)
+		prod.WorkerDone()
+	}()
+
+	prod.DefaultClose()
+	prod.batch.Close(prod.sendBatch, prod.GetShutdownTimeout())
+}
+
+// Produce writes to a buffer that is sent to the configured gRPC server.
+func (prod *GRPC) Produce(workers *sync.WaitGroup) {
+	prod.AddMainWorker(workers)
+	prod.TickerMessageControlLoop(prod.sendMessage, prod.batchTimeout, prod.flushBatchOnTimeOut)
+}
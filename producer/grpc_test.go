@@ -0,0 +1,133 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"gollum/consumer"
+	"gollum/consumer/grpcpb"
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// startGRPCConsumer serves a consumer.GRPC via an in-process transport and
+// returns a dial option to connect to it.
+func startGRPCConsumer(t *testing.T, stream string) (*grpc.Server, grpc.DialOption) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name()+"Consumer", "consumer.GRPC")
+	config.Override("Streams", stream)
+	config.Override("SetMetadata", true)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	cons, casted := plugin.(*consumer.GRPC)
+	expect.True(casted)
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	grpcpb.RegisterIngestServer(server, cons)
+	go server.Serve(listener)
+
+	dialer := func(ctx context.Context, address string) (net.Conn, error) {
+		return listener.Dial()
+	}
+	return server, grpc.WithContextDialer(dialer)
+}
+
+func TestGRPCRoundTrip(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	received := newMockRouter(t.Name() + "Received")
+	server, dialer := startGRPCConsumer(t, t.Name()+"Received")
+	defer server.Stop()
+
+	config := core.NewPluginConfig(t.Name(), "producer.GRPC")
+	config.Override("KeyFrom", "key")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*GRPC)
+	expect.True(casted)
+
+	prod.dialOptions = append(prod.dialOptions, dialer)
+	defer prod.closeConnection()
+
+	messages := []*core.Message{
+		core.NewMessage(nil, []byte("first"), tcontainer.MarshalMap{"key": "a"}, core.InvalidStreamID),
+		core.NewMessage(nil, []byte("second"), nil, core.InvalidStreamID),
+	}
+	expect.NoError(prod.push(messages))
+
+	payloads := []string{}
+	for range messages {
+		select {
+		case msg := <-received.messages:
+			payloads = append(payloads, msg.String())
+			if msg.String() == "first" {
+				expect.MapEqual(msg.GetMetadata(), "key", "a")
+			} else {
+				expect.Equal(0, len(msg.GetMetadata()))
+			}
+		case <-time.After(time.Second):
+			t.Fatal("message was not received")
+		}
+	}
+	expect.Equal([]string{"first", "second"}, payloads)
+
+	// The connection is reused for the next batch
+	connection := prod.connection
+	expect.NoError(prod.push(messages[:1]))
+	expect.Equal(connection, prod.connection)
+	expect.Equal([]string{"first"}, received.receive(t, 1))
+}
+
+func TestGRPCFallbackOnError(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	fallback := newMockRouter(t.Name() + "Fallback")
+	server, dialer := startGRPCConsumer(t, t.Name()+"Received")
+	server.Stop()
+
+	config := core.NewPluginConfig(t.Name(), "producer.GRPC")
+	config.Override("FallbackStream", t.Name()+"Fallback")
+	config.Override("TimeoutMs", 100)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*GRPC)
+	expect.True(casted)
+
+	prod.dialOptions = append(prod.dialOptions, dialer)
+
+	prod.sendBatch([]*core.Message{
+		core.NewMessage(nil, []byte("first"), nil, core.InvalidStreamID),
+		core.NewMessage(nil, []byte("second"), nil, core.InvalidStreamID),
+	})
+
+	expect.Equal([]string{"first", "second"}, fallback.receive(t, 2))
+	expect.Nil(prod.connection)
+}
@@ -91,6 +91,7 @@ func init() {
 func (prod *HTTPRequest) Configure(conf core.PluginConfigReader) {
 	var err error
 	prod.SetStopCallback(prod.close)
+	prod.EnableManualAck()
 
 	address := conf.GetString("Address", "http://localhost:80")
 
@@ -183,11 +184,13 @@ func (prod *HTTPRequest) sendReq(msg *core.Message) {
 	if err != nil {
 		prod.Logger.Error("Invalid request: ", err)
 		prod.TryFallback(msg)
+		prod.AckMessage(msg)
 		prod.lastError = err
 		return // ### return, malformed request ###
 	}
 
 	go func() {
+		defer prod.AckMessage(msg)
 		_, _, err := httpRequestWrapper(http.DefaultClient.Do(req))
 		prod.lastError = err
 		if err != nil {
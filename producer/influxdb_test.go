@@ -0,0 +1,179 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+type influxDB2Stub struct {
+	guard    sync.Mutex
+	requests []*http.Request
+	bodies   []string
+	status   int
+}
+
+func (stub *influxDB2Stub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	stub.guard.Lock()
+	defer stub.guard.Unlock()
+
+	if r.URL.Path == "/ping" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	stub.requests = append(stub.requests, r)
+	stub.bodies = append(stub.bodies, string(body))
+	w.WriteHeader(stub.status)
+}
+
+func TestInfluxDBFormatLine(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "producer.InfluxDB")
+	config.Override("LineFromMetadata", true)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*InfluxDB)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, nil, tcontainer.MarshalMap{
+		"measurement": "http requests",
+		"tags":        tcontainer.MarshalMap{"host": "web 01", "region": "eu,west", "empty": ""},
+		"fields": tcontainer.MarshalMap{
+			"status":   json.Number("200"),
+			"duration": 0.25,
+			"count":    int64(3),
+			"cached":   true,
+			"path":     `/say "hi"`,
+		},
+		"time": "1500000000000",
+	}, core.InvalidStreamID)
+
+	line, err := prod.formatLine(msg)
+	expect.NoError(err)
+	expect.Equal(`http\ requests,host=web\ 01,region=eu\,west cached=true,count=3i,duration=0.25,path="/say \"hi\"",status=200i 1500000000000`+"\n", string(line))
+
+	// The creation time is used if no time is set
+	msg = core.NewMessage(nil, nil, tcontainer.MarshalMap{
+		"measurement": "cpu",
+		"fields":      tcontainer.MarshalMap{"load": json.Number("1.5")},
+	}, core.InvalidStreamID)
+	line, err = prod.formatLine(msg)
+	expect.NoError(err)
+	expect.Equal(fmt.Sprintf("cpu load=1.5 %d\n", msg.GetCreationTime().UnixNano()/1000000), string(line))
+}
+
+func TestInfluxDBFormatLineErrors(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "producer.InfluxDB")
+	config.Override("LineFromMetadata", true)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*InfluxDB)
+	expect.True(casted)
+
+	for _, metadata := range []tcontainer.MarshalMap{
+		nil,
+		{"fields": tcontainer.MarshalMap{"a": 1}},
+		{"measurement": "cpu"},
+		{"measurement": "cpu", "fields": "a=1"},
+		{"measurement": "cpu", "fields": tcontainer.MarshalMap{"a": []int{1}}},
+		{"measurement": "cpu", "fields": tcontainer.MarshalMap{"a": 1}, "time": "yesterday"},
+	} {
+		msg := core.NewMessage(nil, nil, metadata, core.InvalidStreamID)
+		_, err := prod.formatLine(msg)
+		expect.NotNil(err)
+	}
+}
+
+func TestInfluxDB2Write(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	stub := &influxDB2Stub{status: http.StatusNoContent}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	fallback := newMockRouter(t.Name() + "Fallback")
+
+	config := core.NewPluginConfig(t.Name(), "producer.InfluxDB")
+	config.Override("Version", 200)
+	config.Override("Host", server.URL)
+	config.Override("Org", "trivago")
+	config.Override("Bucket", "metrics")
+	config.Override("Token", "secret")
+	config.Override("LineFromMetadata", true)
+	config.Override("FallbackStream", t.Name()+"Fallback")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*InfluxDB)
+	expect.True(casted)
+
+	messages := []*core.Message{
+		core.NewMessage(nil, []byte("first"), tcontainer.MarshalMap{
+			"measurement": "cpu",
+			"fields":      tcontainer.MarshalMap{"load": 1},
+			"time":        int64(1000),
+		}, core.InvalidStreamID),
+		core.NewMessage(nil, []byte("invalid"), nil, core.InvalidStreamID),
+		core.NewMessage(nil, []byte("second"), tcontainer.MarshalMap{
+			"measurement": "cpu",
+			"fields":      tcontainer.MarshalMap{"load": 2},
+			"time":        int64(2000),
+		}, core.InvalidStreamID),
+	}
+
+	for _, msg := range messages {
+		msg.FreezeOriginal()
+	}
+
+	assemble := prod.sendBatch()
+	expect.NotNil(assemble)
+	assemble(messages)
+
+	expect.Equal([]string{"invalid"}, fallback.receive(t, 1))
+	expect.Equal([]string{"cpu load=1i 1000\ncpu load=2i 2000\n"}, stub.bodies)
+
+	req := stub.requests[0]
+	expect.Equal("/api/v2/write", req.URL.Path)
+	expect.Equal("trivago", req.URL.Query().Get("org"))
+	expect.Equal("metrics", req.URL.Query().Get("bucket"))
+	expect.Equal("ms", req.URL.Query().Get("precision"))
+	expect.Equal("Token secret", req.Header.Get("Authorization"))
+
+	// Non-2xx responses send the original messages to the fallback
+	stub.status = http.StatusBadRequest
+	prod.sendBatch()(messages[:1])
+	expect.Equal([]string{"first"}, fallback.receive(t, 1))
+}
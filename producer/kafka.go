@@ -16,17 +16,20 @@ package producer
 
 import (
 	"crypto/tls"
-	"crypto/x509"
-	"io/ioutil"
+	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"gollum/core"
+	"gollum/core/components"
 
 	kafka "github.com/Shopify/sarama"
 	metrics "github.com/rcrowley/go-metrics"
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/thealthcheck"
 )
 
 const (
@@ -36,6 +39,11 @@ const (
 	compressNone   = "none"
 	compressGZIP   = "zip"
 	compressSnappy = "snappy"
+
+	// Upper bounds of the size sarama adds to each record and each record
+	// header when checking the maximum message size.
+	kafkaRecordOverhead = 36
+	kafkaHeaderOverhead = 10
 )
 
 // Kafka producer
@@ -43,6 +51,9 @@ const (
 // This producer writes messages to a kafka cluster. This producer is backed by
 // the sarama library (https://github.com/Shopify/sarama) so most settings
 // directly relate to the settings of that library.
+// When shutting down, the producer waits up to ShutdownTimeoutMs for all
+// messages passed to sarama to be acknowledged. Messages not acknowledged in
+// time are sent to the fallback.
 //
 // Parameters
 //
@@ -51,7 +62,7 @@ const (
 // By default this parameter is set to an empty list.
 //
 // - Version: Defines the kafka protocol version to use. Common values are 0.8.2,
-// 0.9.0 or 0.10.0. Values of the form "A.B" are allowed as well as "A.B.C"
+// 0.9.0, 0.10.0 or 0.11.0. Values of the form "A.B" are allowed as well as "A.B.C"
 // and "A.B.C.D". If the version given is not known, the closest possible
 // version is chosen. If GroupId is set to a value < "0.9", "0.9.0.1" will be used.
 // By default this parameter is set to "0.8.2".
@@ -72,8 +83,23 @@ const (
 // - PartitionHasher: Defines the hash algorithm to use when Partitioner is set
 // to "Hash". Accepted values are "fnv1-a" and "murmur2".
 //
+// - PartitionFrom: Defines the metadata field that contains the partition a
+// message should be written to. Nested fields can be addressed by a path like
+// "kafka/partition". If the field is missing, not numeric or out of range for
+// the topic, the configured Partitioner is used. When set to an empty string,
+// the Partitioner is used for all messages.
+// By default this parameter is set to "".
+//
 // - KeyFrom: Defines the metadata field that contains the string to be used as
-// the key passed to kafka. When set to an empty string no key is used.
+// the key passed to kafka. Nested fields can be addressed by a path like
+// "user/id". When set to an empty string no key is used.
+// By default this parameter is set to "".
+//
+// - HeadersFrom: Defines a metadata field containing a map. Each key/value
+// pair of this map is sent as record header, e.g. to propagate trace
+// context. Nested fields can be addressed by a path like "kafka/headers".
+// Record headers require Version to be at least 0.11. When set to an empty
+// string no headers are sent.
 // By default this parameter is set to "".
 //
 // - Compression: Defines the compression algorithm to use.
@@ -85,6 +111,16 @@ const (
 // message.
 // By default this parameter is set to 1.
 //
+// - Idempotent: When set to true, sarama's idempotent producer is used. The
+// broker then discards duplicates caused by retries of the producer, so each
+// message is written once per partition, in order. This requires Version to
+// be at least 0.11, RequiredAcks to be -1, MaxOpenRequests to be 1 and
+// SendRetries to be at least 1. Parameters left at their default values are
+// adjusted accordingly, explicitly configured conflicting values are
+// reported as configuration errors. Messages sent again after a restart or
+// after being passed to the fallback are not deduplicated.
+// By default this parameter is set to false.
+//
 // - TimeoutMs: Denotes the maximum time the broker will wait for acks. This
 // setting becomes active when RequiredAcks is set to wait for multiple commits.
 // By default this parameter is set to 10000.
@@ -116,6 +152,31 @@ const (
 // will not be rejected.
 // By default this parameter is set to false.
 //
+// - RequireExistingTopic: When set to true, the producer checks if a topic
+// exists before writing the first message to it. Messages for topics that do
+// not exist are sent to the fallback and an error is logged once per topic.
+// The check is repeated every MetadataRefreshMs, so messages are written as
+// soon as the topic has been created. This prevents brokers with
+// auto.create.topics.enable set to true from creating topics with default
+// settings.
+// By default this parameter is set to false.
+//
+// - AutoCreateTopic: When set to true, topics that do not exist are created
+// with AutoCreatePartitions partitions and AutoCreateReplicationFactor
+// replicas before writing the first message to them. This implies
+// RequireExistingTopic and requires Version to be at least 0.10.1. If a
+// topic cannot be created, it is handled as described for
+// RequireExistingTopic.
+// By default this parameter is set to false.
+//
+// - AutoCreatePartitions: Defines the number of partitions of topics created
+// by AutoCreateTopic.
+// By default this parameter is set to 1.
+//
+// - AutoCreateReplicationFactor: Defines the number of replicas of topics
+// created by AutoCreateTopic.
+// By default this parameter is set to 1.
+//
 // - Batch/MinCount: Sets the minimum number of messages required to send a
 // request.
 // By default this parameter is set to 1.
@@ -132,6 +193,18 @@ const (
 // Messages bigger than this limit will be rejected.
 // By default this parameter is set to 1024.
 //
+// - TooLargeStream: Defines a stream to route messages to that have been
+// rejected for exceeding Batch/SizeMaxKB. The message is reset to its
+// original state before being routed. When set to "", rejected messages are
+// discarded.
+// By default this parameter is set to "".
+//
+// - TruncateOversize: When set to true, messages rejected for exceeding
+// Batch/SizeMaxKB are truncated to fit and sent again. Truncated messages
+// have the metadata field "truncated" set to true. If a truncated message
+// is rejected again, it is handled as described for TooLargeStream.
+// By default this parameter is set to false.
+//
 // - Batch/TimeoutMs: Defines the maximum time in milliseconds after which a
 // new request will be sent, ignoring of Batch/MinCount and Batch/MinSizeByte
 // By default this parameter is set to 3.
@@ -152,15 +225,28 @@ const (
 // By default this parameter is set to false.
 //
 // - TlsKeyLocation: Path to the client's private key (PEM) used for TLS based
-// authentication.
+// authentication. Cannot be used together with TlsKeyPem.
+// By default this parameter is set to "".
+//
+// - TlsKeyPem: The client's PEM encoded private key used for TLS based
+// authentication. Can be used instead of TlsKeyLocation, e.g. when the key
+// is passed via an environment variable.
 // By default this parameter is set to "".
 //
 // - TlsCertificateLocation: Path to the client's public key (PEM) used for TLS
-// based authentication.
+// based authentication. Cannot be used together with TlsCertificatePem.
+// By default this parameter is set to "".
+//
+// - TlsCertificatePem: The client's PEM encoded public key used for TLS based
+// authentication. Can be used instead of TlsCertificateLocation.
 // By default this parameter is set to "".
 //
 // - TlsCaLocation: Path to the CA certificate(s) used for verifying the
-// broker's key.
+// broker's key. Cannot be used together with TlsCaPem.
+// By default this parameter is set to "".
+//
+// - TlsCaPem: The PEM encoded CA certificate(s) used for verifying the
+// broker's key. Can be used instead of TlsCaLocation.
 // By default this parameter is set to "".
 //
 // - TlsServerName: Used to verify the hostname on the server's certificate
@@ -189,6 +275,9 @@ const (
 //    Type: producer.Kafka
 //    Streams: logs
 //    Compression: zip
+//    Breaker:
+//      FailThreshold: 10
+//      CooldownMs: 5000
 //    Servers:
 //      - "kafka01:9092"
 //      - "kafka02:9092"
@@ -206,14 +295,33 @@ type Kafka struct {
 	client                kafka.Client
 	config                *kafka.Config
 	producer              kafka.AsyncProducer
-	nilValueAllowed       bool   `config:"AllowNilValue" default:"false"`
-	keyField              string `config:"KeyFrom"`
+	nilValueAllowed       bool        `config:"AllowNilValue" default:"false"`
+	keyField              string      `config:"KeyFrom"`
+	partitionField        string      `config:"PartitionFrom"`
+	headersField          string      `config:"HeadersFrom"`
+	tooLargeStream        core.Router `config:"TooLargeStream" default:""`
+	truncateOversize      bool        `config:"TruncateOversize" default:"false"`
+	idempotent            bool        `config:"Idempotent" default:"false"`
+	requireExistingTopic  bool        `config:"RequireExistingTopic" default:"false"`
+	autoCreateTopic       bool        `config:"AutoCreateTopic" default:"false"`
+	autoCreatePartitions  int         `config:"AutoCreatePartitions" default:"1"`
+	autoCreateReplicas    int         `config:"AutoCreateReplicationFactor" default:"1"`
+	topicExists           func(topic string) (bool, error)
+	createTopic           func(topic string) error
 	metricsRegistry       metrics.Registry
+	disconnected          map[string]string
+	inFlight              map[*core.Message]struct{}
+	inFlightGuard         *sync.Mutex
+
+	// Breaker is public to make CircuitBreaker.Configure() callable (bug in treflect package)
+	Breaker components.CircuitBreaker `gollumdoc:"embed_type"`
 }
 
 type topicHandle struct {
 	name             string
 	lastHeartBeat    time.Time
+	lastCheck        time.Time
+	exists           bool
 	metricsRoundtrip metrics.Timer
 	metricsDelivered metrics.Counter
 	metricsSent      metrics.Counter
@@ -227,6 +335,7 @@ func init() {
 // Configure initializes this producer with values from a plugin config.
 func (prod *Kafka) Configure(conf core.PluginConfigReader) {
 	prod.SetStopCallback(prod.close)
+	prod.EnableManualAck()
 
 	kafka.Logger = prod.Logger.WithField("Scope", "Sarama")
 
@@ -234,7 +343,11 @@ func (prod *Kafka) Configure(conf core.PluginConfigReader) {
 	prod.streamToTopic = conf.GetStreamMap("Topics", "")
 	prod.topic = make(map[core.MessageStreamID]*topicHandle)
 	prod.topicHandles = make(map[string]*topicHandle)
+	prod.disconnected = make(map[string]string)
+	prod.inFlight = make(map[*core.Message]struct{})
+	prod.inFlightGuard = new(sync.Mutex)
 	prod.metricsRegistry = core.NewMetricsRegistryForPlugin(prod)
+	prod.Breaker.RegisterMetrics(prod.metricsRegistry)
 
 	prod.config = kafka.NewConfig()
 	prod.config.ClientID = prod.clientID
@@ -253,24 +366,43 @@ func (prod *Kafka) Configure(conf core.PluginConfigReader) {
 		prod.config.Version = kafka.V0_9_0_1
 	case "0.10", "0.10.0", "0.10.0.0":
 		prod.config.Version = kafka.V0_10_0_0
+	case "0.10.0.1":
+		prod.config.Version = kafka.V0_10_0_1
+	case "0.10.1", "0.10.1.0":
+		prod.config.Version = kafka.V0_10_1_0
+	case "0.10.2", "0.10.2.0":
+		prod.config.Version = kafka.V0_10_2_0
+	case "0.11", "0.11.0", "0.11.0.0":
+		prod.config.Version = kafka.V0_11_0_0
+	case "1", "1.0", "1.0.0", "1.0.0.0":
+		prod.config.Version = kafka.V1_0_0_0
 	default:
 		prod.Logger.Warning("Unknown kafka version given: ", ver)
 		parts := strings.Split(ver, ".")
 		if len(parts) < 2 {
 			prod.config.Version = kafka.V0_8_2_2
 		} else {
+			major, _ := strconv.ParseUint(parts[0], 10, 8)
 			minor, _ := strconv.ParseUint(parts[1], 10, 8)
 			switch {
+			case major >= 1:
+				prod.config.Version = kafka.V1_0_0_0
 			case minor <= 8:
 				prod.config.Version = kafka.V0_8_2_2
 			case minor == 9:
 				prod.config.Version = kafka.V0_9_0_1
-			case minor >= 10:
+			case minor == 10:
 				prod.config.Version = kafka.V0_10_0_0
+			case minor >= 11:
+				prod.config.Version = kafka.V0_11_0_0
 			}
 		}
 	}
 
+	if len(prod.headersField) > 0 && !prod.config.Version.IsAtLeast(kafka.V0_11_0_0) {
+		conf.Errors.Pushf("HeadersFrom requires Version to be at least 0.11")
+	}
+
 	prod.config.Net.MaxOpenRequests = int(conf.GetInt("MaxOpenRequests", 5))
 	prod.config.Net.DialTimeout = time.Duration(int(conf.GetInt("ServerTimeoutSec", 30))) * time.Second
 	prod.config.Net.ReadTimeout = prod.config.Net.DialTimeout
@@ -280,34 +412,22 @@ func (prod *Kafka) Configure(conf core.PluginConfigReader) {
 	if prod.config.Net.TLS.Enable {
 		prod.config.Net.TLS.Config = &tls.Config{}
 
-		keyFile := conf.GetString("TlsKeyLocation", "")
-		certFile := conf.GetString("TlsCertificateLocation", "")
-		if keyFile != "" && certFile != "" {
-			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
-			if conf.Errors.Push(err) {
-				return
-			}
-			prod.config.Net.TLS.Config.Certificates = []tls.Certificate{cert}
-		} else if certFile == "" {
-			conf.Errors.Pushf("Cannot specify TlsKeyLocation without TlsCertificateLocation")
-			return
-		} else if keyFile == "" {
-			conf.Errors.Pushf("Cannot specify TlsCertificateLocation without TlsKeyLocation")
+		cert, err := components.ReadTLSKeyPair(conf)
+		if conf.Errors.Push(err) {
 			return
 		}
+		if cert != nil {
+			prod.config.Net.TLS.Config.Certificates = []tls.Certificate{*cert}
+		}
 
-		caFile := conf.GetString("TlsCaLocation", "")
-		if caFile == "" {
-			conf.Errors.Pushf("TlsEnable is set to true, but no TlsCaLocation was specified")
+		caCertPool, err := components.ReadTLSCertPool(conf)
+		if conf.Errors.Push(err) {
 			return
 		}
-		caCert, err := ioutil.ReadFile(caFile)
-		if conf.Errors.Push(err) {
+		if caCertPool == nil {
+			conf.Errors.Pushf("TlsEnable is set to true, but neither TlsCaLocation nor TlsCaPem was specified")
 			return
 		}
-
-		caCertPool := x509.NewCertPool()
-		caCertPool.AppendCertsFromPEM(caCert)
 		prod.config.Net.TLS.Config.RootCAs = caCertPool
 
 		serverName := conf.GetString("TlsServerName", "")
@@ -372,6 +492,58 @@ func (prod *Kafka) Configure(conf core.PluginConfigReader) {
 
 		}
 	}
+
+	if len(prod.partitionField) > 0 {
+		prod.config.Producer.Partitioner = NewManualPartitionerWithFallback(prod.config.Producer.Partitioner)
+	}
+
+	if prod.idempotent {
+		prod.configureIdempotence(conf)
+	}
+
+	prod.topicExists = prod.fetchTopicExists
+	prod.createTopic = prod.createTopicWithAdmin
+	if prod.autoCreateTopic {
+		prod.requireExistingTopic = true
+		if !prod.config.Version.IsAtLeast(kafka.V0_10_1_0) {
+			conf.Errors.Pushf("AutoCreateTopic requires Version to be at least 0.10.1")
+		}
+		if prod.autoCreatePartitions < 1 || prod.autoCreateReplicas < 1 {
+			conf.Errors.Pushf("AutoCreatePartitions and AutoCreateReplicationFactor must be at least 1")
+		}
+	}
+}
+
+// configureIdempotence enables the idempotent producer and enforces its
+// prerequisites. Settings left at their defaults are adjusted, explicitly
+// configured settings conflicting with the prerequisites are reported.
+func (prod *Kafka) configureIdempotence(conf core.PluginConfigReader) {
+	prod.config.Producer.Idempotent = true
+
+	if !prod.config.Version.IsAtLeast(kafka.V0_11_0_0) {
+		if conf.HasValue("Version") {
+			conf.Errors.Pushf("Idempotent requires Version to be at least 0.11")
+		}
+		prod.config.Version = kafka.V0_11_0_0
+	}
+
+	if prod.config.Producer.RequiredAcks != kafka.WaitForAll {
+		if conf.HasValue("RequiredAcks") {
+			conf.Errors.Pushf("Idempotent requires RequiredAcks to be -1")
+		}
+		prod.config.Producer.RequiredAcks = kafka.WaitForAll
+	}
+
+	if prod.config.Net.MaxOpenRequests != 1 {
+		if conf.HasValue("MaxOpenRequests") {
+			conf.Errors.Pushf("Idempotent requires MaxOpenRequests to be 1")
+		}
+		prod.config.Net.MaxOpenRequests = 1
+	}
+
+	if prod.config.Producer.Retry.Max < 1 {
+		conf.Errors.Pushf("Idempotent requires SendRetries to be at least 1")
+	}
 }
 
 func (prod *Kafka) onMsgReturned(msg *core.Message) {
@@ -383,6 +555,137 @@ func (prod *Kafka) onMsgReturned(msg *core.Message) {
 	topic.metricsDelivered.Inc(1)
 }
 
+// addInFlight marks a message as passed to sarama but not yet acknowledged.
+func (prod *Kafka) addInFlight(msg *core.Message) {
+	prod.inFlightGuard.Lock()
+	defer prod.inFlightGuard.Unlock()
+	prod.inFlight[msg] = struct{}{}
+}
+
+// removeInFlight marks a message as acknowledged.
+func (prod *Kafka) removeInFlight(msg *core.Message) {
+	prod.inFlightGuard.Lock()
+	defer prod.inFlightGuard.Unlock()
+	delete(prod.inFlight, msg)
+}
+
+// getInFlightCount returns the number of messages not yet acknowledged.
+func (prod *Kafka) getInFlightCount() int {
+	prod.inFlightGuard.Lock()
+	defer prod.inFlightGuard.Unlock()
+	return len(prod.inFlight)
+}
+
+// fallbackInFlight sends all messages not yet acknowledged to the fallback.
+func (prod *Kafka) fallbackInFlight() {
+	prod.inFlightGuard.Lock()
+	pending := prod.inFlight
+	prod.inFlight = make(map[*core.Message]struct{})
+	prod.inFlightGuard.Unlock()
+
+	if len(pending) > 0 {
+		prod.Logger.Warningf("%d messages have not been acknowledged", len(pending))
+	}
+	for msg := range pending {
+		prod.TryFallback(msg)
+		prod.AckMessage(msg)
+	}
+}
+
+func (prod *Kafka) onSuccess(result *kafka.ProducerMessage) {
+	prod.Breaker.Success()
+	if msg, hasMsg := result.Metadata.(*core.Message); hasMsg {
+		prod.removeInFlight(msg)
+		prod.onMsgReturned(msg)
+		prod.AckMessage(msg)
+	}
+}
+
+func (prod *Kafka) onError(err *kafka.ProducerError) {
+	if msg, hasMsg := err.Msg.Metadata.(*core.Message); hasMsg {
+		prod.Logger.WithError(err).Warning("Kafka producer error on return: ")
+		prod.removeInFlight(msg)
+		prod.onMsgReturned(msg)
+		if err.Err == kafka.ErrMessageTooLarge {
+			prod.onMessageTooLarge(msg, err.Msg)
+		} else {
+			prod.Breaker.Failure()
+			prod.TryFallback(msg)
+			prod.AckMessage(msg)
+		}
+	}
+}
+
+// onMessageTooLarge handles messages rejected for exceeding the maximum
+// message size. Messages are truncated and sent again if TruncateOversize is
+// set, routed to TooLargeStream if set or discarded otherwise.
+func (prod *Kafka) onMessageTooLarge(msg *core.Message, kafkaMsg *kafka.ProducerMessage) {
+	isTruncated, _ := msg.TryGetMetadata().Bool("truncated")
+	if prod.truncateOversize && !isTruncated {
+		if prod.truncate(msg, kafkaMsg) && prod.resend(msg, kafkaMsg) {
+			prod.Logger.Warning("Message truncated as too large.")
+			return // ### return, sent again ###
+		}
+	}
+
+	if prod.tooLargeStream != nil {
+		prod.Logger.Warning("Message routed to TooLargeStream as too large.")
+		if err := core.RouteOriginal(msg, prod.tooLargeStream); err != nil {
+			prod.Logger.WithError(err).Error("Failed to route to TooLargeStream")
+		}
+		prod.AckMessage(msg)
+		return // ### return, routed ###
+	}
+
+	prod.Logger.Error("Message discarded as too large.")
+	core.MetricMessagesDiscarded.Inc(1)
+	prod.AckMessage(msg)
+}
+
+// truncate shortens the payload of a message so that the resulting kafka
+// message does not exceed the maximum message size. False is returned if
+// key and headers alone exceed that size.
+func (prod *Kafka) truncate(msg *core.Message, kafkaMsg *kafka.ProducerMessage) bool {
+	maxSize := prod.config.Producer.MaxMessageBytes - kafkaRecordOverhead
+	if kafkaMsg.Key != nil {
+		maxSize -= kafkaMsg.Key.Length()
+	}
+	for _, header := range kafkaMsg.Headers {
+		maxSize -= len(header.Key) + len(header.Value) + kafkaHeaderOverhead
+	}
+
+	payload := msg.GetPayload()
+	if maxSize <= 0 || len(payload) <= maxSize {
+		return false // ### return, truncation does not help ###
+	}
+
+	msg.StorePayload(payload[:maxSize])
+	msg.GetMetadata().Set("truncated", true)
+	kafkaMsg.Value = kafka.ByteEncoder(msg.GetPayload())
+	return true
+}
+
+// resend passes a message to the kafka client again. False is returned if
+// the client is closed or does not accept messages within GracePeriodMs.
+func (prod *Kafka) resend(msg *core.Message, kafkaMsg *kafka.ProducerMessage) bool {
+	producer := prod.producer
+	if producer == nil {
+		return false // ### return, shutting down ###
+	}
+
+	prod.addInFlight(msg)
+	timeout := time.NewTimer(prod.gracePeriod)
+	defer timeout.Stop()
+
+	select {
+	case producer.Input() <- kafkaMsg:
+		return true
+	case <-timeout.C:
+		prod.removeInFlight(msg)
+		return false
+	}
+}
+
 func (prod *Kafka) pollResults() {
 	// Check for results
 	keepPolling := true
@@ -391,23 +694,12 @@ func (prod *Kafka) pollResults() {
 		select {
 		case result, hasMore := <-prod.producer.Successes():
 			if hasMore {
-				if msg, hasMsg := result.Metadata.(core.Message); hasMsg {
-					prod.onMsgReturned(&msg)
-				}
+				prod.onSuccess(result)
 			}
 
 		case err, hasMore := <-prod.producer.Errors():
 			if hasMore {
-				if msg, hasMsg := err.Msg.Metadata.(core.Message); hasMsg {
-					prod.Logger.WithError(err).Warning("Kafka producer error on return: ")
-					prod.onMsgReturned(&msg)
-					if err == kafka.ErrMessageTooLarge {
-						prod.Logger.Error("Message discarded as too large.")
-						core.MetricMessagesDiscarded.Inc(1)
-					} else {
-						prod.TryFallback(&msg)
-					}
-				}
+				prod.onError(err)
 			}
 
 		case <-timeout.C:
@@ -416,6 +708,51 @@ func (prod *Kafka) pollResults() {
 	}
 }
 
+// drainResults stops the producer from accepting new messages and handles
+// results until all messages have been acknowledged or ShutdownTimeoutMs
+// has passed. Messages still not acknowledged are sent to the fallback.
+func (prod *Kafka) drainResults() {
+	if prod.producer == nil {
+		prod.fallbackInFlight()
+		return // ### return, not connected ###
+	}
+
+	// AsyncClose flushes all pending messages and closes the result channels
+	// when done.
+	prod.producer.AsyncClose()
+	successes := prod.producer.Successes()
+	errors := prod.producer.Errors()
+	prod.producer = nil
+
+	timeout := time.NewTimer(prod.GetShutdownTimeout())
+	defer timeout.Stop()
+
+	for (successes != nil || errors != nil) && prod.getInFlightCount() > 0 {
+		select {
+		case result, hasMore := <-successes:
+			if !hasMore {
+				successes = nil
+				continue // ### continue, channel closed ###
+			}
+			prod.onSuccess(result)
+
+		case err, hasMore := <-errors:
+			if !hasMore {
+				errors = nil
+				continue // ### continue, channel closed ###
+			}
+			prod.onError(err)
+
+		case <-timeout.C:
+			prod.Logger.Warning("Shutdown timeout reached while waiting for acknowledgements")
+			prod.fallbackInFlight()
+			return // ### return, timeout ###
+		}
+	}
+
+	prod.fallbackInFlight()
+}
+
 func (prod *Kafka) registerNewTopic(topicName string, streamID core.MessageStreamID) *topicHandle {
 	prod.topicGuard.Lock()
 	defer prod.topicGuard.Unlock()
@@ -445,11 +782,20 @@ func (prod *Kafka) registerNewTopic(topicName string, streamID core.MessageStrea
 }
 
 func (prod *Kafka) produceMessage(msg *core.Message) {
+	// Messages passed to sarama are acknowledged when the result arrives
+	if !prod.sendMessage(msg) {
+		prod.AckMessage(msg)
+	}
+}
+
+// sendMessage passes a message to sarama. False is returned if the message
+// has been discarded or sent to the fallback instead.
+func (prod *Kafka) sendMessage(msg *core.Message) bool {
 	if !prod.nilValueAllowed && len(msg.GetPayload()) == 0 {
 		streamName := core.StreamRegistry.GetStreamName(msg.GetStreamID())
 		prod.Logger.Errorf("0 byte message detected on %s. Discarded", streamName)
 		core.MetricMessagesDiscarded.Inc(1)
-		return // ### return, invalid data ###
+		return false // ### return, invalid data ###
 	}
 
 	prod.topicGuard.RLock()
@@ -467,19 +813,35 @@ func (prod *Kafka) produceMessage(msg *core.Message) {
 		topic = prod.registerNewTopic(topicName, msg.GetStreamID())
 	}
 
+	if !prod.Breaker.Allow() {
+		prod.TryFallback(msg)
+		return false // ### return, breaker open ###
+	}
+
+	if prod.requireExistingTopic && !prod.checkTopicExists(topic) {
+		prod.TryFallback(msg)
+		return false // ### return, topic does not exist ###
+	}
+
 	if isConnected, err := prod.isConnected(topic.name); !isConnected {
+		prod.Breaker.Failure()
 		prod.TryFallback(msg)
 		if err != nil {
 			prod.Logger.WithError(err).Errorf("Topic %s is not connected", topic.name)
+			prod.setDisconnected(topic.name, err.Error())
+		} else {
+			prod.setDisconnected(topic.name, "connection failed")
 		}
-		// TBD: health check? (ex-fuse breaker)
-		return // ### return, not connected ###
+		return false // ### return, not connected ###
 	}
+	prod.setDisconnected(topic.name, "")
 
 	kafkaMsg := &kafka.ProducerMessage{
-		Topic:    topic.name,
-		Value:    kafka.ByteEncoder(msg.GetPayload()),
-		Metadata: &msg,
+		Topic:     topic.name,
+		Value:     kafka.ByteEncoder(msg.GetPayload()),
+		Metadata:  msg,
+		Partition: prod.getKafkaMsgPartition(msg),
+		Headers:   prod.getKafkaMsgHeaders(msg),
 	}
 
 	kafkaKey := prod.getKafkaMsgKey(msg)
@@ -489,23 +851,27 @@ func (prod *Kafka) produceMessage(msg *core.Message) {
 
 	// Sarama can block on single messages if all buffers are full.
 	// So we stop trying after a few milliseconds
+	prod.addInFlight(msg)
 	timeout := time.NewTimer(prod.gracePeriod)
 	select {
 	case prod.producer.Input() <- kafkaMsg:
 		timeout.Stop()
 		topic.metricsSent.Inc(1)
+		return true
 
 	case <-timeout.C:
 		// Sarama channels are full -> fallback
+		prod.removeInFlight(msg)
+		prod.Breaker.Failure()
 		prod.TryFallback(msg)
 		topic.metricsTimeout.Inc(1)
+		return false
 	}
 }
 
 func (prod *Kafka) getKafkaMsgKey(msg *core.Message) []byte {
 	if len(prod.keyField) > 0 {
-		if metadata := msg.TryGetMetadata(); metadata != nil {
-			key, _ := metadata.Value(prod.keyField)
+		if key, exists := core.GetValuePath(msg.TryGetMetadata(), prod.keyField); exists {
 			return core.ConvertToBytes(key)
 		}
 	}
@@ -514,6 +880,142 @@ func (prod *Kafka) getKafkaMsgKey(msg *core.Message) []byte {
 
 }
 
+func (prod *Kafka) getKafkaMsgHeaders(msg *core.Message) []kafka.RecordHeader {
+	if len(prod.headersField) == 0 {
+		return nil
+	}
+
+	value, exists := core.GetValuePath(msg.TryGetMetadata(), prod.headersField)
+	if !exists {
+		return nil
+	}
+
+	// Don't convert MarshalMaps to keep binary values intact
+	headers, isMap := value.(tcontainer.MarshalMap)
+	if !isMap {
+		var err error
+		if headers, err = tcontainer.ConvertToMarshalMap(value, nil); err != nil {
+			prod.Logger.WithError(err).Warningf("%s does not contain a map", prod.headersField)
+			return nil
+		}
+	}
+
+	keys := make([]string, 0, len(headers))
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	recordHeaders := make([]kafka.RecordHeader, 0, len(keys))
+	for _, key := range keys {
+		recordHeaders = append(recordHeaders, kafka.RecordHeader{
+			Key:   []byte(key),
+			Value: core.ConvertToBytes(headers[key]),
+		})
+	}
+	return recordHeaders
+}
+
+func (prod *Kafka) getKafkaMsgPartition(msg *core.Message) int32 {
+	if len(prod.partitionField) == 0 {
+		return kafkaNoPartition
+	}
+
+	value, exists := core.GetValuePath(msg.TryGetMetadata(), prod.partitionField)
+	if !exists {
+		return kafkaNoPartition
+	}
+
+	partition, err := strconv.ParseInt(core.ConvertToString(value), 10, 32)
+	if err != nil || partition < 0 {
+		prod.Logger.Warningf("Invalid partition '%v' in %s", value, prod.partitionField)
+		return kafkaNoPartition
+	}
+	return int32(partition)
+}
+
+// checkTopicExists returns true if the given topic exists. If the topic does
+// not exist and AutoCreateTopic is set, the topic is created. The result is
+// cached for MetadataRefreshMs.
+func (prod *Kafka) checkTopicExists(topic *topicHandle) bool {
+	if !topic.lastCheck.IsZero() && time.Since(topic.lastCheck) < prod.config.Metadata.RefreshFrequency {
+		return topic.exists // ### return, cached ###
+	}
+
+	if prod.client == nil && !prod.tryOpenConnection() {
+		return false // ### return, not connected ###
+	}
+
+	exists, err := prod.topicExists(topic.name)
+	if err != nil {
+		prod.Logger.WithError(err).Errorf("Failed to check if topic %s exists", topic.name)
+		prod.setDisconnected(topic.name, err.Error())
+		return false // ### return, check failed ###
+	}
+
+	if !exists && prod.autoCreateTopic {
+		if err := prod.createTopic(topic.name); err != nil {
+			prod.Logger.WithError(err).Errorf("Failed to create topic %s", topic.name)
+		} else {
+			prod.Logger.Infof("Created topic %s with %d partitions and a replication factor of %d",
+				topic.name, prod.autoCreatePartitions, prod.autoCreateReplicas)
+			exists = true
+		}
+	}
+
+	if !exists && (topic.lastCheck.IsZero() || topic.exists) {
+		prod.Logger.Errorf("Topic %s does not exist. Messages are sent to the fallback until the topic has been created", topic.name)
+	}
+
+	topic.exists = exists
+	topic.lastCheck = time.Now()
+	if !exists {
+		prod.setDisconnected(topic.name, "topic does not exist")
+	}
+	return exists
+}
+
+// fetchTopicExists refreshes the metadata of all topics and checks if the
+// given topic is part of it. Requesting metadata for a specific topic would
+// create the topic on brokers with auto.create.topics.enable set to true.
+func (prod *Kafka) fetchTopicExists(topic string) (bool, error) {
+	if err := prod.client.RefreshMetadata(); err != nil {
+		return false, err
+	}
+
+	topics, err := prod.client.Topics()
+	if err != nil {
+		return false, err
+	}
+
+	for _, name := range topics {
+		if name == topic {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// createTopicWithAdmin creates the given topic using the cluster admin API.
+// Topics created in the meantime are not treated as an error.
+func (prod *Kafka) createTopicWithAdmin(topic string) error {
+	// The admin is not closed as this would close the producer's client, too
+	admin, err := kafka.NewClusterAdminFromClient(prod.client)
+	if err != nil {
+		return err
+	}
+
+	err = admin.CreateTopic(topic, &kafka.TopicDetail{
+		NumPartitions:     int32(prod.autoCreatePartitions),
+		ReplicationFactor: int16(prod.autoCreateReplicas),
+	}, false)
+
+	if topicErr, isTopicErr := err.(*kafka.TopicError); isTopicErr && topicErr.Err == kafka.ErrTopicAlreadyExists {
+		return nil
+	}
+	return err
+}
+
 func (prod *Kafka) isConnected(topic string) (bool, error) {
 	if prod.client == nil || prod.producer == nil {
 		if !prod.tryOpenConnection() {
@@ -563,6 +1065,56 @@ func (prod *Kafka) isConnected(topic string) (bool, error) {
 	return true, nil
 }
 
+// setDisconnected stores the reason why a topic is not connected. Passing an
+// empty reason marks the topic as connected.
+func (prod *Kafka) setDisconnected(topic string, reason string) {
+	prod.topicGuard.RLock()
+	current, isDisconnected := prod.disconnected[topic]
+	prod.topicGuard.RUnlock()
+
+	if (!isDisconnected && reason == "") || current == reason {
+		return // ### return, nothing changed ###
+	}
+
+	prod.topicGuard.Lock()
+	defer prod.topicGuard.Unlock()
+	if reason == "" {
+		delete(prod.disconnected, topic)
+	} else {
+		prod.disconnected[topic] = reason
+	}
+}
+
+// HealthCheck reports StatusServiceUnavailable if the circuit breaker is open
+// or if at least one topic failed to connect during the last write.
+func (prod *Kafka) HealthCheck() (code int, body string) {
+	if prod.Breaker.IsOpen() {
+		return thealthcheck.StatusServiceUnavailable, "BREAKER_OPEN"
+	}
+
+	prod.topicGuard.RLock()
+	defer prod.topicGuard.RUnlock()
+	if len(prod.disconnected) == 0 {
+		return thealthcheck.StatusOK, "CONNECTED"
+	}
+
+	reasons := make([]string, 0, len(prod.disconnected))
+	for topic, reason := range prod.disconnected {
+		reasons = append(reasons, fmt.Sprintf("%s (%s)", topic, reason))
+	}
+	sort.Strings(reasons)
+	return thealthcheck.StatusServiceUnavailable, "NOT_CONNECTED: " + strings.Join(reasons, ", ")
+}
+
+// Dial checks if a connection to the configured brokers can be established
+func (prod *Kafka) Dial() error {
+	client, err := kafka.NewClient(prod.servers, prod.config)
+	if err != nil {
+		return err
+	}
+	return client.Close()
+}
+
 func (prod *Kafka) tryOpenConnection() bool {
 	// Reconnect the client first
 	if prod.client == nil {
@@ -599,7 +1151,8 @@ func (prod *Kafka) closeConnection() {
 func (prod *Kafka) close() {
 	defer prod.WorkerDone()
 	prod.DefaultClose()
-	prod.closeConnection()
+	prod.drainResults()
+	prod.RunBeforeDrainDeadline(prod.closeConnection)
 }
 
 // Produce writes to a buffer that is sent to a given socket.
@@ -0,0 +1,58 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	kafka "github.com/Shopify/sarama"
+)
+
+// kafkaNoPartition marks messages that should be passed to the configured
+// partitioner.
+const kafkaNoPartition = int32(-1)
+
+// ManualPartitioner uses the partition set on a message if it is valid for
+// the topic. Messages without partition (i.e. set to a negative value) or
+// with a partition out of range are passed to a fallback partitioner.
+// ManualPartitioner satisfies sarama.Partitioner so it can be directly
+// assigned to sarama kafka producer config.
+type ManualPartitioner struct {
+	fallback kafka.Partitioner
+}
+
+// NewManualPartitionerWithFallback returns a sarama partitioner constructor
+// creating a ManualPartitioner that uses the partitioner created by the
+// given constructor as a fallback.
+func NewManualPartitionerWithFallback(fallback kafka.PartitionerConstructor) kafka.PartitionerConstructor {
+	return func(topic string) kafka.Partitioner {
+		return &ManualPartitioner{
+			fallback: fallback(topic),
+		}
+	}
+}
+
+// Partition returns the partition set on the message if it is within
+// [0, numPartitions). Otherwise the fallback partitioner is used.
+func (p *ManualPartitioner) Partition(message *kafka.ProducerMessage, numPartitions int32) (int32, error) {
+	if message.Partition >= 0 && message.Partition < numPartitions {
+		return message.Partition, nil
+	}
+	return p.fallback.Partition(message, numPartitions)
+}
+
+// RequiresConsistency always returns true as manual partitions must not be
+// changed by sarama.
+func (p *ManualPartitioner) RequiresConsistency() bool {
+	return true
+}
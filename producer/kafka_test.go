@@ -0,0 +1,604 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gollum/core"
+
+	kafka "github.com/Shopify/sarama"
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/thealthcheck"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestKafkaPartitionFrom(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "producer.Kafka")
+	config.Override("PartitionFrom", "kafka/partition")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*Kafka)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("foo"), tcontainer.MarshalMap{
+		"kafka": tcontainer.MarshalMap{"partition": 3},
+	}, core.InvalidStreamID)
+	expect.Equal(int32(3), prod.getKafkaMsgPartition(msg))
+
+	msg = core.NewMessage(nil, []byte("foo"), tcontainer.MarshalMap{
+		"kafka": tcontainer.MarshalMap{"partition": "2"},
+	}, core.InvalidStreamID)
+	expect.Equal(int32(2), prod.getKafkaMsgPartition(msg))
+
+	msg = core.NewMessage(nil, []byte("foo"), tcontainer.MarshalMap{
+		"kafka": tcontainer.MarshalMap{"partition": "two"},
+	}, core.InvalidStreamID)
+	expect.Equal(kafkaNoPartition, prod.getKafkaMsgPartition(msg))
+
+	msg = core.NewMessage(nil, []byte("foo"), nil, core.InvalidStreamID)
+	expect.Equal(kafkaNoPartition, prod.getKafkaMsgPartition(msg))
+
+	partitioner := prod.config.Producer.Partitioner("topic")
+	_, isManual := partitioner.(*ManualPartitioner)
+	expect.True(isManual)
+}
+
+func TestKafkaWithoutPartitionFrom(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "producer.Kafka")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*Kafka)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("foo"), tcontainer.MarshalMap{"partition": 1}, core.InvalidStreamID)
+	expect.Equal(kafkaNoPartition, prod.getKafkaMsgPartition(msg))
+
+	partitioner := prod.config.Producer.Partitioner("topic")
+	_, isManual := partitioner.(*ManualPartitioner)
+	expect.False(isManual)
+}
+
+func TestKafkaManualPartitioner(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	constructor := NewManualPartitionerWithFallback(kafka.NewRoundRobinPartitioner)
+	partitioner := constructor("topic")
+	expect.True(partitioner.RequiresConsistency())
+
+	partition, err := partitioner.Partition(&kafka.ProducerMessage{Partition: 2}, 4)
+	expect.NoError(err)
+	expect.Equal(int32(2), partition)
+
+	// Out of range and unset partitions are passed to the fallback
+	partition, err = partitioner.Partition(&kafka.ProducerMessage{Partition: 4}, 4)
+	expect.NoError(err)
+	expect.Equal(int32(0), partition)
+
+	partition, err = partitioner.Partition(&kafka.ProducerMessage{Partition: kafkaNoPartition}, 4)
+	expect.NoError(err)
+	expect.Equal(int32(1), partition)
+}
+
+func TestKafkaHeadersFrom(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "producer.Kafka")
+	config.Override("HeadersFrom", "kafka/headers")
+	config.Override("Version", "0.11")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*Kafka)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("foo"), tcontainer.MarshalMap{
+		"kafka": tcontainer.MarshalMap{
+			"headers": tcontainer.MarshalMap{
+				"traceparent": "00-abc-def-01",
+				"binary":      []byte{0, 1, 2},
+			},
+		},
+	}, core.InvalidStreamID)
+
+	headers := prod.getKafkaMsgHeaders(msg)
+	expect.Equal(2, len(headers))
+	expect.Equal("binary", string(headers[0].Key))
+	expect.Equal([]byte{0, 1, 2}, headers[0].Value)
+	expect.Equal("traceparent", string(headers[1].Key))
+	expect.Equal("00-abc-def-01", string(headers[1].Value))
+
+	msg = core.NewMessage(nil, []byte("foo"), nil, core.InvalidStreamID)
+	expect.Equal(0, len(prod.getKafkaMsgHeaders(msg)))
+}
+
+func TestKafkaHeadersFromRequiresVersion(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "producer.Kafka")
+	config.Override("HeadersFrom", "headers")
+	config.Override("Version", "0.10")
+
+	_, err := core.NewPluginWithConfig(config)
+	expect.NotNil(err)
+}
+
+func TestKafkaTlsPemAndLocation(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "producer.Kafka")
+	config.Override("TlsEnable", true)
+	config.Override("TlsCaLocation", "ca.pem")
+	config.Override("TlsCaPem", "-----BEGIN CERTIFICATE-----")
+
+	_, err := core.NewPluginWithConfig(config)
+	expect.NotNil(err)
+}
+
+func TestKafkaHealthCheck(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "producer.Kafka")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*Kafka)
+	expect.True(casted)
+
+	code, body := prod.HealthCheck()
+	expect.Equal(thealthcheck.StatusOK, code)
+	expect.Equal("CONNECTED", body)
+
+	prod.setDisconnected("b", "connection failed")
+	prod.setDisconnected("a", "timeout")
+
+	code, body = prod.HealthCheck()
+	expect.Equal(thealthcheck.StatusServiceUnavailable, code)
+	expect.Equal("NOT_CONNECTED: a (timeout), b (connection failed)", body)
+
+	prod.setDisconnected("a", "")
+	prod.setDisconnected("b", "")
+
+	code, _ = prod.HealthCheck()
+	expect.Equal(thealthcheck.StatusOK, code)
+}
+
+// mockAsyncProducer reports the given results when being closed but never
+// closes its result channels.
+type mockAsyncProducer struct {
+	input     chan *kafka.ProducerMessage
+	successes chan *kafka.ProducerMessage
+	errors    chan *kafka.ProducerError
+	onClose   func(*mockAsyncProducer)
+	closed    int
+}
+
+func newMockAsyncProducer(onClose func(*mockAsyncProducer)) *mockAsyncProducer {
+	return &mockAsyncProducer{
+		input:     make(chan *kafka.ProducerMessage, 10),
+		successes: make(chan *kafka.ProducerMessage, 10),
+		errors:    make(chan *kafka.ProducerError, 10),
+		onClose:   onClose,
+	}
+}
+
+func (mock *mockAsyncProducer) AsyncClose() {
+	mock.closed++
+	mock.onClose(mock)
+}
+
+func (mock *mockAsyncProducer) Close() error {
+	mock.AsyncClose()
+	return nil
+}
+
+func (mock *mockAsyncProducer) Input() chan<- *kafka.ProducerMessage {
+	return mock.input
+}
+
+func (mock *mockAsyncProducer) Successes() <-chan *kafka.ProducerMessage {
+	return mock.successes
+}
+
+func (mock *mockAsyncProducer) Errors() <-chan *kafka.ProducerError {
+	return mock.errors
+}
+
+func TestKafkaDrainResults(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	fallback := newMockRouter(t.Name() + "Fallback")
+
+	config := core.NewPluginConfig(t.Name(), "producer.Kafka")
+	config.Override("FallbackStream", t.Name()+"Fallback")
+	config.Override("ShutdownTimeoutMs", 100)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*Kafka)
+	expect.True(casted)
+
+	prod.registerNewTopic("test", core.InvalidStreamID)
+
+	messages := []*core.Message{
+		core.NewMessage(nil, []byte("acked"), nil, core.InvalidStreamID),
+		core.NewMessage(nil, []byte("failed"), nil, core.InvalidStreamID),
+		core.NewMessage(nil, []byte("unacked"), nil, core.InvalidStreamID),
+	}
+
+	mock := newMockAsyncProducer(func(mock *mockAsyncProducer) {
+		for idx := 0; idx < 2; idx++ {
+			kafkaMsg := <-mock.input
+			if idx == 0 {
+				mock.successes <- kafkaMsg
+			} else {
+				mock.errors <- &kafka.ProducerError{Msg: kafkaMsg, Err: errors.New("failed")}
+			}
+		}
+	})
+	prod.producer = mock
+
+	for _, msg := range messages {
+		msg.FreezeOriginal()
+		prod.addInFlight(msg)
+		mock.input <- &kafka.ProducerMessage{Topic: "test", Metadata: msg}
+	}
+	expect.Equal(3, prod.getInFlightCount())
+
+	start := time.Now()
+	prod.drainResults()
+	expect.Geq(int64(time.Since(start)), int64(100*time.Millisecond))
+
+	expect.Equal([]string{"failed", "unacked"}, fallback.receive(t, 2))
+	expect.Equal(0, prod.getInFlightCount())
+	expect.Nil(prod.producer)
+
+	// The producer must not be closed again
+	prod.closeConnection()
+	expect.Equal(1, mock.closed)
+}
+
+func TestKafkaWriteAheadLogAck(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	dir, err := ioutil.TempDir("", "gollum-wal")
+	expect.NoError(err)
+	defer os.RemoveAll(dir)
+
+	fallback := newMockRouter(t.Name() + "Fallback")
+	config := core.NewPluginConfig(t.Name(), "producer.Kafka")
+	config.Override("FallbackStream", t.Name()+"Fallback")
+	config.Override("WAL", map[string]interface{}{"Path": dir})
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*Kafka)
+	expect.True(casted)
+	prod.registerNewTopic("test", core.InvalidStreamID)
+
+	// Opening the log again returns the log used by the producer
+	wal, err := core.NewWriteAheadLog(filepath.Join(dir, t.Name()), 0, 0, prod.Logger)
+	expect.NoError(err)
+
+	delivered := core.NewMessage(nil, []byte("delivered"), nil, core.InvalidStreamID)
+	failed := core.NewMessage(nil, []byte("failed"), nil, core.InvalidStreamID)
+	failed.FreezeOriginal()
+	prod.Enqueue(delivered, -1)
+	prod.Enqueue(failed, -1)
+	expect.Equal(2, wal.GetNumInFlight())
+
+	// Messages are acknowledged by the result sent by the broker
+	prod.addInFlight(delivered)
+	prod.onSuccess(&kafka.ProducerMessage{Topic: "test", Metadata: delivered})
+	expect.Equal(1, wal.GetNumInFlight())
+
+	prod.addInFlight(failed)
+	prod.onError(&kafka.ProducerError{Msg: &kafka.ProducerMessage{Topic: "test", Metadata: failed}, Err: errors.New("failed")})
+	expect.Equal([]string{"failed"}, fallback.receive(t, 1))
+	expect.Equal(0, wal.GetNumInFlight())
+
+	expect.NoError(wal.Close())
+	expect.NoError(wal.Close())
+}
+
+func TestKafkaMessageTooLarge(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	tooLarge := newMockRouter(t.Name() + "TooLarge")
+
+	config := core.NewPluginConfig(t.Name(), "producer.Kafka")
+	config.Override("TooLargeStream", t.Name()+"TooLarge")
+	config.Override("TruncateOversize", true)
+	config.Override("Batch/SizeMaxKB", 1)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*Kafka)
+	expect.True(casted)
+
+	prod.registerNewTopic("test", core.InvalidStreamID)
+
+	mock := newMockAsyncProducer(func(*mockAsyncProducer) {})
+	prod.producer = mock
+
+	payload := make([]byte, 2048)
+	for idx := range payload {
+		payload[idx] = 'a'
+	}
+	msg := core.NewMessage(nil, payload, nil, core.InvalidStreamID)
+	msg.FreezeOriginal()
+
+	kafkaMsg := &kafka.ProducerMessage{
+		Topic:    "test",
+		Key:      kafka.StringEncoder("key"),
+		Value:    kafka.ByteEncoder(msg.GetPayload()),
+		Metadata: msg,
+	}
+
+	// The message is truncated to fit and sent again
+	prod.onError(&kafka.ProducerError{Msg: kafkaMsg, Err: kafka.ErrMessageTooLarge})
+
+	select {
+	case resent := <-mock.input:
+		expect.Equal(kafkaMsg, resent)
+		expect.Equal(1024-kafkaRecordOverhead-3, resent.Value.Length())
+		expect.MapEqual(msg.GetMetadata(), "truncated", true)
+		expect.Equal(1, prod.getInFlightCount())
+	default:
+		t.Fatal("truncated message was not sent")
+	}
+
+	// A truncated message that is rejected again is routed as-is
+	prod.onError(&kafka.ProducerError{Msg: kafkaMsg, Err: kafka.ErrMessageTooLarge})
+	expect.Equal([]string{string(payload)}, tooLarge.receive(t, 1))
+	expect.Equal(0, prod.getInFlightCount())
+	expect.Equal(0, len(mock.input))
+
+	// Without truncation messages are routed directly
+	prod.truncateOversize = false
+	msg = core.NewMessage(nil, []byte("too large"), nil, core.InvalidStreamID)
+	kafkaMsg = &kafka.ProducerMessage{Topic: "test", Value: kafka.ByteEncoder(msg.GetPayload()), Metadata: msg}
+	prod.onError(&kafka.ProducerError{Msg: kafkaMsg, Err: kafka.ErrMessageTooLarge})
+	expect.Equal([]string{"too large"}, tooLarge.receive(t, 1))
+	expect.Equal(0, len(mock.input))
+}
+
+func TestKafkaIdempotent(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "producer.Kafka")
+	config.Override("Idempotent", true)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*Kafka)
+	expect.True(casted)
+
+	expect.True(prod.config.Producer.Idempotent)
+	expect.True(prod.config.Version.IsAtLeast(kafka.V0_11_0_0))
+	expect.Equal(kafka.WaitForAll, prod.config.Producer.RequiredAcks)
+	expect.Equal(1, prod.config.Net.MaxOpenRequests)
+	expect.NoError(prod.config.Validate())
+}
+
+func TestKafkaIdempotentExplicitSettings(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "producer.Kafka")
+	config.Override("Idempotent", true)
+	config.Override("Version", "1.0")
+	config.Override("RequiredAcks", -1)
+	config.Override("MaxOpenRequests", 1)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*Kafka)
+	expect.True(casted)
+
+	expect.Equal(kafka.V1_0_0_0, prod.config.Version)
+	expect.NoError(prod.config.Validate())
+}
+
+func TestKafkaIdempotentConflicts(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	for idx, settings := range []map[string]interface{}{
+		{"Version": "0.10"},
+		{"RequiredAcks": 1},
+		{"MaxOpenRequests": 5},
+		{"SendRetries": 0},
+	} {
+		config := core.NewPluginConfig(fmt.Sprintf("%s%d", t.Name(), idx), "producer.Kafka")
+		config.Override("Idempotent", true)
+		for key, value := range settings {
+			config.Override(key, value)
+		}
+		_, err := core.NewPluginWithConfig(config)
+		expect.NotNil(err)
+	}
+}
+
+// mockKafkaClient is a non-nil client for tests that never reach sarama.
+type mockKafkaClient struct {
+	kafka.Client
+}
+
+// mockKafkaTopics answers topic existence checks and creation requests.
+type mockKafkaTopics struct {
+	topics  map[string]bool
+	checks  int
+	created []string
+	err     error
+}
+
+func (mock *mockKafkaTopics) exists(topic string) (bool, error) {
+	mock.checks++
+	return mock.topics[topic], mock.err
+}
+
+func (mock *mockKafkaTopics) create(topic string) error {
+	if mock.err != nil {
+		return mock.err
+	}
+	mock.created = append(mock.created, topic)
+	mock.topics[topic] = true
+	return nil
+}
+
+func TestKafkaRequireExistingTopic(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	fallback := newMockRouter(t.Name() + "Fallback")
+
+	config := core.NewPluginConfig(t.Name(), "producer.Kafka")
+	config.Override("RequireExistingTopic", true)
+	config.Override("FallbackStream", t.Name()+"Fallback")
+	config.Override("Topics", map[string]string{
+		t.Name(): "missing",
+	})
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*Kafka)
+	expect.True(casted)
+
+	prod.client = &mockKafkaClient{}
+	topics := &mockKafkaTopics{topics: map[string]bool{"existing": true}}
+	prod.topicExists = topics.exists
+	prod.createTopic = topics.create
+
+	// Messages for missing topics are sent to the fallback and the topic is
+	// only checked once.
+	prod.produceMessage(core.NewMessage(nil, []byte("first"), nil, core.GetStreamID(t.Name())))
+	prod.produceMessage(core.NewMessage(nil, []byte("second"), nil, core.GetStreamID(t.Name())))
+	expect.Equal([]string{"first", "second"}, fallback.receive(t, 2))
+	expect.Equal(1, topics.checks)
+	expect.Equal(0, len(topics.created))
+
+	code, body := prod.HealthCheck()
+	expect.Equal(thealthcheck.StatusServiceUnavailable, code)
+	expect.Equal("NOT_CONNECTED: missing (topic does not exist)", body)
+
+	// Existing topics pass the check
+	existing := prod.registerNewTopic("existing", core.InvalidStreamID)
+	expect.True(prod.checkTopicExists(existing))
+	expect.True(prod.checkTopicExists(existing))
+	expect.Equal(2, topics.checks)
+
+	// The check is repeated after MetadataRefreshMs
+	missing := prod.registerNewTopic("missing", core.GetStreamID(t.Name()))
+	topics.topics["missing"] = true
+	expect.False(prod.checkTopicExists(missing))
+	missing.lastCheck = time.Now().Add(-prod.config.Metadata.RefreshFrequency)
+	expect.True(prod.checkTopicExists(missing))
+	expect.Equal(3, topics.checks)
+}
+
+func TestKafkaRequireExistingTopicError(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "producer.Kafka")
+	config.Override("RequireExistingTopic", true)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*Kafka)
+	expect.True(casted)
+
+	prod.client = &mockKafkaClient{}
+	topics := &mockKafkaTopics{topics: map[string]bool{"existing": true}}
+	prod.topicExists = topics.exists
+	prod.createTopic = topics.create
+
+	// Failed checks are not cached
+	topics.err = errors.New("metadata request failed")
+	topic := prod.registerNewTopic("existing", core.InvalidStreamID)
+	expect.False(prod.checkTopicExists(topic))
+	expect.True(topic.lastCheck.IsZero())
+
+	topics.err = nil
+	expect.True(prod.checkTopicExists(topic))
+	expect.Equal(2, topics.checks)
+}
+
+func TestKafkaAutoCreateTopic(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "producer.Kafka")
+	config.Override("AutoCreateTopic", true)
+	config.Override("Version", "0.11")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*Kafka)
+	expect.True(casted)
+
+	prod.client = &mockKafkaClient{}
+	topics := &mockKafkaTopics{topics: map[string]bool{"existing": true}}
+	prod.topicExists = topics.exists
+	prod.createTopic = topics.create
+
+	expect.True(prod.requireExistingTopic)
+
+	topic := prod.registerNewTopic("missing", core.InvalidStreamID)
+	expect.True(prod.checkTopicExists(topic))
+	expect.Equal([]string{"missing"}, topics.created)
+
+	// Topics that cannot be created are treated as missing
+	topic = prod.registerNewTopic("forbidden", core.InvalidStreamID)
+	prod.createTopic = func(string) error { return errors.New("not authorized") }
+	expect.False(prod.checkTopicExists(topic))
+	expect.False(topic.lastCheck.IsZero())
+}
+
+func TestKafkaAutoCreateTopicConfig(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	for idx, settings := range []map[string]interface{}{
+		{"AutoCreateTopic": true, "Version": "0.10"},
+		{"AutoCreateTopic": true, "Version": "0.11", "AutoCreatePartitions": 0},
+		{"AutoCreateTopic": true, "Version": "0.11", "AutoCreateReplicationFactor": 0},
+	} {
+		config := core.NewPluginConfig(fmt.Sprintf("%s%d", t.Name(), idx), "producer.Kafka")
+		for key, value := range settings {
+			config.Override(key, value)
+		}
+		_, err := core.NewPluginWithConfig(config)
+		expect.NotNil(err)
+	}
+}
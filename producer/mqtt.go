@@ -0,0 +1,299 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"gollum/core"
+	"gollum/core/components"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// MQTT producer plugin
+//
+// This producer publishes messages to an MQTT broker. Each message is
+// published with the message payload as MQTT payload.
+// Lost connections are reestablished in the background with an increasing
+// backoff. Messages sent while the producer is not connected are passed to
+// the fallback. Messages published with QoS 1 or 2 are passed to the
+// fallback if the broker does not acknowledge them in time.
+//
+// Parameters
+//
+// - Servers: Defines a list of broker URIs like "tcp://host:1883". Servers
+// are tried in the given order when connecting. Use "ssl://" to connect via
+// TLS or "ws://" and "wss://" to connect via websockets.
+// By default this parameter is set to "tcp://localhost:1883".
+//
+// - StreamMapping: Defines a translation from gollum stream names to MQTT
+// topics. You can define the wildcard stream (*) here, too. If a stream is
+// not mapped, the stream name is used as topic.
+// By default this parameter is set to an empty list.
+//
+// - TopicFrom: Defines a metadata field to read the topic from. Nested fields
+// can be addressed by a path like "mqtt/topic". If the field is not set or
+// empty, StreamMapping is used.
+// By default this parameter is set to "".
+//
+// - QoS: Defines the MQTT quality of service level used for publishing.
+// Valid values are 0 (at most once), 1 (at least once) and 2 (exactly once).
+// By default this parameter is set to 1.
+//
+// - Retained: When set to true messages are published with the retained
+// flag, i.e. the broker stores the last message of each topic and sends it
+// to new subscribers.
+// By default this parameter is set to false.
+//
+// - ClientID: Defines the client identifier sent to the broker. If empty, the
+// broker assigns an identifier.
+// By default this parameter is set to "".
+//
+// - CleanSession: When set to false the broker keeps the session state of
+// this client while it is disconnected. Requires ClientID to be set.
+// By default this parameter is set to true.
+//
+// - Username: Defines the username used for authentication.
+// By default this parameter is set to "".
+//
+// - Password: Defines the password used for authentication.
+// By default this parameter is set to "".
+//
+// - KeepAliveSec: Defines the interval in seconds in which the client pings
+// the broker when no other messages are sent.
+// By default this parameter is set to "30".
+//
+// - TimeoutMs: Defines the timeout in milliseconds for connecting to a server
+// and waiting for the broker to acknowledge a message.
+// By default this parameter is set to "5000".
+//
+// - ReconnectDelayMs: Defines the delay in milliseconds before a failed
+// initial connection attempt is repeated.
+// By default this parameter is set to "500".
+//
+// - ReconnectDelayMaxMs: Defines the maximum delay between two reconnect
+// attempts in milliseconds. The delay starts at one second and is doubled
+// with each failed attempt.
+// By default this parameter is set to "30000".
+//
+// - TlsKeyLocation, TlsKeyPem: The client's private key used for TLS based
+// authentication, given as path or PEM encoded string.
+// By default these parameters are set to "".
+//
+// - TlsCertificateLocation, TlsCertificatePem: The client's public key used
+// for TLS based authentication, given as path or PEM encoded string.
+// By default these parameters are set to "".
+//
+// - TlsCaLocation, TlsCaPem: The CA certificate(s) used for verifying the
+// server's key, given as path or PEM encoded string. If not set, the
+// system's root certificates are used.
+// By default these parameters are set to "".
+//
+// - TlsServerName: Used to verify the hostname on the server's certificate
+// unless TlsInsecureSkipVerify is true. If not set, the host of the server
+// URI is used.
+// By default this parameter is set to "".
+//
+// - TlsInsecureSkipVerify: Disables server certificate chain and host name
+// verification.
+// By default this parameter is set to false.
+//
+// Examples
+//
+// This example publishes the latest state of each device as retained
+// message to a topic read from the metadata field "device_topic".
+//
+//  MQTTOut:
+//    Type: producer.MQTT
+//    Streams: devices
+//    Servers:
+//      - ssl://mqtt.example.com:8883
+//    StreamMapping:
+//      devices: devices/unknown
+//    TopicFrom: device_topic
+//    QoS: 1
+//    Retained: true
+type MQTT struct {
+	core.BufferedProducer `gollumdoc:"embed_type"`
+	servers               []string `config:"Servers" default:"tcp://localhost:1883"`
+	streamToTopic         map[core.MessageStreamID]string
+	topicField            string        `config:"TopicFrom"`
+	qos                   int           `config:"QoS" default:"1"`
+	retained              bool          `config:"Retained" default:"false"`
+	clientID              string        `config:"ClientID"`
+	cleanSession          bool          `config:"CleanSession" default:"true"`
+	username              string        `config:"Username"`
+	password              string        `config:"Password"`
+	keepAlive             time.Duration `config:"KeepAliveSec" default:"30" metric:"sec"`
+	timeout               time.Duration `config:"TimeoutMs" default:"5000" metric:"ms"`
+	reconnectDelay        time.Duration `config:"ReconnectDelayMs" default:"500" metric:"ms"`
+	reconnectDelayMax     time.Duration `config:"ReconnectDelayMaxMs" default:"30000" metric:"ms"`
+	tlsConfig             *tls.Config
+	client                mqtt.Client
+}
+
+func init() {
+	core.TypeRegistry.Register(MQTT{})
+}
+
+// Configure initializes this producer with values from a plugin config.
+func (prod *MQTT) Configure(conf core.PluginConfigReader) {
+	prod.SetStopCallback(prod.close)
+	prod.streamToTopic = conf.GetStreamMap("StreamMapping", "")
+
+	if len(prod.servers) == 0 {
+		conf.Errors.Pushf("At least one server is required")
+	}
+	for _, server := range prod.servers {
+		if err := validateMQTTServer(server); err != nil {
+			conf.Errors.Pushf("Invalid server '%s': %s", server, err.Error())
+		}
+	}
+
+	if prod.qos < 0 || prod.qos > 2 {
+		conf.Errors.Pushf("QoS must be 0, 1 or 2")
+	}
+	if !prod.cleanSession && prod.clientID == "" {
+		conf.Errors.Pushf("ClientID is required if CleanSession is false")
+	}
+
+	prod.tlsConfig = &tls.Config{
+		ServerName:         conf.GetString("TlsServerName", ""),
+		InsecureSkipVerify: conf.GetBool("TlsInsecureSkipVerify", false),
+	}
+
+	cert, err := components.ReadTLSKeyPair(conf)
+	if !conf.Errors.Push(err) && cert != nil {
+		prod.tlsConfig.Certificates = []tls.Certificate{*cert}
+	}
+
+	caCertPool, err := components.ReadTLSCertPool(conf)
+	if !conf.Errors.Push(err) {
+		prod.tlsConfig.RootCAs = caCertPool
+	}
+}
+
+// validateMQTTServer returns an error if the given server URI cannot be used
+// to connect to an MQTT broker.
+func validateMQTTServer(server string) error {
+	uri, err := url.Parse(server)
+	if err != nil {
+		return err
+	}
+
+	switch uri.Scheme {
+	case "tcp", "mqtt", "ssl", "tls", "mqtts", "tcps", "ws", "wss":
+		return nil
+	default:
+		return fmt.Errorf("unsupported scheme '%s'", uri.Scheme)
+	}
+}
+
+// getTopic returns the topic a message should be published to.
+func (prod *MQTT) getTopic(msg *core.Message) string {
+	if prod.topicField != "" {
+		if value, exists := core.GetValuePath(msg.TryGetMetadata(), prod.topicField); exists {
+			if topic := string(core.ConvertToBytes(value)); topic != "" {
+				return topic
+			}
+		}
+	}
+
+	if topic, isMapped := prod.streamToTopic[msg.GetStreamID()]; isMapped {
+		return topic
+	}
+	if topic, isMapped := prod.streamToTopic[core.WildcardStreamID]; isMapped {
+		return topic
+	}
+	return core.StreamRegistry.GetStreamName(msg.GetStreamID())
+}
+
+// newClientOptions returns the options used to connect to the broker.
+func (prod *MQTT) newClientOptions() *mqtt.ClientOptions {
+	options := mqtt.NewClientOptions()
+	for _, server := range prod.servers {
+		options.AddBroker(server)
+	}
+
+	options.SetClientID(prod.clientID)
+	options.SetUsername(prod.username)
+	options.SetPassword(prod.password)
+	options.SetCleanSession(prod.cleanSession)
+	options.SetTLSConfig(prod.tlsConfig.Clone())
+	options.SetKeepAlive(prod.keepAlive)
+	options.SetConnectTimeout(prod.timeout)
+	options.SetWriteTimeout(prod.timeout)
+
+	options.SetConnectRetry(true)
+	options.SetConnectRetryInterval(prod.reconnectDelay)
+	options.SetAutoReconnect(true)
+	options.SetMaxReconnectInterval(prod.reconnectDelayMax)
+
+	options.SetConnectionLostHandler(func(client mqtt.Client, err error) {
+		prod.Logger.WithError(err).Warning("Connection lost, reconnecting")
+	})
+	return options
+}
+
+// publish sends the message to the broker and waits for the broker to
+// acknowledge it if QoS is 1 or 2. An error is returned if the message was
+// not accepted.
+func (prod *MQTT) publish(msg *core.Message) error {
+	// Messages published while reconnecting would be stored by the client
+	// and could be sent after they have been passed to the fallback.
+	if !prod.client.IsConnectionOpen() {
+		return fmt.Errorf("not connected")
+	}
+
+	token := prod.client.Publish(prod.getTopic(msg), byte(prod.qos), prod.retained, msg.GetPayload())
+	if prod.qos == 0 {
+		return nil // ### return, no acknowledgement required ###
+	}
+
+	if !token.WaitTimeout(prod.timeout) {
+		return fmt.Errorf("timeout while waiting for acknowledgement")
+	}
+	return token.Error()
+}
+
+func (prod *MQTT) sendMessage(msg *core.Message) {
+	if err := prod.publish(msg); err != nil {
+		prod.Logger.WithError(err).Error("Publish error")
+		prod.TryFallback(msg)
+	}
+}
+
+func (prod *MQTT) close() {
+	defer func() {
+		prod.client.Disconnect(uint(prod.timeout / time.Millisecond))
+		prod.WorkerDone()
+	}()
+	prod.DefaultClose()
+}
+
+// Produce publishes messages to the configured MQTT broker.
+func (prod *MQTT) Produce(workers *sync.WaitGroup) {
+	prod.client = mqtt.NewClient(prod.newClientOptions())
+	prod.AddMainWorker(workers)
+
+	// Failed connection attempts are retried until the producer is stopped
+	prod.client.Connect()
+	prod.MessageControlLoop(prod.sendMessage)
+}
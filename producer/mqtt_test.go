@@ -0,0 +1,218 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"gollum/core"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+// mockMQTTToken implements mqtt.Token
+type mockMQTTToken struct {
+	done chan struct{}
+	err  error
+}
+
+func newMockMQTTToken(completed bool, err error) *mockMQTTToken {
+	token := &mockMQTTToken{
+		done: make(chan struct{}),
+		err:  err,
+	}
+	if completed {
+		close(token.done)
+	}
+	return token
+}
+
+func (token *mockMQTTToken) Wait() bool {
+	<-token.done
+	return true
+}
+
+func (token *mockMQTTToken) WaitTimeout(timeout time.Duration) bool {
+	select {
+	case <-token.done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (token *mockMQTTToken) Done() <-chan struct{} {
+	return token.done
+}
+
+func (token *mockMQTTToken) Error() error {
+	return token.err
+}
+
+// mockMQTTClient records published messages. Methods not used by the
+// producer are not implemented.
+type mockMQTTClient struct {
+	mqtt.Client
+	connected bool
+	token     mqtt.Token
+	topics    []string
+	retained  []bool
+}
+
+func (client *mockMQTTClient) IsConnectionOpen() bool {
+	return client.connected
+}
+
+func (client *mockMQTTClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	client.topics = append(client.topics, topic)
+	client.retained = append(client.retained, retained)
+	return client.token
+}
+
+func TestMQTTTopic(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "producer.MQTT")
+	config.Override("TopicFrom", "mqtt/topic")
+	config.Override("StreamMapping", map[string]string{
+		t.Name() + "Mapped": "mapped/topic",
+	})
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*MQTT)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("message"), tcontainer.MarshalMap{
+		"mqtt": tcontainer.MarshalMap{"topic": "devices/1"},
+	}, core.GetStreamID(t.Name()+"Mapped"))
+	expect.Equal("devices/1", prod.getTopic(msg))
+
+	msg = core.NewMessage(nil, []byte("message"), tcontainer.MarshalMap{
+		"mqtt": tcontainer.MarshalMap{"topic": ""},
+	}, core.GetStreamID(t.Name()+"Mapped"))
+	expect.Equal("mapped/topic", prod.getTopic(msg))
+
+	msg = core.NewMessage(nil, []byte("message"), nil, core.GetStreamID(t.Name()+"Unmapped"))
+	expect.Equal(t.Name()+"Unmapped", prod.getTopic(msg))
+}
+
+func TestMQTTTopicWildcard(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "producer.MQTT")
+	config.Override("StreamMapping", map[string]string{
+		"*": "default/topic",
+	})
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*MQTT)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("message"), nil, core.GetStreamID(t.Name()))
+	expect.Equal("default/topic", prod.getTopic(msg))
+}
+
+func TestMQTTPublish(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	fallback := newMockRouter(t.Name() + "Fallback")
+
+	config := core.NewPluginConfig(t.Name(), "producer.MQTT")
+	config.Override("FallbackStream", t.Name()+"Fallback")
+	config.Override("Retained", true)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*MQTT)
+	expect.True(casted)
+
+	client := &mockMQTTClient{
+		connected: true,
+		token:     newMockMQTTToken(true, nil),
+	}
+	prod.client = client
+
+	prod.sendMessage(core.NewMessage(nil, []byte("message"), nil, core.GetStreamID(t.Name())))
+	expect.Equal([]string{t.Name()}, client.topics)
+	expect.Equal([]bool{true}, client.retained)
+	expect.Equal(0, len(fallback.messages))
+}
+
+func TestMQTTFallback(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	fallback := newMockRouter(t.Name() + "Fallback")
+
+	config := core.NewPluginConfig(t.Name(), "producer.MQTT")
+	config.Override("FallbackStream", t.Name()+"Fallback")
+	config.Override("TimeoutMs", 10)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*MQTT)
+	expect.True(casted)
+
+	client := &mockMQTTClient{}
+	prod.client = client
+
+	// Messages are not published while disconnected
+	prod.sendMessage(core.NewMessage(nil, []byte("disconnected"), nil, core.InvalidStreamID))
+	expect.Equal([]string{"disconnected"}, fallback.receive(t, 1))
+	expect.Equal(0, len(client.topics))
+
+	client.connected = true
+	client.token = newMockMQTTToken(false, nil)
+	prod.sendMessage(core.NewMessage(nil, []byte("timeout"), nil, core.InvalidStreamID))
+	expect.Equal([]string{"timeout"}, fallback.receive(t, 1))
+
+	client.token = newMockMQTTToken(true, fmt.Errorf("rejected"))
+	prod.sendMessage(core.NewMessage(nil, []byte("error"), nil, core.InvalidStreamID))
+	expect.Equal([]string{"error"}, fallback.receive(t, 1))
+
+	// Acknowledgements are not awaited for QoS 0
+	prod.qos = 0
+	client.token = newMockMQTTToken(false, nil)
+	prod.sendMessage(core.NewMessage(nil, []byte("qos0"), nil, core.InvalidStreamID))
+	expect.Equal(0, len(fallback.messages))
+	expect.Equal(3, len(client.topics))
+}
+
+func TestMQTTConfigErrors(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	for idx, settings := range []map[string]interface{}{
+		{"Servers": []string{}},
+		{"Servers": []string{"http://localhost"}},
+		{"QoS": -1},
+		{"CleanSession": false},
+	} {
+		config := core.NewPluginConfig(fmt.Sprintf("%s%d", t.Name(), idx), "producer.MQTT")
+		for key, value := range settings {
+			config.Override(key, value)
+		}
+		_, err := core.NewPluginWithConfig(config)
+		expect.NotNil(err)
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"runtime/debug"
 	"testing"
+	"time"
 
 	"gollum/core"
 	_ "gollum/filter"
@@ -47,3 +48,59 @@ func TestProducerInterface(t *testing.T) {
 		}
 	}
 }
+
+// mockRouter collects all messages enqueued to a stream
+type mockRouter struct {
+	streamID core.MessageStreamID
+	messages chan *core.Message
+}
+
+func newMockRouter(stream string) *mockRouter {
+	router := &mockRouter{
+		streamID: core.StreamRegistry.GetStreamID(stream),
+		messages: make(chan *core.Message, 16),
+	}
+	core.StreamRegistry.Register(router, router.streamID)
+	return router
+}
+
+func (router *mockRouter) Modulate(msg *core.Message) core.ModulateResult {
+	return core.ModulateResultContinue
+}
+
+func (router *mockRouter) GetStreamID() core.MessageStreamID {
+	return router.streamID
+}
+
+func (router *mockRouter) GetID() string {
+	return "mockRouter"
+}
+
+func (router *mockRouter) AddProducer(producers ...core.Producer) {
+}
+
+func (router *mockRouter) Enqueue(msg *core.Message) error {
+	router.messages <- msg
+	return nil
+}
+
+func (router *mockRouter) GetTimeout() time.Duration {
+	return time.Second
+}
+
+func (router *mockRouter) Start() error {
+	return nil
+}
+
+func (router *mockRouter) receive(t *testing.T, count int) []string {
+	payloads := []string{}
+	for i := 0; i < count; i++ {
+		select {
+		case msg := <-router.messages:
+			payloads = append(payloads, msg.String())
+		case <-time.After(time.Second):
+			t.Fatal("message was not received")
+		}
+	}
+	return payloads
+}
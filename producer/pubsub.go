@@ -0,0 +1,266 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gollum/core"
+	"gollum/core/components/pubsub"
+
+	cloudpubsub "cloud.google.com/go/pubsub"
+)
+
+// PubSub producer plugin
+//
+// This producer publishes messages to Google Cloud Pub/Sub topics. Messages
+// are collected in batches per topic by the Pub/Sub client library and
+// published asynchronously. Messages rejected by Pub/Sub are sent to the
+// fallback.
+//
+// If OrderingKeyFrom is set, messages with the same ordering key are
+// published in the order they were received. Once a message with a given
+// ordering key has failed, all following messages with this key that are
+// already waiting to be published are sent to the fallback, too, so that no
+// message is published after a preceding one has been lost. Note that Pub/Sub
+// only delivers messages in order if message ordering is enabled for the
+// subscription.
+//
+// Requests are authorized with the credentials file given by CredentialsFile.
+// If no file is set, application default credentials are used, i.e. the file
+// named by the GOOGLE_APPLICATION_CREDENTIALS environment variable, the
+// gcloud user credentials or the service account of the compute instance
+// gollum is running on. If the PUBSUB_EMULATOR_HOST environment variable is
+// set, the emulator is used without authentication.
+//
+// Parameters
+//
+// - StreamMapping: Defines a translation from gollum stream names to Pub/Sub
+// topics. Topics can be given as topic ID or as fully qualified name like
+// "projects/<project>/topics/<topic>". You can define the wildcard stream (*)
+// here, too. If a stream is not mapped, the stream name is used as topic.
+// By default this parameter is set to an empty list.
+//
+// - ProjectID: Defines the project of topics not given as fully qualified
+// name. If empty, the project of the credentials or the GOOGLE_CLOUD_PROJECT
+// environment variable is used.
+// By default this parameter is set to "".
+//
+// - CredentialsFile: Defines the path to a service account or authorized
+// user JSON key file. If empty, application default credentials are used.
+// By default this parameter is set to "".
+//
+// - Endpoint: Defines the address of the Pub/Sub gRPC API. If empty, the
+// public endpoint is used. Regional endpoints like
+// "europe-west1-pubsub.googleapis.com:443" are recommended when using
+// ordering keys. This setting is ignored when using the emulator.
+// By default this parameter is set to "".
+//
+// - AttributesFrom: Defines a map of Pub/Sub attribute names to metadata
+// fields. Nested fields can be addressed by a path like "request/host".
+// Attributes whose metadata field is not set are not sent.
+// By default this parameter is set to an empty map.
+//
+// - OrderingKeyFrom: Defines the metadata field to read the ordering key of
+// each message from. Nested fields can be addressed by a path like
+// "user/id". If the field is not set or empty, the message is published
+// without ordering key.
+// By default this parameter is set to "".
+//
+// - TimeoutMs: Defines the time in milliseconds after which a message that
+// could not be published is sent to the fallback.
+// By default this parameter is set to "10000".
+//
+// - Batch/FlushCount: Defines the number of messages to be buffered per
+// topic before they are published. Batches are split into multiple requests
+// if they exceed the request limits of Pub/Sub.
+// By default this parameter is set to "100".
+//
+// - Batch/TimeoutMs: Defines the maximum number of milliseconds to wait after
+// the first message of a batch arrived before the batch is published.
+// By default this parameter is set to "100".
+//
+// Examples
+//
+// This example publishes access logs to the topic "access-logs" of the
+// project "my-project". Each message carries the host as attribute and all
+// messages of a user are kept in order.
+//
+//  PubSubOut:
+//    Type: producer.PubSub
+//    Streams: access
+//    ProjectID: my-project
+//    CredentialsFile: /etc/gollum/pubsub-key.json
+//    Endpoint: europe-west1-pubsub.googleapis.com:443
+//    StreamMapping:
+//      access: access-logs
+//    AttributesFrom:
+//      host: request/host
+//    OrderingKeyFrom: user/id
+type PubSub struct {
+	core.BufferedProducer `gollumdoc:"embed_type"`
+	streamToTopic         map[core.MessageStreamID]string
+	attributeFields       map[string]string
+	projectID             string        `config:"ProjectID"`
+	credentialsFile       string        `config:"CredentialsFile"`
+	endpoint              string        `config:"Endpoint"`
+	orderingKeyField      string        `config:"OrderingKeyFrom"`
+	timeout               time.Duration `config:"TimeoutMs" default:"10000" metric:"ms"`
+	batchTimeout          time.Duration `config:"Batch/TimeoutMs" default:"100" metric:"ms"`
+	batchFlushCount       int           `config:"Batch/FlushCount" default:"100"`
+	client                *cloudpubsub.Client
+	topics                map[string]*cloudpubsub.Topic
+	topicGuard            *sync.Mutex
+}
+
+func init() {
+	core.TypeRegistry.Register(PubSub{})
+}
+
+// Configure initializes this producer with values from a plugin config.
+func (prod *PubSub) Configure(conf core.PluginConfigReader) {
+	prod.SetStopCallback(prod.close)
+	prod.EnableManualAck()
+	prod.streamToTopic = conf.GetStreamMap("StreamMapping", "")
+	prod.attributeFields = conf.GetStringMap("AttributesFrom", map[string]string{})
+	prod.topics = make(map[string]*cloudpubsub.Topic)
+	prod.topicGuard = new(sync.Mutex)
+
+	if prod.batchFlushCount < 1 {
+		conf.Errors.Pushf("Batch/FlushCount must be at least 1")
+	}
+
+	client, err := pubsub.NewClient(context.Background(), pubsub.Credentials{
+		ProjectID: prod.projectID,
+		File:      prod.credentialsFile,
+		Endpoint:  prod.endpoint,
+	})
+	if !conf.Errors.Push(err) {
+		prod.client = client
+	}
+}
+
+// getTopicName returns the name of the topic a message should be published
+// to.
+func (prod *PubSub) getTopicName(msg *core.Message) string {
+	if topic, isMapped := prod.streamToTopic[msg.GetStreamID()]; isMapped {
+		return topic
+	}
+	if topic, isMapped := prod.streamToTopic[core.WildcardStreamID]; isMapped {
+		return topic
+	}
+	return core.StreamRegistry.GetStreamName(msg.GetStreamID())
+}
+
+// getTopic returns the topic for the given name. Topics are created on first
+// use and kept until the producer is stopped.
+func (prod *PubSub) getTopic(name string) *cloudpubsub.Topic {
+	prod.topicGuard.Lock()
+	defer prod.topicGuard.Unlock()
+
+	if topic, exists := prod.topics[name]; exists {
+		return topic // ### return, known topic ###
+	}
+
+	var topic *cloudpubsub.Topic
+	if project, id := pubsub.SplitResourceName(name); project != "" {
+		topic = prod.client.TopicInProject(id, project)
+	} else {
+		topic = prod.client.Topic(id)
+	}
+
+	topic.PublishSettings.CountThreshold = prod.batchFlushCount
+	topic.PublishSettings.DelayThreshold = prod.batchTimeout
+	topic.PublishSettings.Timeout = prod.timeout
+	topic.EnableMessageOrdering = prod.orderingKeyField != ""
+
+	prod.topics[name] = topic
+	return topic
+}
+
+// newPubSubMessage returns the Pub/Sub message to publish for a message.
+func (prod *PubSub) newPubSubMessage(msg *core.Message) *cloudpubsub.Message {
+	pubsubMsg := &cloudpubsub.Message{
+		Data: msg.GetPayload(),
+	}
+
+	metadata := msg.TryGetMetadata()
+	if metadata == nil {
+		return pubsubMsg // ### return, no metadata ###
+	}
+
+	for name, field := range prod.attributeFields {
+		if value, exists := core.GetValuePath(metadata, field); exists {
+			if pubsubMsg.Attributes == nil {
+				pubsubMsg.Attributes = make(map[string]string, len(prod.attributeFields))
+			}
+			pubsubMsg.Attributes[name] = string(core.ConvertToBytes(value))
+		}
+	}
+
+	if prod.orderingKeyField != "" {
+		if value, exists := core.GetValuePath(metadata, prod.orderingKeyField); exists {
+			pubsubMsg.OrderingKey = string(core.ConvertToBytes(value))
+		}
+	}
+	return pubsubMsg
+}
+
+// sendMessage publishes a message. The message is sent to the fallback if
+// Pub/Sub rejects it.
+func (prod *PubSub) sendMessage(msg *core.Message) {
+	topic := prod.getTopic(prod.getTopicName(msg))
+	pubsubMsg := prod.newPubSubMessage(msg)
+	result := topic.Publish(context.Background(), pubsubMsg)
+
+	go func() {
+		defer prod.AckMessage(msg)
+		if _, err := result.Get(context.Background()); err != nil {
+			prod.GetErrorMetrics().CountSendFailure()
+			prod.Logger.WithError(err).Errorf("Failed to publish message to %s", topic)
+
+			// Publishing of a key is paused after a failure, so that all
+			// messages already queued for this key fail, too.
+			if pubsubMsg.OrderingKey != "" {
+				topic.ResumePublish(pubsubMsg.OrderingKey)
+			}
+			prod.TryFallback(msg)
+		}
+	}()
+}
+
+// close publishes all pending messages and waits for their results.
+func (prod *PubSub) close() {
+	defer prod.WorkerDone()
+	prod.DefaultClose()
+
+	prod.topicGuard.Lock()
+	defer prod.topicGuard.Unlock()
+
+	prod.RunBeforeDrainDeadline(func() {
+		for _, topic := range prod.topics {
+			topic.Stop()
+		}
+	})
+	prod.client.Close()
+}
+
+// Produce publishes messages to the configured Pub/Sub topics.
+func (prod *PubSub) Produce(workers *sync.WaitGroup) {
+	prod.AddMainWorker(workers)
+	prod.MessageControlLoop(prod.sendMessage)
+}
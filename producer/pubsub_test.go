@@ -0,0 +1,159 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"gollum/core"
+
+	cloudpubsub "cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+const pubsubTestProject = "gollum-test"
+
+// startPubSubTestServer starts an in-memory Pub/Sub server. The
+// PUBSUB_EMULATOR_HOST environment variable points to the server until the
+// returned function is called.
+func startPubSubTestServer() (*pstest.Server, func()) {
+	server := pstest.NewServer()
+	os.Setenv("PUBSUB_EMULATOR_HOST", server.Addr)
+
+	return server, func() {
+		os.Unsetenv("PUBSUB_EMULATOR_HOST")
+		server.Close()
+	}
+}
+
+func createPubSubTestTopic(t *testing.T, name string) {
+	expect := ttesting.NewExpect(t)
+
+	client, err := cloudpubsub.NewClient(context.Background(), pubsubTestProject)
+	expect.NoError(err)
+	defer client.Close()
+
+	_, err = client.CreateTopic(context.Background(), name)
+	expect.NoError(err)
+}
+
+func TestPubSubTopic(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	_, stopServer := startPubSubTestServer()
+	defer stopServer()
+
+	config := core.NewPluginConfig(t.Name(), "producer.PubSub")
+	config.Override("ProjectID", pubsubTestProject)
+	config.Override("StreamMapping", map[string]string{
+		t.Name() + "Mapped": "projects/gollum/topics/mapped",
+	})
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*PubSub)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("message"), nil, core.GetStreamID(t.Name()+"Mapped"))
+	expect.Equal("projects/gollum/topics/mapped", prod.getTopicName(msg))
+	expect.Equal("projects/gollum/topics/mapped", prod.getTopic(prod.getTopicName(msg)).String())
+
+	msg = core.NewMessage(nil, []byte("message"), nil, core.GetStreamID(t.Name()+"Unmapped"))
+	expect.Equal(t.Name()+"Unmapped", prod.getTopicName(msg))
+	expect.Equal("projects/"+pubsubTestProject+"/topics/"+t.Name()+"Unmapped", prod.getTopic(prod.getTopicName(msg)).String())
+}
+
+func TestPubSubPublish(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	server, stopServer := startPubSubTestServer()
+	defer stopServer()
+	createPubSubTestTopic(t, t.Name())
+
+	config := core.NewPluginConfig(t.Name(), "producer.PubSub")
+	config.Override("ProjectID", pubsubTestProject)
+	config.Override("OrderingKeyFrom", "user/id")
+	config.Override("AttributesFrom", map[string]string{
+		"host":   "request/host",
+		"status": "status",
+		"unset":  "unset",
+	})
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*PubSub)
+	expect.True(casted)
+
+	prod.sendMessage(core.NewMessage(nil, []byte("first"), tcontainer.MarshalMap{
+		"request": tcontainer.MarshalMap{"host": "web01"},
+		"status":  200,
+		"user":    tcontainer.MarshalMap{"id": "42"},
+	}, core.GetStreamID(t.Name())))
+	prod.sendMessage(core.NewMessage(nil, []byte("second"), nil, core.GetStreamID(t.Name())))
+	prod.getTopic(t.Name()).Flush()
+
+	messages := map[string]*pstest.Message{}
+	for _, msg := range server.Messages() {
+		messages[string(msg.Data)] = msg
+	}
+	expect.Equal(2, len(messages))
+
+	first, exists := messages["first"]
+	expect.True(exists)
+	expect.Equal(map[string]string{"host": "web01", "status": "200"}, first.Attributes)
+	expect.Equal("42", first.OrderingKey)
+
+	second, exists := messages["second"]
+	expect.True(exists)
+	expect.Equal(0, len(second.Attributes))
+	expect.Equal("", second.OrderingKey)
+}
+
+func TestPubSubFallback(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	server, stopServer := startPubSubTestServer()
+	defer stopServer()
+
+	fallback := newMockRouter(t.Name() + "Fallback")
+
+	config := core.NewPluginConfig(t.Name(), "producer.PubSub")
+	config.Override("ProjectID", pubsubTestProject)
+	config.Override("FallbackStream", t.Name()+"Fallback")
+	config.Override("OrderingKeyFrom", "key")
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*PubSub)
+	expect.True(casted)
+
+	// The topic does not exist, so publishing fails
+	prod.sendMessage(core.NewMessage(nil, []byte("fail"), tcontainer.MarshalMap{"key": "a"}, core.GetStreamID(t.Name())))
+	expect.Equal([]string{"fail"}, fallback.receive(t, 1))
+
+	// Publishing of the ordering key is resumed after the failure
+	createPubSubTestTopic(t, t.Name())
+	prod.sendMessage(core.NewMessage(nil, []byte("retry"), tcontainer.MarshalMap{"key": "a"}, core.GetStreamID(t.Name())))
+	prod.getTopic(t.Name()).Flush()
+
+	messages := server.Messages()
+	expect.Equal(1, len(messages))
+	expect.Equal("retry", string(messages[0].Data))
+	expect.Equal(0, len(fallback.messages))
+}
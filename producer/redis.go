@@ -48,8 +48,9 @@ import (
 // "list", "set", "sortedset", "string". By default this is set to "hash".
 //
 // - KeyFrom: Defines the name of the metadata field used as a key for messages
-// sent to redis. If the name is an empty string no key is sent. By default
-// this value is set to an empty string.
+// sent to redis. Nested fields can be addressed by a path like "user/id".
+// If the name is an empty string no key is sent. By default this value is set
+// to an empty string.
 //
 // - FieldFrom: Defines the name of the metadata field used as a field for messages
 // sent to redis. If the name is an empty string no key is sent. By default
@@ -103,15 +104,15 @@ func (prod *Redis) Configure(conf core.PluginConfigReader) {
 
 func (prod *Redis) getValueAndKey(msg *core.Message) (v, k []byte) {
 	meta := msg.GetMetadata()
-	key, _ := meta.Value(prod.key)
+	key, _ := core.GetValuePath(meta, prod.key)
 
 	return msg.GetPayload(), core.ConvertToBytes(key)
 }
 
 func (prod *Redis) getValueFieldAndKey(msg *core.Message) (v, f, k []byte) {
 	meta := msg.GetMetadata()
-	key, _ := meta.Value(prod.key)
-	field, _ := meta.Value(prod.field)
+	key, _ := core.GetValuePath(meta, prod.key)
+	field, _ := core.GetValuePath(meta, prod.field)
 
 	return msg.GetPayload(), core.ConvertToBytes(field), core.ConvertToBytes(key)
 }
@@ -20,6 +20,7 @@ import (
 	"time"
 
 	"gollum/core"
+	"gollum/core/components"
 
 	"github.com/trivago/tgo/tmath"
 	"github.com/trivago/tgo/tnet"
@@ -88,6 +89,9 @@ type Socket struct {
 	batchTimeout          time.Duration `config:"Batch/TimeoutSec" default:"5" metric:"sec"`
 	batchMaxCount         int           `config:"Batch/MaxCount" default:"8192"`
 	batchFlushCount       int           `config:"Batch/FlushCount" default:"4096"`
+
+	// Envelope is public to make EnvelopeConfig.Configure() callable (bug in treflect package)
+	Envelope components.EnvelopeConfig `gollumdoc:"embed_type"`
 }
 
 type bufferedConn interface {
@@ -121,6 +125,9 @@ func (prod *Socket) Configure(conf core.PluginConfigReader) {
 	prod.assembly = core.NewWriterAssembly(nil, prod.TryFallback, prod)
 	prod.assembly.SetValidator(prod.validate)
 	prod.assembly.SetErrorHandler(prod.onWriteError)
+	if prod.Envelope.IsEnabled() {
+		prod.assembly.SetEncoder(prod.Envelope.Encode)
+	}
 }
 
 func (prod *Socket) tryConnect() bool {
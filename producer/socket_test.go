@@ -0,0 +1,88 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestSocketEnvelope(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	expect.NoError(err)
+	defer listener.Close()
+
+	config := core.NewPluginConfig(t.Name(), "producer.Socket")
+	config.Override("Address", listener.Addr().String())
+	config.Override("Envelope/Format", "json")
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*Socket)
+	expect.True(casted)
+	defer prod.closeConnection()
+
+	msg := core.NewMessage(nil, []byte("hello"), tcontainer.MarshalMap{"host": "web01"}, core.InvalidStreamID)
+	prod.sendMessage(msg)
+	prod.sendBatch()
+
+	conn, err := listener.Accept()
+	expect.NoError(err)
+	defer conn.Close()
+	expect.NoError(conn.SetReadDeadline(time.Now().Add(time.Second)))
+
+	record, err := bufio.NewReader(conn).ReadString('\n')
+	expect.NoError(err)
+	expect.Equal(`{"metadata":{"host":"web01"},"payload":"hello"}`+"\n", record)
+
+	// The envelope is only created for writing
+	expect.Equal("hello", msg.String())
+}
+
+func TestSocketEnvelopeFallback(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	// Get an address nobody listens to
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	expect.NoError(err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	fallback := newMockRouter(t.Name() + "Fallback")
+	config := core.NewPluginConfig(t.Name(), "producer.Socket")
+	config.Override("Address", address)
+	config.Override("FallbackStream", t.Name()+"Fallback")
+	config.Override("Envelope/Format", "json")
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*Socket)
+	expect.True(casted)
+
+	prod.sendMessage(core.NewMessage(nil, []byte("hello"), tcontainer.MarshalMap{"host": "web01"}, core.InvalidStreamID))
+	prod.sendBatch()
+
+	// Messages that could not be written are passed on without envelope
+	expect.Equal([]string{"hello"}, fallback.receive(t, 1))
+}
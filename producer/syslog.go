@@ -0,0 +1,366 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tnet"
+)
+
+const (
+	syslogTimestampFormat = "2006-01-02T15:04:05.000000Z07:00"
+	syslogMaxHostnameLen  = 255
+	syslogMaxAppNameLen   = 48
+)
+
+var (
+	syslogFacilities = map[string]int{
+		"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+		"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+		"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+		"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+	}
+	syslogSeverities = map[string]int{
+		"emerg": 0, "alert": 1, "crit": 2, "err": 3, "error": 3,
+		"warning": 4, "warn": 4, "notice": 5, "info": 6, "debug": 7,
+	}
+)
+
+// Syslog producer plugin
+//
+// This producer sends messages to a syslog server. Each message is formatted
+// according to RFC5424 (https://tools.ietf.org/html/rfc5424) with the message
+// payload as MSG. Messages sent via TCP or TLS use octet-counting framing as
+// described in RFC6587 (https://tools.ietf.org/html/rfc6587). Messages sent
+// via UDP are sent as one datagram per message.
+// If a message cannot be sent, it is passed to the fallback and the
+// connection is reestablished with the next message. If connecting fails,
+// all messages are sent to the fallback until the next connection attempt,
+// which is delayed by an increasing backoff.
+//
+// Parameters
+//
+// - Address: Defines the protocol, host and port of the syslog server.
+// Valid protocols are "udp", "tcp" and "tls".
+// By default this parameter is set to "udp://localhost:514".
+//
+// - Facility: Defines the facility used for all messages. Can be a number
+// between 0 and 23 or a name like "user" or "local0".
+// By default this parameter is set to "user".
+//
+// - Severity: Defines the severity used for all messages. Can be a number
+// between 0 and 7 or a name like "err" or "info".
+// By default this parameter is set to "info".
+//
+// - AppName: Defines the APP-NAME used for all messages.
+// By default this parameter is set to "gollum".
+//
+// - Hostname: Defines the HOSTNAME used for all messages. If empty, the
+// name of the host gollum is running on is used.
+// By default this parameter is set to "".
+//
+// - FacilityFrom, SeverityFrom, AppNameFrom, HostnameFrom: Define a metadata
+// field to read the corresponding value from. If the field is not set or
+// invalid, the configured value is used. Nested fields can be addressed by a
+// path like "syslog/facility".
+// By default these parameters are set to "".
+//
+// - TimeoutMs: Defines the timeout in milliseconds for connecting and writing
+// to the server.
+// By default this parameter is set to "1000".
+//
+// - ReconnectDelayMs: Defines the delay in milliseconds before a failed
+// connection is reestablished. The delay is doubled with each failed attempt.
+// By default this parameter is set to "500".
+//
+// - ReconnectDelayMaxMs: Defines the maximum delay between two connection
+// attempts in milliseconds.
+// By default this parameter is set to "30000".
+//
+// - TlsCaLocation: Path to the CA certificate(s) used for verifying the
+// server's key when using "tls". If not set, the system's root certificates
+// are used.
+// By default this parameter is set to "".
+//
+// - TlsServerName: Used to verify the hostname on the server's certificate
+// unless TlsInsecureSkipVerify is true.
+// By default this parameter is set to "".
+//
+// - TlsInsecureSkipVerify: Disables server certificate chain and host name
+// verification.
+// By default this parameter is set to false.
+//
+// Examples
+//
+// This example forwards all messages to a syslog collector via TLS and uses
+// the metadata field "level" as severity.
+//
+//  SyslogOut:
+//    Type: producer.Syslog
+//    Streams: "*"
+//    Address: "tls://syslog.example.com:6514"
+//    Facility: local0
+//    AppName: myapp
+//    SeverityFrom: level
+type Syslog struct {
+	core.BufferedProducer `gollumdoc:"embed_type"`
+	protocol              string
+	address               string
+	facility              int
+	severity              int
+	appName               string        `config:"AppName" default:"gollum"`
+	hostname              string        `config:"Hostname"`
+	facilityField         string        `config:"FacilityFrom"`
+	severityField         string        `config:"SeverityFrom"`
+	appNameField          string        `config:"AppNameFrom"`
+	hostnameField         string        `config:"HostnameFrom"`
+	timeout               time.Duration `config:"TimeoutMs" default:"1000" metric:"ms"`
+	reconnectDelay        time.Duration `config:"ReconnectDelayMs" default:"500" metric:"ms"`
+	reconnectDelayMax     time.Duration `config:"ReconnectDelayMaxMs" default:"30000" metric:"ms"`
+	tlsConfig             *tls.Config
+	connection            net.Conn
+	nextReconnect         time.Time
+	currentDelay          time.Duration
+}
+
+func init() {
+	core.TypeRegistry.Register(Syslog{})
+}
+
+// Configure initializes this producer with values from a plugin config.
+func (prod *Syslog) Configure(conf core.PluginConfigReader) {
+	prod.SetStopCallback(prod.close)
+	prod.protocol, prod.address = tnet.ParseAddress(conf.GetString("Address", "udp://localhost:514"), "udp")
+
+	var ok bool
+	facility := conf.GetValue("Facility", "user")
+	if prod.facility, ok = parseSyslogValue(facility, syslogFacilities, 23); !ok {
+		conf.Errors.Pushf("Unknown facility: %v", facility)
+	}
+
+	severity := conf.GetValue("Severity", "info")
+	if prod.severity, ok = parseSyslogValue(severity, syslogSeverities, 7); !ok {
+		conf.Errors.Pushf("Unknown severity: %v", severity)
+	}
+
+	if prod.hostname == "" {
+		prod.hostname, _ = os.Hostname()
+	}
+
+	switch prod.protocol {
+	case "udp", "tcp":
+	case "tls":
+		prod.tlsConfig = &tls.Config{
+			ServerName:         conf.GetString("TlsServerName", ""),
+			InsecureSkipVerify: conf.GetBool("TlsInsecureSkipVerify", false),
+		}
+
+		if caFile := conf.GetString("TlsCaLocation", ""); caFile != "" {
+			caCert, err := ioutil.ReadFile(caFile)
+			if !conf.Errors.Push(err) {
+				prod.tlsConfig.RootCAs = x509.NewCertPool()
+				prod.tlsConfig.RootCAs.AppendCertsFromPEM(caCert)
+			}
+		}
+	default:
+		conf.Errors.Pushf("Unsupported protocol: %s", prod.protocol)
+	}
+}
+
+// parseSyslogValue converts a facility or severity given as name or number.
+func parseSyslogValue(value interface{}, names map[string]int, max int) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, v >= 0 && v <= max
+	case int64:
+		return int(v), v >= 0 && v <= int64(max)
+	case float64:
+		return int(v), v >= 0 && v <= float64(max) && v == float64(int(v))
+	}
+
+	name := strings.ToLower(string(core.ConvertToBytes(value)))
+	if number, err := strconv.Atoi(name); err == nil {
+		return number, number >= 0 && number <= max
+	}
+
+	number, known := names[name]
+	return number, known
+}
+
+// syslogHeaderValue returns value as a valid RFC5424 header field, i.e. a
+// string of printable ASCII characters without spaces. Empty values are
+// replaced by the NILVALUE "-".
+func syslogHeaderValue(value string, maxLen int) string {
+	cleaned := strings.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, value)
+
+	switch {
+	case len(cleaned) == 0:
+		return "-"
+	case len(cleaned) > maxLen:
+		return cleaned[:maxLen]
+	default:
+		return cleaned
+	}
+}
+
+func (prod *Syslog) getMetadataString(msg *core.Message, field string, defaultValue string) string {
+	if field == "" {
+		return defaultValue
+	}
+	if value, exists := core.GetValuePath(msg.TryGetMetadata(), field); exists {
+		if str := string(core.ConvertToBytes(value)); str != "" {
+			return str
+		}
+	}
+	return defaultValue
+}
+
+func (prod *Syslog) getMetadataCode(msg *core.Message, field string, names map[string]int, max int, defaultValue int) int {
+	if field == "" {
+		return defaultValue
+	}
+	if value, exists := core.GetValuePath(msg.TryGetMetadata(), field); exists {
+		if code, ok := parseSyslogValue(value, names, max); ok {
+			return code
+		}
+	}
+	return defaultValue
+}
+
+// format creates an RFC5424 syslog message from the given message.
+func (prod *Syslog) format(msg *core.Message) []byte {
+	facility := prod.getMetadataCode(msg, prod.facilityField, syslogFacilities, 23, prod.facility)
+	severity := prod.getMetadataCode(msg, prod.severityField, syslogSeverities, 7, prod.severity)
+	hostname := prod.getMetadataString(msg, prod.hostnameField, prod.hostname)
+	appName := prod.getMetadataString(msg, prod.appNameField, prod.appName)
+
+	buffer := bytes.NewBuffer(nil)
+	fmt.Fprintf(buffer, "<%d>1 %s %s %s - - - ",
+		facility*8+severity,
+		msg.GetCreationTime().Format(syslogTimestampFormat),
+		syslogHeaderValue(hostname, syslogMaxHostnameLen),
+		syslogHeaderValue(appName, syslogMaxAppNameLen))
+	buffer.Write(msg.GetPayload())
+
+	return buffer.Bytes()
+}
+
+// frame applies the framing required by the configured protocol.
+func (prod *Syslog) frame(data []byte) []byte {
+	if prod.protocol == "udp" {
+		return data
+	}
+	return append([]byte(strconv.Itoa(len(data))+" "), data...)
+}
+
+func (prod *Syslog) tryConnect() bool {
+	if prod.connection != nil {
+		return true // ### return, connection active ###
+	}
+
+	if time.Now().Before(prod.nextReconnect) {
+		return false // ### return, waiting for reconnect ###
+	}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+
+	switch prod.protocol {
+	case "tls":
+		dialer := &net.Dialer{Timeout: prod.timeout}
+		conn, err = tls.DialWithDialer(dialer, "tcp", prod.address, prod.tlsConfig)
+	default:
+		conn, err = net.DialTimeout(prod.protocol, prod.address, prod.timeout)
+	}
+
+	if err != nil {
+		prod.Logger.WithError(err).Error("Connection error")
+		prod.delayReconnect()
+		return false // ### return, connection failed ###
+	}
+
+	prod.connection = conn
+	prod.currentDelay = 0
+	return true
+}
+
+func (prod *Syslog) delayReconnect() {
+	switch {
+	case prod.currentDelay == 0:
+		prod.currentDelay = prod.reconnectDelay
+	case prod.currentDelay < prod.reconnectDelayMax:
+		prod.currentDelay *= 2
+	}
+
+	if prod.currentDelay > prod.reconnectDelayMax {
+		prod.currentDelay = prod.reconnectDelayMax
+	}
+	prod.nextReconnect = time.Now().Add(prod.currentDelay)
+}
+
+func (prod *Syslog) closeConnection() {
+	if prod.connection != nil {
+		prod.connection.Close()
+		prod.connection = nil
+	}
+}
+
+func (prod *Syslog) sendMessage(msg *core.Message) {
+	if !prod.tryConnect() {
+		prod.TryFallback(msg)
+		return // ### return, not connected ###
+	}
+
+	prod.connection.SetWriteDeadline(time.Now().Add(prod.timeout))
+	if _, err := prod.connection.Write(prod.frame(prod.format(msg))); err != nil {
+		prod.Logger.WithError(err).Error("Write error")
+		prod.closeConnection()
+		prod.TryFallback(msg)
+	}
+}
+
+func (prod *Syslog) close() {
+	defer func() {
+		prod.closeConnection()
+		prod.WorkerDone()
+	}()
+	prod.DefaultClose()
+}
+
+// Produce writes messages to the configured syslog server.
+func (prod *Syslog) Produce(workers *sync.WaitGroup) {
+	prod.AddMainWorker(workers)
+	prod.MessageControlLoop(prod.sendMessage)
+}
@@ -0,0 +1,230 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func syslogTimestamp(msg *core.Message) string {
+	return msg.GetCreationTime().Format(syslogTimestampFormat)
+}
+
+func TestSyslogFormat(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "producer.Syslog")
+	config.Override("Facility", "local0")
+	config.Override("Severity", 3)
+	config.Override("Hostname", "web01")
+	config.Override("AppName", "my app")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*Syslog)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("hello world"), nil, core.InvalidStreamID)
+	expected := fmt.Sprintf("<131>1 %s web01 my_app - - - hello world", syslogTimestamp(msg))
+	expect.Equal(expected, string(prod.format(msg)))
+}
+
+func TestSyslogFormatFromMetadata(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "producer.Syslog")
+	config.Override("Hostname", "web01")
+	config.Override("FacilityFrom", "syslog/facility")
+	config.Override("SeverityFrom", "level")
+	config.Override("AppNameFrom", "app")
+	config.Override("HostnameFrom", "host")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*Syslog)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("message"), tcontainer.MarshalMap{
+		"syslog": tcontainer.MarshalMap{"facility": "local7"},
+		"level":  "err",
+		"app":    "nginx",
+		"host":   "web02",
+	}, core.InvalidStreamID)
+	expected := fmt.Sprintf("<187>1 %s web02 nginx - - - message", syslogTimestamp(msg))
+	expect.Equal(expected, string(prod.format(msg)))
+
+	// Numeric values are accepted, invalid values fall back to the default
+	msg = core.NewMessage(nil, []byte("message"), tcontainer.MarshalMap{
+		"syslog": tcontainer.MarshalMap{"facility": 4},
+		"level":  "unknown",
+		"app":    "",
+	}, core.InvalidStreamID)
+	expected = fmt.Sprintf("<38>1 %s web01 gollum - - - message", syslogTimestamp(msg))
+	expect.Equal(expected, string(prod.format(msg)))
+}
+
+func TestSyslogConfigErrors(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	for idx, settings := range []map[string]interface{}{
+		{"Facility": "unknown"},
+		{"Facility": 24},
+		{"Severity": "8"},
+		{"Address": "unix:///dev/log"},
+	} {
+		config := core.NewPluginConfig(fmt.Sprintf("%s%d", t.Name(), idx), "producer.Syslog")
+		for key, value := range settings {
+			config.Override(key, value)
+		}
+		_, err := core.NewPluginWithConfig(config)
+		expect.NotNil(err)
+	}
+}
+
+func readOctetCountedFrame(reader *bufio.Reader) (string, error) {
+	length, err := reader.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	size, err := strconv.Atoi(strings.TrimSuffix(length, " "))
+	if err != nil {
+		return "", err
+	}
+	frame := make([]byte, size)
+	_, err = io.ReadFull(reader, frame)
+	return string(frame), err
+}
+
+func TestSyslogTCPFraming(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	expect.NoError(err)
+	defer listener.Close()
+
+	config := core.NewPluginConfig(t.Name(), "producer.Syslog")
+	config.Override("Address", "tcp://"+listener.Addr().String())
+	config.Override("Hostname", "web01")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*Syslog)
+	expect.True(casted)
+
+	defer prod.closeConnection()
+
+	messages := []*core.Message{
+		core.NewMessage(nil, []byte("first"), nil, core.InvalidStreamID),
+		core.NewMessage(nil, []byte("multi\nline 1 2"), nil, core.InvalidStreamID),
+	}
+	for _, msg := range messages {
+		prod.sendMessage(msg)
+	}
+
+	conn, err := listener.Accept()
+	expect.NoError(err)
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	reader := bufio.NewReader(conn)
+	for _, msg := range messages {
+		frame, err := readOctetCountedFrame(reader)
+		expect.NoError(err)
+		expect.Equal(string(prod.format(msg)), frame)
+	}
+}
+
+func TestSyslogUDP(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	expect.NoError(err)
+	defer server.Close()
+
+	config := core.NewPluginConfig(t.Name(), "producer.Syslog")
+	config.Override("Address", "udp://"+server.LocalAddr().String())
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*Syslog)
+	expect.True(casted)
+
+	defer prod.closeConnection()
+
+	msg := core.NewMessage(nil, []byte("datagram"), nil, core.InvalidStreamID)
+	prod.sendMessage(msg)
+
+	buffer := make([]byte, 1024)
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	size, _, err := server.ReadFrom(buffer)
+	expect.NoError(err)
+	expect.Equal(string(prod.format(msg)), string(buffer[:size]))
+}
+
+func TestSyslogFallbackAndBackoff(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	// Reserve a port nobody listens on
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	expect.NoError(err)
+	address := listener.Addr().String()
+	listener.Close()
+
+	fallback := newMockRouter(t.Name() + "Fallback")
+
+	config := core.NewPluginConfig(t.Name(), "producer.Syslog")
+	config.Override("Address", "tcp://"+address)
+	config.Override("FallbackStream", t.Name()+"Fallback")
+	config.Override("ReconnectDelayMs", 100)
+	config.Override("ReconnectDelayMaxMs", 300)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*Syslog)
+	expect.True(casted)
+
+	prod.sendMessage(core.NewMessage(nil, []byte("first"), nil, core.InvalidStreamID))
+	expect.Equal([]string{"first"}, fallback.receive(t, 1))
+	expect.Equal(int64(100*time.Millisecond), int64(prod.currentDelay))
+
+	// No connection attempt is made during backoff
+	nextReconnect := prod.nextReconnect
+	prod.sendMessage(core.NewMessage(nil, []byte("second"), nil, core.InvalidStreamID))
+	expect.Equal([]string{"second"}, fallback.receive(t, 1))
+	expect.Equal(nextReconnect, prod.nextReconnect)
+
+	// The delay is doubled with each failed attempt up to the maximum
+	prod.delayReconnect()
+	expect.Equal(int64(200*time.Millisecond), int64(prod.currentDelay))
+	prod.delayReconnect()
+	expect.Equal(int64(300*time.Millisecond), int64(prod.currentDelay))
+}
@@ -0,0 +1,284 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gollum/core"
+)
+
+// VictoriaMetrics producer
+//
+// This producer pushes batches of metrics to VictoriaMetrics or any other
+// endpoint accepting InfluxDB line protocol or VictoriaMetrics JSON lines
+// via HTTP (e.g. InfluxDB 2.x "/api/v2/write"). Messages are expected to
+// already contain one line of the selected format. Messages are joined by
+// newlines and sent as one request per batch. Batches exceeding the
+// configured request size are split into multiple requests.
+//
+// If the endpoint answers with 429 or 503 the "Retry-After" header is
+// respected before the request is retried. Messages of requests that finally
+// fail are sent to the fallback.
+//
+// Parameters
+//
+// - Address: Defines the URL to post batches to. If the value doesn't
+// contain "://", it is prepended with "http://".
+// By default this parameter is set to "http://localhost:8428/write".
+//
+// - Format: Defines the payload format. Can be "line" for InfluxDB line
+// protocol or "json" for the VictoriaMetrics JSON import format. This
+// setting controls the Content-Type header of each request.
+// By default this parameter is set to "line".
+//
+// - Token: When set, an "Authorization" header using TokenScheme and this
+// token is added to each request.
+// By default this parameter is set to "".
+//
+// - TokenScheme: Defines the authorization scheme used together with Token.
+// Set this to "Token" when writing to InfluxDB 2.x.
+// By default this parameter is set to "Bearer".
+//
+// - Compress: When set to true, request bodies are gzip compressed.
+// By default this parameter is set to false.
+//
+// - RequestMaxKB: Defines the maximum size of an uncompressed request body in
+// KB. Batches larger than this are split into multiple requests. Single
+// messages larger than this limit are sent to the fallback.
+// By default this parameter is set to "8192".
+//
+// - TimeoutSec: Defines the timeout for a single request in seconds.
+// By default this parameter is set to "10".
+//
+// - MaxRetries: Defines how often a request is retried when the endpoint
+// signals overload by returning 429 or 503.
+// By default this parameter is set to "3".
+//
+// - RetryMaxWaitSec: Defines the maximum number of seconds to wait for a
+// single retry, regardless of the Retry-After header sent by the endpoint.
+// By default this parameter is set to "30".
+//
+// Examples
+//
+//  metricsToVictoria:
+//    Type: producer.VictoriaMetrics
+//    Streams: metrics
+//    Address: "http://victoria:8428/write"
+//    Compress: true
+//    Token: "secret"
+//    Batch:
+//      MaxCount: 5000
+//      FlushCount: 1000
+//      TimeoutSec: 5
+type VictoriaMetrics struct {
+	core.BatchedProducer `gollumdoc:"embed_type"`
+
+	format       string        `config:"Format" default:"line"`
+	token        string        `config:"Token"`
+	tokenScheme  string        `config:"TokenScheme" default:"Bearer"`
+	compress     bool          `config:"Compress" default:"false"`
+	requestMax   int64         `config:"RequestMaxKB" default:"8192" metric:"kb"`
+	timeout      time.Duration `config:"TimeoutSec" default:"10" metric:"sec"`
+	maxRetries   int           `config:"MaxRetries" default:"3"`
+	retryMaxWait time.Duration `config:"RetryMaxWaitSec" default:"30" metric:"sec"`
+
+	address     string
+	contentType string
+	client      *http.Client
+}
+
+func init() {
+	core.TypeRegistry.Register(VictoriaMetrics{})
+}
+
+// Configure initializes this producer with values from a plugin config.
+func (prod *VictoriaMetrics) Configure(conf core.PluginConfigReader) {
+	prod.address = conf.GetString("Address", "http://localhost:8428/write")
+	if !strings.Contains(prod.address, "://") {
+		prod.address = "http://" + prod.address
+	}
+
+	switch strings.ToLower(prod.format) {
+	case "line":
+		prod.contentType = "text/plain; charset=utf-8"
+	case "json":
+		prod.contentType = "application/json"
+	default:
+		conf.Errors.Pushf("Unknown format '%s'. Expected 'line' or 'json'", prod.format)
+	}
+
+	prod.client = &http.Client{Timeout: prod.timeout}
+}
+
+// splitBatch splits a list of messages into chunks that do not exceed the
+// configured request size. Messages that don't fit into a request on their
+// own are sent to the fallback.
+func (prod *VictoriaMetrics) splitBatch(messages []*core.Message) [][]*core.Message {
+	chunks := [][]*core.Message{}
+	chunk := []*core.Message{}
+	chunkSize := int64(0)
+
+	for _, msg := range messages {
+		msgSize := int64(len(msg.GetPayload()) + 1) // +1 for the newline
+		if msgSize > prod.requestMax {
+			prod.Logger.Warningf("Message of %d bytes exceeds request limit of %d bytes", msgSize, prod.requestMax)
+			prod.TryFallback(msg)
+			continue
+		}
+
+		if chunkSize+msgSize > prod.requestMax {
+			chunks = append(chunks, chunk)
+			chunk = []*core.Message{}
+			chunkSize = 0
+		}
+
+		chunk = append(chunk, msg)
+		chunkSize += msgSize
+	}
+
+	if len(chunk) > 0 {
+		chunks = append(chunks, chunk)
+	}
+	return chunks
+}
+
+// encode joins all messages by newline and compresses the result if
+// required.
+func (prod *VictoriaMetrics) encode(messages []*core.Message) ([]byte, error) {
+	body := bytes.Buffer{}
+	var writer io.Writer = &body
+
+	var gzipWriter *gzip.Writer
+	if prod.compress {
+		gzipWriter = gzip.NewWriter(&body)
+		writer = gzipWriter
+	}
+
+	for _, msg := range messages {
+		payload := msg.GetPayload()
+		if _, err := writer.Write(payload); err != nil {
+			return nil, err
+		}
+		if len(payload) == 0 || payload[len(payload)-1] != '\n' {
+			if _, err := writer.Write([]byte{'\n'}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if gzipWriter != nil {
+		if err := gzipWriter.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return body.Bytes(), nil
+}
+
+// post sends a single request body and retries as long as the endpoint
+// signals overload and the retry limit has not been reached.
+func (prod *VictoriaMetrics) post(body []byte) error {
+	for retry := 0; ; retry++ {
+		req, err := http.NewRequest("POST", prod.address, bytes.NewReader(body))
+		if err != nil {
+			return err // ### return, malformed request ###
+		}
+
+		req.Header.Set("Content-Type", prod.contentType)
+		if prod.compress {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+		if prod.token != "" {
+			req.Header.Set("Authorization", prod.tokenScheme+" "+prod.token)
+		}
+
+		resp, err := prod.client.Do(req)
+		if err != nil {
+			return err // ### return, connection error ###
+		}
+
+		code, respBody, _ := httpRequestWrapper(resp, nil)
+		resp.Body.Close()
+
+		switch {
+		case code >= 200 && code < 300:
+			return nil // ### return, success ###
+
+		case code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable:
+			if retry >= prod.maxRetries {
+				return fmt.Errorf("%d %s (giving up after %d retries)", code, respBody, retry)
+			}
+			wait := prod.getRetryAfter(resp.Header.Get("Retry-After"))
+			prod.Logger.Warningf("Endpoint returned %d, retrying in %s", code, wait)
+			time.Sleep(wait)
+
+		default:
+			return fmt.Errorf("%d %s", code, respBody)
+		}
+	}
+}
+
+// getRetryAfter parses the value of a Retry-After header which can be either
+// a number of seconds or a HTTP date. The result is capped by RetryMaxWaitSec.
+func (prod *VictoriaMetrics) getRetryAfter(value string) time.Duration {
+	wait := time.Second
+	if seconds, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if date, err := http.ParseTime(value); err == nil {
+		wait = time.Until(date)
+	}
+
+	switch {
+	case wait < 0:
+		return 0
+	case wait > prod.retryMaxWait:
+		return prod.retryMaxWait
+	}
+	return wait
+}
+
+// sendMessages is an AssemblyFunc that posts all messages of a batch.
+func (prod *VictoriaMetrics) sendMessages(messages []*core.Message) {
+	for _, chunk := range prod.splitBatch(messages) {
+		body, err := prod.encode(chunk)
+		if err == nil {
+			err = prod.post(body)
+		}
+
+		if err != nil {
+			prod.Logger.WithError(err).Errorf("Failed to send %d messages", len(chunk))
+			for _, msg := range chunk {
+				prod.TryFallback(msg)
+			}
+		}
+	}
+}
+
+func (prod *VictoriaMetrics) sendBatch() core.AssemblyFunc {
+	return prod.sendMessages
+}
+
+// Produce starts a batched producer posting collected messages on flush.
+func (prod *VictoriaMetrics) Produce(workers *sync.WaitGroup) {
+	prod.BatchMessageLoop(workers, prod.sendBatch)
+}
@@ -0,0 +1,199 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+type victoriaMetricsStub struct {
+	guard    sync.Mutex
+	bodies   []string
+	headers  []http.Header
+	failures int
+}
+
+func (stub *victoriaMetricsStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	stub.guard.Lock()
+	defer stub.guard.Unlock()
+
+	if stub.failures > 0 {
+		stub.failures--
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+
+	reader := r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gzipReader, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		reader = gzipReader
+	}
+
+	body, _ := ioutil.ReadAll(reader)
+	stub.bodies = append(stub.bodies, string(body))
+	stub.headers = append(stub.headers, r.Header)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newVictoriaMetricsTestMessages(lines ...string) []*core.Message {
+	messages := make([]*core.Message, 0, len(lines))
+	for _, line := range lines {
+		messages = append(messages, core.NewMessage(nil, []byte(line), nil, core.InvalidStreamID))
+	}
+	return messages
+}
+
+func TestVictoriaMetricsCompressionAndAuth(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	stub := &victoriaMetricsStub{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	config := core.NewPluginConfig(t.Name(), "producer.VictoriaMetrics")
+	config.Override("Address", server.URL)
+	config.Override("Compress", true)
+	config.Override("Token", "secret")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*VictoriaMetrics)
+	expect.True(casted)
+
+	prod.sendMessages(newVictoriaMetricsTestMessages("cpu value=1", "cpu value=2"))
+
+	expect.Equal(1, len(stub.bodies))
+	expect.Equal("cpu value=1\ncpu value=2\n", stub.bodies[0])
+	expect.Equal("gzip", stub.headers[0].Get("Content-Encoding"))
+	expect.Equal("Bearer secret", stub.headers[0].Get("Authorization"))
+	expect.Equal("text/plain; charset=utf-8", stub.headers[0].Get("Content-Type"))
+}
+
+func TestVictoriaMetricsTokenScheme(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	stub := &victoriaMetricsStub{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	config := core.NewPluginConfig(t.Name(), "producer.VictoriaMetrics")
+	config.Override("Address", server.URL)
+	config.Override("Token", "secret")
+	config.Override("TokenScheme", "Token")
+	config.Override("Format", "json")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*VictoriaMetrics)
+	expect.True(casted)
+
+	prod.sendMessages(newVictoriaMetricsTestMessages(`{"metric":{"__name__":"cpu"},"values":[1],"timestamps":[1]}`))
+
+	expect.Equal(1, len(stub.bodies))
+	expect.Equal("", stub.headers[0].Get("Content-Encoding"))
+	expect.Equal("Token secret", stub.headers[0].Get("Authorization"))
+	expect.Equal("application/json", stub.headers[0].Get("Content-Type"))
+}
+
+func TestVictoriaMetricsBatchSplitting(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	stub := &victoriaMetricsStub{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	config := core.NewPluginConfig(t.Name(), "producer.VictoriaMetrics")
+	config.Override("Address", server.URL)
+	config.Override("RequestMaxKB", 1)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*VictoriaMetrics)
+	expect.True(casted)
+
+	line := strings.Repeat("x", 399)
+	prod.sendMessages(newVictoriaMetricsTestMessages(line, line, line, line, line))
+
+	// 400 bytes per line (incl. newline), 1024 bytes per request
+	expect.Equal(3, len(stub.bodies))
+	expect.Equal(800, len(stub.bodies[0]))
+	expect.Equal(800, len(stub.bodies[1]))
+	expect.Equal(400, len(stub.bodies[2]))
+}
+
+func TestVictoriaMetricsOversizedMessage(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	stub := &victoriaMetricsStub{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	config := core.NewPluginConfig(t.Name(), "producer.VictoriaMetrics")
+	config.Override("Address", server.URL)
+	config.Override("RequestMaxKB", 1)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*VictoriaMetrics)
+	expect.True(casted)
+
+	chunks := prod.splitBatch(newVictoriaMetricsTestMessages("small", strings.Repeat("x", 2048), "small"))
+	expect.Equal(1, len(chunks))
+	expect.Equal(2, len(chunks[0]))
+}
+
+func TestVictoriaMetricsRetryAfter(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	stub := &victoriaMetricsStub{failures: 2}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	config := core.NewPluginConfig(t.Name(), "producer.VictoriaMetrics")
+	config.Override("Address", server.URL)
+	config.Override("MaxRetries", 2)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*VictoriaMetrics)
+	expect.True(casted)
+
+	expect.NoError(prod.post([]byte("cpu value=1\n")))
+	expect.Equal(1, len(stub.bodies))
+
+	stub.failures = 3
+	expect.NotNil(prod.post([]byte("cpu value=1\n")))
+	expect.Equal(1, len(stub.bodies))
+}
@@ -0,0 +1,294 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+)
+
+// Webhook producer
+//
+// This producer posts a JSON body rendered from a go template to a webhook
+// URL for each message, e.g. to send alerts to Slack or Mattermost.
+//
+// To avoid flooding the receiver when many messages arrive at once,
+// notifications are deduplicated and rate limited. A message is suppressed
+// if a message with the same key has been sent within DedupWindowSec or if
+// RateLimit notifications have been sent within the last minute. The number
+// of messages suppressed since the last notification is passed to the next
+// notification sent. If a notification cannot be sent, the message is passed
+// to the fallback and the suppressed messages are counted again.
+//
+// The template can use the fields .Payload, .Stream, .Metadata, .Suppressed
+// and .Text. Text contains the payload followed by the number of suppressed
+// messages, if any. The template function "json" encodes a value as JSON
+// string, which should be used for all values inserted into the body.
+//
+// Parameters
+//
+// - URL: Defines the URL to post notifications to. If the value doesn't
+// contain "://", it is prepended with "http://".
+// By default this parameter is set to "http://localhost:80".
+//
+// - Template: Defines the go template used to render the request body.
+// By default this parameter is set to "{\"text\":{{json .Text}}}".
+//
+// - RateLimit: Defines the maximum number of notifications sent per minute.
+// Set to 0 to disable rate limiting.
+// By default this parameter is set to "10".
+//
+// - DedupWindowSec: Defines the number of seconds in which a message with the
+// same key as a previously sent message is suppressed. Set to 0 to disable
+// deduplication.
+// By default this parameter is set to "60".
+//
+// - DedupKeyFrom: Defines the metadata field used as deduplication key. When
+// left empty, the payload is used.
+// By default this parameter is set to "".
+//
+// - AuthHeader: When set, this value is sent as AuthHeaderName header with
+// each request, e.g. "Bearer <token>".
+// By default this parameter is set to "".
+//
+// - AuthHeaderName: Defines the name of the header used for AuthHeader.
+// By default this parameter is set to "Authorization".
+//
+// - TimeoutSec: Defines the timeout for a single request in seconds.
+// By default this parameter is set to "10".
+//
+// Examples
+//
+// This example sends error logs to a Slack channel. Repeating errors are
+// sent at most once every 5 minutes and no more than 5 notifications are
+// sent per minute.
+//
+//  slackAlerts:
+//    Type: producer.Webhook
+//    Streams: errors
+//    URL: "https://hooks.slack.com/services/T000/B000/XXXX"
+//    Template: '{"text":{{json .Text}},"username":"gollum"}'
+//    RateLimit: 5
+//    DedupWindowSec: 300
+type Webhook struct {
+	core.BufferedProducer `gollumdoc:"embed_type"`
+	rateLimit             int           `config:"RateLimit" default:"10"`
+	dedupWindow           time.Duration `config:"DedupWindowSec" default:"60" metric:"sec"`
+	dedupKeyFrom          string        `config:"DedupKeyFrom"`
+	authHeader            string        `config:"AuthHeader"`
+	authHeaderName        string        `config:"AuthHeaderName" default:"Authorization"`
+	timeout               time.Duration `config:"TimeoutSec" default:"10" metric:"sec"`
+	address               string
+	template              *template.Template
+	client                *http.Client
+	tokens                float64
+	lastRefill            time.Time
+	lastSent              map[string]time.Time
+	lastCleanup           time.Time
+	suppressed            int
+	now                   func() time.Time
+}
+
+// webhookEvent defines the fields available in Webhook templates.
+type webhookEvent struct {
+	Payload    string
+	Stream     string
+	Metadata   tcontainer.MarshalMap
+	Suppressed int
+	Text       string
+}
+
+func init() {
+	core.TypeRegistry.Register(Webhook{})
+}
+
+// Configure initializes this producer with values from a plugin config.
+func (prod *Webhook) Configure(conf core.PluginConfigReader) {
+	prod.address = conf.GetString("URL", "http://localhost:80")
+	if !strings.Contains(prod.address, "://") {
+		prod.address = "http://" + prod.address
+	}
+
+	var err error
+	tpl := conf.GetString("Template", `{"text":{{json .Text}}}`)
+	prod.template, err = template.New("Webhook").Funcs(template.FuncMap{
+		"json": webhookJSON,
+	}).Parse(tpl)
+	conf.Errors.Push(err)
+
+	if prod.rateLimit < 0 {
+		conf.Errors.Pushf("RateLimit must not be negative")
+	}
+
+	prod.client = &http.Client{Timeout: prod.timeout}
+	prod.lastSent = make(map[string]time.Time)
+	prod.now = time.Now
+	prod.lastRefill = prod.now()
+	prod.lastCleanup = prod.lastRefill
+	prod.tokens = float64(prod.rateLimit)
+}
+
+// webhookJSON encodes the given value as JSON for use in templates.
+func webhookJSON(value interface{}) (string, error) {
+	if data, isBytes := value.([]byte); isBytes {
+		value = string(data)
+	}
+	encoded, err := json.Marshal(value)
+	return string(encoded), err
+}
+
+func (prod *Webhook) getDedupKey(msg *core.Message) string {
+	if prod.dedupKeyFrom == "" {
+		return msg.String()
+	}
+
+	metadata := msg.TryGetMetadata()
+	if metadata == nil {
+		return ""
+	}
+	key, _ := metadata.String(prod.dedupKeyFrom)
+	return key
+}
+
+// isDuplicate returns true if a notification with the given key has been
+// sent within DedupWindowSec.
+func (prod *Webhook) isDuplicate(key string, now time.Time) bool {
+	if prod.dedupWindow <= 0 {
+		return false
+	}
+
+	if now.Sub(prod.lastCleanup) > prod.dedupWindow {
+		for sentKey, sent := range prod.lastSent {
+			if now.Sub(sent) >= prod.dedupWindow {
+				delete(prod.lastSent, sentKey)
+			}
+		}
+		prod.lastCleanup = now
+	}
+
+	sent, exists := prod.lastSent[key]
+	return exists && now.Sub(sent) < prod.dedupWindow
+}
+
+// takeToken refills the token bucket and removes one token from it. If no
+// token is available false is returned.
+func (prod *Webhook) takeToken(now time.Time) bool {
+	if prod.rateLimit == 0 {
+		return true
+	}
+
+	limit := float64(prod.rateLimit)
+	prod.tokens += now.Sub(prod.lastRefill).Minutes() * limit
+	if prod.tokens > limit {
+		prod.tokens = limit
+	}
+	prod.lastRefill = now
+
+	if prod.tokens < 1 {
+		return false
+	}
+	prod.tokens--
+	return true
+}
+
+// getNotification returns the event to be sent for the given message or nil
+// if the message is suppressed. The suppressed messages are passed to the
+// returned event.
+func (prod *Webhook) getNotification(msg *core.Message) *webhookEvent {
+	now := prod.now()
+	key := prod.getDedupKey(msg)
+
+	if prod.isDuplicate(key, now) || !prod.takeToken(now) {
+		prod.suppressed++
+		return nil // ### return, suppressed ###
+	}
+
+	if prod.dedupWindow > 0 {
+		prod.lastSent[key] = now
+	}
+
+	event := &webhookEvent{
+		Payload:    msg.String(),
+		Stream:     msg.GetStreamID().GetName(),
+		Metadata:   msg.TryGetMetadata(),
+		Suppressed: prod.suppressed,
+		Text:       msg.String(),
+	}
+	if event.Suppressed > 0 {
+		event.Text += fmt.Sprintf(" (%d more messages suppressed)", event.Suppressed)
+	}
+	prod.suppressed = 0
+	return event
+}
+
+// post renders the given event and sends it to the webhook.
+func (prod *Webhook) post(event *webhookEvent) error {
+	body := bytes.Buffer{}
+	if err := prod.template.Execute(&body, event); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", prod.address, &body)
+	if err != nil {
+		return err // ### return, malformed request ###
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if prod.authHeader != "" {
+		req.Header.Set(prod.authHeaderName, prod.authHeader)
+	}
+
+	resp, err := prod.client.Do(req)
+	if err != nil {
+		return err // ### return, connection error ###
+	}
+	defer resp.Body.Close()
+
+	if code, respBody, _ := httpRequestWrapper(resp, nil); code < 200 || code >= 300 {
+		return fmt.Errorf("%d %s", code, respBody)
+	}
+	return nil
+}
+
+func (prod *Webhook) sendMessage(msg *core.Message) {
+	event := prod.getNotification(msg)
+	if event == nil {
+		return // ### return, suppressed ###
+	}
+
+	if err := prod.post(event); err != nil {
+		prod.Logger.WithError(err).Error("Failed to send notification")
+		prod.suppressed += event.Suppressed
+		prod.TryFallback(msg)
+	}
+}
+
+// Produce posts notifications for all messages.
+func (prod *Webhook) Produce(workers *sync.WaitGroup) {
+	defer prod.WorkerDone()
+
+	prod.AddMainWorker(workers)
+	prod.MessageControlLoop(prod.sendMessage)
+}
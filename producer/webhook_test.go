@@ -0,0 +1,211 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package producer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+type webhookStub struct {
+	bodies  []string
+	headers []http.Header
+	status  int
+}
+
+func (stub *webhookStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	stub.bodies = append(stub.bodies, string(body))
+	stub.headers = append(stub.headers, r.Header)
+	if stub.status != 0 {
+		w.WriteHeader(stub.status)
+	}
+}
+
+func newWebhookTestMessage(payload string) *core.Message {
+	return core.NewMessage(nil, []byte(payload), nil, core.InvalidStreamID)
+}
+
+func TestWebhookDedup(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "producer.Webhook")
+	config.Override("RateLimit", 0)
+	config.Override("DedupWindowSec", 60)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*Webhook)
+	expect.True(casted)
+
+	now := time.Date(2018, 3, 5, 12, 0, 0, 0, time.UTC)
+	prod.now = func() time.Time { return now }
+	prod.lastRefill = now
+	prod.lastCleanup = now
+
+	expect.NotNil(prod.getNotification(newWebhookTestMessage("disk full")))
+	expect.Nil(prod.getNotification(newWebhookTestMessage("disk full")))
+	expect.Nil(prod.getNotification(newWebhookTestMessage("disk full")))
+
+	// Other messages are not affected and report the suppressed messages
+	event := prod.getNotification(newWebhookTestMessage("out of memory"))
+	expect.NotNil(event)
+	expect.Equal(2, event.Suppressed)
+	expect.Equal("out of memory (2 more messages suppressed)", event.Text)
+
+	now = now.Add(59 * time.Second)
+	expect.Nil(prod.getNotification(newWebhookTestMessage("disk full")))
+
+	now = now.Add(time.Second)
+	event = prod.getNotification(newWebhookTestMessage("disk full"))
+	expect.NotNil(event)
+	expect.Equal(1, event.Suppressed)
+	expect.Equal("disk full", event.Payload)
+
+	// The window starts again with each notification sent
+	event = prod.getNotification(newWebhookTestMessage("out of memory"))
+	expect.NotNil(event)
+	expect.Equal(0, event.Suppressed)
+	expect.Equal("out of memory", event.Text)
+}
+
+func TestWebhookDedupKeyFrom(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "producer.Webhook")
+	config.Override("RateLimit", 0)
+	config.Override("DedupKeyFrom", "host")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*Webhook)
+	expect.True(casted)
+
+	msg := newWebhookTestMessage("error at 12:00")
+	msg.GetMetadata().Set("host", "web01")
+	expect.NotNil(prod.getNotification(msg))
+
+	msg = newWebhookTestMessage("error at 12:01")
+	msg.GetMetadata().Set("host", "web01")
+	expect.Nil(prod.getNotification(msg))
+
+	msg = newWebhookTestMessage("error at 12:01")
+	msg.GetMetadata().Set("host", "web02")
+	expect.NotNil(prod.getNotification(msg))
+}
+
+func TestWebhookRateLimit(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig(t.Name(), "producer.Webhook")
+	config.Override("RateLimit", 2)
+	config.Override("DedupWindowSec", 0)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*Webhook)
+	expect.True(casted)
+
+	now := time.Date(2018, 3, 5, 12, 0, 0, 0, time.UTC)
+	prod.now = func() time.Time { return now }
+	prod.lastRefill = now
+	prod.lastCleanup = now
+
+	expect.NotNil(prod.getNotification(newWebhookTestMessage("a")))
+	expect.NotNil(prod.getNotification(newWebhookTestMessage("b")))
+	for _, payload := range []string{"c", "d", "e"} {
+		expect.Nil(prod.getNotification(newWebhookTestMessage(payload)))
+	}
+
+	// A token is refilled every 30 seconds
+	now = now.Add(29 * time.Second)
+	expect.Nil(prod.getNotification(newWebhookTestMessage("f")))
+
+	now = now.Add(time.Second)
+	event := prod.getNotification(newWebhookTestMessage("g"))
+	expect.NotNil(event)
+	expect.Equal(4, event.Suppressed)
+	expect.Equal("g (4 more messages suppressed)", event.Text)
+	expect.Nil(prod.getNotification(newWebhookTestMessage("h")))
+
+	// Tokens don't exceed the limit after being idle
+	now = now.Add(time.Hour)
+	expect.NotNil(prod.getNotification(newWebhookTestMessage("i")))
+	expect.NotNil(prod.getNotification(newWebhookTestMessage("j")))
+	expect.Nil(prod.getNotification(newWebhookTestMessage("k")))
+}
+
+func TestWebhookSend(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	stub := &webhookStub{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	config := core.NewPluginConfig(t.Name(), "producer.Webhook")
+	config.Override("URL", server.URL)
+	config.Override("AuthHeader", "Bearer secret")
+	config.Override("Template", `{"text":{{json .Text}},"host":{{json .Metadata.host}},"count":{{.Suppressed}}}`)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	prod, casted := plugin.(*Webhook)
+	expect.True(casted)
+
+	msg := newWebhookTestMessage("quote \" and\nnewline")
+	msg.GetMetadata().Set("host", []byte("web01"))
+	prod.sendMessage(msg)
+	prod.sendMessage(newWebhookTestMessage("quote \" and\nnewline"))
+
+	expect.Equal(1, len(stub.bodies))
+	expect.Equal("Bearer secret", stub.headers[0].Get("Authorization"))
+	expect.Equal("application/json", stub.headers[0].Get("Content-Type"))
+
+	body := tcontainer.MarshalMap{}
+	expect.NoError(json.Unmarshal([]byte(stub.bodies[0]), &body))
+	expect.MapEqual(body, "text", "quote \" and\nnewline")
+	expect.MapEqual(body, "host", "web01")
+
+	// Suppressed messages are counted again if sending fails
+	stub.status = http.StatusInternalServerError
+	prod.sendMessage(newWebhookTestMessage("failing"))
+	expect.Equal(2, len(stub.bodies))
+	expect.Equal(1, prod.suppressed)
+
+	stub.status = 0
+	prod.sendMessage(newWebhookTestMessage("working"))
+	expect.Equal(3, len(stub.bodies))
+	expect.NoError(json.Unmarshal([]byte(stub.bodies[2]), &body))
+	expect.MapEqual(body, "text", "working (1 more messages suppressed)")
+	expect.Equal(0, prod.suppressed)
+
+	config = core.NewPluginConfig("", "producer.Webhook")
+	config.Override("Template", "{{")
+	_, err = core.NewPluginWithConfig(config)
+	expect.NotNil(err)
+}
@@ -0,0 +1,153 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+
+	"gollum/core"
+)
+
+// consistentHashReplicas is the number of points per weight on the hash ring
+const consistentHashReplicas = 128
+
+// ConsistentHash router plugin
+//
+// The "ConsistentHash" router relays each message sent to the stream [Stream]
+// to exactly one of the streams listed in [TargetStreams]. The target is
+// chosen by hashing a metadata field or the payload onto a hash ring, so all
+// messages sharing the same key are routed to the same stream. Adding or
+// removing a target stream only moves the keys of that stream.
+//
+// Parameters
+//
+// - TargetStreams: Either a list of streams or a map of stream names to
+// integer weights. A stream with weight 2 receives about twice as many keys
+// as a stream with weight 1. Streams given as list have a weight of 1.
+//
+// - KeyFrom: Defines the metadata field used as key. Nested fields can be
+// addressed by a path like "user/id". If left empty, the payload is used.
+// By default this parameter is set to "".
+//
+// Examples
+//
+// This example routes all messages of the same user to the same stream:
+//
+//  userRouter:
+//    Type: router.ConsistentHash
+//    Stream: users
+//    KeyFrom: user_id
+//    TargetStreams:
+//      usersA: 1
+//      usersB: 1
+//      usersC: 2
+//
+type ConsistentHash struct {
+	Broadcast `gollumdoc:"embed_type"`
+	getKey    core.GetDataAsBytesFunc
+	targets   []weightedStream
+	routers   []core.Router
+	ring      []consistentHashPoint
+}
+
+type consistentHashPoint struct {
+	hash   uint64
+	target int
+}
+
+func init() {
+	core.TypeRegistry.Register(ConsistentHash{})
+}
+
+// Configure initializes this distributor with values from a plugin config.
+func (router *ConsistentHash) Configure(conf core.PluginConfigReader) {
+	router.getKey = core.NewBytesGetterFor(conf.GetString("KeyFrom", ""))
+	router.targets = getWeightedStreams(conf, "TargetStreams")
+	router.ring = newConsistentHashRing(router.targets)
+}
+
+// Start the router
+func (router *ConsistentHash) Start() error {
+	for _, target := range router.targets {
+		targetRouter := core.StreamRegistry.GetRouterOrFallback(target.streamID)
+		router.routers = append(router.routers, targetRouter)
+	}
+	return nil
+}
+
+// Enqueue enques a message to the router
+func (router *ConsistentHash) Enqueue(msg *core.Message) error {
+	if len(router.ring) == 0 {
+		return core.NewModulateResultError(
+			"Router %s: no streams configured", router.GetID())
+	}
+
+	targetRouter := router.routers[router.getTarget(router.getKey(msg))]
+	if router.GetStreamID() == targetRouter.GetStreamID() {
+		return router.Broadcast.Enqueue(msg)
+	}
+
+	msg.SetStreamID(targetRouter.GetStreamID())
+	return core.Route(msg, targetRouter)
+}
+
+// getTarget returns the index of the target stream for the given key
+func (router *ConsistentHash) getTarget(key []byte) int {
+	hash := consistentHash(key)
+	idx := sort.Search(len(router.ring), func(i int) bool {
+		return router.ring[i].hash >= hash
+	})
+	if idx == len(router.ring) {
+		idx = 0
+	}
+	return router.ring[idx].target
+}
+
+// newConsistentHashRing creates a sorted hash ring containing weight *
+// consistentHashReplicas points per target.
+func newConsistentHashRing(targets []weightedStream) []consistentHashPoint {
+	ring := []consistentHashPoint{}
+	for targetIdx, target := range targets {
+		name := target.streamID.GetName()
+		for i := 0; i < target.weight*consistentHashReplicas; i++ {
+			ring = append(ring, consistentHashPoint{
+				hash:   consistentHash([]byte(name + "#" + strconv.Itoa(i))),
+				target: targetIdx,
+			})
+		}
+	}
+
+	sort.Slice(ring, func(i, j int) bool {
+		return ring[i].hash < ring[j].hash
+	})
+	return ring
+}
+
+func consistentHash(key []byte) uint64 {
+	hash := fnv.New64a()
+	hash.Write(key)
+
+	// FNV does not distribute short keys evenly across all bits, so apply
+	// the murmur3 finalizer to get a uniform distribution.
+	value := hash.Sum64()
+	value ^= value >> 33
+	value *= 0xff51afd7ed558ccd
+	value ^= value >> 33
+	value *= 0xc4ceb9fe1a85ec53
+	value ^= value >> 33
+	return value
+}
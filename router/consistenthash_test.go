@@ -0,0 +1,96 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"fmt"
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func newConsistentHashRouter(t *testing.T, targets interface{}) *ConsistentHash {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "router.ConsistentHash")
+	config.Override("Stream", "hashStream")
+	config.Override("KeyFrom", "key")
+	config.Override("TargetStreams", targets)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	router, casted := plugin.(*ConsistentHash)
+	expect.True(casted)
+	return router
+}
+
+func TestConsistentHashStickiness(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	router := newConsistentHashRouter(t, []interface{}{"hashA", "hashB", "hashC"})
+
+	expect.Equal(3, len(router.targets))
+	expect.Equal(3*consistentHashReplicas, len(router.ring))
+
+	for i := 0; i < 100; i++ {
+		key := []byte(fmt.Sprintf("user%d", i))
+		target := router.getTarget(key)
+		for j := 0; j < 10; j++ {
+			expect.Equal(target, router.getTarget(key))
+		}
+	}
+
+	msg := core.NewMessage(nil, []byte("payload"), tcontainer.MarshalMap{"key": "user1"}, core.InvalidStreamID)
+	expect.Equal(router.getTarget([]byte("user1")), router.getTarget(router.getKey(msg)))
+}
+
+func TestConsistentHashDistribution(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	router := newConsistentHashRouter(t, map[string]interface{}{
+		"hashA": 1,
+		"hashB": 1,
+		"hashC": 2,
+	})
+
+	counts := make([]int, len(router.targets))
+	for i := 0; i < 10000; i++ {
+		counts[router.getTarget([]byte(fmt.Sprintf("key%d", i)))]++
+	}
+
+	// Expect 2500, 2500, 5000 with some tolerance
+	expect.Geq(counts[0], 2000)
+	expect.Leq(counts[0], 3000)
+	expect.Geq(counts[1], 2000)
+	expect.Leq(counts[1], 3000)
+	expect.Geq(counts[2], 4300)
+	expect.Leq(counts[2], 5700)
+}
+
+func TestConsistentHashStability(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	routerABC := newConsistentHashRouter(t, []interface{}{"hashA", "hashB", "hashC"})
+	routerAB := newConsistentHashRouter(t, []interface{}{"hashA", "hashB"})
+
+	// Removing hashC must not move keys between hashA and hashB
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key%d", i))
+		if target := routerABC.getTarget(key); target != 2 {
+			expect.Equal(target, routerAB.getTarget(key))
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"fmt"
+
+	"gollum/core"
+)
+
+// Expr router
+//
+// This router evaluates an expression for each message to decide which
+// stream or streams the message is sent to. This allows replacing chains of
+// filters and routers with a single declarative rule.
+//
+// Expressions support string literals in single or double quotes, numbers,
+// true, false, null and lists written as ["a", "b"]. Values can be compared
+// with ==, !=, <, <=, > and >= and combined with &&, || and !. The ternary
+// operator "condition ? a : b" selects between two values. Numbers are
+// compared numerically if both sides can be converted to a number.
+//
+// Identifiers like level or http/status refer to metadata fields. Missing
+// fields evaluate to null. The following functions are available:
+//
+// - meta("path") returns a metadata field, e.g. for names containing special
+// characters.
+//
+// - json("path") returns a field of the payload parsed as JSON object. The
+// payload is parsed at most once per message.
+//
+// - payload() returns the payload as string.
+//
+// - contains(a, b) returns true if the string a contains b or the list a
+// contains an element equal to b.
+//
+// - matches(a, "regexp") returns true if a matches the given regular
+// expression.
+//
+// The expression has to evaluate to a stream name or a list of stream names.
+// A copy of the message is sent to each listed stream.
+//
+// Parameters
+//
+// - Expression: Defines the expression to evaluate. The expression is
+// compiled when the router is configured. If empty, messages are sent to the
+// router's own stream.
+// By default this parameter is set to "".
+//
+// - ErrorStream: Defines the stream messages are sent to if the expression
+// cannot be evaluated or does not return a stream name. If empty, these
+// messages are sent to the router's own stream.
+// By default this parameter is set to "".
+//
+// Examples
+//
+// This example sends error messages to the "errors" stream and all
+// other messages to the "default" stream. Messages of the payment service
+// are additionally sent to "audit".
+//
+//  exprRouter:
+//    Type: router.Expr
+//    Stream: logs
+//    Expression: >-
+//      service == "payment" ? [level == "error" ? "errors" : "default", "audit"]
+//      : (json("level") == "error" ? "errors" : "default")
+//    ErrorStream: unroutable
+//
+type Expr struct {
+	Broadcast     `gollumdoc:"embed_type"`
+	expression    exprNode
+	errorStreamID core.MessageStreamID
+}
+
+func init() {
+	core.TypeRegistry.Register(Expr{})
+}
+
+// Configure initializes this router with values from a plugin config.
+func (router *Expr) Configure(conf core.PluginConfigReader) {
+	if expression := conf.GetString("Expression", ""); expression != "" {
+		node, err := parseExpr(expression)
+		if err != nil {
+			conf.Errors.Pushf("Failed to parse Expression: %s", err.Error())
+		}
+		router.expression = node
+	}
+
+	router.errorStreamID = core.InvalidStreamID
+	if errorStream := conf.GetString("ErrorStream", ""); errorStream != "" {
+		router.errorStreamID = core.GetStreamID(errorStream)
+	}
+}
+
+// Start the router
+func (router *Expr) Start() error {
+	return nil
+}
+
+// getTargets evaluates the expression for the given message and returns the
+// names of the streams to send the message to.
+func (router *Expr) getTargets(msg *core.Message) ([]string, error) {
+	result, err := router.expression.eval(&exprContext{msg: msg})
+	if err != nil {
+		return nil, err
+	}
+
+	streams := []string{}
+	switch value := result.(type) {
+	case string:
+		streams = append(streams, value)
+	case []interface{}:
+		for _, item := range value {
+			name, isString := item.(string)
+			if !isString {
+				return nil, fmt.Errorf("expression returned non-string stream %v", item)
+			}
+			streams = append(streams, name)
+		}
+	default:
+		return nil, fmt.Errorf("expression returned %v instead of a stream name", result)
+	}
+
+	for _, name := range streams {
+		if name == "" {
+			return nil, fmt.Errorf("expression returned an empty stream name")
+		}
+	}
+	return streams, nil
+}
+
+// getTargetStreams returns the IDs of the streams to send the given message
+// to. ErrorStream is returned if the expression cannot be evaluated.
+func (router *Expr) getTargetStreams(msg *core.Message) []core.MessageStreamID {
+	if router.expression == nil {
+		return []core.MessageStreamID{router.GetStreamID()}
+	}
+
+	streams, err := router.getTargets(msg)
+	if err != nil {
+		router.Logger.WithError(err).Debug("Failed to evaluate expression")
+		if router.errorStreamID == core.InvalidStreamID {
+			return []core.MessageStreamID{router.GetStreamID()}
+		}
+		return []core.MessageStreamID{router.errorStreamID}
+	}
+
+	streamIDs := make([]core.MessageStreamID, 0, len(streams))
+	for _, name := range streams {
+		streamIDs = append(streamIDs, core.GetStreamID(name))
+	}
+	return streamIDs
+}
+
+// Enqueue enques a message to the router
+func (router *Expr) Enqueue(msg *core.Message) error {
+	streamIDs := router.getTargetStreams(msg)
+	lastIdx := len(streamIDs) - 1
+
+	for idx, streamID := range streamIDs {
+		target := msg
+		if idx < lastIdx {
+			target = msg.Clone()
+		}
+
+		if streamID == router.GetStreamID() {
+			if err := router.Broadcast.Enqueue(target); err != nil {
+				return err
+			}
+			continue
+		}
+
+		target.SetStreamID(streamID)
+		if err := core.Route(target, core.StreamRegistry.GetRouterOrFallback(streamID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func newExprRouter(t *testing.T, expression string, errorStream string) *Expr {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "router.Expr")
+	config.Override("Stream", "exprStream")
+	config.Override("Expression", expression)
+	config.Override("ErrorStream", errorStream)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	router, casted := plugin.(*Expr)
+	expect.True(casted)
+	return router
+}
+
+func TestExprTargets(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	metadata := tcontainer.MarshalMap{
+		"level":   "error",
+		"status":  "503",
+		"service": "payment",
+		"tags":    []interface{}{"eu", "prod"},
+		"http":    tcontainer.MarshalMap{"method": "POST"},
+	}
+	payload := []byte(`{"user": {"id": 42, "name": "ann"}, "debug": false}`)
+
+	for expression, expected := range map[string][]string{
+		`level == "error" ? "errors" : "default"`:                   {"errors"},
+		`level != 'error' ? "errors" : "default"`:                   {"default"},
+		`status >= 500 && status < 600 ? "5xx" : "other"`:           {"5xx"},
+		`status > 1000 || missing == null ? "fallback" : "other"`:   {"fallback"},
+		`!(service == "payment") ? "other" : ["payment", "audit"]`:  {"payment", "audit"},
+		`http/method == "POST" ? "writes" : "reads"`:                {"writes"},
+		`meta("http/method") == "GET" ? "reads" : "writes"`:         {"writes"},
+		`json("user/id") == 42 ? "user42" : "other"`:                {"user42"},
+		`json("debug") ? "debug" : "nodebug"`:                       {"nodebug"},
+		`contains(tags, "prod") ? "prod" : "dev"`:                   {"prod"},
+		`contains(payload(), "ann") ? "ann" : "other"`:              {"ann"},
+		`matches(service, "^pay") ? "pay" : "other"`:                {"pay"},
+		`level == "info" ? "info" : level == "error" ? "err" : "x"`: {"err"},
+		`service`: {"payment"},
+	} {
+		router := newExprRouter(t, expression, "")
+		msg := core.NewMessage(nil, payload, metadata.Clone(), core.InvalidStreamID)
+
+		targets, err := router.getTargets(msg)
+		expect.NoError(err)
+		expect.Equal(expected, targets)
+	}
+}
+
+func TestExprErrors(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	metadata := tcontainer.MarshalMap{"level": "error"}
+
+	for _, expression := range []string{
+		`missing`,
+		`level == "error"`,
+		`missing > 3 ? "a" : "b"`,
+		`level == "error" ? "" : "b"`,
+		`["a", 1]`,
+	} {
+		router := newExprRouter(t, expression, "exprErrors")
+		msg := core.NewMessage(nil, []byte("payload"), metadata.Clone(), core.InvalidStreamID)
+
+		_, err := router.getTargets(msg)
+		expect.NotNil(err)
+		expect.Equal([]core.MessageStreamID{core.GetStreamID("exprErrors")}, router.getTargetStreams(msg))
+	}
+
+	// Without ErrorStream messages stay in the router's stream
+	router := newExprRouter(t, `missing`, "")
+	msg := core.NewMessage(nil, []byte("payload"), nil, core.InvalidStreamID)
+	expect.Equal([]core.MessageStreamID{router.GetStreamID()}, router.getTargetStreams(msg))
+}
+
+func TestExprParseErrors(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	for _, expression := range []string{
+		`level ==`,
+		`level == "error" ? "a"`,
+		`("a"`,
+		`"unterminated`,
+		`unknown("a")`,
+		`matches(level, "(")`,
+		`json(level)`,
+		`level = "a"`,
+		`"a" "b"`,
+	} {
+		config := core.NewPluginConfig("", "router.Expr")
+		config.Override("Stream", "exprStream")
+		config.Override("Expression", expression)
+		_, err := core.NewPluginWithConfig(config)
+		expect.NotNil(err)
+	}
+}
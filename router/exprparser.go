@@ -0,0 +1,667 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+)
+
+// exprContext holds the message an expression is evaluated for. The payload
+// is parsed as JSON at most once per message.
+type exprContext struct {
+	msg        *core.Message
+	json       tcontainer.MarshalMap
+	jsonParsed bool
+}
+
+// exprNode is a node of a compiled expression
+type exprNode interface {
+	eval(ctx *exprContext) (interface{}, error)
+}
+
+type exprLiteral struct {
+	value interface{}
+}
+
+type exprMetadata struct {
+	path string
+}
+
+type exprJSON struct {
+	path string
+}
+
+type exprPayload struct{}
+
+type exprList struct {
+	items []exprNode
+}
+
+type exprNot struct {
+	operand exprNode
+}
+
+type exprLogical struct {
+	isAnd       bool
+	left, right exprNode
+}
+
+type exprCompare struct {
+	operator    string
+	left, right exprNode
+}
+
+type exprTernary struct {
+	condition    exprNode
+	then, orElse exprNode
+}
+
+type exprContains struct {
+	haystack, needle exprNode
+}
+
+type exprMatches struct {
+	value      exprNode
+	expression *regexp.Regexp
+}
+
+func (node exprLiteral) eval(ctx *exprContext) (interface{}, error) {
+	return node.value, nil
+}
+
+func (node exprMetadata) eval(ctx *exprContext) (interface{}, error) {
+	value, _ := core.GetValuePath(ctx.msg.TryGetMetadata(), node.path)
+	return normalizeExprValue(value), nil
+}
+
+func (node exprJSON) eval(ctx *exprContext) (interface{}, error) {
+	if !ctx.jsonParsed {
+		ctx.jsonParsed = true
+		var object map[string]interface{}
+		decoder := json.NewDecoder(bytes.NewReader(ctx.msg.GetPayload()))
+		decoder.UseNumber()
+		if err := decoder.Decode(&object); err == nil {
+			ctx.json = tcontainer.MarshalMap(object)
+		}
+	}
+
+	value, _ := core.GetValuePath(ctx.json, node.path)
+	return normalizeExprValue(value), nil
+}
+
+func (node exprPayload) eval(ctx *exprContext) (interface{}, error) {
+	return ctx.msg.String(), nil
+}
+
+func (node exprList) eval(ctx *exprContext) (interface{}, error) {
+	values := make([]interface{}, 0, len(node.items))
+	for _, item := range node.items {
+		value, err := item.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func (node exprNot) eval(ctx *exprContext) (interface{}, error) {
+	value, err := node.operand.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return !isExprTrue(value), nil
+}
+
+func (node exprLogical) eval(ctx *exprContext) (interface{}, error) {
+	left, err := node.left.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if isExprTrue(left) != node.isAnd {
+		return !node.isAnd, nil // ### return, short circuit ###
+	}
+
+	right, err := node.right.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return isExprTrue(right), nil
+}
+
+func (node exprCompare) eval(ctx *exprContext) (interface{}, error) {
+	left, err := node.left.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	right, err := node.right.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch node.operator {
+	case "==":
+		return isExprEqual(left, right), nil
+	case "!=":
+		return !isExprEqual(left, right), nil
+	}
+
+	if left == nil || right == nil {
+		return nil, fmt.Errorf("cannot compare %v %s %v", left, node.operator, right)
+	}
+
+	var order int
+	leftNum, leftIsNum := toExprNumber(left)
+	rightNum, rightIsNum := toExprNumber(right)
+	switch {
+	case leftIsNum && rightIsNum:
+		switch {
+		case leftNum < rightNum:
+			order = -1
+		case leftNum > rightNum:
+			order = 1
+		}
+	default:
+		order = strings.Compare(core.ConvertToString(left), core.ConvertToString(right))
+	}
+
+	switch node.operator {
+	case "<":
+		return order < 0, nil
+	case "<=":
+		return order <= 0, nil
+	case ">":
+		return order > 0, nil
+	default:
+		return order >= 0, nil
+	}
+}
+
+func (node exprTernary) eval(ctx *exprContext) (interface{}, error) {
+	condition, err := node.condition.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if isExprTrue(condition) {
+		return node.then.eval(ctx)
+	}
+	return node.orElse.eval(ctx)
+}
+
+func (node exprContains) eval(ctx *exprContext) (interface{}, error) {
+	haystack, err := node.haystack.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+	needle, err := node.needle.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch value := haystack.(type) {
+	case nil:
+		return false, nil
+	case []interface{}:
+		for _, item := range value {
+			if isExprEqual(item, needle) {
+				return true, nil
+			}
+		}
+		return false, nil
+	default:
+		return strings.Contains(core.ConvertToString(value), core.ConvertToString(needle)), nil
+	}
+}
+
+func (node exprMatches) eval(ctx *exprContext) (interface{}, error) {
+	value, err := node.value.eval(ctx)
+	if err != nil || value == nil {
+		return false, err
+	}
+	return node.expression.MatchString(core.ConvertToString(value)), nil
+}
+
+// normalizeExprValue converts values read from metadata or JSON into the
+// types used by expressions, i.e. string, float64, bool, nil or lists.
+func normalizeExprValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case nil, string, float64, bool:
+		return typed
+	case []byte:
+		return string(typed)
+	case json.Number:
+		if number, err := typed.Float64(); err == nil {
+			return number
+		}
+		return typed.String()
+	case []interface{}:
+		values := make([]interface{}, 0, len(typed))
+		for _, item := range typed {
+			values = append(values, normalizeExprValue(item))
+		}
+		return values
+	case []string:
+		values := make([]interface{}, 0, len(typed))
+		for _, item := range typed {
+			values = append(values, item)
+		}
+		return values
+	default:
+		if number, isNumber := toExprNumber(typed); isNumber {
+			return number
+		}
+		return typed
+	}
+}
+
+// toExprNumber converts numbers and numeric strings to float64
+func toExprNumber(value interface{}) (float64, bool) {
+	switch typed := value.(type) {
+	case float64:
+		return typed, true
+	case float32:
+		return float64(typed), true
+	case int:
+		return float64(typed), true
+	case int64:
+		return float64(typed), true
+	case int32:
+		return float64(typed), true
+	case uint64:
+		return float64(typed), true
+	case uint32:
+		return float64(typed), true
+	case string:
+		number, err := strconv.ParseFloat(typed, 64)
+		return number, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// isExprTrue returns the truth value of a value. Nil, false, 0, empty
+// strings and empty lists are false.
+func isExprTrue(value interface{}) bool {
+	switch typed := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return typed
+	case float64:
+		return typed != 0
+	case string:
+		return typed != ""
+	case []interface{}:
+		return len(typed) > 0
+	default:
+		return true
+	}
+}
+
+// isExprEqual compares two values. Numbers are compared numerically if both
+// values can be converted to a number, all other values are compared as
+// strings. Nil is only equal to nil.
+func isExprEqual(left, right interface{}) bool {
+	if left == nil || right == nil {
+		return left == nil && right == nil
+	}
+
+	leftBool, leftIsBool := left.(bool)
+	rightBool, rightIsBool := right.(bool)
+	if leftIsBool || rightIsBool {
+		return leftIsBool && rightIsBool && leftBool == rightBool
+	}
+
+	_, leftIsFloat := left.(float64)
+	_, rightIsFloat := right.(float64)
+	if leftIsFloat || rightIsFloat {
+		leftNum, leftIsNum := toExprNumber(left)
+		rightNum, rightIsNum := toExprNumber(right)
+		if leftIsNum && rightIsNum {
+			return leftNum == rightNum
+		}
+	}
+
+	return core.ConvertToString(left) == core.ConvertToString(right)
+}
+
+// exprParser is a recursive descent parser for the expressions of
+// router.Expr. The grammar in order of precedence is:
+//
+//  ternary := or ["?" ternary ":" ternary]
+//  or      := and {"||" and}
+//  and     := unary {"&&" unary}
+//  unary   := "!" unary | compare
+//  compare := primary [("=="|"!="|"<"|"<="|">"|">=") primary]
+//  primary := string | number | "true" | "false" | "null" | field | call |
+//             "(" ternary ")" | "[" [ternary {"," ternary}] "]"
+type exprParser struct {
+	tokens []string
+	pos    int
+}
+
+// parseExpr compiles the given expression
+func parseExpr(expression string) (exprNode, error) {
+	tokens, err := tokenizeExpr(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := exprParser{tokens: tokens}
+	node, err := parser.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	if parser.pos < len(parser.tokens) {
+		return nil, fmt.Errorf("unexpected '%s'", parser.tokens[parser.pos])
+	}
+	return node, nil
+}
+
+// tokenizeExpr splits an expression into string literals (including their
+// quotes), numbers, identifiers and operators.
+func tokenizeExpr(expression string) ([]string, error) {
+	tokens := []string{}
+	for pos := 0; pos < len(expression); {
+		char := rune(expression[pos])
+		switch {
+		case unicode.IsSpace(char):
+			pos++
+
+		case char == '"' || char == '\'':
+			end := pos + 1
+			for end < len(expression) && expression[end] != expression[pos] {
+				if expression[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(expression) {
+				return nil, fmt.Errorf("unterminated string starting at %d", pos)
+			}
+			tokens = append(tokens, expression[pos:end+1])
+			pos = end + 1
+
+		case isExprIdentChar(char) || char == '-' && pos+1 < len(expression) && unicode.IsDigit(rune(expression[pos+1])):
+			end := pos + 1
+			for end < len(expression) && isExprIdentChar(rune(expression[end])) {
+				end++
+			}
+			tokens = append(tokens, expression[pos:end])
+			pos = end
+
+		default:
+			operator := ""
+			for _, candidate := range []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "!", "?", ":", "(", ")", "[", "]", ","} {
+				if strings.HasPrefix(expression[pos:], candidate) {
+					operator = candidate
+					break
+				}
+			}
+			if operator == "" {
+				return nil, fmt.Errorf("unexpected character '%c' at %d", char, pos)
+			}
+			tokens = append(tokens, operator)
+			pos += len(operator)
+		}
+	}
+	return tokens, nil
+}
+
+func isExprIdentChar(char rune) bool {
+	return unicode.IsLetter(char) || unicode.IsDigit(char) || strings.ContainsRune("_./", char)
+}
+
+func (parser *exprParser) peek() string {
+	if parser.pos < len(parser.tokens) {
+		return parser.tokens[parser.pos]
+	}
+	return ""
+}
+
+func (parser *exprParser) next() string {
+	token := parser.peek()
+	parser.pos++
+	return token
+}
+
+func (parser *exprParser) expect(token string) error {
+	if next := parser.next(); next != token {
+		if next == "" {
+			return fmt.Errorf("expected '%s' but expression ended", token)
+		}
+		return fmt.Errorf("expected '%s' but found '%s'", token, next)
+	}
+	return nil
+}
+
+func (parser *exprParser) parseTernary() (exprNode, error) {
+	condition, err := parser.parseOr()
+	if err != nil || parser.peek() != "?" {
+		return condition, err
+	}
+	parser.next()
+
+	then, err := parser.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	if err := parser.expect(":"); err != nil {
+		return nil, err
+	}
+	orElse, err := parser.parseTernary()
+	if err != nil {
+		return nil, err
+	}
+	return exprTernary{condition, then, orElse}, nil
+}
+
+func (parser *exprParser) parseOr() (exprNode, error) {
+	left, err := parser.parseAnd()
+	for err == nil && parser.peek() == "||" {
+		parser.next()
+		var right exprNode
+		if right, err = parser.parseAnd(); err == nil {
+			left = exprLogical{false, left, right}
+		}
+	}
+	return left, err
+}
+
+func (parser *exprParser) parseAnd() (exprNode, error) {
+	left, err := parser.parseUnary()
+	for err == nil && parser.peek() == "&&" {
+		parser.next()
+		var right exprNode
+		if right, err = parser.parseUnary(); err == nil {
+			left = exprLogical{true, left, right}
+		}
+	}
+	return left, err
+}
+
+func (parser *exprParser) parseUnary() (exprNode, error) {
+	if parser.peek() == "!" {
+		parser.next()
+		operand, err := parser.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return exprNot{operand}, nil
+	}
+	return parser.parseCompare()
+}
+
+func (parser *exprParser) parseCompare() (exprNode, error) {
+	left, err := parser.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	switch operator := parser.peek(); operator {
+	case "==", "!=", "<", "<=", ">", ">=":
+		parser.next()
+		right, err := parser.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		return exprCompare{operator, left, right}, nil
+	default:
+		return left, nil
+	}
+}
+
+func (parser *exprParser) parsePrimary() (exprNode, error) {
+	token := parser.next()
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+
+	case token == "(":
+		node, err := parser.parseTernary()
+		if err != nil {
+			return nil, err
+		}
+		return node, parser.expect(")")
+
+	case token == "[":
+		items, err := parser.parseArguments("]")
+		return exprList{items}, err
+
+	case token[0] == '"' || token[0] == '\'':
+		return parseExprString(token)
+
+	case token == "true" || token == "false":
+		return exprLiteral{token == "true"}, nil
+
+	case token == "null":
+		return exprLiteral{nil}, nil
+
+	case unicode.IsDigit(rune(token[0])) || token[0] == '-':
+		number, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s'", token)
+		}
+		return exprLiteral{number}, nil
+
+	case isExprIdentChar(rune(token[0])):
+		if parser.peek() == "(" {
+			parser.next()
+			return parser.parseCall(token)
+		}
+		return exprMetadata{token}, nil
+
+	default:
+		return nil, fmt.Errorf("unexpected '%s'", token)
+	}
+}
+
+func parseExprString(token string) (exprNode, error) {
+	if token[0] == '\'' {
+		token = "\"" + strings.Replace(strings.Replace(token[1:len(token)-1], "\\'", "'", -1), "\"", "\\\"", -1) + "\""
+	}
+	value, err := strconv.Unquote(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid string %s", token)
+	}
+	return exprLiteral{value}, nil
+}
+
+// parseArguments parses a comma separated list of expressions until the
+// given closing token.
+func (parser *exprParser) parseArguments(closing string) ([]exprNode, error) {
+	items := []exprNode{}
+	if parser.peek() == closing {
+		parser.next()
+		return items, nil
+	}
+
+	for {
+		item, err := parser.parseTernary()
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+
+		if parser.peek() != "," {
+			return items, parser.expect(closing)
+		}
+		parser.next()
+	}
+}
+
+// parseCall parses the arguments of a function call and returns the node
+// implementing the given function.
+func (parser *exprParser) parseCall(name string) (exprNode, error) {
+	args, err := parser.parseArguments(")")
+	if err != nil {
+		return nil, err
+	}
+
+	stringArg := func(idx int) (string, error) {
+		if literal, isLiteral := args[idx].(exprLiteral); isLiteral {
+			if value, isString := literal.value.(string); isString {
+				return value, nil
+			}
+		}
+		return "", fmt.Errorf("argument %d of %s() must be a string", idx+1, name)
+	}
+
+	argCount := map[string]int{"payload": 0, "meta": 1, "json": 1, "contains": 2, "matches": 2}
+	expectedArgs, known := argCount[name]
+	if !known {
+		return nil, fmt.Errorf("unknown function %s()", name)
+	}
+	if len(args) != expectedArgs {
+		return nil, fmt.Errorf("%s() expects %d arguments", name, expectedArgs)
+	}
+
+	switch name {
+	case "payload":
+		return exprPayload{}, nil
+
+	case "meta":
+		path, err := stringArg(0)
+		return exprMetadata{path}, err
+
+	case "json":
+		path, err := stringArg(0)
+		return exprJSON{path}, err
+
+	case "contains":
+		return exprContains{args[0], args[1]}, nil
+
+	default:
+		pattern, err := stringArg(1)
+		if err != nil {
+			return nil, err
+		}
+		expression, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return exprMatches{args[0], expression}, nil
+	}
+}
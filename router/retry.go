@@ -0,0 +1,176 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package router
+
+import (
+	"time"
+
+	"gollum/core"
+)
+
+// Retry router
+//
+// This router is meant to be used as the fallback stream of producers. It
+// holds each message for a given delay and routes it back to the stream the
+// message was originally consumed from. The number of retries is stored in
+// the metadata of the message. If a message failed more than MaxRetries
+// times, it is routed to DeadLetterStream instead.
+// Please note that a retried message is routed to all producers of its
+// original stream again. Messages waiting for a retry are lost if gollum is
+// shut down.
+//
+// Parameters
+//
+// - DelayMs: Defines the time in milliseconds a message is held before the
+// first retry. The delay is doubled with each retry.
+// By default this parameter is set to "1000".
+//
+// - DelayMaxMs: Defines the maximum time in milliseconds a message is held
+// before being retried.
+// By default this parameter is set to "60000".
+//
+// - MaxRetries: Defines how often a message is retried before it is routed to
+// DeadLetterStream.
+// By default this parameter is set to "3".
+//
+// - RetryCountKey: Defines the metadata key used to store the number of
+// retries.
+// By default this parameter is set to "retries".
+//
+// - DeadLetterStream: Defines the stream messages are routed to after
+// MaxRetries has been reached. If not set, these messages are discarded.
+// By default this parameter is set to "".
+//
+// Examples
+//
+// This example retries messages that could not be written to kafka up to 5
+// times and writes them to a file afterwards.
+//
+//  kafkaOut:
+//    Type: producer.Kafka
+//    Streams: logs
+//    FallbackStream: retry
+//
+//  retryRouter:
+//    Type: router.Retry
+//    Stream: retry
+//    DelayMs: 500
+//    MaxRetries: 5
+//    DeadLetterStream: failed
+//
+//  failedOut:
+//    Type: producer.File
+//    Streams: failed
+//    File: /var/log/gollum/failed.log
+type Retry struct {
+	core.SimpleRouter `gollumdoc:"embed_type"`
+	delay             time.Duration        `config:"DelayMs" default:"1000" metric:"ms"`
+	delayMax          time.Duration        `config:"DelayMaxMs" default:"60000" metric:"ms"`
+	maxRetries        int                  `config:"MaxRetries" default:"3"`
+	retryCountKey     string               `config:"RetryCountKey" default:"retries"`
+	deadLetterStream  core.MessageStreamID `config:"DeadLetterStream"`
+}
+
+func init() {
+	core.TypeRegistry.Register(Retry{})
+}
+
+// Configure initializes this router with values from a plugin config.
+func (router *Retry) Configure(conf core.PluginConfigReader) {
+	if router.delay < 0 {
+		conf.Errors.Pushf("DelayMs must not be negative")
+	}
+	if router.delayMax < router.delay {
+		conf.Errors.Pushf("DelayMaxMs must not be less than DelayMs")
+	}
+	if router.maxRetries < 0 {
+		conf.Errors.Pushf("MaxRetries must not be negative")
+	}
+	if router.retryCountKey == "" {
+		conf.Errors.Pushf("RetryCountKey must not be empty")
+	}
+}
+
+// Start the router
+func (router *Retry) Start() error {
+	return nil
+}
+
+// getRetryCount returns the number of times the given message has been
+// retried so far.
+func (router *Retry) getRetryCount(msg *core.Message) int {
+	metadata := msg.TryGetMetadata()
+	if metadata == nil {
+		return 0
+	}
+	retries, err := metadata.Int(router.retryCountKey)
+	if err != nil {
+		return 0
+	}
+	return int(retries)
+}
+
+// getDelay returns the time to wait before the given retry.
+func (router *Retry) getDelay(retry int) time.Duration {
+	delay := router.delay
+	for i := 1; i < retry && delay < router.delayMax; i++ {
+		delay *= 2
+	}
+	if delay > router.delayMax {
+		return router.delayMax
+	}
+	return delay
+}
+
+// retry routes the message back to its original stream.
+func (router *Retry) retry(msg *core.Message) {
+	// The current state has to become the original, otherwise the retry count
+	// would be lost when the message is passed to a fallback again.
+	msg.ResetOriginal()
+	msg.SetStreamID(msg.GetOrigStreamID())
+
+	if err := core.Route(msg, msg.GetRouter()); err != nil {
+		router.Logger.WithError(err).Error("Failed to retry message")
+	}
+}
+
+// routeToDeadLetter routes the message to the dead letter stream or discards
+// it if there is none.
+func (router *Retry) routeToDeadLetter(msg *core.Message) error {
+	if router.deadLetterStream == core.InvalidStreamID {
+		core.DiscardMessage(msg, router.GetID(), "Retry router reached MaxRetries")
+		return nil
+	}
+
+	msg.SetStreamID(router.deadLetterStream)
+	return core.Route(msg, msg.GetRouter())
+}
+
+// Enqueue schedules a retry for the given message or routes it to the dead
+// letter stream.
+func (router *Retry) Enqueue(msg *core.Message) error {
+	retries := router.getRetryCount(msg)
+	if retries >= router.maxRetries {
+		return router.routeToDeadLetter(msg)
+	}
+
+	retries++
+	msg.GetMetadata().Set(router.retryCountKey, retries)
+	time.AfterFunc(router.getDelay(retries), func() {
+		router.retry(msg)
+	})
+	return nil
+}
@@ -0,0 +1,194 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"testing"
+	"time"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+// mockRouter collects all messages enqueued to a stream
+type mockRouter struct {
+	streamID core.MessageStreamID
+	messages chan *core.Message
+}
+
+func newMockRouter(stream string) *mockRouter {
+	router := &mockRouter{
+		streamID: core.StreamRegistry.GetStreamID(stream),
+		messages: make(chan *core.Message, 16),
+	}
+	core.StreamRegistry.Register(router, router.streamID)
+	return router
+}
+
+func (router *mockRouter) Modulate(msg *core.Message) core.ModulateResult {
+	return core.ModulateResultContinue
+}
+
+func (router *mockRouter) GetStreamID() core.MessageStreamID {
+	return router.streamID
+}
+
+func (router *mockRouter) GetID() string {
+	return "mockRouter"
+}
+
+func (router *mockRouter) AddProducer(producers ...core.Producer) {
+}
+
+func (router *mockRouter) Enqueue(msg *core.Message) error {
+	router.messages <- msg
+	return nil
+}
+
+func (router *mockRouter) GetTimeout() time.Duration {
+	return time.Second
+}
+
+func (router *mockRouter) Start() error {
+	return nil
+}
+
+func (router *mockRouter) receive(t *testing.T) *core.Message {
+	select {
+	case msg := <-router.messages:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("message was not received")
+		return nil
+	}
+}
+
+func TestRetryCounter(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	original := newMockRouter(t.Name() + "Original")
+	deadLetter := newMockRouter(t.Name() + "DeadLetter")
+
+	config := core.NewPluginConfig("", "router.Retry")
+	config.Override("Stream", t.Name()+"Retry")
+	config.Override("DelayMs", 10)
+	config.Override("MaxRetries", 2)
+	config.Override("DeadLetterStream", t.Name()+"DeadLetter")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	router, casted := plugin.(*Retry)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("payload"), nil, original.GetStreamID())
+	msg.SetStreamID(router.GetStreamID())
+
+	for retry := int64(1); retry <= 2; retry++ {
+		msg.FreezeOriginal()
+		expect.NoError(core.RouteOriginal(msg, router))
+
+		retried := original.receive(t)
+		expect.Equal("payload", retried.String())
+		expect.Equal(original.GetStreamID(), retried.GetStreamID())
+
+		retries, err := retried.GetMetadata().Int("retries")
+		expect.NoError(err)
+		expect.Equal(retry, retries)
+
+		// Producers freeze and modify the message before it fails again
+		msg = retried
+		msg.FreezeOriginal()
+		msg.StorePayload([]byte("modified"))
+	}
+
+	// The retry count survives the fallback, so MaxRetries is reached
+	expect.NoError(core.RouteOriginal(msg, router))
+	failed := deadLetter.receive(t)
+	expect.Equal("payload", failed.String())
+	expect.Equal(deadLetter.GetStreamID(), failed.GetStreamID())
+
+	select {
+	case <-original.messages:
+		t.Error("message has been retried after MaxRetries")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRetryWithoutDeadLetterStream(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+	original := newMockRouter(t.Name() + "Original")
+
+	config := core.NewPluginConfig("", "router.Retry")
+	config.Override("Stream", t.Name()+"Retry")
+	config.Override("DelayMs", 10)
+	config.Override("MaxRetries", 1)
+	config.Override("RetryCountKey", "retry/count")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	router, casted := plugin.(*Retry)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("payload"), nil, original.GetStreamID())
+	msg.GetMetadata().Set("retry", map[string]interface{}{"count": 1})
+
+	// Messages are discarded after MaxRetries
+	expect.NoError(router.Enqueue(msg))
+	select {
+	case <-original.messages:
+		t.Error("message has been retried after MaxRetries")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "router.Retry")
+	config.Override("Stream", t.Name()+"Retry")
+	config.Override("DelayMs", 100)
+	config.Override("DelayMaxMs", 300)
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	router, casted := plugin.(*Retry)
+	expect.True(casted)
+
+	expect.Equal(100*time.Millisecond, router.getDelay(1))
+	expect.Equal(200*time.Millisecond, router.getDelay(2))
+	expect.Equal(300*time.Millisecond, router.getDelay(3))
+	expect.Equal(300*time.Millisecond, router.getDelay(10))
+}
+
+func TestRetryConfigErrors(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	for _, settings := range []map[string]interface{}{
+		{"DelayMs": -1},
+		{"DelayMs": 1000, "DelayMaxMs": 100},
+		{"MaxRetries": -1},
+		{"RetryCountKey": ""},
+	} {
+		config := core.NewPluginConfig("", "router.Retry")
+		for key, value := range settings {
+			config.Override(key, value)
+		}
+		_, err := core.NewPluginWithConfig(config)
+		expect.NotNil(err)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"bytes"
+
+	"gollum/core"
+)
+
+// Split router
+//
+// This router splits the payload of a message into several parts and sends
+// each part to all producers of this stream as a message of its own.
+// Filters and modulators of the router are applied to the complete message
+// before splitting. Each part gets a copy of the metadata of the complete
+// message. Modulators of the producers are applied to each part separately.
+// If no parts are left, e.g. because all parts are empty, the message is
+// discarded.
+//
+// Parameters
+//
+// - Delimiter: Defines the delimiter that separates two parts.
+// By default this parameter is set to "\n".
+//
+// - KeepEmpty: When set to true, empty parts, e.g. a trailing part after the
+// last delimiter, are sent as messages, too.
+// By default this parameter is set to false.
+//
+// Examples
+//
+// This example splits messages containing multiple lines and writes each line
+// as a message of its own.
+//
+//  lineSplitter:
+//    Type: router.Split
+//    Stream: batches
+//    Delimiter: "\n"
+//
+type Split struct {
+	Broadcast `gollumdoc:"embed_type"`
+	delimiter string `config:"Delimiter" default:"\n"`
+	keepEmpty bool   `config:"KeepEmpty" default:"false"`
+}
+
+func init() {
+	core.TypeRegistry.Register(Split{})
+}
+
+// Configure initializes this router with values from a plugin config.
+func (router *Split) Configure(conf core.PluginConfigReader) {
+	if router.delimiter == "" {
+		conf.Errors.Pushf("Delimiter must not be empty")
+	}
+}
+
+// Enqueue enques each part of the message to the router
+func (router *Split) Enqueue(msg *core.Message) error {
+	parts := router.split(msg)
+	if len(parts) == 0 {
+		core.DiscardMessage(msg, router.GetID(), "Split router found no parts")
+		return nil
+	}
+
+	for _, part := range parts {
+		if err := router.Broadcast.Enqueue(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// split returns one message per part. The original message is reused for
+// the last part.
+func (router *Split) split(msg *core.Message) []*core.Message {
+	// Split a copy as StorePayload may reuse the buffer of the message
+	payload := append([]byte(nil), msg.GetPayload()...)
+	payloads := bytes.Split(payload, []byte(router.delimiter))
+
+	if !router.keepEmpty {
+		nonEmpty := payloads[:0]
+		for _, part := range payloads {
+			if len(part) > 0 {
+				nonEmpty = append(nonEmpty, part)
+			}
+		}
+		payloads = nonEmpty
+	}
+
+	if len(payloads) == 0 {
+		return nil
+	}
+
+	// Store the last part first so that cloning does not copy the complete
+	// payload for each part.
+	lastIdx := len(payloads) - 1
+	msg.StorePayload(payloads[lastIdx])
+
+	parts := make([]*core.Message, len(payloads))
+	for i, part := range payloads[:lastIdx] {
+		parts[i] = msg.Clone()
+		parts[i].StorePayload(part)
+	}
+	parts[lastIdx] = msg
+	return parts
+}
@@ -0,0 +1,112 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+	"github.com/trivago/tgo/ttesting"
+)
+
+func getSplitPayloads(parts []*core.Message) []string {
+	payloads := []string{}
+	for _, part := range parts {
+		payloads = append(payloads, part.String())
+	}
+	return payloads
+}
+
+func TestSplit(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "router.Split")
+	config.Override("Stream", "splitStream")
+	config.Override("Delimiter", ",")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	router, casted := plugin.(*Split)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("first,second,third"), tcontainer.MarshalMap{"key": "value"}, core.InvalidStreamID)
+	parts := router.split(msg)
+
+	expect.Equal([]string{"first", "second", "third"}, getSplitPayloads(parts))
+	expect.Equal(msg, parts[2])
+
+	for _, part := range parts {
+		value, err := part.GetMetadata().String("key")
+		expect.NoError(err)
+		expect.Equal("value", value)
+	}
+
+	// Metadata must not be shared between parts
+	parts[0].GetMetadata().Set("key", "changed")
+	value, _ := parts[1].GetMetadata().String("key")
+	expect.Equal("value", value)
+}
+
+func TestSplitEmptyTrailingSegments(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "router.Split")
+	config.Override("Stream", "splitStream")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	router, casted := plugin.(*Split)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("a\n\nb\n"), nil, core.InvalidStreamID)
+	expect.Equal([]string{"a", "b"}, getSplitPayloads(router.split(msg)))
+
+	msg = core.NewMessage(nil, []byte("\n\n"), nil, core.InvalidStreamID)
+	expect.Equal(0, len(router.split(msg)))
+
+	config = core.NewPluginConfig("", "router.Split")
+	config.Override("Stream", "splitStream")
+	config.Override("KeepEmpty", true)
+
+	plugin, err = core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	router, casted = plugin.(*Split)
+	expect.True(casted)
+
+	msg = core.NewMessage(nil, []byte("a\n\nb\n"), nil, core.InvalidStreamID)
+	expect.Equal([]string{"a", "", "b", ""}, getSplitPayloads(router.split(msg)))
+}
+
+func TestSplitMultiByteDelimiter(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "router.Split")
+	config.Override("Stream", "splitStream")
+	config.Override("Delimiter", "\r\n")
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	router, casted := plugin.(*Split)
+	expect.True(casted)
+
+	msg := core.NewMessage(nil, []byte("first line\r\nsecond line\r\n"), nil, core.InvalidStreamID)
+	expect.Equal([]string{"first line", "second line"}, getSplitPayloads(router.split(msg)))
+}
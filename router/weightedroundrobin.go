@@ -0,0 +1,117 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"sync"
+
+	"gollum/core"
+)
+
+// WeightedRoundRobin router
+//
+// This router relays each message sent to the stream [Stream] to exactly one
+// of the streams listed in [TargetStreams]. Messages are distributed in
+// proportion to the weight of each stream using smooth weighted round robin
+// as known from nginx, i.e. streams with a high weight don't receive their
+// messages in bursts but interleaved with the other streams.
+// This router can be useful to gradually shift traffic from one producer to
+// another, e.g. during a migration.
+//
+// Parameters
+//
+// - TargetStreams: A map of stream names to integer weights. Streams with a
+// weight of 0 don't receive any messages.
+//
+// Examples
+//
+// This example sends 90% of all messages to the old and 10% to the new
+// elasticsearch cluster.
+//
+//  migrationRouter:
+//    Type: router.WeightedRoundRobin
+//    Stream: logs
+//    TargetStreams:
+//      logsOldCluster: 9
+//      logsNewCluster: 1
+//
+type WeightedRoundRobin struct {
+	Broadcast   `gollumdoc:"embed_type"`
+	targets     []weightedStream
+	routers     []core.Router
+	current     []int
+	totalWeight int
+	guard       *sync.Mutex
+}
+
+func init() {
+	core.TypeRegistry.Register(WeightedRoundRobin{})
+}
+
+// Configure initializes this distributor with values from a plugin config.
+func (router *WeightedRoundRobin) Configure(conf core.PluginConfigReader) {
+	router.guard = new(sync.Mutex)
+	router.targets = getWeightedStreams(conf, "TargetStreams")
+	router.current = make([]int, len(router.targets))
+	router.totalWeight = 0
+	for _, target := range router.targets {
+		router.totalWeight += target.weight
+	}
+}
+
+// Start the router
+func (router *WeightedRoundRobin) Start() error {
+	for _, target := range router.targets {
+		targetRouter := core.StreamRegistry.GetRouterOrFallback(target.streamID)
+		router.routers = append(router.routers, targetRouter)
+	}
+	return nil
+}
+
+// Enqueue enques a message to the router
+func (router *WeightedRoundRobin) Enqueue(msg *core.Message) error {
+	if router.totalWeight == 0 {
+		return core.NewModulateResultError(
+			"Router %s: no streams configured", router.GetID())
+	}
+
+	targetRouter := router.routers[router.next()]
+	if router.GetStreamID() == targetRouter.GetStreamID() {
+		return router.Broadcast.Enqueue(msg)
+	}
+
+	msg.SetStreamID(targetRouter.GetStreamID())
+	return core.Route(msg, targetRouter)
+}
+
+// next returns the index of the next target. Each target's current weight is
+// increased by its weight and the target with the highest current weight is
+// chosen. The chosen target's current weight is then decreased by the total
+// weight.
+func (router *WeightedRoundRobin) next() int {
+	router.guard.Lock()
+	defer router.guard.Unlock()
+
+	selected := 0
+	for i, target := range router.targets {
+		router.current[i] += target.weight
+		if router.current[i] > router.current[selected] {
+			selected = i
+		}
+	}
+
+	router.current[selected] -= router.totalWeight
+	return selected
+}
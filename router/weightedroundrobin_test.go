@@ -0,0 +1,88 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"testing"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/ttesting"
+)
+
+func TestWeightedRoundRobinDistribution(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "router.WeightedRoundRobin")
+	config.Override("Stream", "wrrStream")
+	config.Override("TargetStreams", map[string]interface{}{
+		"wrrA": 5,
+		"wrrB": 1,
+		"wrrC": 1,
+		"wrrD": 0,
+	})
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	router, casted := plugin.(*WeightedRoundRobin)
+	expect.True(casted)
+
+	counts := make([]int, len(router.targets))
+	for i := 0; i < 7000; i++ {
+		counts[router.next()]++
+	}
+
+	// Targets are sorted by name
+	expect.Equal(5000, counts[0])
+	expect.Equal(1000, counts[1])
+	expect.Equal(1000, counts[2])
+	expect.Equal(0, counts[3])
+}
+
+func TestWeightedRoundRobinSmooth(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "router.WeightedRoundRobin")
+	config.Override("Stream", "wrrStream")
+	config.Override("TargetStreams", map[string]interface{}{
+		"wrrA": 5,
+		"wrrB": 1,
+		"wrrC": 1,
+	})
+
+	plugin, err := core.NewPluginWithConfig(config)
+	expect.NoError(err)
+
+	router, casted := plugin.(*WeightedRoundRobin)
+	expect.True(casted)
+
+	// nginx sequence for weights 5,1,1: a a b a c a a
+	sequence := []int{}
+	for i := 0; i < 7; i++ {
+		sequence = append(sequence, router.next())
+	}
+	expect.Equal([]int{0, 0, 1, 0, 2, 0, 0}, sequence)
+}
+
+func TestWeightedRoundRobinInvalidWeight(t *testing.T) {
+	expect := ttesting.NewExpect(t)
+
+	config := core.NewPluginConfig("", "router.WeightedRoundRobin")
+	config.Override("TargetStreams", map[string]interface{}{"wrrA": -1})
+
+	_, err := core.NewPluginWithConfig(config)
+	expect.NotNil(err)
+}
@@ -0,0 +1,76 @@
+// Copyright 2015-2018 trivago N.V.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package router
+
+import (
+	"sort"
+
+	"gollum/core"
+
+	"github.com/trivago/tgo/tcontainer"
+)
+
+// weightedStream is a target stream with a routing weight
+type weightedStream struct {
+	streamID core.MessageStreamID
+	weight   int
+}
+
+// getWeightedStreams reads a list of stream names or a map of stream names
+// to integer weights from the given key. Streams given as list have a
+// weight of 1. Map entries are sorted by stream name so that the result does
+// not depend on the order of the config file.
+func getWeightedStreams(conf core.PluginConfigReader, key string) []weightedStream {
+	value := conf.GetValue(key, nil)
+	if value == nil {
+		return []weightedStream{}
+	}
+
+	if _, isArray := value.([]interface{}); isArray {
+		streams := []weightedStream{}
+		for _, streamID := range conf.GetStreamArray(key, []core.MessageStreamID{}) {
+			streams = append(streams, weightedStream{streamID: streamID, weight: 1})
+		}
+		return streams
+	}
+
+	weights, err := tcontainer.ConvertToMarshalMap(value, nil)
+	if conf.Errors.Push(err) {
+		return []weightedStream{}
+	}
+
+	names := make([]string, 0, len(weights))
+	for name := range weights {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	streams := make([]weightedStream, 0, len(names))
+	for _, name := range names {
+		weight, err := weights.Int(name)
+		if conf.Errors.Push(err) {
+			continue
+		}
+		if weight < 0 {
+			conf.Errors.Pushf("Weight of stream %s must not be negative", name)
+			continue
+		}
+		streams = append(streams, weightedStream{
+			streamID: core.GetStreamID(name),
+			weight:   int(weight),
+		})
+	}
+	return streams
+}